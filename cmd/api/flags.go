@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"io"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+// options are the command line flags. Each one given overrides the
+// variable it stands for; config.Load checks the values.
+type options struct {
+	vars map[string]string
+
+	// command is the first argument after the flags, such as backfill.
+	command string
+}
+
+func parseFlags(args []string, stderr io.Writer) (options, error) {
+	fs := flag.NewFlagSet("urlshortener", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	names := map[string]string{
+		"config":    "CONFIG_FILE",
+		"bind":      "DOMAIN",
+		"port":      "PORT",
+		"log-level": "LOG_LEVEL",
+		"migrate":   "AUTO_MIGRATE",
+	}
+	fs.String("config", "", "YAML or TOML `file` of settings (CONFIG_FILE)")
+	fs.String("bind", "", "`host` to listen on (DOMAIN)")
+	fs.String("port", "", "`port` to listen on (PORT)")
+	fs.String("log-level", "", "debug, info or error (LOG_LEVEL)")
+	fs.Bool("migrate", true, "create the MongoDB or Cassandra schema (AUTO_MIGRATE)")
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+
+	opts := options{vars: make(map[string]string), command: fs.Arg(0)}
+	fs.Visit(func(f *flag.Flag) {
+		opts.vars[names[f.Name]] = f.Value.String()
+	})
+	return opts, nil
+}
+
+// override makes the flags given win over the environment, .env and the
+// configuration file on every config.Load, reloads included.
+func (opts options) override() {
+	for key, value := range opts.vars {
+		config.Override(key, value)
+	}
+}
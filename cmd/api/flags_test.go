@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+func TestFlags(t *testing.T) {
+	t.Setenv("BASE_URL", "https://sho.rt/")
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("DOMAIN", "localhost")
+	t.Setenv("PORT", "3001")
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("AUTO_MIGRATE", "true")
+
+	opts, err := parseFlags([]string{"-port", "9090", "-bind", "0.0.0.0", "-log-level", "ERROR", "-migrate=false", "backfill"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags() failed: %v", err)
+	}
+	if opts.command != "backfill" {
+		t.Errorf("Expected the backfill command, got %q", opts.command)
+	}
+	want := map[string]string{"PORT": "9090", "DOMAIN": "0.0.0.0", "LOG_LEVEL": "ERROR", "AUTO_MIGRATE": "false"}
+	if len(opts.vars) != len(want) {
+		t.Errorf("Expected only the flags given, got %v", opts.vars)
+	}
+	for key, value := range want {
+		if opts.vars[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, opts.vars[key])
+		}
+	}
+
+	opts.override()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.BindAddr() != "0.0.0.0:9090" || cfg.LogLevel != config.LogError || cfg.AutoMigrate {
+		t.Errorf("Expected the flags to override the environment, got %s, %q and %v", cfg.BindAddr(), cfg.LogLevel, cfg.AutoMigrate)
+	}
+
+	if _, err := parseFlags([]string{"-verbose"}, io.Discard); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+}
@@ -1,29 +1,128 @@
+// Command api runs the shortener's server, which make builds as
+// bin/urlshortener.
+//
+//	urlshortener [-config FILE] [-bind HOST] [-port PORT] [-log-level LEVEL] [-migrate=false] [backfill]
+//
+// Flags override the environment and the configuration file.
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"urlshortener/urlshortener/internal/config"
 	"urlshortener/urlshortener/internal/db"
 	"urlshortener/urlshortener/internal/http"
+	"urlshortener/urlshortener/internal/repo"
+
+	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	opts, err := parseFlags(os.Args[1:], os.Stderr)
+	if err != nil {
+		os.Exit(2)
+	}
+	opts.override()
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cfg.LogLevel == config.LogDebug {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
-	pg, err := db.Open(cfg)
+	// New database connections log in as the latest configuration says.
+	var current atomic.Pointer[config.Config]
+	current.Store(&cfg)
+	pg, err := db.Open(cfg, func() (string, string) {
+		c := current.Load()
+		return c.DBUser, c.DBPass
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer pg.Close()
+	if pg != nil {
+		defer pg.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	engine := http.NewServer(cfg, pg)
+	app := http.NewApp(cfg, pg)
+	app.OnReload(current.Store)
+	if opts.command == "backfill" {
+		backfill(ctx, app)
+		return
+	}
+	app.WarmCache(ctx)
+	app.StartWorkers(ctx)
 
-	if err := engine.Run(cfg.BindAddr()); err != nil {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := app.Reload(); err != nil {
+				log.Printf("reload: %v", err)
+			} else {
+				log.Printf("reload: configuration reloaded")
+			}
+		}
+	}()
+	if cfg.SecretsRefresh > 0 {
+		go refreshSecrets(ctx, app, cfg.SecretsRefresh)
+	}
+
+	if err := http.ListenAndServe(ctx, cfg, app.Engine); err != nil {
 		log.Fatal(err)
 	}
+	app.Wait()
+}
+
+// refreshSecrets reloads the configuration every interval until ctx is
+// done, fetching the secrets it refers to again.
+func refreshSecrets(ctx context.Context, app *http.App, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := app.Reload(); err != nil {
+				log.Printf("secrets: %v", err)
+			}
+		}
+	}
+}
+
+// backfill copies the links of MIGRATE_FROM's backend that DB_DRIVER's lacks,
+// logging progress every few seconds, and exits non-zero on failure or when
+// some links could not be copied.
+func backfill(ctx context.Context, app *http.App) {
+	last := time.Now()
+	res, err := app.Backfill(ctx, func(res repo.BackfillResult) {
+		if time.Since(last) >= 5*time.Second {
+			last = time.Now()
+			log.Printf("backfill: %d copied, %d present", res.Copied, res.Present)
+		}
+	})
+	log.Printf("backfill: %d copied, %d present, %d conflicting", res.Copied, res.Present, len(res.Conflicts))
+	for _, code := range res.Conflicts {
+		log.Printf("backfill: %s: destination has another code in DB_DRIVER's backend", code)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(res.Conflicts) > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,26 @@
+// Command openapi writes the API's OpenAPI document; see internal/openapi.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"urlshortener/urlshortener/internal/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	out := flag.String("o", "openapi.json", "output file")
+	flag.Parse()
+	gin.SetMode(gin.ReleaseMode)
+
+	spec, err := http.OpenAPISpec()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, spec, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
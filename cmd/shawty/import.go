@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"urlshortener/urlshortener/internal/client"
+	"urlshortener/urlshortener/internal/model"
+)
+
+// importBatch matches the server's limit on links per import request.
+const importBatch = 1000
+
+func importLinks(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := subcommand("import [-owner O] [-domain D] <file|->", stderr)
+	owner := fs.String("owner", "", "user the imported links belong to")
+	domain := fs.String("domain", "", "short domain the codes live on")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	links, err := readImport(r)
+	if err != nil {
+		return err
+	}
+
+	var imported, skipped int
+	for start := 0; start < len(links); start += importBatch {
+		end := min(start+importBatch, len(links))
+		res, err := c.Import(ctx, model.ImportReq{Owner: *owner, Domain: *domain, Links: links[start:end]})
+		if err != nil {
+			return fmt.Errorf("importing rows %d-%d: %w", start+1, end, err)
+		}
+		imported += res.Imported
+		skipped += len(res.Conflicts)
+		for _, cf := range res.Conflicts {
+			fmt.Fprintf(stderr, "row %d (%s): %s\n", start+cf.Row+1, cf.Code, cf.Reason)
+		}
+	}
+	fmt.Fprintf(stdout, "imported %d, skipped %d\n", imported, skipped)
+	return nil
+}
+
+// readImport reads links as a JSON array, as one JSON object per line, or as
+// CSV with a header naming the code, long_url (or url) and optional
+// created_at columns.
+func readImport(r io.Reader) ([]model.ImportLink, error) {
+	br := bufio.NewReader(r)
+	first, err := skipSpace(br)
+	if err != nil {
+		return nil, err
+	}
+	switch first {
+	case '[':
+		var links []model.ImportLink
+		if err := json.NewDecoder(br).Decode(&links); err != nil {
+			return nil, fmt.Errorf("reading JSON: %w", err)
+		}
+		return links, nil
+	case '{':
+		var links []model.ImportLink
+		dec := json.NewDecoder(br)
+		for {
+			var l model.ImportLink
+			err := dec.Decode(&l)
+			if errors.Is(err, io.EOF) {
+				return links, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading JSON line %d: %w", len(links)+1, err)
+			}
+			links = append(links, l)
+		}
+	}
+	return readCSV(br)
+}
+
+// skipSpace consumes leading white space and any byte order mark, and
+// returns the first rune after them without consuming it.
+func skipSpace(r *bufio.Reader) (rune, error) {
+	for {
+		c, _, err := r.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("nothing to import")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(c) && c != '\ufeff' {
+			return c, r.UnreadRune()
+		}
+	}
+}
+
+func readCSV(r io.Reader) ([]model.ImportLink, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	codeCol, ok := col["code"]
+	if !ok {
+		return nil, errors.New("CSV header has no code column")
+	}
+	urlCol, ok := col["long_url"]
+	if !ok {
+		if urlCol, ok = col["url"]; !ok {
+			return nil, errors.New("CSV header has no long_url or url column")
+		}
+	}
+	createdCol, hasCreated := col["created_at"]
+
+	var links []model.ImportLink
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return links, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		l := model.ImportLink{Code: field(row, codeCol), LongURL: field(row, urlCol)}
+		if s := field(row, createdCol); hasCreated && s != "" {
+			t, err := importTime(s)
+			if err != nil {
+				return nil, fmt.Errorf("CSV line %d: %w", line, err)
+			}
+			l.CreatedAt = &t
+		}
+		links = append(links, l)
+	}
+}
+
+func field(row []string, i int) string {
+	if i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
+
+// importTime reads an RFC 3339 timestamp, or a UTC "2006-01-02 15:04:05" one
+// as databases tend to export.
+func importTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid created_at %q", s)
+}
@@ -0,0 +1,265 @@
+// Command shawty is a command line client for the shortener's HTTP API.
+//
+//	shawty [-server URL] [-key KEY] shorten [-domain D] [-expires T] [-utm k=v]... <url>
+//	shawty resolve <code>
+//	shawty list [-limit N] [-offset N] [-json]
+//	shawty delete <code>
+//	shawty export [-stats] [-cursor CODE]
+//	shawty import [-owner O] [-domain D] <file|->
+//
+// The server and API key default to $SHAWTY_SERVER and $SHAWTY_API_KEY.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"urlshortener/urlshortener/internal/client"
+	"urlshortener/urlshortener/internal/model"
+)
+
+const defaultServer = "http://localhost:3001"
+
+const usage = `usage: shawty [-server URL] [-key KEY] <command> [args]
+
+commands:
+  shorten [-domain D] [-expires T] [-utm key=value]... <url>
+  resolve <code>
+  list [-limit N] [-offset N] [-json]
+  delete <code>
+  export [-stats] [-cursor CODE]
+  import [-owner O] [-domain D] <file|->   (admin key; CSV, JSON or NDJSON)
+
+The server and API key default to $SHAWTY_SERVER and $SHAWTY_API_KEY.
+`
+
+// errUsage signals a command line mistake; usage has already been printed.
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "shawty:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("shawty", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+
+	server := fs.String("server", or(getenv("SHAWTY_SERVER"), defaultServer), "shortener base URL")
+	key := fs.String("key", getenv("SHAWTY_API_KEY"), "API key")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	c := client.New(*server, *key)
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "shorten":
+		return shorten(ctx, c, rest, stdout, stderr)
+	case "resolve":
+		return resolve(ctx, c, rest, stdout, stderr)
+	case "list":
+		return list(ctx, c, rest, stdout, stderr)
+	case "delete":
+		return del(ctx, c, rest, stdout, stderr)
+	case "export":
+		return export(ctx, c, rest, stdout, stderr)
+	case "import":
+		return importLinks(ctx, c, rest, stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "shawty: unknown command %q\n", cmd)
+	fs.Usage()
+	return errUsage
+}
+
+func shorten(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := subcommand("shorten [-domain D] [-expires T] [-utm key=value]... <url>", stderr)
+	domain := fs.String("domain", "", "short domain to create the link on")
+	expires := fs.String("expires", "", "expiry as an RFC 3339 time or a duration from now, e.g. 72h")
+	utm := params{}
+	fs.Var(utm, "utm", "campaign parameter as key=value; repeatable")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	req := model.CreateReq{URL: fs.Arg(0), Domain: *domain}
+	if len(utm) > 0 {
+		req.UTM = utm
+	}
+	if *expires != "" {
+		t, err := expiry(*expires, time.Now())
+		if err != nil {
+			return err
+		}
+		req.ExpiresAt = &t
+	}
+
+	rec, err := c.Shorten(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, rec.ShortUrl)
+	return nil
+}
+
+func resolve(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := subcommand("resolve <code>", stderr)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	long, err := c.Resolve(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, long)
+	return nil
+}
+
+func list(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := subcommand("list [-query TEXT] [-limit N] [-offset N] [-json]", stderr)
+	query := fs.String("query", "", "only links whose destination contains TEXT")
+	limit := fs.Int("limit", 50, "links per page, at most 500")
+	offset := fs.Int("offset", 0, "links to skip")
+	asJSON := fs.Bool("json", false, "print the links as JSON")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	recs, err := c.List(ctx, *query, *limit, *offset)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(recs)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODE\tSTATUS\tCREATED\tDESTINATION")
+	for _, rec := range recs {
+		status := "active"
+		if !rec.Active {
+			status = "disabled"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rec.Code, status, rec.CreatedAt.Local().Format(time.DateTime), rec.LongUrl)
+	}
+	return tw.Flush()
+}
+
+func del(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := subcommand("delete <code>", stderr)
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	return c.Delete(ctx, fs.Arg(0))
+}
+
+// exportChunk is how many links export fetches per request.
+const exportChunk = 1000
+
+func export(ctx context.Context, c *client.Client, args []string, stdout, stderr io.Writer) error {
+	fs := subcommand("export [-stats] [-cursor CODE]", stderr)
+	stats := fs.Bool("stats", false, "include click totals")
+	cursor := fs.String("cursor", "", "resume after this code, e.g. the last one of an interrupted export")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(stdout)
+	for {
+		links, err := c.Export(ctx, *cursor, exportChunk, *stats)
+		for _, l := range links {
+			if err := enc.Encode(l); err != nil {
+				return err
+			}
+			*cursor = l.Code
+		}
+		if err != nil && *cursor != "" {
+			return fmt.Errorf("export stopped; resume with -cursor %s: %w", *cursor, err)
+		}
+		if err != nil {
+			return err
+		}
+		if len(links) < exportChunk {
+			return nil
+		}
+	}
+}
+
+func subcommand(synopsis string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(strings.Fields(synopsis)[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: shawty %s\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses a subcommand's flags and requires exactly n arguments after them.
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// expiry reads an RFC 3339 time, or a duration counted from now.
+func expiry(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -expires %q: want an RFC 3339 time or a duration", s)
+	}
+	return t, nil
+}
+
+// params collects repeated key=value flags.
+type params map[string]string
+
+func (p params) String() string { return "" }
+
+func (p params) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	p[k] = v
+	return nil
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+	apphttp "urlshortener/urlshortener/internal/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	srv := httptest.NewServer(apphttp.NewServer(config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"s3cret": "alice", "root-key": "root"},
+		AdminOwners: []string{"root"},
+	}, nil))
+	defer srv.Close()
+
+	env := map[string]string{"SHAWTY_SERVER": srv.URL, "SHAWTY_API_KEY": "s3cret"}
+	shawty := func(args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		err := run(context.Background(), args, func(k string) string { return env[k] }, &stdout, &stderr)
+		return stdout.String(), err
+	}
+
+	out, err := shawty("shorten", "-utm", "utm_source=cli", "-expires", "1h", "https://example.com/cli")
+	if err != nil {
+		t.Fatalf("shorten failed: %v", err)
+	}
+	short := strings.TrimSpace(out)
+	if !strings.HasPrefix(short, "https://shawt.ly/") {
+		t.Fatalf("expected a short URL, got %q", out)
+	}
+	code := strings.TrimPrefix(short, "https://shawt.ly/")
+
+	if out, err := shawty("resolve", code); err != nil || strings.TrimSpace(out) != "https://example.com/cli?utm_source=cli" {
+		t.Errorf("resolve: got %q, %v", out, err)
+	}
+
+	out, err = shawty("list")
+	if err != nil || !strings.Contains(out, code) || !strings.Contains(out, "https://example.com/cli") {
+		t.Errorf("list: got %q, %v", out, err)
+	}
+
+	if out, err := shawty("export", "-stats"); err != nil || !strings.Contains(out, `"code":"`+code+`"`) {
+		t.Errorf("export: got %q, %v", out, err)
+	}
+
+	if _, err := shawty("delete", code); err != nil {
+		t.Errorf("delete failed: %v", err)
+	}
+	if _, err := shawty("resolve", code); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 after delete, got %v", err)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "links.csv")
+	os.WriteFile(file, []byte("code,long_url\nold-1,https://example.com/old\nold-1,https://example.com/dup\n"), 0o644)
+	if out, err := shawty("-key", "root-key", "import", "-owner", "alice", file); err != nil || out != "imported 1, skipped 1\n" {
+		t.Errorf("import: got %q, %v", out, err)
+	}
+	if out, err := shawty("resolve", "old-1"); err != nil || strings.TrimSpace(out) != "https://example.com/old" {
+		t.Errorf("resolve imported: got %q, %v", out, err)
+	}
+
+	// Flags override the environment.
+	if _, err := shawty("-key", "wrong", "list"); err == nil || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Errorf("expected the -key flag to be used, got %v", err)
+	}
+
+	for _, args := range [][]string{{}, {"frobnicate"}, {"resolve"}, {"shorten", "-utm", "novalue", "https://example.com/"}} {
+		if _, err := shawty(args...); err != errUsage {
+			t.Errorf("%q: expected usage error, got %v", args, err)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if got, err := expiry("90m", now); err != nil || !got.Equal(now.Add(90*time.Minute)) {
+		t.Errorf("duration: got %v, %v", got, err)
+	}
+	if got, err := expiry("2025-01-01T00:00:00Z", now); err != nil || got.Year() != 2025 {
+		t.Errorf("timestamp: got %v, %v", got, err)
+	}
+	if _, err := expiry("tomorrow", now); err == nil {
+		t.Error("expected an error for an unparsable expiry")
+	}
+}
+
+func TestReadImport(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, in := range map[string]string{
+		"csv":    "\ufeffCode,URL,Created_At\nabc,https://example.com/a,2020-01-02 03:04:05\nxyz,https://example.com/x,\n",
+		"json":   ` [{"code":"abc","long_url":"https://example.com/a","created_at":"2020-01-02T03:04:05Z"},{"code":"xyz","long_url":"https://example.com/x"}]`,
+		"ndjson": "{\"code\":\"abc\",\"long_url\":\"https://example.com/a\",\"created_at\":\"2020-01-02T03:04:05Z\"}\n{\"code\":\"xyz\",\"long_url\":\"https://example.com/x\"}\n",
+	} {
+		links, err := readImport(strings.NewReader(in))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(links) != 2 || links[0].Code != "abc" || links[1].LongURL != "https://example.com/x" {
+			t.Errorf("%s: got %+v", name, links)
+			continue
+		}
+		if links[0].CreatedAt == nil || !links[0].CreatedAt.Equal(created) || links[1].CreatedAt != nil {
+			t.Errorf("%s: expected only the first link to be dated, got %v and %v", name, links[0].CreatedAt, links[1].CreatedAt)
+		}
+	}
+
+	for _, in := range []string{"", "code,target\nabc,https://example.com/\n", "code,url,created_at\nabc,https://example.com/,yesterday\n"} {
+		if _, err := readImport(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+-- Responses to requests sent with an Idempotency-Key, replayed on retries.
+-- status is 0 while the first request is still in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  owner           TEXT NOT NULL,
+  idempotency_key TEXT NOT NULL,
+  request_hash    TEXT NOT NULL,
+  status          INTEGER NOT NULL DEFAULT 0,
+  headers         TEXT NOT NULL DEFAULT '',
+  body            BYTEA,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (owner, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx
+  ON idempotency_keys (created_at);
@@ -0,0 +1,6 @@
+-- Destination hosts operators have banned; subdomains are banned with them
+CREATE TABLE IF NOT EXISTS banned_domains (
+  domain     TEXT PRIMARY KEY,
+  reason     TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+-- Trigram index so searching links by destination (long_url ILIKE '%...%')
+-- does not scan the whole table
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS url_records_long_url_trgm_idx
+  ON url_records USING gin (long_url gin_trgm_ops);
@@ -0,0 +1,4 @@
+-- Owner-editable title and notes for each link
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS title       TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- Organizations share a link namespace among their members. Links created
+-- for an organization record it in url_records.org; owner stays the member
+-- who created them.
+CREATE TABLE IF NOT EXISTS orgs (
+  slug       TEXT        PRIMARY KEY,
+  name       TEXT        NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- role is 'admin' or 'member'; admins manage the member list.
+CREATE TABLE IF NOT EXISTS org_members (
+  org        TEXT        NOT NULL REFERENCES orgs (slug) ON DELETE CASCADE,
+  owner      TEXT        NOT NULL,
+  role       TEXT        NOT NULL DEFAULT 'member',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (org, owner)
+);
+
+CREATE INDEX IF NOT EXISTS org_members_owner_idx ON org_members (owner);
+
+ALTER TABLE url_records ADD COLUMN IF NOT EXISTS org TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS url_records_org_idx ON url_records (org, created_at DESC);
@@ -0,0 +1,2 @@
+-- Counter behind the sequence code strategy; each value becomes one code.
+CREATE SEQUENCE IF NOT EXISTS code_seq;
@@ -0,0 +1,7 @@
+-- Values the service adjusts at run time and must keep across restarts,
+-- such as the current length of random codes.
+CREATE TABLE IF NOT EXISTS settings (
+  name       TEXT        PRIMARY KEY,
+  value      TEXT        NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
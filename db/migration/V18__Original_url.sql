@@ -0,0 +1,3 @@
+-- The destination as submitted, when tracking parameters were stripped from long_url
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS original_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Unique links get a code of their own even when their destination already
+-- has a link, so only the other links stay one per destination and domain
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS dedup BOOLEAN NOT NULL DEFAULT true;
+
+DROP INDEX IF EXISTS url_records_domain_long_url_key;
+
+CREATE UNIQUE INDEX url_records_domain_long_url_key
+  ON url_records (domain, long_url) WHERE dedup;
@@ -0,0 +1,12 @@
+-- Clicks per link and UTC day, rolled up from click_events by the rollup
+-- worker so stats queries read one row per day instead of every click.
+CREATE TABLE IF NOT EXISTS click_daily (
+  code    TEXT   NOT NULL,
+  day     DATE   NOT NULL,
+  clicks  BIGINT NOT NULL,
+  PRIMARY KEY (code, day)
+);
+
+-- The rollup rescans events by time alone.
+CREATE INDEX IF NOT EXISTS click_events_clicked_at_idx
+  ON click_events (clicked_at);
@@ -0,0 +1,3 @@
+-- Region (ISO 3166-2 subdivision) of clicks located with a GeoIP database
+ALTER TABLE click_events
+  ADD COLUMN IF NOT EXISTS region TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- Who changed what, kept for abuse investigations. Link changes carry the
+-- record before and after as JSON; '' means there was none.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id              BIGSERIAL PRIMARY KEY,
+  action          TEXT NOT NULL,
+  actor           TEXT NOT NULL DEFAULT '',
+  subject         TEXT NOT NULL DEFAULT '',
+  before_snapshot TEXT NOT NULL DEFAULT '',
+  after_snapshot  TEXT NOT NULL DEFAULT '',
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id);
+CREATE INDEX IF NOT EXISTS audit_log_subject_idx ON audit_log (subject, id);
@@ -0,0 +1,13 @@
+-- Links belong to a tenant, resolved from the Host of the request that made
+-- them; '' is the default tenant. Each tenant keeps one link per destination
+-- and domain of its own.
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS url_records_domain_long_url_key;
+
+CREATE UNIQUE INDEX url_records_domain_long_url_key
+  ON url_records (tenant_id, domain, long_url) WHERE dedup;
+
+CREATE INDEX IF NOT EXISTS url_records_tenant_created_idx
+  ON url_records (tenant_id, created_at DESC);
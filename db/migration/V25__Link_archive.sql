@@ -0,0 +1,30 @@
+-- Links unused for a long time, moved out of url_records by the archive job
+-- to keep it and its indexes small, and moved back when next looked up.
+-- The columns mirror url_records; archived codes stay taken.
+CREATE TABLE IF NOT EXISTS url_records_archive (
+  code         TEXT PRIMARY KEY,
+  id           UUID NOT NULL,
+  long_url     TEXT NOT NULL,
+  short_url    TEXT NOT NULL,
+  created_at   TIMESTAMPTZ NOT NULL,
+  scan_status  TEXT NOT NULL,
+  scanned_at   TIMESTAMPTZ,
+  utm_params   TEXT NOT NULL,
+  owner        TEXT NOT NULL,
+  updated_at   TIMESTAMPTZ NOT NULL,
+  active       BOOLEAN NOT NULL,
+  domain       TEXT NOT NULL,
+  expires_at   TIMESTAMPTZ,
+  title        TEXT NOT NULL,
+  description  TEXT NOT NULL,
+  org          TEXT NOT NULL,
+  original_url TEXT NOT NULL,
+  dedup        BOOLEAN NOT NULL,
+  max_clicks   INTEGER NOT NULL,
+  click_count  BIGINT NOT NULL,
+  tenant_id    TEXT NOT NULL,
+  archived_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- User erasure finds an owner's archived links.
+CREATE INDEX IF NOT EXISTS url_records_archive_owner_idx ON url_records_archive (owner);
@@ -0,0 +1,7 @@
+-- Leases on background jobs, so that of several instances only the one
+-- holding a job's lease runs it. A lease past locked_until is free to take.
+CREATE TABLE IF NOT EXISTS job_locks (
+  name         TEXT PRIMARY KEY,
+  owner        TEXT NOT NULL,
+  locked_until TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,10 @@
+-- Links operators have taken down for abuse, with the reason shown to
+-- visitors. Their owners cannot enable them again while a row remains.
+CREATE TABLE IF NOT EXISTS takedowns (
+  code       TEXT PRIMARY KEY,
+  owner      TEXT NOT NULL DEFAULT '',
+  reason     TEXT NOT NULL,
+  note       TEXT NOT NULL DEFAULT '',
+  taken_by   TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
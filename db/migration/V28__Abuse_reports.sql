@@ -0,0 +1,14 @@
+-- Links reported as abusive by anyone, queued for operators to review.
+CREATE TABLE IF NOT EXISTS abuse_reports (
+  id          BIGSERIAL PRIMARY KEY,
+  code        TEXT NOT NULL,
+  reason      TEXT NOT NULL,
+  details     TEXT NOT NULL DEFAULT '',
+  contact     TEXT NOT NULL DEFAULT '',
+  status      TEXT NOT NULL DEFAULT 'pending',
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  reviewed_by TEXT NOT NULL DEFAULT '',
+  reviewed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS abuse_reports_status_idx ON abuse_reports (status, id);
@@ -0,0 +1,12 @@
+-- New links held back because their destination's domain scored below
+-- REPUTATION_THRESHOLD. They stay disabled until an operator approves them.
+CREATE TABLE IF NOT EXISTS link_reviews (
+  code       TEXT PRIMARY KEY,
+  owner      TEXT NOT NULL DEFAULT '',
+  domain     TEXT NOT NULL,
+  score      INTEGER NOT NULL,
+  reasons    TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS link_reviews_created_at_idx ON link_reviews (created_at);
@@ -0,0 +1,7 @@
+-- Malware/phishing scan state per link
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT 'unchecked',
+  ADD COLUMN IF NOT EXISTS scanned_at  TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS url_records_scanned_at_idx
+  ON url_records (scanned_at NULLS FIRST) WHERE scan_status <> 'flagged';
@@ -0,0 +1,11 @@
+-- The latest liveness check of each link's destination, made when the link
+-- is created or its destination changes and repeated by the liveness job.
+CREATE TABLE IF NOT EXISTS link_checks (
+  code       TEXT PRIMARY KEY,
+  status     INTEGER NOT NULL DEFAULT 0,
+  error      TEXT NOT NULL DEFAULT '',
+  dead       BOOLEAN NOT NULL DEFAULT false,
+  checked_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS link_checks_checked_at_idx ON link_checks (checked_at);
@@ -0,0 +1,11 @@
+-- What each link's destination page says about itself, fetched in the
+-- background when FETCH_METADATA is on.
+CREATE TABLE IF NOT EXISTS link_page_meta (
+  code        TEXT PRIMARY KEY,
+  title       TEXT NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  site_name   TEXT NOT NULL DEFAULT '',
+  image       TEXT NOT NULL DEFAULT '',
+  favicon     TEXT NOT NULL DEFAULT '',
+  fetched_at  TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Where visitors go once a link is disabled, expired or out of clicks
+-- ('' for the error page).
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE url_records_archive
+  ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT '';
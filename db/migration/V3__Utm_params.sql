@@ -0,0 +1,4 @@
+-- Campaign parameters appended to the destination at redirect time,
+-- stored as an encoded query string
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS utm_params TEXT NOT NULL DEFAULT '';
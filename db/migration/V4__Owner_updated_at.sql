@@ -0,0 +1,6 @@
+-- Link ownership (API key owner, '' for anonymous links) and edit tracking
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS owner      TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS url_records_owner_idx ON url_records (owner) WHERE owner <> '';
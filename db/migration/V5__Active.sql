@@ -0,0 +1,3 @@
+-- Soft delete: disabled links answer 410 but keep their code reserved
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
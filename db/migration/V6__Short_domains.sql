@@ -0,0 +1,9 @@
+-- Links live on one of the configured short domains ('' is the BASE_URL
+-- domain), and a destination can have one link per domain
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE url_records DROP CONSTRAINT IF EXISTS url_records_long_url_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS url_records_domain_long_url_key
+  ON url_records (domain, long_url);
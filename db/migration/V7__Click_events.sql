@@ -0,0 +1,13 @@
+-- Raw click events, written in batches by the click writer
+CREATE TABLE IF NOT EXISTS click_events (
+  id          BIGSERIAL PRIMARY KEY,
+  code        TEXT NOT NULL,
+  clicked_at  TIMESTAMPTZ NOT NULL,
+  referrer    TEXT NOT NULL DEFAULT '',
+  ip_hash     TEXT NOT NULL DEFAULT '',
+  user_agent  TEXT NOT NULL DEFAULT '',
+  country     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS click_events_code_clicked_at_idx
+  ON click_events (code, clicked_at);
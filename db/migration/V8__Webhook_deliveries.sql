@@ -0,0 +1,17 @@
+-- Outbox of webhook deliveries, one row per event and endpoint
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               UUID PRIMARY KEY,
+  endpoint         TEXT NOT NULL,
+  event            TEXT NOT NULL,
+  payload          TEXT NOT NULL,
+  status           TEXT NOT NULL DEFAULT 'pending',
+  attempts         INTEGER NOT NULL DEFAULT 0,
+  last_status_code INTEGER NOT NULL DEFAULT 0,
+  last_error       TEXT NOT NULL DEFAULT '',
+  next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  delivered_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+  ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
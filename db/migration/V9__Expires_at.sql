@@ -0,0 +1,6 @@
+-- Optional expiry: expired links answer 410 until the cleanup worker purges them
+ALTER TABLE url_records
+  ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS url_records_expires_at_idx
+  ON url_records (expires_at) WHERE expires_at IS NOT NULL;
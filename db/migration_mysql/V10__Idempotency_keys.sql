@@ -0,0 +1,13 @@
+-- Responses to requests sent with an Idempotency-Key, replayed on retries.
+-- status is 0 while the first request is still in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  owner           VARCHAR(128) NOT NULL,
+  idempotency_key VARCHAR(255) NOT NULL,
+  request_hash    CHAR(64)     NOT NULL,
+  status          INT          NOT NULL DEFAULT 0,
+  headers         TEXT         NOT NULL,
+  body            MEDIUMBLOB   NULL,
+  created_at      DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (owner, idempotency_key),
+  INDEX idempotency_keys_created_at_idx (created_at)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,6 @@
+-- Destination hosts operators have banned; subdomains are banned with them
+CREATE TABLE IF NOT EXISTS banned_domains (
+  domain     VARCHAR(253)  NOT NULL PRIMARY KEY,
+  reason     VARCHAR(1024) NOT NULL DEFAULT '',
+  created_at DATETIME(6)   NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
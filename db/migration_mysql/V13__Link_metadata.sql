@@ -0,0 +1,4 @@
+-- Owner-editable title and notes for each link
+ALTER TABLE url_records
+  ADD COLUMN title       VARCHAR(512)  NOT NULL DEFAULT '',
+  ADD COLUMN description VARCHAR(2048) NOT NULL DEFAULT '';
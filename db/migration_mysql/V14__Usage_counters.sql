@@ -0,0 +1,9 @@
+-- Per-owner usage counted against quotas: new links per day and recorded
+-- clicks per month. period is the first day of the counted day or month.
+CREATE TABLE IF NOT EXISTS usage_counters (
+  owner  VARCHAR(128) NOT NULL,
+  metric VARCHAR(32)  NOT NULL,
+  period DATE         NOT NULL,
+  count  INT          NOT NULL DEFAULT 0,
+  PRIMARY KEY (owner, metric, period)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,23 @@
+-- Organizations share a link namespace among their members. Links created
+-- for an organization record it in url_records.org; owner stays the member
+-- who created them.
+CREATE TABLE IF NOT EXISTS orgs (
+  slug       VARCHAR(64)  NOT NULL PRIMARY KEY,
+  name       VARCHAR(200) NOT NULL DEFAULT '',
+  created_at DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- role is 'admin' or 'member'; admins manage the member list.
+CREATE TABLE IF NOT EXISTS org_members (
+  org        VARCHAR(64)  NOT NULL,
+  owner      VARCHAR(128) NOT NULL,
+  role       VARCHAR(16)  NOT NULL DEFAULT 'member',
+  created_at DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (org, owner),
+  INDEX org_members_owner_idx (owner),
+  FOREIGN KEY (org) REFERENCES orgs (slug) ON DELETE CASCADE
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+ALTER TABLE url_records
+  ADD COLUMN org VARCHAR(64) NOT NULL DEFAULT '',
+  ADD INDEX url_records_org_idx (org, created_at);
@@ -0,0 +1,8 @@
+-- Counter behind the sequence code strategy; each value becomes one code.
+-- MySQL has no sequences, so a single row is bumped with LAST_INSERT_ID.
+CREATE TABLE IF NOT EXISTS code_sequence (
+  n BIGINT UNSIGNED NOT NULL
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+INSERT INTO code_sequence (n)
+SELECT 0 FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM code_sequence);
@@ -0,0 +1,7 @@
+-- Values the service adjusts at run time and must keep across restarts,
+-- such as the current length of random codes.
+CREATE TABLE IF NOT EXISTS settings (
+  name       VARCHAR(64) NOT NULL PRIMARY KEY,
+  value      TEXT        NOT NULL,
+  updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
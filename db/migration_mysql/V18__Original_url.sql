@@ -0,0 +1,4 @@
+-- The destination as submitted, when tracking parameters were stripped from long_url.
+-- TEXT columns take no default here, so rows without one hold NULL.
+ALTER TABLE url_records
+  ADD COLUMN original_url TEXT;
@@ -0,0 +1,8 @@
+-- Unique links get a code of their own even when their destination already
+-- has a link, so only the other links stay one per destination and domain.
+-- Unique links have a NULL dedup_hash, which the unique index lets repeat.
+ALTER TABLE url_records
+  ADD COLUMN dedup      BOOLEAN  NOT NULL DEFAULT TRUE,
+  ADD COLUMN dedup_hash CHAR(64) AS (IF(dedup, SHA2(long_url, 256), NULL)) STORED,
+  DROP INDEX url_records_domain_long_url,
+  ADD UNIQUE INDEX url_records_domain_long_url (domain, dedup_hash);
@@ -0,0 +1,10 @@
+-- URL shortener core table (MySQL 5.7+ / MariaDB 10.2+)
+-- long_url is TEXT and cannot be indexed in full, so uniqueness is enforced on its hash.
+CREATE TABLE IF NOT EXISTS url_records (
+  id             CHAR(36)     NOT NULL PRIMARY KEY,
+  code           VARCHAR(64)  NOT NULL UNIQUE,
+  long_url       TEXT         NOT NULL,
+  long_url_hash  CHAR(64)     AS (SHA2(long_url, 256)) STORED UNIQUE,
+  short_url      TEXT         NOT NULL,
+  created_at     DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
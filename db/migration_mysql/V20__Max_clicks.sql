@@ -0,0 +1,5 @@
+-- Links that disable themselves after max_clicks redirects (0 for no limit).
+-- click_count only counts redirects of such links.
+ALTER TABLE url_records
+  ADD COLUMN max_clicks  INT    NOT NULL DEFAULT 0,
+  ADD COLUMN click_count BIGINT NOT NULL DEFAULT 0;
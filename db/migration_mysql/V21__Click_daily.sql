@@ -0,0 +1,11 @@
+-- Clicks per link and UTC day, rolled up from click_events by the rollup
+-- worker so stats queries read one row per day instead of every click.
+CREATE TABLE IF NOT EXISTS click_daily (
+  code    VARCHAR(64) NOT NULL,
+  day     DATE        NOT NULL,
+  clicks  BIGINT      NOT NULL,
+  PRIMARY KEY (code, day)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- The rollup rescans events by time alone.
+CREATE INDEX click_events_clicked_at_idx ON click_events (clicked_at);
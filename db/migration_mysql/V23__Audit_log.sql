@@ -0,0 +1,13 @@
+-- Who changed what, kept for abuse investigations. Link changes carry the
+-- record before and after as JSON; '' means there was none.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id              BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  action          VARCHAR(64)  NOT NULL,
+  actor           VARCHAR(128) NOT NULL DEFAULT '',
+  subject         VARCHAR(255) NOT NULL DEFAULT '',
+  before_snapshot MEDIUMTEXT   NOT NULL,
+  after_snapshot  MEDIUMTEXT   NOT NULL,
+  created_at      DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  INDEX audit_log_actor_idx (actor, id),
+  INDEX audit_log_subject_idx (subject, id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,8 @@
+-- Links belong to a tenant, resolved from the Host of the request that made
+-- them; '' is the default tenant. Each tenant keeps one link per destination
+-- and domain of its own.
+ALTER TABLE url_records
+  ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '',
+  DROP INDEX url_records_domain_long_url,
+  ADD UNIQUE INDEX url_records_domain_long_url (tenant_id, domain, dedup_hash),
+  ADD INDEX url_records_tenant_created_idx (tenant_id, created_at);
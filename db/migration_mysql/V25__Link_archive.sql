@@ -0,0 +1,29 @@
+-- Links unused for a long time, moved out of url_records by the archive job
+-- to keep it and its indexes small, and moved back when next looked up.
+-- The columns mirror url_records, less the generated hashes; archived codes
+-- stay taken.
+CREATE TABLE IF NOT EXISTS url_records_archive (
+  code         VARCHAR(64)   NOT NULL PRIMARY KEY,
+  id           CHAR(36)      NOT NULL,
+  long_url     TEXT          NOT NULL,
+  short_url    TEXT          NOT NULL,
+  created_at   DATETIME(6)   NOT NULL,
+  scan_status  VARCHAR(16)   NOT NULL,
+  scanned_at   DATETIME(6)   NULL,
+  utm_params   VARCHAR(4096) NOT NULL,
+  owner        VARCHAR(128)  NOT NULL,
+  updated_at   DATETIME(6)   NOT NULL,
+  active       BOOLEAN       NOT NULL,
+  domain       VARCHAR(253)  NOT NULL,
+  expires_at   DATETIME(6)   NULL,
+  title        VARCHAR(512)  NOT NULL,
+  description  VARCHAR(2048) NOT NULL,
+  org          VARCHAR(64)   NOT NULL,
+  original_url TEXT          NULL,
+  dedup        BOOLEAN       NOT NULL,
+  max_clicks   INT           NOT NULL,
+  click_count  BIGINT        NOT NULL,
+  tenant_id    VARCHAR(64)   NOT NULL,
+  archived_at  DATETIME(6)   NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  INDEX url_records_archive_owner_idx (owner)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
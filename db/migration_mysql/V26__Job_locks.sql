@@ -0,0 +1,7 @@
+-- Leases on background jobs, so that of several instances only the one
+-- holding a job's lease runs it. A lease past locked_until is free to take.
+CREATE TABLE IF NOT EXISTS job_locks (
+  name         VARCHAR(64)  NOT NULL PRIMARY KEY,
+  owner        VARCHAR(255) NOT NULL,
+  locked_until DATETIME(6)  NOT NULL
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
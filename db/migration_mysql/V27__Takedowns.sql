@@ -0,0 +1,10 @@
+-- Links operators have taken down for abuse, with the reason shown to
+-- visitors. Their owners cannot enable them again while a row remains.
+CREATE TABLE IF NOT EXISTS takedowns (
+  code       VARCHAR(64)   NOT NULL PRIMARY KEY,
+  owner      VARCHAR(128)  NOT NULL DEFAULT '',
+  reason     VARCHAR(32)   NOT NULL,
+  note       VARCHAR(1024) NOT NULL DEFAULT '',
+  taken_by   VARCHAR(128)  NOT NULL DEFAULT '',
+  created_at DATETIME(6)   NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
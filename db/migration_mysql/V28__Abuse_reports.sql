@@ -0,0 +1,13 @@
+-- Links reported as abusive by anyone, queued for operators to review.
+CREATE TABLE IF NOT EXISTS abuse_reports (
+  id          BIGINT        NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  code        VARCHAR(64)   NOT NULL,
+  reason      VARCHAR(32)   NOT NULL,
+  details     VARCHAR(2000) NOT NULL DEFAULT '',
+  contact     VARCHAR(255)  NOT NULL DEFAULT '',
+  status      VARCHAR(16)   NOT NULL DEFAULT 'pending',
+  created_at  DATETIME(6)   NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  reviewed_by VARCHAR(128)  NOT NULL DEFAULT '',
+  reviewed_at DATETIME(6)   NULL,
+  INDEX abuse_reports_status_idx (status, id)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,11 @@
+-- New links held back because their destination's domain scored below
+-- REPUTATION_THRESHOLD. They stay disabled until an operator approves them.
+CREATE TABLE IF NOT EXISTS link_reviews (
+  code       VARCHAR(64)   NOT NULL PRIMARY KEY,
+  owner      VARCHAR(128)  NOT NULL DEFAULT '',
+  domain     VARCHAR(255)  NOT NULL,
+  score      INT           NOT NULL,
+  reasons    VARCHAR(1024) NOT NULL DEFAULT '',
+  created_at DATETIME(6)   NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  KEY link_reviews_created_at_idx (created_at)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
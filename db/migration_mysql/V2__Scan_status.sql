@@ -0,0 +1,5 @@
+-- Malware/phishing scan state per link
+ALTER TABLE url_records
+  ADD COLUMN scan_status VARCHAR(16) NOT NULL DEFAULT 'unchecked',
+  ADD COLUMN scanned_at  DATETIME(6) NULL,
+  ADD INDEX url_records_scanned_at_idx (scanned_at);
@@ -0,0 +1,10 @@
+-- The latest liveness check of each link's destination, made when the link
+-- is created or its destination changes and repeated by the liveness job.
+CREATE TABLE IF NOT EXISTS link_checks (
+  code       VARCHAR(64)   NOT NULL PRIMARY KEY,
+  status     INT           NOT NULL DEFAULT 0,
+  error      VARCHAR(1024) NOT NULL DEFAULT '',
+  dead       BOOLEAN       NOT NULL DEFAULT FALSE,
+  checked_at DATETIME(6)   NOT NULL,
+  KEY link_checks_checked_at_idx (checked_at)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,11 @@
+-- What each link's destination page says about itself, fetched in the
+-- background when FETCH_METADATA is on.
+CREATE TABLE IF NOT EXISTS link_page_meta (
+  code        VARCHAR(64)   NOT NULL PRIMARY KEY,
+  title       VARCHAR(255)  NOT NULL DEFAULT '',
+  description VARCHAR(1024) NOT NULL DEFAULT '',
+  site_name   VARCHAR(255)  NOT NULL DEFAULT '',
+  image       VARCHAR(2048) NOT NULL DEFAULT '',
+  favicon     VARCHAR(2048) NOT NULL DEFAULT '',
+  fetched_at  DATETIME(6)   NOT NULL
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
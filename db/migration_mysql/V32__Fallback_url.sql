@@ -0,0 +1,6 @@
+-- Where visitors go once a link is disabled, expired or out of clicks
+-- (NULL for the error page).
+ALTER TABLE url_records
+  ADD COLUMN fallback_url TEXT;
+ALTER TABLE url_records_archive
+  ADD COLUMN fallback_url TEXT;
@@ -0,0 +1,5 @@
+-- Link ownership (API key owner, '' for anonymous links) and edit tracking
+ALTER TABLE url_records
+  ADD COLUMN owner      VARCHAR(128) NOT NULL DEFAULT '',
+  ADD COLUMN updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  ADD INDEX url_records_owner_idx (owner);
@@ -0,0 +1,6 @@
+-- Links live on one of the configured short domains ('' is the BASE_URL
+-- domain), and a destination can have one link per domain
+ALTER TABLE url_records
+  ADD COLUMN domain VARCHAR(253) NOT NULL DEFAULT '',
+  DROP INDEX long_url_hash,
+  ADD UNIQUE INDEX url_records_domain_long_url (domain, long_url_hash);
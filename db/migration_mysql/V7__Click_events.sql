@@ -0,0 +1,11 @@
+-- Raw click events, written in batches by the click writer
+CREATE TABLE IF NOT EXISTS click_events (
+  id          BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  code        VARCHAR(64)  NOT NULL,
+  clicked_at  DATETIME(6)  NOT NULL,
+  referrer    VARCHAR(512) NOT NULL DEFAULT '',
+  ip_hash     CHAR(32)     NOT NULL DEFAULT '',
+  user_agent  VARCHAR(512) NOT NULL DEFAULT '',
+  country     CHAR(2)      NOT NULL DEFAULT '',
+  INDEX click_events_code_clicked_at_idx (code, clicked_at)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,15 @@
+-- Outbox of webhook deliveries, one row per event and endpoint
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               CHAR(36)     NOT NULL PRIMARY KEY,
+  endpoint         TEXT         NOT NULL,
+  event            VARCHAR(64)  NOT NULL,
+  payload          MEDIUMTEXT   NOT NULL,
+  status           VARCHAR(16)  NOT NULL DEFAULT 'pending',
+  attempts         INT          NOT NULL DEFAULT 0,
+  last_status_code INT          NOT NULL DEFAULT 0,
+  last_error       VARCHAR(1024) NOT NULL DEFAULT '',
+  next_attempt_at  DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  created_at       DATETIME(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  delivered_at     DATETIME(6)  NULL,
+  INDEX webhook_deliveries_due_idx (status, next_attempt_at)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,4 @@
+-- Optional expiry: expired links answer 410 until the cleanup worker purges them
+ALTER TABLE url_records
+  ADD COLUMN expires_at DATETIME(6) NULL,
+  ADD INDEX url_records_expires_at_idx (expires_at);
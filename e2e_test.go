@@ -14,27 +14,34 @@ import (
 	"urlshortener/urlshortener/internal/config"
 	"urlshortener/urlshortener/internal/db"
 	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/testutil"
 
 	httpserver "urlshortener/urlshortener/internal/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/sbowman/dotenv"
 )
 
 var (
 	testServer *httptest.Server
+	// testDB is nil when the suite runs on the memory driver.
 	testDB     *sql.DB
 	testConfig config.Config
 )
 
+// e2eAdminKey reads links back through the admin API on the memory driver,
+// which has no table to query.
+const e2eAdminKey = "e2e-admin"
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 
 	// Setup test environment
 	if err := setupE2ETest(); err != nil {
 		fmt.Printf("Failed to setup E2E tests: %v\n", err)
+		teardownE2ETest()
 		os.Exit(1)
 	}
 
@@ -63,6 +70,16 @@ func setupE2ETest() error {
 		Port:    "0", // Let test server choose port
 	}
 
+	// Without a Postgres to test against, the suite runs on the memory
+	// driver.
+	if testConfig.DBHost == "" {
+		testConfig.DBDriver = "memory"
+		testConfig.APIKeys = map[string]string{e2eAdminKey: e2eAdminKey}
+		testConfig.AdminOwners = []string{e2eAdminKey}
+		testServer = httptest.NewServer(httpserver.NewServer(testConfig, nil))
+		return nil
+	}
+
 	// Create test database if needed
 	if err := createTestDatabase(); err != nil {
 		return fmt.Errorf("failed to create test database: %w", err)
@@ -70,7 +87,7 @@ func setupE2ETest() error {
 
 	// Connect to test database
 	var err error
-	testDB, err = db.Open(testConfig)
+	testDB, err = db.Open(testConfig, nil)
 	if err != nil {
 		return fmt.Errorf("failed to connect to test database: %w", err)
 	}
@@ -101,7 +118,7 @@ func createTestDatabase() error {
 	adminConfig := testConfig
 	adminConfig.DBName = "postgres"
 
-	adminDB, err := sql.Open("postgres", adminConfig.DSN())
+	adminDB, err := sql.Open("pgx", adminConfig.DSN())
 	if err != nil {
 		return err
 	}
@@ -118,17 +135,7 @@ func createTestDatabase() error {
 }
 
 func createTableSchema() error {
-	schema := `
-		CREATE TABLE IF NOT EXISTS url_records (
-			id UUID PRIMARY KEY,
-			code TEXT NOT NULL UNIQUE,
-			long_url TEXT NOT NULL UNIQUE,
-			short_url TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
-		)
-	`
-	_, err := testDB.Exec(schema)
-	return err
+	return testutil.ApplyMigrations(testDB)
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -139,10 +146,65 @@ func getEnvOrDefault(key, defaultValue string) string {
 }
 
 func clearDatabase() error {
+	if testDB == nil {
+		// A new server starts with an empty memory store.
+		testServer.Close()
+		testServer = httptest.NewServer(httpserver.NewServer(testConfig, nil))
+		return nil
+	}
 	_, err := testDB.Exec("DELETE FROM url_records")
 	return err
 }
 
+// storedLinks returns every link the server has stored.
+func storedLinks(t *testing.T) []model.URLRecord {
+	t.Helper()
+	if testDB == nil {
+		req, _ := http.NewRequest(http.MethodGet, testServer.URL+"/api/v1/admin/links?limit=100", nil)
+		req.Header.Set("X-API-Key", e2eAdminKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to list links: %v", err)
+		}
+		defer resp.Body.Close()
+		var page model.LinkPage
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode links: %v", err)
+		}
+		return page.Links
+	}
+
+	rows, err := testDB.Query("SELECT id, code, long_url, short_url FROM url_records")
+	if err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	defer rows.Close()
+	var links []model.URLRecord
+	for rows.Next() {
+		var l model.URLRecord
+		if err := rows.Scan(&l.ID, &l.Code, &l.LongUrl, &l.ShortUrl); err != nil {
+			t.Fatalf("Failed to scan link: %v", err)
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Failed to query database: %v", err)
+	}
+	return links
+}
+
+// countLinks counts the stored links match accepts.
+func countLinks(t *testing.T, match func(model.URLRecord) bool) int {
+	t.Helper()
+	n := 0
+	for _, l := range storedLinks(t) {
+		if match(l) {
+			n++
+		}
+	}
+	return n
+}
+
 func TestE2E_ShortenURL_NewURL(t *testing.T) {
 	if err := clearDatabase(); err != nil {
 		t.Fatalf("Failed to clear database: %v", err)
@@ -195,12 +257,7 @@ func TestE2E_ShortenURL_NewURL(t *testing.T) {
 	}
 
 	// Verify data was persisted in database
-	var count int
-	err = testDB.QueryRow("SELECT COUNT(*) FROM url_records WHERE id = $1", urlRecord.ID).Scan(&count)
-	if err != nil {
-		t.Fatalf("Failed to query database: %v", err)
-	}
-
+	count := countLinks(t, func(l model.URLRecord) bool { return l.ID == urlRecord.ID })
 	if count != 1 {
 		t.Errorf("Expected 1 record in database, got %d", count)
 	}
@@ -262,12 +319,7 @@ func TestE2E_ShortenURL_ExistingURL(t *testing.T) {
 	}
 
 	// Verify only one record exists in database
-	var count int
-	err = testDB.QueryRow("SELECT COUNT(*) FROM url_records WHERE long_url = $1", testURL).Scan(&count)
-	if err != nil {
-		t.Fatalf("Failed to query database: %v", err)
-	}
-
+	count := countLinks(t, func(l model.URLRecord) bool { return l.LongUrl == testURL })
 	if count != 1 {
 		t.Errorf("Expected 1 record in database, got %d", count)
 	}
@@ -436,12 +488,7 @@ func TestE2E_ShortenURL_ConcurrentRequests(t *testing.T) {
 	}
 
 	// Verify only one record exists in database
-	var count int
-	err := testDB.QueryRow("SELECT COUNT(*) FROM url_records WHERE long_url = $1", testURL).Scan(&count)
-	if err != nil {
-		t.Fatalf("Failed to query database: %v", err)
-	}
-
+	count := countLinks(t, func(l model.URLRecord) bool { return l.LongUrl == testURL })
 	if count != 1 {
 		t.Errorf("Expected 1 record in database, got %d", count)
 	}
@@ -498,24 +545,19 @@ func TestE2E_ShortenURL_MultipleUniqueURLs(t *testing.T) {
 	}
 
 	// Verify all records were persisted
-	var totalCount int
-	err := testDB.QueryRow("SELECT COUNT(*) FROM url_records").Scan(&totalCount)
-	if err != nil {
-		t.Fatalf("Failed to query total count: %v", err)
+	stored := make(map[string]model.URLRecord)
+	for _, l := range storedLinks(t) {
+		stored[l.Code] = l
 	}
-
-	if totalCount != len(urls) {
-		t.Errorf("Expected %d records in database, got %d", len(urls), totalCount)
+	if len(stored) != len(urls) {
+		t.Errorf("Expected %d records in database, got %d", len(urls), len(stored))
 	}
 
 	// Verify each record exists in database
 	for i, record := range records {
-		var dbRecord model.URLRecord
-		err := testDB.QueryRow(
-			"SELECT id, code, long_url, short_url FROM url_records WHERE code = $1",
-			record.Code).Scan(&dbRecord.ID, &dbRecord.Code, &dbRecord.LongUrl, &dbRecord.ShortUrl)
-		if err != nil {
-			t.Errorf("Record %d not found in database: %v", i, err)
+		dbRecord, ok := stored[record.Code]
+		if !ok {
+			t.Errorf("Record %d not found in database", i)
 			continue
 		}
 
@@ -619,6 +661,21 @@ var noFollow = &http.Client{
 
 func seedRecord(t *testing.T, code, long, base string) {
 	t.Helper()
+	if testDB == nil {
+		body, _ := json.Marshal(model.ImportReq{Links: []model.ImportLink{{Code: code, LongURL: long}}})
+		req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/api/v1/admin/import", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", e2eAdminKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("seed import failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("seed import failed: status %d", resp.StatusCode)
+		}
+		return
+	}
 	id := uuid.New().String()
 	_, err := testDB.Exec(`
         INSERT INTO url_records (id, code, long_url, short_url, created_at)
@@ -0,0 +1,61 @@
+// Package bloom implements a Bloom filter: a compact set that may claim to
+// hold a key it does not, but never denies holding one it does.
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter is a Bloom filter safe for concurrent use. It cannot grow: sized
+// for n keys, it holds more at a rising false positive rate.
+type Filter struct {
+	bits []atomic.Uint64
+	m    uint64 // number of bits
+	k    uint64 // number of hashes
+	seed maphash.Seed
+}
+
+// New returns a filter sized for n keys at false positive rate p.
+func New(n int, p float64) *Filter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &Filter{
+		bits: make([]atomic.Uint64, (m+63)/64),
+		m:    m,
+		k:    max(k, 1),
+		seed: maphash.MakeSeed(),
+	}
+}
+
+// Add puts key in the filter.
+func (f *Filter) Add(key string) {
+	h1, h2 := f.hash(key)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// MayContain reports false when key was certainly never added, and true
+// when it probably was.
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := f.hash(key)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash derives the k bit positions from two halves of one 64-bit hash, as
+// Kirsch and Mitzenmacher showed to work as well as k independent hashes.
+func (f *Filter) hash(key string) (h1, h2 uint64) {
+	h := maphash.String(f.seed, key)
+	return h & math.MaxUint32, h>>32 | 1
+}
@@ -0,0 +1,28 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(10000, 0.01)
+	for i := range 10000 {
+		f.Add("in" + strconv.Itoa(i))
+	}
+	for i := range 10000 {
+		if !f.MayContain("in" + strconv.Itoa(i)) {
+			t.Fatalf("expected added key %d to be found", i)
+		}
+	}
+
+	var falsePositives int
+	for i := range 10000 {
+		if f.MayContain("out" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("expected about 1%% false positives, got %d in 10000", falsePositives)
+	}
+}
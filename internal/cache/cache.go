@@ -0,0 +1,115 @@
+// Package cache holds short-lived state that spares the database repeated
+// lookups, either in process memory or shared between instances in Redis.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Set remembers keys for a while. It is only ever a shortcut: a key that
+// was forgotten early, or never stored because of an error, costs a lookup
+// and nothing else.
+type Set interface {
+	Contains(ctx context.Context, key string) bool
+	Add(ctx context.Context, key string)
+	Remove(ctx context.Context, key string)
+}
+
+// Store remembers values by key for a while, on the same terms as Set.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Put(ctx context.Context, key string, value []byte)
+	Remove(ctx context.Context, key string)
+}
+
+// MemorySet is a Set in process memory holding at most twice size keys, each
+// for at most ttl, the way MemoryStore holds values.
+type MemorySet struct {
+	store *MemoryStore
+}
+
+// NewMemorySet returns an empty MemorySet.
+func NewMemorySet(size int, ttl time.Duration) *MemorySet {
+	return &MemorySet{store: NewMemoryStore(size, ttl)}
+}
+
+func (s *MemorySet) Contains(ctx context.Context, key string) bool {
+	_, ok := s.store.Get(ctx, key)
+	return ok
+}
+
+func (s *MemorySet) Add(ctx context.Context, key string) {
+	s.store.Put(ctx, key, nil)
+}
+
+func (s *MemorySet) Remove(ctx context.Context, key string) {
+	s.store.Remove(ctx, key)
+}
+
+// MemoryStore is a Store in process memory holding at most twice size keys,
+// each for at most ttl. Keys live in two generations: new ones go into the
+// current one, which replaces the previous one once it is full or half of
+// ttl old, and the previous one is dropped once it started ttl ago. A flood
+// of keys therefore pushes older ones out rather than growing the store.
+type MemoryStore struct {
+	ttl  time.Duration
+	size int
+
+	mu        sync.Mutex
+	cur       map[string][]byte
+	curStart  time.Time
+	prev      map[string][]byte
+	prevStart time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, size: size, cur: make(map[string][]byte), curStart: time.Now()}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	if v, ok := s.cur[key]; ok {
+		return v, true
+	}
+	v, ok := s.prev[key]
+	return v, ok
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	if len(s.cur) >= s.size {
+		s.rotate(time.Now())
+	}
+	s.cur[key] = value
+}
+
+func (s *MemoryStore) Remove(_ context.Context, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cur, key)
+	delete(s.prev, key)
+}
+
+// expire starts a new generation every half ttl and drops the previous one
+// once its oldest keys may have outlived ttl.
+func (s *MemoryStore) expire() {
+	now := time.Now()
+	if now.Sub(s.curStart) >= s.ttl/2 {
+		s.rotate(now)
+	}
+	if now.Sub(s.prevStart) >= s.ttl {
+		s.prev = nil
+	}
+}
+
+func (s *MemoryStore) rotate(now time.Time) {
+	s.prev, s.prevStart = s.cur, s.curStart
+	s.cur, s.curStart = make(map[string][]byte), now
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemorySet(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemorySet(10, time.Hour)
+
+	s.Add(ctx, "abc")
+	if !s.Contains(ctx, "abc") || s.Contains(ctx, "xyz") {
+		t.Fatal("expected only the added key")
+	}
+	s.Remove(ctx, "abc")
+	if s.Contains(ctx, "abc") {
+		t.Error("expected a removed key to be gone")
+	}
+}
+
+func TestMemorySet_Expiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemorySet(10, 200*time.Millisecond)
+
+	s.Add(ctx, "abc")
+	time.Sleep(120 * time.Millisecond)
+	s.Add(ctx, "def")
+	if !s.Contains(ctx, "abc") || !s.Contains(ctx, "def") {
+		t.Fatal("expected both keys within ttl")
+	}
+	time.Sleep(120 * time.Millisecond)
+	if s.Contains(ctx, "abc") {
+		t.Error("expected the key to expire after ttl")
+	}
+	if !s.Contains(ctx, "def") {
+		t.Error("expected the newer key to outlive the older")
+	}
+}
+
+func TestMemorySet_Size(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemorySet(2, time.Hour)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.Add(ctx, key)
+	}
+	if s.Contains(ctx, "a") || s.Contains(ctx, "b") {
+		t.Error("expected the oldest keys to be pushed out")
+	}
+	if !s.Contains(ctx, "d") || !s.Contains(ctx, "e") {
+		t.Error("expected the newest keys to be kept")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(1, time.Hour)
+
+	s.Put(ctx, "abc", []byte("1"))
+	s.Put(ctx, "def", []byte("2"))
+	if v, ok := s.Get(ctx, "abc"); !ok || string(v) != "1" {
+		t.Errorf("expected the value from the previous generation, got %q, %v", v, ok)
+	}
+	s.Put(ctx, "abc", []byte("3"))
+	if v, ok := s.Get(ctx, "abc"); !ok || string(v) != "3" {
+		t.Errorf("expected the latest value, got %q, %v", v, ok)
+	}
+	s.Remove(ctx, "abc")
+	if _, ok := s.Get(ctx, "abc"); ok {
+		t.Error("expected a removed key to be gone")
+	}
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSet is a Set in Redis, shared by every instance using the same
+// server, so a key removed by one is gone for all. Redis errors make keys
+// look absent and are otherwise ignored, in keeping with Set.
+type RedisSet struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisSet returns a RedisSet storing each key under prefix+key, expiring
+// after ttl.
+func NewRedisSet(client *redis.Client, prefix string, ttl time.Duration) *RedisSet {
+	return &RedisSet{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (s *RedisSet) Contains(ctx context.Context, key string) bool {
+	n, err := s.client.Exists(ctx, s.prefix+key).Result()
+	return err == nil && n > 0
+}
+
+func (s *RedisSet) Add(ctx context.Context, key string) {
+	s.client.Set(ctx, s.prefix+key, 1, s.ttl)
+}
+
+func (s *RedisSet) Remove(ctx context.Context, key string) {
+	s.client.Del(ctx, s.prefix+key)
+}
+
+// RedisStore is a Store in Redis, shared by every instance using the same
+// server. Redis errors make keys look absent and are otherwise ignored.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStore returns a RedisStore keeping each value under prefix+key,
+// expiring after ttl.
+func NewRedisStore(client *redis.Client, prefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool) {
+	v, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	return v, err == nil
+}
+
+func (s *RedisStore) Put(ctx context.Context, key string, value []byte) {
+	s.client.Set(ctx, s.prefix+key, value, s.ttl)
+}
+
+func (s *RedisStore) Remove(ctx context.Context, key string) {
+	s.client.Del(ctx, s.prefix+key)
+}
+
+// RedisFeed passes keys between instances over a Redis channel. Delivery is
+// at most once: keys published while an instance is disconnected do not
+// reach it.
+type RedisFeed struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedisFeed returns a RedisFeed on channel.
+func NewRedisFeed(client *redis.Client, channel string) *RedisFeed {
+	return &RedisFeed{client: client, channel: channel}
+}
+
+// Publish sends key to every subscribed instance, this one included.
+func (f *RedisFeed) Publish(ctx context.Context, key string) {
+	f.client.Publish(ctx, f.channel, key)
+}
+
+// Subscribe calls fn with every key published until ctx is cancelled,
+// reconnecting as needed.
+func (f *RedisFeed) Subscribe(ctx context.Context, fn func(key string)) {
+	sub := f.client.Subscribe(ctx, f.channel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			fn(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisSet(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := NewRedisSet(client, "test:", time.Minute)
+
+	s.Add(ctx, "abc")
+	if !s.Contains(ctx, "abc") || s.Contains(ctx, "xyz") {
+		t.Fatal("expected only the added key")
+	}
+	if !mr.Exists("test:abc") || mr.TTL("test:abc") != time.Minute {
+		t.Errorf("expected the key under its prefix with a ttl, got ttl %v", mr.TTL("test:abc"))
+	}
+	mr.FastForward(time.Minute)
+	if s.Contains(ctx, "abc") {
+		t.Error("expected the key to expire")
+	}
+
+	s.Add(ctx, "def")
+	s.Remove(ctx, "def")
+	if s.Contains(ctx, "def") {
+		t.Error("expected a removed key to be gone")
+	}
+
+	mr.Close()
+	if s.Contains(ctx, "abc") {
+		t.Error("expected keys to look absent while Redis is down")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test:", time.Minute)
+
+	s.Put(ctx, "abc", []byte("value"))
+	if v, ok := s.Get(ctx, "abc"); !ok || string(v) != "value" {
+		t.Fatalf("expected the stored value, got %q, %v", v, ok)
+	}
+	if mr.TTL("test:abc") != time.Minute {
+		t.Errorf("expected a ttl, got %v", mr.TTL("test:abc"))
+	}
+	s.Remove(ctx, "abc")
+	if _, ok := s.Get(ctx, "abc"); ok {
+		t.Error("expected a removed key to be gone")
+	}
+}
+
+func TestRedisFeed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	feed := NewRedisFeed(client, "test:codes")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		feed.Subscribe(ctx, func(key string) {
+			select {
+			case got <- key:
+			default:
+			}
+		})
+		close(done)
+	}()
+
+	// Publish until the subscription is up.
+	deadline := time.After(time.Second)
+	for received := false; !received; {
+		feed.Publish(context.Background(), "abc")
+		select {
+		case key := <-got:
+			if key != "abc" {
+				t.Errorf("expected abc, got %q", key)
+			}
+			received = true
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("expected the published key to arrive")
+		}
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,48 @@
+package captcha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "test-secret" || r.FormValue("remoteip") != "203.0.113.7" {
+			t.Errorf("expected the secret and address in the form, got %v", r.Form)
+		}
+		if r.FormValue("response") == "good" {
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	defer srv.Close()
+
+	v := &Verifier{Secret: "test-secret", Client: srv.Client(), Endpoint: srv.URL}
+	ctx := context.Background()
+	if ok, err := v.Verify(ctx, "good", "203.0.113.7"); err != nil || !ok {
+		t.Errorf("expected a valid token to pass, got %v (%v)", ok, err)
+	}
+	if ok, err := v.Verify(ctx, "bad", "203.0.113.7"); err != nil || ok {
+		t.Errorf("expected an invalid token to fail, got %v (%v)", ok, err)
+	}
+	if ok, _ := v.Verify(ctx, "", "203.0.113.7"); ok {
+		t.Error("expected a missing token to fail")
+	}
+
+	srv.Close()
+	if _, err := v.Verify(ctx, "good", "203.0.113.7"); err == nil {
+		t.Error("expected an error with the provider down")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if New("", "secret") != nil {
+		t.Error("expected no verifier without a provider")
+	}
+	if v := New(Turnstile, "secret"); v == nil || v.Endpoint != endpoints[Turnstile] {
+		t.Errorf("expected Turnstile's endpoint, got %+v", v)
+	}
+}
@@ -0,0 +1,183 @@
+// Package client is a small Go client for the shortener's HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// Client calls one shortener server, optionally authenticated with an API key.
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// New returns a client for the server at baseURL. An empty apiKey makes
+// anonymous requests.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		http: &http.Client{
+			// Resolve reads the redirect rather than following it.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// APIError is a non-success response from the server.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 or 410 from the server.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusGone)
+}
+
+// Shorten creates a short link, or returns the existing one for the URL.
+func (c *Client) Shorten(ctx context.Context, req model.CreateReq) (model.URLRecord, error) {
+	var rec model.URLRecord
+	err := c.do(ctx, http.MethodPost, "/api/v1/shorten", req, &rec)
+	return rec, err
+}
+
+// Resolve returns the destination a code redirects to.
+func (c *Client) Resolve(ctx context.Context, code string) (string, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/"+url.PathEscape(code), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", apiError(resp)
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+// List returns a page of the caller's links, newest first. A non-empty query
+// keeps only links whose destination contains it.
+func (c *Client) List(ctx context.Context, query string, limit, offset int) ([]model.URLRecord, error) {
+	var page model.LinkPage
+	q := url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset)}}
+	if query != "" {
+		q.Set("query", query)
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/links?"+q.Encode(), nil, &page)
+	return page.Links, err
+}
+
+// Delete removes one of the caller's links.
+func (c *Client) Delete(ctx context.Context, code string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/links/"+url.PathEscape(code), nil, nil)
+}
+
+// Export returns up to limit of the caller's links in code order, after the
+// code cursor ("" for the first). A chunk shorter than limit is the last.
+// With stats, links carry their click totals when the server counts clicks.
+func (c *Client) Export(ctx context.Context, cursor string, limit int, stats bool) ([]model.ExportLink, error) {
+	q := url.Values{"limit": {strconv.Itoa(limit)}, "stats": {strconv.FormatBool(stats)}}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/v1/export?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+	var links []model.ExportLink
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var l model.ExportLink
+		err := dec.Decode(&l)
+		if errors.Is(err, io.EOF) {
+			return links, nil
+		}
+		if err != nil {
+			return links, err
+		}
+		links = append(links, l)
+	}
+}
+
+// Import stores links exported from elsewhere under their original codes.
+// It needs an admin key; links that cannot be imported come back as
+// conflicts.
+func (c *Client) Import(ctx context.Context, req model.ImportReq) (model.ImportResult, error) {
+	var res model.ImportResult
+	err := c.do(ctx, http.MethodPost, "/api/v1/admin/import", req, &res)
+	return res, err
+}
+
+// do sends body as JSON and decodes a 2xx response into out, if given.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return c.http.Do(req)
+}
+
+func apiError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body)
+	return &APIError{Status: resp.StatusCode, Message: body.Error}
+}
@@ -1,49 +1,1207 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"urlshortener/urlshortener/internal/captcha"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/util"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
 	"github.com/sbowman/dotenv"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// appScheme matches a URL scheme as RFC 3986 defines it.
+var appScheme = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// unsafeSchemes are never app schemes: the web's own, and those that run
+// or embed content in the page instead of leaving it.
+var unsafeSchemes = []string{"http", "https", "javascript", "vbscript", "data", "blob", "file", "about", "filesystem"}
+
+// Jobs names the background jobs JOB_SCHEDULES can schedule.
+var Jobs = []string{"archive", "cleanup", "idempotency", "liveness", "rescan", "retention", "rollup", "usage", "webhooks"}
+
+// What click events keep of the visitor's address.
+const (
+	// ClickIPHash keeps a salted hash of the visitor's network.
+	ClickIPHash = "hash"
+	// ClickIPTruncate keeps the network itself, e.g. 203.0.113.0/24.
+	ClickIPTruncate = "truncate"
+	ClickIPNone     = "none"
+)
+
+// What the click buffer drops when it is full.
+const (
+	ClickOverflowDropNew = "drop_new"
+	ClickOverflowDropOld = "drop_old"
+)
+
+// Policies for destinations that are already short links.
+const (
+	ShortLinksAllow  = "allow"
+	ShortLinksReject = "reject"
+	// ShortLinksUnwrap follows the link's redirects and stores where they
+	// end up instead.
+	ShortLinksUnwrap = "unwrap"
+)
+
+// DefaultShortenerDomains are well-known public link shorteners.
+var DefaultShortenerDomains = []string{
+	"bit.ly", "bitly.com", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "ow.ly",
+	"rb.gy", "rebrand.ly", "shorturl.at", "t.co", "t.ly", "tiny.cc",
+	"tinyurl.com", "v.gd",
+}
+
+// DBDrivers are the storage backends DB_DRIVER may name.
+var DBDrivers = []string{"postgres", "mysql", "memory", "dynamodb", "mongodb", "cassandra", "redis"}
+
+// How much the server logs.
+const (
+	// LogDebug adds gin's debug output, such as the routes it registers.
+	LogDebug = "debug"
+	// LogInfo logs every request and every problem.
+	LogInfo = "info"
+	// LogError leaves out the request log.
+	LogError = "error"
 )
 
+// LogLevels are the levels LOG_LEVEL may name.
+var LogLevels = []string{LogDebug, LogInfo, LogError}
+
 type Config struct {
-	DBUser  string
-	DBPass  string
-	DBName  string
-	DBHost  string
-	DBPort  string
-	SSLMode string
-	BaseURL string
-	Domain  string
-	Port    string
+	DBDriver string
+	DBUser   string
+	DBPass   string
+	DBName   string
+	DBHost   string
+	DBPort   string
+	SSLMode  string
+	BaseURL  string
+	Domain   string
+	Port     string
+
+	// Connection pool limits. Zero keeps database/sql's defaults: no limit
+	// on open connections, two idle ones, and connections kept forever.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	// DBConnectTimeout is how long startup keeps retrying a database that
+	// does not answer yet.
+	DBConnectTimeout time.Duration
+	// DBQueryTimeout is the Postgres statement_timeout, how long the server
+	// lets one statement run. A negative value leaves the server's setting.
+	// MySQL and MariaDB spell it differently and only for SELECTs, so there
+	// RequestTimeout alone bounds queries.
+	DBQueryTimeout time.Duration
+	// DBNoStatementCache stops Postgres connections caching prepared
+	// statements, for poolers such as PgBouncer in transaction mode.
+	DBNoStatementCache bool
+	// AutoMigrate lets the server create the tables and indexes the
+	// MongoDB and Cassandra backends need. SQL schemas are Flyway's.
+	AutoMigrate bool
+
+	// LogLevel is LogDebug, LogInfo or LogError.
+	LogLevel string
+
+	// SecretsRefresh is how often the configuration is read again, so that
+	// secrets it refers to pick up rotations. Zero reads it only at startup
+	// and on reloads.
+	SecretsRefresh time.Duration
+
+	// DynamoTable is the DynamoDB table links are kept in with
+	// DB_DRIVER=dynamodb. DynamoEndpoint overrides the AWS endpoint, as for
+	// DynamoDB Local; region and credentials come from the usual AWS_*
+	// variables, shared files or the instance role.
+	DynamoTable    string
+	DynamoEndpoint string
+
+	// MongoURI and MongoDatabase locate the MongoDB database links are kept
+	// in with DB_DRIVER=mongodb, in its "links" collection.
+	MongoURI      string
+	MongoDatabase string
+
+	// MigrateFrom names the backend links are being moved off, which keeps
+	// receiving every write while DB_DRIVER's is filled; empty when not
+	// migrating. At most one of the two may be a SQL database, as they share
+	// the DB_* connection settings.
+	MigrateFrom string
+
+	// CassandraHosts are contact points of the Cassandra or ScyllaDB cluster
+	// links are kept in with DB_DRIVER=cassandra, in tables of
+	// CassandraKeyspace, which must exist. CassandraUsername and
+	// CassandraPassword log in when the username is set.
+	CassandraHosts    []string
+	CassandraKeyspace string
+	CassandraUsername string
+	CassandraPassword string
+
+	// PathPrefix is the sub-path every route is served under, such as "/s"
+	// behind a reverse proxy; empty mounts them at the root. It is also
+	// added to the base URLs, so short links point under it.
+	PathPrefix string
+
+	// UnixSocket is a socket path the server listens on instead of
+	// Domain:Port, created with UnixSocketMode permissions. Sockets passed
+	// by systemd take precedence over both.
+	UnixSocket     string
+	UnixSocketMode os.FileMode
+
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// TrustedProxies are the reverse proxies and CDNs whose ClientIPHeader
+	// is believed; with none, the peer address is the client's.
+	TrustedProxies []netip.Prefix
+	ClientIPHeader string
+
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSAutocert         bool
+	TLSAutocertHosts    []string
+	TLSAutocertCacheDir string
+	TLSAutocertEmail    string
+
+	// HTTPAddr is a plain-HTTP listener next to the HTTPS one. It serves the
+	// API and redirects too, or with HTTPRedirect only redirects to HTTPS.
+	HTTPAddr     string
+	HTTPRedirect bool
+
+	// RequestTimeout bounds how long a request may wait on the database and
+	// other backends; a negative value lets requests run for as long as
+	// they take.
+	RequestTimeout time.Duration
+
+	// Deadlines of the HTTP server itself, which bound slow clients rather
+	// than slow backends: ReadHeaderTimeout for the request line and
+	// headers, ReadTimeout for the whole request, WriteTimeout for handling
+	// it and writing the response, and IdleTimeout for a kept-alive
+	// connection between requests. A negative value turns one off. Exports
+	// and imports lift the read and write deadlines, as they stream.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// MaxHeaderBytes caps the request line and headers.
+	MaxHeaderBytes int
+
+	// MaxBodyBytes caps the bodies of requests that create or edit links,
+	// over REST and GraphQL alike, and MaxURLLength the destinations they
+	// may carry.
+	MaxBodyBytes int
+	MaxURLLength int
+
+	// DebugAddr is where the pprof profiles are served, on a listener of
+	// their own; empty turns them off.
+	DebugAddr string
+
+	BlockInternalTargets bool
+
+	// AppSchemes are custom URL schemes, such as myapp, that destinations
+	// may use besides http and https, to open a mobile app. Visitors get a
+	// page that opens the app and links AppStoreURL and PlayStoreURL for
+	// those without it.
+	AppSchemes   []string
+	AppStoreURL  string
+	PlayStoreURL string
+
+	// ShortLinks decides what happens to destinations that are themselves
+	// short links, on ShortenerDomains or this server's own domains: one of
+	// the ShortLinks* policies.
+	ShortLinks         string
+	ShortenerDomains   []string
+	UnwrapTimeout      time.Duration
+	UnwrapMaxRedirects int
+
+	SafeBrowsingAPIKey string
+	URLhausAuthKey     string
+	ScanInterval       time.Duration
+	ScanRefreshAfter   time.Duration
+	ScanBatchSize      int
+
+	// ReputationThreshold holds new links to domains scoring below it, out
+	// of 100, for review by an operator; zero scores nothing.
+	// ReputationAPIURL adds an external service to the local heuristics.
+	ReputationThreshold int
+	ReputationAPIURL    string
+	ReputationAPIKey    string
+
+	// LivenessCheck requests the destinations of new links, waiting at most
+	// LivenessTimeout and reading at most LivenessMaxBytes, and records
+	// whether they are live. LivenessRejectDead refuses dead ones.
+	// LivenessInterval, when set, rechecks a batch of LivenessBatchSize
+	// checks older than LivenessRefreshAfter that often.
+	LivenessCheck        bool
+	LivenessRejectDead   bool
+	LivenessTimeout      time.Duration
+	LivenessMaxBytes     int
+	LivenessInterval     time.Duration
+	LivenessRefreshAfter time.Duration
+	LivenessBatchSize    int
+
+	// CaptchaProvider, one of captcha.Providers, checks the captcha tokens
+	// anonymous endpoints ask for; empty asks for none.
+	CaptchaProvider string
+	CaptchaSecret   string
+	// CaptchaShorten asks anonymous callers of /shorten for a captcha too;
+	// callers with an API key never need one.
+	CaptchaShorten bool
+	// ReportLimit is how many abuse reports one client address may file per
+	// hour; zero is unlimited.
+	ReportLimit int
+
+	// APIKeys maps each accepted API key to the owner it authenticates.
+	APIKeys map[string]string
+
+	// AdminOwners are the API key owners allowed to use the /admin endpoints.
+	AdminOwners []string
+
+	// Quota applies to every owner without an entry in OwnerQuotas.
+	Quota       model.Quota
+	OwnerQuotas map[string]model.Quota
+
+	// FeatureFlags are the configured feature flags by name; flags set
+	// through the admin API override them. Instances pick up each other's
+	// API changes every FeatureFlagRefresh.
+	FeatureFlags       map[string]model.FeatureFlag
+	FeatureFlagRefresh time.Duration
+
+	// ReservedCodes are never generated, on top of util.DefaultReserved.
+	ReservedCodes []string
+	// CodeStrategy picks how new codes are made: random, sequence or hash.
+	CodeStrategy string
+	CodeLength   int
+	// CodeSequenceKey keys the permutation that scrambles sequence codes.
+	CodeSequenceKey string
+	// CodeAdaptiveLength lengthens random codes once more than
+	// CodeCollisionRate of CodeCollisionWindow consecutive candidates collide.
+	CodeAdaptiveLength  bool
+	CodeCollisionRate   float64
+	CodeCollisionWindow int
+
+	ClickEvents        bool
+	ClickBufferSize    int
+	ClickBatchSize     int
+	ClickFlushInterval time.Duration
+	// ClickWriters is how many batches are written at once.
+	ClickWriters int
+	// ClickOverflow is one of the ClickOverflow* constants.
+	ClickOverflow string
+	ClickIPSalt   string
+	// ClickIP is one of the ClickIP* constants.
+	ClickIP string
+	// HonorDNT skips click events for requests with DNT or Sec-GPC set.
+	HonorDNT bool
+	// NoAnalytics turns click events off whatever ClickEvents says, and keeps
+	// client addresses out of the access log.
+	NoAnalytics bool
+	// ClickDedupWindow makes repeated clicks by one visitor on one link within
+	// the window count once; zero counts every click.
+	ClickDedupWindow time.Duration
+	// GeoIPDatabase is a MaxMind database file used to locate clicks.
+	GeoIPDatabase string
+	// ClickRollupInterval is how often click events are rolled up into daily
+	// totals; zero turns the rollup and daily stats off.
+	ClickRollupInterval time.Duration
+	// ClickRetentionDays is how many UTC days of raw click events are kept,
+	// besides today; zero keeps them forever. Daily totals are always kept.
+	ClickRetentionDays int
+
+	WebhookURLs        []string
+	WebhookSecret      string
+	WebhookClicks      bool
+	WebhookInterval    time.Duration
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
+	CleanupInterval time.Duration
+	// CleanupGrace is how long expired links keep answering 410 before they
+	// are deleted.
+	CleanupGrace time.Duration
+	// CleanupDisabledAfter deletes links disabled for longer; zero keeps them.
+	CleanupDisabledAfter time.Duration
+	CleanupBatchSize     int
+	// LeaderElection runs the jobs shared by the fleet on one elected
+	// instance, the holder of a lease of LeaderLease, rather than taking a
+	// lease per job.
+	LeaderElection bool
+	LeaderLease    time.Duration
+	// JobSchedules gives background jobs cron schedules by name, replacing
+	// the interval each otherwise runs at.
+	JobSchedules map[string]string
+	// ArchiveAfterDays moves links neither changed nor clicked for that many
+	// days to the archive table; zero keeps every link in place.
+	ArchiveAfterDays int
+
+	// RedirectCacheControl is the Cache-Control policy sent with each redirect
+	// status; statuses without one get no caching headers.
+	RedirectCacheControl map[int]string
+
+	// IdempotencyTTL is how long Idempotency-Key responses are kept for replay.
+	IdempotencyTTL time.Duration
+
+	// RedisURL points at a Redis server for state shared between instances,
+	// such as the negative cache; empty keeps it in process memory. With
+	// DB_DRIVER=redis it holds the links too, and RedisAppendOnly turns on
+	// the server's append-only file so they survive a restart.
+	RedisURL        string
+	RedisAppendOnly bool
+
+	// NegativeCacheTTL is how long a code found missing is remembered, so
+	// lookups of it skip the database; zero turns the cache off.
+	// NegativeCacheSize bounds the codes held in memory.
+	NegativeCacheTTL  time.Duration
+	NegativeCacheSize int
+
+	// LinkCacheTTL is how long links are cached for redirects once they are
+	// created, changed or looked up; zero turns the cache off.
+	// LinkCacheSize bounds the links held in memory.
+	LinkCacheTTL  time.Duration
+	LinkCacheSize int
+	// CacheWarmTop, when positive, loads the links with the most clicks in
+	// the last CacheWarmDays days into the link cache at startup.
+	CacheWarmTop  int
+	CacheWarmDays int
+
+	// CodeFilter keeps a Bloom filter of every code in memory, rebuilt every
+	// CodeFilterRebuild and sized for at least CodeFilterSize codes, so
+	// lookups of codes that do not exist skip the database.
+	CodeFilter        bool
+	CodeFilterRebuild time.Duration
+	CodeFilterSize    int
+
+	// FetchTitles fills in a new link's title from its destination page when
+	// the request has none.
+	FetchTitles       bool
+	TitleFetchTimeout time.Duration
+
+	// FetchMetadata fetches the title, description, preview image and
+	// favicon of new destinations in the background, waiting at most
+	// MetadataTimeout for each page. Pages are cached for MetadataCacheTTL,
+	// up to MetadataCacheSize of them in memory, and at most
+	// MetadataQueueSize wait to be fetched.
+	FetchMetadata     bool
+	MetadataTimeout   time.Duration
+	MetadataCacheTTL  time.Duration
+	MetadataCacheSize int
+	MetadataQueueSize int
+
+	// StripTracking removes utm_*, fbclid and gclid parameters from new
+	// destinations unless a request says otherwise.
+	StripTracking bool
+
+	// UniqueLinks lets create requests ask for a new link to a destination
+	// that already has one.
+	UniqueLinks bool
+
+	// OpenAPIUI serves Swagger UI for /openapi.json at /docs.
+	OpenAPIUI bool
+
+	// SiteDir holds files that replace the built-in front end's, such as a
+	// branded index.html or robots.txt.
+	SiteDir string
+
+	// RobotsNoindex sends X-Robots-Tag: noindex with everything served for
+	// short links, so search engines leave them out of their results.
+	RobotsNoindex bool
+
+	// AppleAppSiteAssociation and AssetLinks are JSON files served under
+	// /.well-known, so short links open a companion app as iOS Universal
+	// Links and Android App Links.
+	AppleAppSiteAssociation string
+	AssetLinks              string
+
+	// FallbackURL receives visitors of short links that do not exist or no
+	// longer redirect, unless the link names its own fallback. Otherwise
+	// ErrorPage, an html/template file, is shown to them, if set.
+	FallbackURL string
+	ErrorPage   string
+
+	// Metrics serves Prometheus metrics at /metrics, with the connection pool
+	// and caches sampled every MetricsInterval.
+	Metrics         bool
+	MetricsInterval time.Duration
+
+	// Tenants maps each tenant's host to the tenant. Requests to other hosts
+	// belong to the default tenant.
+	Tenants map[string]Tenant
+
+	// ShortDomains maps each additional short domain's host to its base URL.
+	// BASE_URL's own host is the default domain and is not listed.
+	ShortDomains map[string]string
 }
 
 func Load() (Config, error) {
 	dotenv.Load()
+	applyOverrides()
+	if err := loadFile(dotenv.GetString("CONFIG_FILE")); err != nil {
+		return Config{}, err
+	}
 
 	cfg := Config{
-		DBUser:  dotenv.GetString("DB_USER"),
-		DBPass:  dotenv.GetString("DB_USER_PASSWORD"),
-		DBName:  dotenv.GetString("DB_NAME"),
-		DBHost:  dotenv.GetString("DB_HOST"),
-		DBPort:  dotenv.GetString("DB_PORT"),
-		SSLMode: dotenv.GetString("DB_SSLMODE"),
-		BaseURL: dotenv.GetString("BASE_URL"),
-		Domain:  dotenv.GetString("DOMAIN"),
-		Port:    dotenv.GetString("PORT"),
+		DBDriver: dotenv.GetString("DB_DRIVER"),
+		DBUser:   dotenv.GetString("DB_USER"),
+		DBPass:   dotenv.GetString("DB_USER_PASSWORD"),
+		DBName:   dotenv.GetString("DB_NAME"),
+		DBHost:   dotenv.GetString("DB_HOST"),
+		DBPort:   dotenv.GetString("DB_PORT"),
+		SSLMode:  dotenv.GetString("DB_SSLMODE"),
+		BaseURL:  dotenv.GetString("BASE_URL"),
+		Domain:   dotenv.GetString("DOMAIN"),
+		Port:     dotenv.GetString("PORT"),
+
+		DBMaxOpenConns:     integer("DB_MAX_OPEN_CONNS", 0),
+		DBMaxIdleConns:     integer("DB_MAX_IDLE_CONNS", 0),
+		DBConnMaxLifetime:  duration("DB_CONN_MAX_LIFETIME", 0),
+		DBConnectTimeout:   duration("DB_CONNECT_TIMEOUT", 30*time.Second),
+		DBQueryTimeout:     duration("DB_QUERY_TIMEOUT", 10*time.Second),
+		DBNoStatementCache: dotenv.GetBool("DB_NO_STATEMENT_CACHE"),
+		AutoMigrate:        boolean("AUTO_MIGRATE", true),
+
+		LogLevel: strings.ToLower(str("LOG_LEVEL", LogInfo)),
+
+		SecretsRefresh: dotenv.GetDuration("SECRETS_REFRESH"),
+
+		DynamoTable:    str("DYNAMODB_TABLE", "shawty_links"),
+		DynamoEndpoint: dotenv.GetString("DYNAMODB_ENDPOINT"),
+
+		MongoURI:      str("MONGODB_URI", "mongodb://localhost:27017"),
+		MongoDatabase: str("MONGODB_DATABASE", "shawty"),
+
+		MigrateFrom: strings.ToLower(dotenv.GetString("MIGRATE_FROM")),
+
+		CassandraHosts:    list("CASSANDRA_HOSTS", []string{"localhost"}),
+		CassandraKeyspace: str("CASSANDRA_KEYSPACE", "shawty"),
+		CassandraUsername: dotenv.GetString("CASSANDRA_USERNAME"),
+		CassandraPassword: dotenv.GetString("CASSANDRA_PASSWORD"),
+
+		CORSAllowedOrigins:   list("CORS_ALLOWED_ORIGINS", nil),
+		CORSAllowedMethods:   list("CORS_ALLOWED_METHODS", []string{"GET", "POST", "OPTIONS"}),
+		CORSAllowedHeaders:   list("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization"}),
+		CORSAllowCredentials: dotenv.GetBool("CORS_ALLOW_CREDENTIALS"),
+		CORSMaxAge:           duration("CORS_MAX_AGE", 10*time.Minute),
+
+		ClientIPHeader: str("CLIENT_IP_HEADER", "X-Forwarded-For"),
+
+		TLSCertFile:         dotenv.GetString("TLS_CERT_FILE"),
+		TLSKeyFile:          dotenv.GetString("TLS_KEY_FILE"),
+		TLSAutocert:         dotenv.GetBool("TLS_AUTOCERT"),
+		TLSAutocertHosts:    list("TLS_AUTOCERT_HOSTS", nil),
+		TLSAutocertCacheDir: dotenv.GetString("TLS_AUTOCERT_CACHE_DIR"),
+		TLSAutocertEmail:    dotenv.GetString("TLS_AUTOCERT_EMAIL"),
+
+		HTTPAddr:     dotenv.GetString("HTTP_ADDR"),
+		HTTPRedirect: dotenv.GetBool("HTTP_REDIRECT"),
+
+		RequestTimeout: duration("REQUEST_TIMEOUT", 30*time.Second),
+
+		ReadHeaderTimeout: duration("READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       duration("READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      duration("WRITE_TIMEOUT", time.Minute),
+		IdleTimeout:       duration("IDLE_TIMEOUT", 2*time.Minute),
+		MaxHeaderBytes:    integer("MAX_HEADER_BYTES", 64<<10),
+
+		MaxBodyBytes: integer("MAX_BODY_BYTES", 64<<10),
+		MaxURLLength: integer("MAX_URL_LENGTH", 2048),
+
+		DebugAddr: dotenv.GetString("DEBUG_ADDR"),
+
+		BlockInternalTargets: dotenv.GetBool("BLOCK_INTERNAL_TARGETS"),
+
+		AppSchemes:   list("APP_SCHEMES", nil),
+		AppStoreURL:  dotenv.GetString("APP_STORE_URL"),
+		PlayStoreURL: dotenv.GetString("PLAY_STORE_URL"),
+
+		ShortLinks:         strings.ToLower(str("SHORT_LINKS", ShortLinksReject)),
+		ShortenerDomains:   list("SHORTENER_DOMAINS", DefaultShortenerDomains),
+		UnwrapTimeout:      duration("UNWRAP_TIMEOUT", 3*time.Second),
+		UnwrapMaxRedirects: integer("UNWRAP_MAX_REDIRECTS", 5),
+
+		SafeBrowsingAPIKey: dotenv.GetString("SAFE_BROWSING_API_KEY"),
+		URLhausAuthKey:     dotenv.GetString("URLHAUS_AUTH_KEY"),
+		ScanInterval:       dotenv.GetDuration("SCAN_INTERVAL"),
+		ScanRefreshAfter:   duration("SCAN_REFRESH_AFTER", 24*time.Hour),
+		ScanBatchSize:      integer("SCAN_BATCH_SIZE", 100),
+
+		ReputationThreshold: dotenv.GetInt("REPUTATION_THRESHOLD"),
+		ReputationAPIURL:    dotenv.GetString("REPUTATION_API_URL"),
+		ReputationAPIKey:    dotenv.GetString("REPUTATION_API_KEY"),
+
+		LivenessCheck:        dotenv.GetBool("LIVENESS_CHECK"),
+		LivenessRejectDead:   dotenv.GetBool("LIVENESS_REJECT_DEAD"),
+		LivenessTimeout:      duration("LIVENESS_TIMEOUT", 5*time.Second),
+		LivenessMaxBytes:     integer("LIVENESS_MAX_BYTES", 64<<10),
+		LivenessInterval:     dotenv.GetDuration("LIVENESS_INTERVAL"),
+		LivenessRefreshAfter: duration("LIVENESS_REFRESH_AFTER", 24*time.Hour),
+		LivenessBatchSize:    integer("LIVENESS_BATCH_SIZE", 100),
+
+		CaptchaProvider: strings.ToLower(dotenv.GetString("CAPTCHA_PROVIDER")),
+		CaptchaSecret:   dotenv.GetString("CAPTCHA_SECRET"),
+		CaptchaShorten:  dotenv.GetBool("CAPTCHA_SHORTEN"),
+		ReportLimit:     integer("REPORT_LIMIT", 10),
+
+		APIKeys: apiKeys("API_KEYS"),
+
+		AdminOwners: list("ADMIN_OWNERS", nil),
+
+		Quota: model.Quota{
+			LinksPerDay:    dotenv.GetInt("QUOTA_LINKS_PER_DAY"),
+			LinksTotal:     dotenv.GetInt("QUOTA_LINKS_TOTAL"),
+			ClicksPerMonth: dotenv.GetInt("QUOTA_CLICKS_PER_MONTH"),
+		},
+
+		ReservedCodes: list("RESERVED_CODES", nil),
+		CodeStrategy:  str("CODE_STRATEGY", util.CodesRandom),
+		CodeLength:    integer("CODE_LENGTH", util.DefaultCodeLength),
+
+		CodeSequenceKey:     dotenv.GetString("CODE_SEQUENCE_KEY"),
+		CodeAdaptiveLength:  dotenv.GetBool("CODE_ADAPTIVE_LENGTH"),
+		CodeCollisionRate:   fraction("CODE_COLLISION_RATE", 0.01),
+		CodeCollisionWindow: integer("CODE_COLLISION_WINDOW", 1000),
+
+		FetchTitles:       dotenv.GetBool("FETCH_TITLES"),
+		TitleFetchTimeout: duration("TITLE_FETCH_TIMEOUT", 3*time.Second),
+		FetchMetadata:     dotenv.GetBool("FETCH_METADATA"),
+		MetadataTimeout:   duration("METADATA_TIMEOUT", 5*time.Second),
+		MetadataCacheTTL:  duration("METADATA_CACHE_TTL", time.Hour),
+		MetadataCacheSize: integer("METADATA_CACHE_SIZE", 10000),
+		MetadataQueueSize: integer("METADATA_QUEUE_SIZE", 1000),
+		StripTracking:     dotenv.GetBool("STRIP_TRACKING_PARAMS"),
+		UniqueLinks:       dotenv.GetBool("UNIQUE_LINKS"),
+
+		OpenAPIUI: dotenv.GetBool("OPENAPI_UI"),
+		SiteDir:   dotenv.GetString("SITE_DIR"),
+
+		RobotsNoindex: dotenv.GetBool("ROBOTS_NOINDEX"),
+
+		AppleAppSiteAssociation: dotenv.GetString("APPLE_APP_SITE_ASSOCIATION"),
+		AssetLinks:              dotenv.GetString("ASSET_LINKS"),
+
+		FallbackURL: dotenv.GetString("FALLBACK_URL"),
+		ErrorPage:   dotenv.GetString("ERROR_PAGE"),
+
+		Metrics:         dotenv.GetBool("METRICS"),
+		MetricsInterval: duration("METRICS_INTERVAL", 15*time.Second),
+
+		FeatureFlagRefresh: duration("FEATURE_FLAG_REFRESH", 30*time.Second),
+
+		ClickEvents:         dotenv.GetBool("CLICK_EVENTS"),
+		ClickBufferSize:     integer("CLICK_BUFFER_SIZE", 10000),
+		ClickBatchSize:      integer("CLICK_BATCH_SIZE", 500),
+		ClickFlushInterval:  duration("CLICK_FLUSH_INTERVAL", 2*time.Second),
+		ClickWriters:        integer("CLICK_WRITERS", 1),
+		ClickOverflow:       strings.ToLower(str("CLICK_OVERFLOW", ClickOverflowDropNew)),
+		ClickIPSalt:         dotenv.GetString("CLICK_IP_SALT"),
+		ClickRollupInterval: duration("CLICK_ROLLUP_INTERVAL", 5*time.Minute),
+		ClickRetentionDays:  dotenv.GetInt("CLICK_RETENTION_DAYS"),
+		ClickIP:             strings.ToLower(str("CLICK_IP", ClickIPHash)),
+		HonorDNT:            dotenv.GetBool("HONOR_DNT"),
+		NoAnalytics:         dotenv.GetBool("NO_ANALYTICS"),
+		ClickDedupWindow:    dotenv.GetDuration("CLICK_DEDUP_WINDOW"),
+		GeoIPDatabase:       dotenv.GetString("GEOIP_DATABASE"),
+
+		WebhookURLs:        list("WEBHOOK_URLS", nil),
+		WebhookSecret:      dotenv.GetString("WEBHOOK_SECRET"),
+		WebhookClicks:      dotenv.GetBool("WEBHOOK_CLICKS"),
+		WebhookInterval:    duration("WEBHOOK_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts: integer("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeout:     duration("WEBHOOK_TIMEOUT", 10*time.Second),
+
+		CleanupInterval:      duration("CLEANUP_INTERVAL", time.Hour),
+		CleanupGrace:         dotenv.GetDuration("CLEANUP_GRACE"),
+		CleanupDisabledAfter: dotenv.GetDuration("CLEANUP_DISABLED_AFTER"),
+		CleanupBatchSize:     integer("CLEANUP_BATCH_SIZE", 1000),
+		LeaderElection:       dotenv.GetBool("LEADER_ELECTION"),
+		LeaderLease:          duration("LEADER_LEASE", 15*time.Second),
+		JobSchedules:         jobSchedules("JOB_SCHEDULES"),
+		ArchiveAfterDays:     dotenv.GetInt("ARCHIVE_AFTER_DAYS"),
+
+		IdempotencyTTL: duration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		RedisURL:        dotenv.GetString("REDIS_URL"),
+		RedisAppendOnly: dotenv.GetBool("REDIS_APPENDONLY"),
+
+		NegativeCacheTTL:  dotenv.GetDuration("NEGATIVE_CACHE_TTL"),
+		NegativeCacheSize: integer("NEGATIVE_CACHE_SIZE", 100000),
+		LinkCacheTTL:      dotenv.GetDuration("LINK_CACHE_TTL"),
+		LinkCacheSize:     integer("LINK_CACHE_SIZE", 100000),
+		CacheWarmTop:      dotenv.GetInt("CACHE_WARM_TOP"),
+		CacheWarmDays:     integer("CACHE_WARM_DAYS", 7),
+
+		CodeFilter:        dotenv.GetBool("CODE_FILTER"),
+		CodeFilterRebuild: duration("CODE_FILTER_REBUILD", time.Hour),
+		CodeFilterSize:    integer("CODE_FILTER_SIZE", 1000000),
+	}
+	// Every problem is reported at once, so fixing the configuration does
+	// not take a restart per mistake.
+	errs := cfg.resolveSecrets()
+	if cfg.DBDriver == "" {
+		cfg.DBDriver = "postgres"
+	}
+	if !slices.Contains(DBDrivers, cfg.DBDriver) {
+		errs = append(errs, fmt.Errorf("unknown DB_DRIVER %q; use one of %s", cfg.DBDriver, strings.Join(DBDrivers, ", ")))
 	}
+	if !slices.Contains(LogLevels, cfg.LogLevel) {
+		errs = append(errs, fmt.Errorf("unknown LOG_LEVEL %q", cfg.LogLevel))
+	}
+	if cfg.MigrateFrom != "" {
+		switch {
+		case !slices.Contains(DBDrivers, cfg.MigrateFrom) || cfg.MigrateFrom == "memory":
+			errs = append(errs, fmt.Errorf("unknown MIGRATE_FROM %q", cfg.MigrateFrom))
+		case cfg.MigrateFrom == cfg.DBDriver:
+			errs = append(errs, fmt.Errorf("MIGRATE_FROM is DB_DRIVER %q", cfg.DBDriver))
+		case cfg.SQL() && sqlDriver(cfg.MigrateFrom):
+			errs = append(errs, fmt.Errorf("MIGRATE_FROM %q and DB_DRIVER %q are both SQL databases", cfg.MigrateFrom, cfg.DBDriver))
+		}
+	}
+	if sqlDriver(cfg.DBDriver) || sqlDriver(cfg.MigrateFrom) {
+		errs = append(errs, cfg.checkDB()...)
+	}
+	cfg.UnixSocket = dotenv.GetString("UNIX_SOCKET")
+	errs = append(errs, cfg.checkListener()...)
 	if !strings.HasSuffix(cfg.BaseURL, "/") {
 		cfg.BaseURL += "/"
 	}
-	return cfg, nil
+	prefix, err := pathPrefix(dotenv.GetString("PATH_PREFIX"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.PathPrefix = prefix
+	cfg.BaseURL = withPrefix(cfg.BaseURL, prefix)
+	mode, err := strconv.ParseUint(str("UNIX_SOCKET_MODE", "0660"), 8, 32)
+	if err != nil || mode > 0o777 {
+		errs = append(errs, fmt.Errorf("invalid UNIX_SOCKET_MODE %q", dotenv.GetString("UNIX_SOCKET_MODE")))
+	}
+	cfg.UnixSocketMode = os.FileMode(mode)
+	if addr := dotenv.GetString("TLS_REDIRECT_ADDR"); addr != "" && cfg.HTTPAddr == "" {
+		// The older spelling of a redirecting HTTP_ADDR.
+		cfg.HTTPAddr, cfg.HTTPRedirect = addr, true
+	}
+	if cfg.TLSAutocertCacheDir == "" {
+		cfg.TLSAutocertCacheDir = "./certs"
+	}
+	cfg.RedirectCacheControl = map[int]string{
+		http.StatusMovedPermanently:  str("REDIRECT_CACHE_CONTROL_301", "public, max-age=86400"),
+		http.StatusFound:             str("REDIRECT_CACHE_CONTROL_302", "private, max-age=90"),
+		http.StatusTemporaryRedirect: str("REDIRECT_CACHE_CONTROL_307", "private, max-age=90"),
+		http.StatusPermanentRedirect: str("REDIRECT_CACHE_CONTROL_308", "public, max-age=86400"),
+	}
+	proxies, err := trustedProxies(list("TRUSTED_PROXIES", nil))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.TrustedProxies = proxies
+	cfg.OwnerQuotas = ownerQuotas(list("QUOTA_OVERRIDES", nil), cfg.Quota)
+	cfg.FeatureFlags = featureFlags(list("FEATURE_FLAGS", nil))
+	cfg.ShortDomains = shortDomains(list("SHORT_DOMAINS", nil), cfg.BaseURL)
+	for host, base := range cfg.ShortDomains {
+		cfg.ShortDomains[host] = withPrefix(base, prefix)
+	}
+	tenants, err := tenants(list("TENANTS", nil))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for host, t := range tenants {
+		t.BaseURL = withPrefix(t.BaseURL, prefix)
+		tenants[host] = t
+	}
+	cfg.Tenants = tenants
+	if err := cfg.checkTenants(); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains(util.CodeStrategies, cfg.CodeStrategy) {
+		errs = append(errs, fmt.Errorf("unknown CODE_STRATEGY %q", cfg.CodeStrategy))
+	}
+	if !slices.Contains([]string{ShortLinksAllow, ShortLinksReject, ShortLinksUnwrap}, cfg.ShortLinks) {
+		errs = append(errs, fmt.Errorf("unknown SHORT_LINKS %q", cfg.ShortLinks))
+	}
+	if cfg.ClickIP == "" {
+		cfg.ClickIP = ClickIPNone // str reads "none" as empty
+	}
+	if !slices.Contains([]string{ClickIPHash, ClickIPTruncate, ClickIPNone}, cfg.ClickIP) {
+		errs = append(errs, fmt.Errorf("unknown CLICK_IP %q", cfg.ClickIP))
+	}
+	if !slices.Contains([]string{ClickOverflowDropNew, ClickOverflowDropOld}, cfg.ClickOverflow) {
+		errs = append(errs, fmt.Errorf("unknown CLICK_OVERFLOW %q", cfg.ClickOverflow))
+	}
+	if cfg.ClickRetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("negative CLICK_RETENTION_DAYS %d", cfg.ClickRetentionDays))
+	}
+	if cfg.NoAnalytics {
+		cfg.ClickEvents = false
+	}
+	if cfg.WriteTimeout > 0 && cfg.RequestTimeout > 0 && cfg.WriteTimeout <= cfg.RequestTimeout {
+		// Requests that time out would be cut off before their 503.
+		errs = append(errs, fmt.Errorf("WRITE_TIMEOUT %s must be longer than REQUEST_TIMEOUT %s", cfg.WriteTimeout, cfg.RequestTimeout))
+	}
+	if cfg.CacheWarmTop < 0 {
+		errs = append(errs, fmt.Errorf("negative CACHE_WARM_TOP %d", cfg.CacheWarmTop))
+	}
+	if cfg.CacheWarmTop > 0 && cfg.LinkCacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("CACHE_WARM_TOP needs LINK_CACHE_TTL"))
+	}
+	if cfg.LeaderElection && cfg.LeaderLease < time.Second {
+		errs = append(errs, fmt.Errorf("LEADER_LEASE %s is under a second", cfg.LeaderLease))
+	}
+	for name, spec := range cfg.JobSchedules {
+		if !slices.Contains(Jobs, name) {
+			errs = append(errs, fmt.Errorf("JOB_SCHEDULES: unknown job %q", name))
+			continue
+		}
+		if _, err := cron.ParseStandard(spec); err != nil {
+			errs = append(errs, fmt.Errorf("JOB_SCHEDULES: %s: %w", name, err))
+		}
+	}
+	if cfg.ReputationThreshold < 0 || cfg.ReputationThreshold > 100 {
+		errs = append(errs, fmt.Errorf("REPUTATION_THRESHOLD must be between 0 and 100"))
+	}
+	if cfg.ReputationAPIURL != "" && hostOf(cfg.ReputationAPIURL) == "" {
+		errs = append(errs, fmt.Errorf("invalid REPUTATION_API_URL %q", cfg.ReputationAPIURL))
+	}
+	if (cfg.LivenessRejectDead || cfg.LivenessInterval > 0) && !cfg.LivenessCheck {
+		errs = append(errs, fmt.Errorf("LIVENESS_REJECT_DEAD and LIVENESS_INTERVAL need LIVENESS_CHECK"))
+	}
+	if cfg.CORSAllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+		errs = append(errs, fmt.Errorf("CORS_ALLOW_CREDENTIALS needs the origins listed in CORS_ALLOWED_ORIGINS, not \"*\""))
+	}
+	if cfg.CaptchaShorten && cfg.CaptchaProvider == "" {
+		errs = append(errs, fmt.Errorf("CAPTCHA_SHORTEN needs CAPTCHA_PROVIDER"))
+	}
+	if cfg.CaptchaProvider != "" {
+		if !slices.Contains(captcha.Providers, cfg.CaptchaProvider) {
+			errs = append(errs, fmt.Errorf("unknown CAPTCHA_PROVIDER %q", cfg.CaptchaProvider))
+		}
+		if cfg.CaptchaSecret == "" {
+			errs = append(errs, fmt.Errorf("CAPTCHA_PROVIDER needs CAPTCHA_SECRET"))
+		}
+	}
+	if cfg.ArchiveAfterDays < 0 {
+		errs = append(errs, fmt.Errorf("negative ARCHIVE_AFTER_DAYS %d", cfg.ArchiveAfterDays))
+	}
+	if cfg.ArchiveAfterDays > 0 {
+		if !slices.Contains([]string{"postgres", "mysql", "memory"}, cfg.DBDriver) {
+			errs = append(errs, fmt.Errorf("ARCHIVE_AFTER_DAYS is not supported with DB_DRIVER=%s", cfg.DBDriver))
+		}
+		// Without click events every link looks unused.
+		if !cfg.ClickEvents {
+			errs = append(errs, fmt.Errorf("ARCHIVE_AFTER_DAYS needs CLICK_EVENTS"))
+		}
+	}
+	if cfg.DBDriver == "mongodb" {
+		if err := options.Client().ApplyURI(cfg.MongoURI).Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("MONGODB_URI: %w", err))
+		}
+	}
+	if cfg.DBDriver == "redis" && cfg.RedisURL == "" {
+		errs = append(errs, fmt.Errorf("DB_DRIVER=redis needs REDIS_URL"))
+	}
+	if cfg.RedisURL != "" {
+		if _, err := redis.ParseURL(cfg.RedisURL); err != nil {
+			errs = append(errs, fmt.Errorf("REDIS_URL: %w", err))
+		}
+	}
+	if cfg.GeoIPDatabase != "" {
+		if _, err := os.Stat(cfg.GeoIPDatabase); err != nil {
+			errs = append(errs, fmt.Errorf("GEOIP_DATABASE: %w", err))
+		}
+	}
+	for i, scheme := range cfg.AppSchemes {
+		scheme = strings.ToLower(strings.TrimSuffix(scheme, "://"))
+		if !appScheme.MatchString(scheme) || slices.Contains(unsafeSchemes, scheme) {
+			errs = append(errs, fmt.Errorf("APP_SCHEMES: %q cannot be used for app links", scheme))
+		}
+		cfg.AppSchemes[i] = scheme
+	}
+	for _, f := range []struct{ name, value string }{{"APP_STORE_URL", cfg.AppStoreURL}, {"PLAY_STORE_URL", cfg.PlayStoreURL}, {"FALLBACK_URL", cfg.FallbackURL}} {
+		if u, err := url.Parse(f.value); f.value != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			errs = append(errs, fmt.Errorf("invalid %s %q", f.name, f.value))
+		}
+	}
+	for _, f := range []struct{ name, path string }{
+		{"APPLE_APP_SITE_ASSOCIATION", cfg.AppleAppSiteAssociation},
+		{"ASSET_LINKS", cfg.AssetLinks},
+	} {
+		if f.path == "" {
+			continue
+		}
+		b, err := os.ReadFile(f.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+			continue
+		}
+		if !json.Valid(b) {
+			errs = append(errs, fmt.Errorf("%s: %s is not JSON", f.name, f.path))
+		}
+	}
+	if cfg.SiteDir != "" {
+		if fi, err := os.Stat(cfg.SiteDir); err != nil || !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("SITE_DIR: %s is not a directory", cfg.SiteDir))
+		}
+	}
+	if cfg.ErrorPage != "" {
+		if _, err := template.ParseFiles(cfg.ErrorPage); err != nil {
+			errs = append(errs, fmt.Errorf("ERROR_PAGE: %w", err))
+		}
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// checkDB reports the DB_* settings a SQL database cannot be reached
+// without, which would otherwise only fail when connecting.
+func (cfg Config) checkDB() []error {
+	driver := cfg.DBDriver
+	if !sqlDriver(driver) {
+		driver = cfg.MigrateFrom
+	}
+	var errs []error
+	for _, f := range []struct{ name, value string }{
+		{"DB_HOST", cfg.DBHost},
+		{"DB_PORT", cfg.DBPort},
+		{"DB_NAME", cfg.DBName},
+		{"DB_USER", cfg.DBUser},
+	} {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("%s is not set; %s needs it", f.name, driver))
+		}
+	}
+	if cfg.DBPort != "" && !validPort(cfg.DBPort) {
+		errs = append(errs, fmt.Errorf("DB_PORT %q is not a port number", cfg.DBPort))
+	}
+	return errs
+}
+
+// checkListener reports a BASE_URL short links cannot be made from and a
+// PORT the server cannot listen on. PORT may be left out when the server
+// listens on UNIX_SOCKET or on sockets systemd passes in.
+func (cfg Config) checkListener() []error {
+	var errs []error
+	switch u, err := url.Parse(cfg.BaseURL); {
+	case cfg.BaseURL == "":
+		errs = append(errs, fmt.Errorf("BASE_URL is not set; use where short links point, e.g. https://sho.rt/"))
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		errs = append(errs, fmt.Errorf("BASE_URL %q is not an absolute http(s) URL, e.g. https://sho.rt/", cfg.BaseURL))
+	}
+	switch {
+	case cfg.Port != "" && !validPort(cfg.Port):
+		errs = append(errs, fmt.Errorf("PORT %q is not a port number", cfg.Port))
+	case cfg.Port == "" && cfg.UnixSocket == "" && os.Getenv("LISTEN_FDS") == "":
+		errs = append(errs, fmt.Errorf("PORT is not set; set it or UNIX_SOCKET"))
+	}
+	return errs
+}
+
+// validPort reports whether s is a TCP port number.
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 0 && n <= 65535
+}
+
+// shortDomains indexes extra base URLs by host, skipping unparsable entries
+// and the default domain.
+func shortDomains(baseURLs []string, defaultBase string) map[string]string {
+	domains := make(map[string]string)
+	def := hostOf(defaultBase)
+	for _, base := range baseURLs {
+		host := hostOf(base)
+		if host == "" || host == def {
+			continue
+		}
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		domains[host] = base
+	}
+	return domains
+}
+
+// trustedProxies parses CIDRs, or single addresses standing for themselves.
+func trustedProxies(entries []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, entry := range entries {
+		if ip, err := netip.ParseAddr(entry); err == nil {
+			out = append(out, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// pathPrefix normalizes PATH_PREFIX to a leading slash and no trailing one,
+// or "" for the root.
+func pathPrefix(raw string) (string, error) {
+	p := strings.Trim(strings.TrimSpace(raw), "/")
+	if p == "" {
+		return "", nil
+	}
+	p = "/" + p
+	if path.Clean(p) != p || strings.ContainsAny(p, ":*?# ") {
+		return "", fmt.Errorf("invalid PATH_PREFIX %q", raw)
+	}
+	return p, nil
+}
+
+// withPrefix adds prefix to the path of base, which ends in a slash, unless
+// the path already ends with it.
+func withPrefix(base, prefix string) string {
+	if prefix == "" || strings.HasSuffix(base, prefix+"/") {
+		return base
+	}
+	return base + prefix[1:] + "/"
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// DomainFor maps a request Host onto a short domain key: the host itself when
+// it is one of ShortDomains, otherwise "" for the default domain.
+func (cfg Config) DomainFor(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if _, ok := cfg.ShortDomains[host]; ok {
+		return host
+	}
+	return ""
+}
+
+// DefaultDomain is the host of BASE_URL.
+func (cfg Config) DefaultDomain() string {
+	return hostOf(cfg.BaseURL)
+}
+
+// BaseURLFor returns the base URL short links on domain are built from.
+func (cfg Config) BaseURLFor(domain string) string {
+	if base, ok := cfg.ShortDomains[domain]; ok {
+		return base
+	}
+	return cfg.BaseURL
+}
+
+// str reads a string variable, or returns def when unset. "none" yields "".
+func str(key, def string) string {
+	v := strings.TrimSpace(dotenv.GetString(key))
+	switch {
+	case v == "":
+		return def
+	case strings.EqualFold(v, "none"):
+		return ""
+	}
+	return v
+}
+
+// list reads a comma-separated variable, trimming blanks, or returns def when unset.
+func list(key string, def []string) []string {
+	raw := dotenv.GetString(key)
+	if strings.TrimSpace(raw) == "" {
+		return def
+	}
+
+	var out []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// apiKeys reads a comma-separated list of owner:key pairs into a key -> owner
+// map. Entries missing either half are ignored.
+func apiKeys(key string) map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range list(key, nil) {
+		owner, k, ok := strings.Cut(pair, ":")
+		owner, k = strings.TrimSpace(owner), strings.TrimSpace(k)
+		if ok && owner != "" && k != "" {
+			keys[k] = owner
+		}
+	}
+	return keys
+}
+
+// jobSchedules reads semicolon-separated name=spec entries, e.g.
+// "cleanup=0 3 * * *;rescan=@every 30m"; commas belong to cron
+// expressions. Entries without a name are skipped.
+func jobSchedules(key string) map[string]string {
+	schedules := make(map[string]string)
+	for _, entry := range strings.Split(dotenv.GetString(key), ";") {
+		name, spec, _ := strings.Cut(entry, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			schedules[name] = strings.TrimSpace(spec)
+		}
+	}
+	return schedules
+}
+
+// ownerQuotas parses owner:setting=value;setting=value entries, e.g.
+// "alice:links_per_day=1000;links_total=0". Settings left out keep the
+// default; unknown settings and malformed values are ignored.
+func ownerQuotas(entries []string, def model.Quota) map[string]model.Quota {
+	quotas := make(map[string]model.Quota)
+	for _, entry := range entries {
+		owner, settings, ok := strings.Cut(entry, ":")
+		owner = strings.TrimSpace(owner)
+		if !ok || owner == "" {
+			continue
+		}
+		q := def
+		for _, setting := range strings.Split(settings, ";") {
+			name, value, _ := strings.Cut(setting, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				continue
+			}
+			switch strings.TrimSpace(name) {
+			case "links_per_day":
+				q.LinksPerDay = n
+			case "links_total":
+				q.LinksTotal = n
+			case "clicks_per_month":
+				q.ClicksPerMonth = n
+			}
+		}
+		quotas[owner] = q
+	}
+	return quotas
+}
+
+// featureFlags parses name:term;term entries, where each term is either a
+// percentage such as 25% or an owner the flag is on for. Entries without a
+// name are skipped.
+func featureFlags(entries []string) map[string]model.FeatureFlag {
+	flags := make(map[string]model.FeatureFlag)
+	for _, entry := range entries {
+		name, terms, _ := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		flag := model.FeatureFlag{Name: name}
+		for _, term := range strings.Split(terms, ";") {
+			term = strings.TrimSpace(term)
+			if pct, ok := strings.CutSuffix(term, "%"); ok {
+				if n, err := strconv.Atoi(pct); err == nil {
+					flag.Percent = min(max(n, 0), 100)
+				}
+			} else if term != "" {
+				flag.Owners = append(flag.Owners, term)
+			}
+		}
+		flags[name] = flag
+	}
+	return flags
+}
+
+// duration reads a Go duration string such as "30s", or returns def when unset or invalid.
+func duration(key string, def time.Duration) time.Duration {
+	if d := dotenv.GetDuration(key); d != 0 {
+		return d
+	}
+	return def
+}
+
+// fraction reads a number between 0 and 1, or returns def when unset or out
+// of range.
+func fraction(key string, def float64) float64 {
+	if f := dotenv.GetFloat64(key); f > 0 && f < 1 {
+		return f
+	}
+	return def
+}
+
+// boolean reads true or false, or returns def when unset or invalid.
+func boolean(key string, def bool) bool {
+	if b, err := strconv.ParseBool(dotenv.GetString(key)); err == nil {
+		return b
+	}
+	return def
+}
+
+// integer reads an integer variable, or returns def when unset, invalid or not positive.
+func integer(key string, def int) int {
+	if n := dotenv.GetInt(key); n > 0 {
+		return n
+	}
+	return def
+}
+
+// SQL reports whether DBDriver is one of the SQL databases, as opposed to
+// the memory driver or a backend that stores only links.
+func (cfg Config) SQL() bool {
+	return sqlDriver(cfg.DBDriver)
+}
+
+func sqlDriver(driver string) bool {
+	return driver == "postgres" || driver == "mysql"
 }
 
 func (cfg Config) BindAddr() string {
 	return fmt.Sprintf("%s:%s", cfg.Domain, cfg.Port)
 }
 
+// LogClientIPs reports whether access logs may show client addresses.
+func (cfg Config) LogClientIPs() bool {
+	return !cfg.NoAnalytics && cfg.ClickIP != ClickIPNone
+}
+
+// TLSEnabled reports whether the server should terminate TLS itself.
+func (cfg Config) TLSEnabled() bool {
+	return cfg.TLSAutocert || (cfg.TLSCertFile != "" && cfg.TLSKeyFile != "")
+}
+
 func (cfg Config) DSN() string {
+	if cfg.DBDriver == "mysql" {
+		return cfg.mysqlDSN()
+	}
 	return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s",
 		cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DBHost, cfg.DBPort, cfg.SSLMode)
 }
+
+// mysqlDSN maps the shared DB settings onto go-sql-driver/mysql's DSN format.
+// DB_SSLMODE keeps its Postgres spelling: disable turns TLS off, require skips
+// certificate verification and the verify-* modes enable full verification.
+// clientFoundRows makes UPDATE report matched rather than changed rows, as
+// Postgres does.
+func (cfg Config) mysqlDSN() string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&clientFoundRows=true",
+		cfg.DBUser, cfg.DBPass, cfg.DBHost, cfg.DBPort, cfg.DBName)
+
+	switch cfg.SSLMode {
+	case "disable":
+		dsn += "&tls=false"
+	case "require":
+		dsn += "&tls=skip-verify"
+	case "verify-ca", "verify-full":
+		dsn += "&tls=true"
+	}
+	return dsn
+}
@@ -1,10 +1,36 @@
 package config
 
 import (
+	"errors"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
 )
 
+// TestMain gives the tests the settings Load requires, which they override
+// as they need.
+func TestMain(m *testing.M) {
+	for key, value := range map[string]string{
+		"BASE_URL": "https://sho.rt/",
+		"PORT":     "3001",
+		"DB_HOST":  "localhost",
+		"DB_PORT":  "5432",
+		"DB_NAME":  "shawty",
+		"DB_USER":  "shawty",
+	} {
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	os.Exit(m.Run())
+}
+
 func TestConfig_Load(t *testing.T) {
 	// Save original environment
 	originalEnv := make(map[string]string)
@@ -110,46 +136,24 @@ func TestConfig_Load_EmptyEnvironment(t *testing.T) {
 		os.Unsetenv(key)
 	}
 
-	cfg, err := Load()
-	if err != nil {
-		t.Fatalf("Load() failed: %v", err)
-	}
-
-	// All fields should be empty strings
-	if cfg.DBUser != "" {
-		t.Errorf("Expected empty DBUser, got '%s'", cfg.DBUser)
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Expected an error for an empty environment")
 	}
-
-	if cfg.DBPass != "" {
-		t.Errorf("Expected empty DBPass, got '%s'", cfg.DBPass)
-	}
-
-	if cfg.DBName != "" {
-		t.Errorf("Expected empty DBName, got '%s'", cfg.DBName)
-	}
-
-	if cfg.DBHost != "" {
-		t.Errorf("Expected empty DBHost, got '%s'", cfg.DBHost)
-	}
-
-	if cfg.DBPort != "" {
-		t.Errorf("Expected empty DBPort, got '%s'", cfg.DBPort)
-	}
-
-	if cfg.SSLMode != "" {
-		t.Errorf("Expected empty SSLMode, got '%s'", cfg.SSLMode)
-	}
-
-	if cfg.BaseURL != "/" {
-		t.Errorf("Expected BaseURL '/', got '%s'", cfg.BaseURL)
-	}
-
-	if cfg.Domain != "" {
-		t.Errorf("Expected empty Domain, got '%s'", cfg.Domain)
+	// Every missing setting is reported at once.
+	for _, key := range []string{"DB_HOST", "DB_PORT", "DB_NAME", "DB_USER", "BASE_URL", "PORT"} {
+		if !strings.Contains(err.Error(), key+" is not set") {
+			t.Errorf("Expected the error to name %s, got %v", key, err)
+		}
 	}
 
-	if cfg.Port != "" {
-		t.Errorf("Expected empty Port, got '%s'", cfg.Port)
+	os.Setenv("DB_DRIVER", "memory")
+	defer os.Unsetenv("DB_DRIVER")
+	os.Setenv("UNIX_SOCKET", "/run/shawty.sock")
+	defer os.Unsetenv("UNIX_SOCKET")
+	_, err = Load()
+	if err == nil || strings.Contains(err.Error(), "DB_") || strings.Contains(err.Error(), "PORT") {
+		t.Errorf("Expected only BASE_URL to be missing without a SQL database or TCP port, got %v", err)
 	}
 }
 
@@ -169,16 +173,6 @@ func TestConfig_BaseURL_TrailingSlash(t *testing.T) {
 			input:    "https://short.ly/",
 			expected: "https://short.ly/",
 		},
-		{
-			name:     "Empty string",
-			input:    "",
-			expected: "/",
-		},
-		{
-			name:     "Just slash",
-			input:    "/",
-			expected: "/",
-		},
 		{
 			name:     "Multiple trailing slashes",
 			input:    "https://short.ly//",
@@ -358,3 +352,847 @@ func BenchmarkConfig_BindAddr(b *testing.B) {
 		cfg.BindAddr()
 	}
 }
+
+func TestConfig_DSN_MySQL(t *testing.T) {
+	testCases := []struct {
+		sslMode  string
+		expected string
+	}{
+		{"disable", "testuser:testpass@tcp(localhost:3306)/testdb?parseTime=true&clientFoundRows=true&tls=false"},
+		{"require", "testuser:testpass@tcp(localhost:3306)/testdb?parseTime=true&clientFoundRows=true&tls=skip-verify"},
+		{"verify-full", "testuser:testpass@tcp(localhost:3306)/testdb?parseTime=true&clientFoundRows=true&tls=true"},
+		{"", "testuser:testpass@tcp(localhost:3306)/testdb?parseTime=true&clientFoundRows=true"},
+	}
+
+	for _, tc := range testCases {
+		cfg := Config{
+			DBDriver: "mysql",
+			DBUser:   "testuser",
+			DBPass:   "testpass",
+			DBName:   "testdb",
+			DBHost:   "localhost",
+			DBPort:   "3306",
+			SSLMode:  tc.sslMode,
+		}
+
+		if dsn := cfg.DSN(); dsn != tc.expected {
+			t.Errorf("sslmode %q: expected DSN '%s', got '%s'", tc.sslMode, tc.expected, dsn)
+		}
+	}
+}
+
+func TestConfig_Load_DefaultDriver(t *testing.T) {
+	original, set := os.LookupEnv("DB_DRIVER")
+	defer func() {
+		if set {
+			os.Setenv("DB_DRIVER", original)
+		} else {
+			os.Unsetenv("DB_DRIVER")
+		}
+	}()
+
+	os.Unsetenv("DB_DRIVER")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.DBDriver != "postgres" {
+		t.Errorf("Expected default DBDriver 'postgres', got '%s'", cfg.DBDriver)
+	}
+
+	os.Setenv("DB_DRIVER", "mysql")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.DBDriver != "mysql" {
+		t.Errorf("Expected DBDriver 'mysql', got '%s'", cfg.DBDriver)
+	}
+
+	os.Setenv("DB_DRIVER", "sqlite")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an unknown DB_DRIVER")
+	}
+}
+
+func TestConfig_Load_MigrateFrom(t *testing.T) {
+	t.Setenv("DB_DRIVER", "dynamodb")
+	t.Setenv("MIGRATE_FROM", "Postgres")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.MigrateFrom != "postgres" {
+		t.Errorf("Expected MigrateFrom 'postgres', got '%s'", cfg.MigrateFrom)
+	}
+
+	for _, tc := range []struct{ driver, from string }{
+		{"dynamodb", "dynamodb"},
+		{"dynamodb", "memory"},
+		{"dynamodb", "sqlite"},
+		{"mysql", "postgres"},
+	} {
+		t.Setenv("DB_DRIVER", tc.driver)
+		t.Setenv("MIGRATE_FROM", tc.from)
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected an error migrating from %s to %s", tc.from, tc.driver)
+		}
+	}
+}
+
+func TestConfig_Load_APIKeys(t *testing.T) {
+	original, set := os.LookupEnv("API_KEYS")
+	defer func() {
+		if set {
+			os.Setenv("API_KEYS", original)
+		} else {
+			os.Unsetenv("API_KEYS")
+		}
+	}()
+
+	os.Setenv("API_KEYS", "alice:k1, bob : k2 ,broken,:nokey,noowner:")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	expected := map[string]string{"k1": "alice", "k2": "bob"}
+	if len(cfg.APIKeys) != len(expected) {
+		t.Fatalf("Expected %d API keys, got %v", len(expected), cfg.APIKeys)
+	}
+	for k, owner := range expected {
+		if cfg.APIKeys[k] != owner {
+			t.Errorf("Expected key %s to belong to %s, got %q", k, owner, cfg.APIKeys[k])
+		}
+	}
+}
+
+func TestConfig_Load_Tenants(t *testing.T) {
+	keys := []string{"API_KEYS", "TENANTS", "TENANT_ACME_API_KEYS"}
+	for _, key := range keys {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+	}
+
+	os.Setenv("API_KEYS", "alice:k1")
+	os.Setenv("TENANTS", "acme=https://go.acme.test")
+	os.Setenv("TENANT_ACME_API_KEYS", "bob:k2")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	tenant, ok := cfg.TenantFor("GO.acme.test:443")
+	want := Tenant{ID: "acme", BaseURL: "https://go.acme.test/", APIKeys: map[string]string{"k2": "bob"}}
+	if !ok || !reflect.DeepEqual(tenant, want) {
+		t.Fatalf("expected %+v, got %+v (found %v)", want, tenant, ok)
+	}
+	view := cfg.ForTenant(tenant)
+	if view.BaseURLFor("") != "https://go.acme.test/" || view.APIKeys["k1"] != "" || view.AdminOwners != nil {
+		t.Errorf("expected the tenant's view to hold its own base URL and keys only, got %+v", view)
+	}
+	if _, ok := cfg.TenantFor("localhost:3001"); ok {
+		t.Error("expected other hosts to belong to the default tenant")
+	}
+
+	for env, value := range map[string]string{
+		"TENANT_ACME_API_KEYS": "alice:k3",
+		"TENANTS":              "ACME=https://go.acme.test",
+	} {
+		original := os.Getenv(env)
+		os.Setenv(env, value)
+		if _, err := Load(); err == nil {
+			t.Errorf("%s=%s: expected an error", env, value)
+		}
+		os.Setenv(env, original)
+	}
+}
+
+func TestConfig_Load_PathPrefix(t *testing.T) {
+	keys := []string{"BASE_URL", "SHORT_DOMAINS", "PATH_PREFIX"}
+	for _, key := range keys {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+	}
+
+	os.Setenv("BASE_URL", "https://example.com")
+	os.Setenv("SHORT_DOMAINS", "https://sho.rt/s/")
+	os.Setenv("PATH_PREFIX", "s/")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.PathPrefix != "/s" {
+		t.Errorf("expected PATH_PREFIX to be normalized to /s, got %q", cfg.PathPrefix)
+	}
+	if cfg.BaseURL != "https://example.com/s/" || cfg.BaseURLFor("sho.rt") != "https://sho.rt/s/" {
+		t.Errorf("expected the prefix on every base URL once, got %q and %q", cfg.BaseURL, cfg.BaseURLFor("sho.rt"))
+	}
+
+	for _, prefix := range []string{"/a/../b", "/:code", "/a b"} {
+		os.Setenv("PATH_PREFIX", prefix)
+		if _, err := Load(); err == nil {
+			t.Errorf("PATH_PREFIX=%s: expected an error", prefix)
+		}
+	}
+}
+
+func TestConfig_Load_TrustedProxies(t *testing.T) {
+	original, set := os.LookupEnv("TRUSTED_PROXIES")
+	defer func() {
+		if set {
+			os.Setenv("TRUSTED_PROXIES", original)
+		} else {
+			os.Unsetenv("TRUSTED_PROXIES")
+		}
+	}()
+
+	os.Setenv("TRUSTED_PROXIES", "10.1.2.3/8, 192.0.2.7, ::1")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	if !reflect.DeepEqual(cfg.TrustedProxies, want) {
+		t.Errorf("expected %v, got %v", want, cfg.TrustedProxies)
+	}
+
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+	if _, err := Load(); err == nil {
+		t.Error("expected an invalid CIDR to be rejected")
+	}
+}
+
+func TestConfig_Load_HTTPAddr(t *testing.T) {
+	keys := []string{"HTTP_ADDR", "HTTP_REDIRECT", "TLS_REDIRECT_ADDR"}
+	for _, key := range keys {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+		os.Unsetenv(key)
+	}
+
+	os.Setenv("HTTP_ADDR", ":8080")
+	cfg, err := Load()
+	if err != nil || cfg.HTTPAddr != ":8080" || cfg.HTTPRedirect {
+		t.Errorf("expected HTTP_ADDR to serve the API, got %q redirect=%v (err %v)", cfg.HTTPAddr, cfg.HTTPRedirect, err)
+	}
+
+	os.Unsetenv("HTTP_ADDR")
+	os.Setenv("TLS_REDIRECT_ADDR", ":80")
+	cfg, err = Load()
+	if err != nil || cfg.HTTPAddr != ":80" || !cfg.HTTPRedirect {
+		t.Errorf("expected TLS_REDIRECT_ADDR to redirect, got %q redirect=%v (err %v)", cfg.HTTPAddr, cfg.HTTPRedirect, err)
+	}
+}
+
+func TestConfig_Load_GeoIPDatabase(t *testing.T) {
+	original, set := os.LookupEnv("GEOIP_DATABASE")
+	defer func() {
+		if set {
+			os.Setenv("GEOIP_DATABASE", original)
+		} else {
+			os.Unsetenv("GEOIP_DATABASE")
+		}
+	}()
+
+	db := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	os.WriteFile(db, nil, 0o644)
+	os.Setenv("GEOIP_DATABASE", db)
+	cfg, err := Load()
+	if err != nil || cfg.GeoIPDatabase != db {
+		t.Errorf("Expected GEOIP_DATABASE to be read, got %q (err %v)", cfg.GeoIPDatabase, err)
+	}
+
+	os.Setenv("GEOIP_DATABASE", db+".missing")
+	if _, err := Load(); err == nil {
+		t.Error("Expected a missing GEOIP_DATABASE to be rejected")
+	}
+}
+
+func TestConfig_Load_ClickWriter(t *testing.T) {
+	keys := []string{"CLICK_WRITERS", "CLICK_OVERFLOW"}
+	for _, key := range keys {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+		os.Unsetenv(key)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.ClickWriters != 1 || cfg.ClickOverflow != ClickOverflowDropNew {
+		t.Errorf("Expected one writer dropping new clicks by default, got %d and %q", cfg.ClickWriters, cfg.ClickOverflow)
+	}
+
+	os.Setenv("CLICK_WRITERS", "4")
+	os.Setenv("CLICK_OVERFLOW", "DROP_OLD")
+	if cfg, err = Load(); err != nil || cfg.ClickWriters != 4 || cfg.ClickOverflow != ClickOverflowDropOld {
+		t.Errorf("Expected 4 writers dropping old clicks, got %d and %q (err %v)", cfg.ClickWriters, cfg.ClickOverflow, err)
+	}
+	os.Setenv("CLICK_OVERFLOW", "block")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an unknown CLICK_OVERFLOW to be rejected")
+	}
+}
+
+func TestConfig_Load_Privacy(t *testing.T) {
+	keys := []string{"CLICK_IP", "NO_ANALYTICS", "CLICK_EVENTS"}
+	for _, key := range keys {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+		os.Unsetenv(key)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.ClickIP != ClickIPHash || !cfg.LogClientIPs() {
+		t.Errorf("Expected hashed IPs and IPs in logs by default, got %q", cfg.ClickIP)
+	}
+
+	os.Setenv("CLICK_IP", "None")
+	if cfg, err = Load(); err != nil || cfg.ClickIP != ClickIPNone || cfg.LogClientIPs() {
+		t.Errorf("Expected CLICK_IP=none to keep IPs out, got %q (err %v)", cfg.ClickIP, err)
+	}
+	os.Setenv("CLICK_IP", "encrypt")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an unknown CLICK_IP to be rejected")
+	}
+	os.Unsetenv("CLICK_IP")
+
+	os.Setenv("CLICK_EVENTS", "true")
+	os.Setenv("NO_ANALYTICS", "true")
+	if cfg, err = Load(); err != nil || cfg.ClickEvents || cfg.LogClientIPs() {
+		t.Errorf("Expected NO_ANALYTICS to override CLICK_EVENTS, got %+v (err %v)", cfg.ClickEvents, err)
+	}
+}
+
+func TestConfig_Load_RedirectCacheControl(t *testing.T) {
+	for _, key := range []string{"REDIRECT_CACHE_CONTROL_302", "REDIRECT_CACHE_CONTROL_301"} {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+	}
+
+	os.Setenv("REDIRECT_CACHE_CONTROL_302", "no-store")
+	os.Setenv("REDIRECT_CACHE_CONTROL_301", "none")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	if got := cfg.RedirectCacheControl[302]; got != "no-store" {
+		t.Errorf("Expected 302 policy no-store, got %q", got)
+	}
+	if got := cfg.RedirectCacheControl[301]; got != "" {
+		t.Errorf("Expected none to disable the 301 policy, got %q", got)
+	}
+	if got := cfg.RedirectCacheControl[308]; got != "public, max-age=86400" {
+		t.Errorf("Expected default 308 policy, got %q", got)
+	}
+}
+
+func TestConfig_ShortDomains(t *testing.T) {
+	cfg := Config{BaseURL: "https://shawt.ly/"}
+	cfg.ShortDomains = shortDomains([]string{"https://Example.to", "https://shawt.ly/", "::bad"}, cfg.BaseURL)
+
+	if len(cfg.ShortDomains) != 1 || cfg.ShortDomains["example.to"] != "https://Example.to/" {
+		t.Fatalf("Expected only example.to with a trailing slash, got %v", cfg.ShortDomains)
+	}
+
+	testCases := []struct {
+		host   string
+		domain string
+		base   string
+	}{
+		{"example.to", "example.to", "https://Example.to/"},
+		{"EXAMPLE.TO:8080", "example.to", "https://Example.to/"},
+		{"shawt.ly", "", "https://shawt.ly/"},
+		{"localhost:3001", "", "https://shawt.ly/"},
+	}
+	for _, tc := range testCases {
+		domain := cfg.DomainFor(tc.host)
+		if domain != tc.domain {
+			t.Errorf("DomainFor(%q) = %q, want %q", tc.host, domain, tc.domain)
+		}
+		if base := cfg.BaseURLFor(domain); base != tc.base {
+			t.Errorf("BaseURLFor(%q) = %q, want %q", domain, base, tc.base)
+		}
+	}
+}
+
+func TestOwnerQuotas(t *testing.T) {
+	def := model.Quota{LinksPerDay: 100, LinksTotal: 1000}
+	got := ownerQuotas([]string{"alice:links_per_day=5;clicks_per_month=50", "bob:links_total=0;bogus=1;links_per_day=x", "broken", ":links_total=1"}, def)
+
+	want := map[string]model.Quota{
+		"alice": {LinksPerDay: 5, LinksTotal: 1000, ClicksPerMonth: 50},
+		"bob":   {LinksPerDay: 100},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestFeatureFlags(t *testing.T) {
+	got := featureFlags([]string{"adaptive_codes:10%;alice; bob", "cache:250%", "off:", ":5%"})
+
+	want := map[string]model.FeatureFlag{
+		"adaptive_codes": {Name: "adaptive_codes", Percent: 10, Owners: []string{"alice", "bob"}},
+		"cache":          {Name: "cache", Percent: 100},
+		"off":            {Name: "off"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestLive_Reload(t *testing.T) {
+	keys := []string{"API_KEYS", "PORT", "QUOTA_LINKS_PER_DAY", "CLICK_IP", "LOG_LEVEL", "REPORT_LIMIT"}
+	for _, key := range keys {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+	}
+
+	os.Setenv("API_KEYS", "alice:old-key")
+	os.Setenv("PORT", "8080")
+	os.Unsetenv("QUOTA_LINKS_PER_DAY")
+	os.Unsetenv("LOG_LEVEL")
+	os.Unsetenv("REPORT_LIMIT")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	live := NewLive(cfg)
+	var seen *Config
+	live.OnReload(func(cfg *Config) { seen = cfg })
+
+	os.Setenv("API_KEYS", "alice:new-key")
+	os.Setenv("PORT", "9090")
+	os.Setenv("QUOTA_LINKS_PER_DAY", "5")
+	os.Setenv("LOG_LEVEL", "error")
+	os.Setenv("REPORT_LIMIT", "20")
+	got, err := live.Reload()
+	if err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if got.APIKeys["new-key"] != "alice" || got.Quota.LinksPerDay != 5 || got.LogLevel != LogError || got.ReportLimit != 20 {
+		t.Errorf("Expected the new keys, quota, log level and report limit, got %v, %+v, %q and %d", got.APIKeys, got.Quota, got.LogLevel, got.ReportLimit)
+	}
+	if got.Port != "8080" {
+		t.Errorf("Expected PORT to keep its startup value, got %q", got.Port)
+	}
+	if live.Get() != got || seen != got {
+		t.Error("Expected the new snapshot to be current and passed to watchers")
+	}
+
+	os.Setenv("CLICK_IP", "encrypt")
+	if _, err := live.Reload(); err == nil || live.Get() != got {
+		t.Errorf("Expected an invalid configuration to be rejected and the current one kept, got %v", err)
+	}
+}
+
+func TestConfig_Load_ArchiveAfterDays(t *testing.T) {
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("CLICK_EVENTS", "true")
+	t.Setenv("ARCHIVE_AFTER_DAYS", "180")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.ArchiveAfterDays != 180 {
+		t.Errorf("Expected ArchiveAfterDays 180, got %d", cfg.ArchiveAfterDays)
+	}
+
+	t.Setenv("NO_ANALYTICS", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error archiving without click events")
+	}
+	t.Setenv("NO_ANALYTICS", "")
+	t.Setenv("DB_DRIVER", "redis")
+	t.Setenv("REDIS_URL", "redis://localhost:6379")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error archiving with DB_DRIVER=redis")
+	}
+}
+
+func TestConfig_Load_CacheWarm(t *testing.T) {
+	t.Setenv("CACHE_WARM_TOP", "500")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error warming without LINK_CACHE_TTL")
+	}
+	t.Setenv("LINK_CACHE_TTL", "5m")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.CacheWarmTop != 500 || cfg.CacheWarmDays != 7 {
+		t.Errorf("Expected 500 links from 7 days, got %d from %d", cfg.CacheWarmTop, cfg.CacheWarmDays)
+	}
+}
+
+func TestConfig_Load_LeaderElection(t *testing.T) {
+	t.Setenv("LEADER_ELECTION", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if !cfg.LeaderElection || cfg.LeaderLease != 15*time.Second {
+		t.Errorf("Expected leader election with a 15s lease, got %v, %s", cfg.LeaderElection, cfg.LeaderLease)
+	}
+	t.Setenv("LEADER_LEASE", "100ms")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a lease under a second")
+	}
+}
+
+func TestConfig_Load_JobSchedules(t *testing.T) {
+	t.Setenv("JOB_SCHEDULES", "cleanup=0 3 * * *; rescan = 0,30 * * * *;")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	want := map[string]string{"cleanup": "0 3 * * *", "rescan": "0,30 * * * *"}
+	if !reflect.DeepEqual(cfg.JobSchedules, want) {
+		t.Errorf("Expected %v, got %v", want, cfg.JobSchedules)
+	}
+	for _, bad := range []string{"backup=@daily", "cleanup=every day"} {
+		t.Setenv("JOB_SCHEDULES", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestConfig_Load_CORSCredentials(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for credentials with any origin")
+	}
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com,https://*.example.com")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if !cfg.CORSAllowCredentials || len(cfg.CORSAllowedOrigins) != 2 {
+		t.Errorf("Expected credentials for 2 origins, got %v and %v", cfg.CORSAllowCredentials, cfg.CORSAllowedOrigins)
+	}
+}
+
+func TestConfig_Load_Captcha(t *testing.T) {
+	t.Setenv("CAPTCHA_SHORTEN", "true")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for CAPTCHA_SHORTEN without a provider")
+	}
+	t.Setenv("CAPTCHA_PROVIDER", "Turnstile")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error without CAPTCHA_SECRET")
+	}
+	t.Setenv("CAPTCHA_SECRET", "s3cret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.CaptchaProvider != "turnstile" || !cfg.CaptchaShorten || cfg.ReportLimit != 10 {
+		t.Errorf("Expected turnstile on /shorten and 10 reports an hour, got %q, %v and %d", cfg.CaptchaProvider, cfg.CaptchaShorten, cfg.ReportLimit)
+	}
+	t.Setenv("CAPTCHA_PROVIDER", "recaptcha")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+func TestConfig_Load_Reputation(t *testing.T) {
+	t.Setenv("REPUTATION_THRESHOLD", "101")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a threshold over 100")
+	}
+	t.Setenv("REPUTATION_THRESHOLD", "60")
+	t.Setenv("REPUTATION_API_URL", "not a url")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an invalid REPUTATION_API_URL")
+	}
+	t.Setenv("REPUTATION_API_URL", "https://rep.example.com/v1/domains")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.ReputationThreshold != 60 || cfg.ReputationAPIURL != "https://rep.example.com/v1/domains" {
+		t.Errorf("Expected threshold 60 with the API, got %d and %q", cfg.ReputationThreshold, cfg.ReputationAPIURL)
+	}
+}
+
+func TestConfig_Load_Liveness(t *testing.T) {
+	t.Setenv("LIVENESS_INTERVAL", "1h")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for LIVENESS_INTERVAL without LIVENESS_CHECK")
+	}
+	t.Setenv("LIVENESS_CHECK", "true")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.LivenessInterval != time.Hour || cfg.LivenessTimeout != 5*time.Second || cfg.LivenessMaxBytes != 64<<10 || cfg.LivenessBatchSize != 100 {
+		t.Errorf("Expected the interval with default limits, got %+v", cfg)
+	}
+}
+
+func TestConfig_Load_AppLinks(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ASSET_LINKS", filepath.Join(dir, "missing.json"))
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a missing ASSET_LINKS file")
+	}
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte("[{"), 0o644)
+	t.Setenv("ASSET_LINKS", bad)
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an ASSET_LINKS file that is not JSON")
+	}
+	good := filepath.Join(dir, "assetlinks.json")
+	os.WriteFile(good, []byte(`[{"relation":["delegate_permission/common.handle_all_urls"]}]`), 0o644)
+	t.Setenv("ASSET_LINKS", good)
+	if cfg, err := Load(); err != nil || cfg.AssetLinks != good {
+		t.Errorf("Expected ASSET_LINKS accepted, got %q (%v)", cfg.AssetLinks, err)
+	}
+}
+
+func TestConfig_Load_AppSchemes(t *testing.T) {
+	t.Setenv("APP_SCHEMES", "myapp,javascript")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for javascript as an app scheme")
+	}
+	t.Setenv("APP_SCHEMES", "MyApp://,fb-messenger")
+	t.Setenv("APP_STORE_URL", "itms-apps://apps.apple.com/app/id123")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a store URL that is not a web page")
+	}
+	t.Setenv("APP_STORE_URL", "https://apps.apple.com/app/id123")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.AppSchemes, []string{"myapp", "fb-messenger"}) {
+		t.Errorf("Expected the schemes lowercased without ://, got %v", cfg.AppSchemes)
+	}
+}
+
+func TestConfig_Load_ErrorPages(t *testing.T) {
+	t.Setenv("FALLBACK_URL", "/home")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a relative FALLBACK_URL")
+	}
+	t.Setenv("FALLBACK_URL", "")
+
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.html")
+	os.WriteFile(bad, []byte("<h1>{{.Reason</h1>"), 0o644)
+	t.Setenv("ERROR_PAGE", bad)
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an ERROR_PAGE that does not parse")
+	}
+	good := filepath.Join(dir, "error.html")
+	os.WriteFile(good, []byte("<h1>{{.Reason}}</h1>"), 0o644)
+	t.Setenv("ERROR_PAGE", good)
+	if cfg, err := Load(); err != nil || cfg.ErrorPage != good {
+		t.Errorf("Expected ERROR_PAGE accepted, got %q (%v)", cfg.ErrorPage, err)
+	}
+}
+
+func TestConfig_Load_ConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yml := filepath.Join(dir, "shawty.yaml")
+	os.WriteFile(yml, []byte(`
+db:
+  driver: memory
+  max_open_conns: 20
+cors:
+  allowed_origins: [https://a.example, https://b.example]
+link_cache_ttl: 5m
+`), 0o644)
+	t.Setenv("CONFIG_FILE", yml)
+	t.Setenv("DB_MAX_OPEN_CONNS", "5")
+	t.Cleanup(func() { loadFile("") })
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.DBDriver != "memory" || cfg.LinkCacheTTL != 5*time.Minute {
+		t.Errorf("Expected settings from the file, got %q and %v", cfg.DBDriver, cfg.LinkCacheTTL)
+	}
+	if cfg.DBMaxOpenConns != 5 {
+		t.Errorf("Expected the environment to override the file, got %d", cfg.DBMaxOpenConns)
+	}
+	if !reflect.DeepEqual(cfg.CORSAllowedOrigins, []string{"https://a.example", "https://b.example"}) {
+		t.Errorf("Expected a list from the file, got %v", cfg.CORSAllowedOrigins)
+	}
+
+	tml := filepath.Join(dir, "shawty.toml")
+	os.WriteFile(tml, []byte("[db]\ndriver = \"memory\"\n\n[webhook]\nsecret = \"s3cret\"\n"), 0o644)
+	t.Setenv("CONFIG_FILE", tml)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.WebhookSecret != "s3cret" || cfg.LinkCacheTTL != 0 || len(cfg.CORSAllowedOrigins) != 0 {
+		t.Errorf("Expected only the new file's settings, got %q, %v and %v", cfg.WebhookSecret, cfg.LinkCacheTTL, cfg.CORSAllowedOrigins)
+	}
+
+	ini := filepath.Join(dir, "shawty.ini")
+	os.WriteFile(ini, []byte("db_driver=memory\n"), 0o644)
+	t.Setenv("CONFIG_FILE", ini)
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a file that is neither YAML nor TOML")
+	}
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "missing.yaml"))
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestConfig_Load_LogLevelAndMigrations(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.LogLevel != LogInfo || !cfg.AutoMigrate {
+		t.Errorf("Expected info logging and migrations by default, got %q and %v", cfg.LogLevel, cfg.AutoMigrate)
+	}
+	t.Setenv("LOG_LEVEL", "Debug")
+	t.Setenv("AUTO_MIGRATE", "false")
+	if cfg, err = Load(); err != nil || cfg.LogLevel != LogDebug || cfg.AutoMigrate {
+		t.Errorf("Expected debug logging without migrations, got %q and %v (%v)", cfg.LogLevel, cfg.AutoMigrate, err)
+	}
+	t.Setenv("LOG_LEVEL", "trace")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an unknown LOG_LEVEL")
+	}
+}
+
+func TestConfig_Load_Validation(t *testing.T) {
+	for _, tc := range []struct{ key, value string }{
+		{"BASE_URL", "/"},
+		{"BASE_URL", "short.ly"},
+		{"BASE_URL", "ftp://short.ly/"},
+		{"PORT", "http"},
+		{"PORT", "70000"},
+		{"DB_PORT", "postgres"},
+	} {
+		t.Run(tc.key+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.key, tc.value)
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tc.key) {
+				t.Errorf("Expected an error naming %s, got %v", tc.key, err)
+			}
+		})
+	}
+
+	t.Setenv("CLICK_IP", "encrypt")
+	t.Setenv("SHORT_LINKS", "follow")
+	t.Setenv("GEOIP_DATABASE", filepath.Join(t.TempDir(), "missing.mmdb"))
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "CLICK_IP") || !strings.Contains(err.Error(), "SHORT_LINKS") {
+		t.Errorf("Expected both mistakes reported, got %v", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the missing GeoIP database to be kept in the error, got %v", err)
+	}
+}
+
+func TestConfig_Load_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	password := filepath.Join(dir, "db_password")
+	os.WriteFile(password, []byte("s3cret\n"), 0o600)
+	t.Setenv("DB_USER_PASSWORD", "file:"+password)
+	t.Setenv("SECRETS_REFRESH", "1h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.DBPass != "s3cret" || cfg.SecretsRefresh != time.Hour {
+		t.Errorf("Expected the password read from its file, got %q and %v", cfg.DBPass, cfg.SecretsRefresh)
+	}
+
+	live := NewLive(cfg)
+	os.WriteFile(password, []byte("rotated\n"), 0o600)
+	if got, err := live.Reload(); err != nil || got.DBPass != "rotated" {
+		t.Errorf("Expected a reload to pick up the rotated password, got %q (%v)", got.DBPass, err)
+	}
+
+	t.Setenv("WEBHOOK_SECRET", "file:"+filepath.Join(dir, "missing"))
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("CODE_SEQUENCE_KEY", "vault:secret/data/shawty#key")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "WEBHOOK_SECRET") || !strings.Contains(err.Error(), "CODE_SEQUENCE_KEY") {
+		t.Errorf("Expected both unresolvable secrets reported, got %v", err)
+	}
+}
+
+func TestConfig_Load_ServerTimeouts(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.ReadHeaderTimeout != 5*time.Second || cfg.WriteTimeout != time.Minute || cfg.MaxHeaderBytes != 64<<10 {
+		t.Errorf("Expected the default server limits, got %v, %v and %d", cfg.ReadHeaderTimeout, cfg.WriteTimeout, cfg.MaxHeaderBytes)
+	}
+
+	t.Setenv("WRITE_TIMEOUT", "10s")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a WRITE_TIMEOUT shorter than REQUEST_TIMEOUT")
+	}
+	t.Setenv("WRITE_TIMEOUT", "-1s")
+	t.Setenv("READ_TIMEOUT", "-1s")
+	if cfg, err = Load(); err != nil || cfg.WriteTimeout >= 0 || cfg.ReadTimeout >= 0 {
+		t.Errorf("Expected negative timeouts to be kept, turning them off, got %v and %v (%v)", cfg.WriteTimeout, cfg.ReadTimeout, err)
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// overrides are the variables Override sets.
+var (
+	overrideMu sync.Mutex
+	overrides  = make(map[string]string)
+)
+
+// Override sets the variable key to value for every Load from now on, above
+// the environment and .env, as command line flags do.
+func Override(key, value string) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	overrides[key] = value
+}
+
+// applyOverrides puts the overrides into the environment, where .env may
+// have replaced them.
+func applyOverrides() {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	for key, value := range overrides {
+		os.Setenv(key, value)
+	}
+}
+
+// fileVars are the variables the configuration file last set, so a reload
+// can tell them from those the environment sets and drop the ones the file
+// no longer has.
+var (
+	fileMu   sync.Mutex
+	fileVars = make(map[string]string)
+)
+
+// loadFile reads the YAML or TOML file at path into the environment,
+// beneath it: variables the environment already sets keep their values.
+// Sections name variables by joining their keys with underscores, so
+//
+//	db:
+//	  driver: postgres
+//	  max_open_conns: 20
+//
+// sets DB_DRIVER and DB_MAX_OPEN_CONNS. Lists become comma-separated
+// values. An empty path only drops what an earlier file set.
+func loadFile(path string) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	for key, val := range fileVars {
+		if cur, ok := os.LookupEnv(key); ok && cur == val {
+			os.Unsetenv(key)
+		}
+	}
+	clear(fileVars)
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return fmt.Errorf("CONFIG_FILE %q is neither .yaml, .yml nor .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE %s: %w", path, err)
+	}
+
+	vars := make(map[string]string)
+	if err := flatten("", tree, vars); err != nil {
+		return fmt.Errorf("CONFIG_FILE %s: %w", path, err)
+	}
+	for key, val := range vars {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		os.Setenv(key, val)
+		fileVars[key] = val
+	}
+	return nil
+}
+
+// flatten adds the variables v sets under prefix to vars.
+func flatten(prefix string, v any, vars map[string]string) error {
+	switch v := v.(type) {
+	case nil:
+	case map[string]any:
+		for k, sub := range v {
+			key := strings.ToUpper(strings.ReplaceAll(k, "-", "_"))
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			if err := flatten(key, sub, vars); err != nil {
+				return err
+			}
+		}
+	case map[any]any:
+		return fmt.Errorf("%s: keys must be strings", prefix)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]any, map[any]any, []any:
+				return fmt.Errorf("%s: lists may only hold values", prefix)
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		vars[prefix] = strings.Join(items, ",")
+	default:
+		vars[prefix] = fmt.Sprint(v)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Live is the running configuration: an immutable snapshot that Reload
+// replaces atomically, so a request sees either the old settings or the new
+// ones and never a mix.
+type Live struct {
+	cur atomic.Pointer[Config]
+
+	mu       sync.Mutex // serializes reloads
+	watchers []func(*Config)
+}
+
+func NewLive(cfg Config) *Live {
+	l := &Live{}
+	l.cur.Store(&cfg)
+	return l
+}
+
+// Get returns the current snapshot, which callers must not modify.
+func (l *Live) Get() *Config {
+	return l.cur.Load()
+}
+
+// OnReload calls fn with every snapshot Reload swaps in, for components that
+// derive state from the configuration.
+func (l *Live) OnReload(fn func(*Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.watchers = append(l.watchers, fn)
+}
+
+// Reload reads the configuration again, as Load does, and swaps in a
+// snapshot with its reloadable settings. The others keep their startup
+// values, since listeners, connections and workers were made from them. On
+// error the current snapshot stays in place.
+func (l *Live) Reload() (*Config, error) {
+	next, err := Load()
+	if err != nil {
+		return l.Get(), err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cfg := *l.cur.Load()
+	cfg.APIKeys = next.APIKeys
+	cfg.AdminOwners = next.AdminOwners
+	cfg.RedirectCacheControl = next.RedirectCacheControl
+	cfg.UniqueLinks = next.UniqueLinks
+	cfg.HonorDNT = next.HonorDNT
+	cfg.Quota = next.Quota
+	cfg.OwnerQuotas = next.OwnerQuotas
+	cfg.FeatureFlags = next.FeatureFlags
+	cfg.Tenants = next.Tenants
+	cfg.LogLevel = next.LogLevel
+	cfg.ReportLimit = next.ReportLimit
+	// New database connections log in with these.
+	cfg.DBUser = next.DBUser
+	cfg.DBPass = next.DBPass
+	l.cur.Store(&cfg)
+
+	for _, fn := range l.watchers {
+		fn(&cfg)
+	}
+	return &cfg, nil
+}
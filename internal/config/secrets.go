@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"urlshortener/urlshortener/internal/secret"
+
+	"github.com/sbowman/dotenv"
+)
+
+// secretTimeout bounds fetching every secret the configuration refers to.
+const secretTimeout = 30 * time.Second
+
+// secretSetting is a setting that may refer to a secret instead of holding
+// it, as DB_USER_PASSWORD=file:/run/secrets/db_password does.
+type secretSetting struct {
+	name  string
+	value *string
+}
+
+func (cfg *Config) secretSettings() []secretSetting {
+	return []secretSetting{
+		{"DB_USER", &cfg.DBUser},
+		{"DB_USER_PASSWORD", &cfg.DBPass},
+		{"CASSANDRA_USERNAME", &cfg.CassandraUsername},
+		{"CASSANDRA_PASSWORD", &cfg.CassandraPassword},
+		{"MONGODB_URI", &cfg.MongoURI},
+		{"REDIS_URL", &cfg.RedisURL},
+		{"WEBHOOK_SECRET", &cfg.WebhookSecret},
+		{"CODE_SEQUENCE_KEY", &cfg.CodeSequenceKey},
+		{"CLICK_IP_SALT", &cfg.ClickIPSalt},
+		{"CAPTCHA_SECRET", &cfg.CaptchaSecret},
+		{"SAFE_BROWSING_API_KEY", &cfg.SafeBrowsingAPIKey},
+		{"URLHAUS_AUTH_KEY", &cfg.URLhausAuthKey},
+		{"REPUTATION_API_KEY", &cfg.ReputationAPIKey},
+	}
+}
+
+// resolveSecrets replaces the settings that refer to secrets with the
+// secrets themselves. VAULT_TOKEN may itself be a file: reference.
+func (cfg *Config) resolveSecrets() []error {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	var errs []error
+	token := dotenv.GetString("VAULT_TOKEN")
+	if secret.IsRef(token) {
+		var err error
+		if token, err = secret.NewResolver("", "").Resolve(ctx, token); err != nil {
+			errs = append(errs, fmt.Errorf("VAULT_TOKEN: %w", err))
+		}
+	}
+	r := secret.NewResolver(dotenv.GetString("VAULT_ADDR"), token)
+	for _, s := range cfg.secretSettings() {
+		if !secret.IsRef(*s.value) {
+			continue
+		}
+		v, err := r.Resolve(ctx, *s.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		*s.value = v
+	}
+	return errs
+}
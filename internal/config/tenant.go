@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Tenant is a customer served on a host of its own, with its own links and
+// API keys. The default tenant, "", is everything configured outside TENANTS.
+type Tenant struct {
+	ID string
+	// BaseURL is where the tenant's short links live; its host selects the
+	// tenant.
+	BaseURL string
+	// APIKeys maps each of the tenant's API keys to the owner it
+	// authenticates.
+	APIKeys map[string]string
+}
+
+// tenantIDs are lower-case so they map onto TENANT_<ID>_API_KEYS.
+var tenantID = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// tenants reads TENANTS, comma-separated id=base_url pairs, and each
+// tenant's TENANT_<ID>_API_KEYS, keyed by the host of the base URL.
+func tenants(entries []string) (map[string]Tenant, error) {
+	out := make(map[string]Tenant)
+	for _, entry := range entries {
+		id, base, _ := strings.Cut(entry, "=")
+		id, base = strings.TrimSpace(id), strings.TrimSpace(base)
+		if !tenantID.MatchString(id) {
+			return nil, fmt.Errorf("TENANTS: invalid tenant id %q", id)
+		}
+		host := hostOf(base)
+		if host == "" {
+			return nil, fmt.Errorf("TENANTS: tenant %s needs a base URL", id)
+		}
+		if other, ok := out[host]; ok {
+			return nil, fmt.Errorf("TENANTS: tenants %s and %s share %s", other.ID, id, host)
+		}
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		out[host] = Tenant{ID: id, BaseURL: base, APIKeys: apiKeys("TENANT_" + strings.ToUpper(id) + "_API_KEYS")}
+	}
+	return out, nil
+}
+
+// checkTenants makes sure tenants are told apart: no tenant takes over a
+// short domain, and no owner has keys in two tenants. Owners are unique, so
+// what is keyed by owner alone, such as quotas and erasure, stays within one
+// tenant.
+func (cfg Config) checkTenants() error {
+	if len(cfg.Tenants) == 0 {
+		return nil
+	}
+	ownerTenant := make(map[string]string)
+	claim := func(tenant string, keys map[string]string) error {
+		for _, owner := range keys {
+			if other, ok := ownerTenant[owner]; ok && other != tenant {
+				return fmt.Errorf("TENANTS: owner %s has keys in tenants %q and %q", owner, other, tenant)
+			}
+			ownerTenant[owner] = tenant
+		}
+		return nil
+	}
+	if err := claim("", cfg.APIKeys); err != nil {
+		return err
+	}
+	for _, host := range slices.Sorted(maps.Keys(cfg.Tenants)) {
+		t := cfg.Tenants[host]
+		if _, ok := cfg.ShortDomains[host]; ok || host == cfg.DefaultDomain() {
+			return fmt.Errorf("TENANTS: %s of tenant %s is already a short domain", host, t.ID)
+		}
+		if err := claim(t.ID, t.APIKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TenantFor returns the tenant serving a request Host, or false for the
+// default tenant.
+func (cfg Config) TenantFor(host string) (Tenant, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	t, ok := cfg.Tenants[strings.ToLower(host)]
+	return t, ok
+}
+
+// ForTenant returns the configuration as t's requests see it: links on t's
+// base URL only, t's API keys and no admins.
+func (cfg Config) ForTenant(t Tenant) Config {
+	cfg.BaseURL = t.BaseURL
+	cfg.ShortDomains = nil
+	cfg.APIKeys = t.APIKeys
+	cfg.AdminOwners = nil
+	return cfg
+}
+
+type configKey struct{}
+
+// NewContext returns ctx carrying cfg as the configuration of the request it
+// belongs to.
+func NewContext(ctx context.Context, cfg *Config) context.Context {
+	return context.WithValue(ctx, configKey{}, cfg)
+}
+
+// For returns the configuration stored in ctx by NewContext, such as a
+// tenant's, or else the current snapshot.
+func (l *Live) For(ctx context.Context) *Config {
+	if cfg, ok := ctx.Value(configKey{}).(*Config); ok {
+		return cfg
+	}
+	return l.Get()
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Delays between connection attempts: the first retry waits firstRetry, and
+// each later one twice as long up to maxRetry.
+const (
+	firstRetry = 500 * time.Millisecond
+	maxRetry   = 10 * time.Second
+)
+
+// Login returns the user and password a new connection logs in with.
+type Login func() (user, password string)
+
+// Open connects to the configured SQL database, sized as the DB_* pool
+// settings say. Postgres goes through pgx, which prepares each statement once
+// per connection and reuses it unless DBNoStatementCache is set. Its
+// statements running longer than DBQueryTimeout are cancelled by the server.
+// A database that is not up yet, as when it starts alongside the server, is
+// retried with backoff for up to DBConnectTimeout. The memory driver and
+// the backends without SQL need no connection, so a nil *sql.DB is returned
+// for them, unless links are being migrated off a SQL database; that one is
+// opened instead. New connections log in with what login returns, when it is
+// not nil, so credentials rotated since startup apply without a restart.
+func Open(cfg config.Config, login Login) (*sql.DB, error) {
+	if !cfg.SQL() && cfg.MigrateFrom != "" {
+		cfg.DBDriver = cfg.MigrateFrom
+	}
+	if !cfg.SQL() {
+		return nil, nil
+	}
+
+	var db *sql.DB
+	if cfg.DBDriver == "postgres" {
+		cc, err := pgx.ParseConfig(cfg.DSN())
+		if err != nil {
+			return nil, err
+		}
+		if cfg.DBQueryTimeout > 0 {
+			cc.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.DBQueryTimeout.Milliseconds(), 10)
+		}
+		if cfg.DBNoStatementCache {
+			// Poolers in transaction mode hand each statement to whichever
+			// server connection is free, where a cached one does not exist.
+			cc.DefaultQueryExecMode = pgx.QueryExecModeExec
+		}
+		var opts []stdlib.OptionOpenDB
+		if login != nil {
+			opts = append(opts, stdlib.OptionBeforeConnect(func(_ context.Context, cc *pgx.ConnConfig) error {
+				cc.User, cc.Password = login()
+				return nil
+			}))
+		}
+		db = stdlib.OpenDB(*cc, opts...)
+	} else {
+		mc, err := mysql.ParseDSN(cfg.DSN())
+		if err != nil {
+			return nil, err
+		}
+		if login != nil {
+			mc.Apply(mysql.BeforeConnect(func(_ context.Context, mc *mysql.Config) error {
+				mc.User, mc.Passwd = login()
+				return nil
+			}))
+		}
+		connector, err := mysql.NewConnector(mc)
+		if err != nil {
+			return nil, err
+		}
+		db = sql.OpenDB(connector)
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	if cfg.DBMaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
+	if err := ping(db, cfg.DBConnectTimeout); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// ping waits for db to answer, retrying until timeout has passed.
+func ping(db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	wait := firstRetry
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("db: %v; retrying in %v", err, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait = min(2*wait, maxRetry)
+	}
+}
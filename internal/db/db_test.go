@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyDriver refuses the first fails connections, like a database that is
+// still starting.
+type flakyDriver struct {
+	fails    int32
+	attempts atomic.Int32
+}
+
+func (d *flakyDriver) Open(name string) (driver.Conn, error) {
+	if d.attempts.Add(1) <= d.fails {
+		return nil, errors.New("connection refused")
+	}
+	return conn{}, nil
+}
+
+type conn struct{}
+
+func (conn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (conn) Close() error                              { return nil }
+func (conn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+func (conn) Ping(ctx context.Context) error            { return nil }
+
+func TestPing_RetriesUntilUp(t *testing.T) {
+	d := &flakyDriver{fails: 2}
+	db := sql.OpenDB(connector{d})
+	defer db.Close()
+
+	if err := ping(db, 10*time.Second); err != nil {
+		t.Fatalf("expected the database to be reached, got %v", err)
+	}
+	if got := d.attempts.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestPing_GivesUp(t *testing.T) {
+	d := &flakyDriver{fails: 1000}
+	db := sql.OpenDB(connector{d})
+	defer db.Close()
+
+	start := time.Now()
+	if err := ping(db, 100*time.Millisecond); err == nil {
+		t.Fatal("expected an unreachable database to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to give up after the timeout, took %v", elapsed)
+	}
+}
+
+type connector struct{ d *flakyDriver }
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                            { return c.d }
@@ -0,0 +1,194 @@
+// Package feature decides which owners get features that are still being
+// rolled out, so a risky change can reach a few keys or a share of traffic
+// before everyone.
+package feature
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// AdaptiveCodes routes new links through the adaptive-length code generator.
+const AdaptiveCodes = "adaptive_codes"
+
+// LinkCache caches the owner's links for redirects.
+const LinkCache = "link_cache"
+
+// Sources of a flag.
+const (
+	SourceConfig = "config"
+	SourceAdmin  = "admin"
+)
+
+// setting is the setting the flags set through the API are kept in, as one
+// JSON object keyed by name.
+const setting = "feature_flags"
+
+// ErrNotFound is returned by Unset for a flag that was not set through the
+// API.
+var ErrNotFound = errors.New("flag not found")
+
+// Flags holds the configured flags and those set through the API, which
+// override them. The latter are stored as a setting so they survive restarts
+// and reach every instance on its next Refresh.
+type Flags struct {
+	settings repo.SettingsRepo // nil keeps them in memory only
+
+	mu     sync.RWMutex
+	config map[string]model.FeatureFlag
+	stored map[string]model.FeatureFlag
+}
+
+// New returns Flags starting from config. Call Refresh to load the flags
+// stored in settings.
+func New(settings repo.SettingsRepo, config map[string]model.FeatureFlag) *Flags {
+	return &Flags{settings: settings, config: config, stored: map[string]model.FeatureFlag{}}
+}
+
+// Enabled reports whether the feature name is on for owner. Owners are
+// bucketed by a hash of the flag name and owner, so raising Percent only
+// adds owners and each flag picks a different share. Unauthenticated callers
+// share the bucket of the empty owner. Unknown flags are off.
+func (f *Flags) Enabled(name, owner string) bool {
+	if f == nil {
+		return false
+	}
+	flag, ok := f.get(name)
+	if !ok {
+		return false
+	}
+	if slices.Contains(flag.Owners, owner) {
+		return true
+	}
+	return bucket(name, owner) < flag.Percent
+}
+
+func (f *Flags) get(name string) (model.FeatureFlag, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if flag, ok := f.stored[name]; ok {
+		return flag, true
+	}
+	flag, ok := f.config[name]
+	return flag, ok
+}
+
+// bucket maps owner to 0..99 for the flag name.
+func bucket(name, owner string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(owner))
+	return int(h.Sum32() % 100)
+}
+
+// List returns the flags in effect, sorted by name.
+func (f *Flags) List() []model.FeatureFlag {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	merged := make(map[string]model.FeatureFlag, len(f.config)+len(f.stored))
+	for name, flag := range f.config {
+		flag.Name, flag.Source = name, SourceConfig
+		merged[name] = flag
+	}
+	for name, flag := range f.stored {
+		flag.Name, flag.Source = name, SourceAdmin
+		merged[name] = flag
+	}
+	flags := make([]model.FeatureFlag, 0, len(merged))
+	for _, name := range slices.Sorted(maps.Keys(merged)) {
+		flags = append(flags, merged[name])
+	}
+	return flags
+}
+
+// SetConfig replaces the configured flags, as on a configuration reload.
+func (f *Flags) SetConfig(config map[string]model.FeatureFlag) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = config
+}
+
+// Set stores flag, overriding any configured flag of the same name.
+func (f *Flags) Set(ctx context.Context, flag model.FeatureFlag) (model.FeatureFlag, error) {
+	flag.Percent = min(max(flag.Percent, 0), 100)
+	flag.Source = SourceAdmin
+	err := f.update(ctx, func(stored map[string]model.FeatureFlag) error {
+		stored[flag.Name] = flag
+		return nil
+	})
+	return flag, err
+}
+
+// Unset removes a flag set through the API; a configured flag of the same
+// name applies again.
+func (f *Flags) Unset(ctx context.Context, name string) error {
+	return f.update(ctx, func(stored map[string]model.FeatureFlag) error {
+		if _, ok := stored[name]; !ok {
+			return ErrNotFound
+		}
+		delete(stored, name)
+		return nil
+	})
+}
+
+// update applies change to the freshest stored flags and saves them. Two
+// instances updating at the same moment may lose one of the changes.
+func (f *Flags) update(ctx context.Context, change func(map[string]model.FeatureFlag) error) error {
+	if err := f.Refresh(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored := maps.Clone(f.stored)
+	if err := change(stored); err != nil {
+		return err
+	}
+	if f.settings != nil {
+		b, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		if err := f.settings.PutSetting(ctx, setting, string(b)); err != nil {
+			return err
+		}
+	}
+	f.stored = stored
+	return nil
+}
+
+// Refresh reloads the flags set through the API, picking up changes other
+// instances made.
+func (f *Flags) Refresh(ctx context.Context) error {
+	if f.settings == nil {
+		return nil
+	}
+	v, err := f.settings.GetSetting(ctx, setting)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stored := map[string]model.FeatureFlag{}
+	if err := json.Unmarshal([]byte(v), &stored); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stored = stored
+	return nil
+}
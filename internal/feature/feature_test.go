@@ -0,0 +1,72 @@
+package feature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestFlags_Enabled(t *testing.T) {
+	f := New(nil, map[string]model.FeatureFlag{
+		"listed": {Owners: []string{"alice"}},
+		"half":   {Percent: 50},
+		"all":    {Percent: 100},
+	})
+
+	if !f.Enabled("listed", "alice") || f.Enabled("listed", "bob") {
+		t.Error("expected listed to be on for alice only")
+	}
+	if !f.Enabled("all", "") || f.Enabled("unknown", "alice") {
+		t.Error("expected all on and unknown off")
+	}
+
+	on := 0
+	for i := range 1000 {
+		if f.Enabled("half", fmt.Sprintf("owner-%d", i)) {
+			on++
+		}
+	}
+	if on < 400 || on > 600 {
+		t.Errorf("expected about half of 1000 owners, got %d", on)
+	}
+	var nilFlags *Flags
+	if nilFlags.Enabled("all", "alice") {
+		t.Error("expected nil Flags to have every feature off")
+	}
+}
+
+func TestFlags_SetUnset(t *testing.T) {
+	ctx := context.Background()
+	settings := repo.NewMemory()
+	f := New(settings, map[string]model.FeatureFlag{"cache": {Percent: 10}})
+
+	if _, err := f.Set(ctx, model.FeatureFlag{Name: "cache", Owners: []string{"bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled("cache", "bob") {
+		t.Error("expected the stored flag to override the configured one")
+	}
+
+	// Another instance sharing the settings sees the change on Refresh.
+	other := New(settings, nil)
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if list := other.List(); len(list) != 1 || list[0].Name != "cache" || list[0].Source != SourceAdmin {
+		t.Errorf("expected the stored cache flag, got %+v", list)
+	}
+
+	if err := f.Unset(ctx, "cache"); err != nil {
+		t.Fatal(err)
+	}
+	if list := f.List(); len(list) != 1 || list[0].Percent != 10 || list[0].Source != SourceConfig {
+		t.Errorf("expected the configured flag back, got %+v", list)
+	}
+	if err := f.Unset(ctx, "cache"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Package geoip locates client addresses with a MaxMind database, such as
+// GeoLite2-Country or GeoLite2-City, for operators who have no CDN to tell
+// them where visitors are.
+package geoip
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB reads locations from a MaxMind database file. It is safe for
+// concurrent use.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// record holds the fields Locate needs; the rest of each entry is skipped
+// while decoding.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+}
+
+// Open opens the database at path.
+func Open(path string) (*DB, error) {
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{reader: r}, nil
+}
+
+// Locate returns the ISO 3166-1 country code of addr and, when the database
+// has subdivisions, the ISO 3166-2 code of its region without the country
+// prefix, e.g. "FI" and "18". Unknown addresses return empty strings.
+func (db *DB) Locate(addr netip.Addr) (country, region string) {
+	var rec record
+	if err := db.reader.Lookup(addr.Unmap().AsSlice(), &rec); err != nil {
+		return "", ""
+	}
+	if len(rec.Subdivisions) > 0 {
+		region = rec.Subdivisions[0].ISOCode
+	}
+	return strings.ToUpper(rec.Country.ISOCode), strings.ToUpper(region)
+}
+
+// Close releases the database.
+func (db *DB) Close() error {
+	return db.reader.Close()
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithAdmin enables the /admin endpoints.
+func WithAdmin(a service.Admin) Option {
+	return func(h *Handler) { h.admin = a }
+}
+
+// GET /admin/links?limit=&offset=
+func (h *Handler) AdminListLinks(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	recs, err := h.admin.ListLinks(c.Request.Context(), limit, offset)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if recs == nil {
+		recs = []model.URLRecord{}
+	}
+	c.IndentedJSON(http.StatusOK, model.LinkPage{Links: recs, Limit: limit, Offset: offset})
+}
+
+// DELETE /admin/links/:code
+func (h *Handler) AdminDeleteLink(c *gin.Context) {
+	err := h.admin.DeleteLink(c.Request.Context(), middleware.Owner(c), c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GET /admin/stats
+func (h *Handler) AdminStats(c *gin.Context) {
+	stats, err := h.admin.Stats(c.Request.Context())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, stats)
+}
+
+// GET /admin/audit?actor=&subject=&action=&limit=&offset=
+// Lists the audit log, newest first, narrowed to the given actor, subject
+// (link code, domain or owner) and action.
+func (h *Handler) AdminAuditLog(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	filter := model.AuditFilter{Actor: c.Query("actor"), Subject: c.Query("subject"), Action: c.Query("action")}
+
+	entries, err := h.admin.AuditLog(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if entries == nil {
+		entries = []model.AuditEntry{}
+	}
+	c.IndentedJSON(http.StatusOK, model.AuditPage{Entries: entries, Limit: limit, Offset: offset})
+}
+
+// POST /admin/reload
+// Rereads the configuration and applies its reloadable settings, as SIGHUP
+// does. A configuration that fails to load leaves the running one in place.
+func (h *Handler) AdminReload(c *gin.Context) {
+	if _, err := h.live.Reload(); err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /admin/bans
+func (h *Handler) AdminListBans(c *gin.Context) {
+	bans, err := h.admin.BannedDomains(c.Request.Context())
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if bans == nil {
+		bans = []model.BannedDomain{}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"bans": bans})
+}
+
+// PUT /admin/bans/:domain
+// The body, {"reason": "..."}, is optional.
+func (h *Handler) AdminBan(c *gin.Context) {
+	var req model.BanReq
+	if c.Request.ContentLength != 0 {
+		if !requireJSON(c) {
+			return
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+			return
+		}
+	}
+
+	ban, err := h.admin.BanDomain(c.Request.Context(), middleware.Owner(c), c.Param("domain"), req.Reason)
+	switch {
+	case errors.Is(err, service.ErrInvalidDomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusOK, ban)
+	}
+}
+
+// DELETE /admin/bans/:domain
+func (h *Handler) AdminUnban(c *gin.Context) {
+	err := h.admin.UnbanDomain(c.Request.Context(), middleware.Owner(c), c.Param("domain"))
+	switch {
+	case errors.Is(err, service.ErrInvalidDomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain is not banned"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// maxImportBatch bounds the links of one import request; clients split
+// larger exports.
+const maxImportBatch = 1000
+
+// POST /admin/import
+// Stores links exported from another shortener under their original codes.
+// Links that cannot be imported are skipped and reported with the reason;
+// the rest are imported regardless.
+func (h *Handler) AdminImport(c *gin.Context) {
+	if !requireJSON(c) {
+		return
+	}
+
+	var req model.ImportReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing field: links"})
+		return
+	}
+	if len(req.Links) == 0 || len(req.Links) > maxImportBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "links must hold between 1 and " + strconv.Itoa(maxImportBatch) + " entries"})
+		return
+	}
+
+	domain, err := h.linkDomain(c.Request.Context(), "", req.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	opts := service.LinkOptions{Owner: req.Owner, Domain: domain}
+
+	res := model.ImportResult{Conflicts: []model.ImportConflict{}}
+	for i, link := range req.Links {
+		conflict := func(err error) {
+			res.Conflicts = append(res.Conflicts, model.ImportConflict{Row: i, Code: link.Code, Reason: err.Error()})
+		}
+
+		long, err := h.validURL(ctx, link.LongURL)
+		if err != nil {
+			conflict(err)
+			continue
+		}
+		link.LongURL = long
+
+		_, err = h.admin.ImportLink(ctx, middleware.Owner(c), h.cfg(ctx).BaseURLFor(domain), link, opts)
+		switch {
+		case err == nil:
+			res.Imported++
+		case errors.Is(err, service.ErrInvalidCode), errors.Is(err, service.ErrCodeTaken),
+			errors.Is(err, service.ErrURLTaken), errors.Is(err, service.ErrBanned):
+			conflict(err)
+		default:
+			// Storage trouble: stop, reporting how far the import got.
+			body := internalErrorBody(c, err)
+			body["imported"] = res.Imported
+			c.JSON(http.StatusInternalServerError, body)
+			return
+		}
+	}
+	c.IndentedJSON(http.StatusOK, res)
+}
+
+// pageParams reads limit and offset query parameters. On failure the 400
+// response has already been written.
+func pageParams(c *gin.Context) (limit, offset int, ok bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+		return 0, 0, false
+	}
+	offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must not be negative"})
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+type appLinkData struct {
+	Href         template.URL
+	App          string
+	AppStoreURL  string
+	PlayStoreURL string
+}
+
+// allowedApp reports whether u opens an app through one of the schemes
+// APP_SCHEMES approves.
+func (h *Handler) allowedApp(ctx context.Context, u *url.URL) bool {
+	return slices.Contains(h.cfg(ctx).AppSchemes, u.Scheme)
+}
+
+// appLink reports whether long opens an app rather than a web page.
+func appLink(long string) bool {
+	u, err := url.Parse(long)
+	return err == nil && u.Scheme != "http" && u.Scheme != "https"
+}
+
+// appLinkPage answers a visit to an app link with a page that tries to open
+// the app, and offers the store pages to visitors without it. Browsers do
+// not follow redirects to custom schemes, and when the app is missing a
+// redirect would leave nothing on screen.
+func (h *Handler) appLinkPage(c *gin.Context, long string) {
+	cfg := h.cfg(c.Request.Context())
+	u, _ := url.Parse(long)
+	data := appLinkData{
+		// The scheme was approved when the link was created; html/template
+		// would otherwise replace it with #ZgotmplZ.
+		Href:         template.URL(long),
+		App:          u.Scheme,
+		AppStoreURL:  cfg.AppStoreURL,
+		PlayStoreURL: cfg.PlayStoreURL,
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := templates.ExecuteTemplate(c.Writer, "applink.html", data); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cacheRedirect sets Cache-Control and a matching Expires header for a
+// redirect with the given status, following the configured policy.
+func (h *Handler) cacheRedirect(c *gin.Context, status int) {
+	policy := h.cfg(c.Request.Context()).RedirectCacheControl[status]
+	if policy == "" {
+		return
+	}
+	c.Header("Cache-Control", policy)
+	c.Header("Expires", time.Now().Add(maxAge(policy)).UTC().Format(http.TimeFormat))
+}
+
+// maxAge extracts max-age from a Cache-Control policy; policies without one,
+// or that forbid reuse, yield 0 and so an Expires of now.
+func maxAge(policy string) time.Duration {
+	var age time.Duration
+	for _, directive := range strings.Split(policy, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0
+		case "max-age":
+			if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+				age = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return age
+}
+
+// linkHeaders sets the validators of a link's current revision.
+func linkHeaders(c *gin.Context, rec model.URLRecord) {
+	c.Header("ETag", service.ETag(rec))
+	c.Header("Last-Modified", rec.UpdatedAt.UTC().Format(http.TimeFormat))
+}
+
+// notModified reports whether the request's conditional headers match rec's
+// current revision. If-None-Match takes precedence over If-Modified-Since.
+func notModified(c *gin.Context, rec model.URLRecord) bool {
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		etag := service.ETag(rec)
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !rec.UpdatedAt.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxClickField caps stored referrers and user agents.
+const maxClickField = 512
+
+// ClickRecorder receives a click event for every successful redirect. It must
+// not block.
+type ClickRecorder interface {
+	Record(ev model.ClickEvent)
+}
+
+// ClickQuota decides whether a click still fits its link owner's quota.
+type ClickQuota interface {
+	AllowClick(ctx context.Context, code string) bool
+}
+
+// WithClickQuota stops recording clicks on links whose owner is over their
+// monthly click quota. The redirects themselves are unaffected.
+func WithClickQuota(q ClickQuota) Option {
+	return func(h *Handler) { h.clickQuota = q }
+}
+
+// GeoLocator finds the country and region of a client address.
+type GeoLocator interface {
+	Locate(addr netip.Addr) (country, region string)
+}
+
+// WithGeoIP locates clicks with g instead of trusting a CF-IPCountry header.
+// The header still fills in the country of addresses g does not know.
+func WithGeoIP(g GeoLocator) Option {
+	return func(h *Handler) { h.geo = g }
+}
+
+func (h *Handler) recordClick(c *gin.Context, code string) {
+	// HEAD requests come from link checkers, not visitors.
+	if h.clicks == nil || c.Request.Method != http.MethodGet {
+		return
+	}
+	if h.cfg(c.Request.Context()).HonorDNT && (c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1") {
+		return
+	}
+	if h.clickQuota != nil && !h.clickQuota.AllowClick(c.Request.Context(), code) {
+		return
+	}
+
+	var country, region string
+	if addr, err := netip.ParseAddr(c.ClientIP()); err == nil && h.geo != nil {
+		country, region = h.geo.Locate(addr)
+	}
+	if country == "" {
+		country = strings.ToUpper(c.GetHeader("CF-IPCountry"))
+	}
+	if len(country) != 2 {
+		country = ""
+	}
+
+	h.clicks.Record(model.ClickEvent{
+		Code:      code,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  truncate(c.Request.Referer(), maxClickField),
+		IPHash:    h.clickNetwork(c.Request.Context(), c.ClientIP()),
+		UserAgent: truncate(c.Request.UserAgent(), maxClickField),
+		Country:   country,
+		Region:    region,
+	})
+}
+
+// clickNetwork returns what a click event keeps of the client address ip,
+// as configured by CLICK_IP.
+func (h *Handler) clickNetwork(ctx context.Context, ip string) string {
+	switch h.cfg(ctx).ClickIP {
+	case config.ClickIPNone:
+		return ""
+	case config.ClickIPTruncate:
+		if prefix, ok := network(ip); ok {
+			return prefix.String()
+		}
+		return ""
+	}
+	return hashIP(ip, h.ipSalt)
+}
+
+// network reduces ip to its /24 (IPv4) or /48 (IPv6) network.
+func network(ip string) (netip.Prefix, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	return prefix, err == nil
+}
+
+// hashIP hashes the network of ip with salt, so clicks from one network can
+// be grouped without the address being stored or recoverable.
+func hashIP(ip, salt string) string {
+	prefix, ok := network(ip)
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + prefix.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DELETE /users/:id/data
+// Erases the links, click events and usage of owner :id in one transaction.
+// Owners may erase themselves; admins may erase anyone.
+func (h *Handler) EraseUser(c *gin.Context) {
+	caller := middleware.Owner(c)
+	if caller == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+	owner := c.Param("id")
+	if owner != caller && !slices.Contains(h.cfg(c.Request.Context()).AdminOwners, caller) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot erase another user's data"})
+		return
+	}
+
+	erasure, err := h.admin.EraseOwner(c.Request.Context(), caller, owner)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, erasure)
+}
+
+// DELETE /links/:code/clicks
+// Deletes the click history of one of the caller's links; the link itself
+// keeps working.
+func (h *Handler) PurgeClicks(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	code := c.Param("code")
+	_, err := h.srv.Get(ctx, owner, code)
+	if err == nil {
+		_, err = h.admin.PurgeClicks(ctx, owner, code)
+	}
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
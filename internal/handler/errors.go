@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// internalError answers 500 for err, which is only logged: storage and other
+// internal errors may name hosts, tables or queries clients have no business
+// seeing. The request ID in the body finds the log line. Requests that ran
+// out of time get 503 instead, since trying again later may well work.
+func internalError(c *gin.Context, err error) {
+	body := internalErrorBody(c, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		body["error"] = "Request timed out"
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, body)
+}
+
+// internalErrorBody logs err and returns the body internalError sends, for
+// responses that add fields of their own.
+func internalErrorBody(c *gin.Context, err error) gin.H {
+	return logInternal(c.Request, middleware.RequestIDOf(c), err)
+}
+
+// logInternal logs err for r, the request with ID id, and returns the body
+// clients get instead.
+func logInternal(r *http.Request, id string, err error) gin.H {
+	log.Printf("%s %s [%s]: %v", r.Method, r.URL.Path, id, err)
+	body := gin.H{"error": "Internal server error"}
+	if id != "" {
+		body["request_id"] = id
+	}
+	return body
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// exportPageSize is how many links are read from the store at a time.
+	exportPageSize = 500
+	// maxExportChunk bounds the limit of a chunked export.
+	maxExportChunk = 10000
+)
+
+// GET /export
+// Streams the caller's links as NDJSON, one model.ExportLink per line in code
+// order. cursor resumes after the code of the last line received, so an
+// interrupted export, or one fetched in limit-sized chunks, picks up where it
+// stopped; a chunk shorter than limit is the last. stats=true adds each
+// link's click total.
+func (h *Handler) Export(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	limit := 0 // everything
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxExportChunk {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxExportChunk)})
+			return
+		}
+		limit = n
+	}
+	stats, err := strconv.ParseBool(c.DefaultQuery("stats", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stats must be true or false"})
+		return
+	}
+	cursor := c.Query("cursor")
+
+	ctx := c.Request.Context()
+	enc := json.NewEncoder(c.Writer)
+	started := false
+	for sent := 0; limit == 0 || sent < limit; {
+		n := exportPageSize
+		if limit > 0 {
+			n = min(n, limit-sent)
+		}
+		lines, err := h.exportPage(ctx, owner, cursor, n, stats)
+		if err != nil {
+			if !started {
+				internalError(c, err)
+				return
+			}
+			// The status has been sent; the client sees the stream end early
+			// and resumes from the last code it received.
+			c.Error(err)
+			return
+		}
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		for _, line := range lines {
+			if err := enc.Encode(line); err != nil {
+				return // client gone
+			}
+		}
+		c.Writer.Flush()
+
+		if len(lines) < n {
+			return
+		}
+		cursor = lines[len(lines)-1].Code
+		sent += len(lines)
+	}
+}
+
+// exportPage reads up to n of owner's links after cursor, with click totals
+// when stats is set and clicks are counted.
+func (h *Handler) exportPage(ctx context.Context, owner, cursor string, n int, stats bool) ([]model.ExportLink, error) {
+	recs, err := h.srv.Export(ctx, owner, cursor, n)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]model.ExportLink, len(recs))
+	for i, rec := range recs {
+		lines[i].URLRecord = rec
+		if stats && h.stats != nil {
+			clicks, err := h.stats.CountClicks(ctx, rec.Code)
+			if err != nil {
+				return nil, err
+			}
+			lines[i].Clicks = &clicks
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type errorPageData struct {
+	// Status is 404 for codes that do not exist and 410 for links that no
+	// longer redirect.
+	Status   int
+	Code     string
+	ShortURL string
+	Reason   string
+}
+
+// WithErrorPage answers visits to missing or unavailable links with t, the
+// deployment's ERROR_PAGE, rather than an empty body.
+func WithErrorPage(t *template.Template) Option {
+	return func(h *Handler) { h.errorPage = t }
+}
+
+// fallbackURL validates a link's fallback page like a destination. It must
+// be a web page, as visitors are redirected to it.
+func (h *Handler) fallbackURL(ctx context.Context, raw string) (string, error) {
+	long, err := h.validURL(ctx, raw)
+	if err != nil {
+		return "", fmt.Errorf("fallback_url: %w", err)
+	}
+	if appLink(long) {
+		return "", errFallbackURL
+	}
+	return long, nil
+}
+
+// unavailable answers a visit to code that failed with err. Visitors are
+// sent to the link's fallback page, or else the deployment's FALLBACK_URL,
+// or shown its error page; without either they get the bare status.
+func (h *Handler) unavailable(c *gin.Context, code string, err error) {
+	status := http.StatusNotFound
+	reason := "Link not found"
+	if gone(err) {
+		status, reason = http.StatusGone, err.Error()
+	}
+
+	target := h.cfg(c.Request.Context()).FallbackURL
+	var fe *service.FallbackError
+	if errors.As(err, &fe) {
+		target = fe.URL
+	}
+	// The link may come back, so neither answer may be cached.
+	if target != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, target)
+		c.Abort()
+		return
+	}
+	if h.errorPage == nil {
+		c.AbortWithStatus(status)
+		return
+	}
+
+	data := errorPageData{Status: status, Code: code, ShortURL: c.Request.Host + "/" + code, Reason: reason}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := h.errorPage.Execute(c.Writer, data); err != nil {
+		c.Error(err)
+	}
+	c.Abort()
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/feature"
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithFlags decides which owners get features being rolled out, and backs
+// the /admin/flags endpoints.
+func WithFlags(f *feature.Flags) Option {
+	return func(h *Handler) { h.flags = f }
+}
+
+// GET /admin/flags
+func (h *Handler) AdminListFlags(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{"flags": h.flags.List()})
+}
+
+// PUT /admin/flags/:name
+// Turns a feature on for the listed owners plus percent percent of the
+// rest, overriding FEATURE_FLAGS.
+func (h *Handler) AdminSetFlag(c *gin.Context) {
+	if !requireJSON(c) {
+		return
+	}
+	var req model.FeatureFlagReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+	if req.Percent < 0 || req.Percent > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percent must be between 0 and 100"})
+		return
+	}
+
+	flag, err := h.flags.Set(c.Request.Context(), model.FeatureFlag{Name: c.Param("name"), Percent: req.Percent, Owners: req.Owners})
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, flag)
+}
+
+// DELETE /admin/flags/:name
+// Drops a flag set through the API; a flag of the same name in
+// FEATURE_FLAGS applies again.
+func (h *Handler) AdminUnsetFlag(c *gin.Context) {
+	err := h.flags.Unset(c.Request.Context(), c.Param("name"))
+	switch {
+	case errors.Is(err, feature.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flag not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema/schema.graphql
+var graphqlSchema string
+
+// ClickCounter reports per-link click totals for the GraphQL clicks field.
+type ClickCounter interface {
+	CountClicks(ctx context.Context, code string) (int, error)
+}
+
+// WithStats exposes click totals through GraphQL.
+func WithStats(counter ClickCounter) Option {
+	return func(h *Handler) { h.stats = counter }
+}
+
+var (
+	errAPIKeyRequired = errors.New("API key required")
+	errLinkNotFound   = errors.New("Link not found")
+)
+
+type graphqlReq struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// gqlCaller is what resolvers know about the HTTP request they serve.
+type gqlCaller struct {
+	owner     string
+	host      string
+	ip        string
+	req       *http.Request
+	requestID string
+}
+
+type gqlCallerKey struct{}
+
+func caller(ctx context.Context) gqlCaller {
+	c, _ := ctx.Value(gqlCallerKey{}).(gqlCaller)
+	return c
+}
+
+// POST /graphql
+// Runs a query against the same service and validation as the REST routes.
+// Errors are reported in the response's errors list with status 200.
+func (h *Handler) GraphQL(c *gin.Context) {
+	if !requireJSON(c) {
+		return
+	}
+
+	var req graphqlReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badBody(c, err, "Missing field: query")
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), gqlCallerKey{}, gqlCaller{
+		owner:     middleware.Owner(c),
+		host:      c.Request.Host,
+		ip:        c.ClientIP(),
+		req:       c.Request,
+		requestID: middleware.RequestIDOf(c),
+	})
+	c.JSON(http.StatusOK, h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+func newSchema(h *Handler) *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &gqlRoot{h}, graphql.UseFieldResolvers(), graphql.MaxDepth(5))
+}
+
+type gqlRoot struct{ h *Handler }
+
+// owner returns the authenticated caller, failing for anonymous requests.
+func owner(ctx context.Context) (string, error) {
+	if o := caller(ctx).owner; o != "" {
+		return o, nil
+	}
+	return "", errAPIKeyRequired
+}
+
+// clientErrors are the service errors clients may see, as the REST routes
+// show them.
+var clientErrors = []error{
+	service.ErrFlagged, service.ErrBanned, service.ErrDeadDestination,
+	service.ErrNotMember, service.ErrConflict, service.ErrPreconditionFailed,
+	service.ErrDisabled, service.ErrExpired, service.ErrClickLimit,
+	service.ErrUnderReview,
+}
+
+// gqlError turns service errors into messages fit for API clients. Any other
+// error is logged like internalError's and hidden behind the request ID.
+func gqlError(ctx context.Context, err error) error {
+	if errors.Is(err, service.ErrNotFound) {
+		return errLinkNotFound
+	}
+	var qe *service.QuotaError
+	if errors.As(err, &qe) {
+		return qe
+	}
+	for _, known := range clientErrors {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+	c := caller(ctx)
+	body := logInternal(c.req, c.requestID, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		body["error"] = "Request timed out"
+	}
+	return gqlInternalError(body)
+}
+
+// gqlInternalError is the error clients get in place of an internal one,
+// with the request ID among its extensions.
+type gqlInternalError gin.H
+
+func (e gqlInternalError) Error() string { return e["error"].(string) }
+
+func (e gqlInternalError) Extensions() map[string]any {
+	if id, ok := e["request_id"]; ok {
+		return map[string]any{"request_id": id}
+	}
+	return nil
+}
+
+func (r *gqlRoot) Link(ctx context.Context, args struct{ Code string }) (*gqlLink, error) {
+	o, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := r.h.srv.Get(ctx, o, args.Code)
+	if errors.Is(err, service.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, gqlError(ctx, err)
+	}
+	return r.link(rec), nil
+}
+
+func (r *gqlRoot) Links(ctx context.Context, args struct {
+	Query         string
+	Limit, Offset int32
+}) ([]*gqlLink, error) {
+	o, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if args.Limit < 1 || args.Limit > maxPageSize || args.Offset < 0 {
+		return nil, errors.New("limit must be between 1 and 500 and offset not negative")
+	}
+	if len(args.Query) > maxQueryLen {
+		return nil, errors.New("query must be at most 200 characters")
+	}
+	recs, err := r.h.srv.List(ctx, o, strings.TrimSpace(args.Query), int(args.Limit), int(args.Offset))
+	if err != nil {
+		return nil, gqlError(ctx, err)
+	}
+	links := make([]*gqlLink, len(recs))
+	for i, rec := range recs {
+		links[i] = r.link(rec)
+	}
+	return links, nil
+}
+
+type gqlParam struct {
+	Key   string
+	Value string
+}
+
+type shortenInput struct {
+	URL           string
+	Domain        *string
+	UTM           *[]gqlParam
+	ExpiresAt     *graphql.Time
+	Title         *string
+	Description   *string
+	StripTracking *bool
+	Unique        *bool
+	MaxClicks     *int32
+	OneTime       *bool
+	FallbackUrl   *string
+	CaptchaToken  *string
+}
+
+func (r *gqlRoot) Shorten(ctx context.Context, args struct{ Input shortenInput }) (*gqlLink, error) {
+	in := args.Input
+	if r.h.anonymousCaptcha(ctx, caller(ctx).owner) {
+		if err := r.h.verifyCaptcha(ctx, deref(in.CaptchaToken), caller(ctx).ip); err != nil {
+			return nil, err
+		}
+	}
+	long, err := r.h.validURL(ctx, in.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := service.LinkOptions{Owner: caller(ctx).owner, StripTracking: in.StripTracking}
+	if in.UTM != nil {
+		opts.UTM = make(map[string]string, len(*in.UTM))
+		for _, p := range *in.UTM {
+			opts.UTM[p.Key] = p.Value
+		}
+		if !validParams(opts.UTM) {
+			return nil, errBadParams
+		}
+	}
+	if in.ExpiresAt != nil {
+		if !in.ExpiresAt.After(time.Now()) {
+			return nil, errPastExpiry
+		}
+		opts.ExpiresAt = &in.ExpiresAt.Time
+	}
+	opts.Title, opts.Description = deref(trimmed(in.Title)), deref(trimmed(in.Description))
+	if !validNotes(opts.Title, opts.Description) {
+		return nil, errLongNotes
+	}
+	if opts.Unique = in.Unique != nil && *in.Unique; opts.Unique && !r.h.cfg(ctx).UniqueLinks {
+		return nil, errNoUnique
+	}
+	if in.MaxClicks != nil {
+		if *in.MaxClicks < 0 {
+			return nil, errMaxClicks
+		}
+		opts.MaxClicks = int(*in.MaxClicks)
+	}
+	if in.OneTime != nil && *in.OneTime {
+		if opts.MaxClicks > 1 {
+			return nil, errOneTime
+		}
+		opts.MaxClicks = 1
+	}
+	if in.FallbackUrl != nil && *in.FallbackUrl != "" {
+		if opts.FallbackURL, err = r.h.fallbackURL(ctx, *in.FallbackUrl); err != nil {
+			return nil, err
+		}
+	}
+
+	var requested string
+	if in.Domain != nil {
+		requested = *in.Domain
+	}
+	if opts.Domain, err = r.h.linkDomain(ctx, caller(ctx).host, requested); err != nil {
+		return nil, err
+	}
+
+	rec, _, err := r.h.srv.Shorten(ctx, r.h.cfg(ctx).BaseURLFor(opts.Domain), long, opts)
+	if err != nil {
+		return nil, gqlError(ctx, err)
+	}
+	return r.link(rec), nil
+}
+
+func (r *gqlRoot) UpdateLink(ctx context.Context, args struct {
+	Code        string
+	URL         *string
+	Title       *string
+	Description *string
+	FallbackUrl *string
+	Etag        *string
+}) (*gqlLink, error) {
+	o, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if args.URL == nil && args.Title == nil && args.Description == nil && args.FallbackUrl == nil {
+		return nil, errors.New("url, title, description or fallbackUrl is required")
+	}
+	edit := service.LinkEdit{Title: trimmed(args.Title), Description: trimmed(args.Description), FallbackURL: args.FallbackUrl}
+	if args.URL != nil {
+		if edit.LongURL, err = r.h.validURL(ctx, *args.URL); err != nil {
+			return nil, err
+		}
+	}
+	if args.FallbackUrl != nil && *args.FallbackUrl != "" {
+		fallback, err := r.h.fallbackURL(ctx, *args.FallbackUrl)
+		if err != nil {
+			return nil, err
+		}
+		edit.FallbackURL = &fallback
+	}
+	if !validNotes(deref(edit.Title), deref(edit.Description)) {
+		return nil, errLongNotes
+	}
+	rec, err := r.h.srv.Update(ctx, o, args.Code, edit, deref(args.Etag))
+	if err != nil {
+		return nil, gqlError(ctx, err)
+	}
+	return r.link(rec), nil
+}
+
+func (r *gqlRoot) DisableLink(ctx context.Context, args struct{ Code string }) (*gqlLink, error) {
+	return r.setActive(ctx, args.Code, false)
+}
+
+func (r *gqlRoot) EnableLink(ctx context.Context, args struct{ Code string }) (*gqlLink, error) {
+	return r.setActive(ctx, args.Code, true)
+}
+
+func (r *gqlRoot) setActive(ctx context.Context, code string, active bool) (*gqlLink, error) {
+	o, err := owner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := r.h.srv.SetActive(ctx, o, code, active)
+	if err != nil {
+		return nil, gqlError(ctx, err)
+	}
+	return r.link(rec), nil
+}
+
+func (r *gqlRoot) DeleteLink(ctx context.Context, args struct{ Code string }) (bool, error) {
+	o, err := owner(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := r.h.srv.Delete(ctx, o, args.Code); err != nil {
+		return false, gqlError(ctx, err)
+	}
+	return true, nil
+}
+
+func (r *gqlRoot) link(rec model.URLRecord) *gqlLink {
+	return &gqlLink{rec: rec, stats: r.h.stats}
+}
+
+// gqlLink resolves the Link type from a URLRecord.
+type gqlLink struct {
+	rec   model.URLRecord
+	stats ClickCounter
+}
+
+func (l *gqlLink) ID() graphql.ID           { return graphql.ID(l.rec.ID) }
+func (l *gqlLink) Code() string             { return l.rec.Code }
+func (l *gqlLink) LongUrl() string          { return l.rec.LongUrl }
+func (l *gqlLink) ShortUrl() string         { return l.rec.ShortUrl }
+func (l *gqlLink) Destination() string      { return service.Destination(l.rec) }
+func (l *gqlLink) Owner() *string           { return optional(l.rec.Owner) }
+func (l *gqlLink) Domain() *string          { return optional(l.rec.Domain) }
+func (l *gqlLink) Active() bool             { return l.rec.Active }
+func (l *gqlLink) ScanStatus() string       { return l.rec.ScanStatus }
+func (l *gqlLink) ScannedAt() *graphql.Time { return optionalTime(l.rec.ScannedAt) }
+func (l *gqlLink) CreatedAt() graphql.Time  { return graphql.Time{Time: l.rec.CreatedAt} }
+func (l *gqlLink) UpdatedAt() graphql.Time  { return graphql.Time{Time: l.rec.UpdatedAt} }
+func (l *gqlLink) ExpiresAt() *graphql.Time { return optionalTime(l.rec.ExpiresAt) }
+func (l *gqlLink) Etag() string             { return service.ETag(l.rec) }
+func (l *gqlLink) Title() *string           { return optional(l.rec.Title) }
+func (l *gqlLink) Description() *string     { return optional(l.rec.Description) }
+func (l *gqlLink) OriginalUrl() *string     { return optional(l.rec.OriginalURL) }
+func (l *gqlLink) Unique() bool             { return l.rec.Unique }
+func (l *gqlLink) FallbackUrl() *string     { return optional(l.rec.FallbackURL) }
+
+// MaxClicks and ClickCount are null for links without a click limit.
+func (l *gqlLink) MaxClicks() *int32 {
+	if l.rec.MaxClicks <= 0 {
+		return nil
+	}
+	n := int32(l.rec.MaxClicks)
+	return &n
+}
+
+func (l *gqlLink) ClickCount() *int32 {
+	if l.rec.MaxClicks <= 0 {
+		return nil
+	}
+	n := int32(l.rec.ClickCount)
+	return &n
+}
+
+func (l *gqlLink) UTM() []gqlParam {
+	params := make([]gqlParam, 0, len(l.rec.UTM))
+	for k, v := range l.rec.UTM {
+		params = append(params, gqlParam{Key: k, Value: v})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Key < params[j].Key })
+	return params
+}
+
+func (l *gqlLink) Clicks(ctx context.Context) (*int32, error) {
+	if l.stats == nil {
+		return nil, nil
+	}
+	n, err := l.stats.CountClicks(ctx, l.rec.Code)
+	if err != nil {
+		return nil, gqlError(ctx, err)
+	}
+	clicks := int32(n)
+	return &clicks, nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func optionalTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
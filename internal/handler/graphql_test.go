@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type gqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newGraphQLRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := repo.NewMemory()
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, service.NewShortener(r), WithStats(r))
+	router := gin.New()
+	router.POST("/graphql", middleware.APIKey(map[string]string{"k1": "alice"}), h.GraphQL)
+	return router
+}
+
+func gql(t *testing.T, router *gin.Engine, key, query string) gqlResponse {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var resp gqlResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body, err)
+	}
+	return resp
+}
+
+func TestGraphQL_Lifecycle(t *testing.T) {
+	router := newGraphQLRouter()
+
+	resp := gql(t, router, "k1", `mutation {
+		shorten(input: {url: "https://example.com/", utm: [{key: "utm_source", value: "news"}]}) {
+			code destination owner active clicks
+		}
+	}`)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("shorten failed: %v", resp.Errors)
+	}
+	var created struct {
+		Code        string
+		Destination string
+		Owner       string
+		Active      bool
+		Clicks      *int
+	}
+	json.Unmarshal(resp.Data["shorten"], &created)
+	if created.Destination != "https://example.com/?utm_source=news" || created.Owner != "alice" || !created.Active {
+		t.Errorf("unexpected link %+v", created)
+	}
+	if created.Clicks == nil || *created.Clicks != 0 {
+		t.Errorf("expected 0 clicks, got %v", created.Clicks)
+	}
+
+	resp = gql(t, router, "k1", `{ links { code } link(code: "`+created.Code+`") { longUrl } }`)
+	if string(resp.Data["links"]) != `[{"code":"`+created.Code+`"}]` || string(resp.Data["link"]) != `{"longUrl":"https://example.com/"}` {
+		t.Errorf("unexpected query result %s %s", resp.Data["links"], resp.Data["link"])
+	}
+
+	resp = gql(t, router, "k1", `mutation { disableLink(code: "`+created.Code+`") { active } }`)
+	if string(resp.Data["disableLink"]) != `{"active":false}` {
+		t.Errorf("expected disabled link, got %s %v", resp.Data["disableLink"], resp.Errors)
+	}
+
+	resp = gql(t, router, "k1", `mutation { deleteLink(code: "`+created.Code+`") }`)
+	if string(resp.Data["deleteLink"]) != `true` {
+		t.Errorf("expected delete to succeed, got %s %v", resp.Data["deleteLink"], resp.Errors)
+	}
+	resp = gql(t, router, "k1", `{ link(code: "`+created.Code+`") { code } }`)
+	if string(resp.Data["link"]) != `null` {
+		t.Errorf("expected deleted link to be gone, got %s", resp.Data["link"])
+	}
+}
+
+func TestGraphQL_Errors(t *testing.T) {
+	router := newGraphQLRouter()
+
+	testCases := []struct {
+		name  string
+		key   string
+		query string
+		want  string
+	}{
+		{"anonymous list", "", `{ links { code } }`, "API key required"},
+		{"bad url", "k1", `mutation { shorten(input: {url: "ftp://example.com/"}) { code } }`, "Malformed or unsupported URL"},
+		{"unknown domain", "k1", `mutation { shorten(input: {url: "https://example.com/", domain: "nope.example"}) { code } }`, "Unknown domain"},
+		{"missing link", "k1", `mutation { disableLink(code: "NOPE42") { code } }`, "Link not found"},
+	}
+
+	for _, tc := range testCases {
+		resp := gql(t, router, tc.key, tc.query)
+		if len(resp.Errors) != 1 || resp.Errors[0].Message != tc.want {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.want, resp.Errors)
+		}
+	}
+}
+
+// brokenRepo fails like a database that went away.
+type brokenRepo struct{ *repo.MemoryRepo }
+
+var errBrokenRepo = errors.New("failed to connect to `host=db.internal user=shawty`: dial error")
+
+func (brokenRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	return model.URLRecord{}, errBrokenRepo
+}
+
+func (brokenRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	return nil, errBrokenRepo
+}
+
+func TestGraphQL_InternalErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, service.NewShortener(brokenRepo{repo.NewMemory()}))
+	router := gin.New()
+	router.POST("/graphql", middleware.RequestID(), middleware.APIKey(map[string]string{"k1": "alice"}), h.GraphQL)
+
+	for _, query := range []string{
+		`{ links(limit: 10) { code } }`,
+		`{ link(code: "abc123") { code } }`,
+	} {
+		resp := gql(t, router, "k1", query)
+		if len(resp.Errors) != 1 {
+			t.Fatalf("%s: expected one error, got %+v", query, resp.Errors)
+		}
+		e := resp.Errors[0]
+		if e.Message != "Internal server error" || strings.Contains(e.Message, "db.internal") {
+			t.Errorf("%s: expected the error to be hidden, got %q", query, e.Message)
+		}
+		if id, _ := e.Extensions["request_id"].(string); id == "" {
+			t.Errorf("%s: expected a request_id extension, got %v", query, e.Extensions)
+		}
+	}
+}
+
+func TestGraphQL_Captcha(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/", CaptchaShorten: true}, service.NewShortener(repo.NewMemory()), WithCaptcha(fakeCaptcha{}))
+	router := gin.New()
+	router.POST("/graphql", middleware.APIKey(map[string]string{"k1": "alice"}), h.GraphQL)
+
+	resp := gql(t, router, "", `mutation { shorten(input: {url: "https://example.com/a"}) { code } }`)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != errCaptcha.Error() {
+		t.Errorf("expected the captcha to be asked for, got %+v", resp.Errors)
+	}
+	resp = gql(t, router, "", `mutation { shorten(input: {url: "https://example.com/a", captchaToken: "solved"}) { code } }`)
+	if len(resp.Errors) != 0 {
+		t.Errorf("expected a solved captcha to pass, got %+v", resp.Errors)
+	}
+	resp = gql(t, router, "k1", `mutation { shorten(input: {url: "https://example.com/b"}) { code } }`)
+	if len(resp.Errors) != 0 {
+		t.Errorf("expected API key callers to need no captcha, got %+v", resp.Errors)
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobRunner reports on the background jobs and runs them on demand.
+type JobRunner interface {
+	JobStats() []model.JobStatus
+	Trigger(name string) error
+}
+
+// WithJobs backs the /admin/jobs endpoints.
+func WithJobs(j JobRunner) Option {
+	return func(h *Handler) { h.jobs = j }
+}
+
+// GET /admin/jobs
+func (h *Handler) AdminListJobs(c *gin.Context) {
+	jobs := []model.JobStatus{}
+	if h.jobs != nil {
+		jobs = h.jobs.JobStats()
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// POST /admin/jobs/:name/run
+// Starts a run of the job on this instance now, whoever holds its lease;
+// a run already going is not interrupted, and the next one follows it.
+func (h *Handler) AdminRunJob(c *gin.Context) {
+	if h.jobs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	err := h.jobs.Trigger(c.Param("name"))
+	switch {
+	case errors.Is(err, worker.ErrUnknownJob):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusAccepted)
+	}
+}
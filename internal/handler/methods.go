@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MethodNotAllowed answers 405 for a path that takes only the methods
+// allow. Without any, it keeps the Allow header gin set from the routes.
+func MethodNotAllowed(allow ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(allow) > 0 {
+			c.Header("Allow", strings.Join(allow, ", "))
+		}
+		c.AbortWithStatusJSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+	}
+}
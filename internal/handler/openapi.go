@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"urlshortener/urlshortener/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /openapi.json
+func (h *Handler) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openapi.Spec)
+}
+
+// GET /docs
+// Swagger UI for /openapi.json, served when OPENAPI_UI is set.
+func (h *Handler) Docs(c *gin.Context) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := templates.ExecuteTemplate(c.Writer, "docs.html", nil); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithOrgs enables the /orgs endpoints.
+func WithOrgs(o service.Orgs) Option {
+	return func(h *Handler) { h.orgs = o }
+}
+
+// POST /orgs
+// Creates an organization with the caller as its admin.
+func (h *Handler) CreateOrg(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+	if !requireJSON(c) {
+		return
+	}
+
+	var req model.OrgReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing field: slug"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !validNotes(req.Name, "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be at most " + strconv.Itoa(maxTitleLen) + " characters"})
+		return
+	}
+
+	org, err := h.orgs.Create(c.Request.Context(), owner, req)
+	switch {
+	case errors.Is(err, service.ErrInvalidOrg):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOrgExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusCreated, org)
+	}
+}
+
+// GET /orgs
+// Lists the organizations the caller belongs to.
+func (h *Handler) ListOrgs(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	orgs, err := h.orgs.List(c.Request.Context(), owner)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if orgs == nil {
+		orgs = []model.Org{}
+	}
+	c.IndentedJSON(http.StatusOK, model.OrgList{Orgs: orgs})
+}
+
+// GET /orgs/:org
+func (h *Handler) GetOrg(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	org, err := h.orgs.Get(c.Request.Context(), owner, c.Param("org"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, org)
+}
+
+// PUT /orgs/:org/members/:owner
+// Adds a member or changes their role. The body, {"role": "admin"}, is
+// optional; members are added as plain members by default.
+func (h *Handler) PutOrgMember(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	var req model.MemberReq
+	if c.Request.ContentLength != 0 {
+		if !requireJSON(c) {
+			return
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+			return
+		}
+	}
+
+	m, err := h.orgs.PutMember(c.Request.Context(), owner, c.Param("org"), c.Param("owner"), req.Role)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, m)
+}
+
+// DELETE /orgs/:org/members/:owner
+// Admins may remove anyone; other members may only leave.
+func (h *Handler) RemoveOrgMember(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	err := h.orgs.RemoveMember(c.Request.Context(), owner, c.Param("org"), c.Param("owner"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /orgs/:org/links?query=&limit=&offset=
+// Lists the organization's links, newest first, like GET /links does the
+// caller's own.
+func (h *Handler) OrgLinks(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	query := strings.TrimSpace(c.Query("query"))
+	if len(query) > maxQueryLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query must be at most " + strconv.Itoa(maxQueryLen) + " characters"})
+		return
+	}
+
+	recs, err := h.orgs.Links(c.Request.Context(), owner, c.Param("org"), query, limit, offset)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	if recs == nil {
+		recs = []model.URLRecord{}
+	}
+	c.IndentedJSON(http.StatusOK, model.LinkPage{Links: recs, Query: query, Limit: limit, Offset: offset})
+}
+
+// GET /orgs/:org/stats
+func (h *Handler) OrgStats(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	stats, err := h.orgs.Stats(c.Request.Context(), owner, c.Param("org"))
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, stats)
+}
+
+// orgError answers a failed organization request. Organizations the caller
+// does not belong to are not found, so their slugs do not leak.
+func orgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	case errors.Is(err, service.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotOrgAdmin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		internalError(c, err)
+	}
+}
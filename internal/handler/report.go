@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+	"urlshortener/urlshortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CaptchaVerifier checks the token a captcha widget gave the client.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// WithReports enables POST /report and the /admin/reports review queue.
+func WithReports(r service.Reports) Option {
+	return func(h *Handler) { h.reports = r }
+}
+
+// WithCaptcha makes anonymous endpoints ask for a solved captcha.
+func WithCaptcha(v CaptchaVerifier) Option {
+	return func(h *Handler) { h.captcha = v }
+}
+
+var (
+	errCaptcha            = errors.New("Captcha verification failed")
+	errCaptchaUnavailable = errors.New("Captcha verification unavailable")
+)
+
+// verifyCaptcha checks token from the client at ip when a captcha is
+// configured.
+func (h *Handler) verifyCaptcha(ctx context.Context, token, ip string) error {
+	if h.captcha == nil {
+		return nil
+	}
+	ok, err := h.captcha.Verify(ctx, token, ip)
+	if err != nil {
+		log.Printf("captcha: %v", err)
+		return errCaptchaUnavailable
+	}
+	if !ok {
+		return errCaptcha
+	}
+	return nil
+}
+
+// checkCaptcha verifies token when a captcha is configured, answering the
+// request itself when it fails.
+func (h *Handler) checkCaptcha(c *gin.Context, token string) bool {
+	switch err := h.verifyCaptcha(c.Request.Context(), token, c.ClientIP()); err {
+	case nil:
+		return true
+	case errCaptchaUnavailable:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	}
+	return false
+}
+
+// anonymousCaptcha reports whether a caller without an API key must solve
+// a captcha to shorten.
+func (h *Handler) anonymousCaptcha(ctx context.Context, owner string) bool {
+	return owner == "" && h.cfg(ctx).CaptchaShorten
+}
+
+// reportedCode takes the code out of a short link, or returns s itself
+// when it is a bare code.
+func reportedCode(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSuffix(s, "/")
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// POST /report
+// Flags a short link for review by the operators. Anyone may report;
+// reports are rate limited per client and may need a captcha.
+func (h *Handler) Report(c *gin.Context) {
+	if !requireJSON(c) {
+		return
+	}
+	var req model.ReportReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+	if !h.checkCaptcha(c, req.CaptchaToken) {
+		return
+	}
+	code := reportedCode(req.URL)
+	if !util.ValidCode(code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be a short link or its code"})
+		return
+	}
+
+	rep, err := h.reports.Submit(c.Request.Context(), model.AbuseReport{
+		Code: code, Reason: req.Reason, Details: req.Details, Contact: req.Contact,
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidReason):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be one of " + strings.Join(model.ReportReasons, ", ")})
+	case errors.Is(err, service.ErrLongReport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusCreated, rep)
+	}
+}
+
+// GET /admin/reports?status=&limit=&offset=
+// Lists abuse reports, oldest first, in the given status or all of them.
+func (h *Handler) AdminListReports(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	status := c.Query("status")
+	if status != "" && !slices.Contains([]string{model.ReportPending, model.ReportApproved, model.ReportRejected}, status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved or rejected"})
+		return
+	}
+
+	reps, err := h.reports.List(c.Request.Context(), status, limit, offset)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if reps == nil {
+		reps = []model.AbuseReport{}
+	}
+	c.IndentedJSON(http.StatusOK, model.ReportPage{Reports: reps, Status: status, Limit: limit, Offset: offset})
+}
+
+// POST /admin/reports/:id/approve
+// Takes the reported link down, for the report's reason unless the body
+// gives another.
+func (h *Handler) AdminApproveReport(c *gin.Context) {
+	id, ok := reportID(c)
+	if !ok {
+		return
+	}
+	var req model.ApproveReq
+	if c.Request.ContentLength != 0 {
+		if !requireJSON(c) {
+			return
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+			return
+		}
+	}
+
+	rep, err := h.reports.Approve(c.Request.Context(), middleware.Owner(c), id, req.Reason, req.Note)
+	h.reviewed(c, rep, err)
+}
+
+// POST /admin/reports/:id/reject
+// Closes the report and leaves the link alone.
+func (h *Handler) AdminRejectReport(c *gin.Context) {
+	id, ok := reportID(c)
+	if !ok {
+		return
+	}
+	rep, err := h.reports.Reject(c.Request.Context(), middleware.Owner(c), id)
+	h.reviewed(c, rep, err)
+}
+
+func (h *Handler) reviewed(c *gin.Context, rep model.AbuseReport, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReason):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be one of " + strings.Join(model.TakedownReasons, ", ")})
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+	case errors.Is(err, service.ErrReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusOK, rep)
+	}
+}
+
+func reportID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return 0, false
+	}
+	return id, true
+}
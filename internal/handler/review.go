@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /admin/reviews?limit=&offset=
+// Lists the links held for their destination's reputation, oldest first.
+func (h *Handler) AdminListReviews(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	reviews, err := h.admin.ListReviews(c.Request.Context(), limit, offset)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if reviews == nil {
+		reviews = []model.Review{}
+	}
+	c.IndentedJSON(http.StatusOK, model.ReviewPage{Reviews: reviews, Limit: limit, Offset: offset})
+}
+
+// POST /admin/reviews/:code/approve
+func (h *Handler) AdminApproveReview(c *gin.Context) {
+	rec, err := h.admin.ApproveReview(c.Request.Context(), middleware.Owner(c), c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link is not held for review"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusOK, rec)
+	}
+}
+
+// POST /admin/reviews/:code/reject
+// Deletes the held link.
+func (h *Handler) AdminRejectReview(c *gin.Context) {
+	err := h.admin.RejectReview(c.Request.Context(), middleware.Owner(c), c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link is not held for review"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
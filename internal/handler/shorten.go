@@ -1,70 +1,779 @@
 package handler
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"log"
 	"mime"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/feature"
+	"urlshortener/urlshortener/internal/middleware"
 	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/pagetitle"
 	"urlshortener/urlshortener/internal/service"
+	"urlshortener/urlshortener/internal/urlcheck"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/graph-gophers/graphql-go"
 )
 
 type Handler struct {
-	cfg config.Config
-	srv service.Shortener
+	live       *config.Live
+	srv        service.Shortener
+	check      *urlcheck.Checker
+	clicks     ClickRecorder
+	ipSalt     string
+	clickQuota ClickQuota
+	stats      ClickCounter
+	daily      DailyClickReader
+	breakdowns ClickBreakdowns
+	geo        GeoLocator
+	admin      service.Admin
+	orgs       service.Orgs
+	flags      *feature.Flags
+	jobs       JobRunner
+	reports    service.Reports
+	captcha    CaptchaVerifier
+	pageMeta   service.PageMetaStore
+	errorPage  *template.Template
+	schema     *graphql.Schema
 }
 
-func New(cfg config.Config, srv service.Shortener) *Handler { return &Handler{cfg: cfg, srv: srv} }
+// Option configures optional handler collaborators.
+type Option func(*Handler)
+
+// WithClicks records a click event for every redirect. salt keys the hash
+// that stands in for the client's address.
+func WithClicks(rec ClickRecorder, salt string) Option {
+	return func(h *Handler) {
+		h.clicks = rec
+		h.ipSalt = salt
+	}
+}
+
+// WithLiveConfig makes the handler follow l, so reloaded settings apply to
+// the next request. Otherwise it keeps the configuration given to New.
+func WithLiveConfig(l *config.Live) Option {
+	return func(h *Handler) { h.live = l }
+}
+
+func New(cfg config.Config, srv service.Shortener, opts ...Option) *Handler {
+	h := &Handler{live: config.NewLive(cfg), srv: srv, check: urlcheck.New(cfg)}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.flags == nil {
+		h.flags = feature.New(nil, cfg.FeatureFlags)
+	}
+	h.schema = newSchema(h)
+	return h
+}
+
+// cfg returns the configuration of the request ctx belongs to: its
+// tenant's, or the current snapshot.
+func (h *Handler) cfg(ctx context.Context) *config.Config {
+	return h.live.For(ctx)
+}
 
 // POST /shorten
+// Takes JSON, a form or the bare URL as text/plain, and answers with the link
+// as JSON or, when Accept asks for text/plain, just the short URL.
 func (h *Handler) Shorten(c *gin.Context) {
-	ct := c.GetHeader("Content-Type")
+	var req model.CreateReq
+	if !bindCreate(c, &req) {
+		return
+	}
+	if h.anonymousCaptcha(c.Request.Context(), middleware.Owner(c)) && !h.checkCaptcha(c, req.CaptchaToken) {
+		return
+	}
 
-	mt, _, err := mime.ParseMediaType(ct)
+	long, ok := h.destination(c, req.URL)
+	if !ok {
+		return
+	}
 
-	if err != nil || mt != "application/json" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/json"})
+	if !validParams(req.UTM) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errBadParams.Error()})
 		return
 	}
 
-	var req model.CreateReq
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errPastExpiry.Error()})
+		return
+	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing field: url"})
+	if !validNotes(req.Title, req.Description) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errLongNotes.Error()})
 		return
 	}
 
-	parsedUrl, err := url.ParseRequestURI(req.URL)
-	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed or unsupported URL"})
+	if req.Unique && !h.cfg(c.Request.Context()).UniqueLinks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errNoUnique.Error()})
+		return
+	}
+
+	if req.MaxClicks < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMaxClicks.Error()})
+		return
+	}
+	if req.OneTime {
+		if req.MaxClicks > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errOneTime.Error()})
+			return
+		}
+		req.MaxClicks = 1
+	}
+	if req.FallbackURL != "" {
+		fallback, err := h.fallbackURL(c.Request.Context(), req.FallbackURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.FallbackURL = fallback
+	}
+
+	domain, err := h.linkDomain(c.Request.Context(), c.Request.Host, req.Domain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	rec, created, err := h.srv.Shorten(c.Request.Context(), h.cfg.BaseURL, parsedUrl.String())
+	opts := service.LinkOptions{
+		UTM:           req.UTM,
+		Owner:         middleware.Owner(c),
+		Domain:        domain,
+		ExpiresAt:     req.ExpiresAt,
+		Title:         strings.TrimSpace(req.Title),
+		Description:   strings.TrimSpace(req.Description),
+		Org:           req.Org,
+		StripTracking: req.StripTracking,
+		Unique:        req.Unique,
+		MaxClicks:     req.MaxClicks,
+		FallbackURL:   req.FallbackURL,
+	}
+	rec, created, err := h.srv.Shorten(c.Request.Context(), h.cfg(c.Request.Context()).BaseURLFor(domain), long, opts)
+	if errors.Is(err, service.ErrFlagged) || errors.Is(err, service.ErrBanned) || errors.Is(err, service.ErrDeadDestination) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrNotMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrConflict) || errors.Is(err, service.ErrDisabled) || errors.Is(err, service.ErrExpired) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	var qe *service.QuotaError
+	if errors.As(err, &qe) {
+		quotaExceeded(c, qe)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		internalError(c, err)
 		return
 	}
 
+	linkHeaders(c, rec)
+	status := http.StatusOK
 	if created {
-		c.IndentedJSON(http.StatusCreated, rec)
-	} else {
+		status = http.StatusCreated
+	}
+	if plainReply(c) {
+		c.String(status, rec.ShortUrl+"\n")
+		return
+	}
+	c.IndentedJSON(status, rec)
+}
+
+// GET /links/:code
+// Returns the caller's link with ETag and Last-Modified, answering conditional
+// requests for an unchanged link with 304.
+func (h *Handler) Get(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	rec, err := h.srv.Get(c.Request.Context(), owner, c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		linkHeaders(c, rec)
+		c.Header("Cache-Control", "private, no-cache")
+		if notModified(c, rec) {
+			c.Status(http.StatusNotModified)
+			return
+		}
 		c.IndentedJSON(http.StatusOK, rec)
 	}
 }
 
+// GET /resolve/:code
+// Returns the record a short link redirects with, under the same rules as
+// the redirect itself but without following it. domain picks the short
+// domain; by default the request's Host decides.
+func (h *Handler) ResolveLink(c *gin.Context) {
+	domain, err := h.linkDomain(c.Request.Context(), c.Request.Host, c.Query("domain"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rec, err := h.srv.Lookup(c.Request.Context(), domain, c.Param("code"))
+	h.publicLink(c, rec, err)
+}
+
+// GET /lookup?url=
+// Returns the link that shortening url would hand out, so clients can check
+// before creating one. The URL is normalised as on creation; domain works
+// as for /resolve.
+func (h *Handler) ReverseLookup(c *gin.Context) {
+	raw := c.Query("url")
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing parameter: url"})
+		return
+	}
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && !h.allowedApp(c.Request.Context(), u)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMalformedURL.Error()})
+		return
+	}
+	domain, err := h.linkDomain(c.Request.Context(), c.Request.Host, c.Query("domain"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rec, err := h.srv.Find(c.Request.Context(), domain, u.String())
+	h.publicLink(c, rec, err)
+}
+
+// publicLink answers with a link found by /resolve or /lookup, hiding who
+// owns it from everyone but its owner.
+func (h *Handler) publicLink(c *gin.Context, rec model.URLRecord, err error) {
+	switch {
+	case gone(err):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		if owner := middleware.Owner(c); owner == "" || owner != rec.Owner {
+			rec.Owner, rec.Org = "", ""
+		}
+		c.IndentedJSON(http.StatusOK, rec)
+	}
+}
+
+// PATCH /links/:code
+// Changes the destination, title or description; at least one is required.
+// The current revision is matched against If-Match, or against updated_at in
+// the body when the header is absent.
+func (h *Handler) Update(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	if !requireJSON(c) {
+		return
+	}
+
+	var req model.UpdateReq
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" && req.Title == nil && req.Description == nil && req.FallbackURL == nil {
+		badBody(c, err, "Missing field: url, title, description or fallback_url")
+		return
+	}
+
+	edit := service.LinkEdit{Title: trimmed(req.Title), Description: trimmed(req.Description), FallbackURL: req.FallbackURL}
+	if req.URL != "" {
+		long, ok := h.destination(c, req.URL)
+		if !ok {
+			return
+		}
+		edit.LongURL = long
+	}
+	if req.FallbackURL != nil && *req.FallbackURL != "" {
+		fallback, err := h.fallbackURL(c.Request.Context(), *req.FallbackURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		edit.FallbackURL = &fallback
+	}
+	if !validNotes(deref(edit.Title), deref(edit.Description)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errLongNotes.Error()})
+		return
+	}
+
+	etag := c.GetHeader("If-Match")
+	if etag == "" && req.UpdatedAt != nil {
+		etag = service.ETag(model.URLRecord{UpdatedAt: *req.UpdatedAt})
+	}
+
+	rec, err := h.srv.Update(c.Request.Context(), owner, c.Param("code"), edit, etag)
+	switch {
+	case errors.Is(err, service.ErrFlagged), errors.Is(err, service.ErrBanned), errors.Is(err, service.ErrDeadDestination):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPreconditionFailed):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		linkHeaders(c, rec)
+		c.IndentedJSON(http.StatusOK, rec)
+	}
+}
+
+// POST /links/:code/disable
+func (h *Handler) Disable(c *gin.Context) { h.setActive(c, false) }
+
+// POST /links/:code/enable
+func (h *Handler) Enable(c *gin.Context) { h.setActive(c, true) }
+
+func (h *Handler) setActive(c *gin.Context, active bool) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	rec, err := h.srv.SetActive(c.Request.Context(), owner, c.Param("code"), active)
+	var td *service.TakedownError
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case errors.As(err, &td), errors.Is(err, service.ErrUnderReview):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err != nil:
+		internalError(c, err)
+	default:
+		linkHeaders(c, rec)
+		c.IndentedJSON(http.StatusOK, rec)
+	}
+}
+
+// DELETE /links/:code
+func (h *Handler) Delete(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	err := h.srv.Delete(c.Request.Context(), owner, c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// maxQueryLen bounds the search term of a link listing.
+const maxQueryLen = 200
+
+// GET /links?query=&limit=&offset=
+// Lists the caller's links, newest first. query narrows the list to links
+// whose destination contains it, ignoring case.
+func (h *Handler) List(c *gin.Context) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return
+	}
+
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	query := strings.TrimSpace(c.Query("query"))
+	if len(query) > maxQueryLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query must be at most " + strconv.Itoa(maxQueryLen) + " characters"})
+		return
+	}
+
+	recs, err := h.srv.List(c.Request.Context(), owner, query, limit, offset)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	if recs == nil {
+		recs = []model.URLRecord{}
+	}
+	c.IndentedJSON(http.StatusOK, model.LinkPage{Links: recs, Query: query, Limit: limit, Offset: offset})
+}
+
+func requireJSON(c *gin.Context) bool {
+	mt, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mt != "application/json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/json"})
+		return false
+	}
+	return true
+}
+
+// bindCreate reads a new link from the request: a JSON CreateReq, the same
+// fields form-encoded with utm[utm_source]=... for UTM, or the URL alone as
+// text/plain, so curl -d and HTML forms work. On failure the response has
+// already been written.
+func bindCreate(c *gin.Context, req *model.CreateReq) bool {
+	mt, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	var err error
+	switch mt {
+	case binding.MIMEJSON:
+		err = c.ShouldBindJSON(req)
+	case binding.MIMEPOSTForm:
+		if err = c.ShouldBindWith(req, binding.FormPost); err == nil {
+			if utm := c.PostFormMap("utm"); len(utm) > 0 {
+				req.UTM = utm
+			}
+		}
+	case binding.MIMEPlain:
+		var body []byte
+		if body, err = io.ReadAll(c.Request.Body); err == nil {
+			req.URL = strings.TrimSpace(string(body))
+			err = binding.Validator.ValidateStruct(req)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/json, application/x-www-form-urlencoded or text/plain"})
+		return false
+	}
+	if err != nil {
+		badBody(c, err, "Missing field: url")
+		return false
+	}
+	return true
+}
+
+// plainReply reports whether the caller prefers the short URL as text to the
+// link as JSON. Without an Accept header saying otherwise, requests answer in
+// the kind they were sent in, forms getting JSON.
+func plainReply(c *gin.Context) bool {
+	offers := []string{binding.MIMEJSON, binding.MIMEPlain}
+	if c.ContentType() == binding.MIMEPlain {
+		slices.Reverse(offers)
+	}
+	return c.NegotiateFormat(offers...) == binding.MIMEPlain
+}
+
+// badBody answers a body that did not bind: 413 when it was cut off at the
+// size limit, otherwise 400 with msg.
+func badBody(c *gin.Context, err error, msg string) {
+	if middleware.TooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+}
+
+var (
+	errMalformedURL  = errors.New("Malformed or unsupported URL")
+	errLongURL       = errors.New("URL is too long")
+	errUnknownDomain = errors.New("Unknown domain")
+	errPastExpiry    = errors.New("expires_at must be in the future")
+	errBadParams     = errors.New("Invalid utm parameters")
+	errLongNotes     = errors.New("title must be at most 200 and description at most 2000 characters")
+	errNoUnique      = errors.New("Unique links are not enabled")
+	errMaxClicks     = errors.New("max_clicks must not be negative")
+	errOneTime       = errors.New("one_time links allow exactly one click; drop max_clicks")
+	errFallbackURL   = errors.New("fallback_url must be a web page")
+)
+
+// destination validates a submitted long URL, identically for create and
+// update, and returns its normalised form. On failure the response, 422 for
+// a URL over the length limit and 400 otherwise, has already been written.
+func (h *Handler) destination(c *gin.Context, raw string) (string, bool) {
+	long, err := h.validURL(c.Request.Context(), raw)
+	if errors.Is(err, errLongURL) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return long, true
+}
+
+// validURL is destination without the response, for callers outside REST.
+func (h *Handler) validURL(ctx context.Context, raw string) (string, error) {
+	if n := h.cfg(ctx).MaxURLLength; n > 0 && len(raw) > n {
+		return "", errLongURL
+	}
+
+	parsedUrl, err := url.ParseRequestURI(raw)
+	if err == nil && h.allowedApp(ctx, parsedUrl) {
+		// Nothing on the web to check: the app decides what it opens.
+		return parsedUrl.String(), nil
+	}
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") {
+		return "", errMalformedURL
+	}
+
+	if err := h.check.Check(ctx, parsedUrl); err != nil {
+		return "", err
+	}
+
+	parsedUrl, err = h.check.ShortLinks(ctx, parsedUrl, h.resolveOwn)
+	if err != nil {
+		return "", err
+	}
+
+	return parsedUrl.String(), nil
+}
+
+// resolveOwn returns the destination of one of our own short links, for
+// unwrapping links to them.
+func (h *Handler) resolveOwn(ctx context.Context, u *url.URL) (string, error) {
+	cfg := h.cfg(ctx)
+	domain := cfg.DomainFor(u.Host)
+	base, err := url.Parse(cfg.BaseURLFor(domain))
+	if err != nil {
+		return "", err
+	}
+	code, ok := strings.CutPrefix(u.Path, base.Path)
+	if !ok || code == "" {
+		return "", service.ErrNotFound
+	}
+	return h.srv.Resolve(ctx, domain, code)
+}
+
+// linkDomain picks the short domain for a new link: the requested one when
+// given, otherwise the one the request was sent to.
+func (h *Handler) linkDomain(ctx context.Context, host, requested string) (string, error) {
+	cfg := h.cfg(ctx)
+	if requested == "" {
+		return cfg.DomainFor(host), nil
+	}
+	domain := cfg.DomainFor(requested)
+	if domain == "" && !strings.EqualFold(requested, cfg.DefaultDomain()) {
+		return "", errUnknownDomain
+	}
+	return domain, nil
+}
+
+const (
+	maxParams        = 20
+	maxParamKeyLen   = 64
+	maxParamValueLen = 512
+)
+
+const (
+	maxTitleLen       = pagetitle.MaxLen
+	maxDescriptionLen = 2000
+)
+
+// validNotes bounds a link's title and description, in characters.
+func validNotes(title, description string) bool {
+	return utf8.RuneCountInString(title) <= maxTitleLen && utf8.RuneCountInString(description) <= maxDescriptionLen
+}
+
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	return &t
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// validParams bounds the campaign parameters a link may carry. Keys are
+// limited to characters that never need escaping in a query string.
+func validParams(params map[string]string) bool {
+	if len(params) > maxParams {
+		return false
+	}
+	for k, v := range params {
+		if k == "" || len(k) > maxParamKeyLen || len(v) > maxParamValueLen {
+			return false
+		}
+		for _, r := range k {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Get /:code -> redirect
+// Get /:code+ or /:code?preview=1 -> interstitial page showing the destination
+// Get /:code from a link-preview bot -> the destination's Open Graph tags
 func (h *Handler) Redirect(c *gin.Context) {
 	code := c.Param("code")
+	if h.cfg(c.Request.Context()).RobotsNoindex {
+		// Redirects, previews and error pages alike.
+		c.Header("X-Robots-Tag", "noindex")
+	}
 
-	longUrl, err := h.srv.Resolve(c, code)
+	if strings.HasSuffix(code, "+") || c.Query("preview") == "1" {
+		h.preview(c, strings.TrimSuffix(code, "+"))
+		return
+	}
+	if h.unfurl(c, code) {
+		return
+	}
+
+	visit := h.srv.Visit
+	if c.Request.Method != http.MethodGet {
+		// Link checkers must not use up a link's clicks.
+		visit = h.peek
+	}
+	ctx := c.Request.Context()
+	rec, longUrl, err := visit(ctx, h.cfg(ctx).DomainFor(c.Request.Host), code)
+	var td *service.TakedownError
+	if errors.As(err, &td) {
+		takedownPage(c, td.Takedown)
+		return
+	}
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
+		h.unavailable(c, code, err)
 		return
 	}
 
+	h.recordClick(c, code)
+	if appLink(longUrl) {
+		h.appLinkPage(c, longUrl)
+		return
+	}
+	if rec.MaxClicks > 0 {
+		// A cached redirect would outlive the link's clicks.
+		c.Header("Cache-Control", "no-store")
+	} else {
+		h.cacheRedirect(c, http.StatusFound)
+	}
 	c.Redirect(http.StatusFound, longUrl)
 }
+
+// peek is Visit without counting the redirect.
+func (h *Handler) peek(ctx context.Context, domain, code string) (model.URLRecord, string, error) {
+	rec, err := h.srv.Lookup(ctx, domain, code)
+	if err != nil {
+		return model.URLRecord{}, "", err
+	}
+	return rec, service.Destination(rec), nil
+}
+
+// quotaExceeded answers 429 for a daily quota, which frees up by itself, and
+// 403 for the total link quota, which does not.
+func quotaExceeded(c *gin.Context, qe *service.QuotaError) {
+	c.Header("X-Quota-Limit", strconv.Itoa(qe.Limit))
+	c.Header("X-Quota-Remaining", "0")
+	if qe.Reset.IsZero() {
+		c.JSON(http.StatusForbidden, gin.H{"error": qe.Error()})
+		return
+	}
+	c.Header("X-Quota-Reset", strconv.FormatInt(qe.Reset.Unix(), 10))
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(qe.Reset).Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": qe.Error()})
+}
+
+// gone reports whether a lookup failed because the link exists but no longer
+// redirects, which is answered with 410 rather than 404.
+func gone(err error) bool {
+	return errors.Is(err, service.ErrFlagged) || errors.Is(err, service.ErrDisabled) || errors.Is(err, service.ErrExpired) ||
+		errors.Is(err, service.ErrClickLimit)
+}
+
+// WithPageMeta shows what destination pages say about themselves on the
+// preview page.
+func WithPageMeta(m service.PageMetaStore) Option {
+	return func(h *Handler) { h.pageMeta = m }
+}
+
+type previewData struct {
+	Title       string
+	Description string
+	Image       string
+	Favicon     string
+	Host        string
+	LongURL     string
+	ShortURL    string
+	// Href is LongURL for the continue button. Only approved schemes are
+	// stored, so app links may keep theirs.
+	Href template.URL
+}
+
+func (h *Handler) preview(c *gin.Context, code string) {
+	ctx := c.Request.Context()
+	rec, err := h.srv.Lookup(ctx, h.cfg(ctx).DomainFor(c.Request.Host), code)
+	var td *service.TakedownError
+	if errors.As(err, &td) {
+		takedownPage(c, td.Takedown)
+		return
+	}
+	if err != nil {
+		h.unavailable(c, code, err)
+		return
+	}
+
+	data := previewData{LongURL: service.Destination(rec), ShortURL: rec.ShortUrl}
+	data.Href = template.URL(data.LongURL)
+	if u, err := url.Parse(rec.LongUrl); err == nil {
+		data.Host = u.Hostname()
+	}
+	data.Title = data.Host
+	if meta, ok := h.previewMeta(ctx, rec.Code); ok {
+		data.Title = cmp.Or(meta.Title, data.Host)
+		data.Description, data.Image, data.Favicon = meta.Description, meta.Image, meta.Favicon
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := templates.ExecuteTemplate(c.Writer, "preview.html", data); err != nil {
+		c.Error(err)
+	}
+}
+
+// previewMeta returns the metadata fetched for code's destination, if any.
+// The preview works without it, so failures are only logged.
+func (h *Handler) previewMeta(ctx context.Context, code string) (model.PageMeta, bool) {
+	if h.pageMeta == nil {
+		return model.PageMeta{}, false
+	}
+	metas, err := h.pageMeta.GetPageMetas(ctx, []string{code})
+	if err != nil {
+		log.Printf("page metadata %s: %v", code, err)
+		return model.PageMeta{}, false
+	}
+	meta, ok := metas[code]
+	return meta, ok
+}
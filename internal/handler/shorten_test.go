@@ -3,15 +3,23 @@ package handler
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/middleware"
 	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,22 +29,93 @@ type mockShortener struct {
 	shortenFunc  func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error)
 	resolveFunc  func(ctx context.Context, code string) (string, error)
 	redirectFunc func(ctx context.Context, code string) (string, error)
+	lookupFunc   func(ctx context.Context, code string) (model.URLRecord, error)
+	findFunc     func(ctx context.Context, long string) (model.URLRecord, error)
+	updateFunc   func(ctx context.Context, owner, code string, edit service.LinkEdit, etag string) (model.URLRecord, error)
+	activeFunc   func(ctx context.Context, owner, code string, active bool) (model.URLRecord, error)
+	getFunc      func(ctx context.Context, owner, code string) (model.URLRecord, error)
+	deleteFunc   func(ctx context.Context, owner, code string) error
+	listFunc     func(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error)
+	lastOpts     service.LinkOptions
 }
 
-func (m *mockShortener) Shorten(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+func (m *mockShortener) SetActive(ctx context.Context, owner, code string, active bool) (model.URLRecord, error) {
+	if m.activeFunc != nil {
+		return m.activeFunc(ctx, owner, code, active)
+	}
+	return model.URLRecord{}, errors.New("not implemented")
+}
+
+func (m *mockShortener) Delete(ctx context.Context, owner, code string) error {
+	if m.deleteFunc != nil {
+		return m.deleteFunc(ctx, owner, code)
+	}
+	return errors.New("not implemented")
+}
+
+func (m *mockShortener) List(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	if m.listFunc != nil {
+		return m.listFunc(ctx, owner, query, limit, offset)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockShortener) Export(ctx context.Context, owner, cursor string, limit int) ([]model.URLRecord, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockShortener) Find(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	if m.findFunc != nil {
+		return m.findFunc(ctx, long)
+	}
+	return model.URLRecord{}, errors.New("not implemented")
+}
+
+func (m *mockShortener) Get(ctx context.Context, owner, code string) (model.URLRecord, error) {
+	if m.getFunc != nil {
+		return m.getFunc(ctx, owner, code)
+	}
+	return model.URLRecord{}, errors.New("not implemented")
+}
+
+func (m *mockShortener) Update(ctx context.Context, owner, code string, edit service.LinkEdit, etag string) (model.URLRecord, error) {
+	if m.updateFunc != nil {
+		return m.updateFunc(ctx, owner, code, edit, etag)
+	}
+	return model.URLRecord{}, errors.New("not implemented")
+}
+
+func (m *mockShortener) Shorten(ctx context.Context, baseURL, long string, opts service.LinkOptions) (model.URLRecord, bool, error) {
+	m.lastOpts = opts
 	if m.shortenFunc != nil {
 		return m.shortenFunc(ctx, baseURL, long)
 	}
 	return model.URLRecord{}, false, errors.New("not implemented")
 }
 
-func (m *mockShortener) Resolve(ctx context.Context, code string) (string, error) {
+func (m *mockShortener) Resolve(ctx context.Context, domain, code string) (string, error) {
 	if m.resolveFunc != nil {
 		return m.resolveFunc(ctx, code)
 	}
 	return "", errors.New("not implemented")
 }
 
+func (m *mockShortener) Visit(ctx context.Context, domain, code string) (model.URLRecord, string, error) {
+	dest, err := m.Resolve(ctx, domain, code)
+	return model.URLRecord{Code: code}, dest, err
+}
+
+func (m *mockShortener) Lookup(ctx context.Context, domain, code string) (model.URLRecord, error) {
+	if m.lookupFunc != nil {
+		return m.lookupFunc(ctx, code)
+	}
+	if m.resolveFunc != nil {
+		long, err := m.resolveFunc(ctx, code)
+		return model.URLRecord{Code: code, LongUrl: long}, err
+	}
+	return model.URLRecord{}, errors.New("not implemented")
+}
+
 func TestHandler_Shorten_Success_NewURL(t *testing.T) {
 	// Setup
 	gin.SetMode(gin.TestMode)
@@ -347,6 +426,7 @@ func TestHandler_Shorten_ServiceError(t *testing.T) {
 
 	handler := New(cfg, mockSrv)
 	router := gin.New()
+	router.Use(middleware.RequestID())
 	router.POST("/shorten", handler.Shorten)
 
 	// Test data
@@ -373,10 +453,17 @@ func TestHandler_Shorten_ServiceError(t *testing.T) {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	expectedError := "database connection failed"
+	// The cause is logged, never shown to the client.
+	expectedError := "Internal server error"
 	if response["error"] != expectedError {
 		t.Errorf("Expected error message %s, got %s", expectedError, response["error"])
 	}
+	if strings.Contains(w.Body.String(), "database") {
+		t.Errorf("Expected no internal details in the response, got %s", w.Body)
+	}
+	if id := w.Header().Get("X-Request-ID"); id == "" || response["request_id"] != id {
+		t.Errorf("Expected the request ID %q in the response, got %q", id, response["request_id"])
+	}
 }
 
 func TestHandler_Shorten_URLNormalization(t *testing.T) {
@@ -459,6 +546,79 @@ func TestHandler_Shorten_ContentType(t *testing.T) {
 	}
 }
 
+func TestHandler_Shorten_FormAndPlainText(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{Code: "ABC123", LongUrl: long, ShortUrl: baseURL + "ABC123"}, true, nil
+		},
+	}
+	router := gin.New()
+	router.POST("/shorten", New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv).Shorten)
+
+	tests := []struct {
+		name, contentType, accept, body string
+		status                          int
+		wantType, wantBody              string
+	}{
+		{"form as text", "application/x-www-form-urlencoded", "text/plain", "url=https://example.com/form",
+			http.StatusCreated, "text/plain; charset=utf-8", "https://shawt.ly/ABC123\n"},
+		{"text", "text/plain; charset=utf-8", "", "https://example.com/text\n",
+			http.StatusCreated, "text/plain; charset=utf-8", "https://shawt.ly/ABC123\n"},
+		{"text as JSON", "text/plain", "application/json", "https://example.com/text",
+			http.StatusCreated, "application/json; charset=utf-8", `"long_url": "https://example.com/text"`},
+		{"form", "application/x-www-form-urlencoded", "", "url=https%3A%2F%2Fexample.com%2Fform&utm%5Butm_source%5D=mail&title=Form",
+			http.StatusCreated, "application/json; charset=utf-8", `"long_url": "https://example.com/form"`},
+		{"form without url", "application/x-www-form-urlencoded", "", "title=x",
+			http.StatusBadRequest, "application/json; charset=utf-8", "Missing field: url"},
+		{"empty text", "text/plain", "", "  \n",
+			http.StatusBadRequest, "application/json; charset=utf-8", "Missing field: url"},
+		{"xml", "application/xml", "", "<url/>",
+			http.StatusBadRequest, "application/json; charset=utf-8", "Content-Type must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status || w.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("expected %d %s, got %d %s: %s", tt.status, tt.wantType, w.Code, w.Header().Get("Content-Type"), w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %s", tt.wantBody, w.Body)
+			}
+		})
+	}
+	// The form was the last to get through.
+	if mockSrv.lastOpts.UTM["utm_source"] != "mail" || mockSrv.lastOpts.Title != "Form" {
+		t.Errorf("expected the form's utm and title, got %+v", mockSrv.lastOpts)
+	}
+
+	// Form utm keys name the parameters in full, as JSON ones do.
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, service.NewShortener(repo.NewMemory()))
+	router = gin.New()
+	router.POST("/shorten", h.Shorten)
+	router.GET("/:code", h.Redirect)
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader("url=https%3A%2F%2Fexample.com%2Fform&utm%5Butm_source%5D=mail"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	short := strings.TrimSpace(w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(short, "https://shawt.ly"), nil))
+	if loc := w.Header().Get("Location"); loc != "https://example.com/form?utm_source=mail" {
+		t.Errorf("expected the redirect to carry utm_source, got %d %q", w.Code, loc)
+	}
+}
+
 func BenchmarkHandler_Shorten(b *testing.B) {
 	// Setup
 	gin.SetMode(gin.TestMode)
@@ -531,6 +691,204 @@ func TestHandler_Redirect_Success(t *testing.T) {
 	}
 }
 
+func TestHandler_AppLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{BaseURL: "https://shawt.ly/", AppSchemes: []string{"myapp"}, PlayStoreURL: "https://play.google.com/store/apps/details?id=app"}
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{Code: "AbC123", LongUrl: long, ShortUrl: baseURL + "AbC123"}, true, nil
+		},
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "myapp://item/42?ref=a&b=c", nil
+		},
+	}
+	h := New(cfg, mockSrv)
+
+	r := gin.New()
+	r.POST("/shorten", h.Shorten)
+	r.GET("/:code", h.Redirect)
+
+	for long, want := range map[string]int{
+		"myapp://item/42":        http.StatusCreated,
+		"otherapp://item/42":     http.StatusBadRequest,
+		"javascript:alert(1)":    http.StatusBadRequest,
+		"https://example.com/42": http.StatusCreated,
+	} {
+		body, _ := json.Marshal(model.CreateReq{URL: long})
+		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("expected %d for %s, got %d: %s", want, long, w.Code, w.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/AbC123", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Fatalf("expected the app link page instead of a redirect, got %d", w.Code)
+	}
+	if !strings.Contains(body, `href="myapp://item/42?ref=a&amp;b=c"`) || strings.Contains(body, "ZgotmplZ") ||
+		!strings.Contains(body, `href="https://play.google.com/store/apps/details?id=app"`) || strings.Contains(body, "App Store") {
+		t.Errorf("expected the app link and the configured store only, got %s", body)
+	}
+}
+
+func TestHandler_Redirect_Unavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			switch code {
+			case "Sale01":
+				return "", &service.FallbackError{URL: "https://example.com/sold-out", Err: service.ErrClickLimit}
+			case "Old001":
+				return "", service.ErrExpired
+			}
+			return "", service.ErrNotFound
+		},
+	}
+	page := template.Must(template.New("error").Parse(`{{.Status}} {{.ShortURL}}: {{.Reason}}`))
+
+	get := func(h *Handler, path string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.GET("/:code", h.Redirect)
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "shawt.ly"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithErrorPage(page))
+	w := get(h, "/Sale01")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/sold-out" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected an uncached redirect to the link's fallback, got %d %v", w.Code, w.Header())
+	}
+	if w := get(h, "/Old001"); w.Code != http.StatusGone || w.Body.String() != "410 shawt.ly/Old001: Link has expired" {
+		t.Errorf("expected the error page with 410, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(h, "/Nope01+"); w.Code != http.StatusNotFound || w.Body.String() != "404 shawt.ly/Nope01: Link not found" {
+		t.Errorf("expected the error page with 404 for previews too, got %d: %s", w.Code, w.Body)
+	}
+
+	h = New(config.Config{BaseURL: "https://shawt.ly/", FallbackURL: "https://shawt.ly/"}, mockSrv, WithErrorPage(page))
+	if w := get(h, "/Nope01"); w.Code != http.StatusFound || w.Header().Get("Location") != "https://shawt.ly/" {
+		t.Errorf("expected the deployment's fallback, got %d %v", w.Code, w.Header())
+	}
+	if w := get(h, "/Sale01"); w.Header().Get("Location") != "https://example.com/sold-out" {
+		t.Errorf("expected the link's fallback to win, got %v", w.Header())
+	}
+}
+
+func TestHandler_Redirect_CacheHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{BaseURL: "https://shawt.ly/", RedirectCacheControl: map[int]string{http.StatusFound: "public, max-age=300"}}
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "https://example.com/landing", nil
+		},
+	}
+	h := New(cfg, mockSrv)
+
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/AbC123", nil))
+
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("expected configured Cache-Control, got %q", cc)
+	}
+	expires, err := http.ParseTime(w.Header().Get("Expires"))
+	if err != nil {
+		t.Fatalf("expected an Expires header, got %q", w.Header().Get("Expires"))
+	}
+	if d := time.Until(expires); d < 290*time.Second || d > 300*time.Second {
+		t.Errorf("expected Expires about 300s ahead, got %v", d)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"private, max-age=90":           90 * time.Second,
+		"public, s-maxage=60":           0,
+		"no-store":                      0,
+		"max-age=3600, no-cache":        0,
+		"public, MAX-AGE=10, immutable": 10 * time.Second,
+	}
+	for policy, want := range testCases {
+		if got := maxAge(policy); got != want {
+			t.Errorf("maxAge(%q) = %v, want %v", policy, got, want)
+		}
+	}
+}
+
+func TestHandler_Get(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.UTC)
+	mockSrv := &mockShortener{
+		getFunc: func(ctx context.Context, owner, code string) (model.URLRecord, error) {
+			if code != "AbC123" || owner != "alice" {
+				return model.URLRecord{}, sql.ErrNoRows
+			}
+			return model.URLRecord{Code: code, Owner: owner, UpdatedAt: updatedAt}, nil
+		},
+	}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	r := gin.New()
+	r.GET("/links/:code", middleware.APIKey(map[string]string{"k1": "alice"}), h.Get)
+
+	get := func(code, key string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/links/"+code, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("AbC123", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := get("NOPE42", "k1"); w.Code != http.StatusNotFound {
+		t.Errorf("missing: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := get("AbC123", "k1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if etag != service.ETag(model.URLRecord{UpdatedAt: updatedAt}) || lastModified != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Errorf("expected validators, got ETag %q Last-Modified %q", etag, lastModified)
+	}
+
+	if w := get("AbC123", "k1", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: expected %d without body, got %d", http.StatusNotModified, w.Code)
+	}
+	if w := get("AbC123", "k1", "If-None-Match", `"stale"`); w.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := get("AbC123", "k1", "If-Modified-Since", lastModified); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: expected %d, got %d", http.StatusNotModified, w.Code)
+	}
+	if w := get("AbC123", "k1", "If-Modified-Since", "Wed, 01 May 2024 11:59:59 GMT"); w.Code != http.StatusOK {
+		t.Errorf("older If-Modified-Since: expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
 func TestHandler_Redirect_NotFound(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -609,3 +967,1140 @@ func TestHandler_Redirect_HEAD_MirrorsGET(t *testing.T) {
 		t.Fatalf("bad Location %q", w.Header().Get("Location"))
 	}
 }
+
+func TestHandler_Shorten_InternalTargetRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{BaseURL: "https://shawt.ly/", BlockInternalTargets: true}
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			t.Fatal("service should not be called for internal targets")
+			return model.URLRecord{}, false, nil
+		},
+	}
+
+	handler := New(cfg, mockSrv)
+	router := gin.New()
+	router.POST("/shorten", handler.Shorten)
+
+	for _, target := range []string{"http://127.0.0.1/admin", "http://localhost:3000/", "http://[::1]/"} {
+		jsonBody, _ := json.Marshal(model.CreateReq{URL: target})
+		req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestHandler_Shorten_Limits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{BaseURL: "https://shawt.ly/", MaxURLLength: 100}
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			t.Fatal("service should not be called for rejected requests")
+			return model.URLRecord{}, false, nil
+		},
+	}
+
+	handler := New(cfg, mockSrv)
+	router := gin.New()
+	router.POST("/shorten", middleware.BodyLimit(1024), handler.Shorten)
+
+	long, _ := json.Marshal(model.CreateReq{URL: "https://example.com/" + strings.Repeat("a", 100)})
+	huge, _ := json.Marshal(model.CreateReq{URL: "https://example.com/", Description: strings.Repeat("a", 2000)})
+	for name, tc := range map[string]struct {
+		body []byte
+		want int
+	}{
+		"long URL":  {long, http.StatusUnprocessableEntity},
+		"huge body": {huge, http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		// Hide the length so the body is cut off while being read.
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.want {
+			t.Errorf("%s: expected status %d, got %d", name, tc.want, w.Code)
+		}
+	}
+}
+
+func TestHandler_Shorten_FlaggedURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{}, false, service.ErrFlagged
+		},
+	}
+
+	handler := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	router := gin.New()
+	router.POST("/shorten", handler.Shorten)
+
+	jsonBody, _ := json.Marshal(model.CreateReq{URL: "https://malware.example/"})
+	req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_Redirect_Flagged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "", service.ErrFlagged
+		},
+	}
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	req := httptest.NewRequest(http.MethodGet, "/BAD001", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Fatalf("expected %d, got %d", http.StatusGone, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "" {
+		t.Fatalf("did not expect Location header, got %q", loc)
+	}
+}
+
+func TestHandler_Redirect_Preview(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			t.Fatal("preview must not resolve for redirect")
+			return "", nil
+		},
+		lookupFunc: func(ctx context.Context, code string) (model.URLRecord, error) {
+			if code != "AbC123" {
+				return model.URLRecord{}, errors.New("not found")
+			}
+			return model.URLRecord{
+				Code:     "AbC123",
+				LongUrl:  "https://example.com/landing?a=1&b=<2>",
+				ShortUrl: "https://shawt.ly/AbC123",
+			}, nil
+		},
+	}
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	for _, target := range []string{"/AbC123+", "/AbC123?preview=1"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", target, http.StatusOK, w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != "" {
+			t.Fatalf("%s: did not expect Location header, got %q", target, loc)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Fatalf("%s: expected HTML, got %q", target, ct)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "example.com") || !strings.Contains(body, "b=&lt;2&gt;") {
+			t.Fatalf("%s: expected escaped destination in body, got %s", target, body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/NOPE42+", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected %d for unknown code, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+type stubPageMeta map[string]model.PageMeta
+
+func (m stubPageMeta) GetPageMetas(ctx context.Context, codes []string) (map[string]model.PageMeta, error) {
+	return m, nil
+}
+
+func TestHandler_Redirect_PreviewMeta(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		lookupFunc: func(ctx context.Context, code string) (model.URLRecord, error) {
+			return model.URLRecord{Code: code, LongUrl: "https://example.com/docs", ShortUrl: "https://shawt.ly/" + code}, nil
+		},
+	}
+	meta := stubPageMeta{"AbC123": {Title: "The <docs>", Description: "All of them", Favicon: "https://example.com/icon.png"}}
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithPageMeta(meta))
+
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	req := httptest.NewRequest(http.MethodGet, "/AbC123+", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "The &lt;docs&gt;") || !strings.Contains(body, "All of them") ||
+		!strings.Contains(body, `src="https://example.com/icon.png"`) {
+		t.Fatalf("expected the page's metadata on the preview, got %d: %s", w.Code, body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/XyZ789+", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "example.com") || strings.Contains(body, "icon.png") {
+		t.Errorf("expected the host without metadata, got %s", body)
+	}
+}
+
+func TestHandler_Redirect_Unfurl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var visits int
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			visits++
+			return "https://example.com/post?a=1&b=2", nil
+		},
+		lookupFunc: func(ctx context.Context, code string) (model.URLRecord, error) {
+			rec := model.URLRecord{Code: code, LongUrl: "https://example.com/post?a=1&b=2", ShortUrl: "https://shawt.ly/" + code}
+			if code == "Once01" {
+				rec.MaxClicks = 1
+			}
+			return rec, nil
+		},
+	}
+	meta := stubPageMeta{
+		"AbC123": {Title: "A post", Description: "About \"things\"", Image: "https://example.com/card.png"},
+		"Once01": {Title: "Secret"},
+	}
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithPageMeta(meta))
+
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	get := func(path, ua string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/AbC123", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `<meta property="og:title" content="A post" />`) ||
+		!strings.Contains(body, `content="About &#34;things&#34;"`) || !strings.Contains(body, `<meta property="og:image" content="https://example.com/card.png" />`) ||
+		!strings.Contains(body, `<meta property="og:url" content="https://example.com/post?a=1&amp;b=2" />`) {
+		t.Fatalf("expected the Open Graph page, got %d: %s", w.Code, body)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+		t.Errorf("expected the page kept out of shared caches, got %q", cc)
+	}
+	if visits != 0 {
+		t.Errorf("expected the bot not to count as a visit, got %d", visits)
+	}
+
+	for _, tc := range []struct{ path, ua string }{
+		{"/AbC123", "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"},
+		{"/Once01", "Twitterbot/1.0"},
+		{"/NoMeta", "Twitterbot/1.0"},
+	} {
+		if w := get(tc.path, tc.ua); w.Code != http.StatusFound {
+			t.Errorf("%s for %q: expected a redirect, got %d", tc.path, tc.ua, w.Code)
+		}
+	}
+}
+
+func TestHandler_ResolveLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		lookupFunc: func(ctx context.Context, code string) (model.URLRecord, error) {
+			switch code {
+			case "AbC123":
+				return model.URLRecord{Code: code, LongUrl: "https://example.com/", Owner: "alice", Active: true}, nil
+			case "Off123":
+				return model.URLRecord{}, service.ErrDisabled
+			}
+			return model.URLRecord{}, service.ErrNotFound
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/resolve/:code", New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv).ResolveLink)
+
+	get := func(target string) (*httptest.ResponseRecorder, model.URLRecord) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var rec model.URLRecord
+		json.Unmarshal(w.Body.Bytes(), &rec)
+		return w, rec
+	}
+
+	w, rec := get("/api/v1/resolve/AbC123")
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Fatalf("expected %d without a redirect, got %d %v", http.StatusOK, w.Code, w.Header())
+	}
+	if rec.LongUrl != "https://example.com/" || rec.Owner != "" {
+		t.Errorf("expected the record without its owner, got %+v", rec)
+	}
+	if w, _ := get("/api/v1/resolve/Off123"); w.Code != http.StatusGone {
+		t.Errorf("expected %d for a disabled link, got %d", http.StatusGone, w.Code)
+	}
+	if w, _ := get("/api/v1/resolve/NOPE42"); w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for an unknown code, got %d", http.StatusNotFound, w.Code)
+	}
+	if w, _ := get("/api/v1/resolve/AbC123?domain=other.example"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for an unknown domain, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_ReverseLookup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		findFunc: func(ctx context.Context, long string) (model.URLRecord, error) {
+			if long == "https://example.com/a" {
+				return model.URLRecord{Code: "AbC123", LongUrl: long, Owner: "alice"}, nil
+			}
+			return model.URLRecord{}, service.ErrNotFound
+		},
+	}
+	r := gin.New()
+	r.GET("/api/v1/lookup", New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv).ReverseLookup)
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/api/v1/lookup?url=https%3A%2F%2Fexample.com%2Fa", http.StatusOK},
+		{"/api/v1/lookup?url=https%3A%2F%2Fexample.com%2Fb", http.StatusNotFound},
+		{"/api/v1/lookup?url=ftp%3A%2F%2Fexample.com%2F", http.StatusBadRequest},
+		{"/api/v1/lookup", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.target, tt.want, w.Code)
+		}
+		if tt.want == http.StatusOK && !strings.Contains(w.Body.String(), `"AbC123"`) {
+			t.Errorf("%s: expected the link, got %s", tt.target, w.Body)
+		}
+	}
+}
+
+func TestHandler_Shorten_UTMParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{BaseURL: "https://shawt.ly/"}
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{Code: "AbC123", LongUrl: long}, true, nil
+		},
+	}
+
+	handler := New(cfg, mockSrv)
+	router := gin.New()
+	router.POST("/shorten", handler.Shorten)
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(`{"url":"https://example.com/","utm":{"utm_source":"newsletter","utm_medium":"email"}}`); code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d", http.StatusCreated, code)
+	}
+	if got := mockSrv.lastOpts.UTM["utm_source"]; got != "newsletter" {
+		t.Errorf("expected utm_source to reach the service, got %q", got)
+	}
+
+	for _, body := range []string{
+		`{"url":"https://example.com/","utm":{"":"x"}}`,
+		`{"url":"https://example.com/","utm":{"utm source":"x"}}`,
+		`{"url":"https://example.com/","utm":{"a&b":"x"}}`,
+	} {
+		if code := post(body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", body, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestHandler_Shorten_Unique(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{Code: "AbC123", LongUrl: long, Unique: true}, true, nil
+		},
+	}
+	post := func(cfg config.Config) int {
+		router := gin.New()
+		router.POST("/shorten", New(cfg, mockSrv).Shorten)
+		req := httptest.NewRequest("POST", "/shorten", strings.NewReader(`{"url":"https://example.com/","unique":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(config.Config{BaseURL: "https://shawt.ly/"}); code != http.StatusBadRequest {
+		t.Errorf("expected %d while unique links are off, got %d", http.StatusBadRequest, code)
+	}
+	if code := post(config.Config{BaseURL: "https://shawt.ly/", UniqueLinks: true}); code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d", http.StatusCreated, code)
+	}
+	if !mockSrv.lastOpts.Unique {
+		t.Error("expected unique to reach the service")
+	}
+}
+
+func TestHandler_OneTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	srv := service.NewShortener(repo.NewMemory())
+	r := gin.New()
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, srv)
+	r.POST("/shorten", h.Shorten)
+	r.GET("/:code", h.Redirect)
+	r.HEAD("/:code", h.Redirect)
+
+	post := func(body string) (int, model.URLRecord) {
+		req := httptest.NewRequest("POST", "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var rec model.URLRecord
+		json.Unmarshal(w.Body.Bytes(), &rec)
+		return w.Code, rec
+	}
+
+	if code, _ := post(`{"url":"https://example.com/","one_time":true,"max_clicks":5}`); code != http.StatusBadRequest {
+		t.Errorf("expected %d for one_time with max_clicks, got %d", http.StatusBadRequest, code)
+	}
+	code, rec := post(`{"url":"https://example.com/reset","one_time":true}`)
+	if code != http.StatusCreated || rec.MaxClicks != 1 {
+		t.Fatalf("expected a one-time link, got %d %+v", code, rec)
+	}
+
+	visit := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/"+rec.Code, nil))
+		return w
+	}
+	if w := visit(http.MethodHead); w.Code != http.StatusFound {
+		t.Fatalf("expected HEAD to leave the click alone, got %d", w.Code)
+	}
+	w := visit(http.MethodGet)
+	if w.Code != http.StatusFound || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected an uncached redirect, got %d %v", w.Code, w.Header())
+	}
+	if w := visit(http.MethodGet); w.Code != http.StatusGone {
+		t.Errorf("expected %d after the only click, got %d", http.StatusGone, w.Code)
+	}
+}
+
+func TestHandler_Shorten_Conflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Config{BaseURL: "https://shawt.ly/"}
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{}, false, service.ErrConflict
+		},
+	}
+
+	handler := New(cfg, mockSrv)
+	router := gin.New()
+	router.POST("/shorten", handler.Shorten)
+
+	req := httptest.NewRequest("POST", "/shorten", strings.NewReader(`{"url":"https://example.com/","utm":{"utm_source":"x"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestHandler_Update(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+	var gotOwner, gotEtag string
+	var gotEdit service.LinkEdit
+	mockSrv := &mockShortener{
+		updateFunc: func(ctx context.Context, owner, code string, edit service.LinkEdit, etag string) (model.URLRecord, error) {
+			gotOwner, gotEtag, gotEdit = owner, etag, edit
+			switch etag {
+			case `"stale"`:
+				return model.URLRecord{}, service.ErrPreconditionFailed
+			}
+			if code != "AbC123" {
+				return model.URLRecord{}, sql.ErrNoRows
+			}
+			return model.URLRecord{Code: code, LongUrl: edit.LongURL, Owner: owner, UpdatedAt: updatedAt}, nil
+		},
+	}
+
+	handler := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	router := gin.New()
+	router.PATCH("/links/:code", middleware.APIKey(map[string]string{"k1": "alice"}), handler.Update)
+
+	patch := func(code, key, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/links/"+code, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := patch("AbC123", "", "", `{"url":"https://example.com/new"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := patch("AbC123", "k1", "", `{"url":"ftp://example.com/"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bad url: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := patch("AbC123", "k1", `"stale"`, `{"url":"https://example.com/new"}`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale: expected %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if w := patch("NOPE42", "k1", "", `{"url":"https://example.com/new"}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := patch("AbC123", "k1", "", `{"url":"https://example.com/new","updated_at":"2024-05-01T12:00:00.123456Z"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if gotOwner != "alice" {
+		t.Errorf("expected owner alice, got %q", gotOwner)
+	}
+	want := service.ETag(model.URLRecord{UpdatedAt: updatedAt})
+	if gotEtag != want {
+		t.Errorf("expected updated_at to become ETag %s, got %s", want, gotEtag)
+	}
+	if etag := w.Header().Get("ETag"); etag != want {
+		t.Errorf("expected ETag header %s, got %s", want, etag)
+	}
+
+	if w := patch("AbC123", "k1", "", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty edit: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := patch("AbC123", "k1", "", `{"title":"`+strings.Repeat("x", maxTitleLen+1)+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long title: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	w = patch("AbC123", "k1", "", `{"title":"  Docs  ","description":""}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("notes only: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if gotEdit.LongURL != "" || gotEdit.Title == nil || *gotEdit.Title != "Docs" || gotEdit.Description == nil || *gotEdit.Description != "" {
+		t.Errorf("expected trimmed title and cleared description without a new URL, got %+v", gotEdit)
+	}
+}
+
+func TestHandler_Redirect_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "", service.ErrDisabled
+		},
+	}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	req := httptest.NewRequest(http.MethodGet, "/AbC123", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("expected %d, got %d", http.StatusGone, w.Code)
+	}
+}
+
+func TestHandler_Expiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		shortenFunc: func(ctx context.Context, baseURL, long string) (model.URLRecord, bool, error) {
+			return model.URLRecord{Code: "AbC123", LongUrl: long}, true, nil
+		},
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "", service.ErrExpired
+		},
+	}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	r := gin.New()
+	r.POST("/shorten", h.Shorten)
+	r.GET("/:code", h.Redirect)
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(`{"url":"https://example.com/","expires_at":"2001-01-01T00:00:00Z"}`); code != http.StatusBadRequest {
+		t.Errorf("past expiry: expected %d, got %d", http.StatusBadRequest, code)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if code := post(`{"url":"https://example.com/","expires_at":"` + future.Format(time.RFC3339) + `"}`); code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d", http.StatusCreated, code)
+	}
+	if got := mockSrv.lastOpts.ExpiresAt; got == nil || !got.Equal(future) {
+		t.Errorf("expected expires_at %v to reach the service, got %v", future, got)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/AbC123", nil))
+	if w.Code != http.StatusGone {
+		t.Errorf("expired: expected %d, got %d", http.StatusGone, w.Code)
+	}
+}
+
+func TestHandler_DeleteAndList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotLimit, gotOffset int
+	var gotQuery string
+	mockSrv := &mockShortener{
+		deleteFunc: func(ctx context.Context, owner, code string) error {
+			if code != "AbC123" {
+				return sql.ErrNoRows
+			}
+			return nil
+		},
+		listFunc: func(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+			gotQuery, gotLimit, gotOffset = query, limit, offset
+			return []model.URLRecord{{Code: "AbC123", Owner: owner}}, nil
+		},
+	}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	r := gin.New()
+	auth := middleware.APIKey(map[string]string{"k1": "alice"})
+	r.GET("/links", auth, h.List)
+	r.DELETE("/links/:code", auth, h.Delete)
+
+	do := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodDelete, "/links/AbC123", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous delete: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := do(http.MethodDelete, "/links/NOPE42", "k1"); w.Code != http.StatusNotFound {
+		t.Errorf("missing: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodDelete, "/links/AbC123", "k1"); w.Code != http.StatusNoContent {
+		t.Errorf("delete: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if w := do(http.MethodGet, "/links?limit=0", "k1"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad limit: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	w := do(http.MethodGet, "/links?limit=10&offset=20", "k1")
+	if w.Code != http.StatusOK || gotLimit != 10 || gotOffset != 20 {
+		t.Errorf("list: expected %d with limit 10 offset 20, got %d with %d/%d", http.StatusOK, w.Code, gotLimit, gotOffset)
+	}
+	if !strings.Contains(w.Body.String(), `"code": "AbC123"`) {
+		t.Errorf("expected link in body, got %s", w.Body)
+	}
+
+	w = do(http.MethodGet, "/links?query=+docs%2Fapi+", "k1")
+	if w.Code != http.StatusOK || gotQuery != "docs/api" || !strings.Contains(w.Body.String(), `"query": "docs/api"`) {
+		t.Errorf("search: expected trimmed query docs/api, got %d with %q: %s", w.Code, gotQuery, w.Body)
+	}
+	if w := do(http.MethodGet, "/links?query="+strings.Repeat("a", maxQueryLen+1), "k1"); w.Code != http.StatusBadRequest {
+		t.Errorf("long query: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_DisableEnable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	active := map[string]bool{}
+	mockSrv := &mockShortener{
+		activeFunc: func(ctx context.Context, owner, code string, a bool) (model.URLRecord, error) {
+			if code != "AbC123" {
+				return model.URLRecord{}, sql.ErrNoRows
+			}
+			active[code] = a
+			return model.URLRecord{Code: code, Owner: owner, Active: a}, nil
+		},
+	}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	r := gin.New()
+	auth := middleware.APIKey(map[string]string{"k1": "alice"})
+	r.POST("/links/:code/disable", auth, h.Disable)
+	r.POST("/links/:code/enable", auth, h.Enable)
+
+	post := func(path, key string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post("/links/AbC123/disable", ""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := post("/links/NOPE42/disable", "k1"); code != http.StatusNotFound {
+		t.Errorf("missing: expected %d, got %d", http.StatusNotFound, code)
+	}
+	if code := post("/links/AbC123/disable", "k1"); code != http.StatusOK || active["AbC123"] {
+		t.Errorf("disable: expected %d and inactive, got %d", http.StatusOK, code)
+	}
+	if code := post("/links/AbC123/enable", "k1"); code != http.StatusOK || !active["AbC123"] {
+		t.Errorf("enable: expected %d and active, got %d", http.StatusOK, code)
+	}
+}
+
+type recordedClicks struct{ events []model.ClickEvent }
+
+func (r *recordedClicks) Record(ev model.ClickEvent) { r.events = append(r.events, ev) }
+
+func TestHandler_Redirect_RecordsClick(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			if code != "AbC123" {
+				return "", sql.ErrNoRows
+			}
+			return "https://example.com/", nil
+		},
+	}
+	clicks := &recordedClicks{}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithClicks(clicks, "salt"))
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+	r.HEAD("/:code", h.Redirect)
+
+	req := httptest.NewRequest(http.MethodGet, "/AbC123", nil)
+	req.RemoteAddr = "203.0.113.77:5555"
+	req.Header.Set("Referer", "https://news.example/post")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("CF-IPCountry", "fi")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/NOPE42", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, "/AbC123", nil))
+
+	if len(clicks.events) != 1 {
+		t.Fatalf("expected exactly one click for the successful GET, got %d", len(clicks.events))
+	}
+	ev := clicks.events[0]
+	if ev.Code != "AbC123" || ev.Referrer != "https://news.example/post" || ev.UserAgent != "test-agent" || ev.Country != "FI" {
+		t.Errorf("unexpected click event %+v", ev)
+	}
+	if ev.IPHash == "" || strings.Contains(ev.IPHash, "203.0.113") {
+		t.Errorf("expected an opaque IP hash, got %q", ev.IPHash)
+	}
+	if ev.IPHash != hashIP("203.0.113.1", "salt") {
+		t.Error("expected addresses in the same /24 to hash alike")
+	}
+}
+
+func TestHashIP(t *testing.T) {
+	if hashIP("198.51.100.1", "a") == hashIP("198.51.101.1", "a") {
+		t.Error("expected different /24 networks to hash differently")
+	}
+	if hashIP("198.51.100.1", "a") == hashIP("198.51.100.1", "b") {
+		t.Error("expected the salt to change the hash")
+	}
+	if hashIP("2001:db8:1:2::1", "a") != hashIP("2001:db8:1:ffff::9", "a") {
+		t.Error("expected addresses in the same /48 to hash alike")
+	}
+	if hashIP("::ffff:198.51.100.1", "a") != hashIP("198.51.100.9", "a") {
+		t.Error("expected IPv4-mapped addresses to be treated as IPv4")
+	}
+	if hashIP("not-an-ip", "a") != "" {
+		t.Error("expected empty hash for invalid input")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("héllo", 2); got != "h" {
+		t.Errorf("expected cut before the multi-byte rune, got %q", got)
+	}
+	if got := truncate("hello", 10); got != "hello" {
+		t.Errorf("expected short strings untouched, got %q", got)
+	}
+}
+
+func TestHandler_DailyStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		getFunc: func(ctx context.Context, owner, code string) (model.URLRecord, error) {
+			if owner != "alice" || code != "AbC123" {
+				return model.URLRecord{}, service.ErrNotFound
+			}
+			return model.URLRecord{Code: code, Owner: owner}, nil
+		},
+	}
+	clicks := repo.NewMemory()
+	ctx := context.Background()
+	day := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d.Add(12 * time.Hour)
+	}
+	clicks.InsertClicks(ctx, []model.ClickEvent{
+		{Code: "AbC123", ClickedAt: day("2024-05-01")},
+		{Code: "AbC123", ClickedAt: day("2024-05-01")},
+		{Code: "AbC123", ClickedAt: day("2024-05-03")},
+		{Code: "OTHER1", ClickedAt: day("2024-05-02")},
+	})
+	clicks.RollupClicks(ctx)
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithDailyStats(clicks))
+	r := gin.New()
+	auth := middleware.APIKey(map[string]string{"k1": "alice", "k2": "bob"})
+	r.GET("/links/:code/stats/daily", auth, h.DailyStats)
+
+	do := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/links/AbC123/stats/daily?from=2024-05-01&to=2024-05-03", "k1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var stats model.DailyStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	want := []model.DailyClicks{{Day: "2024-05-01", Clicks: 2}, {Day: "2024-05-02", Clicks: 0}, {Day: "2024-05-03", Clicks: 1}}
+	if !reflect.DeepEqual(stats.Days, want) {
+		t.Errorf("expected %v, got %v", want, stats.Days)
+	}
+
+	if w := do("/links/AbC123/stats/daily?to=2024-05-03", "k1"); w.Code != http.StatusOK || strings.Count(w.Body.String(), `"day"`) != dailyStatsDays {
+		t.Errorf("expected %d days by default, got %d: %s", dailyStatsDays, w.Code, w.Body)
+	}
+	for _, q := range []string{"from=May+1", "from=2024-05-04&to=2024-05-03", "from=2022-01-01&to=2024-05-03"} {
+		if w := do("/links/AbC123/stats/daily?"+q, "k1"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", q, http.StatusBadRequest, w.Code)
+		}
+	}
+	if w := do("/links/AbC123/stats/daily", "k2"); w.Code != http.StatusNotFound {
+		t.Errorf("someone else's link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	h = New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv)
+	r = gin.New()
+	r.GET("/links/:code/stats/daily", auth, h.DailyStats)
+	if w := do("/links/AbC123/stats/daily", "k1"); w.Code != http.StatusNotFound {
+		t.Errorf("without rollups: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+type fakeGeo map[string][2]string
+
+func (g fakeGeo) Locate(addr netip.Addr) (string, string) {
+	loc := g[addr.String()]
+	return loc[0], loc[1]
+}
+
+func TestHandler_Redirect_GeoIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "https://example.com/", nil
+		},
+	}
+	clicks := &recordedClicks{}
+	geo := fakeGeo{"203.0.113.77": {"FI", "18"}}
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithClicks(clicks, "salt"), WithGeoIP(geo))
+	r := gin.New()
+	r.GET("/:code", h.Redirect)
+
+	for _, addr := range []string{"203.0.113.77:5555", "198.51.100.1:5555"} {
+		req := httptest.NewRequest(http.MethodGet, "/AbC123", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("CF-IPCountry", "SE")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(clicks.events) != 2 {
+		t.Fatalf("expected two clicks, got %d", len(clicks.events))
+	}
+	if ev := clicks.events[0]; ev.Country != "FI" || ev.Region != "18" {
+		t.Errorf("expected the database's location, got %q/%q", ev.Country, ev.Region)
+	}
+	if ev := clicks.events[1]; ev.Country != "SE" || ev.Region != "" {
+		t.Errorf("expected the header for an unknown address, got %q/%q", ev.Country, ev.Region)
+	}
+}
+
+func TestHandler_CountryStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		getFunc: func(ctx context.Context, owner, code string) (model.URLRecord, error) {
+			if owner != "alice" {
+				return model.URLRecord{}, service.ErrNotFound
+			}
+			return model.URLRecord{Code: code, Owner: owner}, nil
+		},
+	}
+	clicks := repo.NewMemory()
+	may1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clicks.InsertClicks(context.Background(), []model.ClickEvent{
+		{Code: "AbC123", ClickedAt: may1, Country: "SE"},
+		{Code: "AbC123", ClickedAt: may1, Country: "FI"},
+		{Code: "AbC123", ClickedAt: may1.Add(11 * time.Hour), Country: "FI"},
+		{Code: "AbC123", ClickedAt: may1},
+		{Code: "AbC123", ClickedAt: may1.AddDate(0, 0, 1), Country: "FI"},
+	})
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithBreakdowns(clicks))
+	r := gin.New()
+	auth := middleware.APIKey(map[string]string{"k1": "alice", "k2": "bob"})
+	r.GET("/links/:code/stats/countries", auth, h.CountryStats)
+
+	req := httptest.NewRequest(http.MethodGet, "/links/AbC123/stats/countries?from=2024-05-01&to=2024-05-01", nil)
+	req.Header.Set("X-API-Key", "k1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var stats model.ClickBreakdown
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	want := []model.ClickCount{{Value: "FI", Clicks: 2}, {Value: "", Clicks: 1}, {Value: "SE", Clicks: 1}}
+	if !reflect.DeepEqual(stats.Items, want) {
+		t.Errorf("expected %v, got %v", want, stats.Items)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/links/AbC123/stats/countries", nil)
+	req.Header.Set("X-API-Key", "k2")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("someone else's link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandler_ReferrerAndBrowserStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		getFunc: func(ctx context.Context, owner, code string) (model.URLRecord, error) {
+			return model.URLRecord{Code: code, Owner: owner}, nil
+		},
+	}
+	const (
+		chrome  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+		firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"
+		edge    = chrome + " Edg/124.0.2478.80"
+	)
+	clicks := repo.NewMemory()
+	now := time.Now().UTC()
+	clicks.InsertClicks(context.Background(), []model.ClickEvent{
+		{Code: "AbC123", ClickedAt: now, Referrer: "https://www.news.example/a", UserAgent: chrome},
+		{Code: "AbC123", ClickedAt: now, Referrer: "https://news.example/b", UserAgent: edge},
+		{Code: "AbC123", ClickedAt: now, Referrer: "https://blog.example/", UserAgent: firefox},
+		{Code: "AbC123", ClickedAt: now, UserAgent: chrome},
+	})
+
+	h := New(config.Config{BaseURL: "https://shawt.ly/"}, mockSrv, WithBreakdowns(clicks))
+	r := gin.New()
+	auth := middleware.APIKey(map[string]string{"k1": "alice"})
+	r.GET("/links/:code/stats/referrers", auth, h.ReferrerStats)
+	r.GET("/links/:code/stats/browsers", auth, h.BrowserStats)
+
+	get := func(path string, v any) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatalf("failed to decode body: %v", err)
+			}
+		}
+		return w.Code
+	}
+
+	var refs model.ClickBreakdown
+	if code := get("/links/AbC123/stats/referrers?limit=2", &refs); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, code)
+	}
+	want := []model.ClickCount{{Value: "news.example", Clicks: 2}, {Value: "", Clicks: 1}}
+	if !reflect.DeepEqual(refs.Items, want) {
+		t.Errorf("expected referrers %v, got %v", want, refs.Items)
+	}
+
+	var browsers model.BrowserStats
+	if code := get("/links/AbC123/stats/browsers", &browsers); code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, code)
+	}
+	wantBrowsers := []model.ClickCount{{Value: "Chrome", Clicks: 2}, {Value: "Edge", Clicks: 1}, {Value: "Firefox", Clicks: 1}}
+	wantOS := []model.ClickCount{{Value: "Windows", Clicks: 3}, {Value: "Linux", Clicks: 1}}
+	if !reflect.DeepEqual(browsers.Browsers, wantBrowsers) || !reflect.DeepEqual(browsers.OS, wantOS) {
+		t.Errorf("expected %v and %v, got %v and %v", wantBrowsers, wantOS, browsers.Browsers, browsers.OS)
+	}
+
+	if code := get("/links/AbC123/stats/browsers?limit=0", nil); code != http.StatusBadRequest {
+		t.Errorf("bad limit: expected %d, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestHandler_Redirect_ClickPrivacy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockSrv := &mockShortener{
+		resolveFunc: func(ctx context.Context, code string) (string, error) {
+			return "https://example.com/", nil
+		},
+	}
+	click := func(cfg config.Config, header string) []model.ClickEvent {
+		clicks := &recordedClicks{}
+		h := New(cfg, mockSrv, WithClicks(clicks, "salt"))
+		r := gin.New()
+		r.GET("/:code", h.Redirect)
+
+		req := httptest.NewRequest(http.MethodGet, "/AbC123", nil)
+		req.RemoteAddr = "203.0.113.77:5555"
+		if header != "" {
+			req.Header.Set(header, "1")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("expected the redirect to work regardless, got %d", w.Code)
+		}
+		return clicks.events
+	}
+
+	honor := config.Config{BaseURL: "https://shawt.ly/", HonorDNT: true}
+	for _, header := range []string{"DNT", "Sec-GPC"} {
+		if events := click(honor, header); len(events) != 0 {
+			t.Errorf("%s: expected no click recorded, got %d", header, len(events))
+		}
+	}
+	if events := click(config.Config{BaseURL: "https://shawt.ly/"}, "DNT"); len(events) != 1 {
+		t.Errorf("expected DNT to be ignored unless configured, got %d clicks", len(events))
+	}
+
+	for mode, want := range map[string]string{
+		config.ClickIPHash:     hashIP("203.0.113.77", "salt"),
+		config.ClickIPTruncate: "203.0.113.0/24",
+		config.ClickIPNone:     "",
+	} {
+		events := click(config.Config{BaseURL: "https://shawt.ly/", ClickIP: mode}, "")
+		if len(events) != 1 || events[0].IPHash != want {
+			t.Errorf("%s: expected network %q, got %+v", mode, want, events)
+		}
+	}
+}
+
+type fakeCaptcha struct{ err error }
+
+func (f fakeCaptcha) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	return token == "solved", f.err
+}
+
+func TestHandler_Shorten_Captcha(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := repo.NewMemory()
+	newRouter := func(v CaptchaVerifier) *gin.Engine {
+		h := New(config.Config{BaseURL: "https://shawt.ly/", CaptchaShorten: true}, service.NewShortener(r), WithCaptcha(v))
+		router := gin.New()
+		router.POST("/shorten", middleware.APIKey(map[string]string{"k1": "alice"}), h.Shorten)
+		return router
+	}
+	shorten := func(router *gin.Engine, key, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	router := newRouter(fakeCaptcha{})
+	tests := []struct {
+		name string
+		key  string
+		body string
+		want int
+	}{
+		{"anonymous without token", "", `{"url":"https://example.com/a"}`, http.StatusForbidden},
+		{"anonymous with wrong token", "", `{"url":"https://example.com/a","captcha_token":"guess"}`, http.StatusForbidden},
+		{"anonymous with token", "", `{"url":"https://example.com/a","captcha_token":"solved"}`, http.StatusCreated},
+		{"API key", "k1", `{"url":"https://example.com/b"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if got := shorten(router, tt.key, tt.body); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+
+	down := newRouter(fakeCaptcha{err: errors.New("connection refused")})
+	if got := shorten(down, "", `{"url":"https://example.com/c","captcha_token":"solved"}`); got != http.StatusServiceUnavailable {
+		t.Errorf("provider down: expected %d, got %d", http.StatusServiceUnavailable, got)
+	}
+}
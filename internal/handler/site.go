@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /
+// GET /favicon.ico
+// GET /robots.txt
+// SiteFile serves name from the front end's files.
+func SiteFile(site fs.FS, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		http.ServeFileFS(c.Writer, c.Request, site, name)
+	}
+}
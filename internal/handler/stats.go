@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+	"urlshortener/urlshortener/internal/useragent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DailyClickReader reads the per-day click totals kept by the rollup worker.
+type DailyClickReader interface {
+	DailyClicks(ctx context.Context, code string, from, to time.Time) ([]model.DailyClicks, error)
+}
+
+// WithDailyStats serves per-day click time series from d.
+func WithDailyStats(d DailyClickReader) Option {
+	return func(h *Handler) { h.daily = d }
+}
+
+// ClickBreakdowns groups a link's raw click events by one of their fields.
+type ClickBreakdowns interface {
+	ClickBreakdown(ctx context.Context, code, by string, from, to time.Time) ([]model.ClickCount, error)
+}
+
+// WithBreakdowns serves click breakdowns, such as by country, from b.
+func WithBreakdowns(b ClickBreakdowns) Option {
+	return func(h *Handler) { h.breakdowns = b }
+}
+
+const (
+	// dailyStatsDays is the range of a daily stats request without from.
+	dailyStatsDays = 30
+	// maxDailyStatsDays bounds the range of a daily stats request.
+	maxDailyStatsDays = 366
+)
+
+// statsLink starts a stats request: it checks that the caller owns the link
+// and that the stats are enabled, and parses the requested date range. It
+// answers the request itself and returns ok=false when it cannot go on.
+func (h *Handler) statsLink(c *gin.Context, enabled bool) (rec model.URLRecord, from, to time.Time, ok bool) {
+	owner := middleware.Owner(c)
+	if owner == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return rec, from, to, false
+	}
+	if !enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Click stats are not enabled"})
+		return rec, from, to, false
+	}
+
+	from, to, err := statsRange(c.Query("from"), c.Query("to"), time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return rec, from, to, false
+	}
+
+	rec, err = h.srv.Get(c.Request.Context(), owner, c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return rec, from, to, false
+	case err != nil:
+		internalError(c, err)
+		return rec, from, to, false
+	}
+	return rec, from, to, true
+}
+
+// GET /links/:code/stats/daily?from=&to=
+// Returns the caller's link's clicks per UTC day from from to to, both
+// YYYY-MM-DD and inclusive, with a zero for days without clicks. to defaults
+// to today and from to 30 days before to. Totals lag behind the redirects by
+// up to CLICK_ROLLUP_INTERVAL.
+func (h *Handler) DailyStats(c *gin.Context) {
+	rec, from, to, ok := h.statsLink(c, h.daily != nil)
+	if !ok {
+		return
+	}
+
+	counted, err := h.daily.DailyClicks(c.Request.Context(), rec.Code, from, to)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	clicks := make(map[string]int, len(counted))
+	for _, d := range counted {
+		clicks[d.Day] = d.Clicks
+	}
+
+	stats := model.DailyStats{Code: rec.Code, From: from.Format(time.DateOnly), To: to.Format(time.DateOnly)}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		stats.Days = append(stats.Days, model.DailyClicks{Day: key, Clicks: clicks[key]})
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	c.JSON(http.StatusOK, stats)
+}
+
+// GET /links/:code/stats/countries?from=&to=&limit=
+// Returns the caller's link's clicks from from to to grouped by country,
+// most clicked first. Dates work as for daily stats; limit caps the
+// countries listed.
+func (h *Handler) CountryStats(c *gin.Context) {
+	rec, from, to, counts, limit, ok := h.clickCounts(c, model.BreakdownCountry)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, model.ClickBreakdown{Code: rec.Code, From: from, To: to, Items: top(counts, limit)})
+}
+
+// GET /links/:code/stats/referrers?from=&to=&limit=
+// Like CountryStats, grouped by the domain of the referring page without
+// "www.". Clicks without a referrer are counted under an empty value.
+func (h *Handler) ReferrerStats(c *gin.Context) {
+	rec, from, to, counts, limit, ok := h.clickCounts(c, model.BreakdownReferrer)
+	if !ok {
+		return
+	}
+	items := top(regroup(counts, referrerDomain), limit)
+	c.JSON(http.StatusOK, model.ClickBreakdown{Code: rec.Code, From: from, To: to, Items: items})
+}
+
+// GET /links/:code/stats/browsers?from=&to=&limit=
+// Like CountryStats, grouped by browser family and by operating system as
+// told by the visitors' User-Agent headers.
+func (h *Handler) BrowserStats(c *gin.Context) {
+	rec, from, to, counts, limit, ok := h.clickCounts(c, model.BreakdownUserAgent)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, model.BrowserStats{
+		Code:     rec.Code,
+		From:     from,
+		To:       to,
+		Browsers: top(regroup(counts, useragent.Browser), limit),
+		OS:       top(regroup(counts, useragent.OS), limit),
+	})
+}
+
+const (
+	// defaultBreakdownLimit is how many values a breakdown lists by default.
+	defaultBreakdownLimit = 10
+	// maxBreakdownLimit bounds the limit of a breakdown.
+	maxBreakdownLimit = 100
+)
+
+// clickCounts starts a breakdown request like statsLink and reads the link's
+// clicks grouped by the click field by, with from and to spelled as dates.
+func (h *Handler) clickCounts(c *gin.Context, by string) (rec model.URLRecord, from, to string, counts []model.ClickCount, limit int, ok bool) {
+	rec, first, last, ok := h.statsLink(c, h.breakdowns != nil)
+	if !ok {
+		return rec, from, to, nil, 0, false
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultBreakdownLimit)))
+	if err != nil || limit < 1 || limit > maxBreakdownLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxBreakdownLimit)})
+		return rec, from, to, nil, 0, false
+	}
+
+	counts, err = h.breakdowns.ClickBreakdown(c.Request.Context(), rec.Code, by, first, last.AddDate(0, 0, 1))
+	if err != nil {
+		internalError(c, err)
+		return rec, from, to, nil, 0, false
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	return rec, first.Format(time.DateOnly), last.Format(time.DateOnly), counts, limit, true
+}
+
+// regroup merges counts whose values fold to the same value, most clicked
+// first.
+func regroup(counts []model.ClickCount, fold func(string) string) []model.ClickCount {
+	index := make(map[string]int)
+	var merged []model.ClickCount
+	for _, cc := range counts {
+		v := fold(cc.Value)
+		if i, ok := index[v]; ok {
+			merged[i].Clicks += cc.Clicks
+			continue
+		}
+		index[v] = len(merged)
+		merged = append(merged, model.ClickCount{Value: v, Clicks: cc.Clicks})
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Clicks > merged[j].Clicks })
+	return merged
+}
+
+// top returns the first n of counts, never nil so it encodes as [].
+func top(counts []model.ClickCount, n int) []model.ClickCount {
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	if counts == nil {
+		counts = []model.ClickCount{}
+	}
+	return counts
+}
+
+// referrerDomain reduces a referrer to its host name without "www.".
+func referrerDomain(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// statsRange parses the from and to of a stats request.
+func statsRange(fromParam, toParam string, now time.Time) (from, to time.Time, err error) {
+	to = now.Truncate(24 * time.Hour)
+	if toParam != "" {
+		if to, err = time.Parse(time.DateOnly, toParam); err != nil {
+			return from, to, errors.New("to must be a date like 2024-05-01")
+		}
+	}
+	from = to.AddDate(0, 0, 1-dailyStatsDays)
+	if fromParam != "" {
+		if from, err = time.Parse(time.DateOnly, fromParam); err != nil {
+			return from, to, errors.New("from must be a date like 2024-05-01")
+		}
+	}
+	switch {
+	case from.After(to):
+		return from, to, errors.New("from must not be after to")
+	case to.Sub(from) >= maxDailyStatsDays*24*time.Hour:
+		return from, to, fmt.Errorf("at most %d days can be requested at once", maxDailyStatsDays)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type takedownData struct {
+	ShortURL    string
+	Heading     string
+	Explanation string
+	Note        string
+}
+
+// takedownPage tells a visitor of a taken down link why it no longer
+// redirects: 451 for legal complaints, 410 for abuse.
+func takedownPage(c *gin.Context, t model.Takedown) {
+	data := takedownData{ShortURL: c.Request.Host + "/" + t.Code, Note: t.Note}
+	status := http.StatusGone
+	switch t.Reason {
+	case model.TakedownPhishing:
+		data.Heading = "This link led to a phishing site"
+		data.Explanation = "It was removed because the page it pointed to tried to steal passwords or other personal details."
+	case model.TakedownMalware:
+		data.Heading = "This link led to malware"
+		data.Explanation = "It was removed because the page it pointed to distributed harmful software."
+	case model.TakedownDMCA:
+		status = http.StatusUnavailableForLegalReasons
+		data.Heading = "This link is unavailable for legal reasons"
+		data.Explanation = "It was removed in response to a copyright complaint."
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := templates.ExecuteTemplate(c.Writer, "takedown.html", data); err != nil {
+		c.Error(err)
+	}
+	c.Abort()
+}
+
+// POST /admin/links/:code/takedown
+// Disables a link for phishing, malware or a DMCA complaint; visitors get a
+// page saying so and the owner a link.taken_down webhook.
+func (h *Handler) AdminTakedown(c *gin.Context) {
+	if !requireJSON(c) {
+		return
+	}
+	var req model.TakedownReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+		return
+	}
+
+	t, err := h.admin.TakeDown(c.Request.Context(), middleware.Owner(c), c.Param("code"), req.Reason, req.Note)
+	switch {
+	case errors.Is(err, service.ErrInvalidReason):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusOK, t)
+	}
+}
+
+// DELETE /admin/links/:code/takedown
+// Lifts a takedown and enables the link again.
+func (h *Handler) AdminLiftTakedown(c *gin.Context) {
+	rec, err := h.admin.LiftTakedown(c.Request.Context(), middleware.Owner(c), c.Param("code"))
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link is not taken down"})
+	case err != nil:
+		internalError(c, err)
+	default:
+		c.IndentedJSON(http.StatusOK, rec)
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"cmp"
+	"net/http"
+	"net/url"
+
+	"urlshortener/urlshortener/internal/useragent"
+
+	"github.com/gin-gonic/gin"
+)
+
+type unfurlData struct {
+	Title       string
+	Description string
+	SiteName    string
+	Image       string
+	URL         string
+}
+
+// unfurl answers a link-preview bot, such as Slackbot, with a page carrying
+// the destination's Open Graph tags, so the shared short link shows the
+// destination's preview. It reports whether it answered: links without
+// fetched metadata, links counting their clicks and lookups that fail are
+// left to the redirect. Bots do not count as clicks.
+func (h *Handler) unfurl(c *gin.Context, code string) bool {
+	if h.pageMeta == nil || c.Request.Method != http.MethodGet || !useragent.Unfurler(c.Request.UserAgent()) {
+		return false
+	}
+	ctx := c.Request.Context()
+	rec, dest, err := h.peek(ctx, h.cfg(ctx).DomainFor(c.Request.Host), code)
+	if err != nil || rec.MaxClicks > 0 {
+		return false
+	}
+	meta, ok := h.previewMeta(ctx, rec.Code)
+	if !ok {
+		return false
+	}
+
+	data := unfurlData{Title: meta.Title, Description: meta.Description, SiteName: meta.SiteName, Image: meta.Image, URL: dest}
+	if data.Title == "" {
+		if u, err := url.Parse(dest); err == nil {
+			data.Title = cmp.Or(meta.SiteName, u.Hostname())
+		}
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	// Shared caches must not hand the page to browsers.
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(http.StatusOK)
+	if err := templates.ExecuteTemplate(c.Writer, "unfurl.html", data); err != nil {
+		c.Error(err)
+	}
+	return true
+}
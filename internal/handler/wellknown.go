@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /.well-known/apple-app-site-association
+// GET /.well-known/assetlinks.json
+// WellKnown serves doc, a JSON document that lets a companion app claim
+// the short links, as it is. Apple and Google fetch them without
+// following redirects and cache them, as may everyone else.
+func WellKnown(doc []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=3600")
+		c.Data(http.StatusOK, "application/json", doc)
+	}
+}
@@ -0,0 +1,19 @@
+package http
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// debugHandler serves the net/http/pprof profiles under /debug/pprof/. It is
+// meant for a listener of its own that only operators can reach, since the
+// profiles expose the process's internals and some take seconds of CPU.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ListenAndServe serves h on the listeners of mainListeners, terminating TLS
+// itself when a certificate pair or autocert is configured. With HTTP_ADDR
+// set, another listener serves h over plain HTTP, or with HTTP_REDIRECT only
+// redirects to HTTPS, and answers ACME challenges either way. With
+// DEBUG_ADDR set another serves the pprof profiles. All listeners shut down
+// gracefully once ctx is cancelled.
+func ListenAndServe(ctx context.Context, cfg config.Config, h http.Handler) error {
+	lns, err := mainListeners(cfg)
+	if err != nil {
+		return err
+	}
+	srv := newServer(cfg, cfg.BindAddr(), h)
+	servers := []*http.Server{srv}
+	errCh := make(chan error, len(lns)+2)
+
+	if cfg.DebugAddr != "" {
+		// Profiles take as long as they are asked to, so only slow headers
+		// are cut off.
+		ds := &http.Server{Addr: cfg.DebugAddr, Handler: debugHandler(), ReadHeaderTimeout: cfg.ReadHeaderTimeout}
+		servers = append(servers, ds)
+		go func() { errCh <- ds.ListenAndServe() }()
+	}
+
+	if !cfg.TLSEnabled() {
+		for _, ln := range lns {
+			go func() { errCh <- srv.Serve(ln) }()
+		}
+		return wait(ctx, errCh, servers)
+	}
+
+	plain := h
+	if cfg.HTTPRedirect {
+		plain = httpsRedirect(cfg.Port)
+	}
+
+	var certFile, keyFile string
+	if cfg.TLSAutocert {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(autocertHosts(cfg)...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		plain = m.HTTPHandler(plain)
+	} else {
+		certFile, keyFile = cfg.TLSCertFile, cfg.TLSKeyFile
+	}
+
+	if cfg.HTTPAddr != "" {
+		ps := newServer(cfg, cfg.HTTPAddr, plain)
+		servers = append(servers, ps)
+		go func() { errCh <- ps.ListenAndServe() }()
+	}
+	for _, ln := range lns {
+		go func() { errCh <- srv.ServeTLS(ln, certFile, keyFile) }()
+	}
+
+	return wait(ctx, errCh, servers)
+}
+
+// newServer returns a server for h on addr that cuts off slow clients and
+// oversized headers as the configuration says.
+func newServer(cfg config.Config, addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// mainListeners opens where the API is served: the sockets passed by systemd
+// socket activation, else UNIX_SOCKET, else cfg.BindAddr() over TCP.
+func mainListeners(cfg config.Config) ([]net.Listener, error) {
+	if lns, err := systemdListeners(); err != nil || len(lns) > 0 {
+		return lns, err
+	}
+	if cfg.UnixSocket != "" {
+		ln, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketMode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	ln, err := net.Listen("tcp", cfg.BindAddr())
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{ln}, nil
+}
+
+// listenUnix listens on the socket at path, replacing one left behind by a
+// previous run, and gives it mode permissions. The socket is removed again
+// when the listener closes.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("UNIX_SOCKET %s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// shutdownTimeout bounds how long in-flight requests may finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// wait blocks until a listener fails or ctx is cancelled, then stops all servers.
+func wait(ctx context.Context, errCh <-chan error, servers []*http.Server) error {
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		s.Shutdown(sctx)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// httpsRedirect permanently redirects plain-HTTP requests to the same host on
+// the HTTPS port, keeping path and query intact.
+func httpsRedirect(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
+
+// autocertHosts returns the hosts certificates may be issued for: the
+// explicit TLS_AUTOCERT_HOSTS list, or else the hosts of BASE_URL, the
+// other short domains and the tenants.
+func autocertHosts(cfg config.Config) []string {
+	if len(cfg.TLSAutocertHosts) > 0 {
+		return cfg.TLSAutocertHosts
+	}
+	var extra []string
+	for host := range cfg.ShortDomains {
+		extra = append(extra, host)
+	}
+	for host := range cfg.Tenants {
+		extra = append(extra, host)
+	}
+	sort.Strings(extra)
+
+	if host := cfg.DefaultDomain(); host != "" {
+		return append([]string{host}, extra...)
+	}
+	return extra
+}
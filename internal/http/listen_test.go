@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	testCases := []struct {
+		name     string
+		port     string
+		host     string
+		target   string
+		expected string
+	}{
+		{"Default port", "443", "shawt.ly", "/AbC123?x=1", "https://shawt.ly/AbC123?x=1"},
+		{"Custom port", "8443", "shawt.ly:8080", "/AbC123", "https://shawt.ly:8443/AbC123"},
+		{"Root path", "443", "shawt.ly:80", "/", "https://shawt.ly/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			req.Host = tc.host
+			w := httptest.NewRecorder()
+
+			httpsRedirect(tc.port).ServeHTTP(w, req)
+
+			if w.Code != http.StatusMovedPermanently {
+				t.Fatalf("expected %d, got %d", http.StatusMovedPermanently, w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != tc.expected {
+				t.Fatalf("expected Location=%q, got %q", tc.expected, loc)
+			}
+		})
+	}
+}
+
+func TestAutocertHosts(t *testing.T) {
+	cfg := config.Config{BaseURL: "https://Shawt.ly/"}
+	if got := autocertHosts(cfg); !reflect.DeepEqual(got, []string{"shawt.ly"}) {
+		t.Errorf("expected hosts from BaseURL, got %v", got)
+	}
+
+	cfg.ShortDomains = map[string]string{"example.to": "https://example.to/", "b.example": "https://b.example/"}
+	if got := autocertHosts(cfg); !reflect.DeepEqual(got, []string{"shawt.ly", "b.example", "example.to"}) {
+		t.Errorf("expected hosts of all short domains, got %v", got)
+	}
+
+	cfg.TLSAutocertHosts = []string{"a.example", "b.example"}
+	if got := autocertHosts(cfg); !reflect.DeepEqual(got, cfg.TLSAutocertHosts) {
+		t.Errorf("expected explicit hosts, got %v", got)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	debugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine profile") {
+		t.Errorf("expected the goroutine profile, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	debugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/links", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected only profiles to be served, got %d", w.Code)
+	}
+}
+
+func TestListenAndServe_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "shawty.sock")
+	os.WriteFile(sock, nil, 0o644)
+	cfg := config.Config{UnixSocket: sock, UnixSocketMode: 0o660}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	if err := ListenAndServe(context.Background(), cfg, h); err == nil {
+		t.Fatal("expected a regular file in the way to be kept and reported")
+	}
+	os.Remove(sock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ListenAndServe(ctx, cfg, h) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for range 50 {
+		if resp, err = client.Get("http://shawty/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("request over the socket failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("expected %d, got %d", http.StatusTeapot, resp.StatusCode)
+	}
+	if fi, err := os.Stat(sock); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0o660 {
+		t.Errorf("expected socket mode 0660, got %v", fi.Mode().Perm())
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed on shutdown, got %v", err)
+	}
+}
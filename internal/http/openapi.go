@@ -0,0 +1,27 @@
+package http
+
+import (
+	"encoding/json"
+
+	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/openapi"
+)
+
+// OpenAPISpec generates the OpenAPI document from the routes NewApp
+// registers. It backs go generate in internal/openapi.
+func OpenAPISpec() ([]byte, error) {
+	cfg := config.Config{DBDriver: "memory", BaseURL: "http://localhost:3001/", OpenAPIUI: true}
+	var routes []openapi.Route
+	for _, r := range NewApp(cfg, nil).Engine.Routes() {
+		routes = append(routes, openapi.Route{Method: r.Method, Path: r.Path})
+	}
+	doc, err := openapi.Build(routes)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
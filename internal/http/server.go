@@ -1,28 +1,797 @@
 package http
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
 
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/captcha"
 	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/feature"
+	"urlshortener/urlshortener/internal/geoip"
 	"urlshortener/urlshortener/internal/handler"
+	"urlshortener/urlshortener/internal/liveness"
+	"urlshortener/urlshortener/internal/metrics"
+	"urlshortener/urlshortener/internal/middleware"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/pagetitle"
 	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/reputation"
+	"urlshortener/urlshortener/internal/scan"
 	"urlshortener/urlshortener/internal/service"
+	"urlshortener/urlshortener/internal/util"
+	"urlshortener/urlshortener/internal/webhook"
+	"urlshortener/urlshortener/internal/worker"
+	"urlshortener/urlshortener/site"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-func NewServer(cfg config.Config, db *sql.DB) *gin.Engine {
-	r := gin.Default()
+// App wires configuration, storage and services into a router, and owns the
+// background workers that share its storage.
+type App struct {
+	Engine *gin.Engine
+
+	cfg         config.Config
+	live        *config.Live
+	repo        repo.URLRepo
+	clicks      repo.ClickRepo
+	clickStats  repo.ClickStatsRepo
+	webhooks    repo.WebhookRepo
+	admin       repo.AdminRepo
+	audit       repo.AuditRepo
+	idempotency repo.IdempotencyRepo
+	usage       repo.QuotaRepo
+	sequence    repo.SequenceRepo
+	settings    repo.SettingsRepo
+	orgs        repo.OrgRepo
+	quotas      *service.Quotas
+	flags       *feature.Flags
+	scanner     scan.Scanner
+	writer      *worker.ClickWriter
+	meta        *worker.MetaFetcher
+	metrics     *metrics.Metrics
+	redis       *redis.Client
+	notFound    *repo.NegativeCache
+	linkCache   *repo.LinkCache
+	codeFilter  *repo.CodeFilter
+	codeFeed    *cache.RedisFeed
+	migration   *repo.DualWrite
+	archive     repo.ArchiveRepo
+	locks       repo.LockRepo
+	leader      *worker.Leader
+	jobs        *worker.Scheduler
+	instance    string
+	wg          sync.WaitGroup
+}
+
+func NewApp(cfg config.Config, db *sql.DB) *App {
+	a := &App{cfg: cfg, live: config.NewLive(cfg), scanner: scan.New(cfg), instance: instanceID()}
+
+	switch cfg.DBDriver {
+	case "mysql":
+		r := repo.NewMySQL(db)
+		a.archive = r
+		a.repo, a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r, r
+	case "memory":
+		r := repo.NewMemory()
+		a.archive = r
+		a.repo, a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r, r
+	case "dynamodb":
+		// DynamoDB holds the links; everything else lives in memory.
+		r := repo.NewLinkStore(repo.NewDynamo(a.dynamoClient(), cfg.DynamoTable))
+		a.repo = r.Links()
+		a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r
+	case "mongodb":
+		// MongoDB holds the links; everything else lives in memory.
+		r := repo.NewLinkStore(a.mongoLinks())
+		a.repo = r.Links()
+		a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r
+	case "cassandra":
+		// Cassandra holds the links; everything else lives in memory.
+		r := repo.NewLinkStore(a.cassandraLinks())
+		a.repo = r.Links()
+		a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r
+	case "redis":
+		// Redis holds the links; everything else lives in memory.
+		r := repo.NewLinkStore(a.redisLinks())
+		a.repo = r.Links()
+		a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r
+	default:
+		r := repo.NewPostgres(db)
+		a.archive = r
+		a.repo, a.clicks, a.webhooks, a.idempotency, a.admin, a.usage, a.orgs, a.sequence, a.settings, a.clickStats, a.audit, a.locks = r, r, r, r, r, r, r, r, r, r, r, r
+	}
+
+	if cfg.RedisURL != "" {
+		// Redis reaches every instance whatever holds the data, and keeps
+		// the leases off the database.
+		a.locks = repo.NewRedisLocks(a.redisClient(), "shawty:lock:")
+	}
+	if cfg.LeaderElection {
+		a.leader = worker.NewLeader(a.locks, a.instance, cfg.LeaderLease)
+		a.jobs = worker.NewScheduler(a.leader)
+	} else {
+		a.jobs = worker.NewScheduler(worker.NewLeases(a.locks, a.instance))
+	}
+	if cfg.ArchiveAfterDays > 0 && a.archive != nil {
+		// Archived links come back when looked up.
+		a.repo = repo.WithArchive(a.repo, a.archive)
+	}
+	if cfg.MigrateFrom != "" {
+		// Links move from MIGRATE_FROM's backend to the one chosen above.
+		a.migration = repo.NewDualWrite(a.links(cfg.MigrateFrom, db), a.repo)
+		a.repo = a.migration
+	}
+
+	// Concurrent lookups of one code share a query.
+	a.repo = repo.WithSingleflight(a.repo)
+	if cfg.NegativeCacheTTL > 0 {
+		a.notFound = repo.WithNegativeCache(a.repo, a.cacheSet("notfound:", cfg.NegativeCacheSize, cfg.NegativeCacheTTL))
+		a.repo = a.notFound
+	}
+	if cfg.CodeFilter {
+		// The filter goes in front of the negative cache, which it makes
+		// mostly redundant. Instances hear of each other's codes over Redis.
+		var announce func(context.Context, string)
+		if cfg.RedisURL != "" {
+			a.codeFeed = cache.NewRedisFeed(a.redisClient(), "shawty:codes")
+			announce = a.codeFeed.Publish
+		}
+		a.codeFilter = repo.WithCodeFilter(a.repo, announce)
+		a.repo = a.codeFilter
+	}
+	if cfg.LinkCacheTTL > 0 {
+		// Outermost, so every change to a link reaches it and lookups it
+		// misses still pass the filters above.
+		a.linkCache = repo.WithLinkCache(a.repo, a.cacheStore("links:", cfg.LinkCacheSize, cfg.LinkCacheTTL))
+		a.repo = a.linkCache
+	}
+
+	a.flags = feature.New(a.settings, featureFlags(&cfg))
+	if err := a.flags.Refresh(context.Background()); err != nil {
+		log.Printf("feature flags: %v", err)
+	}
+	a.live.OnReload(func(cfg *config.Config) { a.flags.SetConfig(featureFlags(cfg)) })
+	if a.linkCache != nil {
+		// Links of owners the link_cache flag is off for are read from the
+		// database on every redirect.
+		a.linkCache.Only(func(rec model.URLRecord) bool { return a.flags.Enabled(feature.LinkCache, rec.Owner) })
+	}
+
+	reserved := util.NewReserved(cfg.ReservedCodes)
+	opts := []service.Option{service.WithReserved(reserved), service.WithBans(a.admin), service.WithTakedowns(a.admin), service.WithOrgs(a.orgs), service.WithAudit(a.audit)}
+	var codeStats service.CodeStatser
+	if cfg.CodeAdaptiveLength && (cfg.CodeStrategy == "" || cfg.CodeStrategy == util.CodesRandom) {
+		codes := service.NewAdaptiveCodes(context.Background(), a.settings, cfg.CodeLength, cfg.CodeCollisionRate, cfg.CodeCollisionWindow)
+		codeStats = codes
+		// Owners the adaptive_codes flag is off for keep fixed-length codes.
+		opts = append(opts, service.WithCodes(util.RandomCodes{Length: cfg.CodeLength}), service.WithFlaggedCodes(a.flags, feature.AdaptiveCodes, codes))
+	} else {
+		// Load has already rejected unknown strategies.
+		codeOpts := util.CodeOptions{Length: cfg.CodeLength, Counter: a.sequence, Key: cfg.CodeSequenceKey}
+		if codes, err := util.NewCodeGenerator(cfg.CodeStrategy, codeOpts); err == nil {
+			opts = append(opts, service.WithCodes(codes))
+		}
+	}
+	if a.scanner != nil {
+		opts = append(opts, service.WithScanner(a.scanner))
+	}
+	if rep := reputation.New(cfg); rep != nil {
+		opts = append(opts, service.WithReputation(rep, cfg.ReputationThreshold, a.admin))
+	}
+	if a.linkCache != nil {
+		opts = append(opts, service.WithLinkCache(a.linkCache))
+	}
+	if cfg.FetchTitles {
+		opts = append(opts, service.WithTitles(pagetitle.New(cfg.TitleFetchTimeout)))
+	}
+	if cfg.FetchMetadata {
+		a.meta = worker.NewMetaFetcher(pagetitle.New(cfg.MetadataTimeout), a.admin, a.cacheStore("meta:", cfg.MetadataCacheSize, cfg.MetadataCacheTTL), cfg.MetadataQueueSize)
+		opts = append(opts, service.WithPageMeta(a.meta, a.admin))
+	}
+	if cfg.LivenessCheck {
+		opts = append(opts, service.WithLiveness(liveness.New(cfg.LivenessTimeout, int64(cfg.LivenessMaxBytes)), a.admin, cfg.LivenessRejectDead))
+	}
+	if cfg.StripTracking {
+		opts = append(opts, service.WithStripTracking(true))
+	}
+	if cfg.Quota != (model.Quota{}) || len(cfg.OwnerQuotas) > 0 {
+		a.quotas = service.NewQuotas(a.repo, a.usage, cfg.Quota, cfg.OwnerQuotas)
+		a.live.OnReload(func(cfg *config.Config) { a.quotas.SetLimits(cfg.Quota, cfg.OwnerQuotas) })
+		opts = append(opts, service.WithQuotas(a.quotas))
+	}
+	var notifier *webhook.Notifier
+	var events service.EventPublisher
+	if len(cfg.WebhookURLs) > 0 {
+		notifier = webhook.NewNotifier(a.webhooks, cfg.WebhookURLs)
+		events = notifier
+		opts = append(opts, service.WithEvents(notifier))
+	}
+	sv := service.NewShortener(a.repo, opts...)
+
+	adminSvc := service.NewAdmin(a.repo, a.admin, reserved, events, codeStats, a.audit)
+	hopts := []handler.Option{
+		handler.WithLiveConfig(a.live),
+		handler.WithFlags(a.flags),
+		handler.WithJobs(a.jobs),
+		handler.WithAdmin(adminSvc),
+		handler.WithReports(service.NewReports(a.repo, a.admin, adminSvc, events, a.audit)),
+		handler.WithOrgs(service.NewOrgs(a.orgs)),
+	}
+	if a.meta != nil {
+		hopts = append(hopts, handler.WithPageMeta(a.admin))
+	}
+	if v := captcha.New(cfg.CaptchaProvider, cfg.CaptchaSecret); v != nil {
+		hopts = append(hopts, handler.WithCaptcha(v))
+	}
+	if cfg.ErrorPage != "" {
+		// Load has checked that the template parses.
+		if t, err := template.ParseFiles(cfg.ErrorPage); err != nil {
+			log.Printf("ERROR_PAGE: %v", err)
+		} else {
+			hopts = append(hopts, handler.WithErrorPage(t))
+		}
+	}
+	if cfg.ClickEvents {
+		a.writer = worker.NewClickWriter(a.clicks, cfg.ClickBufferSize, cfg.ClickBatchSize, cfg.ClickFlushInterval)
+		a.writer.DedupWindow(cfg.ClickDedupWindow)
+		a.writer.Writers(cfg.ClickWriters)
+		if cfg.ClickOverflow == config.ClickOverflowDropOld {
+			a.writer.DropOldest()
+		}
+		if notifier != nil && cfg.WebhookClicks {
+			a.writer.OnFlush(func(ctx context.Context, events []model.ClickEvent) {
+				notifier.Publish(ctx, model.EventClicks, events)
+			})
+		}
+		hopts = append(hopts, handler.WithClicks(a.writer, clickSalt(cfg)), handler.WithStats(a.clicks))
+		if a.quotas != nil {
+			hopts = append(hopts, handler.WithClickQuota(a.quotas))
+		}
+		if cfg.ClickRollupInterval > 0 {
+			hopts = append(hopts, handler.WithDailyStats(a.clickStats))
+		}
+		hopts = append(hopts, handler.WithBreakdowns(a.clickStats))
+		if cfg.GeoIPDatabase != "" {
+			// Load has checked the file exists; a broken one only costs
+			// clicks their location.
+			if geo, err := geoip.Open(cfg.GeoIPDatabase); err != nil {
+				log.Printf("geoip: %v", err)
+			} else {
+				hopts = append(hopts, handler.WithGeoIP(geo))
+			}
+		}
+	}
+	h := handler.New(cfg, sv, hopts...)
+
+	r := gin.New()
+	// RealIP resolves the client address before anything reads it; gin
+	// itself trusts no forwarding headers.
+	r.SetTrustedProxies(nil)
+	// A path asked for with a method it does not take gets 405 and the
+	// methods it does, not 404.
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(handler.MethodNotAllowed())
+	r.Use(middleware.RealIP(cfg.TrustedProxies, cfg.ClientIPHeader), middleware.RequestID(), accessLog(a.live), gin.Recovery(), middleware.Tenant(a.live))
+	// Exports stream for as long as the caller keeps reading, and imports
+	// store a whole batch.
+	r.Use(middleware.Timeout(cfg.RequestTimeout, cfg.PathPrefix+"/api/v1/export", cfg.PathPrefix+"/api/v1/admin/import"))
+
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		r.Use(middleware.CORS(cfg))
+	}
+
+	// Everything is served under PATH_PREFIX, which is empty at the root.
+	root := r.Group(cfg.PathPrefix)
+	files := site.FS(cfg.SiteDir)
+	get(root, "/", handler.SiteFile(files, "index.html"))
+	get(root, "/favicon.ico", handler.SiteFile(files, "favicon.ico"))
+	// Crawlers and apps look for these at the root of the domain, whatever
+	// the prefix.
+	get(r, "/robots.txt", handler.SiteFile(files, "robots.txt"))
+	for path, file := range map[string]string{
+		"/.well-known/apple-app-site-association": cfg.AppleAppSiteAssociation,
+		"/.well-known/assetlinks.json":            cfg.AssetLinks,
+	} {
+		if file == "" {
+			continue
+		}
+		// Load has checked the file holds JSON.
+		if doc, err := os.ReadFile(file); err != nil {
+			log.Printf("%s: %v", path, err)
+		} else {
+			get(r, path, handler.WellKnown(doc))
+		}
+	}
+	get(root, "/openapi.json", h.OpenAPI)
+	if cfg.Metrics {
+		a.metrics = metrics.New(db)
+		get(root, "/metrics", gin.WrapH(a.metrics.Handler()))
+		if a.notFound != nil {
+			a.metrics.AddCache("negative", a.notFound)
+		}
+		if a.codeFilter != nil {
+			a.metrics.AddCache("code_filter", a.codeFilter)
+		}
+		if a.linkCache != nil {
+			a.metrics.AddCache("links", a.linkCache)
+		}
+		if a.writer != nil {
+			a.metrics.AddCounter("clicks_dropped_total", "Click events dropped because the buffer was full.", func() float64 { return float64(a.writer.Dropped()) })
+			a.metrics.AddCounter("clicks_written_total", "Click events stored.", func() float64 { return float64(a.writer.Written()) })
+			a.metrics.AddCounter("clicks_failed_total", "Click events lost because their batch could not be stored.", func() float64 { return float64(a.writer.Failed()) })
+			a.metrics.AddGauge("clicks_queued", "Click events waiting in the buffer.", func() float64 { return float64(a.writer.Queued()) })
+		}
+		if a.meta != nil {
+			a.metrics.AddCounter("page_metadata_dropped_total", "Links left without page metadata because the fetch queue was full.", func() float64 { return float64(a.meta.Dropped()) })
+		}
+	}
+	if cfg.OpenAPIUI {
+		get(root, "/docs", h.Docs)
+	}
+
+	auth := middleware.APIKeyFunc(func(ctx context.Context) map[string]string { return a.live.For(ctx).APIKeys })
+	idempotency := middleware.Idempotency(a.idempotency)
+	// Limited before Idempotency, which reads the whole body.
+	bodyLimit := middleware.BodyLimit(int64(cfg.MaxBodyBytes))
+
+	v1 := root.Group("/api/v1", auth)
+	v1.POST("/shorten", bodyLimit, idempotency, h.Shorten)
+	v1.POST("/graphql", bodyLimit, h.GraphQL)
+	get(v1, "/links", h.List)
+	get(v1, "/links/:code", h.Get)
+	v1.DELETE("/links/:code", h.Delete)
+	v1.PATCH("/links/:code", bodyLimit, h.Update)
+	v1.POST("/links/:code/disable", h.Disable)
+	v1.POST("/links/:code/enable", h.Enable)
+	get(v1, "/links/:code/stats/daily", h.DailyStats)
+	get(v1, "/links/:code/stats/countries", h.CountryStats)
+	get(v1, "/links/:code/stats/referrers", h.ReferrerStats)
+	get(v1, "/links/:code/stats/browsers", h.BrowserStats)
+	v1.DELETE("/links/:code/clicks", h.PurgeClicks)
+	get(v1, "/export", middleware.Unbounded(), h.Export)
+	get(v1, "/resolve/:code", h.ResolveLink)
+	get(v1, "/lookup", h.ReverseLookup)
+	v1.POST("/orgs", h.CreateOrg)
+	get(v1, "/orgs", h.ListOrgs)
+	get(v1, "/orgs/:org", h.GetOrg)
+	v1.PUT("/orgs/:org/members/:owner", h.PutOrgMember)
+	v1.DELETE("/orgs/:org/members/:owner", h.RemoveOrgMember)
+	get(v1, "/orgs/:org/links", h.OrgLinks)
+	get(v1, "/orgs/:org/stats", h.OrgStats)
+	v1.DELETE("/users/:id/data", h.EraseUser)
+	// Tenants have no admins; those of the default tenant see every tenant.
+	admin := v1.Group("/admin", middleware.RequireAdminFunc(func(ctx context.Context) []string { return a.live.For(ctx).AdminOwners }), middleware.AllTenants())
+	get(admin, "/links", h.AdminListLinks)
+	admin.DELETE("/links/:code", h.AdminDeleteLink)
+	admin.POST("/links/:code/takedown", h.AdminTakedown)
+	admin.DELETE("/links/:code/takedown", h.AdminLiftTakedown)
+	get(admin, "/stats", h.AdminStats)
+	get(admin, "/audit", h.AdminAuditLog)
+	admin.POST("/reload", h.AdminReload)
+	get(admin, "/bans", h.AdminListBans)
+	admin.PUT("/bans/:domain", h.AdminBan)
+	admin.DELETE("/bans/:domain", h.AdminUnban)
+	admin.POST("/import", middleware.Unbounded(), h.AdminImport)
+	get(admin, "/flags", h.AdminListFlags)
+	admin.PUT("/flags/:name", h.AdminSetFlag)
+	admin.DELETE("/flags/:name", h.AdminUnsetFlag)
+	get(admin, "/jobs", h.AdminListJobs)
+	admin.POST("/jobs/:name/run", h.AdminRunJob)
+	get(admin, "/reviews", h.AdminListReviews)
+	admin.POST("/reviews/:code/approve", h.AdminApproveReview)
+	admin.POST("/reviews/:code/reject", h.AdminRejectReview)
+	get(admin, "/reports", h.AdminListReports)
+	admin.POST("/reports/:id/approve", h.AdminApproveReport)
+	admin.POST("/reports/:id/reject", h.AdminRejectReport)
+
+	// Anyone may report a link, without an API key.
+	root.POST("/report", middleware.RateLimit(func() int { return a.live.Get().ReportLimit }, time.Hour), bodyLimit, h.Report)
+
+	// The unversioned /shorten predates /api/v1 and is kept for existing clients.
+	root.POST("/shorten", auth, middleware.Deprecated(cfg.PathPrefix+"/api/v1/shorten"), bodyLimit, idempotency, h.Shorten)
 
-	rp := repo.NewPostgres(db)
-	sv := service.NewShortener(rp)
-	h := handler.New(cfg, sv)
+	// GET on these would otherwise be taken for a short code and get 404.
+	get(root, "/report", handler.MethodNotAllowed(http.MethodPost))
+	get(root, "/shorten", handler.MethodNotAllowed(http.MethodPost))
 
-	r.StaticFile("/", "./site/index.html")
-	r.StaticFile("/favicon.ico", "./site/favicon.ico")
+	get(root, "/:code", middleware.ValidCode(), h.Redirect)
 
-	r.POST("/shorten", h.Shorten)
-	r.GET("/:code", h.Redirect)
+	a.Engine = r
+	return a
+}
+
+// WarmCache loads the most clicked links into the link cache, when
+// CACHE_WARM_TOP asks for it, so a cold start does not send the first
+// burst of redirects to the database. It gives up after a minute rather
+// than hold up startup; failures are only logged.
+func (a *App) WarmCache(ctx context.Context) {
+	if a.cfg.CacheWarmTop <= 0 || a.linkCache == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	codes, err := a.clickStats.TopCodes(ctx, start.AddDate(0, 0, -a.cfg.CacheWarmDays), a.cfg.CacheWarmTop)
+	if err != nil {
+		log.Printf("cache warm: %v", err)
+		return
+	}
+	n, err := a.linkCache.Warm(ctx, codes)
+	if err != nil {
+		log.Printf("cache warm: %v", err)
+	}
+	log.Printf("cache warm: loaded %d of the %d most clicked links in %s", n, len(codes), time.Since(start).Round(time.Millisecond))
+}
+
+// StartWorkers launches the configured background jobs; they stop when ctx
+// is cancelled. Wait blocks until they have finished.
+func (a *App) StartWorkers(ctx context.Context) {
+	if a.leader != nil {
+		a.goWorker(func() { a.leader.Run(ctx) })
+		if a.metrics != nil {
+			a.metrics.AddGauge("leader", "1 while this instance is the elected leader running the shared jobs.", func() float64 {
+				if a.leader.Leading() {
+					return 1
+				}
+				return 0
+			})
+		}
+	}
+	if a.scanner != nil && a.cfg.ScanInterval > 0 {
+		rs := worker.NewRescanner(a.repo, a.scanner, a.cfg.ScanRefreshAfter, a.cfg.ScanBatchSize)
+		a.every(ctx, "rescan", a.cfg.ScanInterval, func(ctx context.Context) error {
+			_, err := rs.RunOnce(ctx)
+			return err
+		})
+	}
+	if a.cfg.LivenessCheck && a.cfg.LivenessInterval > 0 {
+		lc := worker.NewLivenessChecker(a.repo, a.admin, liveness.New(a.cfg.LivenessTimeout, int64(a.cfg.LivenessMaxBytes)), a.cfg.LivenessRefreshAfter, a.cfg.LivenessBatchSize)
+		a.every(ctx, "liveness", a.cfg.LivenessInterval, func(ctx context.Context) error {
+			_, err := lc.RunOnce(ctx)
+			return err
+		})
+	}
+	if a.cfg.CleanupInterval > 0 {
+		cl := worker.NewCleaner(a.repo, a.cfg.CleanupGrace, a.cfg.CleanupDisabledAfter, a.cfg.CleanupBatchSize)
+		a.every(ctx, "cleanup", a.cfg.CleanupInterval, func(ctx context.Context) error {
+			_, err := cl.RunOnce(ctx)
+			return err
+		})
+		if a.metrics != nil {
+			a.metrics.AddCounter("cleanup_deleted_links_total", "Expired and stale links deleted by the cleanup job.", func() float64 { return float64(cl.Removed()) })
+		}
+		if a.cfg.ArchiveAfterDays > 0 && a.archive != nil {
+			ar := worker.NewArchiver(a.archive, a.cfg.ArchiveAfterDays, a.cfg.CleanupBatchSize)
+			a.every(ctx, "archive", a.cfg.CleanupInterval, func(ctx context.Context) error {
+				_, err := ar.RunOnce(ctx)
+				return err
+			})
+			if a.metrics != nil {
+				a.metrics.AddCounter("archive_archived_links_total", "Unused links moved to the archive.", func() float64 { return float64(ar.Archived()) })
+			}
+		}
+		if a.cfg.ClickRetentionDays > 0 {
+			pr := worker.NewClickPruner(a.clickStats, a.cfg.ClickRetentionDays, a.cfg.CleanupBatchSize)
+			a.every(ctx, "retention", a.cfg.CleanupInterval, func(ctx context.Context) error {
+				_, err := pr.RunOnce(ctx)
+				return err
+			})
+			if a.metrics != nil {
+				a.metrics.AddCounter("retention_pruned_clicks_total", "Raw click events deleted past the retention period.", func() float64 { return float64(pr.Pruned()) })
+				a.metrics.AddGauge("retention_last_run_timestamp_seconds", "When the retention job last completed, as a Unix time.", func() float64 {
+					if t := pr.LastRun(); !t.IsZero() {
+						return float64(t.Unix())
+					}
+					return 0
+				})
+			}
+		}
+	}
+	a.every(ctx, "idempotency", time.Hour, func(ctx context.Context) error {
+		_, err := a.idempotency.DeleteIdempotencyKeys(ctx, time.Now().Add(-a.cfg.IdempotencyTTL))
+		return err
+	})
+	if a.quotas != nil {
+		a.every(ctx, "usage", 24*time.Hour, a.quotas.Prune)
+	}
+	if a.meta != nil {
+		a.goWorker(func() { a.meta.Run(ctx) })
+	}
+	if a.writer != nil {
+		a.goWorker(func() { a.writer.Run(ctx) })
+		if a.cfg.ClickRollupInterval > 0 {
+			ru := worker.NewClickRollup(a.clickStats)
+			a.every(ctx, "rollup", a.cfg.ClickRollupInterval, ru.RunOnce)
+		}
+	}
+	if a.codeFilter != nil {
+		if a.codeFeed != nil {
+			a.goWorker(func() { a.codeFeed.Subscribe(ctx, a.codeFilter.Add) })
+		}
+		rebuild := func(ctx context.Context) error {
+			n, err := a.codeFilter.Rebuild(ctx, a.cfg.CodeFilterSize)
+			if err == nil {
+				log.Printf("code filter: loaded %d codes", n)
+			}
+			return err
+		}
+		a.goWorker(func() {
+			// Lookups pass through until the first build is done.
+			if err := rebuild(ctx); err != nil {
+				log.Printf("code filter: %v", err)
+			}
+			worker.Every(ctx, "code filter", a.cfg.CodeFilterRebuild, rebuild)
+		})
+	}
+	if a.cfg.FeatureFlagRefresh > 0 {
+		a.goWorker(func() { worker.Every(ctx, "feature flags", a.cfg.FeatureFlagRefresh, a.flags.Refresh) })
+	}
+	if a.metrics != nil {
+		a.goWorker(func() { a.metrics.Run(ctx, a.cfg.MetricsInterval) })
+	}
+	if len(a.cfg.WebhookURLs) > 0 {
+		sender := webhook.NewSender(a.cfg.WebhookSecret, a.cfg.WebhookTimeout)
+		wd := worker.NewWebhookDeliverer(a.webhooks, sender, a.cfg.WebhookMaxAttempts, 100)
+		// Deliveries are claimed a batch at a time, so every instance sends
+		// a share.
+		a.schedule("webhooks", a.cfg.WebhookInterval, false, func(ctx context.Context) error {
+			_, err := wd.RunOnce(ctx)
+			return err
+		})
+	}
+	if a.metrics != nil {
+		a.metrics.AddJobs(a.jobs)
+	}
+	a.goWorker(func() { a.jobs.Run(ctx) })
+}
+
+// every schedules a fleet-wide job, run on the leader or, without leader
+// election, on whichever instance holds its lease, so that however many
+// instances there are it runs once when due. Jobs that only touch this
+// instance's own state use worker.Every directly.
+func (a *App) every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	a.schedule(name, interval, true, fn)
+}
+
+// schedule adds the job name to the scheduler, due on its JOB_SCHEDULES
+// entry or else every interval.
+func (a *App) schedule(name string, interval time.Duration, shared bool, fn func(ctx context.Context) error) {
+	spec, ok := a.cfg.JobSchedules[name]
+	if !ok {
+		spec = "@every " + interval.String()
+	}
+	if err := a.jobs.Add(name, spec, shared, fn); err != nil {
+		log.Printf("%s: %v", name, err)
+	}
+}
+
+// Backfill copies the links MIGRATE_FROM's backend has to DB_DRIVER's, as
+// described at repo.DualWrite.Backfill.
+func (a *App) Backfill(ctx context.Context, progress func(repo.BackfillResult)) (repo.BackfillResult, error) {
+	if a.migration == nil {
+		return repo.BackfillResult{}, errors.New("backfill: MIGRATE_FROM is not set")
+	}
+	return a.migration.Backfill(ctx, progress)
+}
+
+// Reload rereads the configuration and applies its reloadable settings, as
+// on SIGHUP.
+func (a *App) Reload() error {
+	_, err := a.live.Reload()
+	return err
+}
+
+// OnReload calls fn with every configuration Reload applies.
+func (a *App) OnReload(fn func(*config.Config)) {
+	a.live.OnReload(fn)
+}
 
+// Wait blocks until every worker started by StartWorkers has returned, so
+// buffered work such as click events is flushed before the process exits.
+func (a *App) Wait() {
+	a.wg.Wait()
+}
+
+func (a *App) goWorker(fn func()) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		fn()
+	}()
+}
+
+// cacheSet returns a cache.Set for keys under prefix: in Redis when REDIS_URL
+// is set, so instances share it, otherwise in memory holding about size keys.
+func (a *App) cacheSet(prefix string, size int, ttl time.Duration) cache.Set {
+	if a.cfg.RedisURL == "" {
+		return cache.NewMemorySet(size, ttl)
+	}
+	return cache.NewRedisSet(a.redisClient(), "shawty:"+prefix, ttl)
+}
+
+// cacheStore returns a cache.Store for keys under prefix, placed like
+// cacheSet's.
+func (a *App) cacheStore(prefix string, size int, ttl time.Duration) cache.Store {
+	if a.cfg.RedisURL == "" {
+		return cache.NewMemoryStore(size, ttl)
+	}
+	return cache.NewRedisStore(a.redisClient(), "shawty:"+prefix, ttl)
+}
+
+// redisClient returns the client for REDIS_URL, which must be set.
+func (a *App) redisClient() *redis.Client {
+	if a.redis == nil {
+		// Load has checked the URL; connections are made on first use.
+		opts, _ := redis.ParseURL(a.cfg.RedisURL)
+		a.redis = redis.NewClient(opts)
+	}
+	return a.redis
+}
+
+// dynamoClient returns a DynamoDB client configured the usual AWS way, at
+// DynamoEndpoint when set. Configuration that fails to load is only logged;
+// every request then fails with the reason.
+func (a *App) dynamoClient() *dynamodb.Client {
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Printf("dynamodb: %v", err)
+	}
+	return dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if a.cfg.DynamoEndpoint != "" {
+			o.BaseEndpoint = aws.String(a.cfg.DynamoEndpoint)
+		}
+	})
+}
+
+// mongoLinks returns the repo on the links collection of MongoDatabase,
+// creating its indexes if need be and AutoMigrate allows. The client
+// connects on first use; Load has checked the URI.
+func (a *App) mongoLinks() *repo.MongoRepo {
+	client, _ := mongo.Connect(options.Client().ApplyURI(a.cfg.MongoURI))
+	r := repo.NewMongo(client.Database(a.cfg.MongoDatabase).Collection("links"))
+	if !a.cfg.AutoMigrate {
+		return r
+	}
+	if err := r.EnsureIndexes(context.Background()); err != nil {
+		log.Printf("mongodb: %v", err)
+	}
+	return r
+}
+
+// links returns the repo keeping links with driver, on db for the SQL ones.
+func (a *App) links(driver string, db *sql.DB) repo.URLRepo {
+	switch driver {
+	case "mysql":
+		return repo.NewMySQL(db)
+	case "dynamodb":
+		return repo.NewDynamo(a.dynamoClient(), a.cfg.DynamoTable)
+	case "mongodb":
+		return a.mongoLinks()
+	case "cassandra":
+		return a.cassandraLinks()
+	case "redis":
+		return a.redisLinks()
+	default:
+		return repo.NewPostgres(db)
+	}
+}
+
+// redisLinks returns the repo keeping links in Redis, first turning on the
+// server's append-only file if RedisAppendOnly asks for it. Servers that do
+// not allow CONFIG, as many hosted ones do not, are only logged.
+func (a *App) redisLinks() *repo.RedisRepo {
+	if a.cfg.RedisAppendOnly {
+		if err := a.redisClient().ConfigSet(context.Background(), "appendonly", "yes").Err(); err != nil {
+			log.Printf("redis: appendonly: %v", err)
+		}
+	}
+	return repo.NewRedis(a.redisClient(), "shawty:")
+}
+
+// cassandraLinks returns the repo on CassandraKeyspace, creating its tables
+// if need be and AutoMigrate allows. A cluster that cannot be reached is
+// only logged; the repo tries again on each request.
+func (a *App) cassandraLinks() *repo.CassandraRepo {
+	cluster := gocql.NewCluster(a.cfg.CassandraHosts...)
+	cluster.Keyspace = a.cfg.CassandraKeyspace
+	cluster.Consistency = gocql.Quorum
+	if a.cfg.CassandraUsername != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: a.cfg.CassandraUsername, Password: a.cfg.CassandraPassword}
+	}
+	r := repo.NewCassandra(cluster)
+	if !a.cfg.AutoMigrate {
+		return r
+	}
+	if err := r.EnsureSchema(context.Background()); err != nil {
+		log.Printf("cassandra: %v", err)
+	}
 	return r
 }
+
+// featureFlags returns the configured feature flags, plus those features
+// turned on by their own setting and not narrowed by a flag.
+func featureFlags(cfg *config.Config) map[string]model.FeatureFlag {
+	flags := maps.Clone(cfg.FeatureFlags)
+	if flags == nil {
+		flags = make(map[string]model.FeatureFlag)
+	}
+	if _, ok := flags[feature.AdaptiveCodes]; !ok && cfg.CodeAdaptiveLength {
+		flags[feature.AdaptiveCodes] = model.FeatureFlag{Name: feature.AdaptiveCodes, Percent: 100}
+	}
+	if _, ok := flags[feature.LinkCache]; !ok && cfg.LinkCacheTTL > 0 {
+		flags[feature.LinkCache] = model.FeatureFlag{Name: feature.LinkCache, Percent: 100}
+	}
+	return flags
+}
+
+// get routes GET and HEAD requests for path to handlers. Link checkers and
+// monitors ask with HEAD; net/http drops the body the handlers write.
+func get(g gin.IRoutes, path string, handlers ...gin.HandlerFunc) {
+	g.GET(path, handlers...)
+	g.HEAD(path, handlers...)
+}
+
+// accessLog returns gin's request logger, minus client addresses when the
+// configuration keeps them out of click events. At LogError it logs nothing;
+// the level is read on each request, so a reload can change it.
+func accessLog(live *config.Live) gin.HandlerFunc {
+	logger := gin.Logger()
+	if !live.Get().LogClientIPs() {
+		logger = gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+			return fmt.Sprintf("[GIN] %v | %3d | %13v | %-7s %#v\n%s",
+				p.TimeStamp.Format("2006/01/02 - 15:04:05"), p.StatusCode, p.Latency, p.Method, p.Path, p.ErrorMessage)
+		})
+	}
+	return func(c *gin.Context) {
+		if live.Get().LogLevel == config.LogError {
+			c.Next()
+			return
+		}
+		logger(c)
+	}
+}
+
+// instanceID names this process among the fleet's by host, process and a
+// random suffix, which keeps restarted processes apart.
+func instanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// clickSalt returns CLICK_IP_SALT, or a random per-process salt when unset.
+// IP hashes are then only comparable within one run.
+func clickSalt(cfg config.Config) string {
+	if cfg.ClickIPSalt != "" {
+		return cfg.ClickIPSalt
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func NewServer(cfg config.Config, db *sql.DB) *gin.Engine {
+	return NewApp(cfg, db).Engine
+}
@@ -2,20 +2,28 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"urlshortener/urlshortener/internal/config"
 	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/openapi"
+	"urlshortener/urlshortener/internal/testutil"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/sbowman/dotenv"
 )
 
@@ -28,8 +36,9 @@ func TestMain(m *testing.M) {
 	var err error
 	testDB, err = setupTestDB()
 	if err != nil {
+		// Database-backed tests skip themselves; memory-backed tests still run.
 		fmt.Printf("Failed to setup test database: %v\n", err)
-		os.Exit(1)
+		testDB = nil
 	}
 
 	// Run tests
@@ -58,7 +67,7 @@ func setupTestDB() (*sql.DB, error) {
 	dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s",
 		dbUser, dbPass, dbName, dbHost, dbPort, dbSSLMode)
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -88,7 +97,7 @@ func createTestDatabase(user, pass, dbname, host, port, sslmode string) error {
 	dsn := fmt.Sprintf("user=%s password=%s dbname=postgres host=%s port=%s sslmode=%s",
 		user, pass, host, port, sslmode)
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return err
 	}
@@ -104,17 +113,7 @@ func createTestDatabase(user, pass, dbname, host, port, sslmode string) error {
 }
 
 func createTestTable(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS url_records (
-			id UUID PRIMARY KEY,
-			code TEXT NOT NULL UNIQUE,
-			long_url TEXT NOT NULL UNIQUE,
-			short_url TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
-		)`
-
-	_, err := db.Exec(query)
-	return err
+	return testutil.ApplyMigrations(db)
 }
 
 func cleanupTestDB() {
@@ -149,20 +148,27 @@ func TestNewServer(t *testing.T) {
 
 	var (
 		foundPostShorten bool
+		foundLegacy      bool
 		foundGetCode     bool
 	)
 
 	// Check routes exist
 	for _, r := range routes {
-		if r.Method == http.MethodPost && r.Path == "/shorten" {
+		if r.Method == http.MethodPost && r.Path == "/api/v1/shorten" {
 			foundPostShorten = true
 		}
+		if r.Method == http.MethodPost && r.Path == "/shorten" {
+			foundLegacy = true
+		}
 		if r.Method == http.MethodGet && r.Path == "/:code" {
 			foundGetCode = true
 		}
 	}
 
 	if !foundPostShorten {
+		t.Error("expected route: POST /api/v1/shorten")
+	}
+	if !foundLegacy {
 		t.Error("expected route: POST /shorten")
 	}
 	if !foundGetCode {
@@ -190,7 +196,7 @@ func TestServer_ShortenEndpoint_Integration(t *testing.T) {
 	}
 	jsonBody, _ := json.Marshal(reqBody)
 
-	req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+	req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -259,7 +265,7 @@ func TestServer_ShortenEndpoint_ExistingURL(t *testing.T) {
 	reqBody := model.CreateReq{URL: longURL}
 	jsonBody, _ := json.Marshal(reqBody)
 
-	req1 := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+	req1 := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer(jsonBody))
 	req1.Header.Set("Content-Type", "application/json")
 	w1 := httptest.NewRecorder()
 
@@ -273,7 +279,7 @@ func TestServer_ShortenEndpoint_ExistingURL(t *testing.T) {
 	json.Unmarshal(w1.Body.Bytes(), &response1)
 
 	// Second request - should return existing
-	req2 := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+	req2 := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer(jsonBody))
 	req2.Header.Set("Content-Type", "application/json")
 	w2 := httptest.NewRecorder()
 
@@ -352,7 +358,7 @@ func TestServer_ShortenEndpoint_InvalidInput(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer([]byte(tc.requestBody)))
+			req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer([]byte(tc.requestBody)))
 			req.Header.Set("Content-Type", tc.contentType)
 			w := httptest.NewRecorder()
 
@@ -400,7 +406,7 @@ func TestServer_ShortenEndpoint_ConcurrentRequests(t *testing.T) {
 			reqBody := model.CreateReq{URL: longURL}
 			jsonBody, _ := json.Marshal(reqBody)
 
-			req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+			req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer(jsonBody))
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
@@ -484,7 +490,7 @@ func TestServer_ShortenEndpoint_DifferentURLs(t *testing.T) {
 		reqBody := model.CreateReq{URL: url}
 		jsonBody, _ := json.Marshal(reqBody)
 
-		req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+		req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
@@ -542,7 +548,7 @@ func BenchmarkServer_ShortenEndpoint(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		req := httptest.NewRequest("POST", "/shorten", bytes.NewBuffer(jsonBody))
+		req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBuffer(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
@@ -654,7 +660,7 @@ func TestServer_RoutePrecedence(t *testing.T) {
 	srv := NewServer(cfg, testDB)
 
 	body, _ := json.Marshal(model.CreateReq{URL: "https://x"})
-	req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewBuffer(body))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -663,3 +669,1231 @@ func TestServer_RoutePrecedence(t *testing.T) {
 		t.Fatalf("expected 201 or 200, got %d", w.Code)
 	}
 }
+
+func TestServer_MemoryDriver_ShortenAndRedirect(t *testing.T) {
+	cfg := config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/"}
+	srv := NewServer(cfg, nil)
+
+	body, _ := json.Marshal(model.CreateReq{URL: "https://example.com/memory"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var rec model.URLRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/"+rec.Code, nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected %d, got %d", http.StatusFound, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "https://example.com/memory" {
+		t.Fatalf("expected Location=https://example.com/memory, got %q", loc)
+	}
+}
+
+func TestServer_CORSPreflight(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:           "memory",
+		BaseURL:            "https://shawt.ly/",
+		CORSAllowedOrigins: []string{"https://app.example.com"},
+		CORSAllowedMethods: []string{"POST"},
+	}
+	srv := NewServer(cfg, nil)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/shorten", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("unexpected Allow-Origin %q", got)
+	}
+}
+
+func TestServer_MultipleDomains(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:     "memory",
+		BaseURL:      "https://shawt.ly/",
+		ShortDomains: map[string]string{"example.to": "https://example.to/"},
+	}
+	srv := NewServer(cfg, nil)
+
+	shorten := func(host, domain string) model.URLRecord {
+		t.Helper()
+		body, _ := json.Marshal(model.CreateReq{URL: "https://example.com/multi", Domain: domain})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+		req.Host = host
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s/%s: expected %d, got %d: %s", host, domain, http.StatusCreated, w.Code, w.Body.String())
+		}
+		var rec model.URLRecord
+		json.Unmarshal(w.Body.Bytes(), &rec)
+		return rec
+	}
+	redirect := func(host, code string) int {
+		req := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	def := shorten("shawt.ly", "")
+	other := shorten("shawt.ly", "example.to")
+
+	if def.Code == other.Code {
+		t.Fatal("expected one link per domain for the same destination")
+	}
+	if !strings.HasPrefix(def.ShortUrl, "https://shawt.ly/") || !strings.HasPrefix(other.ShortUrl, "https://example.to/") {
+		t.Fatalf("expected per-domain short URLs, got %s and %s", def.ShortUrl, other.ShortUrl)
+	}
+
+	if code := redirect("example.to", other.Code); code != http.StatusFound {
+		t.Errorf("expected %d on its own domain, got %d", http.StatusFound, code)
+	}
+	if code := redirect("shawt.ly", other.Code); code != http.StatusNotFound {
+		t.Errorf("expected %d on another domain, got %d", http.StatusNotFound, code)
+	}
+	if code := redirect("example.to:443", def.Code); code != http.StatusNotFound {
+		t.Errorf("expected %d for default-domain link on example.to, got %d", http.StatusNotFound, code)
+	}
+
+	body, _ := json.Marshal(model.CreateReq{URL: "https://example.com/multi", Domain: "unknown.example"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for unknown domain, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestServer_Admin(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root", "alice-key": "alice"},
+		AdminOwners: []string{"root"},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/api/v1/admin/stats", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/admin/stats", "alice-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w := do(http.MethodPost, "/api/v1/shorten", "alice-key", `{"url":"https://spam.example.com/offer"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("shorten: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	var rec model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &rec)
+
+	if w := do(http.MethodPut, "/api/v1/admin/bans/Example.COM", "root-key", `{"reason":"spam"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"domain": "example.com"`) {
+		t.Fatalf("ban: expected %d with normalised domain, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if w := do(http.MethodPut, "/api/v1/admin/bans/not_a_domain!", "root-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid ban: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/shorten", "alice-key", `{"url":"https://www.example.com/other"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("banned subdomain: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = do(http.MethodGet, "/api/v1/admin/stats", "root-key", "")
+	var stats model.Stats
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != http.StatusOK || stats.Links != 1 || stats.Active != 1 {
+		t.Errorf("stats: expected 1 active link, got %d %+v", w.Code, stats)
+	}
+
+	if w := do(http.MethodGet, "/api/v1/admin/links", "root-key", ""); !strings.Contains(w.Body.String(), rec.Code) {
+		t.Errorf("list: expected %s in %s", rec.Code, w.Body)
+	}
+	if w := do(http.MethodDelete, "/api/v1/admin/links/"+rec.Code, "root-key", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := do(http.MethodGet, "/"+rec.Code, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleted link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if w := do(http.MethodDelete, "/api/v1/admin/bans/example.com", "root-key", ""); w.Code != http.StatusNoContent {
+		t.Errorf("unban: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/admin/bans/example.com", "root-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second unban: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_EraseUser(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root", "alice-key": "alice", "bob-key": "bob"},
+		AdminOwners: []string{"root"},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	var codes []string
+	for i, key := range []string{"alice-key", "alice-key", "bob-key"} {
+		w := do(http.MethodPost, "/api/v1/shorten", key, `{"url":"https://example.com/`+string(rune('a'+i))+`"}`)
+		var rec model.URLRecord
+		json.Unmarshal(w.Body.Bytes(), &rec)
+		codes = append(codes, rec.Code)
+	}
+
+	if w := do(http.MethodDelete, "/api/v1/links/"+codes[2]+"/clicks", "alice-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("purging another's link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/links/"+codes[2]+"/clicks", "bob-key", ""); w.Code != http.StatusNoContent {
+		t.Errorf("purge: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	if w := do(http.MethodDelete, "/api/v1/users/alice/data", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/users/alice/data", "bob-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("other user: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+	w := do(http.MethodDelete, "/api/v1/users/alice/data", "alice-key", "")
+	var erasure model.Erasure
+	json.Unmarshal(w.Body.Bytes(), &erasure)
+	if w.Code != http.StatusOK || erasure.Links != 2 || erasure.By != "alice" {
+		t.Fatalf("erase: expected 2 links erased by alice, got %d %+v", w.Code, erasure)
+	}
+	if w := do(http.MethodGet, "/"+codes[0], "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("erased link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodGet, "/"+codes[2], "", ""); w.Code == http.StatusNotFound {
+		t.Errorf("bob's link: expected it to survive, got %d", w.Code)
+	}
+
+	w = do(http.MethodDelete, "/api/v1/users/bob/data", "root-key", "")
+	json.Unmarshal(w.Body.Bytes(), &erasure)
+	if w.Code != http.StatusOK || erasure.Links != 1 || erasure.By != "root" {
+		t.Errorf("admin erase: expected 1 link erased by root, got %d %+v", w.Code, erasure)
+	}
+}
+
+func TestServer_AuditLog(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root", "alice-key": "alice"},
+		AdminOwners: []string{"root"},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/shorten", "alice-key", `{"url":"https://example.com/audited"}`)
+	var rec model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &rec)
+	do(http.MethodPatch, "/api/v1/links/"+rec.Code, "alice-key", `{"title":"Audited"}`)
+	do(http.MethodPost, "/api/v1/links/"+rec.Code+"/disable", "alice-key", "")
+	do(http.MethodDelete, "/api/v1/admin/links/"+rec.Code, "root-key", "")
+
+	if w := do(http.MethodGet, "/api/v1/admin/audit", "alice-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = do(http.MethodGet, "/api/v1/admin/audit?subject="+rec.Code, "root-key", "")
+	var page model.AuditPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	var got []string
+	for _, e := range page.Entries {
+		got = append(got, e.Action+" by "+e.Actor)
+	}
+	want := []string{"link.deleted by root", "link.disabled by alice", "link.updated by alice", "link.created by alice"}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %d %v", want, w.Code, got)
+	}
+	if upd := page.Entries[2]; upd.Before == nil || upd.Before.Title != "" || upd.After == nil || upd.After.Title != "Audited" {
+		t.Errorf("expected the update's before and after snapshots, got %+v", upd)
+	}
+	if del := page.Entries[0]; del.Before == nil || del.After != nil {
+		t.Errorf("expected the deletion to keep only the before snapshot, got %+v", del)
+	}
+
+	w = do(http.MethodGet, "/api/v1/admin/audit?actor=root&limit=1", "root-key", "")
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Entries) != 1 || page.Entries[0].Action != model.EventLinkDeleted {
+		t.Errorf("expected root's deletion only, got %+v", page.Entries)
+	}
+}
+
+func TestServer_FeatureFlags(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:     "memory",
+		BaseURL:      "https://shawt.ly/",
+		APIKeys:      map[string]string{"root-key": "root"},
+		AdminOwners:  []string{"root"},
+		FeatureFlags: map[string]model.FeatureFlag{"cache": {Name: "cache", Percent: 10}},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("X-API-Key", "root-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+	list := func() []model.FeatureFlag {
+		var body struct{ Flags []model.FeatureFlag }
+		json.Unmarshal(do(http.MethodGet, "/api/v1/admin/flags", "").Body.Bytes(), &body)
+		return body.Flags
+	}
+
+	if w := do(http.MethodPut, "/api/v1/admin/flags/cache", `{"percent":150}`); w.Code != http.StatusBadRequest {
+		t.Errorf("percent out of range: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do(http.MethodPut, "/api/v1/admin/flags/cache", `{"percent":50,"owners":["alice"]}`); w.Code != http.StatusOK {
+		t.Fatalf("set: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	want := []model.FeatureFlag{{Name: "cache", Percent: 50, Owners: []string{"alice"}, Source: "admin"}}
+	if got := list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if w := do(http.MethodDelete, "/api/v1/admin/flags/cache", ""); w.Code != http.StatusNoContent {
+		t.Errorf("unset: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	want = []model.FeatureFlag{{Name: "cache", Percent: 10, Source: "config"}}
+	if got := list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if w := do(http.MethodDelete, "/api/v1/admin/flags/cache", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unset again: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_Jobs(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:         "memory",
+		BaseURL:          "https://shawt.ly/",
+		APIKeys:          map[string]string{"root-key": "root"},
+		AdminOwners:      []string{"root"},
+		CleanupInterval:  time.Hour,
+		CleanupBatchSize: 100,
+		JobSchedules:     map[string]string{"cleanup": "0 3 * * *"},
+	}
+	app := NewApp(cfg, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	app.StartWorkers(ctx)
+	defer app.Wait()
+	defer cancel()
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", "root-key")
+		w := httptest.NewRecorder()
+		app.Engine.ServeHTTP(w, req)
+		return w
+	}
+	list := func() []model.JobStatus {
+		var body struct{ Jobs []model.JobStatus }
+		json.Unmarshal(do(http.MethodGet, "/api/v1/admin/jobs").Body.Bytes(), &body)
+		return body.Jobs
+	}
+
+	jobs := list()
+	if len(jobs) != 2 || jobs[0].Name != "cleanup" || jobs[0].Schedule != "0 3 * * *" || jobs[1].Schedule != "@every 1h0m0s" {
+		t.Fatalf("expected cleanup on its cron schedule and idempotency hourly, got %+v", jobs)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/jobs/cleanup/run"); w.Code != http.StatusAccepted {
+		t.Fatalf("run: expected %d, got %d: %s", http.StatusAccepted, w.Code, w.Body)
+	}
+	for i := 0; i < 100 && list()[0].Runs == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if jobs := list(); jobs[0].Runs != 1 || jobs[0].LastRun == nil {
+		t.Errorf("expected the triggered run recorded, got %+v", jobs[0])
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/jobs/backup/run"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown job: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_Tenants(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root"},
+		AdminOwners: []string{"root"},
+		Tenants: map[string]config.Tenant{
+			"go.acme.test": {ID: "acme", BaseURL: "https://go.acme.test/", APIKeys: map[string]string{"bob-key": "bob"}},
+		},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, host, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = host
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "go.acme.test", "/api/v1/shorten", "bob-key", `{"url":"https://example.com/acme"}`)
+	var rec model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &rec)
+	if w.Code != http.StatusCreated || rec.ShortUrl != "https://go.acme.test/"+rec.Code {
+		t.Fatalf("expected a link on the tenant's base URL, got %d %s", w.Code, w.Body)
+	}
+
+	if w := do(http.MethodGet, "go.acme.test", "/api/v1/links", "root-key", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("default key on tenant host: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := do(http.MethodGet, "go.acme.test", "/"+rec.Code, "", ""); w.Code != http.StatusFound {
+		t.Errorf("redirect on tenant host: expected %d, got %d", http.StatusFound, w.Code)
+	}
+	if w := do(http.MethodGet, "shawt.ly", "/"+rec.Code, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("redirect on default host: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// The same destination gets a link of its own in the default tenant.
+	w = do(http.MethodPost, "shawt.ly", "/api/v1/shorten", "root-key", `{"url":"https://example.com/acme"}`)
+	var home model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &home)
+	if w.Code != http.StatusCreated || home.Code == rec.Code {
+		t.Errorf("expected a separate default-tenant link, got %d %s", w.Code, w.Body)
+	}
+
+	// Admins of the default tenant see every tenant's links.
+	var page model.LinkPage
+	json.Unmarshal(do(http.MethodGet, "shawt.ly", "/api/v1/admin/links", "root-key", "").Body.Bytes(), &page)
+	if len(page.Links) != 2 {
+		t.Errorf("expected both links in the admin list, got %d", len(page.Links))
+	}
+}
+
+func TestServer_PathPrefix(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:   "memory",
+		BaseURL:    "https://shawt.ly/s/",
+		PathPrefix: "/s",
+		APIKeys:    map[string]string{"key": "alice"},
+	}
+	srv := NewServer(cfg, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/s/api/v1/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "key")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	var rec model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &rec)
+	if w.Code != http.StatusCreated || rec.ShortUrl != "https://shawt.ly/s/"+rec.Code {
+		t.Fatalf("expected a short URL under the prefix, got %d %s", w.Code, w.Body)
+	}
+
+	for path, want := range map[string]int{
+		"/s/" + rec.Code:  http.StatusFound,
+		"/" + rec.Code:    http.StatusNotFound,
+		"/s/openapi.json": http.StatusOK,
+		"/api/v1/links":   http.StatusNotFound,
+		"/s/api/v1/links": http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestServer_Reload(t *testing.T) {
+	for _, key := range []string{"API_KEYS", "ADMIN_OWNERS"} {
+		original, set := os.LookupEnv(key)
+		defer func() {
+			if set {
+				os.Setenv(key, original)
+			} else {
+				os.Unsetenv(key)
+			}
+		}()
+	}
+	// What Reload needs to load a valid configuration.
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("BASE_URL", "https://shawt.ly/")
+	t.Setenv("PORT", "3001")
+
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root"},
+		AdminOwners: []string{"root"},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do(http.MethodGet, "/api/v1/links", "carol-key"); code != http.StatusUnauthorized {
+		t.Fatalf("unknown key: expected %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	os.Setenv("API_KEYS", "root:root-key,carol:carol-key")
+	os.Setenv("ADMIN_OWNERS", "carol")
+	if code := do(http.MethodPost, "/api/v1/admin/reload", "root-key"); code != http.StatusNoContent {
+		t.Fatalf("reload: expected %d, got %d", http.StatusNoContent, code)
+	}
+	if code := do(http.MethodGet, "/api/v1/links", "carol-key"); code != http.StatusOK {
+		t.Errorf("added key: expected %d, got %d", http.StatusOK, code)
+	}
+	if code := do(http.MethodGet, "/api/v1/admin/stats", "root-key"); code != http.StatusForbidden {
+		t.Errorf("former admin: expected %d, got %d", http.StatusForbidden, code)
+	}
+}
+
+func TestServer_AdminTakedown(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root", "alice-key": "alice"},
+		AdminOwners: []string{"root"},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/shorten", "alice-key", `{"url":"https://login.example.com/bank"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("shorten: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	var rec model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &rec)
+
+	if w := do(http.MethodPost, "/api/v1/admin/links/"+rec.Code+"/takedown", "root-key", `{"reason":"spam"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown reason: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/links/nope/takedown", "root-key", `{"reason":"phishing"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	w = do(http.MethodPost, "/api/v1/admin/links/"+rec.Code+"/takedown", "root-key", `{"reason":"phishing","note":"Reported by the bank."}`)
+	var td model.Takedown
+	json.Unmarshal(w.Body.Bytes(), &td)
+	if w.Code != http.StatusOK || td.Owner != "alice" || td.By != "root" {
+		t.Fatalf("takedown: expected %d for alice's link by root, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	w = do(http.MethodGet, "/"+rec.Code, "", "")
+	if w.Code != http.StatusGone || !strings.Contains(w.Body.String(), "phishing") || !strings.Contains(w.Body.String(), "Reported by the bank.") {
+		t.Errorf("redirect: expected %d with the takedown page, got %d: %s", http.StatusGone, w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/api/v1/links/"+rec.Code+"/enable", "alice-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("owner enable: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	do(http.MethodPost, "/api/v1/admin/links/"+rec.Code+"/takedown", "root-key", `{"reason":"dmca"}`)
+	if w := do(http.MethodGet, "/"+rec.Code, "", ""); w.Code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("dmca: expected %d, got %d", http.StatusUnavailableForLegalReasons, w.Code)
+	}
+
+	if w := do(http.MethodDelete, "/api/v1/admin/links/"+rec.Code+"/takedown", "root-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("lift: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/"+rec.Code, "", ""); w.Code != http.StatusFound {
+		t.Errorf("after lifting: expected %d, got %d", http.StatusFound, w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/admin/links/"+rec.Code+"/takedown", "root-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("lift again: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Disabled by its owner, a link answers a plain 410.
+	do(http.MethodPost, "/api/v1/links/"+rec.Code+"/disable", "alice-key", "")
+	if w := do(http.MethodGet, "/"+rec.Code, "", ""); w.Code != http.StatusGone || w.Body.Len() != 0 {
+		t.Errorf("disabled: expected a bare %d, got %d: %s", http.StatusGone, w.Code, w.Body)
+	}
+}
+
+func TestServer_AdminImport(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:      "memory",
+		BaseURL:       "https://shawt.ly/",
+		APIKeys:       map[string]string{"root-key": "root", "alice-key": "alice"},
+		AdminOwners:   []string{"root"},
+		ReservedCodes: []string{"admin"},
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/import", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("alice-key", `{"links":[{"code":"x","long_url":"https://example.com/"}]}`); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := do("root-key", `{"links":[]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty import: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := do("root-key", `{"owner":"alice","links":[
+		{"code":"docs","long_url":"https://example.com/docs","created_at":"2019-03-04T05:06:07Z"},
+		{"code":"docs","long_url":"https://example.com/other"},
+		{"code":"admin","long_url":"https://example.com/admin"},
+		{"code":"bad code","long_url":"https://example.com/bad"},
+		{"code":"ftp","long_url":"ftp://example.com/"},
+		{"code":"again","long_url":"https://example.com/docs"}
+	]}`)
+	var res model.ImportResult
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.Imported != 1 {
+		t.Fatalf("import: expected 1 link imported, got %d %s", w.Code, w.Body)
+	}
+	var rows []int
+	for _, c := range res.Conflicts {
+		rows = append(rows, c.Row)
+	}
+	if !reflect.DeepEqual(rows, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("expected conflicts on rows 1-5, got %+v", res.Conflicts)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/links/docs", nil)
+	req.Header.Set("X-API-Key", "alice-key")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	var rec model.URLRecord
+	json.Unmarshal(w.Body.Bytes(), &rec)
+	if w.Code != http.StatusOK || rec.ShortUrl != "https://shawt.ly/docs" || rec.CreatedAt.Year() != 2019 {
+		t.Errorf("imported link: expected it owned by alice with its original date, got %d %+v", w.Code, rec)
+	}
+}
+
+func TestServer_Export(t *testing.T) {
+	srv := NewServer(config.Config{
+		DBDriver: "memory",
+		BaseURL:  "https://shawt.ly/",
+		APIKeys:  map[string]string{"alice-key": "alice", "bob-key": "bob"},
+	}, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 5; i++ {
+		do(http.MethodPost, "/api/v1/shorten", "alice-key", fmt.Sprintf(`{"url":"https://example.com/export/%d"}`, i))
+	}
+	do(http.MethodPost, "/api/v1/shorten", "bob-key", `{"url":"https://example.com/bob"}`)
+
+	export := func(query string) []model.ExportLink {
+		t.Helper()
+		w := do(http.MethodGet, "/api/v1/export"+query, "alice-key", "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("export%s: expected NDJSON, got %d %s", query, w.Code, w.Header().Get("Content-Type"))
+		}
+		var links []model.ExportLink
+		dec := json.NewDecoder(w.Body)
+		for dec.More() {
+			var l model.ExportLink
+			if err := dec.Decode(&l); err != nil {
+				t.Fatalf("export%s: %v", query, err)
+			}
+			links = append(links, l)
+		}
+		return links
+	}
+
+	all := export("")
+	if len(all) != 5 {
+		t.Fatalf("expected alice's 5 links, got %d", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Code >= all[i].Code {
+			t.Errorf("expected links in code order, got %s before %s", all[i-1].Code, all[i].Code)
+		}
+	}
+
+	// Chunks resume from the last code received and together cover everything.
+	var chunked []model.ExportLink
+	cursor := ""
+	for {
+		chunk := export("?limit=2&cursor=" + cursor)
+		chunked = append(chunked, chunk...)
+		if len(chunk) < 2 {
+			break
+		}
+		cursor = chunk[len(chunk)-1].Code
+	}
+	if len(chunked) != len(all) || chunked[4].Code != all[4].Code {
+		t.Errorf("expected chunks to add up to the full export, got %d links", len(chunked))
+	}
+
+	if links := export("?cursor=" + all[4].Code); len(links) != 0 {
+		t.Errorf("expected nothing after the last code, got %d links", len(links))
+	}
+	if w := do(http.MethodGet, "/api/v1/export?limit=0", "alice-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/export", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestServer_Quotas(t *testing.T) {
+	srv := NewServer(config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"alice-key": "alice", "bob-key": "bob"},
+		Quota:       model.Quota{LinksPerDay: 1},
+		OwnerQuotas: map[string]model.Quota{"bob": {LinksTotal: 1}},
+	}, nil)
+
+	shorten := func(key, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"`+url+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := shorten("alice-key", "https://example.com/a1"); w.Code != http.StatusCreated {
+		t.Fatalf("first link: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	w := shorten("alice-key", "https://example.com/a2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("X-Quota-Limit") != "1" || w.Header().Get("X-Quota-Remaining") != "0" ||
+		w.Header().Get("X-Quota-Reset") == "" || w.Header().Get("Retry-After") == "" {
+		t.Errorf("daily quota: expected %d with quota headers, got %d %v", http.StatusTooManyRequests, w.Code, w.Header())
+	}
+
+	shorten("bob-key", "https://example.com/b1")
+	w = shorten("bob-key", "https://example.com/b2")
+	if w.Code != http.StatusForbidden || w.Header().Get("X-Quota-Limit") != "1" || w.Header().Get("Retry-After") != "" {
+		t.Errorf("total quota: expected %d without Retry-After, got %d %v", http.StatusForbidden, w.Code, w.Header())
+	}
+}
+
+func TestServer_Orgs(t *testing.T) {
+	srv := NewServer(config.Config{
+		DBDriver: "memory",
+		BaseURL:  "https://shawt.ly/",
+		APIKeys:  map[string]string{"alice-key": "alice", "bob-key": "bob", "eve-key": "eve"},
+	}, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/v1/orgs", "alice-key", `{"slug":"Acme"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid slug: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/orgs", "alice-key", `{"slug":"acme","name":"Acme"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create: expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/api/v1/orgs", "bob-key", `{"slug":"acme"}`); w.Code != http.StatusConflict {
+		t.Errorf("taken slug: expected %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	// Non-members cannot see the org or create links in it.
+	if w := do(http.MethodGet, "/api/v1/orgs/acme", "bob-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("non-member get: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/shorten", "bob-key", `{"url":"https://example.com/b","org":"acme"}`); w.Code != http.StatusForbidden {
+		t.Errorf("non-member shorten: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	if w := do(http.MethodPut, "/api/v1/orgs/acme/members/bob", "alice-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("add member: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if w := do(http.MethodPut, "/api/v1/orgs/acme/members/eve", "bob-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("member adding member: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w := do(http.MethodPut, "/api/v1/orgs/acme/members/alice", "alice-key", `{"role":"member"}`); w.Code != http.StatusConflict {
+		t.Errorf("demoting last admin: expected %d, got %d", http.StatusConflict, w.Code)
+	}
+
+	w := do(http.MethodPost, "/api/v1/shorten", "bob-key", `{"url":"https://example.com/b","org":"acme"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("member shorten: expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+	var rec model.URLRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil || rec.Org != "acme" || rec.Owner != "bob" {
+		t.Fatalf("member shorten: expected org link owned by bob, got %+v (%v)", rec, err)
+	}
+
+	// Every member manages the org's links; outsiders still cannot.
+	if w := do(http.MethodGet, "/api/v1/links/"+rec.Code, "alice-key", ""); w.Code != http.StatusOK {
+		t.Errorf("member get link: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/links/"+rec.Code, "eve-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("outsider get link: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = do(http.MethodGet, "/api/v1/orgs/acme/links", "alice-key", "")
+	var page model.LinkPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Links) != 1 || page.Links[0].Code != rec.Code {
+		t.Errorf("org links: expected [%s], got %d %s", rec.Code, w.Code, w.Body)
+	}
+	w = do(http.MethodGet, "/api/v1/orgs/acme/stats", "bob-key", "")
+	var stats model.Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || stats.Links != 1 {
+		t.Errorf("org stats: expected 1 link, got %d %s", w.Code, w.Body)
+	}
+
+	// Bob leaves; the link stays with the org.
+	if w := do(http.MethodDelete, "/api/v1/orgs/acme/members/bob", "bob-key", ""); w.Code != http.StatusNoContent {
+		t.Errorf("leave: expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/links/"+rec.Code, "alice-key", ""); w.Code != http.StatusOK {
+		t.Errorf("link after creator left: expected %d, got %d", http.StatusOK, w.Code)
+	}
+	w = do(http.MethodGet, "/api/v1/orgs", "bob-key", "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "acme") {
+		t.Errorf("orgs after leaving: expected none, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestOpenAPISpec_UpToDate(t *testing.T) {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		t.Fatalf("OpenAPISpec: %v", err)
+	}
+	if !bytes.Equal(spec, openapi.Spec) {
+		t.Error("internal/openapi/openapi.json is stale; run go generate ./internal/openapi")
+	}
+
+	srv := NewServer(config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/"}, nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), openapi.Spec) {
+		t.Errorf("GET /openapi.json: expected the embedded spec, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /docs without OPENAPI_UI: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_LegacyShorten(t *testing.T) {
+	srv := NewServer(config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/"}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.com/legacy"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w.Header().Get("Deprecation") != "true" || !strings.Contains(w.Header().Get("Link"), "/api/v1/shorten") {
+		t.Errorf("expected deprecation headers, got %v", w.Header())
+	}
+
+	// The same link comes back through the versioned route.
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://example.com/legacy"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Errorf("expected existing link without deprecation headers, got %d %v", w.Code, w.Header())
+	}
+}
+func TestServer_Reports(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:    "memory",
+		BaseURL:     "https://shawt.ly/",
+		APIKeys:     map[string]string{"root-key": "root", "alice-key": "alice"},
+		AdminOwners: []string{"root"},
+		ReportLimit: 3,
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	var codes []string
+	for _, u := range []string{"https://login.example.com/bank", "https://example.com/fine"} {
+		w := do(http.MethodPost, "/api/v1/shorten", "alice-key", `{"url":"`+u+`"}`)
+		var rec model.URLRecord
+		json.Unmarshal(w.Body.Bytes(), &rec)
+		codes = append(codes, rec.Code)
+	}
+
+	if w := do(http.MethodPost, "/report", "", `{"url":"https://shawt.ly/`+codes[0]+`","reason":"cute"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown reason: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	w := do(http.MethodPost, "/report", "", `{"url":"https://shawt.ly/`+codes[0]+`?x=1","reason":"phishing","details":"Asks for my PIN."}`)
+	var first model.AbuseReport
+	json.Unmarshal(w.Body.Bytes(), &first)
+	if w.Code != http.StatusCreated || first.Code != codes[0] || first.Status != model.ReportPending {
+		t.Fatalf("report: expected %d with a pending report on %s, got %d: %s", http.StatusCreated, codes[0], w.Code, w.Body)
+	}
+	w = do(http.MethodPost, "/report", "", `{"url":"`+codes[1]+`","reason":"spam"}`)
+	var second model.AbuseReport
+	json.Unmarshal(w.Body.Bytes(), &second)
+	if w := do(http.MethodPost, "/report", "", `{"url":"`+codes[1]+`","reason":"spam"}`); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("rate limit: expected %d with Retry-After, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	if w := do(http.MethodGet, "/api/v1/admin/reports", "alice-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin list: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+	w = do(http.MethodGet, "/api/v1/admin/reports?status=pending", "root-key", "")
+	var page model.ReportPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if w.Code != http.StatusOK || len(page.Reports) != 2 || page.Reports[0].ID != first.ID {
+		t.Fatalf("list: expected both reports, oldest first, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := do(http.MethodPost, "/api/v1/admin/reports/"+strconv.FormatInt(second.ID, 10)+"/approve", "root-key", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("approve spam: expected %d without a takedown reason, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/reports/"+strconv.FormatInt(second.ID, 10)+"/reject", "root-key", ""); w.Code != http.StatusOK {
+		t.Errorf("reject: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/"+codes[1], "", ""); w.Code != http.StatusFound {
+		t.Errorf("rejected: expected the link to keep redirecting, got %d", w.Code)
+	}
+
+	w = do(http.MethodPost, "/api/v1/admin/reports/"+strconv.FormatInt(first.ID, 10)+"/approve", "root-key", "")
+	var approved model.AbuseReport
+	json.Unmarshal(w.Body.Bytes(), &approved)
+	if w.Code != http.StatusOK || approved.Status != model.ReportApproved || approved.ReviewedBy != "root" {
+		t.Fatalf("approve: expected %d approved by root, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/"+codes[0], "", ""); w.Code != http.StatusGone {
+		t.Errorf("approved: expected the link taken down, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/reports/"+strconv.FormatInt(first.ID, 10)+"/reject", "root-key", ""); w.Code != http.StatusConflict {
+		t.Errorf("review twice: expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/reports/999/approve", "root-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown report: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_ReputationReview(t *testing.T) {
+	cfg := config.Config{
+		DBDriver:            "memory",
+		BaseURL:             "https://shawt.ly/",
+		APIKeys:             map[string]string{"root-key": "root", "alice-key": "alice"},
+		AdminOwners:         []string{"root"},
+		ReputationThreshold: 80,
+	}
+	srv := NewServer(cfg, nil)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+	shorten := func(u string) (int, model.URLRecord) {
+		w := do(http.MethodPost, "/api/v1/shorten", "alice-key", `{"url":"`+u+`"}`)
+		var rec model.URLRecord
+		json.Unmarshal(w.Body.Bytes(), &rec)
+		return w.Code, rec
+	}
+
+	if code, rec := shorten("https://example.com/fine"); code != http.StatusCreated || !rec.Active {
+		t.Errorf("reputable domain: expected %d and an active link, got %d", http.StatusCreated, code)
+	}
+	code, held := shorten("https://free-prize.tk/claim")
+	if code != http.StatusCreated || held.Active {
+		t.Fatalf("doubtful domain: expected %d and a disabled link, got %d", http.StatusCreated, code)
+	}
+	if w := do(http.MethodGet, "/"+held.Code, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("held redirect: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/links/"+held.Code+"/enable", "alice-key", ""); w.Code != http.StatusForbidden {
+		t.Errorf("owner enable: expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w := do(http.MethodGet, "/api/v1/admin/reviews", "root-key", "")
+	var page model.ReviewPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if w.Code != http.StatusOK || len(page.Reviews) != 1 || page.Reviews[0].Code != held.Code || page.Reviews[0].Score != 75 || page.Reviews[0].Domain != "free-prize.tk" {
+		t.Fatalf("list: expected the held link scored 75, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := do(http.MethodPost, "/api/v1/admin/reviews/"+held.Code+"/approve", "root-key", ""); w.Code != http.StatusOK {
+		t.Fatalf("approve: expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/"+held.Code, "", ""); w.Code != http.StatusFound {
+		t.Errorf("approved redirect: expected %d, got %d", http.StatusFound, w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/admin/reviews/"+held.Code+"/approve", "root-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("approve again: expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	_, rejected := shorten("https://192.0.2.7/login")
+	if w := do(http.MethodPost, "/api/v1/admin/reviews/"+rejected.Code+"/reject", "root-key", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("reject: expected %d, got %d: %s", http.StatusNoContent, w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/api/v1/links/"+rejected.Code, "alice-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("rejected: expected the link deleted, got %d", w.Code)
+	}
+}
+
+func TestServer_WellKnown(t *testing.T) {
+	aasa := filepath.Join(t.TempDir(), "aasa.json")
+	os.WriteFile(aasa, []byte(`{"applinks":{"details":[{"appIDs":["ABCDE12345.ly.shawt.app"],"components":[{"/":"/*"}]}]}}`), 0o644)
+	cfg := config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/s/", PathPrefix: "/s", AppleAppSiteAssociation: aasa}
+	srv := NewServer(cfg, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/apple-app-site-association", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || !strings.Contains(w.Body.String(), "ABCDE12345.ly.shawt.app") {
+		t.Errorf("expected the association file at the domain root, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/.well-known/assetlinks.json", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without ASSET_LINKS, got %d", w.Code)
+	}
+}
+
+func TestServer_Site(t *testing.T) {
+	// The tests run in internal/http, where ./site does not exist.
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Branded</h1>"), 0o644)
+
+	get := func(srv http.Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	srv := NewServer(config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/"}, nil)
+	if w := get(srv, "/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("expected the built-in front end, got %d", w.Code)
+	}
+
+	srv = NewServer(config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/", SiteDir: dir}, nil)
+	if w := get(srv, "/"); w.Body.String() != "<h1>Branded</h1>" {
+		t.Errorf("expected SITE_DIR's index.html, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(srv, "/favicon.ico"); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("expected the built-in favicon where SITE_DIR has none, got %d", w.Code)
+	}
+}
+
+func TestServer_Robots(t *testing.T) {
+	cfg := config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/s/", PathPrefix: "/s", RobotsNoindex: true}
+	srv := NewServer(cfg, nil)
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "User-agent: *") {
+		t.Errorf("expected robots.txt at the domain root, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, path := range []string{"/s/NoSuch1", "/s/NoSuch1+"} {
+		w = httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := w.Header().Get("X-Robots-Tag"); got != "noindex" {
+			t.Errorf("%s: expected X-Robots-Tag noindex, got %q", path, got)
+		}
+	}
+}
+
+func TestServer_MethodNotAllowed(t *testing.T) {
+	srv := NewServer(config.Config{DBDriver: "memory", BaseURL: "http://localhost:3001/"}, nil)
+
+	tests := []struct {
+		method, path, allow string
+	}{
+		{http.MethodGet, "/shorten", "POST"},
+		{http.MethodGet, "/report", "POST"},
+		{http.MethodGet, "/api/v1/shorten", "POST"},
+		{http.MethodPost, "/abc123", "GET, HEAD"},
+		{http.MethodDelete, "/abc123", "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected 405, got %d", tt.method, tt.path, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, got)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "Method not allowed" {
+			t.Errorf("%s %s: expected a JSON error, got %s", tt.method, tt.path, w.Body)
+		}
+	}
+}
+
+func TestServer_Head(t *testing.T) {
+	srv := NewServer(config.Config{
+		DBDriver: "memory",
+		BaseURL:  "https://shawt.ly/",
+		APIKeys:  map[string]string{"alice-key": "alice"},
+	}, nil)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"url":"https://example.com/head"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "alice-key")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+	var rec model.URLRecord
+	if err := json.Unmarshal(do(http.MethodPost, "/api/v1/shorten").Body.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+
+	w := do(http.MethodHead, "/"+rec.Code)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/head" {
+		t.Errorf("HEAD /%s: expected a redirect, got %d %q", rec.Code, w.Code, w.Header().Get("Location"))
+	}
+	for _, path := range []string{
+		"/api/v1/links",
+		"/api/v1/links/" + rec.Code,
+		"/api/v1/links/" + rec.Code + "/stats/daily",
+		"/api/v1/links/NoSuch1",
+	} {
+		get, head := do(http.MethodGet, path), do(http.MethodHead, path)
+		if head.Code != get.Code || head.Header().Get("Content-Type") != get.Header().Get("Content-Type") {
+			t.Errorf("HEAD %s: expected %d %s as for GET, got %d %s", path,
+				get.Code, get.Header().Get("Content-Type"), head.Code, head.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestServer_UnboundedRoutes(t *testing.T) {
+	srv := NewServer(config.Config{DBDriver: "memory", BaseURL: "https://shawt.ly/s/", PathPrefix: "/s", RequestTimeout: time.Nanosecond}, nil)
+	// A slow export or import outlives REQUEST_TIMEOUT only if its context
+	// has no deadline; probes on the same paths see what the handlers would.
+	deadline := func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			c.Status(http.StatusOK)
+		} else {
+			c.Status(http.StatusNoContent)
+		}
+	}
+	for path, want := range map[string]int{
+		"/s/api/v1/export":       http.StatusNoContent,
+		"/s/api/v1/admin/import": http.StatusNoContent,
+		"/s/api/v1/links/probe":  http.StatusOK,
+	} {
+		srv.OPTIONS(path, deadline)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d", path, want, w.Code)
+		}
+	}
+}
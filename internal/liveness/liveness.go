@@ -0,0 +1,101 @@
+// Package liveness requests link destinations to tell live ones from dead
+// ones.
+package liveness
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/urlcheck"
+)
+
+var errInternal = errors.New("refusing to request an internal address")
+
+// Checker requests destinations, with HEAD and, for servers that refuse
+// HEAD, GET, reading at most a capped number of body bytes. Like the title
+// fetcher it never connects to internal addresses.
+type Checker struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// New returns a Checker giving each destination timeout to answer and
+// reading at most maxBytes of a GET response.
+func New(timeout time.Duration, maxBytes int64) *Checker {
+	return newChecker(timeout, maxBytes, false)
+}
+
+func newChecker(timeout time.Duration, maxBytes int64, allowInternal bool) *Checker {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Checked on the resolved address, so DNS cannot point us inside.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); !allowInternal && (ip == nil || urlcheck.IsInternal(ip)) {
+				return errInternal
+			}
+			return nil
+		},
+	}
+	return &Checker{maxBytes: maxBytes, client: &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}}
+}
+
+// Check requests rawURL. Destinations are dead when they cannot be reached
+// or answer 404, 410 or a server error; anything else, including 401 and
+// 403, shows something lives there.
+func (c *Checker) Check(ctx context.Context, rawURL string) model.LinkCheck {
+	check := model.LinkCheck{CheckedAt: time.Now().UTC()}
+	status, err := c.request(ctx, http.MethodHead, rawURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = c.request(ctx, http.MethodGet, rawURL)
+	}
+	if err != nil {
+		// The URL is the link's own; the cause alone is enough.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		check.Error = err.Error()
+		check.Dead = true
+		return check
+	}
+	check.Status = status
+	check.Dead = status == http.StatusNotFound || status == http.StatusGone || status >= 500
+	return check
+}
+
+func (c *Checker) request(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "shawty-link-checker/1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Draining a little lets the connection be reused; the rest is dropped.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, c.maxBytes))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,62 @@
+package liveness
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/private":
+			w.WriteHeader(http.StatusForbidden)
+		case "/gethonly":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte(strings.Repeat("x", 1<<20)))
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := newChecker(time.Second, 1024, true)
+	ctx := context.Background()
+	tests := []struct {
+		path   string
+		status int
+		dead   bool
+	}{
+		{"/ok", http.StatusOK, false},
+		{"/moved", http.StatusOK, false},
+		{"/private", http.StatusForbidden, false},
+		{"/gethonly", http.StatusOK, false},
+		{"/broken", http.StatusBadGateway, true},
+		{"/missing", http.StatusNotFound, true},
+	}
+	for _, tt := range tests {
+		got := c.Check(ctx, srv.URL+tt.path)
+		if got.Status != tt.status || got.Dead != tt.dead || got.CheckedAt.IsZero() {
+			t.Errorf("%s: expected %d, dead %v, got %+v", tt.path, tt.status, tt.dead, got)
+		}
+	}
+
+	if got := c.Check(ctx, "http://127.0.0.1:1/"); !got.Dead || got.Error == "" || got.Status != 0 {
+		t.Errorf("unreachable: expected dead with an error, got %+v", got)
+	}
+	if got := New(time.Second, 1024).Check(ctx, srv.URL+"/ok"); !got.Dead {
+		t.Errorf("expected internal addresses refused, got %+v", got)
+	}
+}
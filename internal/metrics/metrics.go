@@ -0,0 +1,183 @@
+// Package metrics exports the server's internals to Prometheus: the
+// database connection pool, caches and background jobs.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shawty"
+
+// CacheStatser is a cache that counts its lookups.
+type CacheStatser interface {
+	// CacheStats returns how many lookups have hit and missed so far.
+	CacheStats() (hits, misses int64)
+}
+
+// JobStatser is a scheduler that reports on its jobs.
+type JobStatser interface {
+	JobStats() []model.JobStatus
+}
+
+// Metrics holds the exported gauges. The pool, cache and job gauges are sampled
+// by Run rather than read on every scrape, so scrapes stay cheap and see
+// values taken at one moment.
+type Metrics struct {
+	registry *prometheus.Registry
+	db       *sql.DB
+
+	dbMaxOpen      prometheus.Gauge
+	dbOpen         prometheus.Gauge
+	dbInUse        prometheus.Gauge
+	dbIdle         prometheus.Gauge
+	dbWaitCount    prometheus.Gauge
+	dbWaitDuration prometheus.Gauge
+
+	cacheHits   *prometheus.GaugeVec
+	cacheMisses *prometheus.GaugeVec
+	cacheRatio  *prometheus.GaugeVec
+
+	jobRuns         *prometheus.GaugeVec
+	jobFailures     *prometheus.GaugeVec
+	jobLastRun      *prometheus.GaugeVec
+	jobLastDuration *prometheus.GaugeVec
+
+	mu     sync.Mutex
+	caches map[string]CacheStatser
+	jobs   []JobStatser
+}
+
+// New returns Metrics sampling db, which is nil for the memory driver, plus
+// the Go runtime and process collectors.
+func New(db *sql.DB) *Metrics {
+	gauge := func(subsystem, name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Namespace: namespace, Subsystem: subsystem, Name: name, Help: help})
+	}
+	cacheGauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: namespace, Subsystem: "cache", Name: name, Help: help}, []string{"cache"})
+	}
+	jobGauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: namespace, Subsystem: "job", Name: name, Help: help}, []string{"job"})
+	}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		db:       db,
+
+		dbMaxOpen:      gauge("db", "max_open_connections", "Maximum number of open connections to the database; 0 is unlimited."),
+		dbOpen:         gauge("db", "open_connections", "Established connections, in use and idle."),
+		dbInUse:        gauge("db", "in_use_connections", "Connections currently in use."),
+		dbIdle:         gauge("db", "idle_connections", "Idle connections."),
+		dbWaitCount:    gauge("db", "wait_count", "Connections waited for in total."),
+		dbWaitDuration: gauge("db", "wait_duration_seconds", "Time blocked waiting for a connection in total."),
+
+		cacheHits:   cacheGauge("hits", "Lookups answered from the cache in total."),
+		cacheMisses: cacheGauge("misses", "Lookups the cache could not answer in total."),
+		cacheRatio:  cacheGauge("hit_ratio", "Share of lookups answered from the cache."),
+
+		jobRuns:         jobGauge("runs", "Runs of the job in total, failed or not."),
+		jobFailures:     jobGauge("failures", "Runs of the job that failed in total."),
+		jobLastRun:      jobGauge("last_run_timestamp_seconds", "When the job's last run started, as a Unix time."),
+		jobLastDuration: jobGauge("last_duration_seconds", "How long the job's last run took."),
+
+		caches: make(map[string]CacheStatser),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.cacheHits, m.cacheMisses, m.cacheRatio,
+		m.jobRuns, m.jobFailures, m.jobLastRun, m.jobLastDuration,
+	)
+	if db != nil {
+		m.registry.MustRegister(m.dbMaxOpen, m.dbOpen, m.dbInUse, m.dbIdle, m.dbWaitCount, m.dbWaitDuration)
+	}
+	return m
+}
+
+// AddCache samples c's hits and misses under the label cache=name.
+func (m *Metrics) AddCache(name string, c CacheStatser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.caches[name] = c
+}
+
+// AddJobs samples the runs of s's jobs under the label job=name.
+func (m *Metrics) AddJobs(s JobStatser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = append(m.jobs, s)
+}
+
+// AddCounter exports fn, a count that only goes up, as name.
+func (m *Metrics) AddCounter(name, help string, fn func() float64) {
+	m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, fn))
+}
+
+// AddGauge exports fn, read on every scrape, as name.
+func (m *Metrics) AddGauge(name, help string, fn func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, fn))
+}
+
+// Sample updates the pool, cache and job gauges.
+func (m *Metrics) Sample() {
+	if m.db != nil {
+		s := m.db.Stats()
+		m.dbMaxOpen.Set(float64(s.MaxOpenConnections))
+		m.dbOpen.Set(float64(s.OpenConnections))
+		m.dbInUse.Set(float64(s.InUse))
+		m.dbIdle.Set(float64(s.Idle))
+		m.dbWaitCount.Set(float64(s.WaitCount))
+		m.dbWaitDuration.Set(s.WaitDuration.Seconds())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, c := range m.caches {
+		hits, misses := c.CacheStats()
+		m.cacheHits.WithLabelValues(name).Set(float64(hits))
+		m.cacheMisses.WithLabelValues(name).Set(float64(misses))
+		if total := hits + misses; total > 0 {
+			m.cacheRatio.WithLabelValues(name).Set(float64(hits) / float64(total))
+		}
+	}
+	for _, s := range m.jobs {
+		for _, st := range s.JobStats() {
+			m.jobRuns.WithLabelValues(st.Name).Set(float64(st.Runs))
+			m.jobFailures.WithLabelValues(st.Name).Set(float64(st.Failures))
+			if st.LastRun != nil {
+				m.jobLastRun.WithLabelValues(st.Name).Set(float64(st.LastRun.Unix()))
+				m.jobLastDuration.WithLabelValues(st.Name).Set(st.LastDuration)
+			}
+		}
+	}
+}
+
+// Run samples every interval until ctx is cancelled.
+func (m *Metrics) Run(ctx context.Context, interval time.Duration) {
+	m.Sample()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.Sample()
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+type fakeCache struct{ hits, misses int64 }
+
+func (c *fakeCache) CacheStats() (int64, int64) { return c.hits, c.misses }
+
+type fakeJobs []model.JobStatus
+
+func (j fakeJobs) JobStats() []model.JobStatus { return j }
+
+func TestMetrics_Sample(t *testing.T) {
+	m := New(nil)
+	c := &fakeCache{hits: 3, misses: 1}
+	m.AddCache("links", c)
+	m.AddCounter("jobs_total", "Jobs run.", func() float64 { return 7 })
+	last := time.Unix(1700000000, 0)
+	m.AddJobs(fakeJobs{{Name: "cleanup", Runs: 4, Failures: 1, LastRun: &last, LastDuration: 1.5}, {Name: "rescan"}})
+	m.Sample()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`shawty_cache_hits{cache="links"} 3`,
+		`shawty_cache_misses{cache="links"} 1`,
+		`shawty_cache_hit_ratio{cache="links"} 0.75`,
+		`shawty_jobs_total 7`,
+		`shawty_job_runs{job="cleanup"} 4`,
+		`shawty_job_failures{job="cleanup"} 1`,
+		`shawty_job_last_run_timestamp_seconds{job="cleanup"} 1.7e+09`,
+		`shawty_job_last_duration_seconds{job="cleanup"} 1.5`,
+		`shawty_job_runs{job="rescan"} 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "shawty_db_") {
+		t.Error("expected no pool metrics without a database")
+	}
+
+	// Gauges only move when sampled.
+	c.hits = 9
+	w = httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `shawty_cache_hits{cache="links"} 3`) {
+		t.Error("expected the last sample until the next one")
+	}
+}
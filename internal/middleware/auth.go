@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ownerKey = "owner"
+
+// APIKey authenticates callers presenting "Authorization: Bearer <key>" or
+// "X-API-Key: <key>" against keys, a key -> owner map. Requests without a key
+// continue anonymously; an unknown key is rejected with 401.
+func APIKey(keys map[string]string) gin.HandlerFunc {
+	return APIKeyFunc(func(context.Context) map[string]string { return keys })
+}
+
+// APIKeyFunc is APIKey with the keys looked up for every request, so they can
+// change while the server runs and differ between tenants.
+func APIKeyFunc(keys func(ctx context.Context) map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if auth := c.GetHeader("Authorization"); key == "" && auth != "" {
+			scheme, token, _ := strings.Cut(auth, " ")
+			if strings.EqualFold(scheme, "Bearer") {
+				key = strings.TrimSpace(token)
+			}
+		}
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		owner, ok := lookupKey(keys(c.Request.Context()), key)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		c.Set(ownerKey, owner)
+		c.Next()
+	}
+}
+
+// lookupKey compares against every configured key in constant time so the
+// response time does not reveal how much of a key matched.
+func lookupKey(keys map[string]string, key string) (string, bool) {
+	var owner string
+	found := false
+	for k, o := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			owner, found = o, true
+		}
+	}
+	return owner, found
+}
+
+// Owner returns the owner authenticated by APIKey, or "" for anonymous requests.
+func Owner(c *gin.Context) string {
+	return c.GetString(ownerKey)
+}
+
+// RequireAdmin admits only owners listed in admins, which must run after
+// APIKey: anonymous requests get 401 and other owners 403.
+func RequireAdmin(admins []string) gin.HandlerFunc {
+	return RequireAdminFunc(func(context.Context) []string { return admins })
+}
+
+// RequireAdminFunc is RequireAdmin with the admins looked up for every
+// request.
+func RequireAdminFunc(admins func(ctx context.Context) []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner := Owner(c)
+		switch {
+		case owner == "":
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		case !slices.Contains(admins(c.Request.Context()), owner):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		default:
+			c.Next()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(APIKey(map[string]string{"s3cret": "alice"}))
+	r.GET("/whoami", func(c *gin.Context) { c.String(http.StatusOK, Owner(c)) })
+	return r
+}
+
+func TestAPIKey(t *testing.T) {
+	r := newAuthRouter()
+
+	testCases := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+		owner  string
+	}{
+		{"anonymous", "", "", http.StatusOK, ""},
+		{"bearer", "Authorization", "Bearer s3cret", http.StatusOK, "alice"},
+		{"bearer lowercase", "Authorization", "bearer s3cret", http.StatusOK, "alice"},
+		{"x-api-key", "X-API-Key", "s3cret", http.StatusOK, "alice"},
+		{"unknown key", "Authorization", "Bearer nope", http.StatusUnauthorized, ""},
+		{"other scheme", "Authorization", "Basic s3cret", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.code, w.Code)
+		}
+		if tc.code == http.StatusOK && w.Body.String() != tc.owner {
+			t.Errorf("%s: expected owner %q, got %q", tc.name, tc.owner, w.Body.String())
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(APIKey(map[string]string{"root-key": "root", "alice-key": "alice"}))
+	r.GET("/admin", RequireAdmin([]string{"root"}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	testCases := []struct {
+		name string
+		key  string
+		code int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"non-admin", "alice-key", http.StatusForbidden},
+		{"admin", "root-key", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.code, w.Code)
+		}
+	}
+}
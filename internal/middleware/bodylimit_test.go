@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/shorten", BodyLimit(10), func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); TooLarge(err) {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		length int64
+		want   int
+	}{
+		{"small", "0123456789", 10, http.StatusCreated},
+		{"declared too large", "0123456789a", 11, http.StatusRequestEntityTooLarge},
+		{"read too large", "0123456789a", -1, http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tc.body))
+		req.ContentLength = tc.length
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.want, w.Code)
+		}
+	}
+}
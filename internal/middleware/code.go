@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"urlshortener/urlshortener/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidCode answers 404 for a :code no short link can have, such as
+// favicon.png or a long probe, before it costs a lookup. The "+" suffix that
+// asks for a link's preview is allowed.
+func ValidCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !util.ValidCode(strings.TrimSuffix(c.Param("code"), "+")) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Next()
+	}
+}
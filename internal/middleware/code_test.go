@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/:code", ValidCode(), func(c *gin.Context) { c.Status(http.StatusFound) })
+
+	for path, want := range map[string]int{
+		"/AbC-12_x":                   http.StatusFound,
+		"/AbC123+":                    http.StatusFound,
+		"/favicon.png":                http.StatusNotFound,
+		"/" + strings.Repeat("a", 65): http.StatusNotFound,
+		"/a'%20OR%201=1":              http.StatusNotFound,
+		"/+":                          http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(cfg config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORS(cfg))
+	r.POST("/shorten", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return r
+}
+
+func corsConfig() config.Config {
+	return config.Config{
+		CORSAllowedOrigins: []string{"https://app.example.com", "https://*.shawt.ly"},
+		CORSAllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		CORSAllowedHeaders: []string{"Content-Type"},
+		CORSMaxAge:         10 * time.Minute,
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	r := newCORSRouter(corsConfig())
+
+	req := httptest.NewRequest(http.MethodOptions, "/shorten", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("unexpected Allow-Origin %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, OPTIONS" {
+		t.Errorf("unexpected Allow-Methods %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type" {
+		t.Errorf("unexpected Allow-Headers %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("unexpected Max-Age %q", got)
+	}
+}
+
+func TestCORS_SimpleRequest(t *testing.T) {
+	r := newCORSRouter(corsConfig())
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", nil)
+	req.Header.Set("Origin", "https://links.shawt.ly")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://links.shawt.ly" {
+		t.Errorf("unexpected Allow-Origin %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("did not expect Allow-Credentials, got %q", got)
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	r := newCORSRouter(corsConfig())
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("did not expect Allow-Origin, got %q", got)
+	}
+}
+
+func TestCORS_Wildcard(t *testing.T) {
+	cfg := corsConfig()
+	cfg.CORSAllowedOrigins = []string{"*"}
+
+	req := httptest.NewRequest(http.MethodPost, "/shorten", nil)
+	req.Header.Set("Origin", "https://any.example.net")
+
+	w := httptest.NewRecorder()
+	newCORSRouter(cfg).ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected '*', got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("did not expect Allow-Credentials, got %q", got)
+	}
+}
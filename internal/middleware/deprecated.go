@@ -0,0 +1,14 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// Deprecated marks responses from a route that is kept only for existing
+// clients, pointing them at successor, the path that replaces it.
+func Deprecated(successor string) gin.HandlerFunc {
+	link := "<" + successor + `>; rel="successor-version"`
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", link)
+		c.Next()
+	}
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLen = 255
+
+// replayedHeaders are the response headers stored with an idempotent response.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency makes requests carrying an "Idempotency-Key" header safe to
+// retry. The first request with a key runs normally and its response is
+// stored; later requests with the same key and owner get that response
+// replayed, marked with "Idempotent-Replayed: true". Reusing a key for a
+// different request is rejected with 422, and retrying while the first
+// request is still running with 409. Server errors are not stored, so they
+// can be retried. Must run after APIKey so keys are scoped per owner.
+func Idempotency(store repo.IdempotencyRepo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if TooLarge(err) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Could not read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		owner := Owner(c)
+		hash := requestHash(c.Request, body)
+
+		prev, reserved, err := store.ReserveIdempotencyKey(ctx, owner, key, hash)
+		if err != nil {
+			// Storage errors are logged, not shown; the ID finds the log line.
+			id := RequestIDOf(c)
+			log.Printf("idempotency: reserving %q [%s]: %v", key, id, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error", "request_id": id})
+			return
+		}
+		if !reserved {
+			replay(c, prev, hash)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		c.Next()
+
+		if rec.Status() >= http.StatusInternalServerError {
+			if err := store.ReleaseIdempotencyKey(ctx, owner, key); err != nil {
+				log.Printf("idempotency: releasing %q: %v", key, err)
+			}
+			return
+		}
+
+		resp := model.IdempotentResponse{Status: rec.Status(), Header: make(map[string]string), Body: rec.body.Bytes()}
+		for _, h := range replayedHeaders {
+			if v := rec.Header().Get(h); v != "" {
+				resp.Header[h] = v
+			}
+		}
+		if err := store.SaveIdempotentResponse(ctx, owner, key, resp); err != nil {
+			log.Printf("idempotency: saving %q: %v", key, err)
+		}
+	}
+}
+
+func replay(c *gin.Context, prev model.IdempotentResponse, hash string) {
+	switch {
+	case prev.RequestHash != hash:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was used for a different request"})
+	case prev.Status == 0:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+	default:
+		for h, v := range prev.Header {
+			c.Header(h, v)
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Status(prev.Status)
+		c.Writer.Write(prev.Body)
+		c.Abort()
+	}
+}
+
+// requestHash fingerprints everything that decides a request's outcome
+// besides the caller, who is already part of the key. Accept is part of it
+// as some responses come in the format it asks for.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{r.Method, r.Host, r.URL.RequestURI(), r.Header.Get("Content-Type"), r.Header.Get("Accept")} {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder copies the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"urlshortener/urlshortener/internal/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	fail := false
+	r := gin.New()
+	r.Use(APIKey(map[string]string{"s3cret": "alice"}), Idempotency(repo.NewMemory()))
+	r.POST("/shorten", func(c *gin.Context) {
+		calls++
+		if fail {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "boom"})
+			return
+		}
+		c.Header("ETag", `"v1"`)
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+
+	post := func(key, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("k1", "", `{"url":"https://example.com/"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d", http.StatusCreated, first.Code)
+	}
+
+	again := post("k1", "", `{"url":"https://example.com/"}`)
+	if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() {
+		t.Errorf("expected replay of %d %s, got %d %s", first.Code, first.Body, again.Code, again.Body)
+	}
+	if again.Header().Get("Idempotent-Replayed") != "true" || again.Header().Get("ETag") != `"v1"` {
+		t.Errorf("expected replayed headers, got %v", again.Header())
+	}
+	if calls != 1 {
+		t.Errorf("expected handler to run once, ran %d times", calls)
+	}
+
+	if w := post("k1", "", `{"url":"https://example.com/other"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	// A replay in another format than asked for would confuse the client.
+	req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url":"https://example.com/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/plain")
+	req.Header.Set("Idempotency-Key", "k1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different Accept: expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	// Keys are scoped per owner.
+	if w := post("k1", "s3cret", `{"url":"https://example.com/"}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("other owner: expected a fresh request, got %d after %d calls", w.Code, calls)
+	}
+
+	// Server errors are not stored, so the retry runs again.
+	fail = true
+	post("k2", "", `{}`)
+	fail = false
+	if w := post("k2", "", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected retry after a 500 to run, got %d %v", w.Code, w.Header())
+	}
+
+	if w := post(strings.Repeat("x", 256), "", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long key: expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit lets each client address make limit() requests per window,
+// counted in fixed windows, and answers the rest with 429 and Retry-After.
+// limit is read on each request, so it may follow a reloaded configuration.
+// Counts are kept per instance. A limit of zero or less lets every request
+// through.
+func RateLimit(limit func() int, window time.Duration) gin.HandlerFunc {
+	l := &windowLimiter{window: window, counts: make(map[string]int)}
+	return func(c *gin.Context) {
+		n := limit()
+		if n <= 0 {
+			c.Next()
+			return
+		}
+		if wait, ok := l.allow(c.ClientIP(), n, time.Now()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+type windowLimiter struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+// allow counts a request by key at now, reporting how long until the
+// window ends when it is over the limit of n.
+func (l *windowLimiter) allow(key string, n int, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.start) >= l.window {
+		// Dropping every count at once keeps the map to one window's clients.
+		l.start = now.Truncate(l.window)
+		clear(l.counts)
+	}
+	if l.counts[key] >= n {
+		return l.start.Add(l.window).Sub(now), false
+	}
+	l.counts[key]++
+	return 0, true
+}
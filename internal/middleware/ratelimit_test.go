@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limit := 2
+	r.POST("/report", RateLimit(func() int { return limit }, time.Hour), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	do := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/report", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for i := range 2 {
+		if w := do("203.0.113.1:1234"); w.Code != http.StatusCreated {
+			t.Fatalf("request %d: expected %d, got %d", i+1, http.StatusCreated, w.Code)
+		}
+	}
+	w := do("203.0.113.1:5678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("over the limit: expected %d with Retry-After, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w := do("203.0.113.2:1234"); w.Code != http.StatusCreated {
+		t.Errorf("another client: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	// A raised limit applies to the current window.
+	limit = 3
+	if w := do("203.0.113.1:1234"); w.Code != http.StatusCreated {
+		t.Errorf("raised limit: expected %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestWindowLimiter(t *testing.T) {
+	l := &windowLimiter{window: time.Minute, counts: make(map[string]int)}
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	if _, ok := l.allow("a", 1, now); !ok {
+		t.Fatal("expected the first request allowed")
+	}
+	if wait, ok := l.allow("a", 1, now); ok || wait != 30*time.Second {
+		t.Errorf("expected the second refused until the minute is up, got %v, %s", ok, wait)
+	}
+	if _, ok := l.allow("a", 1, now.Add(30*time.Second)); !ok {
+		t.Error("expected a new window to allow requests again")
+	}
+}
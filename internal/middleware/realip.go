@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RealIP replaces the request's remote address with the client's, as
+// reported in header by the trusted proxies in front of the server, so that
+// c.ClientIP and the access log see the client rather than the last proxy.
+// Requests from other peers keep their address: only a trusted proxy may
+// speak for someone else.
+//
+// header is "Forwarded" (RFC 7239), or one such as X-Forwarded-For or
+// X-Real-IP holding comma-separated addresses. Its addresses are walked from
+// the nearest hop outwards, and the first one not of a trusted proxy is the
+// client, so addresses a client prepends itself are never reached.
+func RealIP(trusted []netip.Prefix, header string) gin.HandlerFunc {
+	forwarded := strings.EqualFold(header, "Forwarded")
+	return func(c *gin.Context) {
+		if ip, ok := clientIP(c.Request.RemoteAddr, c.Request.Header.Values(header), trusted, forwarded); ok {
+			c.Request.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+		}
+		c.Next()
+	}
+}
+
+// clientIP returns the client address behind remoteAddr, or false when
+// remoteAddr is not a trusted proxy or values name no one else.
+func clientIP(remoteAddr string, values []string, trusted []netip.Prefix, forwarded bool) (netip.Addr, bool) {
+	peer, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil || !isTrusted(peer.Addr(), trusted) {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			if forwarded {
+				hop = forwardedFor(hop)
+			}
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := parseHop(hops[i])
+		if err != nil {
+			// A hop we cannot read ends the chain; the last one we could
+			// is the best we know.
+			break
+		}
+		client = ip
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// forwardedFor returns the for= parameter of one Forwarded element.
+func forwardedFor(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if strings.EqualFold(key, "for") {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// parseHop reads an address with or without a port, IPv6 ones in brackets.
+func parseHop(hop string) (netip.Addr, error) {
+	if ap, err := netip.ParseAddrPort(hop); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	return ip.Unmap(), err
+}
+
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	ip = ip.Unmap()
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRealIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name   string
+		header string
+		remote string
+		values []string
+		want   string
+	}{
+		{"untrusted peer", "X-Forwarded-For", "203.0.113.9:1234", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"trusted peer", "X-Forwarded-For", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hops are skipped", "X-Forwarded-For", "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"repeated headers", "X-Forwarded-For", "10.0.0.1:1234", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"all hops trusted", "X-Forwarded-For", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"unreadable hop", "X-Forwarded-For", "10.0.0.1:1234", []string{"198.51.100.1, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"no header", "X-Forwarded-For", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"single value header", "X-Real-IP", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"forwarded", "Forwarded", "10.0.0.1:1234", []string{`for=198.51.100.1;proto=https, for="[2001:db8::1]:4711"`}, "198.51.100.1"},
+		{"forwarded obfuscated", "Forwarded", "10.0.0.1:1234", []string{"for=_hidden, for=10.0.0.2"}, "10.0.0.2"},
+		{"ipv6 peer", "X-Forwarded-For", "[2001:db8::1]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			r := gin.New()
+			r.SetTrustedProxies(nil)
+			r.GET("/", RealIP(trusted, tt.header), func(c *gin.Context) { got = c.ClientIP() })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.values {
+				req.Header.Add(tt.header, v)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("expected client %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
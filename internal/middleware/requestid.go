@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDKey = "request_id"
+
+// validRequestID bounds the X-Request-ID a client or proxy may pass in, so
+// it is safe to echo and log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags every request with an ID, taken from X-Request-ID when the
+// caller sent a sane one and random otherwise, and returns it in the
+// X-Request-ID response header. Server-side logs carry the same ID, so an
+// error a client reports can be found.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// RequestIDOf returns the ID RequestID gave the request, or "" without it.
+func RequestIDOf(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var seen string
+	r := gin.New()
+	r.GET("/", RequestID(), func(c *gin.Context) { seen = RequestIDOf(c) })
+
+	do := func(header string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("X-Request-ID", header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get("X-Request-ID"); got != seen {
+			t.Errorf("expected X-Request-ID %q, got %q", seen, got)
+		}
+		return seen
+	}
+
+	if id := do(""); len(id) != 16 {
+		t.Errorf("expected a generated ID, got %q", id)
+	}
+	if id := do("edge-4f2a.1"); id != "edge-4f2a.1" {
+		t.Errorf("expected the caller's ID to be kept, got %q", id)
+	}
+	if id := do("bad id\r\n"); id == "bad id\r\n" || len(id) != 16 {
+		t.Errorf("expected an unsafe ID to be replaced, got %q", id)
+	}
+}
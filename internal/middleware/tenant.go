@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"urlshortener/urlshortener/internal/config"
+	"urlshortener/urlshortener/internal/repo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant resolves the tenant of each request from its Host. The request
+// context then carries the tenant's view of the configuration, as returned
+// by Live.For, and scopes every link query to the tenant's links. Requests to
+// other hosts belong to the default tenant.
+func Tenant(live *config.Live) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := live.Get()
+		ctx := c.Request.Context()
+		if t, ok := cfg.TenantFor(c.Request.Host); ok {
+			view := cfg.ForTenant(t)
+			ctx = repo.WithTenant(config.NewContext(ctx, &view), t.ID)
+		} else {
+			ctx = repo.WithTenant(ctx, "")
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// AllTenants lifts the tenant scope for the rest of the chain, for
+// operators who manage every tenant's links.
+func AllTenants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(repo.AllTenants(c.Request.Context()))
+		c.Next()
+	}
+}
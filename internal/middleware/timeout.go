@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout gives each request d to finish, after which the database calls
+// and outgoing requests it makes fail with context.DeadlineExceeded instead
+// of waiting on a slow backend while requests pile up. Routes whose full
+// path is in except, such as streaming exports, run without a deadline. A d
+// of zero or less disables the timeout.
+func Timeout(d time.Duration, except ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d <= 0 || slices.Contains(except, c.FullPath()) {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// Unbounded lifts the server's read and write deadlines for the request, for
+// routes that stream for as long as the client keeps up, such as exports
+// and imports. Connections without deadlines are unaffected.
+func Unbounded() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rc := http.NewResponseController(c.Writer)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Timeout(time.Minute, "/export"))
+	deadline := func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			c.Status(http.StatusOK)
+		} else {
+			c.Status(http.StatusNoContent)
+		}
+	}
+	r.GET("/links", deadline)
+	r.GET("/export", deadline)
+
+	for path, want := range map[string]int{"/links": http.StatusOK, "/export": http.StatusNoContent} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestUnbounded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	slow := func(c *gin.Context) {
+		time.Sleep(150 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	}
+	r.GET("/links", slow)
+	r.GET("/export", Unbounded(), slow)
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL + "/links"); err == nil {
+		resp.Body.Close()
+		t.Errorf("Expected the write deadline to cut off a slow response, got %d", resp.StatusCode)
+	}
+	resp, err := http.Get(srv.URL + "/export")
+	if err != nil {
+		t.Fatalf("Expected the export to outlive the write deadline, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// Without a connection to lift deadlines on, requests pass through.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 from a recorder, got %d", w.Code)
+	}
+}
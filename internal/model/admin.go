@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Stats are service-wide totals for operators.
+type Stats struct {
+	Links    int `json:"links"`
+	Active   int `json:"active"`
+	Disabled int `json:"disabled"`
+	Flagged  int `json:"flagged"`
+	Expired  int `json:"expired"`
+	Clicks   int `json:"clicks"`
+	// Codes is reported when code lengths adapt to collisions.
+	Codes *CodeStats `json:"codes,omitempty"`
+}
+
+// CodeStats describe code generation since the server started.
+type CodeStats struct {
+	// Length is the length of codes made now.
+	Length        int     `json:"length"`
+	Attempts      int64   `json:"attempts"`
+	Collisions    int64   `json:"collisions"`
+	CollisionRate float64 `json:"collision_rate"`
+}
+
+// BannedDomain is a destination host no new link may point to.
+type BannedDomain struct {
+	Domain    string    `json:"domain"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BanReq struct {
+	Reason string `json:"reason,omitempty"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Audit actions besides the link events, which are recorded under their
+// event names.
+const (
+	AuditDomainBanned   = "domain.banned"
+	AuditDomainUnbanned = "domain.unbanned"
+	AuditLinkImported   = "link.imported"
+	AuditClicksPurged   = "clicks.purged"
+	AuditTakedownLifted = "takedown.lifted"
+	AuditReportRejected = "report.rejected"
+	AuditReviewApproved = "review.approved"
+	AuditReviewRejected = "review.rejected"
+)
+
+// AuditEntry records one change: who made it, to what, and for links the
+// record as it was before and after.
+type AuditEntry struct {
+	ID     int64  `json:"id"`
+	Action string `json:"action"`
+	// Actor is the API key owner who made the change; it is empty for
+	// anonymous callers and for changes made by the server itself.
+	Actor string `json:"actor"`
+	// Subject is the link code, banned domain or erased owner acted on.
+	Subject   string     `json:"subject"`
+	Before    *URLRecord `json:"before,omitempty"`
+	After     *URLRecord `json:"after,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AuditFilter narrows an audit log listing; empty fields match everything.
+type AuditFilter struct {
+	Actor   string
+	Subject string
+	Action  string
+}
+
+// AuditPage is one page of the audit log.
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// ClickEvent is a single redirect, kept raw for analytics.
+type ClickEvent struct {
+	Code      string    `json:"code"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	// IPHash is a salted hash of the client's network, never the address itself.
+	IPHash    string `json:"ip_hash,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Country   string `json:"country,omitempty"`
+	// Region is the ISO 3166-2 subdivision code without the country prefix,
+	// known only when clicks are located with a GeoIP database.
+	Region string `json:"region,omitempty"`
+}
+
+// DailyClicks is one UTC day of a link's clicks.
+type DailyClicks struct {
+	Day    string `json:"day"` // YYYY-MM-DD
+	Clicks int    `json:"clicks"`
+}
+
+// DailyStats is a link's click time series from From to To, both inclusive,
+// with one entry per day.
+type DailyStats struct {
+	Code string        `json:"code"`
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Days []DailyClicks `json:"days"`
+}
+
+// Click breakdowns, each grouping clicks by one click event field.
+const (
+	BreakdownCountry   = "country"
+	BreakdownReferrer  = "referrer"
+	BreakdownUserAgent = "user_agent"
+)
+
+// ClickCount is how many clicks share one value of a breakdown.
+type ClickCount struct {
+	Value  string `json:"value"`
+	Clicks int    `json:"clicks"`
+}
+
+// ClickBreakdown is a link's clicks from From to To, both inclusive, grouped
+// by one click field, most clicked first. An empty Value collects the clicks
+// whose field is unknown.
+type ClickBreakdown struct {
+	Code  string       `json:"code"`
+	From  string       `json:"from"`
+	To    string       `json:"to"`
+	Items []ClickCount `json:"items"`
+}
+
+// BrowserStats is a link's clicks from From to To, both inclusive, by
+// browser family and by operating system, most clicked first.
+type BrowserStats struct {
+	Code     string       `json:"code"`
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Browsers []ClickCount `json:"browsers"`
+	OS       []ClickCount `json:"os"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Erasure reports what erasing an owner's data removed.
+type Erasure struct {
+	Owner string `json:"owner"`
+	// By is who asked for the erasure: the owner themselves or an admin.
+	By       string    `json:"by"`
+	Links    int       `json:"links"`
+	Clicks   int       `json:"clicks"`
+	ErasedAt time.Time `json:"erased_at"`
+}
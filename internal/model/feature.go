@@ -0,0 +1,18 @@
+package model
+
+// FeatureFlag turns a feature on for some owners: those listed in Owners,
+// plus Percent percent of the rest.
+type FeatureFlag struct {
+	Name    string   `json:"name"`
+	Percent int      `json:"percent"`
+	Owners  []string `json:"owners,omitempty"`
+	// Source is "config" for flags from FEATURE_FLAGS and "admin" for flags
+	// set through the API, which take precedence.
+	Source string `json:"source"`
+}
+
+// FeatureFlagReq is the body of PUT /admin/flags/:name.
+type FeatureFlagReq struct {
+	Percent int      `json:"percent"`
+	Owners  []string `json:"owners"`
+}
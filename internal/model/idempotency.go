@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotentResponse is the stored outcome of a request sent with an
+// Idempotency-Key. Status is 0 while the original request is still running.
+type IdempotentResponse struct {
+	RequestHash string
+	Status      int
+	// Header holds the response headers worth replaying, e.g. Content-Type and ETag.
+	Header    map[string]string
+	Body      []byte
+	CreatedAt time.Time
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// ImportLink is one link of an export from another shortener.
+type ImportLink struct {
+	Code    string `json:"code"`
+	LongURL string `json:"long_url"`
+	// CreatedAt is kept when given; otherwise the import time is used.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+type ImportReq struct {
+	// Owner receives the imported links; empty makes them anonymous.
+	Owner string `json:"owner,omitempty"`
+	// Domain is the short domain the codes live on, empty for BASE_URL's.
+	Domain string       `json:"domain,omitempty"`
+	Links  []ImportLink `json:"links" binding:"required"`
+}
+
+// ImportConflict explains why one link of an import was skipped.
+type ImportConflict struct {
+	// Row is the link's position in the request, counting from 0.
+	Row    int    `json:"row"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+type ImportResult struct {
+	Imported  int              `json:"imported"`
+	Conflicts []ImportConflict `json:"conflicts"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// JobStatus describes a scheduled background job and how its runs on this
+// instance went.
+type JobStatus struct {
+	Name string `json:"name"`
+	// Schedule is the cron expression the job runs on.
+	Schedule string `json:"schedule"`
+	// Shared jobs work on data the whole fleet shares and run on one
+	// instance at a time; the others run on every instance.
+	Shared  bool       `json:"shared"`
+	Running bool       `json:"running"`
+	NextRun time.Time  `json:"next_run"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+	// LastDuration is how long the last run took, in seconds.
+	LastDuration float64 `json:"last_duration"`
+	LastError    string  `json:"last_error,omitempty"`
+	// Runs counts the runs this instance made, Failures those that failed.
+	// Scheduled runs another instance took count on that one.
+	Runs     int64 `json:"runs"`
+	Failures int64 `json:"failures"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// LinkCheck is the outcome of requesting a link's destination, to tell
+// live destinations from dead ones.
+type LinkCheck struct {
+	Code string `json:"-"`
+	// Status is the HTTP status the destination answered with, after
+	// redirects; zero when it could not be reached.
+	Status int `json:"status,omitempty"`
+	// Error says why the destination could not be reached.
+	Error     string    `json:"error,omitempty"`
+	Dead      bool      `json:"dead"`
+	CheckedAt time.Time `json:"checked_at"`
+}
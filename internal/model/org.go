@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// Member roles. Admins manage an organization's members; every member can
+// create and manage its links.
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Org is an organization whose members share a link namespace.
+type Org struct {
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgMember is an API key owner's membership in an organization.
+type OrgMember struct {
+	Owner     string    `json:"owner"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgDetail is an organization with its members.
+type OrgDetail struct {
+	Org
+	Members []OrgMember `json:"members"`
+}
+
+type OrgList struct {
+	Orgs []Org `json:"orgs"`
+}
+
+type OrgReq struct {
+	Slug string `json:"slug" binding:"required"`
+	Name string `json:"name,omitempty"`
+}
+
+type MemberReq struct {
+	// Role defaults to RoleMember.
+	Role string `json:"role,omitempty"`
+}
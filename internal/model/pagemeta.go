@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// PageMeta is what a link's destination page says about itself, fetched
+// in the background for list views and the preview page.
+type PageMeta struct {
+	Code        string `json:"-"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	// Image is the page's og:image and Favicon its icon, as absolute URLs.
+	Image     string    `json:"image,omitempty"`
+	Favicon   string    `json:"favicon,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// Quota limits one owner's usage. Zero fields are unlimited.
+type Quota struct {
+	// LinksPerDay caps new links per UTC day.
+	LinksPerDay int `json:"links_per_day"`
+	// LinksTotal caps the links an owner has at once; deleting links frees
+	// room.
+	LinksTotal int `json:"links_total"`
+	// ClicksPerMonth caps the clicks recorded on an owner's links per UTC
+	// calendar month. Further clicks still redirect but are not recorded.
+	ClicksPerMonth int `json:"clicks_per_month"`
+}
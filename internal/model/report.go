@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// Abuse report states.
+const (
+	ReportPending  = "pending"
+	ReportApproved = "approved"
+	ReportRejected = "rejected"
+)
+
+// ReportReasons lists what a link may be reported for: the takedown
+// reasons, spam and anything else.
+var ReportReasons = []string{TakedownPhishing, TakedownMalware, TakedownDMCA, "spam", "other"}
+
+// AbuseReport is a complaint about a link, waiting in the review queue
+// until an operator approves it, taking the link down, or rejects it.
+type AbuseReport struct {
+	ID      int64  `json:"id"`
+	Code    string `json:"code"`
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+	// Contact is how the reporter asked to be reached, if at all.
+	Contact    string     `json:"contact,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
+
+type ReportReq struct {
+	// URL is the short link reported, or just its code.
+	URL     string `json:"url" binding:"required"`
+	Reason  string `json:"reason" binding:"required"`
+	Details string `json:"details,omitempty"`
+	Contact string `json:"contact,omitempty"`
+	// CaptchaToken is the captcha widget's response, required when the
+	// deployment sets CAPTCHA_PROVIDER.
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+// ApproveReq overrides the reason and note of the takedown approving a
+// report makes.
+type ApproveReq struct {
+	// Reason defaults to the report's, which must then be a takedown reason.
+	Reason string `json:"reason,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// ReportPage is one page of the review queue.
+type ReportPage struct {
+	Reports []AbuseReport `json:"reports"`
+	Status  string        `json:"status,omitempty"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Review holds a new link to a domain of poor reputation until an operator
+// approves it. Meanwhile the link is disabled and its owner cannot enable
+// it.
+type Review struct {
+	Code  string `json:"code"`
+	Owner string `json:"owner,omitempty"`
+	// Domain is the destination host that was scored.
+	Domain    string    `json:"domain"`
+	Score     int       `json:"score"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReviewPage is one page of the links held for review.
+type ReviewPage struct {
+	Reviews []Review `json:"reviews"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Reasons an operator takes a link down for.
+const (
+	TakedownPhishing = "phishing"
+	TakedownMalware  = "malware"
+	// TakedownDMCA is a copyright complaint; the link answers 451
+	// Unavailable For Legal Reasons rather than 410.
+	TakedownDMCA = "dmca"
+)
+
+// TakedownReasons lists the reasons a takedown may give.
+var TakedownReasons = []string{TakedownPhishing, TakedownMalware, TakedownDMCA}
+
+// Takedown records an operator disabling a link for abuse. Its owner cannot
+// enable the link again until the takedown is lifted.
+type Takedown struct {
+	Code   string `json:"code"`
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason"`
+	// Note is shown to visitors of the link besides the reason, e.g. who
+	// filed the complaint.
+	Note string `json:"note,omitempty"`
+	// By is the operator who took the link down.
+	By        string    `json:"by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TakedownReq struct {
+	Reason string `json:"reason" binding:"required"`
+	Note   string `json:"note,omitempty"`
+}
@@ -3,13 +3,119 @@ package model
 import "time"
 
 type URLRecord struct {
-	ID        string    `json:"id"`
-	Code      string    `json:"code"`
-	LongUrl   string    `json:"long_url"`
-	ShortUrl  string    `json:"short_url"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         string     `json:"id"`
+	Code       string     `json:"code"`
+	LongUrl    string     `json:"long_url"`
+	ShortUrl   string     `json:"short_url"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ScanStatus string     `json:"scan_status"`
+	ScannedAt  *time.Time `json:"scanned_at,omitempty"`
+	// UTM holds campaign parameters appended to LongUrl on redirect.
+	UTM map[string]string `json:"utm,omitempty"`
+	// Owner is the API key owner that created the link, empty for anonymous links.
+	Owner     string    `json:"owner,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Active is false for disabled links, which answer 410 instead of redirecting.
+	Active bool `json:"active"`
+	// Domain is the short domain the link lives on, empty for the BASE_URL domain.
+	Domain string `json:"domain,omitempty"`
+	// ExpiresAt is when the link stops redirecting, nil for links that never expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Title and Description are free-form notes for the link's owner.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Org is the organization whose members share the link, if any.
+	Org string `json:"org,omitempty"`
+	// OriginalURL is the destination as submitted, kept when tracking
+	// parameters were stripped from it to make LongUrl.
+	OriginalURL string `json:"original_url,omitempty"`
+	// Unique links were minted even though their destination may already
+	// have a link, and are never handed out for it again.
+	Unique bool `json:"unique,omitempty"`
+	// MaxClicks, when positive, is the number of redirects after which the
+	// link disables itself; ClickCount counts them.
+	MaxClicks  int   `json:"max_clicks,omitempty"`
+	ClickCount int64 `json:"click_count,omitempty"`
+	// FallbackURL is where visitors go once the link is disabled, expired
+	// or out of clicks, instead of getting an error page.
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// Tenant is the tenant the link belongs to, empty for the default one.
+	// Callers only ever see their own tenant's links.
+	Tenant string `json:"-"`
+	// Liveness is the latest check of the destination, when destinations
+	// are checked. It is filled in for the link's owner, not stored.
+	Liveness *LinkCheck `json:"liveness,omitempty"`
+	// Meta is what the destination page says about itself, once fetched.
+	// Like Liveness it is filled in for the owner, not stored.
+	Meta *PageMeta `json:"meta,omitempty"`
+}
+
+// Exhausted reports whether the link has used up its clicks.
+func (r URLRecord) Exhausted() bool {
+	return r.MaxClicks > 0 && r.ClickCount >= int64(r.MaxClicks)
+}
+
+// Expired reports whether the link's expiry has passed at now.
+func (r URLRecord) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// LinkPage is one page of a link listing.
+type LinkPage struct {
+	Links []URLRecord `json:"links"`
+	// Query is the search term the links were filtered by, if any.
+	Query  string `json:"query,omitempty"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// ExportLink is one line of a data export.
+type ExportLink struct {
+	URLRecord
+	// Clicks is the link's click total, present when stats were requested
+	// and click events are recorded.
+	Clicks *int `json:"clicks,omitempty"`
 }
 
 type CreateReq struct {
-	URL string `json:"url" binding:"required"`
+	URL string            `json:"url" form:"url" binding:"required"`
+	UTM map[string]string `json:"utm,omitempty" form:"-"`
+	// Domain selects one of the configured short domains; by default the
+	// request's Host decides.
+	Domain string `json:"domain,omitempty" form:"domain"`
+	// ExpiresAt, when set, must lie in the future.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" form:"expires_at"`
+	// Title defaults to the destination page's <title> when title fetching
+	// is enabled.
+	Title       string `json:"title,omitempty" form:"title"`
+	Description string `json:"description,omitempty" form:"description"`
+	// Org creates the link in one of the caller's organizations.
+	Org string `json:"org,omitempty" form:"org"`
+	// StripTracking overrides whether utm_*, fbclid and gclid parameters
+	// are removed from URL before it is stored.
+	StripTracking *bool `json:"strip_tracking,omitempty" form:"strip_tracking"`
+	// Unique always mints a new link, even for a destination that already
+	// has one. The server must allow unique links.
+	Unique bool `json:"unique,omitempty" form:"unique"`
+	// MaxClicks disables the link after that many redirects.
+	MaxClicks int `json:"max_clicks,omitempty" form:"max_clicks"`
+	// OneTime links burn after their first redirect, like MaxClicks 1.
+	OneTime bool `json:"one_time,omitempty" form:"one_time"`
+	// FallbackURL receives visitors once the link stops redirecting.
+	FallbackURL string `json:"fallback_url,omitempty" form:"fallback_url"`
+	// CaptchaToken is the captcha widget's response, required from callers
+	// without an API key when the deployment sets CAPTCHA_SHORTEN.
+	CaptchaToken string `json:"captcha_token,omitempty" form:"captcha_token"`
+}
+
+// UpdateReq edits a link; fields left out keep their current value and an
+// empty string clears title or description.
+type UpdateReq struct {
+	URL         string  `json:"url,omitempty"`
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// FallbackURL replaces the fallback page; an empty string removes it.
+	FallbackURL *string `json:"fallback_url,omitempty"`
+	// UpdatedAt, when set, must match the link's current updated_at.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// Webhook event types.
+const (
+	EventLinkCreated  = "link.created"
+	EventLinkUpdated  = "link.updated"
+	EventLinkDisabled = "link.disabled"
+	EventLinkEnabled  = "link.enabled"
+	EventLinkDeleted  = "link.deleted"
+	// EventLinkTakenDown carries a Takedown rather than the link.
+	EventLinkTakenDown = "link.taken_down"
+	// EventLinkHeld carries the Review of a new link held back for its
+	// destination's reputation.
+	EventLinkHeld = "link.held"
+	// EventReportCreated carries an AbuseReport waiting for review.
+	EventReportCreated = "report.created"
+	EventClicks        = "clicks"
+	EventUserErased    = "user.erased"
+)
+
+// Webhook delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEvent is the JSON body POSTed to webhook endpoints.
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// WebhookDelivery tracks one event's delivery to one endpoint.
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	Endpoint       string     `json:"endpoint"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,224 @@
+// Package openapi describes the HTTP API as an OpenAPI 3 document.
+//
+// The document is generated from the server's registered routes and the
+// model types they exchange, then embedded at build time; run go generate
+// after changing a route or a request or response type.
+package openapi
+
+//go:generate go run ../../cmd/openapi -o openapi.json
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spec is the generated document served at /openapi.json.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Version is the info.version of the document.
+const Version = "1.0.0"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps lower-case HTTP methods to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Schema *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Route is a registered method and path, in gin's :param syntax.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// ignored routes are served by the API but are not part of it.
+var ignored = map[string]bool{
+	"GET /":             true,
+	"GET /favicon.ico":  true,
+	"GET /robots.txt":   true,
+	"GET /openapi.json": true,
+	"GET /docs":         true,
+	"GET /metrics":      true,
+	// These only answer 405, since GET on them would reach /{code}.
+	"GET /report":  true,
+	"GET /shorten": true,
+}
+
+// Build describes routes. Every route except HEAD duplicates and the
+// ignored ones must have an entry in operations, so a new endpoint cannot
+// ship undocumented.
+func Build(routes []Route) (*Document, error) {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: "shawty", Version: Version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer"},
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+	gen := &generator{schemas: doc.Components.Schemas}
+
+	var missing []string
+	for _, r := range routes {
+		path, params := convertPath(r.Path)
+		key := r.Method + " " + path
+		if r.Method == http.MethodHead || ignored[key] {
+			continue
+		}
+		op, ok := operations[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = gen.operation(op, params)
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("openapi: undocumented routes: %s", strings.Join(missing, ", "))
+	}
+	return doc, nil
+}
+
+// convertPath turns /links/:code into /links/{code} and returns the names
+// of its path parameters.
+func convertPath(path string) (string, []string) {
+	var params []string
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") || strings.HasPrefix(p, "*") {
+			params = append(params, p[1:])
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func (g *generator) operation(op op, pathParams []string) *Operation {
+	o := &Operation{
+		Summary:    op.summary,
+		Tags:       []string{op.tag},
+		Responses:  map[string]Response{},
+		Deprecated: op.deprecated,
+	}
+	if op.auth {
+		o.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+	}
+	for _, p := range pathParams {
+		o.Parameters = append(o.Parameters, Parameter{Name: p, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, q := range op.query {
+		o.Parameters = append(o.Parameters, Parameter{Name: q, In: "query", Schema: querySchema(q)})
+	}
+	for _, h := range op.headers {
+		o.Parameters = append(o.Parameters, Parameter{Name: h, In: "header", Schema: &Schema{Type: "string"}})
+	}
+	if op.body != nil {
+		o.RequestBody = &RequestBody{
+			Required: !op.optionalBody,
+			Content:  map[string]MediaType{"application/json": {Schema: g.schemaFor(op.body)}},
+		}
+		if op.plain {
+			o.RequestBody.Content["application/x-www-form-urlencoded"] = MediaType{Schema: g.schemaFor(op.body)}
+			o.RequestBody.Content["text/plain"] = MediaType{Schema: &Schema{Type: "string", Format: "uri"}}
+		}
+	}
+	for status, body := range op.responses {
+		resp := Response{Description: http.StatusText(status)}
+		switch {
+		case status >= 300 && status < 400 && status != http.StatusNotModified:
+			resp.Headers = map[string]Header{"Location": {Schema: &Schema{Type: "string", Format: "uri"}}}
+		case body != nil:
+			mt := "application/json"
+			if status < 300 && op.mediaType != "" {
+				mt = op.mediaType
+			}
+			resp.Content = map[string]MediaType{mt: {Schema: g.schemaFor(body)}}
+			if status < 300 && op.plain {
+				resp.Content["text/plain"] = MediaType{Schema: &Schema{Type: "string", Format: "uri"}}
+			}
+		}
+		o.Responses[strconv.Itoa(status)] = resp
+	}
+	return o
+}
+
+func querySchema(name string) *Schema {
+	switch name {
+	case "limit", "offset":
+		return &Schema{Type: "integer"}
+	case "stats":
+		return &Schema{Type: "boolean"}
+	case "from", "to":
+		return &Schema{Type: "string", Format: "date"}
+	}
+	return &Schema{Type: "string"}
+}
@@ -0,0 +1,74 @@
+package openapi
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestBuild(t *testing.T) {
+	doc, err := Build([]Route{
+		{Method: "GET", Path: "/"},
+		{Method: "HEAD", Path: "/api/v1/links/:code"},
+		{Method: "GET", Path: "/api/v1/links/:code"},
+		{Method: "POST", Path: "/api/v1/shorten"},
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if _, ok := doc.Paths["/"]; ok {
+		t.Error("expected / to be left out")
+	}
+	get := doc.Paths["/api/v1/links/{code}"]["get"]
+	if get == nil || len(get.Parameters) == 0 || get.Parameters[0].Name != "code" || get.Parameters[0].In != "path" {
+		t.Fatalf("expected GET /api/v1/links/{code} with a code path parameter, got %+v", get)
+	}
+	if _, ok := doc.Paths["/api/v1/links/{code}"]["head"]; ok {
+		t.Error("expected HEAD to be left out")
+	}
+
+	post := doc.Paths["/api/v1/shorten"]["post"]
+	if ref := post.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/CreateReq" {
+		t.Errorf("expected CreateReq request body, got %q", ref)
+	}
+	if ref := post.Responses["201"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/URLRecord" {
+		t.Errorf("expected URLRecord response, got %q", ref)
+	}
+}
+
+func TestBuild_Undocumented(t *testing.T) {
+	_, err := Build([]Route{{Method: "POST", Path: "/links/:code/archive"}})
+	if err == nil || !strings.Contains(err.Error(), "POST /links/{code}/archive") {
+		t.Errorf("expected undocumented route error, got %v", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	g := &generator{schemas: map[string]*Schema{}}
+	g.schemaFor(model.CreateReq{})
+	g.schemaFor(model.URLRecord{})
+
+	req := g.schemas["CreateReq"]
+	if !slices.Equal(req.Required, []string{"url"}) {
+		t.Errorf("expected only url required, got %v", req.Required)
+	}
+	if s := req.Properties["expires_at"]; s.Type != "string" || s.Format != "date-time" || !s.Nullable {
+		t.Errorf("expected nullable date-time expires_at, got %+v", s)
+	}
+	if s := req.Properties["utm"]; s.Type != "object" || s.AdditionalProperties.Type != "string" {
+		t.Errorf("expected string map utm, got %+v", s)
+	}
+
+	rec := g.schemas["URLRecord"]
+	for _, name := range []string{"id", "code", "long_url", "short_url", "created_at", "active"} {
+		if !slices.Contains(rec.Required, name) {
+			t.Errorf("expected %s required, got %v", name, rec.Required)
+		}
+	}
+	if slices.Contains(rec.Required, "owner") {
+		t.Error("expected omitempty owner to be optional")
+	}
+}
@@ -0,0 +1,441 @@
+package openapi
+
+import (
+	"net/http"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// Error is the JSON shape of every error response. Internal errors carry the
+// request ID, which is also in the X-Request-ID header, instead of details.
+type Error struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// BanList, FlagList, JobList, GraphQLRequest and GraphQLResponse describe bodies the
+// handlers build inline.
+type BanList struct {
+	Bans []model.BannedDomain `json:"bans"`
+}
+
+type FlagList struct {
+	Flags []model.FeatureFlag `json:"flags"`
+}
+
+type JobList struct {
+	Jobs []model.JobStatus `json:"jobs"`
+}
+
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type GraphQLResponse struct {
+	Data   map[string]any   `json:"data,omitempty"`
+	Errors []map[string]any `json:"errors,omitempty"`
+}
+
+// op documents one route. responses maps each status to a value of the type
+// its body encodes, or nil for an empty body.
+type op struct {
+	summary      string
+	tag          string
+	auth         bool
+	query        []string
+	headers      []string
+	body         any
+	optionalBody bool
+	deprecated   bool
+	// plain bodies may also be form-encoded or the URL alone as text/plain,
+	// and successful responses the short URL as text/plain.
+	plain bool
+	// mediaType is the type of successful response bodies when it is not
+	// application/json.
+	mediaType string
+	responses map[int]any
+}
+
+var (
+	errResp  = Error{}
+	linkResp = model.URLRecord{}
+)
+
+// operations is keyed by "METHOD path", with path parameters in braces.
+var operations = map[string]op{
+	"POST /api/v1/shorten": {
+		summary: "Shorten a URL",
+		tag:     "links",
+		auth:    true,
+		headers: []string{"Idempotency-Key"},
+		body:    model.CreateReq{},
+		plain:   true,
+		responses: map[int]any{
+			http.StatusOK:                    linkResp,
+			http.StatusCreated:               linkResp,
+			http.StatusBadRequest:            errResp,
+			http.StatusForbidden:             errResp,
+			http.StatusConflict:              errResp,
+			http.StatusRequestEntityTooLarge: errResp,
+			http.StatusUnprocessableEntity:   errResp,
+			http.StatusTooManyRequests:       errResp,
+			http.StatusServiceUnavailable:    errResp,
+		},
+	},
+	"POST /shorten": {
+		summary:    "Shorten a URL; use /api/v1/shorten instead",
+		tag:        "links",
+		auth:       true,
+		deprecated: true,
+		headers:    []string{"Idempotency-Key"},
+		body:       model.CreateReq{},
+		plain:      true,
+		responses: map[int]any{
+			http.StatusOK:                    linkResp,
+			http.StatusCreated:               linkResp,
+			http.StatusBadRequest:            errResp,
+			http.StatusForbidden:             errResp,
+			http.StatusConflict:              errResp,
+			http.StatusRequestEntityTooLarge: errResp,
+			http.StatusUnprocessableEntity:   errResp,
+			http.StatusTooManyRequests:       errResp,
+			http.StatusServiceUnavailable:    errResp,
+		},
+	},
+	"POST /api/v1/graphql": {
+		summary:   "Run a GraphQL query",
+		tag:       "graphql",
+		auth:      true,
+		body:      GraphQLRequest{},
+		responses: map[int]any{http.StatusOK: GraphQLResponse{}, http.StatusBadRequest: errResp, http.StatusRequestEntityTooLarge: errResp},
+	},
+	"GET /api/v1/links": {
+		summary:   "List or search your links, newest first",
+		tag:       "links",
+		auth:      true,
+		query:     []string{"query", "limit", "offset"},
+		responses: map[int]any{http.StatusOK: model.LinkPage{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp},
+	},
+	"GET /api/v1/links/{code}": {
+		summary: "Fetch a link",
+		tag:     "links",
+		auth:    true,
+		headers: []string{"If-None-Match", "If-Modified-Since"},
+		responses: map[int]any{
+			http.StatusOK:           linkResp,
+			http.StatusNotModified:  nil,
+			http.StatusUnauthorized: errResp,
+			http.StatusNotFound:     errResp,
+		},
+	},
+	"PATCH /api/v1/links/{code}": {
+		summary: "Edit a link's destination, title or description",
+		tag:     "links",
+		auth:    true,
+		headers: []string{"If-Match"},
+		body:    model.UpdateReq{},
+		responses: map[int]any{
+			http.StatusOK:                    linkResp,
+			http.StatusBadRequest:            errResp,
+			http.StatusUnauthorized:          errResp,
+			http.StatusNotFound:              errResp,
+			http.StatusConflict:              errResp,
+			http.StatusPreconditionFailed:    errResp,
+			http.StatusRequestEntityTooLarge: errResp,
+			http.StatusUnprocessableEntity:   errResp,
+		},
+	},
+	"DELETE /api/v1/links/{code}": {
+		summary:   "Delete a link",
+		tag:       "links",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"POST /api/v1/links/{code}/disable": {
+		summary:   "Stop a link from redirecting",
+		tag:       "links",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: linkResp, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"POST /api/v1/links/{code}/enable": {
+		summary:   "Make a disabled link redirect again",
+		tag:       "links",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: linkResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/links/{code}/stats/daily": {
+		summary:   "Clicks per UTC day on one of your links",
+		tag:       "links",
+		auth:      true,
+		query:     []string{"from", "to"},
+		responses: map[int]any{http.StatusOK: model.DailyStats{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/links/{code}/stats/countries": {
+		summary:   "Clicks on one of your links by country",
+		tag:       "links",
+		auth:      true,
+		query:     []string{"from", "to", "limit"},
+		responses: map[int]any{http.StatusOK: model.ClickBreakdown{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/links/{code}/stats/referrers": {
+		summary:   "Clicks on one of your links by referring domain",
+		tag:       "links",
+		auth:      true,
+		query:     []string{"from", "to", "limit"},
+		responses: map[int]any{http.StatusOK: model.ClickBreakdown{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/links/{code}/stats/browsers": {
+		summary:   "Clicks on one of your links by browser and operating system",
+		tag:       "links",
+		auth:      true,
+		query:     []string{"from", "to", "limit"},
+		responses: map[int]any{http.StatusOK: model.BrowserStats{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"DELETE /api/v1/links/{code}/clicks": {
+		summary:   "Delete the click history of one of your links",
+		tag:       "links",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/resolve/{code}": {
+		summary:   "Look up where a short link leads without following it",
+		tag:       "redirect",
+		query:     []string{"domain"},
+		responses: map[int]any{http.StatusOK: linkResp, http.StatusBadRequest: errResp, http.StatusNotFound: errResp, http.StatusGone: errResp},
+	},
+	"GET /api/v1/lookup": {
+		summary:   "Find the existing short link for a long URL",
+		tag:       "links",
+		query:     []string{"url", "domain"},
+		responses: map[int]any{http.StatusOK: linkResp, http.StatusBadRequest: errResp, http.StatusNotFound: errResp, http.StatusGone: errResp},
+	},
+	"DELETE /api/v1/users/{id}/data": {
+		summary:   "Erase a user's links, click events and usage",
+		tag:       "users",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: model.Erasure{}, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"GET /api/v1/admin/links": {
+		summary:   "List every link, newest first",
+		tag:       "admin",
+		auth:      true,
+		query:     []string{"limit", "offset"},
+		responses: map[int]any{http.StatusOK: model.LinkPage{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"DELETE /api/v1/admin/links/{code}": {
+		summary:   "Delete any link",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"POST /api/v1/admin/links/{code}/takedown": {
+		summary:   "Take a link down for phishing, malware or a DMCA complaint",
+		tag:       "admin",
+		auth:      true,
+		body:      model.TakedownReq{},
+		responses: map[int]any{http.StatusOK: model.Takedown{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"DELETE /api/v1/admin/links/{code}/takedown": {
+		summary:   "Lift a takedown and enable the link again",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: linkResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/admin/stats": {
+		summary:   "Service-wide totals",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: model.Stats{}, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"GET /api/v1/admin/audit": {
+		summary:   "Audit log of changes, newest first",
+		tag:       "admin",
+		auth:      true,
+		query:     []string{"actor", "subject", "action", "limit", "offset"},
+		responses: map[int]any{http.StatusOK: model.AuditPage{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"POST /api/v1/admin/reload": {
+		summary:   "Reload the reloadable settings from the environment and .env",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusInternalServerError: errResp},
+	},
+	"GET /api/v1/admin/bans": {
+		summary:   "List banned destination domains",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: BanList{}, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"PUT /api/v1/admin/bans/{domain}": {
+		summary:      "Ban a destination domain and its subdomains",
+		tag:          "admin",
+		auth:         true,
+		body:         model.BanReq{},
+		optionalBody: true,
+		responses:    map[int]any{http.StatusOK: model.BannedDomain{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"DELETE /api/v1/admin/bans/{domain}": {
+		summary:   "Lift a domain ban",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"POST /api/v1/admin/import": {
+		summary:   "Import links from another shortener, keeping their codes",
+		tag:       "admin",
+		auth:      true,
+		body:      model.ImportReq{},
+		responses: map[int]any{http.StatusOK: model.ImportResult{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"GET /api/v1/admin/flags": {
+		summary:   "List the feature flags in effect",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: FlagList{}, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"PUT /api/v1/admin/flags/{name}": {
+		summary:   "Roll a feature out to some owners, overriding FEATURE_FLAGS",
+		tag:       "admin",
+		auth:      true,
+		body:      model.FeatureFlagReq{},
+		responses: map[int]any{http.StatusOK: model.FeatureFlag{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"DELETE /api/v1/admin/flags/{name}": {
+		summary:   "Drop a flag set through the API",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/admin/jobs": {
+		summary:   "List the background jobs with their schedules and last runs",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: JobList{}, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"POST /api/v1/admin/jobs/{name}/run": {
+		summary:   "Run a background job on this instance now",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusAccepted: nil, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/admin/reviews": {
+		summary:   "List the links held for their destination's reputation, oldest first",
+		tag:       "admin",
+		auth:      true,
+		query:     []string{"limit", "offset"},
+		responses: map[int]any{http.StatusOK: model.ReviewPage{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"POST /api/v1/admin/reviews/{code}/approve": {
+		summary:   "Approve a held link, enabling it",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: linkResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"POST /api/v1/admin/reviews/{code}/reject": {
+		summary:   "Reject a held link, deleting it",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/admin/reports": {
+		summary:   "List abuse reports, oldest first, optionally in one status",
+		tag:       "admin",
+		auth:      true,
+		query:     []string{"status", "limit", "offset"},
+		responses: map[int]any{http.StatusOK: model.ReportPage{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp},
+	},
+	"POST /api/v1/admin/reports/{id}/approve": {
+		summary:   "Approve an abuse report, taking the link down",
+		tag:       "admin",
+		auth:      true,
+		body:      model.ApproveReq{},
+		responses: map[int]any{http.StatusOK: model.AbuseReport{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp, http.StatusConflict: errResp},
+	},
+	"POST /api/v1/admin/reports/{id}/reject": {
+		summary:   "Reject an abuse report, leaving the link alone",
+		tag:       "admin",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: model.AbuseReport{}, http.StatusUnauthorized: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp, http.StatusConflict: errResp},
+	},
+	"GET /api/v1/export": {
+		summary:   "Export your links as NDJSON, one link per line in code order",
+		tag:       "links",
+		auth:      true,
+		query:     []string{"cursor", "limit", "stats"},
+		mediaType: "application/x-ndjson",
+		responses: map[int]any{http.StatusOK: model.ExportLink{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp},
+	},
+	"POST /api/v1/orgs": {
+		summary:   "Create an organization, with you as its admin",
+		tag:       "orgs",
+		auth:      true,
+		body:      model.OrgReq{},
+		responses: map[int]any{http.StatusCreated: model.Org{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusConflict: errResp},
+	},
+	"GET /api/v1/orgs": {
+		summary:   "List the organizations you belong to",
+		tag:       "orgs",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: model.OrgList{}, http.StatusUnauthorized: errResp},
+	},
+	"GET /api/v1/orgs/{org}": {
+		summary:   "Fetch an organization and its members",
+		tag:       "orgs",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: model.OrgDetail{}, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"PUT /api/v1/orgs/{org}/members/{owner}": {
+		summary:      "Add a member or change their role; admins only",
+		tag:          "orgs",
+		auth:         true,
+		body:         model.MemberReq{},
+		optionalBody: true,
+		responses: map[int]any{
+			http.StatusOK:           model.OrgMember{},
+			http.StatusBadRequest:   errResp,
+			http.StatusUnauthorized: errResp,
+			http.StatusForbidden:    errResp,
+			http.StatusNotFound:     errResp,
+			http.StatusConflict:     errResp,
+		},
+	},
+	"DELETE /api/v1/orgs/{org}/members/{owner}": {
+		summary: "Remove a member, or leave an organization",
+		tag:     "orgs",
+		auth:    true,
+		responses: map[int]any{
+			http.StatusNoContent:    nil,
+			http.StatusUnauthorized: errResp,
+			http.StatusForbidden:    errResp,
+			http.StatusNotFound:     errResp,
+			http.StatusConflict:     errResp,
+		},
+	},
+	"GET /api/v1/orgs/{org}/links": {
+		summary:   "List or search an organization's links, newest first",
+		tag:       "orgs",
+		auth:      true,
+		query:     []string{"query", "limit", "offset"},
+		responses: map[int]any{http.StatusOK: model.LinkPage{}, http.StatusBadRequest: errResp, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"GET /api/v1/orgs/{org}/stats": {
+		summary:   "Totals for an organization's links",
+		tag:       "orgs",
+		auth:      true,
+		responses: map[int]any{http.StatusOK: model.Stats{}, http.StatusUnauthorized: errResp, http.StatusNotFound: errResp},
+	},
+	"POST /report": {
+		summary:   "Report a short link for abuse; no API key needed",
+		tag:       "redirect",
+		body:      model.ReportReq{},
+		responses: map[int]any{http.StatusCreated: model.AbuseReport{}, http.StatusBadRequest: errResp, http.StatusForbidden: errResp, http.StatusNotFound: errResp, http.StatusTooManyRequests: errResp, http.StatusServiceUnavailable: errResp},
+	},
+	"GET /{code}": {
+		summary:   "Follow a short link",
+		tag:       "redirect",
+		query:     []string{"preview"},
+		responses: map[int]any{http.StatusFound: nil, http.StatusNotFound: nil, http.StatusGone: nil, http.StatusUnavailableForLegalReasons: nil},
+	},
+}
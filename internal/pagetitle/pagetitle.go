@@ -0,0 +1,217 @@
+// Package pagetitle reads the <title> and other metadata of web pages, for
+// labelling and previewing links.
+package pagetitle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/urlcheck"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxBody caps how much of a page is read looking for its title.
+	maxBody = 1 << 20
+	// MaxLen is the longest title returned, in characters.
+	MaxLen = 200
+	// maxDescription and maxURL cap descriptions and image addresses.
+	maxDescription = 500
+	maxURL         = 2048
+)
+
+var errInternal = errors.New("refusing to fetch an internal address")
+
+// Fetcher downloads pages and extracts their titles. It never connects to
+// internal addresses, whatever the destination policy for links is, since
+// the request comes from the server itself.
+type Fetcher struct {
+	client *http.Client
+}
+
+func New(timeout time.Duration) *Fetcher {
+	return newFetcher(timeout, false)
+}
+
+func newFetcher(timeout time.Duration, allowInternal bool) *Fetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Checked on the resolved address, so DNS cannot point us inside.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); !allowInternal && (ip == nil || urlcheck.IsInternal(ip)) {
+				return errInternal
+			}
+			return nil
+		},
+	}
+	return &Fetcher{client: &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}}
+}
+
+// Title returns the page's title with whitespace collapsed, or "" when the
+// page is not HTML or has no title.
+func (f *Fetcher) Title(ctx context.Context, rawURL string) (string, error) {
+	page, err := f.fetch(ctx, rawURL)
+	return page.title, err
+}
+
+// Page returns what the page says about itself: its title, description,
+// preview image and favicon, the latter two as absolute URLs. Open Graph
+// tags stand in for a missing title or description, and /favicon.ico for a
+// missing icon. Pages that are not HTML come back empty.
+func (f *Fetcher) Page(ctx context.Context, rawURL string) (model.PageMeta, error) {
+	page, err := f.fetch(ctx, rawURL)
+	if err != nil {
+		return model.PageMeta{}, err
+	}
+	meta := model.PageMeta{
+		Title:       cmp.Or(page.title, clean(page.meta["og:title"])),
+		Description: cut(cmp.Or(page.meta["description"], page.meta["og:description"]), maxDescription),
+		SiteName:    clean(page.meta["og:site_name"]),
+		Image:       resolve(page.url, page.meta["og:image"]),
+		Favicon:     resolve(page.url, cmp.Or(page.icon, "/favicon.ico")),
+	}
+	if !page.html {
+		meta.Favicon = ""
+	}
+	return meta, nil
+}
+
+// page is what was read of a page.
+type page struct {
+	url   *url.URL
+	html  bool
+	title string
+	// meta holds the content of the description and og:* meta tags.
+	meta map[string]string
+	icon string
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return page{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "shawty-title-fetcher/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return page{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return page{}, fmt.Errorf("pagetitle: %s answered %d", rawURL, resp.StatusCode)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" && mt != "application/xhtml+xml" {
+		return page{}, nil
+	}
+	p := extract(io.LimitReader(resp.Body, maxBody))
+	// Relative links are relative to where redirects ended.
+	p.url, p.html = resp.Request.URL, true
+	return p, nil
+}
+
+// extract reads the first <title> element in r, and the description, og:*
+// meta tags and icon link of its head.
+func extract(r io.Reader) page {
+	p := page{meta: map[string]string{}}
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return p
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				if p.title != "" {
+					continue
+				}
+				var b strings.Builder
+				for z.Next() == html.TextToken {
+					b.Write(z.Text())
+				}
+				p.title = clean(b.String())
+			case "body":
+				if p.title != "" {
+					return p
+				}
+			case "meta":
+				a := attrs(z, hasAttr)
+				key := strings.ToLower(cmp.Or(a["property"], a["name"]))
+				if key == "description" || strings.HasPrefix(key, "og:") {
+					if _, ok := p.meta[key]; !ok {
+						p.meta[key] = a["content"]
+					}
+				}
+			case "link":
+				a := attrs(z, hasAttr)
+				if p.icon == "" && slices.Contains(strings.Fields(strings.ToLower(a["rel"])), "icon") {
+					p.icon = a["href"]
+				}
+			}
+		}
+	}
+}
+
+func attrs(z *html.Tokenizer, more bool) map[string]string {
+	a := map[string]string{}
+	for more {
+		var k, v []byte
+		k, v, more = z.TagAttr()
+		a[string(k)] = string(v)
+	}
+	return a
+}
+
+// resolve returns ref as an absolute http(s) URL, or "" if it is not one.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" || base == nil {
+		return ""
+	}
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.String()) > maxURL {
+		return ""
+	}
+	return u.String()
+}
+
+func clean(s string) string {
+	return cut(s, MaxLen)
+}
+
+func cut(s string, n int) string {
+	s = strings.ToValidUTF8(strings.Join(strings.Fields(s), " "), "")
+	if utf8.RuneCountInString(s) > n {
+		s = string([]rune(s)[:n])
+	}
+	return s
+}
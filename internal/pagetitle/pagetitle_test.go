@@ -0,0 +1,106 @@
+package pagetitle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestTitle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><head><meta charset=utf-8><title>\n  Getting  started &amp; more\n</title></head><body><title>no</title></body></html>"))
+		case "/long":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<title>" + strings.Repeat("é", MaxLen+10) + "</title>"))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"title":"no"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(time.Second, true)
+	ctx := context.Background()
+
+	if got, err := f.Title(ctx, srv.URL+"/page"); err != nil || got != "Getting started & more" {
+		t.Errorf("expected the first title, got %q, %v", got, err)
+	}
+	if got, _ := f.Title(ctx, srv.URL+"/long"); len([]rune(got)) != MaxLen {
+		t.Errorf("expected title cut to %d characters, got %d", MaxLen, len([]rune(got)))
+	}
+	if got, err := f.Title(ctx, srv.URL+"/json"); err != nil || got != "" {
+		t.Errorf("expected no title for JSON, got %q, %v", got, err)
+	}
+	if _, err := f.Title(ctx, srv.URL+"/missing"); err == nil {
+		t.Error("expected an error for 404")
+	}
+}
+
+func TestTitle_RefusesInternal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>secret</title>"))
+	}))
+	defer srv.Close()
+
+	_, err := New(time.Second).Title(context.Background(), srv.URL)
+	if !errors.Is(err, errInternal) {
+		t.Errorf("expected errInternal for a loopback address, got %v", err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/docs/page", http.StatusFound)
+		case "/docs/page":
+			w.Write([]byte(`<html><head><title>Docs</title>
+				<meta property="og:title" content="Not this">
+				<meta property="og:description" content="  All the   docs ">
+				<meta property="og:site_name" content="Example">
+				<meta property="og:image" content="img/card.png">
+				<link rel="shortcut icon" href="/static/icon.png">
+				</head><body></body></html>`))
+		case "/bare":
+			w.Write([]byte(`<meta property="og:title" content="From OG"><meta name="description" content="Plain">` +
+				`<meta property="og:image" content="javascript:alert(1)">`))
+		default:
+			w.Header().Set("Content-Type", "image/png")
+		}
+	}))
+	defer srv.Close()
+
+	f := newFetcher(time.Second, true)
+	ctx := context.Background()
+
+	got, err := f.Page(ctx, srv.URL+"/moved")
+	if err != nil {
+		t.Fatalf("Page: %v", err)
+	}
+	if got.Title != "Docs" || got.Description != "All the docs" || got.SiteName != "Example" ||
+		got.Image != srv.URL+"/docs/img/card.png" || got.Favicon != srv.URL+"/static/icon.png" {
+		t.Errorf("expected the head's metadata resolved against the final URL, got %+v", got)
+	}
+
+	got, _ = f.Page(ctx, srv.URL+"/bare")
+	if got.Title != "From OG" || got.Description != "Plain" || got.Image != "" || got.Favicon != srv.URL+"/favicon.ico" {
+		t.Errorf("expected OG and default fallbacks without the script URL, got %+v", got)
+	}
+
+	if got, err := f.Page(ctx, srv.URL+"/image.png"); err != nil || got != (model.PageMeta{}) {
+		t.Errorf("expected nothing for an image, got %+v, %v", got, err)
+	}
+}
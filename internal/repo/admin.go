@@ -0,0 +1,303 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// AdminRepo backs the operator endpoints.
+type AdminRepo interface {
+	// ListAll returns every link, newest first, skipping offset of them.
+	ListAll(ctx context.Context, limit, offset int) ([]model.URLRecord, error)
+	Stats(ctx context.Context, now time.Time) (model.Stats, error)
+	// BanDomain bans a destination host, replacing the reason of an existing ban.
+	BanDomain(ctx context.Context, ban model.BannedDomain) (model.BannedDomain, error)
+	// UnbanDomain lifts a ban; a missing ban yields ErrNotFound.
+	UnbanDomain(ctx context.Context, domain string) error
+	ListBannedDomains(ctx context.Context) ([]model.BannedDomain, error)
+	// IsBanned reports whether host or one of its parent domains is banned.
+	IsBanned(ctx context.Context, host string) (bool, error)
+	// EraseOwner deletes owner's links with their clicks, and the owner's
+	// usage counters, idempotency keys and org memberships, and clears the
+	// link snapshots of audit entries about owner's links, in one
+	// transaction. It returns how many links and click events went.
+	EraseOwner(ctx context.Context, owner string) (links, clicks int, err error)
+	// PurgeClicks deletes code's click events and daily totals and returns
+	// how many events went.
+	PurgeClicks(ctx context.Context, code string) (int, error)
+	// AddTakedown records a link's takedown, replacing an earlier one, and
+	// returns it with its time.
+	AddTakedown(ctx context.Context, t model.Takedown) (model.Takedown, error)
+	// GetTakedown returns code's takedown or ErrNotFound.
+	GetTakedown(ctx context.Context, code string) (model.Takedown, error)
+	// RemoveTakedown lifts code's takedown; a missing one yields ErrNotFound.
+	RemoveTakedown(ctx context.Context, code string) error
+	ReportRepo
+	ReviewRepo
+	LinkCheckRepo
+	PageMetaRepo
+}
+
+// parentDomains lists host and each domain above it: a.b.c, b.c, c.
+func parentDomains(host string) []string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domains := []string{host}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		domains = append(domains, host)
+	}
+	return domains
+}
+
+const statsQuery = `
+	SELECT
+		COUNT(*),
+		COALESCE(SUM(CASE WHEN active THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN scan_status = 'flagged' THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN expires_at < %s THEN 1 ELSE 0 END), 0)
+	FROM url_records`
+
+const clicksQuery = `SELECT COUNT(*) FROM click_events`
+
+// tenantClicksQuery counts the clicks on one tenant's links.
+const tenantClicksQuery = `SELECT COUNT(*) FROM click_events e JOIN url_records u ON u.code = e.code WHERE u.tenant_id=%s`
+
+// queryStats runs linksQuery, a statsQuery, with now and filter as arguments
+// and clicksQuery with filter alone.
+func queryStats(ctx context.Context, db *sql.DB, linksQuery, clicksQuery string, now time.Time, filter ...any) (model.Stats, error) {
+	var s model.Stats
+	args := append([]any{now}, filter...)
+	if err := db.QueryRowContext(ctx, linksQuery, args...).Scan(&s.Links, &s.Active, &s.Flagged, &s.Expired); err != nil {
+		return model.Stats{}, err
+	}
+	s.Disabled = s.Links - s.Active
+	err := db.QueryRowContext(ctx, clicksQuery, filter...).Scan(&s.Clicks)
+	return s, err
+}
+
+func scanBans(rows *sql.Rows) ([]model.BannedDomain, error) {
+	defer rows.Close()
+
+	var bans []model.BannedDomain
+	for rows.Next() {
+		var b model.BannedDomain
+		if err := rows.Scan(&b.Domain, &b.Reason, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+func (r *PostgresRepo) ListAll(ctx context.Context, limit, offset int) ([]model.URLRecord, error) {
+	const q = `SELECT ` + recordColumns + ` FROM url_records WHERE tenant_id = COALESCE($3, tenant_id) ORDER BY created_at DESC, id LIMIT $1 OFFSET $2`
+
+	rows, err := r.db.QueryContext(ctx, q, limit, offset, tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *PostgresRepo) Stats(ctx context.Context, now time.Time) (model.Stats, error) {
+	if tenant, ok := TenantOf(ctx); ok {
+		return queryStats(ctx, r.db, fmt.Sprintf(statsQuery, "$1")+` WHERE tenant_id=$2`, fmt.Sprintf(tenantClicksQuery, "$1"), now, tenant)
+	}
+	return queryStats(ctx, r.db, fmt.Sprintf(statsQuery, "$1"), clicksQuery, now)
+}
+
+func (r *PostgresRepo) BanDomain(ctx context.Context, ban model.BannedDomain) (model.BannedDomain, error) {
+	const q = `
+		INSERT INTO banned_domains (domain, reason) VALUES ($1, $2)
+		ON CONFLICT (domain) DO UPDATE SET reason = EXCLUDED.reason
+		RETURNING created_at`
+
+	err := r.db.QueryRowContext(ctx, q, ban.Domain, ban.Reason).Scan(&ban.CreatedAt)
+	return ban, err
+}
+
+func (r *PostgresRepo) UnbanDomain(ctx context.Context, domain string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM banned_domains WHERE domain=$1`, domain)
+	return affectedOne(res, err)
+}
+
+func (r *PostgresRepo) ListBannedDomains(ctx context.Context) ([]model.BannedDomain, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT domain, reason, created_at FROM banned_domains ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+	return scanBans(rows)
+}
+
+func (r *PostgresRepo) IsBanned(ctx context.Context, host string) (bool, error) {
+	const q = `SELECT EXISTS (SELECT 1 FROM banned_domains WHERE domain = ANY($1))`
+
+	var banned bool
+	err := r.db.QueryRowContext(ctx, q, parentDomains(host)).Scan(&banned)
+	return banned, err
+}
+
+func (r *MySQLRepo) ListAll(ctx context.Context, limit, offset int) ([]model.URLRecord, error) {
+	const q = `SELECT ` + recordColumns + ` FROM url_records WHERE tenant_id = COALESCE(?, tenant_id) ORDER BY created_at DESC, id LIMIT ? OFFSET ?`
+
+	rows, err := r.db.QueryContext(ctx, q, tenantArg(ctx), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *MySQLRepo) Stats(ctx context.Context, now time.Time) (model.Stats, error) {
+	if tenant, ok := TenantOf(ctx); ok {
+		return queryStats(ctx, r.db, fmt.Sprintf(statsQuery, "?")+` WHERE tenant_id=?`, fmt.Sprintf(tenantClicksQuery, "?"), now, tenant)
+	}
+	return queryStats(ctx, r.db, fmt.Sprintf(statsQuery, "?"), clicksQuery, now)
+}
+
+func (r *MySQLRepo) BanDomain(ctx context.Context, ban model.BannedDomain) (model.BannedDomain, error) {
+	const q = `INSERT INTO banned_domains (domain, reason) VALUES (?, ?) ON DUPLICATE KEY UPDATE reason = VALUES(reason)`
+
+	if _, err := r.db.ExecContext(ctx, q, ban.Domain, ban.Reason); err != nil {
+		return model.BannedDomain{}, err
+	}
+	err := r.db.QueryRowContext(ctx, `SELECT created_at FROM banned_domains WHERE domain=?`, ban.Domain).Scan(&ban.CreatedAt)
+	return ban, err
+}
+
+func (r *MySQLRepo) UnbanDomain(ctx context.Context, domain string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM banned_domains WHERE domain=?`, domain)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) ListBannedDomains(ctx context.Context) ([]model.BannedDomain, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT domain, reason, created_at FROM banned_domains ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+	return scanBans(rows)
+}
+
+func (r *MySQLRepo) IsBanned(ctx context.Context, host string) (bool, error) {
+	domains := parentDomains(host)
+	q := `SELECT EXISTS (SELECT 1 FROM banned_domains WHERE domain IN (?` + strings.Repeat(", ?", len(domains)-1) + `))`
+
+	args := make([]any, len(domains))
+	for i, d := range domains {
+		args[i] = d
+	}
+	var banned bool
+	err := r.db.QueryRowContext(ctx, q, args...).Scan(&banned)
+	return banned, err
+}
+
+func (r *MemoryRepo) ListAll(ctx context.Context, limit, offset int) ([]model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	recs := make([]model.URLRecord, 0, len(r.byCode))
+	for _, rec := range r.byCode {
+		if inTenant(ctx, rec) {
+			recs = append(recs, rec)
+		}
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (r *MemoryRepo) Stats(ctx context.Context, now time.Time) (model.Stats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// A scoped total leaves out clicks on deleted links, as no tenant owns
+	// them any more.
+	_, scoped := TenantOf(ctx)
+	return r.stats(now, func(rec model.URLRecord) bool { return !scoped || rec.Code != "" && inTenant(ctx, rec) }), nil
+}
+
+// stats totals the links that match keep and their clicks. The caller holds
+// r.mu.
+func (r *MemoryRepo) stats(now time.Time, keep func(model.URLRecord) bool) model.Stats {
+	var s model.Stats
+	for _, ev := range r.clicks {
+		// Clicks on deleted links are judged by a blank record, so they count
+		// towards the service-wide total only.
+		if keep(r.byCode[ev.Code]) {
+			s.Clicks++
+		}
+	}
+	for _, rec := range r.byCode {
+		if keep(rec) {
+			countLink(&s, rec, now)
+		}
+	}
+	return s
+}
+
+// countLink adds rec to the link totals of s.
+func countLink(s *model.Stats, rec model.URLRecord, now time.Time) {
+	s.Links++
+	if rec.Active {
+		s.Active++
+	} else {
+		s.Disabled++
+	}
+	if rec.ScanStatus == "flagged" {
+		s.Flagged++
+	}
+	if rec.ExpiresAt != nil && rec.ExpiresAt.Before(now) {
+		s.Expired++
+	}
+}
+
+func (r *MemoryRepo) BanDomain(ctx context.Context, ban model.BannedDomain) (model.BannedDomain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if prev, ok := r.bans[ban.Domain]; ok {
+		ban.CreatedAt = prev.CreatedAt
+	} else {
+		ban.CreatedAt = time.Now().UTC()
+	}
+	r.bans[ban.Domain] = ban
+	return ban, nil
+}
+
+func (r *MemoryRepo) UnbanDomain(ctx context.Context, domain string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.bans[domain]; !ok {
+		return ErrNotFound
+	}
+	delete(r.bans, domain)
+	return nil
+}
+
+func (r *MemoryRepo) ListBannedDomains(ctx context.Context) ([]model.BannedDomain, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bans := make([]model.BannedDomain, 0, len(r.bans))
+	for _, b := range r.bans {
+		bans = append(bans, b)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Domain < bans[j].Domain })
+	return bans, nil
+}
+
+func (r *MemoryRepo) IsBanned(ctx context.Context, host string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, d := range parentDomains(host) {
+		if _, ok := r.bans[d]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
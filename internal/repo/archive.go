@@ -0,0 +1,325 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// ArchiveRepo moves links nobody uses any more out of the link table, so it
+// and its indexes stay small, and back again when one is asked for.
+type ArchiveRepo interface {
+	// ArchiveUnused archives up to limit links last changed before before
+	// that have had no click since, and returns how many it archived.
+	ArchiveUnused(ctx context.Context, before time.Time, limit int) (int, error)
+	// Rehydrate moves an archived link back and returns it, stamping
+	// updated_at so it is not archived again straight away. If its
+	// destination has been given another link meanwhile it comes back as a
+	// unique link. A code that is not archived yields ErrNotFound.
+	Rehydrate(ctx context.Context, code string) (model.URLRecord, error)
+	// IsArchived reports whether code belongs to an archived link of any
+	// tenant.
+	IsArchived(ctx context.Context, code string) (bool, error)
+	// EachArchivedCode calls fn with the code of every archived link, as
+	// URLRepo.EachCode does for the rest.
+	EachArchivedCode(ctx context.Context, fn func(code string) error) error
+}
+
+// Archived is a URLRepo that brings archived links back when they are looked
+// up by code, so archiving is invisible to redirects, and keeps archived
+// codes from being handed out again. Lookups by destination do not reach
+// the archive: shortening an archived link's destination makes a new link.
+type Archived struct {
+	URLRepo
+	archive ArchiveRepo
+}
+
+// WithArchive wraps r, rehydrating links from archive.
+func WithArchive(r URLRepo, archive ArchiveRepo) *Archived {
+	return &Archived{URLRepo: r, archive: archive}
+}
+
+func (r *Archived) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	rec, err := r.URLRepo.GetByCode(ctx, code)
+	if !errors.Is(err, ErrNotFound) {
+		return rec, err
+	}
+	rec, err = r.archive.Rehydrate(ctx, code)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrDuplicateCode) || errors.Is(err, ErrDuplicateLongURL) {
+		// Rehydrated by a concurrent lookup, or never archived.
+		return r.URLRepo.GetByCode(ctx, code)
+	}
+	return rec, err
+}
+
+// taken reports ErrDuplicateCode for archived codes.
+func (r *Archived) taken(ctx context.Context, code string) error {
+	archived, err := r.archive.IsArchived(ctx, code)
+	if err == nil && archived {
+		err = ErrDuplicateCode
+	}
+	return err
+}
+
+func (r *Archived) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
+	if err := r.taken(ctx, rec.Code); err != nil {
+		return model.URLRecord{}, err
+	}
+	return r.URLRepo.Insert(ctx, rec)
+}
+
+func (r *Archived) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	if err := r.taken(ctx, rec.Code); err != nil {
+		return model.URLRecord{}, false, err
+	}
+	return r.URLRepo.Upsert(ctx, rec)
+}
+
+// EachCode visits archived codes too, so filters built from it, such as
+// the code filter, keep letting their lookups through.
+func (r *Archived) EachCode(ctx context.Context, fn func(code string) error) error {
+	if err := r.URLRepo.EachCode(ctx, fn); err != nil {
+		return err
+	}
+	return r.archive.EachArchivedCode(ctx, fn)
+}
+
+// archiveColumns are the columns url_records and url_records_archive share.
+const archiveColumns = `id, code, long_url, short_url, created_at, scan_status, scanned_at, utm_params, owner, updated_at, active, domain, expires_at, title, description, org, original_url, dedup, max_clicks, click_count, tenant_id, fallback_url`
+
+// rehydrateColumns selects an archived row a as a url_records row, with a
+// fresh updated_at and dedup kept only while no other link holds the
+// destination, which destinationTaken tests.
+func rehydrateColumns(now, destinationTaken string) string {
+	return `a.id, a.code, a.long_url, a.short_url, a.created_at, a.scan_status, a.scanned_at, a.utm_params, a.owner, ` + now +
+		`, a.active, a.domain, a.expires_at, a.title, a.description, a.org, a.original_url, a.dedup AND NOT EXISTS (` + destinationTaken +
+		`), a.max_clicks, a.click_count, a.tenant_id, a.fallback_url`
+}
+
+func (r *PostgresRepo) ArchiveUnused(ctx context.Context, before time.Time, limit int) (int, error) {
+	// SKIP LOCKED leaves links being redirected or edited for the next run.
+	const q = `
+		WITH moved AS (
+			DELETE FROM url_records WHERE id IN (
+				SELECT id FROM url_records u
+				WHERE u.created_at < $1 AND u.updated_at < $1 AND u.tenant_id = COALESCE($3, u.tenant_id)
+				  AND NOT EXISTS (SELECT 1 FROM click_events c WHERE c.code = u.code AND c.clicked_at >= $1)
+				  AND NOT EXISTS (SELECT 1 FROM click_daily d WHERE d.code = u.code AND d.day >= ($1::timestamptz AT TIME ZONE 'UTC')::date)
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + archiveColumns + `
+		)
+		INSERT INTO url_records_archive (` + archiveColumns + `)
+		SELECT ` + archiveColumns + ` FROM moved`
+
+	res, err := r.db.ExecContext(ctx, q, before, limit, tenantArg(ctx))
+	return rowsAffected(res, err)
+}
+
+func (r *PostgresRepo) Rehydrate(ctx context.Context, code string) (model.URLRecord, error) {
+	q := `
+		WITH a AS (
+			DELETE FROM url_records_archive WHERE code=$1 AND tenant_id = COALESCE($2, tenant_id)
+			RETURNING ` + archiveColumns + `
+		)
+		INSERT INTO url_records (` + archiveColumns + `)
+		SELECT ` + rehydrateColumns("now()", `SELECT 1 FROM url_records u WHERE u.tenant_id = a.tenant_id AND u.domain = a.domain AND u.long_url = a.long_url AND u.dedup`) + ` FROM a
+		RETURNING ` + recordColumns
+
+	rec, err := scanRecord(r.db.QueryRowContext(ctx, q, code, tenantArg(ctx)))
+	return rec, mapPgError(err)
+}
+
+func (r *PostgresRepo) IsArchived(ctx context.Context, code string) (bool, error) {
+	return isArchived(ctx, r.db, `SELECT EXISTS (SELECT 1 FROM url_records_archive WHERE code=$1)`, code)
+}
+
+func (r *PostgresRepo) EachArchivedCode(ctx context.Context, fn func(code string) error) error {
+	return eachArchivedCode(ctx, r.db, fn)
+}
+
+func (r *MySQLRepo) ArchiveUnused(ctx context.Context, before time.Time, limit int) (int, error) {
+	const pick = `
+		SELECT code FROM url_records u
+		WHERE u.created_at < ? AND u.updated_at < ? AND u.tenant_id = COALESCE(?, u.tenant_id)
+		  AND NOT EXISTS (SELECT 1 FROM click_events c WHERE c.code = u.code AND c.clicked_at >= ?)
+		  AND NOT EXISTS (SELECT 1 FROM click_daily d WHERE d.code = u.code AND d.day >= DATE(?))
+		LIMIT ?
+		FOR UPDATE`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	before = before.UTC()
+	rows, err := tx.QueryContext(ctx, pick, before, before, tenantArg(ctx), before, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	var codes []any
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		codes = append(codes, code)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(codes) == 0 {
+		return 0, err
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(codes)), ", ")
+	if _, err := tx.ExecContext(ctx, `INSERT INTO url_records_archive (`+archiveColumns+`) SELECT `+archiveColumns+` FROM url_records WHERE code IN (`+in+`)`, codes...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_records WHERE code IN (`+in+`)`, codes...); err != nil {
+		return 0, err
+	}
+	return len(codes), tx.Commit()
+}
+
+func (r *MySQLRepo) Rehydrate(ctx context.Context, code string) (model.URLRecord, error) {
+	q := `
+		INSERT INTO url_records (` + archiveColumns + `)
+		SELECT ` + rehydrateColumns("CURRENT_TIMESTAMP(6)", `SELECT 1 FROM url_records u WHERE u.tenant_id = a.tenant_id AND u.domain = a.domain AND u.dedup_hash = SHA2(a.long_url, 256)`) + `
+		FROM url_records_archive a WHERE a.code=? AND a.tenant_id = COALESCE(?, a.tenant_id)`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, q, code, tenantArg(ctx))
+	if err := affectedOne(res, mapMySQLError(err)); err != nil {
+		return model.URLRecord{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_records_archive WHERE code=?`, code); err != nil {
+		return model.URLRecord{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.URLRecord{}, err
+	}
+	return r.GetByCode(ctx, code)
+}
+
+func (r *MySQLRepo) IsArchived(ctx context.Context, code string) (bool, error) {
+	return isArchived(ctx, r.db, `SELECT EXISTS (SELECT 1 FROM url_records_archive WHERE code=?)`, code)
+}
+
+func (r *MySQLRepo) EachArchivedCode(ctx context.Context, fn func(code string) error) error {
+	return eachArchivedCode(ctx, r.db, fn)
+}
+
+func isArchived(ctx context.Context, db *sql.DB, q, code string) (bool, error) {
+	var archived bool
+	err := db.QueryRowContext(ctx, q, code).Scan(&archived)
+	return archived, err
+}
+
+// eachArchivedCode streams every archived code, for both SQL dialects.
+func eachArchivedCode(ctx context.Context, db *sql.DB, fn func(code string) error) error {
+	rows, err := db.QueryContext(ctx, `SELECT code FROM url_records_archive`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return err
+		}
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *MemoryRepo) ArchiveUnused(ctx context.Context, before time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used := make(map[string]bool)
+	for _, ev := range r.clicks {
+		if !ev.ClickedAt.Before(before) {
+			used[ev.Code] = true
+		}
+	}
+	day := before.UTC().Format(time.DateOnly)
+	for key := range r.daily {
+		if key.day >= day {
+			used[key.code] = true
+		}
+	}
+
+	var n int
+	for code, rec := range r.byCode {
+		if n == limit {
+			break
+		}
+		if !inTenant(ctx, rec) || used[code] || !rec.CreatedAt.Before(before) || !rec.UpdatedAt.Before(before) {
+			continue
+		}
+		delete(r.byCode, code)
+		r.unindex(rec)
+		r.archived[code] = rec
+		n++
+	}
+	return n, nil
+}
+
+func (r *MemoryRepo) Rehydrate(ctx context.Context, code string) (model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.archived[code]
+	if !ok || !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	if _, ok := r.byCode[code]; ok {
+		return model.URLRecord{}, ErrDuplicateCode
+	}
+	if _, ok := r.byLong[longKey(rec.Tenant, rec.Domain, rec.LongUrl)]; ok {
+		rec.Unique = true
+	}
+	delete(r.archived, code)
+	rec.UpdatedAt = time.Now().UTC()
+	r.byCode[code] = rec
+	r.index(rec)
+	return rec, nil
+}
+
+func (r *MemoryRepo) IsArchived(ctx context.Context, code string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.archived[code]
+	return ok, nil
+}
+
+func (r *MemoryRepo) EachArchivedCode(ctx context.Context, fn func(code string) error) error {
+	r.mu.RLock()
+	codes := make([]string, 0, len(r.archived))
+	for code := range r.archived {
+		codes = append(codes, code)
+	}
+	r.mu.RUnlock()
+
+	for _, code := range codes {
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
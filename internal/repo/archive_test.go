@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestArchived(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	old := time.Now().AddDate(-1, 0, 0)
+	if _, err := m.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/a", CreatedAt: old}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if n, err := m.ArchiveUnused(ctx, time.Now().AddDate(0, -6, 0), 10); err != nil || n != 1 {
+		t.Fatalf("ArchiveUnused: expected 1 link archived, got %d (%v)", n, err)
+	}
+	if archived, _ := m.IsArchived(ctx, "abc"); !archived {
+		t.Fatal("expected abc archived")
+	}
+
+	r := WithArchive(m, m)
+	if _, err := r.GetByLong(ctx, "", "https://example.com/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected lookups by destination to miss the archive, got %v", err)
+	}
+	if _, err := r.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/b"}); !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("expected archived codes to stay taken, got %v", err)
+	}
+	// Shortened again meanwhile, the destination has another code.
+	if _, err := r.Insert(ctx, model.URLRecord{Code: "def", LongUrl: "https://example.com/a"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	var codes int
+	if err := r.EachCode(ctx, func(string) error { codes++; return nil }); err != nil || codes != 2 {
+		t.Errorf("EachCode: expected the archived code too, got %d (%v)", codes, err)
+	}
+
+	rec, err := r.GetByCode(ctx, "abc")
+	if err != nil || rec.LongUrl != "https://example.com/a" || !rec.Unique {
+		t.Fatalf("expected abc rehydrated as a unique link, got %+v (%v)", rec, err)
+	}
+	if archived, _ := m.IsArchived(ctx, "abc"); archived {
+		t.Error("expected abc out of the archive")
+	}
+	if got, _ := r.GetByLong(ctx, "", "https://example.com/a"); got.Code != "def" {
+		t.Errorf("expected the destination to keep giving def, got %q", got.Code)
+	}
+	if _, err := r.GetByCode(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
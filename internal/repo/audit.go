@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// AuditRepo stores the audit log. Entries are only ever added.
+type AuditRepo interface {
+	// InsertAudit appends entry; its ID and CreatedAt are assigned.
+	InsertAudit(ctx context.Context, entry model.AuditEntry) error
+	// ListAudit returns the entries matching filter, newest first, skipping
+	// offset of them.
+	ListAudit(ctx context.Context, filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, error)
+}
+
+// encodeSnapshot stores a link snapshot as JSON, and no snapshot as an empty
+// string.
+func encodeSnapshot(rec *model.URLRecord) (string, error) {
+	if rec == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(rec)
+	return string(b), err
+}
+
+func decodeSnapshot(s string) (*model.URLRecord, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var rec model.URLRecord
+	if err := json.Unmarshal([]byte(s), &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func insertAudit(ctx context.Context, db *sql.DB, q string, entry model.AuditEntry) error {
+	before, err := encodeSnapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := encodeSnapshot(entry.After)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, q, entry.Action, entry.Actor, entry.Subject, before, after)
+	return err
+}
+
+// listAudit selects the entries matching filter; placeholder spells the
+// i-th (1-based) argument.
+func listAudit(ctx context.Context, db *sql.DB, filter model.AuditFilter, limit, offset int, placeholder func(i int) string) ([]model.AuditEntry, error) {
+	var where []string
+	var args []any
+	for _, f := range []struct{ column, value string }{
+		{"actor", filter.Actor},
+		{"subject", filter.Subject},
+		{"action", filter.Action},
+	} {
+		if f.value != "" {
+			args = append(args, f.value)
+			where = append(where, f.column+"="+placeholder(len(args)))
+		}
+	}
+
+	q := `SELECT id, action, actor, subject, before_snapshot, after_snapshot, created_at FROM audit_log`
+	if len(where) > 0 {
+		q += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	args = append(args, limit, offset)
+	q += ` ORDER BY id DESC LIMIT ` + placeholder(len(args)-1) + ` OFFSET ` + placeholder(len(args))
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		var before, after string
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &e.Subject, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if e.Before, err = decodeSnapshot(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = decodeSnapshot(after); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *PostgresRepo) InsertAudit(ctx context.Context, entry model.AuditEntry) error {
+	return insertAudit(ctx, r.db, `
+		INSERT INTO audit_log (action, actor, subject, before_snapshot, after_snapshot)
+		VALUES ($1, $2, $3, $4, $5)`, entry)
+}
+
+func (r *MySQLRepo) InsertAudit(ctx context.Context, entry model.AuditEntry) error {
+	return insertAudit(ctx, r.db, `
+		INSERT INTO audit_log (action, actor, subject, before_snapshot, after_snapshot)
+		VALUES (?, ?, ?, ?, ?)`, entry)
+}
+
+func (r *MemoryRepo) InsertAudit(ctx context.Context, entry model.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = int64(len(r.audit) + 1)
+	entry.CreatedAt = time.Now().UTC()
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *PostgresRepo) ListAudit(ctx context.Context, filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, error) {
+	return listAudit(ctx, r.db, filter, limit, offset, pgPlaceholder)
+}
+
+func (r *MySQLRepo) ListAudit(ctx context.Context, filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, error) {
+	return listAudit(ctx, r.db, filter, limit, offset, mysqlPlaceholder)
+}
+
+func (r *MemoryRepo) ListAudit(ctx context.Context, filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []model.AuditEntry
+	for i := len(r.audit) - 1; i >= 0; i-- {
+		e := r.audit[i]
+		if (filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Subject != "" && e.Subject != filter.Subject) ||
+			(filter.Action != "" && e.Action != filter.Action) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[offset:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,552 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/gocql/gocql"
+)
+
+// CassandraSchema creates the tables CassandraRepo uses in the session's
+// keyspace. Codes are the primary key of links; links_by_long finds a
+// destination's link and links_by_owner an owner's, in code order.
+var CassandraSchema = []string{
+	`CREATE TABLE IF NOT EXISTS links (
+		code text PRIMARY KEY, id text, long_url text, short_url text,
+		created_at timestamp, updated_at timestamp, scan_status text, scanned_at timestamp,
+		utm text, owner text, active boolean, domain text, expires_at timestamp,
+		title text, description text, org text, original_url text, dedup boolean,
+		max_clicks int, click_count bigint, tenant text, fallback_url text)`,
+	`CREATE TABLE IF NOT EXISTS links_by_long (
+		tenant text, domain text, long_url text, code text,
+		PRIMARY KEY ((tenant, domain, long_url)))`,
+	`CREATE TABLE IF NOT EXISTS links_by_owner (
+		owner text, code text,
+		PRIMARY KEY (owner, code))`,
+}
+
+// cassandraAddedColumns are links columns newer than some deployments'
+// tables, which EnsureSchema adds to them.
+var cassandraAddedColumns = []string{"fallback_url text"}
+
+const cassandraColumns = `code, id, long_url, short_url, created_at, updated_at, scan_status, scanned_at, utm, owner, active, domain, expires_at, title, description, org, original_url, dedup, max_clicks, click_count, tenant, fallback_url`
+
+// takeClickAttempts bounds how often TakeClick retries a count that another
+// redirect changed under it.
+const takeClickAttempts = 10
+
+// CassandraRepo is a URLRepo on Cassandra or ScyllaDB, for deployments whose
+// redirect volume outgrows a single SQL primary. Codes are claimed with
+// lightweight transactions (INSERT ... IF NOT EXISTS), and so are
+// destinations, in links_by_long, before the link that names them is
+// written; a link whose code turns out to be taken releases its claim.
+// Times are kept to the millisecond. Listings other than an owner's read
+// the whole links table and suit background jobs only.
+type CassandraRepo struct {
+	cluster *gocql.ClusterConfig
+
+	mu      sync.Mutex
+	session *gocql.Session
+}
+
+// NewCassandra returns a repo on cluster, which connects on first use and
+// again after a failed attempt.
+func NewCassandra(cluster *gocql.ClusterConfig) *CassandraRepo {
+	return &CassandraRepo{cluster: cluster}
+}
+
+func (r *CassandraRepo) connect() (*gocql.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.session == nil {
+		s, err := r.cluster.CreateSession()
+		if err != nil {
+			return nil, err
+		}
+		r.session = s
+	}
+	return r.session, nil
+}
+
+// Close closes the session, if one was made.
+func (r *CassandraRepo) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.session != nil {
+		r.session.Close()
+		r.session = nil
+	}
+}
+
+// EnsureSchema creates the tables of CassandraSchema unless they exist. The
+// keyspace must exist already, as only its operator knows the replication
+// it needs.
+func (r *CassandraRepo) EnsureSchema(ctx context.Context) error {
+	s, err := r.connect()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range CassandraSchema {
+		if err := s.Query(stmt).WithContext(ctx).Exec(); err != nil {
+			return err
+		}
+	}
+	for _, col := range cassandraAddedColumns {
+		// Adding a column that exists is an invalid query, and all there is
+		// to tell that it does.
+		err := s.Query(`ALTER TABLE links ADD ` + col).WithContext(ctx).Exec()
+		var re gocql.RequestError
+		if err != nil && !(errors.As(err, &re) && re.Code() == gocql.ErrCodeInvalid) {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec runs a statement that needs no result.
+func (r *CassandraRepo) exec(ctx context.Context, stmt string, args ...any) error {
+	s, err := r.connect()
+	if err != nil {
+		return err
+	}
+	return s.Query(stmt, args...).WithContext(ctx).Exec()
+}
+
+// cas runs a lightweight transaction and reports whether it was applied.
+func (r *CassandraRepo) cas(ctx context.Context, stmt string, args ...any) (bool, error) {
+	s, err := r.connect()
+	if err != nil {
+		return false, err
+	}
+	return s.Query(stmt, args...).WithContext(ctx).MapScanCAS(map[string]any{})
+}
+
+// iter runs a query and calls fn with a scanner positioned on each row, in
+// turn, until fn returns false or an error.
+func (r *CassandraRepo) iter(ctx context.Context, fn func(scan func(dest ...any) error) (bool, error), stmt string, args ...any) error {
+	s, err := r.connect()
+	if err != nil {
+		return err
+	}
+	sc := s.Query(stmt, args...).WithContext(ctx).Iter().Scanner()
+	for sc.Next() {
+		more, err := fn(sc.Scan)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	return sc.Err()
+}
+
+func scanCassandra(scan func(dest ...any) error) (model.URLRecord, error) {
+	var rec model.URLRecord
+	var scannedAt, expiresAt *time.Time
+	var utm string
+	var dedup bool
+	err := scan(&rec.Code, &rec.ID, &rec.LongUrl, &rec.ShortUrl, &rec.CreatedAt, &rec.UpdatedAt, &rec.ScanStatus, &scannedAt, &utm, &rec.Owner, &rec.Active, &rec.Domain, &expiresAt, &rec.Title, &rec.Description, &rec.Org, &rec.OriginalURL, &dedup, &rec.MaxClicks, &rec.ClickCount, &rec.Tenant, &rec.FallbackURL)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	rec.CreatedAt = rec.CreatedAt.UTC()
+	rec.UpdatedAt = rec.UpdatedAt.UTC()
+	rec.ScannedAt = utcPtr(scannedAt)
+	rec.ExpiresAt = utcPtr(expiresAt)
+	rec.UTM = decodeParams(utm)
+	rec.Unique = !dedup
+	return rec, err
+}
+
+func (r *CassandraRepo) get(ctx context.Context, code string) (model.URLRecord, error) {
+	s, err := r.connect()
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	return scanCassandra(s.Query(`SELECT `+cassandraColumns+` FROM links WHERE code=?`, code).WithContext(ctx).Scan)
+}
+
+func (r *CassandraRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	rec, err := r.get(ctx, code)
+	if err == nil && !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+func (r *CassandraRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	s, err := r.connect()
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	tenant := tenantID(ctx)
+	var code string
+	err = s.Query(`SELECT code FROM links_by_long WHERE tenant=? AND domain=? AND long_url=?`, tenant, domain, long).WithContext(ctx).Scan(&code)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	// A claim may outlive a link whose insert failed, or not have its link
+	// written yet.
+	rec, err := r.get(ctx, code)
+	if err == nil && (rec.Tenant != tenant || rec.Domain != domain || rec.LongUrl != long) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+// newCassandraRecord fills in what Insert leaves to the database.
+func newCassandraRecord(ctx context.Context, in model.URLRecord) model.URLRecord {
+	now := time.Now()
+	if !in.CreatedAt.IsZero() {
+		now = in.CreatedAt
+	}
+	now = now.UTC().Truncate(time.Millisecond)
+	rec := in
+	rec.CreatedAt, rec.UpdatedAt = now, now
+	rec.ScanStatus = "unchecked"
+	rec.ScannedAt = nil
+	rec.UTM = decodeParams(encodeParams(in.UTM))
+	rec.Active = true
+	rec.ClickCount = 0
+	rec.Tenant = tenantID(ctx)
+	if in.ExpiresAt != nil {
+		t := in.ExpiresAt.UTC().Truncate(time.Millisecond)
+		rec.ExpiresAt = &t
+	}
+	return rec
+}
+
+// create claims rec's destination, unless it is unique, then its code, and
+// indexes it under its owner.
+func (r *CassandraRepo) create(ctx context.Context, rec model.URLRecord) error {
+	if !rec.Unique {
+		ok, err := r.cas(ctx, `INSERT INTO links_by_long (tenant, domain, long_url, code) VALUES (?, ?, ?, ?) IF NOT EXISTS`, rec.Tenant, rec.Domain, rec.LongUrl, rec.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDuplicateLongURL
+		}
+	}
+
+	ok, err := r.cas(ctx, `INSERT INTO links (`+cassandraColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		rec.Code, rec.ID, rec.LongUrl, rec.ShortUrl, rec.CreatedAt, rec.UpdatedAt, rec.ScanStatus, rec.ScannedAt, encodeParams(rec.UTM), rec.Owner, rec.Active, rec.Domain, rec.ExpiresAt, rec.Title, rec.Description, rec.Org, rec.OriginalURL, !rec.Unique, rec.MaxClicks, rec.ClickCount, rec.Tenant, rec.FallbackURL)
+	if err == nil && !ok {
+		err = ErrDuplicateCode
+	}
+	if err != nil {
+		if !rec.Unique {
+			r.release(ctx, rec.Tenant, rec.Domain, rec.LongUrl, rec.Code)
+		}
+		return err
+	}
+
+	if rec.Owner != "" {
+		return r.exec(ctx, `INSERT INTO links_by_owner (owner, code) VALUES (?, ?)`, rec.Owner, rec.Code)
+	}
+	return nil
+}
+
+// release drops code's claim on a destination, unless another link has
+// claimed it since. Failures leave a claim GetByLong sees through.
+func (r *CassandraRepo) release(ctx context.Context, tenant, domain, long, code string) {
+	r.cas(ctx, `DELETE FROM links_by_long WHERE tenant=? AND domain=? AND long_url=? IF code=?`, tenant, domain, long, code)
+}
+
+func (r *CassandraRepo) Insert(ctx context.Context, in model.URLRecord) (model.URLRecord, error) {
+	rec := newCassandraRecord(ctx, in)
+	if err := r.create(ctx, rec); err != nil {
+		return model.URLRecord{}, err
+	}
+	return rec, nil
+}
+
+func (r *CassandraRepo) Upsert(ctx context.Context, in model.URLRecord) (model.URLRecord, bool, error) {
+	if !in.Unique {
+		rec, err := r.GetByLong(ctx, in.Domain, in.LongUrl)
+		if !errors.Is(err, ErrNotFound) {
+			return rec, false, err
+		}
+	}
+	rec := newCassandraRecord(ctx, in)
+	if in.ScanStatus != "" {
+		rec.ScanStatus = in.ScanStatus
+		if in.ScannedAt != nil {
+			t := in.ScannedAt.UTC().Truncate(time.Millisecond)
+			rec.ScannedAt = &t
+		}
+	}
+	err := r.create(ctx, rec)
+	if errors.Is(err, ErrDuplicateLongURL) {
+		// Claimed concurrently since the lookup above.
+		rec, err = r.GetByLong(ctx, in.Domain, in.LongUrl)
+		return rec, false, err
+	}
+	if err != nil {
+		return model.URLRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (r *CassandraRepo) Update(ctx context.Context, in model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	rec, err := r.GetByCode(ctx, in.Code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if !rec.UpdatedAt.Equal(prev) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	oldLong := rec.LongUrl
+	moved := !rec.Unique && oldLong != in.LongUrl
+
+	rec.LongUrl = in.LongUrl
+	rec.UTM = decodeParams(encodeParams(in.UTM))
+	rec.ScanStatus = in.ScanStatus
+	rec.ScannedAt = in.ScannedAt
+	rec.Title = in.Title
+	rec.Description = in.Description
+	rec.OriginalURL = in.OriginalURL
+	rec.FallbackURL = in.FallbackURL
+	rec.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	if moved {
+		ok, err := r.cas(ctx, `INSERT INTO links_by_long (tenant, domain, long_url, code) VALUES (?, ?, ?, ?) IF NOT EXISTS`, rec.Tenant, rec.Domain, rec.LongUrl, rec.Code)
+		if err != nil {
+			return model.URLRecord{}, err
+		}
+		if !ok {
+			return model.URLRecord{}, ErrDuplicateLongURL
+		}
+	}
+	ok, err := r.cas(ctx, `UPDATE links SET long_url=?, utm=?, scan_status=?, scanned_at=?, title=?, description=?, original_url=?, fallback_url=?, updated_at=? WHERE code=? IF updated_at=?`,
+		rec.LongUrl, encodeParams(rec.UTM), rec.ScanStatus, rec.ScannedAt, rec.Title, rec.Description, rec.OriginalURL, rec.FallbackURL, rec.UpdatedAt, rec.Code, prev)
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	if err != nil {
+		if moved {
+			r.release(ctx, rec.Tenant, rec.Domain, rec.LongUrl, rec.Code)
+		}
+		return model.URLRecord{}, err
+	}
+	if moved {
+		r.release(ctx, rec.Tenant, rec.Domain, oldLong, rec.Code)
+	}
+	return rec, nil
+}
+
+func (r *CassandraRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	rec, err := r.GetByCode(ctx, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	rec.Active = active
+	rec.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	ok, err := r.cas(ctx, `UPDATE links SET active=?, updated_at=? WHERE code=? IF EXISTS`, rec.Active, rec.UpdatedAt, code)
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	return rec, nil
+}
+
+func (r *CassandraRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	// Each attempt sets the count one above the one it read, on the
+	// condition that it is still that; a concurrent redirect that got there
+	// first sends this one round again.
+	for range takeClickAttempts {
+		rec, err := r.GetByCode(ctx, code)
+		if err != nil {
+			return model.URLRecord{}, err
+		}
+		if !rec.Active || rec.MaxClicks <= 0 || rec.Exhausted() {
+			return model.URLRecord{}, ErrNotFound
+		}
+		count := rec.ClickCount
+		rec.ClickCount++
+		if rec.Exhausted() {
+			rec.Active = false
+			rec.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+		}
+		ok, err := r.cas(ctx, `UPDATE links SET click_count=?, active=?, updated_at=? WHERE code=? IF click_count=? AND active=true`,
+			rec.ClickCount, rec.Active, rec.UpdatedAt, code, count)
+		if err != nil {
+			return model.URLRecord{}, err
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	return model.URLRecord{}, errors.New("take click: too much contention on " + code)
+}
+
+func (r *CassandraRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	if _, err := r.GetByCode(ctx, code); err != nil {
+		return err
+	}
+	ok, err := r.cas(ctx, `UPDATE links SET scan_status=?, scanned_at=? WHERE code=? IF EXISTS`, status, time.Now().UTC(), code)
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (r *CassandraRepo) Delete(ctx context.Context, code string) error {
+	rec, err := r.GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	return r.delete(ctx, rec)
+}
+
+// delete removes rec with its destination claim and owner index entry.
+func (r *CassandraRepo) delete(ctx context.Context, rec model.URLRecord) error {
+	ok, err := r.cas(ctx, `DELETE FROM links WHERE code=? IF EXISTS`, rec.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	if !rec.Unique {
+		r.release(ctx, rec.Tenant, rec.Domain, rec.LongUrl, rec.Code)
+	}
+	if rec.Owner != "" {
+		return r.exec(ctx, `DELETE FROM links_by_owner WHERE owner=? AND code=?`, rec.Owner, rec.Code)
+	}
+	return nil
+}
+
+// ownerLinks calls fn with owner's links visible to ctx after the code
+// after, in code order, until fn returns false.
+func (r *CassandraRepo) ownerLinks(ctx context.Context, owner, after string, fn func(model.URLRecord) bool) error {
+	return r.iter(ctx, func(scan func(dest ...any) error) (bool, error) {
+		var code string
+		if err := scan(&code); err != nil {
+			return false, err
+		}
+		rec, err := r.GetByCode(ctx, code)
+		if errors.Is(err, ErrNotFound) {
+			// Another tenant's, or deleted since.
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return fn(rec), nil
+	}, `SELECT code FROM links_by_owner WHERE owner=? AND code > ?`, owner, after)
+}
+
+func (r *CassandraRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	query = strings.ToLower(query)
+	var recs []model.URLRecord
+	err := r.ownerLinks(ctx, owner, "", func(rec model.URLRecord) bool {
+		if strings.Contains(strings.ToLower(rec.LongUrl), query) {
+			recs = append(recs, rec)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (r *CassandraRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	err := r.ownerLinks(ctx, owner, after, func(rec model.URLRecord) bool {
+		recs = append(recs, rec)
+		return len(recs) < limit
+	})
+	return recs, err
+}
+
+// scan calls fn with every link visible to ctx until fn returns false.
+func (r *CassandraRepo) scan(ctx context.Context, fn func(model.URLRecord) bool) error {
+	return r.iter(ctx, func(scan func(dest ...any) error) (bool, error) {
+		rec, err := scanCassandra(scan)
+		if err != nil {
+			return false, err
+		}
+		if !inTenant(ctx, rec) {
+			return true, nil
+		}
+		return fn(rec), nil
+	}, `SELECT `+cassandraColumns+` FROM links`)
+}
+
+func (r *CassandraRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	err := r.scan(ctx, func(rec model.URLRecord) bool {
+		if rec.ScanStatus != "flagged" && (rec.ScannedAt == nil || rec.ScannedAt.Before(before)) {
+			recs = append(recs, rec)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		a, b := recs[i].ScannedAt, recs[j].ScannedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+func (r *CassandraRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	var stale []model.URLRecord
+	err := r.scan(ctx, func(rec model.URLRecord) bool {
+		expired := rec.ExpiresAt != nil && rec.ExpiresAt.Before(expiredBefore)
+		disabled := !disabledBefore.IsZero() && !rec.Active && rec.UpdatedAt.Before(disabledBefore)
+		if expired || disabled {
+			stale = append(stale, rec)
+		}
+		return len(stale) < limit
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, rec := range stale {
+		err := r.delete(ctx, rec)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *CassandraRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	return r.iter(ctx, func(scan func(dest ...any) error) (bool, error) {
+		var code string
+		if err := scan(&code); err != nil {
+			return false, err
+		}
+		return true, fn(code)
+	}, `SELECT code FROM links`)
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/gocql/gocql"
+)
+
+func TestScanCassandra(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	want := model.URLRecord{
+		ID: "id-1", Code: "xyz789", LongUrl: "https://example.com/a", ShortUrl: "https://shawt.ly/xyz789",
+		CreatedAt: created, UpdatedAt: created, ScanStatus: "clean", ScannedAt: &created,
+		UTM: map[string]string{"utm_source": "mail"}, Owner: "alice", Active: true, ExpiresAt: &created,
+		Unique: true, MaxClicks: 3, ClickCount: 2, Tenant: "t1", FallbackURL: "https://example.com/gone",
+	}
+	local := created.In(time.FixedZone("EET", 2*60*60))
+	row := []any{
+		want.Code, want.ID, want.LongUrl, want.ShortUrl, local, local, want.ScanStatus, &local,
+		encodeParams(want.UTM), want.Owner, want.Active, want.Domain, &local, want.Title, want.Description,
+		want.Org, want.OriginalURL, false, want.MaxClicks, want.ClickCount, want.Tenant, want.FallbackURL,
+	}
+	scan := func(dest ...any) error {
+		if len(dest) != len(row) {
+			t.Fatalf("expected %d columns, got %d", len(row), len(dest))
+		}
+		for i, v := range row {
+			reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(v))
+		}
+		return nil
+	}
+
+	got, err := scanCassandra(scan)
+	if err != nil {
+		t.Fatalf("scanCassandra: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("row:\nwant %+v\ngot  %+v", want, got)
+	}
+
+	_, err = scanCassandra(func(...any) error { return gocql.ErrNotFound })
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing row, got %v", err)
+	}
+}
+
+func TestNewCassandraRecord(t *testing.T) {
+	ctx := WithTenant(context.Background(), "t1")
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 999999, time.UTC)
+	rec := newCassandraRecord(ctx, model.URLRecord{Code: "abc", ScanStatus: "flagged", ClickCount: 5, ExpiresAt: &expires})
+	if rec.CreatedAt.IsZero() || !rec.CreatedAt.Equal(rec.CreatedAt.Truncate(time.Millisecond)) {
+		t.Errorf("expected created_at at millisecond precision, got %v", rec.CreatedAt)
+	}
+	if !rec.ExpiresAt.Equal(expires.Truncate(time.Millisecond)) {
+		t.Errorf("expected expires_at at millisecond precision, got %v", rec.ExpiresAt)
+	}
+	if rec.Tenant != "t1" || !rec.Active || rec.ScanStatus != "unchecked" || rec.ClickCount != 0 {
+		t.Errorf("expected a fresh active link in tenant t1, got %+v", rec)
+	}
+}
@@ -0,0 +1,426 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// ClickRepo stores raw click events.
+type ClickRepo interface {
+	InsertClicks(ctx context.Context, events []model.ClickEvent) error
+	// CountClicks returns how many clicks code has received.
+	CountClicks(ctx context.Context, code string) (int, error)
+}
+
+// ClickStatsRepo answers aggregate questions about clicks: per-day totals
+// rolled up from the raw events, and breakdowns of the events themselves.
+type ClickStatsRepo interface {
+	// RollupClicks recounts the daily totals from the raw events. Days before
+	// the latest rolled-up one are final and are not counted again.
+	RollupClicks(ctx context.Context) error
+	// DailyClicks returns code's totals for the UTC days from..to, oldest
+	// first. Days without clicks are left out.
+	DailyClicks(ctx context.Context, code string, from, to time.Time) ([]model.DailyClicks, error)
+	// ClickBreakdown counts code's clicks at or after from and before to by
+	// the click field named by by, one of the model.Breakdown* constants,
+	// most clicked first.
+	ClickBreakdown(ctx context.Context, code, by string, from, to time.Time) ([]model.ClickCount, error)
+	// TopCodes returns up to limit codes with the most clicks in the daily
+	// totals from the UTC day of since on, most clicked first.
+	TopCodes(ctx context.Context, since time.Time, limit int) ([]string, error)
+	// PruneClicks deletes up to limit raw events from before before and
+	// returns how many went. The daily totals are kept.
+	PruneClicks(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+// breakdownColumns maps breakdowns to the click_events columns they group by.
+var breakdownColumns = map[string]string{
+	model.BreakdownCountry:   "country",
+	model.BreakdownReferrer:  "referrer",
+	model.BreakdownUserAgent: "user_agent",
+}
+
+// breakdownField returns the value of ev that the breakdown by groups by.
+func breakdownField(ev model.ClickEvent, by string) string {
+	switch by {
+	case model.BreakdownCountry:
+		return ev.Country
+	case model.BreakdownReferrer:
+		return ev.Referrer
+	case model.BreakdownUserAgent:
+		return ev.UserAgent
+	}
+	return ""
+}
+
+const clickColumns = `code, clicked_at, referrer, ip_hash, user_agent, country, region`
+
+// multiInsert appends rows tuples of cols placeholders to head, producing a
+// multi-row INSERT. placeholder(i) spells the i-th (1-based) argument.
+func multiInsert(head string, rows, cols int, placeholder func(i int) string) string {
+	var b strings.Builder
+	b.WriteString(head)
+	b.WriteString(" VALUES ")
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for col := 0; col < cols; col++ {
+			if col > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(placeholder(row*cols + col + 1))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func pgPlaceholder(i int) string { return fmt.Sprintf("$%d", i) }
+
+func mysqlPlaceholder(int) string { return "?" }
+
+func clickArgs(events []model.ClickEvent) []any {
+	args := make([]any, 0, len(events)*7)
+	for _, ev := range events {
+		args = append(args, ev.Code, ev.ClickedAt, ev.Referrer, ev.IPHash, ev.UserAgent, ev.Country, ev.Region)
+	}
+	return args
+}
+
+func (r *PostgresRepo) InsertClicks(ctx context.Context, events []model.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	q := multiInsert(`INSERT INTO click_events (`+clickColumns+`)`, len(events), 7, pgPlaceholder)
+	_, err := r.db.ExecContext(ctx, q, clickArgs(events)...)
+	return err
+}
+
+func (r *MySQLRepo) InsertClicks(ctx context.Context, events []model.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	q := multiInsert(`INSERT INTO click_events (`+clickColumns+`)`, len(events), 7, mysqlPlaceholder)
+	_, err := r.db.ExecContext(ctx, q, clickArgs(events)...)
+	return err
+}
+
+func (r *MemoryRepo) InsertClicks(ctx context.Context, events []model.ClickEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clicks = append(r.clicks, events...)
+	return nil
+}
+
+func (r *PostgresRepo) CountClicks(ctx context.Context, code string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM click_events WHERE code=$1`, code).Scan(&n)
+	return n, err
+}
+
+func (r *MySQLRepo) CountClicks(ctx context.Context, code string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM click_events WHERE code=?`, code).Scan(&n)
+	return n, err
+}
+
+func (r *MemoryRepo) CountClicks(ctx context.Context, code string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int
+	for _, ev := range r.clicks {
+		if ev.Code == code {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// rollupSince returns when the events to roll up start: the day before the
+// latest rolled-up day, so clicks flushed just after midnight still reach
+// their day, or the zero time when nothing has been rolled up yet.
+func rollupSince(ctx context.Context, db *sql.DB) (time.Time, error) {
+	var last sql.NullTime
+	if err := db.QueryRowContext(ctx, `SELECT MAX(day) FROM click_daily`).Scan(&last); err != nil {
+		return time.Time{}, err
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	return last.Time.AddDate(0, 0, -1), nil
+}
+
+func (r *PostgresRepo) RollupClicks(ctx context.Context) error {
+	since, err := rollupSince(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO click_daily (code, day, clicks)
+		SELECT code, (clicked_at AT TIME ZONE 'UTC')::date, COUNT(*)
+		FROM click_events
+		WHERE clicked_at >= $1
+		GROUP BY 1, 2
+		ON CONFLICT (code, day) DO UPDATE SET clicks = EXCLUDED.clicks`
+	_, err = r.db.ExecContext(ctx, q, since)
+	return err
+}
+
+func (r *MySQLRepo) RollupClicks(ctx context.Context) error {
+	since, err := rollupSince(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO click_daily (code, day, clicks)
+		SELECT code, DATE(clicked_at), COUNT(*)
+		FROM click_events
+		WHERE clicked_at >= ?
+		GROUP BY code, DATE(clicked_at)
+		ON DUPLICATE KEY UPDATE clicks = VALUES(clicks)`
+	_, err = r.db.ExecContext(ctx, q, since)
+	return err
+}
+
+func (r *MemoryRepo) RollupClicks(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var since string
+	for key := range r.daily {
+		since = max(since, key.day)
+	}
+	if t, err := time.Parse(time.DateOnly, since); err == nil {
+		since = t.AddDate(0, 0, -1).Format(time.DateOnly)
+	}
+
+	counts := make(map[dailyKey]int)
+	for _, ev := range r.clicks {
+		day := ev.ClickedAt.UTC().Format(time.DateOnly)
+		if day >= since {
+			counts[dailyKey{ev.Code, day}]++
+		}
+	}
+	for key, n := range counts {
+		r.daily[key] = n
+	}
+	return nil
+}
+
+func (r *PostgresRepo) PruneClicks(ctx context.Context, before time.Time, limit int) (int, error) {
+	const q = `
+		DELETE FROM click_events WHERE id IN (
+			SELECT id FROM click_events WHERE clicked_at < $1 LIMIT $2
+		)`
+
+	res, err := r.db.ExecContext(ctx, q, before, limit)
+	return rowsAffected(res, err)
+}
+
+func (r *MySQLRepo) PruneClicks(ctx context.Context, before time.Time, limit int) (int, error) {
+	const q = `DELETE FROM click_events WHERE clicked_at < ? LIMIT ?`
+
+	res, err := r.db.ExecContext(ctx, q, before, limit)
+	return rowsAffected(res, err)
+}
+
+func (r *MemoryRepo) PruneClicks(ctx context.Context, before time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.clicks[:0]
+	var n int
+	for _, ev := range r.clicks {
+		if n < limit && ev.ClickedAt.Before(before) {
+			n++
+			continue
+		}
+		kept = append(kept, ev)
+	}
+	r.clicks = kept
+	return n, nil
+}
+
+func scanDailyClicks(rows *sql.Rows) ([]model.DailyClicks, error) {
+	defer rows.Close()
+
+	var days []model.DailyClicks
+	for rows.Next() {
+		var day time.Time
+		var d model.DailyClicks
+		if err := rows.Scan(&day, &d.Clicks); err != nil {
+			return nil, err
+		}
+		d.Day = day.Format(time.DateOnly)
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+func (r *PostgresRepo) DailyClicks(ctx context.Context, code string, from, to time.Time) ([]model.DailyClicks, error) {
+	const q = `SELECT day, clicks FROM click_daily WHERE code=$1 AND day BETWEEN $2 AND $3 ORDER BY day`
+	rows, err := r.db.QueryContext(ctx, q, code, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	return scanDailyClicks(rows)
+}
+
+func (r *MySQLRepo) DailyClicks(ctx context.Context, code string, from, to time.Time) ([]model.DailyClicks, error) {
+	const q = `SELECT day, clicks FROM click_daily WHERE code=? AND day BETWEEN ? AND ? ORDER BY day`
+	rows, err := r.db.QueryContext(ctx, q, code, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	return scanDailyClicks(rows)
+}
+
+func (r *MemoryRepo) DailyClicks(ctx context.Context, code string, from, to time.Time) ([]model.DailyClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	first, last := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	var days []model.DailyClicks
+	for key, n := range r.daily {
+		if key.code == code && key.day >= first && key.day <= last {
+			days = append(days, model.DailyClicks{Day: key.day, Clicks: n})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
+
+func (r *PostgresRepo) TopCodes(ctx context.Context, since time.Time, limit int) ([]string, error) {
+	const q = `SELECT code FROM click_daily WHERE day >= $1 GROUP BY code ORDER BY SUM(clicks) DESC, code LIMIT $2`
+	return queryCodes(ctx, r.db, q, since.UTC().Format(time.DateOnly), limit)
+}
+
+func (r *MySQLRepo) TopCodes(ctx context.Context, since time.Time, limit int) ([]string, error) {
+	const q = `SELECT code FROM click_daily WHERE day >= ? GROUP BY code ORDER BY SUM(clicks) DESC, code LIMIT ?`
+	return queryCodes(ctx, r.db, q, since.UTC().Format(time.DateOnly), limit)
+}
+
+func (r *MemoryRepo) TopCodes(ctx context.Context, since time.Time, limit int) ([]string, error) {
+	r.mu.RLock()
+	first := since.UTC().Format(time.DateOnly)
+	byCode := make(map[string]int)
+	for key, n := range r.daily {
+		if key.day >= first {
+			byCode[key.code] += n
+		}
+	}
+	r.mu.RUnlock()
+
+	codes := make([]string, 0, len(byCode))
+	for code := range byCode {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if byCode[codes[i]] != byCode[codes[j]] {
+			return byCode[codes[i]] > byCode[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	return codes[:min(limit, len(codes))], nil
+}
+
+// queryCodes runs q, which selects a single code column, for both SQL
+// dialects.
+func queryCodes(ctx context.Context, db *sql.DB, q string, args ...any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+func scanClickCounts(rows *sql.Rows) ([]model.ClickCount, error) {
+	defer rows.Close()
+
+	var counts []model.ClickCount
+	for rows.Next() {
+		var c model.ClickCount
+		if err := rows.Scan(&c.Value, &c.Clicks); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (r *PostgresRepo) ClickBreakdown(ctx context.Context, code, by string, from, to time.Time) ([]model.ClickCount, error) {
+	col, ok := breakdownColumns[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown click breakdown %q", by)
+	}
+	q := `SELECT ` + col + `, COUNT(*) FROM click_events
+		WHERE code=$1 AND clicked_at >= $2 AND clicked_at < $3
+		GROUP BY 1 ORDER BY 2 DESC, 1`
+	rows, err := r.db.QueryContext(ctx, q, code, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanClickCounts(rows)
+}
+
+func (r *MySQLRepo) ClickBreakdown(ctx context.Context, code, by string, from, to time.Time) ([]model.ClickCount, error) {
+	col, ok := breakdownColumns[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown click breakdown %q", by)
+	}
+	q := `SELECT ` + col + `, COUNT(*) FROM click_events
+		WHERE code=? AND clicked_at >= ? AND clicked_at < ?
+		GROUP BY 1 ORDER BY 2 DESC, 1`
+	rows, err := r.db.QueryContext(ctx, q, code, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanClickCounts(rows)
+}
+
+func (r *MemoryRepo) ClickBreakdown(ctx context.Context, code, by string, from, to time.Time) ([]model.ClickCount, error) {
+	if _, ok := breakdownColumns[by]; !ok {
+		return nil, fmt.Errorf("unknown click breakdown %q", by)
+	}
+
+	r.mu.RLock()
+	byValue := make(map[string]int)
+	for _, ev := range r.clicks {
+		if ev.Code == code && !ev.ClickedAt.Before(from) && ev.ClickedAt.Before(to) {
+			byValue[breakdownField(ev, by)]++
+		}
+	}
+	r.mu.RUnlock()
+
+	counts := make([]model.ClickCount, 0, len(byValue))
+	for v, n := range byValue {
+		counts = append(counts, model.ClickCount{Value: v, Clicks: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Clicks != counts[j].Clicks {
+			return counts[i].Clicks > counts[j].Clicks
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	return counts, nil
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"sync/atomic"
+
+	"urlshortener/urlshortener/internal/bloom"
+	"urlshortener/urlshortener/internal/model"
+)
+
+// codeFilterRate is the share of unknown codes the filter lets through.
+const codeFilterRate = 0.01
+
+// CodeFilter is a URLRepo that keeps a Bloom filter of every code and
+// answers GetByCode for codes certainly not in it without a query, which
+// turns away nearly all lookups of made-up codes. Until Rebuild has first
+// filled the filter, every lookup is passed on.
+//
+// New links go into the filter before they are stored. Links created by
+// other instances only arrive through Add, or with the next Rebuild.
+type CodeFilter struct {
+	URLRepo
+	announce func(ctx context.Context, code string)
+
+	cur  atomic.Pointer[bloom.Filter]
+	next atomic.Pointer[bloom.Filter] // being filled by Rebuild
+
+	hits, misses atomic.Int64
+}
+
+// WithCodeFilter wraps r with an empty filter. announce, if not nil, is
+// told the code of every link stored, for the other instances to Add.
+func WithCodeFilter(r URLRepo, announce func(ctx context.Context, code string)) *CodeFilter {
+	return &CodeFilter{URLRepo: r, announce: announce}
+}
+
+// Rebuild fills a new filter, sized for twice the codes there are or at
+// least minSize, from EachCode and swaps it in. Codes added meanwhile go
+// into both filters.
+func (r *CodeFilter) Rebuild(ctx context.Context, minSize int) (int, error) {
+	var n int
+	if err := r.URLRepo.EachCode(ctx, func(string) error { n++; return nil }); err != nil {
+		return 0, err
+	}
+	f := bloom.New(max(2*n, minSize), codeFilterRate)
+	r.next.Store(f)
+	defer r.next.Store(nil)
+
+	n = 0
+	err := r.URLRepo.EachCode(ctx, func(code string) error {
+		f.Add(code)
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.cur.Store(f)
+	return n, nil
+}
+
+// Add puts a code stored elsewhere, such as by another instance, into the
+// filter.
+func (r *CodeFilter) Add(code string) {
+	if f := r.cur.Load(); f != nil {
+		f.Add(code)
+	}
+	if f := r.next.Load(); f != nil {
+		f.Add(code)
+	}
+}
+
+func (r *CodeFilter) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	if f := r.cur.Load(); f != nil && !f.MayContain(code) {
+		r.hits.Add(1)
+		return model.URLRecord{}, ErrNotFound
+	}
+	r.misses.Add(1)
+	return r.URLRepo.GetByCode(ctx, code)
+}
+
+// Insert adds the code before storing the link, so no lookup finds the link
+// stored but the code missing, and again after, for a Rebuild that started
+// in between.
+func (r *CodeFilter) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
+	r.Add(rec.Code)
+	out, err := r.URLRepo.Insert(ctx, rec)
+	if err == nil {
+		r.stored(ctx, out.Code)
+	}
+	return out, err
+}
+
+func (r *CodeFilter) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	r.Add(rec.Code)
+	out, created, err := r.URLRepo.Upsert(ctx, rec)
+	if err == nil && created {
+		r.stored(ctx, out.Code)
+	}
+	return out, created, err
+}
+
+func (r *CodeFilter) stored(ctx context.Context, code string) {
+	r.Add(code)
+	if r.announce != nil {
+		r.announce(ctx, code)
+	}
+}
+
+// CacheStats returns how many lookups the filter has turned away, and how
+// many it passed on.
+func (r *CodeFilter) CacheStats() (hits, misses int64) {
+	return r.hits.Load(), r.misses.Load()
+}
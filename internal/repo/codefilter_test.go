@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestCodeFilter(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{MemoryRepo: NewMemory()}
+	inner.Insert(ctx, model.URLRecord{ID: "1", Code: "old", LongUrl: "https://example.com/old"})
+
+	var announced []string
+	r := WithCodeFilter(inner, func(_ context.Context, code string) { announced = append(announced, code) })
+
+	// Before the first build every lookup is passed on.
+	r.GetByCode(ctx, "nope")
+	if inner.lookups != 1 {
+		t.Fatalf("expected the lookup to reach the store, got %d", inner.lookups)
+	}
+
+	if n, err := r.Rebuild(ctx, 100); err != nil || n != 1 {
+		t.Fatalf("expected 1 code loaded, got %d (%v)", n, err)
+	}
+	inner.lookups = 0
+	for range 10 {
+		if _, err := r.GetByCode(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if _, err := r.GetByCode(ctx, "old"); err != nil {
+		t.Errorf("expected an existing code to be found, got %v", err)
+	}
+	if inner.lookups != 1 {
+		t.Errorf("expected only the existing code to reach the store, got %d lookups", inner.lookups)
+	}
+
+	if _, err := r.Insert(ctx, model.URLRecord{ID: "2", Code: "new", LongUrl: "https://example.com/new"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetByCode(ctx, "new"); err != nil {
+		t.Errorf("expected a new link to be found at once, got %v", err)
+	}
+	if len(announced) != 1 || announced[0] != "new" {
+		t.Errorf("expected the new code to be announced, got %v", announced)
+	}
+
+	// Codes stored by other instances arrive through Add.
+	inner.Insert(ctx, model.URLRecord{ID: "3", Code: "elsewhere", LongUrl: "https://example.com/elsewhere"})
+	r.Add("elsewhere")
+	if _, err := r.GetByCode(ctx, "elsewhere"); err != nil {
+		t.Errorf("expected an added code to be found, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// DualWrite is a URLRepo for moving links from one backend to another
+// without downtime. Every write goes to both; from, the backend being left,
+// takes new links first, so it stays complete and keeps codes and
+// destinations unique, and is what listings and background jobs read. Links
+// are looked up in to first, falling back to from for those Backfill has
+// not copied yet. A write that reaches one backend but fails on the second
+// is logged rather than failed, since the first cannot be taken back.
+type DualWrite struct {
+	from, to URLRepo
+}
+
+// NewDualWrite returns a repo migrating links from from to to.
+func NewDualWrite(from, to URLRepo) *DualWrite {
+	return &DualWrite{from: from, to: to}
+}
+
+// mirror logs a failed write to the second backend. Links Backfill has not
+// copied yet are missing from to, which is expected.
+func mirror(op, code string, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("dual write: %s %s: %v", op, code, err)
+	}
+}
+
+func (r *DualWrite) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	rec, err := r.to.GetByCode(ctx, code)
+	if errors.Is(err, ErrNotFound) {
+		return r.from.GetByCode(ctx, code)
+	}
+	return rec, err
+}
+
+func (r *DualWrite) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	rec, err := r.to.GetByLong(ctx, domain, long)
+	if errors.Is(err, ErrNotFound) {
+		return r.from.GetByLong(ctx, domain, long)
+	}
+	return rec, err
+}
+
+func (r *DualWrite) Insert(ctx context.Context, in model.URLRecord) (model.URLRecord, error) {
+	rec, err := r.from.Insert(ctx, in)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if _, err := r.to.Insert(ctx, rec); err != nil {
+		// Without a copy in to the link would vanish when the migration
+		// ends, so it is not made at all.
+		if derr := r.from.Delete(ctx, rec.Code); derr != nil {
+			log.Printf("dual write: undo insert %s: %v", rec.Code, derr)
+		}
+		return model.URLRecord{}, err
+	}
+	return rec, nil
+}
+
+func (r *DualWrite) Upsert(ctx context.Context, in model.URLRecord) (model.URLRecord, bool, error) {
+	rec, created, err := r.from.Upsert(ctx, in)
+	if err != nil || !created {
+		return rec, created, err
+	}
+	if _, _, err := r.to.Upsert(ctx, rec); err != nil {
+		if derr := r.from.Delete(ctx, rec.Code); derr != nil {
+			log.Printf("dual write: undo upsert %s: %v", rec.Code, derr)
+		}
+		return model.URLRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (r *DualWrite) Update(ctx context.Context, in model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	// prev comes from to's copy when there is one, so to checks it; from's
+	// copy, stamped at other times, is then updated unconditionally.
+	rec, err := r.to.Update(ctx, in, prev)
+	if errors.Is(err, ErrNotFound) {
+		if _, gerr := r.to.GetByCode(ctx, in.Code); errors.Is(gerr, ErrNotFound) {
+			return r.from.Update(ctx, in, prev)
+		}
+	}
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	old, err := r.from.GetByCode(ctx, in.Code)
+	if err == nil {
+		_, err = r.from.Update(ctx, in, old.UpdatedAt)
+	}
+	mirror("update", in.Code, err)
+	return rec, nil
+}
+
+func (r *DualWrite) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	rec, err := r.from.SetActive(ctx, code, active)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	_, err = r.to.SetActive(ctx, code, active)
+	mirror("set active", code, err)
+	return rec, nil
+}
+
+func (r *DualWrite) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	// from counts every click, so its count decides; to follows it.
+	rec, err := r.from.TakeClick(ctx, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	_, err = r.to.TakeClick(ctx, code)
+	mirror("take click", code, err)
+	return rec, nil
+}
+
+func (r *DualWrite) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	if err := r.from.UpdateScanStatus(ctx, code, status); err != nil {
+		return err
+	}
+	mirror("update scan status", code, r.to.UpdateScanStatus(ctx, code, status))
+	return nil
+}
+
+func (r *DualWrite) Delete(ctx context.Context, code string) error {
+	err := r.from.Delete(ctx, code)
+	terr := r.to.Delete(ctx, code)
+	if errors.Is(err, ErrNotFound) {
+		// Gone from from already, as after a failed mirror.
+		return terr
+	}
+	mirror("delete", code, terr)
+	return err
+}
+
+func (r *DualWrite) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	return r.from.ListByOwner(ctx, owner, query, limit, offset)
+}
+
+func (r *DualWrite) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	return r.from.ListAfter(ctx, owner, after, limit)
+}
+
+func (r *DualWrite) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	return r.from.ListForScan(ctx, before, limit)
+}
+
+// DeleteStale deletes from from and then, as far as Backfill has copied
+// them, the same links from to, returning from's count.
+func (r *DualWrite) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	n, err := r.from.DeleteStale(ctx, expiredBefore, disabledBefore, limit)
+	if err != nil {
+		return n, err
+	}
+	if _, err := r.to.DeleteStale(ctx, expiredBefore, disabledBefore, limit); err != nil {
+		log.Printf("dual write: delete stale: %v", err)
+	}
+	return n, nil
+}
+
+func (r *DualWrite) EachCode(ctx context.Context, fn func(code string) error) error {
+	return r.from.EachCode(ctx, fn)
+}
+
+// BackfillResult counts the links Backfill went through.
+type BackfillResult struct {
+	// Copied links were missing from to and have been written to it.
+	Copied int
+	// Present links were in to already, written through DualWrite or an
+	// earlier run.
+	Present int
+	// Conflicts are links from has whose destination to already gives
+	// another code; they are left for an operator to sort out.
+	Conflicts []string
+}
+
+// Backfill copies the links of every tenant that from has and to lacks, so
+// that to can take over. It is safe to run while DualWrite serves traffic,
+// and to run again after an interruption. Copies keep their code, times,
+// scan state, whether they are active and, by replaying it, their click
+// count; progress, when not nil, is called after each link.
+func (r *DualWrite) Backfill(ctx context.Context, progress func(BackfillResult)) (BackfillResult, error) {
+	var res BackfillResult
+	all := AllTenants(ctx)
+	err := r.from.EachCode(all, func(code string) error {
+		rec, err := r.from.GetByCode(all, code)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted since.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch _, err := r.to.GetByCode(all, code); {
+		case err == nil:
+			res.Present++
+		case !errors.Is(err, ErrNotFound):
+			return err
+		default:
+			copied, err := r.copy(WithTenant(ctx, rec.Tenant), rec)
+			if err != nil {
+				return err
+			}
+			if copied {
+				res.Copied++
+			} else {
+				res.Conflicts = append(res.Conflicts, code)
+			}
+		}
+		if progress != nil {
+			progress(res)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// copy writes rec to to, reporting false when its destination is taken
+// there.
+func (r *DualWrite) copy(ctx context.Context, rec model.URLRecord) (bool, error) {
+	out, created, err := r.to.Upsert(ctx, rec)
+	if errors.Is(err, ErrDuplicateCode) {
+		// Written through DualWrite since it was looked for.
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !created {
+		return out.Code == rec.Code, nil
+	}
+	// TakeClick is the only way to raise a count, and disables the link
+	// itself on its last click.
+	for range min(rec.ClickCount, int64(rec.MaxClicks)) {
+		if _, err := r.to.TakeClick(ctx, rec.Code); err != nil {
+			return false, err
+		}
+	}
+	if !rec.Active && !rec.Exhausted() {
+		if _, err := r.to.SetActive(ctx, rec.Code, false); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
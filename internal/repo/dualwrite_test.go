@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestDualWrite(t *testing.T) {
+	ctx := context.Background()
+	from, to := NewMemory(), NewMemory()
+	if _, err := from.Insert(ctx, model.URLRecord{Code: "old", LongUrl: "https://example.com/old"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	r := NewDualWrite(from, to)
+
+	if _, err := r.GetByCode(ctx, "old"); err != nil {
+		t.Errorf("expected links not yet copied to be found in from, got %v", err)
+	}
+	if _, err := r.Insert(ctx, model.URLRecord{Code: "old", LongUrl: "https://example.com/other"}); !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("expected codes taken in from to be refused, got %v", err)
+	}
+
+	rec, err := r.Insert(ctx, model.URLRecord{Code: "new", LongUrl: "https://example.com/new"})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	for name, b := range map[string]URLRepo{"from": from, "to": to} {
+		if got, err := b.GetByCode(ctx, "new"); err != nil || !got.CreatedAt.Equal(rec.CreatedAt) {
+			t.Errorf("expected the new link in %s as created, got %+v (%v)", name, got, err)
+		}
+	}
+
+	rec.LongUrl = "https://example.com/moved"
+	if _, err := r.Update(ctx, rec, rec.UpdatedAt); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, _ := from.GetByCode(ctx, "new"); got.LongUrl != rec.LongUrl {
+		t.Errorf("expected the update mirrored to from, got %q", got.LongUrl)
+	}
+
+	if err := r.Delete(ctx, "old"); err != nil {
+		t.Errorf("expected links only in from to be deletable, got %v", err)
+	}
+	if err := r.Delete(ctx, "old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestDualWrite_Backfill(t *testing.T) {
+	ctx := context.Background()
+	from, to := NewMemory(), NewMemory()
+	for _, rec := range []model.URLRecord{
+		{Code: "a", LongUrl: "https://example.com/a", MaxClicks: 3},
+		{Code: "b", LongUrl: "https://example.com/b"},
+		{Code: "c", LongUrl: "https://example.com/c"},
+	} {
+		if _, err := from.Insert(WithTenant(ctx, "t1"), rec); err != nil {
+			t.Fatalf("Insert %s: %v", rec.Code, err)
+		}
+	}
+	from.TakeClick(ctx, "a")
+	from.TakeClick(ctx, "a")
+	from.SetActive(ctx, "b", false)
+	// c's destination already has another code in to.
+	to.Insert(WithTenant(ctx, "t1"), model.URLRecord{Code: "x", LongUrl: "https://example.com/c"})
+
+	r := NewDualWrite(from, to)
+	res, err := r.Backfill(ctx, nil)
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	if res.Copied != 2 || res.Present != 0 || len(res.Conflicts) != 1 || res.Conflicts[0] != "c" {
+		t.Errorf("expected a and b copied and c conflicting, got %+v", res)
+	}
+
+	a, err := to.GetByCode(WithTenant(ctx, "t1"), "a")
+	if err != nil || a.ClickCount != 2 || !a.Active {
+		t.Errorf("expected a copied with its clicks into tenant t1, got %+v (%v)", a, err)
+	}
+	if b, _ := to.GetByCode(ctx, "b"); b.Active {
+		t.Error("expected b copied disabled")
+	}
+
+	res, err = r.Backfill(ctx, nil)
+	if err != nil || res.Copied != 0 || res.Present != 2 {
+		t.Errorf("expected a second run to find a and b present, got %+v (%v)", res, err)
+	}
+}
+
+func TestDualWrite_EraseOwner(t *testing.T) {
+	ctx := context.Background()
+	from, to := NewMemory(), NewMemory()
+	// a is only in from, not yet backfilled.
+	from.Insert(ctx, model.URLRecord{Code: "a", LongUrl: "https://example.com/a", Owner: "alice"})
+	r := NewDualWrite(from, to)
+	r.Insert(ctx, model.URLRecord{Code: "b", LongUrl: "https://example.com/b", Owner: "alice"})
+	r.Insert(ctx, model.URLRecord{Code: "c", LongUrl: "https://example.com/c", Owner: "bob"})
+
+	// As the admin service erases: to is the store it erases, and the codes
+	// it read beforehand are deleted through the migration.
+	codes, err := OwnerCodes(ctx, r, "alice")
+	if err != nil || len(codes) != 2 {
+		t.Fatalf("OwnerCodes: expected a and b, got %v (%v)", codes, err)
+	}
+	if _, _, err := to.EraseOwner(ctx, "alice"); err != nil {
+		t.Fatalf("EraseOwner: %v", err)
+	}
+	for _, code := range codes {
+		if err := r.Delete(ctx, code); err != nil && !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Delete %s: %v", code, err)
+		}
+	}
+
+	for _, code := range codes {
+		if _, err := r.GetByCode(ctx, code); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %s erased, got %v", code, err)
+		}
+	}
+	res, err := r.Backfill(ctx, nil)
+	if err != nil || res.Copied != 0 || res.Present != 1 {
+		t.Errorf("expected only c left to backfill, present, got %+v (%v)", res, err)
+	}
+	if _, err := to.GetByCode(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a not copied back, got %v", err)
+	}
+}
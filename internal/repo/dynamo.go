@@ -0,0 +1,674 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoOwnerIndex is the global secondary index on (owner, code) the links
+// table needs for ListByOwner and ListAfter.
+const DynamoOwnerIndex = "owner-code"
+
+// Key prefixes of the two kinds of item in the links table.
+const (
+	dynamoLinkPrefix = "link#"
+	dynamoLongPrefix = "long#"
+)
+
+// DynamoAPI is the part of the DynamoDB client DynamoRepo uses.
+type DynamoAPI interface {
+	GetItem(ctx context.Context, in *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	TransactWriteItems(ctx context.Context, in *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	Query(ctx context.Context, in *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, in *dynamodb.ScanInput, opts ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// DynamoRepo is a URLRepo on a single DynamoDB table with a string
+// partition key "pk". Each link is an item keyed link#<code>, and each link
+// that is found by its destination has a second item keyed by a hash of
+// tenant, domain and long URL that names its code. Both are written in one
+// transaction on the condition that neither exists, which is what keeps
+// codes and destinations unique. Reads of single links are strongly
+// consistent; listings go through the eventually consistent owner index or
+// scan the table.
+type DynamoRepo struct {
+	db    DynamoAPI
+	table string
+}
+
+func NewDynamo(db DynamoAPI, table string) *DynamoRepo {
+	return &DynamoRepo{db: db, table: table}
+}
+
+// dynamoLink is a link as stored. Times are Unix nanoseconds, so Update can
+// compare updated_at exactly. An empty owner is left out, as index keys
+// cannot be empty; anonymous links are simply not in the owner index.
+type dynamoLink struct {
+	PK          string            `dynamodbav:"pk"`
+	ID          string            `dynamodbav:"id"`
+	Code        string            `dynamodbav:"code"`
+	LongURL     string            `dynamodbav:"long_url"`
+	ShortURL    string            `dynamodbav:"short_url"`
+	CreatedAt   int64             `dynamodbav:"created_at"`
+	UpdatedAt   int64             `dynamodbav:"updated_at"`
+	ScanStatus  string            `dynamodbav:"scan_status"`
+	ScannedAt   *int64            `dynamodbav:"scanned_at,omitempty"`
+	UTM         map[string]string `dynamodbav:"utm,omitempty"`
+	Owner       string            `dynamodbav:"owner,omitempty"`
+	Active      bool              `dynamodbav:"active"`
+	Domain      string            `dynamodbav:"domain"`
+	ExpiresAt   *int64            `dynamodbav:"expires_at,omitempty"`
+	Title       string            `dynamodbav:"title"`
+	Description string            `dynamodbav:"description"`
+	Org         string            `dynamodbav:"org"`
+	OriginalURL string            `dynamodbav:"original_url"`
+	Unique      bool              `dynamodbav:"unique"`
+	MaxClicks   int               `dynamodbav:"max_clicks"`
+	ClickCount  int64             `dynamodbav:"click_count"`
+	FallbackURL string            `dynamodbav:"fallback_url,omitempty"`
+	Tenant      string            `dynamodbav:"tenant"`
+}
+
+func encodeDynamo(rec model.URLRecord) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMap(dynamoLink{
+		PK:          dynamoLinkKey(rec.Code),
+		ID:          rec.ID,
+		Code:        rec.Code,
+		LongURL:     rec.LongUrl,
+		ShortURL:    rec.ShortUrl,
+		CreatedAt:   rec.CreatedAt.UnixNano(),
+		UpdatedAt:   rec.UpdatedAt.UnixNano(),
+		ScanStatus:  rec.ScanStatus,
+		ScannedAt:   unixNano(rec.ScannedAt),
+		UTM:         rec.UTM,
+		Owner:       rec.Owner,
+		Active:      rec.Active,
+		Domain:      rec.Domain,
+		ExpiresAt:   unixNano(rec.ExpiresAt),
+		Title:       rec.Title,
+		Description: rec.Description,
+		Org:         rec.Org,
+		OriginalURL: rec.OriginalURL,
+		Unique:      rec.Unique,
+		MaxClicks:   rec.MaxClicks,
+		ClickCount:  rec.ClickCount,
+		FallbackURL: rec.FallbackURL,
+		Tenant:      rec.Tenant,
+	})
+}
+
+func decodeDynamo(item map[string]types.AttributeValue) (model.URLRecord, error) {
+	var l dynamoLink
+	if err := attributevalue.UnmarshalMap(item, &l); err != nil {
+		return model.URLRecord{}, err
+	}
+	return model.URLRecord{
+		ID:          l.ID,
+		Code:        l.Code,
+		LongUrl:     l.LongURL,
+		ShortUrl:    l.ShortURL,
+		CreatedAt:   time.Unix(0, l.CreatedAt).UTC(),
+		UpdatedAt:   time.Unix(0, l.UpdatedAt).UTC(),
+		ScanStatus:  l.ScanStatus,
+		ScannedAt:   fromUnixNano(l.ScannedAt),
+		UTM:         l.UTM,
+		Owner:       l.Owner,
+		Active:      l.Active,
+		Domain:      l.Domain,
+		ExpiresAt:   fromUnixNano(l.ExpiresAt),
+		Title:       l.Title,
+		Description: l.Description,
+		Org:         l.Org,
+		OriginalURL: l.OriginalURL,
+		Unique:      l.Unique,
+		MaxClicks:   l.MaxClicks,
+		ClickCount:  l.ClickCount,
+		FallbackURL: l.FallbackURL,
+		Tenant:      l.Tenant,
+	}, nil
+}
+
+func unixNano(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	n := t.UnixNano()
+	return &n
+}
+
+func fromUnixNano(n *int64) *time.Time {
+	if n == nil {
+		return nil
+	}
+	t := time.Unix(0, *n).UTC()
+	return &t
+}
+
+func dynamoLinkKey(code string) string { return dynamoLinkPrefix + code }
+
+// dynamoLongKey hashes the destination, which may be longer than a key may be.
+func dynamoLongKey(tenant, domain, long string) string {
+	sum := sha256.Sum256([]byte(longKey(tenant, domain, long)))
+	return dynamoLongPrefix + hex.EncodeToString(sum[:])
+}
+
+func dynamoKey(pk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: pk}}
+}
+
+func dynamoS(s string) types.AttributeValue { return &types.AttributeValueMemberS{Value: s} }
+
+func dynamoN(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+func dynamoBool(b bool) types.AttributeValue { return &types.AttributeValueMemberBOOL{Value: b} }
+
+// attrName matches the #name placeholders of an expression.
+var attrName = regexp.MustCompile(`#[a-z_]+`)
+
+// exprNames maps the placeholders used in exprs to the attributes they name;
+// DynamoDB rejects unused ones.
+func exprNames(exprs ...string) map[string]string {
+	names := make(map[string]string)
+	for _, expr := range exprs {
+		for _, n := range attrName.FindAllString(expr, -1) {
+			names[n] = n[1:]
+		}
+	}
+	return names
+}
+
+// tenantCondition extends cond to match only links visible to ctx, adding
+// the value it needs to values.
+func tenantCondition(ctx context.Context, cond string, values map[string]types.AttributeValue) string {
+	id, ok := TenantOf(ctx)
+	if !ok {
+		return cond
+	}
+	values[":tenant"] = dynamoS(id)
+	return cond + " AND #tenant = :tenant"
+}
+
+// mapDynamoError translates a failed condition into ErrNotFound, or, for a
+// transaction, into the error at the index of the write whose condition
+// failed.
+func mapDynamoError(err error, failed ...error) error {
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrNotFound
+	}
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		return err
+	}
+	for i, reason := range tce.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" && i < len(failed) {
+			return failed[i]
+		}
+	}
+	return err
+}
+
+func (r *DynamoRepo) get(ctx context.Context, code string) (model.URLRecord, error) {
+	out, err := r.db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            dynamoKey(dynamoLinkKey(code)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if out.Item == nil {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return decodeDynamo(out.Item)
+}
+
+func (r *DynamoRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	rec, err := r.get(ctx, code)
+	if err == nil && !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+func (r *DynamoRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	tenant := tenantID(ctx)
+	out, err := r.db.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            dynamoKey(dynamoLongKey(tenant, domain, long)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	code, ok := out.Item["code"].(*types.AttributeValueMemberS)
+	if !ok {
+		return model.URLRecord{}, ErrNotFound
+	}
+	rec, err := r.get(ctx, code.Value)
+	if err == nil && (rec.Tenant != tenant || rec.Domain != domain || rec.LongUrl != long) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+// newDynamoRecord fills in what Insert leaves to the database.
+func newDynamoRecord(ctx context.Context, in model.URLRecord) model.URLRecord {
+	now := time.Now().UTC()
+	if !in.CreatedAt.IsZero() {
+		now = in.CreatedAt.UTC()
+	}
+	rec := model.URLRecord{
+		ID:          in.ID,
+		Code:        in.Code,
+		LongUrl:     in.LongUrl,
+		ShortUrl:    in.ShortUrl,
+		CreatedAt:   now,
+		ScanStatus:  "unchecked",
+		UTM:         decodeParams(encodeParams(in.UTM)),
+		Owner:       in.Owner,
+		UpdatedAt:   now,
+		Active:      true,
+		Domain:      in.Domain,
+		Title:       in.Title,
+		Description: in.Description,
+		Org:         in.Org,
+		OriginalURL: in.OriginalURL,
+		Unique:      in.Unique,
+		MaxClicks:   in.MaxClicks,
+		FallbackURL: in.FallbackURL,
+		Tenant:      tenantID(ctx),
+	}
+	if in.ExpiresAt != nil {
+		t := in.ExpiresAt.UTC()
+		rec.ExpiresAt = &t
+	}
+	return rec
+}
+
+// create writes a new link and, unless it is unique, its destination item.
+func (r *DynamoRepo) create(ctx context.Context, rec model.URLRecord) error {
+	item, err := encodeDynamo(rec)
+	if err != nil {
+		return err
+	}
+	writes := []types.TransactWriteItem{{Put: &types.Put{
+		TableName:           aws.String(r.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	}}}
+	if !rec.Unique {
+		writes = append(writes, types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(r.table),
+			Item:                map[string]types.AttributeValue{"pk": dynamoS(dynamoLongKey(rec.Tenant, rec.Domain, rec.LongUrl)), "code": dynamoS(rec.Code)},
+			ConditionExpression: aws.String("attribute_not_exists(pk)"),
+		}})
+	}
+	_, err = r.db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	return mapDynamoError(err, ErrDuplicateCode, ErrDuplicateLongURL)
+}
+
+func (r *DynamoRepo) Insert(ctx context.Context, in model.URLRecord) (model.URLRecord, error) {
+	rec := newDynamoRecord(ctx, in)
+	if err := r.create(ctx, rec); err != nil {
+		return model.URLRecord{}, err
+	}
+	return rec, nil
+}
+
+func (r *DynamoRepo) Upsert(ctx context.Context, in model.URLRecord) (model.URLRecord, bool, error) {
+	if !in.Unique {
+		rec, err := r.GetByLong(ctx, in.Domain, in.LongUrl)
+		if !errors.Is(err, ErrNotFound) {
+			return rec, false, err
+		}
+	}
+	rec := newDynamoRecord(ctx, in)
+	if in.ScanStatus != "" {
+		rec.ScanStatus = in.ScanStatus
+		if in.ScannedAt != nil {
+			t := in.ScannedAt.UTC()
+			rec.ScannedAt = &t
+		}
+	}
+	err := r.create(ctx, rec)
+	if errors.Is(err, ErrDuplicateLongURL) {
+		// Created concurrently since the lookup above.
+		rec, err = r.GetByLong(ctx, in.Domain, in.LongUrl)
+		return rec, false, err
+	}
+	if err != nil {
+		return model.URLRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (r *DynamoRepo) Update(ctx context.Context, in model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	rec, err := r.GetByCode(ctx, in.Code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if !rec.UpdatedAt.Equal(prev) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	oldLong := rec.LongUrl
+
+	rec.LongUrl = in.LongUrl
+	rec.UTM = decodeParams(encodeParams(in.UTM))
+	rec.ScanStatus = in.ScanStatus
+	rec.ScannedAt = in.ScannedAt
+	rec.Title = in.Title
+	rec.Description = in.Description
+	rec.OriginalURL = in.OriginalURL
+	rec.FallbackURL = in.FallbackURL
+	rec.UpdatedAt = time.Now().UTC()
+
+	item, err := encodeDynamo(rec)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	writes := []types.TransactWriteItem{{Put: &types.Put{
+		TableName:                 aws.String(r.table),
+		Item:                      item,
+		ConditionExpression:       aws.String("#updated_at = :prev"),
+		ExpressionAttributeNames:  exprNames("#updated_at"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":prev": dynamoN(prev.UnixNano())},
+	}}}
+	if !rec.Unique && oldLong != rec.LongUrl {
+		// The destination item moves; one naming another link means the
+		// new destination is taken.
+		own := "attribute_not_exists(pk) OR #code = :code"
+		values := map[string]types.AttributeValue{":code": dynamoS(rec.Code)}
+		writes = append(writes,
+			types.TransactWriteItem{Delete: &types.Delete{
+				TableName:                 aws.String(r.table),
+				Key:                       dynamoKey(dynamoLongKey(rec.Tenant, rec.Domain, oldLong)),
+				ConditionExpression:       aws.String(own),
+				ExpressionAttributeNames:  exprNames(own),
+				ExpressionAttributeValues: values,
+			}},
+			types.TransactWriteItem{Put: &types.Put{
+				TableName:                 aws.String(r.table),
+				Item:                      map[string]types.AttributeValue{"pk": dynamoS(dynamoLongKey(rec.Tenant, rec.Domain, rec.LongUrl)), "code": dynamoS(rec.Code)},
+				ConditionExpression:       aws.String(own),
+				ExpressionAttributeNames:  exprNames(own),
+				ExpressionAttributeValues: values,
+			}},
+		)
+	}
+	_, err = r.db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	if err = mapDynamoError(err, ErrNotFound, ErrNotFound, ErrDuplicateLongURL); err != nil {
+		return model.URLRecord{}, err
+	}
+	return rec, nil
+}
+
+// update applies the update expression set to code's link, provided it is
+// visible to ctx and cond holds, and returns the link as updated.
+func (r *DynamoRepo) update(ctx context.Context, code, set, cond string, values map[string]types.AttributeValue) (model.URLRecord, error) {
+	cond = tenantCondition(ctx, "attribute_exists(pk)"+cond, values)
+	out, err := r.db.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.table),
+		Key:                       dynamoKey(dynamoLinkKey(code)),
+		UpdateExpression:          aws.String(set),
+		ConditionExpression:       aws.String(cond),
+		ExpressionAttributeNames:  exprNames(set, cond),
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		return model.URLRecord{}, mapDynamoError(err)
+	}
+	return decodeDynamo(out.Attributes)
+}
+
+func (r *DynamoRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	return r.update(ctx, code, "SET #active = :active, #updated_at = :now", "", map[string]types.AttributeValue{
+		":active": dynamoBool(active),
+		":now":    dynamoN(time.Now().UnixNano()),
+	})
+}
+
+func (r *DynamoRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	// The count only goes up while it is under the limit, so concurrent
+	// redirects cannot overshoot; disabling the link after its last click
+	// is a second write.
+	rec, err := r.update(ctx, code, "SET #click_count = #click_count + :one",
+		" AND #active = :true AND #max_clicks > :zero AND #click_count < #max_clicks",
+		map[string]types.AttributeValue{":one": dynamoN(1), ":zero": dynamoN(0), ":true": dynamoBool(true)})
+	if err != nil || !rec.Exhausted() {
+		return rec, err
+	}
+	return r.update(ctx, code, "SET #active = :false, #updated_at = :now", "", map[string]types.AttributeValue{
+		":false": dynamoBool(false),
+		":now":   dynamoN(time.Now().UnixNano()),
+	})
+}
+
+func (r *DynamoRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	_, err := r.update(ctx, code, "SET #scan_status = :status, #scanned_at = :now", "", map[string]types.AttributeValue{
+		":status": dynamoS(status),
+		":now":    dynamoN(time.Now().UnixNano()),
+	})
+	return err
+}
+
+func (r *DynamoRepo) Delete(ctx context.Context, code string) error {
+	rec, err := r.GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	return r.delete(ctx, rec)
+}
+
+// delete removes rec's link and destination items.
+func (r *DynamoRepo) delete(ctx context.Context, rec model.URLRecord) error {
+	writes := []types.TransactWriteItem{{Delete: &types.Delete{
+		TableName:           aws.String(r.table),
+		Key:                 dynamoKey(dynamoLinkKey(rec.Code)),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	}}}
+	if !rec.Unique {
+		// Only remove the destination item if it still names this link.
+		own := "attribute_not_exists(pk) OR #code = :code"
+		writes = append(writes, types.TransactWriteItem{Delete: &types.Delete{
+			TableName:                 aws.String(r.table),
+			Key:                       dynamoKey(dynamoLongKey(rec.Tenant, rec.Domain, rec.LongUrl)),
+			ConditionExpression:       aws.String(own),
+			ExpressionAttributeNames:  exprNames(own),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":code": dynamoS(rec.Code)},
+		}})
+	}
+	_, err := r.db.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+	return mapDynamoError(err, ErrNotFound)
+}
+
+// ownerLinks calls fn with owner's links after the code after, in code
+// order, until fn returns false.
+func (r *DynamoRepo) ownerLinks(ctx context.Context, owner, after string, fn func(model.URLRecord) bool) error {
+	// Key values cannot be empty, so the first page has no lower bound.
+	keyCond := "#owner = :owner"
+	values := map[string]types.AttributeValue{":owner": dynamoS(owner)}
+	if after != "" {
+		keyCond += " AND #code > :after"
+		values[":after"] = dynamoS(after)
+	}
+	p := dynamodb.NewQueryPaginator(r.db, &dynamodb.QueryInput{
+		TableName:                 aws.String(r.table),
+		IndexName:                 aws.String(DynamoOwnerIndex),
+		KeyConditionExpression:    aws.String(keyCond),
+		ExpressionAttributeNames:  exprNames(keyCond),
+		ExpressionAttributeValues: values,
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range out.Items {
+			rec, err := decodeDynamo(item)
+			if err != nil {
+				return err
+			}
+			if inTenant(ctx, rec) && !fn(rec) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (r *DynamoRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	// The index is in code order, so the newest links are only known once
+	// all of owner's have been read.
+	query = strings.ToLower(query)
+	var recs []model.URLRecord
+	err := r.ownerLinks(ctx, owner, "", func(rec model.URLRecord) bool {
+		if strings.Contains(strings.ToLower(rec.LongUrl), query) {
+			recs = append(recs, rec)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (r *DynamoRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	err := r.ownerLinks(ctx, owner, after, func(rec model.URLRecord) bool {
+		recs = append(recs, rec)
+		return len(recs) < limit
+	})
+	return recs, err
+}
+
+// scan calls fn with every link visible to ctx, stopping at the first error
+// fn returns.
+func (r *DynamoRepo) scan(ctx context.Context, fn func(model.URLRecord) error) error {
+	p := dynamodb.NewScanPaginator(r.db, &dynamodb.ScanInput{
+		TableName:                 aws.String(r.table),
+		FilterExpression:          aws.String("begins_with(pk, :link)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":link": dynamoS(dynamoLinkPrefix)},
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range out.Items {
+			rec, err := decodeDynamo(item)
+			if err != nil {
+				return err
+			}
+			if !inTenant(ctx, rec) {
+				continue
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *DynamoRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	err := r.scan(ctx, func(rec model.URLRecord) error {
+		if rec.ScanStatus != "flagged" && (rec.ScannedAt == nil || rec.ScannedAt.Before(before)) {
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		a, b := recs[i].ScannedAt, recs[j].ScannedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+// errEnough stops a scan that has found what it needs.
+var errEnough = errors.New("enough")
+
+func (r *DynamoRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	var stale []model.URLRecord
+	err := r.scan(ctx, func(rec model.URLRecord) error {
+		expired := rec.ExpiresAt != nil && rec.ExpiresAt.Before(expiredBefore)
+		disabled := !disabledBefore.IsZero() && !rec.Active && rec.UpdatedAt.Before(disabledBefore)
+		if expired || disabled {
+			stale = append(stale, rec)
+		}
+		if len(stale) >= limit {
+			return errEnough
+		}
+		return nil
+	})
+	if err != nil && err != errEnough {
+		return 0, err
+	}
+
+	var n int
+	for _, rec := range stale {
+		err := r.delete(ctx, rec)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *DynamoRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	p := dynamodb.NewScanPaginator(r.db, &dynamodb.ScanInput{
+		TableName:                 aws.String(r.table),
+		ProjectionExpression:      aws.String("pk"),
+		FilterExpression:          aws.String("begins_with(pk, :link)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":link": dynamoS(dynamoLinkPrefix)},
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range out.Items {
+			pk, ok := item["pk"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			if err := fn(strings.TrimPrefix(pk.Value, dynamoLinkPrefix)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestDynamoEncoding(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	expires := created.Add(24 * time.Hour)
+	for _, rec := range []model.URLRecord{
+		{Code: "abc123", LongUrl: "https://example.com/", CreatedAt: created, UpdatedAt: created, ScanStatus: "unchecked", Active: true},
+		{
+			ID: "id-1", Code: "xyz789", LongUrl: "https://example.com/a", ShortUrl: "https://shawt.ly/xyz789",
+			CreatedAt: created, UpdatedAt: created.Add(time.Second), ScanStatus: "clean", ScannedAt: &created,
+			UTM: map[string]string{"utm_source": "mail"}, Owner: "alice", Domain: "go.example", ExpiresAt: &expires,
+			Title: "t", Description: "d", Org: "acme", OriginalURL: "https://example.com/a?fbclid=1",
+			Unique: true, MaxClicks: 3, ClickCount: 2, Tenant: "t1",
+		},
+	} {
+		item, err := encodeDynamo(rec)
+		if err != nil {
+			t.Fatalf("encode %s: %v", rec.Code, err)
+		}
+		if _, ok := item["owner"]; ok != (rec.Owner != "") {
+			t.Errorf("%s: expected owner only when set, got %v", rec.Code, item["owner"])
+		}
+		got, err := decodeDynamo(item)
+		if err != nil {
+			t.Fatalf("decode %s: %v", rec.Code, err)
+		}
+		if !reflect.DeepEqual(got, rec) {
+			t.Errorf("round trip:\nwant %+v\ngot  %+v", rec, got)
+		}
+	}
+}
+
+func TestDynamoLongKey(t *testing.T) {
+	key := dynamoLongKey("", "", "https://example.com/"+strings.Repeat("a", 4000))
+	if len(key) > 100 {
+		t.Errorf("expected a short key for a long URL, got %d bytes", len(key))
+	}
+	if dynamoLongKey("t1", "", "https://example.com/") == dynamoLongKey("t2", "", "https://example.com/") {
+		t.Error("expected tenants to have separate destination keys")
+	}
+}
+
+func TestMapDynamoError(t *testing.T) {
+	cancelled := func(codes ...string) error {
+		reasons := make([]types.CancellationReason, len(codes))
+		for i, c := range codes {
+			reasons[i].Code = aws.String(c)
+		}
+		return &types.TransactionCanceledException{CancellationReasons: reasons}
+	}
+	other := errors.New("throttled")
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"condition", &types.ConditionalCheckFailedException{}, ErrNotFound},
+		{"code taken", cancelled("ConditionalCheckFailed", "None"), ErrDuplicateCode},
+		{"long URL taken", cancelled("None", "ConditionalCheckFailed"), ErrDuplicateLongURL},
+		{"conflict", cancelled("TransactionConflict", "None"), nil},
+		{"other", other, other},
+	} {
+		got := mapDynamoError(tc.err, ErrDuplicateCode, ErrDuplicateLongURL)
+		if tc.want == nil {
+			if got != tc.err {
+				t.Errorf("%s: expected the error unchanged, got %v", tc.name, got)
+			}
+		} else if !errors.Is(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestExprNames(t *testing.T) {
+	got := exprNames("SET #active = :active, #updated_at = :now", "attribute_exists(pk) AND #tenant = :tenant")
+	want := map[string]string{"#active": "active", "#updated_at": "updated_at", "#tenant": "tenant"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
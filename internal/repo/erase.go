@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// eraseOwner deletes an owner's click events, daily totals and links with
+// the clicks, daily and links statements, in that order because the first
+// two find the owner's codes through their links, then runs the rest. All
+// run in one transaction with owner as their only argument.
+func eraseOwner(ctx context.Context, db *sql.DB, clicks, daily, links string, rest []string, owner string) (nLinks, nClicks int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	exec := func(q string) (int, error) {
+		res, err := tx.ExecContext(ctx, q, owner)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		return int(n), err
+	}
+	if nClicks, err = exec(clicks); err != nil {
+		return 0, 0, err
+	}
+	if _, err = exec(daily); err != nil {
+		return 0, 0, err
+	}
+	if nLinks, err = exec(links); err != nil {
+		return 0, 0, err
+	}
+	for _, q := range rest {
+		if _, err = exec(q); err != nil {
+			return 0, 0, err
+		}
+	}
+	return nLinks, nClicks, tx.Commit()
+}
+
+// purgeClicks runs stmts in one transaction with code as their only
+// argument and returns how many rows the first deleted.
+func purgeClicks(ctx context.Context, db *sql.DB, stmts []string, code string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var n int64
+	for i, q := range stmts {
+		res, err := tx.ExecContext(ctx, q, code)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 {
+			if n, err = res.RowsAffected(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int(n), tx.Commit()
+}
+
+func (r *PostgresRepo) EraseOwner(ctx context.Context, owner string) (int, int, error) {
+	return eraseOwner(ctx, r.db,
+		`DELETE FROM click_events WHERE code IN (SELECT code FROM url_records WHERE owner=$1 UNION SELECT code FROM url_records_archive WHERE owner=$1)`,
+		`DELETE FROM click_daily WHERE code IN (SELECT code FROM url_records WHERE owner=$1 UNION SELECT code FROM url_records_archive WHERE owner=$1)`,
+		`DELETE FROM url_records WHERE owner=$1`,
+		[]string{
+			`DELETE FROM url_records_archive WHERE owner=$1`,
+			`DELETE FROM usage_counters WHERE owner=$1`,
+			`DELETE FROM idempotency_keys WHERE owner=$1`,
+			`DELETE FROM org_members WHERE owner=$1`,
+			`UPDATE audit_log SET before_snapshot='', after_snapshot=''
+			 WHERE NULLIF(before_snapshot, '')::jsonb->>'owner'=$1 OR NULLIF(after_snapshot, '')::jsonb->>'owner'=$1`,
+		}, owner)
+}
+
+func (r *MySQLRepo) EraseOwner(ctx context.Context, owner string) (int, int, error) {
+	return eraseOwner(ctx, r.db,
+		`DELETE FROM click_events WHERE code IN (SELECT code FROM (SELECT code, owner FROM url_records UNION ALL SELECT code, owner FROM url_records_archive) l WHERE l.owner=?)`,
+		`DELETE FROM click_daily WHERE code IN (SELECT code FROM (SELECT code, owner FROM url_records UNION ALL SELECT code, owner FROM url_records_archive) l WHERE l.owner=?)`,
+		`DELETE FROM url_records WHERE owner=?`,
+		[]string{
+			`DELETE FROM url_records_archive WHERE owner=?`,
+			`DELETE FROM usage_counters WHERE owner=?`,
+			`DELETE FROM idempotency_keys WHERE owner=?`,
+			`DELETE FROM org_members WHERE owner=?`,
+			`UPDATE audit_log SET before_snapshot='', after_snapshot=''
+			 WHERE ? IN (JSON_UNQUOTE(JSON_EXTRACT(NULLIF(before_snapshot, ''), '$.owner')),
+			             JSON_UNQUOTE(JSON_EXTRACT(NULLIF(after_snapshot, ''), '$.owner')))`,
+		}, owner)
+}
+
+func (r *MemoryRepo) EraseOwner(ctx context.Context, owner string) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := make(map[string]bool)
+	for code, rec := range r.byCode {
+		if rec.Owner == owner {
+			codes[code] = true
+			delete(r.byCode, code)
+			r.unindex(rec)
+		}
+	}
+	// Archived links go too, uncounted as in the SQL repos.
+	n := len(codes)
+	for code, rec := range r.archived {
+		if rec.Owner == owner {
+			codes[code] = true
+			delete(r.archived, code)
+		}
+	}
+	return n, r.eraseOwnerData(owner, codes), nil
+}
+
+// eraseOwnerData deletes the clicks on codes, owner's links, along with
+// owner's usage counters, idempotency keys and memberships, and the link
+// snapshots of owner's audit entries, and returns how many click events went.
+// The caller holds r.mu.
+func (r *MemoryRepo) eraseOwnerData(owner string, codes map[string]bool) int {
+	clicks := r.purgeClicks(codes)
+
+	for key := range r.usage {
+		if key.owner == owner {
+			delete(r.usage, key)
+		}
+	}
+	for key := range r.idempotency {
+		if strings.HasPrefix(key, owner+"\x00") {
+			delete(r.idempotency, key)
+		}
+	}
+	for _, members := range r.members {
+		delete(members, owner)
+	}
+	for i, e := range r.audit {
+		if e.Before != nil && e.Before.Owner == owner || e.After != nil && e.After.Owner == owner {
+			r.audit[i].Before, r.audit[i].After = nil, nil
+		}
+	}
+	return clicks
+}
+
+func (r *PostgresRepo) PurgeClicks(ctx context.Context, code string) (int, error) {
+	return purgeClicks(ctx, r.db, []string{
+		`DELETE FROM click_events WHERE code=$1`,
+		`DELETE FROM click_daily WHERE code=$1`,
+	}, code)
+}
+
+func (r *MySQLRepo) PurgeClicks(ctx context.Context, code string) (int, error) {
+	return purgeClicks(ctx, r.db, []string{
+		`DELETE FROM click_events WHERE code=?`,
+		`DELETE FROM click_daily WHERE code=?`,
+	}, code)
+}
+
+func (r *MemoryRepo) PurgeClicks(ctx context.Context, code string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.purgeClicks(map[string]bool{code: true}), nil
+}
+
+// purgeClicks drops the click events and daily totals of codes and returns
+// how many events went. The caller holds r.mu.
+func (r *MemoryRepo) purgeClicks(codes map[string]bool) int {
+	kept := r.clicks[:0]
+	for _, ev := range r.clicks {
+		if !codes[ev.Code] {
+			kept = append(kept, ev)
+		}
+	}
+	n := len(r.clicks) - len(kept)
+	r.clicks = kept
+	for key := range r.daily {
+		if codes[key.code] {
+			delete(r.daily, key)
+		}
+	}
+	return n
+}
@@ -0,0 +1,21 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Every repository reports failures with these errors, whatever the storage
+// behind it, so callers never inspect driver errors.
+var (
+	// ErrNotFound is returned when the record asked for does not exist. It is
+	// sql.ErrNoRows, so rows scanned through database/sql need no
+	// translating.
+	ErrNotFound = sql.ErrNoRows
+	// ErrDuplicateCode is returned by Insert when the short code is already taken.
+	ErrDuplicateCode = errors.New("duplicate code")
+	// ErrDuplicateLongURL is returned by Insert when the long URL has already been shortened.
+	ErrDuplicateLongURL = errors.New("duplicate long url")
+	// ErrDuplicateOrg is returned by CreateOrg when the slug is already taken.
+	ErrDuplicateOrg = errors.New("duplicate org")
+)
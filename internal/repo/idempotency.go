@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// IdempotencyRepo stores the responses of requests sent with an
+// Idempotency-Key, scoped per owner.
+type IdempotencyRepo interface {
+	// ReserveIdempotencyKey claims key for a request with the given hash. If
+	// the key was already used, the stored entry is returned instead and
+	// reserved is false.
+	ReserveIdempotencyKey(ctx context.Context, owner, key, hash string) (prev model.IdempotentResponse, reserved bool, err error)
+	// SaveIdempotentResponse completes a reservation with its response.
+	SaveIdempotentResponse(ctx context.Context, owner, key string, resp model.IdempotentResponse) error
+	// ReleaseIdempotencyKey drops a reservation, so the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, owner, key string) error
+	// DeleteIdempotencyKeys forgets keys created before before and returns how many.
+	DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+}
+
+const idempotencyColumns = `request_hash, status, headers, body, created_at`
+
+func scanIdempotentResponse(row rowScanner) (model.IdempotentResponse, error) {
+	var resp model.IdempotentResponse
+	var headers string
+	err := row.Scan(&resp.RequestHash, &resp.Status, &headers, &resp.Body, &resp.CreatedAt)
+	resp.Header = decodeParams(headers)
+	return resp, err
+}
+
+func (r *PostgresRepo) ReserveIdempotencyKey(ctx context.Context, owner, key, hash string) (model.IdempotentResponse, bool, error) {
+	const ins = `
+		INSERT INTO idempotency_keys (owner, idempotency_key, request_hash) VALUES ($1, $2, $3)
+		ON CONFLICT (owner, idempotency_key) DO NOTHING`
+	const sel = `SELECT ` + idempotencyColumns + ` FROM idempotency_keys WHERE owner=$1 AND idempotency_key=$2`
+
+	res, err := r.db.ExecContext(ctx, ins, owner, key, hash)
+	if n, err := rowsAffected(res, err); err != nil || n == 1 {
+		return model.IdempotentResponse{}, err == nil, err
+	}
+
+	prev, err := scanIdempotentResponse(r.db.QueryRowContext(ctx, sel, owner, key))
+	return prev, false, err
+}
+
+func (r *PostgresRepo) SaveIdempotentResponse(ctx context.Context, owner, key string, resp model.IdempotentResponse) error {
+	const q = `UPDATE idempotency_keys SET status=$3, headers=$4, body=$5 WHERE owner=$1 AND idempotency_key=$2`
+
+	res, err := r.db.ExecContext(ctx, q, owner, key, resp.Status, encodeParams(resp.Header), resp.Body)
+	return affectedOne(res, err)
+}
+
+func (r *PostgresRepo) ReleaseIdempotencyKey(ctx context.Context, owner, key string) error {
+	const q = `DELETE FROM idempotency_keys WHERE owner=$1 AND idempotency_key=$2 AND status=0`
+
+	_, err := r.db.ExecContext(ctx, q, owner, key)
+	return err
+}
+
+func (r *PostgresRepo) DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	const q = `DELETE FROM idempotency_keys WHERE created_at < $1`
+
+	return rowsAffected(r.db.ExecContext(ctx, q, before))
+}
+
+func (r *MySQLRepo) ReserveIdempotencyKey(ctx context.Context, owner, key, hash string) (model.IdempotentResponse, bool, error) {
+	const ins = `INSERT INTO idempotency_keys (owner, idempotency_key, request_hash, headers) VALUES (?, ?, ?, '')`
+	const sel = `SELECT ` + idempotencyColumns + ` FROM idempotency_keys WHERE owner=? AND idempotency_key=?`
+
+	_, err := r.db.ExecContext(ctx, ins, owner, key, hash)
+	if err == nil {
+		return model.IdempotentResponse{}, true, nil
+	}
+	if !isMySQLDuplicate(err) {
+		return model.IdempotentResponse{}, false, err
+	}
+
+	prev, err := scanIdempotentResponse(r.db.QueryRowContext(ctx, sel, owner, key))
+	return prev, false, err
+}
+
+func (r *MySQLRepo) SaveIdempotentResponse(ctx context.Context, owner, key string, resp model.IdempotentResponse) error {
+	const q = `UPDATE idempotency_keys SET status=?, headers=?, body=? WHERE owner=? AND idempotency_key=?`
+
+	res, err := r.db.ExecContext(ctx, q, resp.Status, encodeParams(resp.Header), resp.Body, owner, key)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) ReleaseIdempotencyKey(ctx context.Context, owner, key string) error {
+	const q = `DELETE FROM idempotency_keys WHERE owner=? AND idempotency_key=? AND status=0`
+
+	_, err := r.db.ExecContext(ctx, q, owner, key)
+	return err
+}
+
+func (r *MySQLRepo) DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	const q = `DELETE FROM idempotency_keys WHERE created_at < ?`
+
+	return rowsAffected(r.db.ExecContext(ctx, q, before))
+}
+
+func idempotencyKey(owner, key string) string { return owner + "\x00" + key }
+
+func (r *MemoryRepo) ReserveIdempotencyKey(ctx context.Context, owner, key, hash string) (model.IdempotentResponse, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey(owner, key)
+	if prev, ok := r.idempotency[k]; ok {
+		return prev, false, nil
+	}
+	r.idempotency[k] = model.IdempotentResponse{RequestHash: hash, CreatedAt: time.Now().UTC()}
+	return model.IdempotentResponse{}, true, nil
+}
+
+func (r *MemoryRepo) SaveIdempotentResponse(ctx context.Context, owner, key string, resp model.IdempotentResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey(owner, key)
+	prev, ok := r.idempotency[k]
+	if !ok {
+		return ErrNotFound
+	}
+	prev.Status = resp.Status
+	prev.Header = decodeParams(encodeParams(resp.Header))
+	prev.Body = append([]byte(nil), resp.Body...)
+	r.idempotency[k] = prev
+	return nil
+}
+
+func (r *MemoryRepo) ReleaseIdempotencyKey(ctx context.Context, owner, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := idempotencyKey(owner, key)
+	if prev, ok := r.idempotency[k]; ok && prev.Status == 0 {
+		delete(r.idempotency, k)
+	}
+	return nil
+}
+
+func (r *MemoryRepo) DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for k, resp := range r.idempotency {
+		if resp.CreatedAt.Before(before) {
+			delete(r.idempotency, k)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/model"
+)
+
+// LinkCache is a URLRepo that writes every link it stores or changes through
+// to a cache, so the redirect that follows, typically the creator trying the
+// link out, finds it there even while the database it would be read from
+// lags behind the write. Only Cached reads the cache: GetByCode, which edits
+// and their updated_at checks start from, always asks r. Changes to links
+// made around the repo show in Cached only once the cached copy expires;
+// erasing an owner therefore deletes their links through it as well.
+type LinkCache struct {
+	URLRepo
+	links cache.Store
+	keep  func(model.URLRecord) bool // nil caches every link
+
+	hits, misses atomic.Int64
+}
+
+// WithLinkCache wraps r, keeping links in links.
+func WithLinkCache(r URLRepo, links cache.Store) *LinkCache {
+	return &LinkCache{URLRepo: r, links: links}
+}
+
+// Only limits the cache to the links keep returns true for, as those of the
+// owners a feature flag is on for. The others are dropped from the cache as
+// they are written and always looked up in r. It must be called before the
+// cache is used.
+func (r *LinkCache) Only(keep func(model.URLRecord) bool) {
+	r.keep = keep
+}
+
+// keeps reports whether rec belongs in the cache.
+func (r *LinkCache) keeps(rec model.URLRecord) bool {
+	return r.keep == nil || r.keep(rec)
+}
+
+// cachedLink is a link as cached, with the tenant its JSON leaves out.
+type cachedLink struct {
+	model.URLRecord
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Cached is GetByCode answered from the cache when it can be, for
+// redirects. Links looked up in r are cached on the way out.
+func (r *LinkCache) Cached(ctx context.Context, code string) (model.URLRecord, error) {
+	var c cachedLink
+	if b, ok := r.links.Get(ctx, code); ok && json.Unmarshal(b, &c) == nil && r.keeps(c.URLRecord) {
+		r.hits.Add(1)
+		c.URLRecord.Tenant = c.Tenant
+		if !inTenant(ctx, c.URLRecord) {
+			return model.URLRecord{}, ErrNotFound
+		}
+		return c.URLRecord, nil
+	}
+	r.misses.Add(1)
+
+	// Codes are unique across tenants, so the cache is shared by all of
+	// them, as the negative cache is.
+	rec, err := r.URLRepo.GetByCode(AllTenants(ctx), code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	r.put(ctx, rec)
+	if !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Warm caches the links with codes ahead of their first redirect, skipping
+// those cached already, as by another instance sharing the cache, and codes
+// no longer in use. It returns how many links it looked up.
+func (r *LinkCache) Warm(ctx context.Context, codes []string) (int, error) {
+	all := AllTenants(ctx)
+	var n int
+	for _, code := range codes {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		if _, ok := r.links.Get(ctx, code); ok {
+			continue
+		}
+		rec, err := r.URLRepo.GetByCode(all, code)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		r.put(ctx, rec)
+		n++
+	}
+	return n, nil
+}
+
+func (r *LinkCache) put(ctx context.Context, rec model.URLRecord) {
+	if !r.keeps(rec) {
+		r.links.Remove(ctx, rec.Code)
+		return
+	}
+	if b, err := json.Marshal(cachedLink{URLRecord: rec, Tenant: rec.Tenant}); err == nil {
+		r.links.Put(ctx, rec.Code, b)
+	}
+}
+
+func (r *LinkCache) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
+	out, err := r.URLRepo.Insert(ctx, rec)
+	if err == nil {
+		r.put(ctx, out)
+	}
+	return out, err
+}
+
+func (r *LinkCache) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	out, created, err := r.URLRepo.Upsert(ctx, rec)
+	if err == nil {
+		r.put(ctx, out)
+	}
+	return out, created, err
+}
+
+func (r *LinkCache) Update(ctx context.Context, rec model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	out, err := r.URLRepo.Update(ctx, rec, prev)
+	if err == nil {
+		r.put(ctx, out)
+	}
+	return out, err
+}
+
+func (r *LinkCache) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	out, err := r.URLRepo.SetActive(ctx, code, active)
+	if err == nil {
+		r.put(ctx, out)
+	}
+	return out, err
+}
+
+func (r *LinkCache) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	out, err := r.URLRepo.TakeClick(ctx, code)
+	if err == nil {
+		r.put(ctx, out)
+	}
+	return out, err
+}
+
+// UpdateScanStatus drops the cached link rather than rewriting it, as the
+// repo does not return the link; a flagged link then stops redirecting at
+// once.
+func (r *LinkCache) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	err := r.URLRepo.UpdateScanStatus(ctx, code, status)
+	r.links.Remove(ctx, code)
+	return err
+}
+
+func (r *LinkCache) Delete(ctx context.Context, code string) error {
+	err := r.URLRepo.Delete(ctx, code)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		r.links.Remove(ctx, code)
+	}
+	return err
+}
+
+// CacheStats returns how many Cached lookups the cache has answered, and
+// how many it passed on.
+func (r *LinkCache) CacheStats() (hits, misses int64) {
+	return r.hits.Load(), r.misses.Load()
+}
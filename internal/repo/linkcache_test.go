@@ -0,0 +1,157 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/model"
+)
+
+// laggingRepo stands in for a replica that has not seen any write yet.
+type laggingRepo struct {
+	*MemoryRepo
+}
+
+func (r laggingRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	return model.URLRecord{}, ErrNotFound
+}
+
+func TestLinkCache(t *testing.T) {
+	ctx := context.Background()
+	r := WithLinkCache(laggingRepo{NewMemory()}, cache.NewMemoryStore(100, time.Minute))
+
+	rec, err := r.Insert(WithTenant(ctx, "acme"), model.URLRecord{Code: "abc", LongUrl: "https://example.com/a", MaxClicks: 2})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	got, err := r.Cached(WithTenant(ctx, "acme"), "abc")
+	if err != nil || got.LongUrl != rec.LongUrl || got.Tenant != "acme" || !got.CreatedAt.Equal(rec.CreatedAt) {
+		t.Fatalf("expected the new link from the cache, got %+v (%v)", got, err)
+	}
+	if _, err := r.Cached(WithTenant(ctx, ""), "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another tenant's link to be hidden, got %v", err)
+	}
+	if _, err := r.GetByCode(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected GetByCode to skip the cache, got %v", err)
+	}
+
+	if _, err := r.TakeClick(ctx, "abc"); err != nil {
+		t.Fatalf("TakeClick: %v", err)
+	}
+	if got, _ := r.Cached(ctx, "abc"); got.ClickCount != 1 {
+		t.Errorf("expected the click counted in the cache, got %d", got.ClickCount)
+	}
+	if _, err := r.SetActive(ctx, "abc", false); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	if got, _ := r.Cached(ctx, "abc"); got.Active {
+		t.Error("expected the link disabled in the cache")
+	}
+
+	if err := r.UpdateScanStatus(ctx, "abc", "flagged"); err != nil {
+		t.Fatalf("UpdateScanStatus: %v", err)
+	}
+	if _, err := r.Cached(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a rescanned link dropped from the cache, got %v", err)
+	}
+	if hits, misses := r.CacheStats(); hits != 4 || misses != 1 {
+		t.Errorf("expected 4 hits and 1 miss, got %d and %d", hits, misses)
+	}
+}
+
+func TestLinkCache_ReadThrough(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{MemoryRepo: NewMemory()}
+	inner.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/a"})
+	r := WithLinkCache(inner, cache.NewMemoryStore(100, time.Minute))
+
+	for range 3 {
+		if _, err := r.Cached(ctx, "abc"); err != nil {
+			t.Fatalf("Cached: %v", err)
+		}
+	}
+	if inner.lookups != 1 {
+		t.Errorf("expected 1 lookup to reach the store, got %d", inner.lookups)
+	}
+
+	if err := r.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := r.Cached(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted link gone from the cache, got %v", err)
+	}
+}
+
+func TestLinkCache_Warm(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{MemoryRepo: NewMemory()}
+	inner.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/a"})
+	inner.Insert(WithTenant(ctx, "acme"), model.URLRecord{Code: "def", LongUrl: "https://example.com/d"})
+	r := WithLinkCache(inner, cache.NewMemoryStore(100, time.Minute))
+
+	n, err := r.Warm(ctx, []string{"abc", "def", "gone"})
+	if err != nil || n != 2 {
+		t.Fatalf("Warm: expected 2 links cached, got %d (%v)", n, err)
+	}
+	if n, _ := r.Warm(ctx, []string{"abc", "def"}); n != 0 {
+		t.Errorf("expected cached links skipped, got %d looked up", n)
+	}
+	inner.lookups = 0
+	if _, err := r.Cached(WithTenant(ctx, "acme"), "def"); err != nil || inner.lookups != 0 {
+		t.Errorf("expected the warmed link from the cache, got %d lookups (%v)", inner.lookups, err)
+	}
+}
+
+func TestLinkCache_Only(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{MemoryRepo: NewMemory()}
+	r := WithLinkCache(inner, cache.NewMemoryStore(100, time.Minute))
+	on := map[string]bool{"alice": true}
+	r.Only(func(rec model.URLRecord) bool { return on[rec.Owner] })
+
+	r.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/a", Owner: "alice"})
+	r.Insert(ctx, model.URLRecord{Code: "def", LongUrl: "https://example.com/d", Owner: "bob"})
+	for range 2 {
+		r.Cached(ctx, "abc")
+		r.Cached(ctx, "def")
+	}
+	if inner.lookups != 2 {
+		t.Errorf("expected only bob's link looked up, twice, got %d lookups", inner.lookups)
+	}
+
+	// Turning the flag off for alice stops serving her cached link.
+	on["alice"] = false
+	inner.lookups = 0
+	if _, err := r.Cached(ctx, "abc"); err != nil || inner.lookups != 1 {
+		t.Errorf("expected alice's link looked up, got %d lookups (%v)", inner.lookups, err)
+	}
+}
+
+func TestLinkCache_EraseOwner(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemory()
+	r := WithLinkCache(inner, cache.NewMemoryStore(100, time.Minute))
+	r.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/a", Owner: "alice"})
+
+	// As the admin service erases: the codes read first are deleted through
+	// the cache after the store below it is erased.
+	codes, err := OwnerCodes(ctx, r, "alice")
+	if err != nil {
+		t.Fatalf("OwnerCodes: %v", err)
+	}
+	inner.EraseOwner(ctx, "alice")
+	if _, err := r.Cached(ctx, "abc"); err != nil {
+		t.Fatalf("expected the erased link still cached until deleted, got %v", err)
+	}
+	for _, code := range codes {
+		if err := r.Delete(ctx, code); err != nil && !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Delete %s: %v", code, err)
+		}
+	}
+	if _, err := r.Cached(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the erased link dropped from the cache, got %v", err)
+	}
+}
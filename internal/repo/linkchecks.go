@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// LinkCheckRepo keeps the latest liveness check of each link's destination.
+type LinkCheckRepo interface {
+	// SaveLinkCheck records c, replacing the earlier check of its code.
+	SaveLinkCheck(ctx context.Context, c model.LinkCheck) error
+	// GetLinkChecks returns the checks of those of codes that have one.
+	GetLinkChecks(ctx context.Context, codes []string) (map[string]model.LinkCheck, error)
+	// ListLinkChecks returns up to limit checks made before before, oldest
+	// first.
+	ListLinkChecks(ctx context.Context, before time.Time, limit int) ([]model.LinkCheck, error)
+	// DeleteLinkCheck forgets code's check; a missing one yields ErrNotFound.
+	DeleteLinkCheck(ctx context.Context, code string) error
+}
+
+const linkCheckColumns = `code, status, error, dead, checked_at`
+
+func scanLinkChecks(rows *sql.Rows) ([]model.LinkCheck, error) {
+	defer rows.Close()
+
+	var checks []model.LinkCheck
+	for rows.Next() {
+		var c model.LinkCheck
+		if err := rows.Scan(&c.Code, &c.Status, &c.Error, &c.Dead, &c.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+func linkCheckMap(checks []model.LinkCheck, err error) (map[string]model.LinkCheck, error) {
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]model.LinkCheck, len(checks))
+	for _, c := range checks {
+		m[c.Code] = c
+	}
+	return m, nil
+}
+
+func (r *PostgresRepo) SaveLinkCheck(ctx context.Context, c model.LinkCheck) error {
+	const q = `
+		INSERT INTO link_checks (code, status, error, dead, checked_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code) DO UPDATE SET
+			status = EXCLUDED.status, error = EXCLUDED.error, dead = EXCLUDED.dead, checked_at = EXCLUDED.checked_at`
+
+	_, err := r.db.ExecContext(ctx, q, c.Code, c.Status, c.Error, c.Dead, c.CheckedAt)
+	return err
+}
+
+func (r *PostgresRepo) GetLinkChecks(ctx context.Context, codes []string) (map[string]model.LinkCheck, error) {
+	if len(codes) == 0 {
+		return map[string]model.LinkCheck{}, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT `+linkCheckColumns+` FROM link_checks WHERE code = ANY($1)`, codes)
+	if err != nil {
+		return nil, err
+	}
+	return linkCheckMap(scanLinkChecks(rows))
+}
+
+func (r *PostgresRepo) ListLinkChecks(ctx context.Context, before time.Time, limit int) ([]model.LinkCheck, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+linkCheckColumns+` FROM link_checks WHERE checked_at < $1 ORDER BY checked_at, code LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinkChecks(rows)
+}
+
+func (r *PostgresRepo) DeleteLinkCheck(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM link_checks WHERE code=$1`, code)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) SaveLinkCheck(ctx context.Context, c model.LinkCheck) error {
+	const q = `
+		INSERT INTO link_checks (code, status, error, dead, checked_at) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			status = VALUES(status), error = VALUES(error), dead = VALUES(dead), checked_at = VALUES(checked_at)`
+
+	_, err := r.db.ExecContext(ctx, q, c.Code, c.Status, c.Error, c.Dead, c.CheckedAt)
+	return err
+}
+
+func (r *MySQLRepo) GetLinkChecks(ctx context.Context, codes []string) (map[string]model.LinkCheck, error) {
+	if len(codes) == 0 {
+		return map[string]model.LinkCheck{}, nil
+	}
+	q := `SELECT ` + linkCheckColumns + ` FROM link_checks WHERE code IN (?` + strings.Repeat(", ?", len(codes)-1) + `)`
+
+	args := make([]any, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return linkCheckMap(scanLinkChecks(rows))
+}
+
+func (r *MySQLRepo) ListLinkChecks(ctx context.Context, before time.Time, limit int) ([]model.LinkCheck, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+linkCheckColumns+` FROM link_checks WHERE checked_at < ? ORDER BY checked_at, code LIMIT ?`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinkChecks(rows)
+}
+
+func (r *MySQLRepo) DeleteLinkCheck(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM link_checks WHERE code=?`, code)
+	return affectedOne(res, err)
+}
+
+func (r *MemoryRepo) SaveLinkCheck(ctx context.Context, c model.LinkCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[c.Code] = c
+	return nil
+}
+
+func (r *MemoryRepo) GetLinkChecks(ctx context.Context, codes []string) (map[string]model.LinkCheck, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checks := make(map[string]model.LinkCheck, len(codes))
+	for _, code := range codes {
+		if c, ok := r.checks[code]; ok {
+			checks[code] = c
+		}
+	}
+	return checks, nil
+}
+
+func (r *MemoryRepo) ListLinkChecks(ctx context.Context, before time.Time, limit int) ([]model.LinkCheck, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var checks []model.LinkCheck
+	for _, c := range r.checks {
+		if c.CheckedAt.Before(before) {
+			checks = append(checks, c)
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		if !checks[i].CheckedAt.Equal(checks[j].CheckedAt) {
+			return checks[i].CheckedAt.Before(checks[j].CheckedAt)
+		}
+		return checks[i].Code < checks[j].Code
+	})
+	if len(checks) > limit {
+		checks = checks[:limit]
+	}
+	return checks, nil
+}
+
+func (r *MemoryRepo) DeleteLinkCheck(ctx context.Context, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.checks[code]; !ok {
+		return ErrNotFound
+	}
+	delete(r.checks, code)
+	return nil
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func testLinkChecks(t *testing.T, r LinkCheckRepo) {
+	ctx := context.Background()
+	old := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Microsecond)
+	checks := []model.LinkCheck{
+		{Code: "abc", Status: 200, CheckedAt: old},
+		{Code: "def", Error: "connection refused", Dead: true, CheckedAt: old.Add(time.Hour)},
+		{Code: "ghi", Status: 404, Dead: true, CheckedAt: time.Now().UTC()},
+	}
+	for _, c := range checks {
+		if err := r.SaveLinkCheck(ctx, c); err != nil {
+			t.Fatalf("SaveLinkCheck: %v", err)
+		}
+	}
+
+	got, err := r.GetLinkChecks(ctx, []string{"abc", "def", "nope"})
+	if err != nil || len(got) != 2 || got["abc"].Status != 200 || !got["def"].Dead || got["def"].Error != "connection refused" {
+		t.Errorf("GetLinkChecks: expected abc and def, got %+v (%v)", got, err)
+	}
+	if got, err := r.GetLinkChecks(ctx, nil); err != nil || len(got) != 0 {
+		t.Errorf("GetLinkChecks: expected nothing for no codes, got %+v (%v)", got, err)
+	}
+
+	stale, err := r.ListLinkChecks(ctx, time.Now().Add(-24*time.Hour), 10)
+	if err != nil || len(stale) != 2 || stale[0].Code != "abc" || stale[1].Code != "def" {
+		t.Errorf("ListLinkChecks: expected abc then def, got %+v (%v)", stale, err)
+	}
+
+	if err := r.SaveLinkCheck(ctx, model.LinkCheck{Code: "abc", Status: 410, Dead: true, CheckedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("SaveLinkCheck: %v", err)
+	}
+	if stale, _ := r.ListLinkChecks(ctx, time.Now().Add(-24*time.Hour), 10); len(stale) != 1 || stale[0].Code != "def" {
+		t.Errorf("expected the recheck to replace abc's check, got %+v", stale)
+	}
+
+	if err := r.DeleteLinkCheck(ctx, "def"); err != nil {
+		t.Fatalf("DeleteLinkCheck: %v", err)
+	}
+	if err := r.DeleteLinkCheck(ctx, "def"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestMemoryRepo_LinkChecks(t *testing.T) {
+	testLinkChecks(t, NewMemory())
+}
+
+func TestPostgresRepo_LinkChecks(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+	testDB.Exec("DELETE FROM link_checks")
+	testLinkChecks(t, NewPostgres(testDB))
+}
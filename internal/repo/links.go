@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// linkPage is how many links OwnerCodes reads per ListAfter call.
+const linkPage = 100
+
+// LinkStore pairs a URLRepo on a backend that stores only links, such as
+// DynamoDB, with a MemoryRepo holding everything else. The admin, org and
+// quota queries that read links, which MemoryRepo would answer from its own
+// empty link table, go to links instead. They walk every link through
+// EachCode or an owner's through ListAfter, which is fine for occasional
+// operator requests but not for hot paths.
+type LinkStore struct {
+	*MemoryRepo
+	links URLRepo
+}
+
+// NewLinkStore returns a LinkStore keeping links in links and the rest in a
+// fresh MemoryRepo.
+func NewLinkStore(links URLRepo) *LinkStore {
+	return &LinkStore{MemoryRepo: NewMemory(), links: links}
+}
+
+// Links returns the URLRepo links are kept in.
+func (s *LinkStore) Links() URLRepo {
+	return s.links
+}
+
+// allLinks returns the links visible to ctx that keep accepts.
+func (s *LinkStore) allLinks(ctx context.Context, keep func(model.URLRecord) bool) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	err := s.links.EachCode(ctx, func(code string) error {
+		rec, err := s.links.GetByCode(ctx, code)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// Another tenant's, or deleted since.
+			return nil
+		case err != nil:
+			return err
+		}
+		if keep(rec) {
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	return recs, err
+}
+
+// OwnerCodes returns the codes of owner's links in r, in every tenant.
+func OwnerCodes(ctx context.Context, r URLRepo, owner string) ([]string, error) {
+	ctx = AllTenants(ctx)
+	var codes []string
+	after := ""
+	for {
+		recs, err := r.ListAfter(ctx, owner, after, linkPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			codes = append(codes, rec.Code)
+		}
+		if len(recs) < linkPage {
+			return codes, nil
+		}
+		after = recs[len(recs)-1].Code
+	}
+}
+
+// stats totals recs and the clicks they received, or every click when
+// allClicks is set.
+func (s *LinkStore) stats(recs []model.URLRecord, now time.Time, allClicks bool) model.Stats {
+	var st model.Stats
+	codes := make(map[string]bool, len(recs))
+	for _, rec := range recs {
+		codes[rec.Code] = true
+		countLink(&st, rec, now)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, ev := range s.clicks {
+		if allClicks || codes[ev.Code] {
+			st.Clicks++
+		}
+	}
+	return st
+}
+
+func (s *LinkStore) ListAll(ctx context.Context, limit, offset int) ([]model.URLRecord, error) {
+	recs, err := s.allLinks(ctx, func(model.URLRecord) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (s *LinkStore) Stats(ctx context.Context, now time.Time) (model.Stats, error) {
+	recs, err := s.allLinks(ctx, func(model.URLRecord) bool { return true })
+	if err != nil {
+		return model.Stats{}, err
+	}
+	_, scoped := TenantOf(ctx)
+	return s.stats(recs, now, !scoped), nil
+}
+
+func (s *LinkStore) ListByOrg(ctx context.Context, org, query string, limit, offset int) ([]model.URLRecord, error) {
+	query = strings.ToLower(query)
+	recs, err := s.allLinks(ctx, func(rec model.URLRecord) bool {
+		return rec.Org == org && strings.Contains(strings.ToLower(rec.LongUrl), query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (s *LinkStore) OrgStats(ctx context.Context, org string, now time.Time) (model.Stats, error) {
+	recs, err := s.allLinks(ctx, func(rec model.URLRecord) bool { return rec.Org == org })
+	if err != nil {
+		return model.Stats{}, err
+	}
+	return s.stats(recs, now, false), nil
+}
+
+func (s *LinkStore) CountLinks(ctx context.Context, owner string) (int, error) {
+	codes, err := OwnerCodes(ctx, s.links, owner)
+	return len(codes), err
+}
+
+// EraseOwner deletes owner's links before the rest. Unlike the SQL repos it
+// is not atomic: a failure part way leaves the links not yet reached, and
+// running it again finishes the job.
+func (s *LinkStore) EraseOwner(ctx context.Context, owner string) (int, int, error) {
+	codes, err := OwnerCodes(ctx, s.links, owner)
+	if err != nil {
+		return 0, 0, err
+	}
+	erased := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		err := s.links.Delete(AllTenants(ctx), code)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, 0, err
+		}
+		erased[code] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(erased), s.eraseOwnerData(owner, erased), nil
+}
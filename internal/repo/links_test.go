@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestLinkStore(t *testing.T) {
+	ctx := context.Background()
+	links := NewMemory()
+	s := NewLinkStore(links)
+	for _, rec := range []model.URLRecord{
+		{Code: "a1", LongUrl: "https://example.com/1", Owner: "alice", Org: "acme"},
+		{Code: "a2", LongUrl: "https://example.com/2", Owner: "alice"},
+		{Code: "b1", LongUrl: "https://example.com/3", Owner: "bob", Org: "acme"},
+	} {
+		if _, err := links.Insert(ctx, rec); err != nil {
+			t.Fatalf("Insert %s: %v", rec.Code, err)
+		}
+	}
+	for _, code := range []string{"a1", "a1", "b1"} {
+		if err := s.InsertClicks(ctx, []model.ClickEvent{{Code: code, ClickedAt: time.Now()}}); err != nil {
+			t.Fatalf("InsertClicks: %v", err)
+		}
+	}
+
+	all, err := s.ListAll(ctx, 10, 0)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("ListAll: expected 3 links, got %d (%v)", len(all), err)
+	}
+	stats, err := s.Stats(ctx, time.Now())
+	if err != nil || stats.Links != 3 || stats.Clicks != 3 {
+		t.Errorf("Stats: expected 3 links and 3 clicks, got %+v (%v)", stats, err)
+	}
+	org, err := s.ListByOrg(ctx, "acme", "", 10, 0)
+	if err != nil || len(org) != 2 {
+		t.Errorf("ListByOrg: expected 2 links, got %d (%v)", len(org), err)
+	}
+	if n, err := s.CountLinks(ctx, "alice"); err != nil || n != 2 {
+		t.Errorf("CountLinks: expected 2, got %d (%v)", n, err)
+	}
+
+	nLinks, nClicks, err := s.EraseOwner(ctx, "alice")
+	if err != nil || nLinks != 2 || nClicks != 2 {
+		t.Fatalf("EraseOwner: expected 2 links and 2 clicks, got %d and %d (%v)", nLinks, nClicks, err)
+	}
+	if _, err := links.GetByCode(ctx, "a1"); err != ErrNotFound {
+		t.Errorf("expected alice's links gone from the link store, got %v", err)
+	}
+	stats, err = s.OrgStats(ctx, "acme", time.Now())
+	if err != nil || stats.Links != 1 || stats.Clicks != 1 {
+		t.Errorf("OrgStats: expected 1 link and 1 click, got %+v (%v)", stats, err)
+	}
+}
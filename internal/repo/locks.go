@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LockRepo hands out named leases shared by every instance using the same
+// store, so that work meant to happen once, such as a background job's run,
+// happens on one instance only.
+type LockRepo interface {
+	// TryLock takes the lease name for owner for ttl, reporting whether it
+	// did. A lease owner holds already is renewed; one held by another
+	// owner is only taken once it has run out.
+	TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Unlock gives up the lease name if owner holds it, so another owner
+	// need not wait for it to run out.
+	Unlock(ctx context.Context, name, owner string) error
+}
+
+func (r *PostgresRepo) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	// Leases run on the database's clock, which every instance shares.
+	const q = `
+		INSERT INTO job_locks (name, owner, locked_until) VALUES ($1, $2, now() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, locked_until = excluded.locked_until
+		WHERE job_locks.locked_until <= now() OR job_locks.owner = excluded.owner`
+
+	res, err := r.db.ExecContext(ctx, q, name, owner, ttl.Seconds())
+	n, err := rowsAffected(res, err)
+	return n == 1, err
+}
+
+func (r *PostgresRepo) Unlock(ctx context.Context, name, owner string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM job_locks WHERE name=$1 AND owner=$2`, name, owner)
+	return err
+}
+
+// TryLock upserts the lease and reads back who holds it, as the rows
+// MySQL reports affected by an upsert depend on the connection's flags.
+func (r *MySQLRepo) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	const q = `
+		INSERT INTO job_locks (name, owner, locked_until) VALUES (?, ?, CURRENT_TIMESTAMP(6) + INTERVAL ? MICROSECOND)
+		ON DUPLICATE KEY UPDATE
+			owner = IF(locked_until <= CURRENT_TIMESTAMP(6) OR owner = VALUES(owner), VALUES(owner), owner),
+			locked_until = IF(owner = VALUES(owner), VALUES(locked_until), locked_until)`
+
+	if _, err := r.db.ExecContext(ctx, q, name, owner, ttl.Microseconds()); err != nil {
+		return false, err
+	}
+	var holder string
+	if err := r.db.QueryRowContext(ctx, `SELECT owner FROM job_locks WHERE name=?`, name).Scan(&holder); err != nil {
+		return false, err
+	}
+	return holder == owner, nil
+}
+
+func (r *MySQLRepo) Unlock(ctx context.Context, name, owner string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM job_locks WHERE name=? AND owner=?`, name, owner)
+	return err
+}
+
+// jobLock is a lease held in memory.
+type jobLock struct {
+	owner string
+	until time.Time
+}
+
+func (r *MemoryRepo) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := r.locks[name]; ok && l.owner != owner && now.Before(l.until) {
+		return false, nil
+	}
+	r.locks[name] = jobLock{owner: owner, until: now.Add(ttl)}
+	return true, nil
+}
+
+func (r *MemoryRepo) Unlock(ctx context.Context, name, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.locks[name]; ok && l.owner == owner {
+		delete(r.locks, name)
+	}
+	return nil
+}
+
+// RedisLocks is a LockRepo in Redis, for fleets without a shared SQL
+// database or that would rather keep leases off it.
+type RedisLocks struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLocks returns a RedisLocks keeping each lease under prefix+name.
+func NewRedisLocks(client *redis.Client, prefix string) *RedisLocks {
+	return &RedisLocks{client: client, prefix: prefix}
+}
+
+// redisTryLock sets KEYS[1] to the owner ARGV[1] for ARGV[2] milliseconds
+// unless another owner holds it, returning 1 when it did.
+var redisTryLock = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+func (l *RedisLocks) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	n, err := redisTryLock.Run(ctx, l.client, []string{l.prefix + name}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// redisUnlock deletes KEYS[1] if the owner ARGV[1] holds it.
+var redisUnlock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (l *RedisLocks) Unlock(ctx context.Context, name, owner string) error {
+	return redisUnlock.Run(ctx, l.client, []string{l.prefix + name}, owner).Err()
+}
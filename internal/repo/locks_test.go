@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testLocks(t *testing.T, locks LockRepo, expire func(time.Duration)) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		owner string
+		want  bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"a", true}, // renewed
+	} {
+		if got, err := locks.TryLock(ctx, "job", tc.owner, time.Minute); err != nil || got != tc.want {
+			t.Fatalf("TryLock(%s): expected %v, got %v (%v)", tc.owner, tc.want, got, err)
+		}
+	}
+	if got, _ := locks.TryLock(ctx, "other", "b", time.Minute); !got {
+		t.Error("expected leases on other names to be free")
+	}
+
+	expire(time.Minute)
+	if got, err := locks.TryLock(ctx, "job", "b", time.Minute); err != nil || !got {
+		t.Errorf("expected an expired lease to be taken over, got %v (%v)", got, err)
+	}
+	if got, _ := locks.TryLock(ctx, "job", "a", time.Minute); got {
+		t.Error("expected the previous holder to have lost the lease")
+	}
+
+	if err := locks.Unlock(ctx, "job", "a"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got, _ := locks.TryLock(ctx, "job", "a", time.Minute); got {
+		t.Error("expected unlocking someone else's lease to leave it alone")
+	}
+	locks.Unlock(ctx, "job", "b")
+	if got, _ := locks.TryLock(ctx, "job", "a", time.Minute); !got {
+		t.Error("expected a released lease to be free at once")
+	}
+}
+
+func TestMemoryRepo_TryLock(t *testing.T) {
+	r := NewMemory()
+	testLocks(t, r, func(d time.Duration) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for name, l := range r.locks {
+			l.until = l.until.Add(-d)
+			r.locks[name] = l
+		}
+	})
+}
+
+func TestRedisLocks(t *testing.T) {
+	mr := miniredis.RunT(t)
+	testLocks(t, NewRedisLocks(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test:lock:"), mr.FastForward)
+}
+
+func TestPostgresRepo_TryLock(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+	testDB.Exec("DELETE FROM job_locks")
+	testLocks(t, NewPostgres(testDB), func(d time.Duration) {
+		testDB.Exec("UPDATE job_locks SET locked_until = locked_until - make_interval(secs => $1)", d.Seconds())
+	})
+}
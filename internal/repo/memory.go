@@ -0,0 +1,379 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// MemoryRepo is a URLRepo kept entirely in process memory. Data does not
+// survive a restart; it exists for demos, CI and tests without a database.
+type MemoryRepo struct {
+	mu     sync.RWMutex
+	byCode map[string]model.URLRecord
+	byLong map[string]string // longKey(tenant, domain, long_url) -> code
+	clicks []model.ClickEvent
+	daily  map[dailyKey]int
+	// archived holds the links ArchiveUnused moved out of byCode.
+	archived map[string]model.URLRecord
+
+	deliveries  map[string]model.WebhookDelivery
+	idempotency map[string]model.IdempotentResponse // idempotencyKey(owner, key) -> response
+	bans        map[string]model.BannedDomain
+	takedowns   map[string]model.Takedown
+	reports     map[int64]model.AbuseReport
+	reviews     map[string]model.Review
+	checks      map[string]model.LinkCheck
+	pageMeta    map[string]model.PageMeta
+	usage       map[usageKey]int
+	orgs        map[string]model.Org
+	members     map[string]map[string]model.OrgMember // org -> owner -> member
+	seq         uint64
+	settings    map[string]string
+	audit       []model.AuditEntry
+	locks       map[string]jobLock
+}
+
+func longKey(tenant, domain, long string) string { return tenant + "\x00" + domain + "\x00" + long }
+
+// dailyKey identifies a link's rolled-up clicks on one day.
+type dailyKey struct{ code, day string }
+
+func NewMemory() *MemoryRepo {
+	return &MemoryRepo{
+		byCode: make(map[string]model.URLRecord),
+		byLong: make(map[string]string),
+		daily:  make(map[dailyKey]int),
+
+		archived: make(map[string]model.URLRecord),
+
+		deliveries:  make(map[string]model.WebhookDelivery),
+		idempotency: make(map[string]model.IdempotentResponse),
+		bans:        make(map[string]model.BannedDomain),
+		takedowns:   make(map[string]model.Takedown),
+		reports:     make(map[int64]model.AbuseReport),
+		reviews:     make(map[string]model.Review),
+		checks:      make(map[string]model.LinkCheck),
+		pageMeta:    make(map[string]model.PageMeta),
+		usage:       make(map[usageKey]int),
+		orgs:        make(map[string]model.Org),
+		members:     make(map[string]map[string]model.OrgMember),
+		settings:    make(map[string]string),
+		locks:       make(map[string]jobLock),
+	}
+}
+
+func (r *MemoryRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	code, ok := r.byLong[longKey(tenantID(ctx), domain, long)]
+	if !ok {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return r.byCode[code], nil
+}
+
+func (r *MemoryRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rec, ok := r.byCode[code]
+	if !ok || !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+func (r *MemoryRepo) Insert(ctx context.Context, in model.URLRecord) (model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	in.Tenant = tenantID(ctx)
+	return r.insert(in)
+}
+
+func (r *MemoryRepo) Upsert(ctx context.Context, in model.URLRecord) (model.URLRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	in.Tenant = tenantID(ctx)
+	if code, ok := r.byLong[longKey(in.Tenant, in.Domain, in.LongUrl)]; ok && !in.Unique {
+		return r.byCode[code], false, nil
+	}
+	rec, err := r.insert(in)
+	if err != nil || in.ScanStatus == "" {
+		return rec, err == nil, err
+	}
+	rec.ScanStatus = in.ScanStatus
+	if in.ScannedAt != nil {
+		t := in.ScannedAt.UTC()
+		rec.ScannedAt = &t
+	}
+	r.byCode[rec.Code] = rec
+	return rec, true, nil
+}
+
+// insert stores in; the caller must hold mu.
+func (r *MemoryRepo) insert(in model.URLRecord) (model.URLRecord, error) {
+	if _, ok := r.byCode[in.Code]; ok {
+		return model.URLRecord{}, ErrDuplicateCode
+	}
+	if _, ok := r.byLong[longKey(in.Tenant, in.Domain, in.LongUrl)]; ok && !in.Unique {
+		return model.URLRecord{}, ErrDuplicateLongURL
+	}
+
+	now := time.Now().UTC()
+	if !in.CreatedAt.IsZero() {
+		now = in.CreatedAt.UTC()
+	}
+	rec := model.URLRecord{
+		ID:         in.ID,
+		Code:       in.Code,
+		LongUrl:    in.LongUrl,
+		ShortUrl:   in.ShortUrl,
+		CreatedAt:  now,
+		ScanStatus: "unchecked",
+		// Round-trip like the SQL repos so callers never share the map.
+		UTM:         decodeParams(encodeParams(in.UTM)),
+		Owner:       in.Owner,
+		UpdatedAt:   now,
+		Active:      true,
+		Domain:      in.Domain,
+		Title:       in.Title,
+		Description: in.Description,
+		Org:         in.Org,
+		OriginalURL: in.OriginalURL,
+		Unique:      in.Unique,
+		MaxClicks:   in.MaxClicks,
+		FallbackURL: in.FallbackURL,
+		Tenant:      in.Tenant,
+	}
+	if in.ExpiresAt != nil {
+		t := in.ExpiresAt.UTC()
+		rec.ExpiresAt = &t
+	}
+	r.byCode[rec.Code] = rec
+	r.index(rec)
+
+	return rec, nil
+}
+
+// index makes rec findable by its destination, unless it is a unique link;
+// unindex undoes that. The caller must hold mu.
+func (r *MemoryRepo) index(rec model.URLRecord) {
+	if !rec.Unique {
+		r.byLong[longKey(rec.Tenant, rec.Domain, rec.LongUrl)] = rec.Code
+	}
+}
+
+func (r *MemoryRepo) unindex(rec model.URLRecord) {
+	if key := longKey(rec.Tenant, rec.Domain, rec.LongUrl); r.byLong[key] == rec.Code {
+		delete(r.byLong, key)
+	}
+}
+
+func (r *MemoryRepo) Update(ctx context.Context, in model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.byCode[in.Code]
+	if !ok || !inTenant(ctx, rec) || !rec.UpdatedAt.Equal(prev) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	if code, ok := r.byLong[longKey(rec.Tenant, rec.Domain, in.LongUrl)]; ok && code != rec.Code && !rec.Unique {
+		return model.URLRecord{}, ErrDuplicateLongURL
+	}
+
+	r.unindex(rec)
+	rec.LongUrl = in.LongUrl
+	rec.UTM = decodeParams(encodeParams(in.UTM))
+	rec.ScanStatus = in.ScanStatus
+	rec.ScannedAt = in.ScannedAt
+	rec.Title = in.Title
+	rec.Description = in.Description
+	rec.OriginalURL = in.OriginalURL
+	rec.FallbackURL = in.FallbackURL
+	rec.UpdatedAt = time.Now().UTC()
+	r.byCode[rec.Code] = rec
+	r.index(rec)
+
+	return rec, nil
+}
+
+func (r *MemoryRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.byCode[code]
+	if !ok || !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	rec.Active = active
+	rec.UpdatedAt = time.Now().UTC()
+	r.byCode[code] = rec
+
+	return rec, nil
+}
+
+func (r *MemoryRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.byCode[code]
+	if !ok || !inTenant(ctx, rec) || !rec.Active || rec.MaxClicks <= 0 || rec.ClickCount >= int64(rec.MaxClicks) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	rec.ClickCount++
+	if rec.ClickCount >= int64(rec.MaxClicks) {
+		rec.Active = false
+		rec.UpdatedAt = time.Now().UTC()
+	}
+	r.byCode[code] = rec
+
+	return rec, nil
+}
+
+func (r *MemoryRepo) Delete(ctx context.Context, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.byCode[code]
+	if !ok || !inTenant(ctx, rec) {
+		return ErrNotFound
+	}
+	delete(r.byCode, code)
+	r.unindex(rec)
+	return nil
+}
+
+func (r *MemoryRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var recs []model.URLRecord
+	for _, rec := range r.byCode {
+		if rec.Owner == owner && inTenant(ctx, rec) && strings.Contains(strings.ToLower(rec.LongUrl), query) {
+			recs = append(recs, rec)
+		}
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (r *MemoryRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var recs []model.URLRecord
+	for code, rec := range r.byCode {
+		if rec.Owner == owner && inTenant(ctx, rec) && code > after {
+			recs = append(recs, rec)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Code < recs[j].Code })
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+// page sorts recs newest first, as the SQL repos do, and cuts out one page.
+func page(recs []model.URLRecord, limit, offset int) []model.URLRecord {
+	sort.Slice(recs, func(i, j int) bool {
+		if !recs[i].CreatedAt.Equal(recs[j].CreatedAt) {
+			return recs[i].CreatedAt.After(recs[j].CreatedAt)
+		}
+		return recs[i].ID < recs[j].ID
+	})
+	if offset >= len(recs) {
+		return nil
+	}
+	recs = recs[offset:]
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs
+}
+
+func (r *MemoryRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.byCode[code]
+	if !ok || !inTenant(ctx, rec) {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	rec.ScanStatus = status
+	rec.ScannedAt = &now
+	r.byCode[code] = rec
+
+	return nil
+}
+
+func (r *MemoryRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var recs []model.URLRecord
+	for _, rec := range r.byCode {
+		if !inTenant(ctx, rec) || rec.ScanStatus == "flagged" || (rec.ScannedAt != nil && !rec.ScannedAt.Before(before)) {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		a, b := recs[i].ScannedAt, recs[j].ScannedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+func (r *MemoryRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	r.mu.RLock()
+	codes := make([]string, 0, len(r.byCode))
+	for code := range r.byCode {
+		codes = append(codes, code)
+	}
+	r.mu.RUnlock()
+
+	for _, code := range codes {
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for code, rec := range r.byCode {
+		if n >= limit {
+			break
+		}
+		expired := rec.ExpiresAt != nil && rec.ExpiresAt.Before(expiredBefore)
+		disabled := !disabledBefore.IsZero() && !rec.Active && rec.UpdatedAt.Before(disabledBefore)
+		if !inTenant(ctx, rec) || (!expired && !disabled) {
+			continue
+		}
+		delete(r.byCode, code)
+		r.unindex(rec)
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,505 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func TestMemoryRepo_InsertAndGet(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	utm := map[string]string{"utm_source": "newsletter"}
+	rec, err := repo.Insert(ctx, model.URLRecord{ID: "id-1", Code: "MEM123", LongUrl: "https://example.com/mem", ShortUrl: "https://shawt.ly/MEM123", UTM: utm})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if rec.CreatedAt.IsZero() {
+		t.Error("Expected CreatedAt to be set")
+	}
+	if !reflect.DeepEqual(rec.UTM, utm) {
+		t.Errorf("Expected UTM %v, got %v", utm, rec.UTM)
+	}
+
+	byCode, err := repo.GetByCode(ctx, "MEM123")
+	if err != nil {
+		t.Fatalf("GetByCode failed: %v", err)
+	}
+	if !reflect.DeepEqual(byCode, rec) {
+		t.Errorf("Expected %+v, got %+v", rec, byCode)
+	}
+
+	byLong, err := repo.GetByLong(ctx, "", "https://example.com/mem")
+	if err != nil {
+		t.Fatalf("GetByLong failed: %v", err)
+	}
+	if !reflect.DeepEqual(byLong, rec) {
+		t.Errorf("Expected %+v, got %+v", rec, byLong)
+	}
+}
+
+func TestMemoryRepo_NotFound(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	if _, err := repo.GetByCode(ctx, "NOPE"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+	if _, err := repo.GetByLong(ctx, "", "https://example.com/nope"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestMemoryRepo_Duplicates(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	if _, err := repo.Insert(ctx, model.URLRecord{ID: "id-1", Code: "DUP123", LongUrl: "https://example.com/1", ShortUrl: "https://shawt.ly/DUP123"}); err != nil {
+		t.Fatalf("First insert failed: %v", err)
+	}
+
+	_, err := repo.Insert(ctx, model.URLRecord{ID: "id-2", Code: "DUP123", LongUrl: "https://example.com/2", ShortUrl: "https://shawt.ly/DUP123"})
+	if !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("Expected ErrDuplicateCode, got %v", err)
+	}
+
+	_, err = repo.Insert(ctx, model.URLRecord{ID: "id-3", Code: "OTHER1", LongUrl: "https://example.com/1", ShortUrl: "https://shawt.ly/OTHER1"})
+	if !errors.Is(err, ErrDuplicateLongURL) {
+		t.Errorf("Expected ErrDuplicateLongURL, got %v", err)
+	}
+}
+
+func TestMemoryRepo_Upsert(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	first, created, err := repo.Upsert(ctx, model.URLRecord{ID: "id-1", Code: "UPS001", LongUrl: "https://example.com/1", ScanStatus: "clean"})
+	if err != nil || !created || first.ScanStatus != "clean" {
+		t.Fatalf("Expected a new clean record, got %+v created=%v, %v", first, created, err)
+	}
+
+	again, created, err := repo.Upsert(ctx, model.URLRecord{ID: "id-2", Code: "UPS002", LongUrl: "https://example.com/1"})
+	if err != nil || created || !reflect.DeepEqual(again, first) {
+		t.Errorf("Expected existing %+v, got %+v created=%v, %v", first, again, created, err)
+	}
+
+	if _, _, err := repo.Upsert(ctx, model.URLRecord{ID: "id-3", Code: "UPS001", LongUrl: "https://example.com/2"}); !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("Expected ErrDuplicateCode, got %v", err)
+	}
+}
+
+func TestMemoryRepo_ConcurrentInsert(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code := fmt.Sprintf("C%05d", i)
+			_, err := repo.Insert(ctx, model.URLRecord{ID: code, Code: code, LongUrl: "https://example.com/same", ShortUrl: "https://shawt.ly/" + code})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	var ok int
+	for err := range errs {
+		if err == nil {
+			ok++
+		} else if !errors.Is(err, ErrDuplicateLongURL) {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("Expected exactly 1 successful insert, got %d", ok)
+	}
+}
+
+func TestMemoryRepo_Update(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	rec, _ := repo.Insert(ctx, model.URLRecord{ID: "id-1", Code: "UPD123", LongUrl: "https://example.com/old", ShortUrl: "https://shawt.ly/UPD123"})
+	repo.Insert(ctx, model.URLRecord{ID: "id-2", Code: "UPD456", LongUrl: "https://example.com/taken", ShortUrl: "https://shawt.ly/UPD456"})
+
+	rec.LongUrl = "https://example.com/taken"
+	if _, err := repo.Update(ctx, rec, rec.UpdatedAt); !errors.Is(err, ErrDuplicateLongURL) {
+		t.Errorf("Expected ErrDuplicateLongURL, got %v", err)
+	}
+
+	rec.LongUrl = "https://example.com/new"
+	updated, err := repo.Update(ctx, rec, rec.UpdatedAt)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.LongUrl != "https://example.com/new" {
+		t.Errorf("Expected new long URL, got %s", updated.LongUrl)
+	}
+	if _, err := repo.GetByLong(ctx, "", "https://example.com/old"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected old long URL to be released, got %v", err)
+	}
+
+	// A second writer holding the original revision loses.
+	rec.UpdatedAt = rec.UpdatedAt.Add(-time.Second)
+	if _, err := repo.Update(ctx, rec, rec.UpdatedAt); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for stale revision, got %v", err)
+	}
+}
+
+func TestMemoryRepo_SetActive(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	rec, _ := repo.Insert(ctx, model.URLRecord{ID: "id-1", Code: "OFF123", LongUrl: "https://example.com/off", ShortUrl: "https://shawt.ly/OFF123"})
+	if !rec.Active {
+		t.Fatal("Expected new links to be active")
+	}
+
+	if _, err := repo.SetActive(ctx, "OFF123", false); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+	if got, _ := repo.GetByCode(ctx, "OFF123"); got.Active {
+		t.Error("Expected link to be disabled")
+	}
+
+	// The code stays taken while disabled.
+	if _, err := repo.Insert(ctx, model.URLRecord{ID: "id-2", Code: "OFF123", LongUrl: "https://example.com/other"}); !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("Expected ErrDuplicateCode, got %v", err)
+	}
+
+	if _, err := repo.SetActive(ctx, "NOPE42", false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestMemoryRepo_UniqueLinks(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	shared, _, err := repo.Upsert(ctx, model.URLRecord{ID: "id-1", Code: "UNQ001", LongUrl: "https://example.com/"})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	unique, created, err := repo.Upsert(ctx, model.URLRecord{ID: "id-2", Code: "UNQ002", LongUrl: "https://example.com/", Unique: true})
+	if err != nil || !created || !unique.Unique {
+		t.Fatalf("Expected a second, unique link, got %+v created=%v, %v", unique, created, err)
+	}
+
+	// Unique links stay out of destination lookups, before and after edits.
+	if rec, err := repo.GetByLong(ctx, "", "https://example.com/"); err != nil || rec.Code != shared.Code {
+		t.Errorf("Expected the shared link %s, got %s, %v", shared.Code, rec.Code, err)
+	}
+	unique.LongUrl = "https://example.com/other"
+	if _, err := repo.Update(ctx, unique, unique.UpdatedAt); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := repo.GetByLong(ctx, "", "https://example.com/other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for the unique link's destination, got %v", err)
+	}
+
+	// Deleting a unique link leaves the shared one findable.
+	if _, _, err := repo.Upsert(ctx, model.URLRecord{ID: "id-3", Code: "UNQ003", LongUrl: "https://example.com/", Unique: true}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if err := repo.Delete(ctx, "UNQ003"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if rec, err := repo.GetByLong(ctx, "", "https://example.com/"); err != nil || rec.Code != shared.Code {
+		t.Errorf("Expected the shared link %s to survive, got %s, %v", shared.Code, rec.Code, err)
+	}
+}
+
+func TestMemoryRepo_PerDomainLongURL(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	if _, err := repo.Insert(ctx, model.URLRecord{ID: "id-1", Code: "DOM001", LongUrl: "https://example.com/"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if _, err := repo.Insert(ctx, model.URLRecord{ID: "id-2", Code: "DOM002", LongUrl: "https://example.com/", Domain: "example.to"}); err != nil {
+		t.Fatalf("Expected the same URL to be allowed on another domain, got %v", err)
+	}
+
+	rec, err := repo.GetByLong(ctx, "example.to", "https://example.com/")
+	if err != nil || rec.Code != "DOM002" {
+		t.Errorf("Expected DOM002 on example.to, got %s, %v", rec.Code, err)
+	}
+	if _, err := repo.GetByLong(ctx, "other.example", "https://example.com/"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows on an unused domain, got %v", err)
+	}
+}
+
+func TestMemoryRepo_Tenants(t *testing.T) {
+	repo := NewMemory()
+	acme := WithTenant(context.Background(), "acme")
+	home := WithTenant(context.Background(), "")
+
+	if _, err := repo.Insert(home, model.URLRecord{ID: "id-1", Code: "TEN001", LongUrl: "https://example.com/", Owner: "alice"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if _, err := repo.Insert(acme, model.URLRecord{ID: "id-2", Code: "TEN002", LongUrl: "https://example.com/", Owner: "alice"}); err != nil {
+		t.Fatalf("Expected the same URL to be allowed in another tenant, got %v", err)
+	}
+
+	if _, err := repo.GetByCode(acme, "TEN001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected another tenant's link to be hidden, got %v", err)
+	}
+	if err := repo.Delete(acme, "TEN001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected another tenant's link to survive Delete, got %v", err)
+	}
+	if rec, err := repo.GetByLong(acme, "", "https://example.com/"); err != nil || rec.Code != "TEN002" {
+		t.Errorf("Expected TEN002 in acme, got %s, %v", rec.Code, err)
+	}
+	if recs, _ := repo.ListByOwner(home, "alice", "", 10, 0); len(recs) != 1 || recs[0].Code != "TEN001" {
+		t.Errorf("Expected alice's default-tenant link only, got %+v", recs)
+	}
+
+	// Unscoped contexts, as background jobs use, see every tenant.
+	if recs, _ := repo.ListAll(context.Background(), 10, 0); len(recs) != 2 {
+		t.Errorf("Expected both links unscoped, got %d", len(recs))
+	}
+	if recs, _ := repo.ListAll(AllTenants(acme), 10, 0); len(recs) != 2 {
+		t.Errorf("Expected AllTenants to lift the scope, got %d links", len(recs))
+	}
+}
+
+func TestMemoryRepo_IdempotencyKeys(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	if _, reserved, err := repo.ReserveIdempotencyKey(ctx, "alice", "k1", "h1"); err != nil || !reserved {
+		t.Fatalf("Expected fresh reservation, got reserved=%v err=%v", reserved, err)
+	}
+	resp := model.IdempotentResponse{Status: 201, Header: map[string]string{"ETag": `"v1"`}, Body: []byte(`{}`)}
+	if err := repo.SaveIdempotentResponse(ctx, "alice", "k1", resp); err != nil {
+		t.Fatalf("SaveIdempotentResponse failed: %v", err)
+	}
+
+	prev, reserved, _ := repo.ReserveIdempotencyKey(ctx, "alice", "k1", "h2")
+	if reserved || prev.RequestHash != "h1" || prev.Status != 201 || prev.Header["ETag"] != `"v1"` {
+		t.Errorf("Expected stored response, got reserved=%v %+v", reserved, prev)
+	}
+
+	// Completed responses survive a release; only in-flight ones are dropped.
+	repo.ReleaseIdempotencyKey(ctx, "alice", "k1")
+	if _, reserved, _ := repo.ReserveIdempotencyKey(ctx, "alice", "k1", "h1"); reserved {
+		t.Error("Expected completed key to stay reserved")
+	}
+
+	if n, _ := repo.DeleteIdempotencyKeys(ctx, time.Now().Add(time.Minute)); n != 1 {
+		t.Errorf("Expected 1 key deleted, got %d", n)
+	}
+}
+
+func TestMemoryRepo_DeleteAndList(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	for i, code := range []string{"LST001", "LST002", "LST003"} {
+		repo.Insert(ctx, model.URLRecord{ID: code, Code: code, LongUrl: "https://example.com/" + code, Owner: "alice"})
+		if i == 0 {
+			repo.Insert(ctx, model.URLRecord{ID: "other", Code: "OTH001", LongUrl: "https://example.com/other", Owner: "bob"})
+		}
+	}
+
+	recs, err := repo.ListByOwner(ctx, "alice", "", 2, 1)
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("Expected 2 links, got %d, %v", len(recs), err)
+	}
+	for _, rec := range recs {
+		if rec.Owner != "alice" {
+			t.Errorf("Expected only alice's links, got %+v", rec)
+		}
+	}
+
+	recs, err = repo.ListByOwner(ctx, "alice", "com/lst002", 10, 0)
+	if err != nil || len(recs) != 1 || recs[0].Code != "LST002" {
+		t.Errorf("Expected search to find LST002 only, got %+v, %v", recs, err)
+	}
+	if recs, _ := repo.ListByOwner(ctx, "alice", "other", 10, 0); len(recs) != 0 {
+		t.Errorf("Expected search to stay within alice's links, got %+v", recs)
+	}
+
+	recs, err = repo.ListAfter(ctx, "alice", "LST001", 1)
+	if err != nil || len(recs) != 1 || recs[0].Code != "LST002" {
+		t.Errorf("Expected LST002 after LST001, got %+v, %v", recs, err)
+	}
+	if recs, _ := repo.ListAfter(ctx, "alice", "LST003", 10); len(recs) != 0 {
+		t.Errorf("Expected nothing after the last code, got %+v", recs)
+	}
+
+	if err := repo.Delete(ctx, "LST001"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := repo.GetByCode(ctx, "LST001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected deleted link to be gone, got %v", err)
+	}
+	if _, err := repo.Insert(ctx, model.URLRecord{ID: "again", Code: "LST009", LongUrl: "https://example.com/LST001"}); err != nil {
+		t.Errorf("Expected the destination to be free again, got %v", err)
+	}
+	if err := repo.Delete(ctx, "LST001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestMemoryRepo_Orgs(t *testing.T) {
+	repo := NewMemory()
+	ctx := context.Background()
+
+	if _, err := repo.CreateOrg(ctx, model.Org{Slug: "acme", Name: "Acme"}, "alice"); err != nil {
+		t.Fatalf("CreateOrg failed: %v", err)
+	}
+	if _, err := repo.CreateOrg(ctx, model.Org{Slug: "acme"}, "bob"); !errors.Is(err, ErrDuplicateOrg) {
+		t.Errorf("Expected ErrDuplicateOrg, got %v", err)
+	}
+	if role, err := repo.MemberRole(ctx, "acme", "alice"); err != nil || role != model.RoleAdmin {
+		t.Errorf("Expected alice to be admin, got %q, %v", role, err)
+	}
+	if _, err := repo.MemberRole(ctx, "acme", "bob"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for a non-member, got %v", err)
+	}
+
+	repo.PutMember(ctx, "acme", model.OrgMember{Owner: "bob", Role: model.RoleMember})
+	repo.PutMember(ctx, "acme", model.OrgMember{Owner: "aaron", Role: model.RoleMember})
+	members, err := repo.ListMembers(ctx, "acme")
+	if err != nil || len(members) != 3 || members[0].Owner != "alice" || members[1].Owner != "aaron" {
+		t.Errorf("Expected alice first, then aaron and bob, got %+v, %v", members, err)
+	}
+	if orgs, _ := repo.ListOrgs(ctx, "bob"); len(orgs) != 1 || orgs[0].Slug != "acme" {
+		t.Errorf("Expected bob to belong to acme, got %+v", orgs)
+	}
+
+	repo.Insert(ctx, model.URLRecord{ID: "o1", Code: "ORG001", LongUrl: "https://example.com/org", Owner: "bob", Org: "acme"})
+	repo.Insert(ctx, model.URLRecord{ID: "o2", Code: "OWN001", LongUrl: "https://example.com/own", Owner: "bob"})
+	recs, err := repo.ListByOrg(ctx, "acme", "", 10, 0)
+	if err != nil || len(recs) != 1 || recs[0].Code != "ORG001" {
+		t.Errorf("Expected only ORG001, got %+v, %v", recs, err)
+	}
+	if stats, _ := repo.OrgStats(ctx, "acme", time.Now()); stats.Links != 1 || stats.Active != 1 {
+		t.Errorf("Expected one active link, got %+v", stats)
+	}
+
+	if err := repo.DeleteMember(ctx, "acme", "bob"); err != nil {
+		t.Fatalf("DeleteMember failed: %v", err)
+	}
+	if err := repo.DeleteMember(ctx, "acme", "bob"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestMemoryRepo_RollupClicks(t *testing.T) {
+	r := NewMemory()
+	ctx := context.Background()
+
+	may1 := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	r.InsertClicks(ctx, []model.ClickEvent{
+		{Code: "AbC123", ClickedAt: may1},
+		{Code: "AbC123", ClickedAt: may1.Add(2 * time.Minute)},
+		{Code: "XyZ789", ClickedAt: may1},
+	})
+	if err := r.RollupClicks(ctx); err != nil {
+		t.Fatalf("RollupClicks failed: %v", err)
+	}
+
+	// A late click for a day already rolled up is still counted.
+	r.InsertClicks(ctx, []model.ClickEvent{{Code: "AbC123", ClickedAt: may1}})
+	r.RollupClicks(ctx)
+
+	days, err := r.DailyClicks(ctx, "AbC123", may1.AddDate(0, 0, -1), may1.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("DailyClicks failed: %v", err)
+	}
+	want := []model.DailyClicks{{Day: "2024-05-01", Clicks: 2}, {Day: "2024-05-02", Clicks: 1}}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("expected %v, got %v", want, days)
+	}
+	if days, _ := r.DailyClicks(ctx, "AbC123", may1.AddDate(0, 0, 1), may1.AddDate(0, 0, 1)); len(days) != 1 {
+		t.Errorf("expected the range to be honored, got %v", days)
+	}
+}
+
+func TestMemoryRepo_TopCodes(t *testing.T) {
+	r := NewMemory()
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	r.InsertClicks(ctx, []model.ClickEvent{
+		{Code: "old", ClickedAt: now.AddDate(0, 0, -30)},
+		{Code: "old", ClickedAt: now.AddDate(0, 0, -30)},
+		{Code: "old", ClickedAt: now.AddDate(0, 0, -30)},
+		{Code: "two", ClickedAt: now.AddDate(0, 0, -1)},
+		{Code: "two", ClickedAt: now},
+		{Code: "one", ClickedAt: now},
+		{Code: "b", ClickedAt: now},
+	})
+	r.RollupClicks(ctx)
+
+	codes, err := r.TopCodes(ctx, now.AddDate(0, 0, -7), 3)
+	if err != nil {
+		t.Fatalf("TopCodes failed: %v", err)
+	}
+	if want := []string{"two", "b", "one"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("expected %v, got %v", want, codes)
+	}
+}
+
+func TestMemoryRepo_EraseOwner(t *testing.T) {
+	r := NewMemory()
+	ctx := context.Background()
+
+	r.Insert(ctx, model.URLRecord{ID: "1", Code: "ALI001", LongUrl: "https://example.com/1", Owner: "alice"})
+	r.Insert(ctx, model.URLRecord{ID: "2", Code: "ALI002", LongUrl: "https://example.com/2", Owner: "alice"})
+	r.Insert(ctx, model.URLRecord{ID: "3", Code: "BOB001", LongUrl: "https://example.com/3", Owner: "bob"})
+	now := time.Now().UTC()
+	r.InsertClicks(ctx, []model.ClickEvent{
+		{Code: "ALI001", ClickedAt: now},
+		{Code: "ALI002", ClickedAt: now},
+		{Code: "ALI002", ClickedAt: now},
+		{Code: "BOB001", ClickedAt: now},
+	})
+	r.RollupClicks(ctx)
+	alice := model.URLRecord{Code: "ALI001", LongUrl: "https://example.com/1", Owner: "alice"}
+	bob := model.URLRecord{Code: "BOB001", LongUrl: "https://example.com/3", Owner: "bob"}
+	r.InsertAudit(ctx, model.AuditEntry{Action: "link.updated", Actor: "alice", Subject: "ALI001", Before: &alice, After: &alice})
+	r.InsertAudit(ctx, model.AuditEntry{Action: "link.deleted", Actor: "bob", Subject: "BOB001", Before: &bob})
+
+	links, clicks, err := r.EraseOwner(ctx, "alice")
+	if err != nil || links != 2 || clicks != 3 {
+		t.Fatalf("expected 2 links and 3 clicks erased, got %d, %d, %v", links, clicks, err)
+	}
+	entries, _ := r.ListAudit(ctx, model.AuditFilter{}, 10, 0)
+	if len(entries) != 2 || entries[1].Before != nil || entries[1].After != nil {
+		t.Errorf("expected alice's audit snapshots to be cleared, got %+v", entries)
+	}
+	if entries[0].Before == nil {
+		t.Errorf("expected bob's audit snapshot to be kept, got %+v", entries[0])
+	}
+	if _, err := r.GetByCode(ctx, "ALI001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected alice's link to be gone, got %v", err)
+	}
+	if days, _ := r.DailyClicks(ctx, "ALI002", now, now); len(days) != 0 {
+		t.Errorf("expected alice's daily totals to be gone, got %v", days)
+	}
+	if n, _ := r.CountClicks(ctx, "BOB001"); n != 1 {
+		t.Errorf("expected bob's clicks to be kept, got %d", n)
+	}
+
+	if n, err := r.PurgeClicks(ctx, "BOB001"); err != nil || n != 1 {
+		t.Errorf("expected 1 click purged, got %d, %v", n, err)
+	}
+	if _, err := r.GetByCode(ctx, "BOB001"); err != nil {
+		t.Errorf("expected the link to survive a purge, got %v", err)
+	}
+}
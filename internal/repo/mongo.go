@@ -0,0 +1,415 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Names of the unique indexes mapMongoError tells apart.
+const (
+	mongoCodeIndex = "code"
+	mongoLongIndex = "long_url"
+)
+
+// MongoRepo is a URLRepo on a MongoDB collection with one document per
+// link. Unique indexes on code and, for links that are found by their
+// destination, on tenant, domain and long URL keep both unique; the
+// duplicate key errors they raise become ErrDuplicateCode and
+// ErrDuplicateLongURL.
+type MongoRepo struct{ links *mongo.Collection }
+
+func NewMongo(links *mongo.Collection) *MongoRepo { return &MongoRepo{links} }
+
+// EnsureIndexes creates the indexes the repo relies on, unless they exist.
+func (r *MongoRepo) EnsureIndexes(ctx context.Context) error {
+	_, err := r.links.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetName(mongoCodeIndex).SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "domain", Value: 1}, {Key: "long_url", Value: 1}},
+			Options: options.Index().SetName(mongoLongIndex).SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "dedup", Value: true}}),
+		},
+		{
+			Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetName("owner_code"),
+		},
+		{
+			Keys:    bson.D{{Key: "scanned_at", Value: 1}},
+			Options: options.Index().SetName("scanned_at"),
+		},
+	})
+	return err
+}
+
+// mongoLink is a link as stored. MongoDB keeps times to the millisecond, so
+// new links are stamped at that precision for Update to compare exactly.
+type mongoLink struct {
+	ID          string            `bson:"_id"`
+	Code        string            `bson:"code"`
+	LongURL     string            `bson:"long_url"`
+	ShortURL    string            `bson:"short_url"`
+	CreatedAt   time.Time         `bson:"created_at"`
+	UpdatedAt   time.Time         `bson:"updated_at"`
+	ScanStatus  string            `bson:"scan_status"`
+	ScannedAt   *time.Time        `bson:"scanned_at"`
+	UTM         map[string]string `bson:"utm,omitempty"`
+	Owner       string            `bson:"owner"`
+	Active      bool              `bson:"active"`
+	Domain      string            `bson:"domain"`
+	ExpiresAt   *time.Time        `bson:"expires_at"`
+	Title       string            `bson:"title"`
+	Description string            `bson:"description"`
+	Org         string            `bson:"org"`
+	OriginalURL string            `bson:"original_url"`
+	Dedup       bool              `bson:"dedup"`
+	MaxClicks   int               `bson:"max_clicks"`
+	ClickCount  int64             `bson:"click_count"`
+	FallbackURL string            `bson:"fallback_url,omitempty"`
+	Tenant      string            `bson:"tenant"`
+}
+
+func toMongo(rec model.URLRecord) mongoLink {
+	return mongoLink{
+		ID:          rec.ID,
+		Code:        rec.Code,
+		LongURL:     rec.LongUrl,
+		ShortURL:    rec.ShortUrl,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+		ScanStatus:  rec.ScanStatus,
+		ScannedAt:   rec.ScannedAt,
+		UTM:         rec.UTM,
+		Owner:       rec.Owner,
+		Active:      rec.Active,
+		Domain:      rec.Domain,
+		ExpiresAt:   rec.ExpiresAt,
+		Title:       rec.Title,
+		Description: rec.Description,
+		Org:         rec.Org,
+		OriginalURL: rec.OriginalURL,
+		Dedup:       !rec.Unique,
+		MaxClicks:   rec.MaxClicks,
+		ClickCount:  rec.ClickCount,
+		FallbackURL: rec.FallbackURL,
+		Tenant:      rec.Tenant,
+	}
+}
+
+func (l mongoLink) record() model.URLRecord {
+	return model.URLRecord{
+		ID:          l.ID,
+		Code:        l.Code,
+		LongUrl:     l.LongURL,
+		ShortUrl:    l.ShortURL,
+		CreatedAt:   l.CreatedAt.UTC(),
+		UpdatedAt:   l.UpdatedAt.UTC(),
+		ScanStatus:  l.ScanStatus,
+		ScannedAt:   utcPtr(l.ScannedAt),
+		UTM:         l.UTM,
+		Owner:       l.Owner,
+		Active:      l.Active,
+		Domain:      l.Domain,
+		ExpiresAt:   utcPtr(l.ExpiresAt),
+		Title:       l.Title,
+		Description: l.Description,
+		Org:         l.Org,
+		OriginalURL: l.OriginalURL,
+		Unique:      !l.Dedup,
+		MaxClicks:   l.MaxClicks,
+		ClickCount:  l.ClickCount,
+		FallbackURL: l.FallbackURL,
+		Tenant:      l.Tenant,
+	}
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// dupIndex finds the index named in a duplicate key error, which comes
+// before the duplicated, user controlled, value.
+var dupIndex = regexp.MustCompile(`index: (\S+) dup key`)
+
+// mapMongoError translates missing documents and duplicate keys into the
+// driver-agnostic repo errors.
+func mapMongoError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	m := dupIndex.FindStringSubmatch(err.Error())
+	switch {
+	case m == nil:
+		return err
+	case m[1] == mongoLongIndex:
+		return ErrDuplicateLongURL
+	case m[1] == mongoCodeIndex:
+		return ErrDuplicateCode
+	}
+	return err
+}
+
+// byCode filters code's link, if it is visible to ctx.
+func byCode(ctx context.Context, code string) bson.D {
+	return inMongoTenant(ctx, bson.D{{Key: "code", Value: code}})
+}
+
+// inMongoTenant narrows filter to the links visible to ctx.
+func inMongoTenant(ctx context.Context, filter bson.D) bson.D {
+	if id, ok := TenantOf(ctx); ok {
+		filter = append(filter, bson.E{Key: "tenant", Value: id})
+	}
+	return filter
+}
+
+func (r *MongoRepo) findOne(ctx context.Context, filter bson.D) (model.URLRecord, error) {
+	var l mongoLink
+	if err := r.links.FindOne(ctx, filter).Decode(&l); err != nil {
+		return model.URLRecord{}, mapMongoError(err)
+	}
+	return l.record(), nil
+}
+
+func (r *MongoRepo) find(ctx context.Context, filter bson.D, opts *options.FindOptionsBuilder) ([]model.URLRecord, error) {
+	cur, err := r.links.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var links []mongoLink
+	if err := cur.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	var recs []model.URLRecord
+	for _, l := range links {
+		recs = append(recs, l.record())
+	}
+	return recs, nil
+}
+
+// findAndUpdate applies update to the link filter matches and returns it as
+// updated.
+func (r *MongoRepo) findAndUpdate(ctx context.Context, filter bson.D, update any) (model.URLRecord, error) {
+	var l mongoLink
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.links.FindOneAndUpdate(ctx, filter, update, opts).Decode(&l); err != nil {
+		return model.URLRecord{}, mapMongoError(err)
+	}
+	return l.record(), nil
+}
+
+func (r *MongoRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	return r.findOne(ctx, byCode(ctx, code))
+}
+
+func (r *MongoRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	return r.findOne(ctx, bson.D{{Key: "tenant", Value: tenantID(ctx)}, {Key: "domain", Value: domain}, {Key: "long_url", Value: long}, {Key: "dedup", Value: true}})
+}
+
+// newMongoLink fills in what Insert leaves to the database.
+func newMongoLink(ctx context.Context, in model.URLRecord) mongoLink {
+	now := time.Now()
+	if !in.CreatedAt.IsZero() {
+		now = in.CreatedAt
+	}
+	now = now.UTC().Truncate(time.Millisecond)
+	l := toMongo(in)
+	l.CreatedAt, l.UpdatedAt = now, now
+	l.ScanStatus = "unchecked"
+	l.ScannedAt = nil
+	l.UTM = decodeParams(encodeParams(in.UTM))
+	l.Active = true
+	l.ClickCount = 0
+	l.Tenant = tenantID(ctx)
+	if in.ExpiresAt != nil {
+		t := in.ExpiresAt.UTC().Truncate(time.Millisecond)
+		l.ExpiresAt = &t
+	}
+	return l
+}
+
+func (r *MongoRepo) Insert(ctx context.Context, in model.URLRecord) (model.URLRecord, error) {
+	l := newMongoLink(ctx, in)
+	if _, err := r.links.InsertOne(ctx, l); err != nil {
+		return model.URLRecord{}, mapMongoError(err)
+	}
+	return l.record(), nil
+}
+
+func (r *MongoRepo) Upsert(ctx context.Context, in model.URLRecord) (model.URLRecord, bool, error) {
+	l := newMongoLink(ctx, in)
+	if in.ScanStatus != "" {
+		l.ScanStatus = in.ScanStatus
+		if in.ScannedAt != nil {
+			t := in.ScannedAt.UTC().Truncate(time.Millisecond)
+			l.ScannedAt = &t
+		}
+	}
+	if in.Unique {
+		if _, err := r.links.InsertOne(ctx, l); err != nil {
+			return model.URLRecord{}, false, mapMongoError(err)
+		}
+		return l.record(), true, nil
+	}
+
+	// The link is only inserted when its destination has none yet; either
+	// way the one that ends up stored comes back.
+	filter := bson.D{{Key: "tenant", Value: l.Tenant}, {Key: "domain", Value: l.Domain}, {Key: "long_url", Value: l.LongURL}, {Key: "dedup", Value: true}}
+	rec, err := r.findAndUpdate(ctx, filter, bson.D{{Key: "$setOnInsert", Value: l}})
+	if errors.Is(err, ErrDuplicateLongURL) {
+		// Two upserts raced to insert; the loser finds the winner's link.
+		rec, err = r.GetByLong(ctx, in.Domain, in.LongUrl)
+	}
+	if err != nil {
+		return model.URLRecord{}, false, err
+	}
+	return rec, rec.ID == l.ID, nil
+}
+
+func (r *MongoRepo) Update(ctx context.Context, rec model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	filter := inMongoTenant(ctx, bson.D{{Key: "code", Value: rec.Code}, {Key: "updated_at", Value: prev}})
+	return r.findAndUpdate(ctx, filter, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "long_url", Value: rec.LongUrl},
+		{Key: "utm", Value: decodeParams(encodeParams(rec.UTM))},
+		{Key: "scan_status", Value: rec.ScanStatus},
+		{Key: "scanned_at", Value: rec.ScannedAt},
+		{Key: "title", Value: rec.Title},
+		{Key: "description", Value: rec.Description},
+		{Key: "original_url", Value: rec.OriginalURL},
+		{Key: "fallback_url", Value: rec.FallbackURL},
+		{Key: "updated_at", Value: time.Now().UTC().Truncate(time.Millisecond)},
+	}}})
+}
+
+func (r *MongoRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	return r.findAndUpdate(ctx, byCode(ctx, code), bson.D{{Key: "$set", Value: bson.D{
+		{Key: "active", Value: active},
+		{Key: "updated_at", Value: time.Now().UTC().Truncate(time.Millisecond)},
+	}}})
+}
+
+func (r *MongoRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	filter := append(byCode(ctx, code),
+		bson.E{Key: "active", Value: true},
+		bson.E{Key: "max_clicks", Value: bson.D{{Key: "$gt", Value: 0}}},
+		bson.E{Key: "$expr", Value: bson.D{{Key: "$lt", Value: bson.A{"$click_count", "$max_clicks"}}}},
+	)
+	// A pipeline update sees the document as it was, like SQL's SET.
+	left := bson.D{{Key: "$lt", Value: bson.A{bson.D{{Key: "$add", Value: bson.A{"$click_count", 1}}}, "$max_clicks"}}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "click_count", Value: bson.D{{Key: "$add", Value: bson.A{"$click_count", 1}}}},
+		{Key: "active", Value: left},
+		{Key: "updated_at", Value: bson.D{{Key: "$cond", Value: bson.A{left, "$updated_at", time.Now().UTC().Truncate(time.Millisecond)}}}},
+	}}}}
+	return r.findAndUpdate(ctx, filter, update)
+}
+
+func (r *MongoRepo) Delete(ctx context.Context, code string) error {
+	res, err := r.links.DeleteOne(ctx, byCode(ctx, code))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	filter := inMongoTenant(ctx, bson.D{
+		{Key: "owner", Value: owner},
+		{Key: "long_url", Value: bson.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}},
+	})
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}).SetSkip(int64(offset)).SetLimit(int64(limit))
+	return r.find(ctx, filter, opts)
+}
+
+func (r *MongoRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	filter := inMongoTenant(ctx, bson.D{{Key: "owner", Value: owner}, {Key: "code", Value: bson.D{{Key: "$gt", Value: after}}}})
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "code", Value: 1}}).SetLimit(int64(limit)))
+}
+
+func (r *MongoRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	res, err := r.links.UpdateOne(ctx, byCode(ctx, code), bson.D{{Key: "$set", Value: bson.D{
+		{Key: "scan_status", Value: status},
+		{Key: "scanned_at", Value: time.Now().UTC()},
+	}}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	// Missing and null scanned_at sort first, as NULLS FIRST does.
+	filter := inMongoTenant(ctx, bson.D{
+		{Key: "scan_status", Value: bson.D{{Key: "$ne", Value: "flagged"}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "scanned_at", Value: nil}},
+			bson.D{{Key: "scanned_at", Value: bson.D{{Key: "$lt", Value: before}}}},
+		}},
+	})
+	return r.find(ctx, filter, options.Find().SetSort(bson.D{{Key: "scanned_at", Value: 1}}).SetLimit(int64(limit)))
+}
+
+func (r *MongoRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	stale := bson.A{bson.D{{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: expiredBefore}}}}}
+	if !disabledBefore.IsZero() {
+		stale = append(stale, bson.D{{Key: "active", Value: false}, {Key: "updated_at", Value: bson.D{{Key: "$lt", Value: disabledBefore}}}})
+	}
+	filter := inMongoTenant(ctx, bson.D{{Key: "$or", Value: stale}})
+
+	// DeleteMany has no limit, so a batch of IDs is picked first.
+	recs, err := r.find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil || len(recs) == 0 {
+		return 0, err
+	}
+	ids := make(bson.A, len(recs))
+	for i, rec := range recs {
+		ids[i] = rec.ID
+	}
+	res, err := r.links.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (r *MongoRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	cur, err := r.links.Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{{Key: "code", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var l struct {
+			Code string `bson:"code"`
+		}
+		if err := cur.Decode(&l); err != nil {
+			return err
+		}
+		if err := fn(l.Code); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
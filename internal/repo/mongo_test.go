@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestMapMongoError(t *testing.T) {
+	dup := func(msg string) error {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: msg}}}
+	}
+	other := errors.New("no reachable servers")
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no documents", mongo.ErrNoDocuments, ErrNotFound},
+		{"duplicate code", dup(`E11000 duplicate key error collection: shawty.links index: code dup key: { code: "abc123" }`), ErrDuplicateCode},
+		{"duplicate long URL", dup(`E11000 duplicate key error collection: shawty.links index: long_url dup key: { tenant: "", domain: "", long_url: "https://example.com/" }`), ErrDuplicateLongURL},
+		{"code value naming the other index", dup(`E11000 duplicate key error collection: shawty.links index: code dup key: { code: "index: long_url dup key" }`), ErrDuplicateCode},
+		{"other", other, other},
+	} {
+		if got := mapMongoError(tc.err); !errors.Is(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestMongoLink(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 123000000, time.UTC)
+	rec := model.URLRecord{
+		ID: "id-1", Code: "xyz789", LongUrl: "https://example.com/a", ShortUrl: "https://shawt.ly/xyz789",
+		CreatedAt: created, UpdatedAt: created, ScanStatus: "clean", ScannedAt: &created,
+		UTM: map[string]string{"utm_source": "mail"}, Owner: "alice", Active: true, ExpiresAt: &created,
+		Unique: true, MaxClicks: 3, ClickCount: 2, Tenant: "t1",
+	}
+	raw, err := bson.Marshal(toMongo(rec))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var l mongoLink
+	if err := bson.Unmarshal(raw, &l); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got := l.record(); !reflect.DeepEqual(got, rec) {
+		t.Errorf("round trip:\nwant %+v\ngot  %+v", rec, got)
+	}
+	if l.Dedup {
+		t.Error("expected unique links to be left out of the long_url index")
+	}
+}
+
+func TestNewMongoLink(t *testing.T) {
+	ctx := WithTenant(context.Background(), "t1")
+	l := newMongoLink(ctx, model.URLRecord{Code: "abc", ScanStatus: "flagged", ClickCount: 5})
+	if l.CreatedAt.IsZero() || !l.CreatedAt.Equal(l.CreatedAt.Truncate(time.Millisecond)) {
+		t.Errorf("expected created_at at millisecond precision, got %v", l.CreatedAt)
+	}
+	if l.Tenant != "t1" || !l.Active || l.ScanStatus != "unchecked" || l.ClickCount != 0 || !l.Dedup {
+		t.Errorf("expected a fresh active link in tenant t1, got %+v", l)
+	}
+}
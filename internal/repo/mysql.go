@@ -0,0 +1,212 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const MySQLDuplicateEntry uint16 = 1062
+
+// MySQLRepo implements URLRepo on MySQL/MariaDB. Uniqueness of long_url per
+// domain is enforced through the generated dedup_hash column, the long URL's
+// hash for all but unique links, since TEXT columns cannot carry a
+// full-length unique index.
+type MySQLRepo struct{ db *sql.DB }
+
+func NewMySQL(db *sql.DB) *MySQLRepo { return &MySQLRepo{db} }
+
+func (r *MySQLRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	const q = `SELECT ` + recordColumns + ` FROM url_records WHERE domain=? AND dedup_hash=SHA2(?, 256) AND tenant_id=?`
+
+	return scanRecord(r.db.QueryRowContext(ctx, q, domain, long, tenantID(ctx)))
+}
+
+func (r *MySQLRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	const q = `SELECT ` + recordColumns + ` FROM url_records WHERE code=? AND tenant_id = COALESCE(?, tenant_id)`
+	return scanRecord(r.db.QueryRowContext(ctx, q, code, tenantArg(ctx)))
+}
+
+func (r *MySQLRepo) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
+	const q = `
+		INSERT INTO url_records (id, code, long_url, short_url, utm_params, owner, domain, expires_at, title, description, org, original_url, dedup, max_clicks, tenant_id, fallback_url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP(6)), COALESCE(?, CURRENT_TIMESTAMP(6)))`
+
+	created := nullTime(rec.CreatedAt)
+	if _, err := r.db.ExecContext(ctx, q, rec.ID, rec.Code, rec.LongUrl, rec.ShortUrl, encodeParams(rec.UTM), rec.Owner, rec.Domain, rec.ExpiresAt, rec.Title, rec.Description, rec.Org, rec.OriginalURL, !rec.Unique, rec.MaxClicks, tenantID(ctx), rec.FallbackURL, created, created); err != nil {
+		return model.URLRecord{}, mapMySQLError(err)
+	}
+
+	// MySQL has no RETURNING clause, so read back the server-assigned created_at.
+	return r.GetByCode(ctx, rec.Code)
+}
+
+// Upsert inserts and, when the destination turns out to be taken, reads back
+// the link holding it: INSERT IGNORE and ON DUPLICATE KEY would swallow a
+// code collision too.
+func (r *MySQLRepo) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	const q = `
+		INSERT INTO url_records (id, code, long_url, short_url, utm_params, owner, domain, expires_at, title, description, org, scan_status, scanned_at, original_url, dedup, max_clicks, tenant_id, fallback_url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(NULLIF(?, ''), 'unchecked'), ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP(6)), COALESCE(?, CURRENT_TIMESTAMP(6)))`
+
+	created := nullTime(rec.CreatedAt)
+	_, err := r.db.ExecContext(ctx, q, rec.ID, rec.Code, rec.LongUrl, rec.ShortUrl, encodeParams(rec.UTM), rec.Owner, rec.Domain, rec.ExpiresAt, rec.Title, rec.Description, rec.Org, rec.ScanStatus, rec.ScannedAt, rec.OriginalURL, !rec.Unique, rec.MaxClicks, tenantID(ctx), rec.FallbackURL, created, created)
+	switch err = mapMySQLError(err); {
+	case errors.Is(err, ErrDuplicateLongURL):
+		out, err := r.GetByLong(ctx, rec.Domain, rec.LongUrl)
+		return out, false, err
+	case err != nil:
+		return model.URLRecord{}, false, err
+	}
+
+	out, err := r.GetByCode(ctx, rec.Code)
+	return out, err == nil, err
+}
+
+func (r *MySQLRepo) Update(ctx context.Context, rec model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	const q = `
+		UPDATE url_records
+		SET long_url=?, utm_params=?, scan_status=?, scanned_at=?, title=?, description=?, original_url=?, fallback_url=?, updated_at=CURRENT_TIMESTAMP(6)
+		WHERE code=? AND updated_at=? AND tenant_id = COALESCE(?, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, rec.LongUrl, encodeParams(rec.UTM), rec.ScanStatus, rec.ScannedAt, rec.Title, rec.Description, rec.OriginalURL, rec.FallbackURL, rec.Code, prev, tenantArg(ctx))
+	if err := affectedOne(res, mapMySQLError(err)); err != nil {
+		return model.URLRecord{}, err
+	}
+
+	return r.GetByCode(ctx, rec.Code)
+}
+
+func (r *MySQLRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	const q = `UPDATE url_records SET active=?, updated_at=CURRENT_TIMESTAMP(6) WHERE code=? AND tenant_id = COALESCE(?, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, active, code, tenantArg(ctx))
+	if err := affectedOne(res, err); err != nil {
+		return model.URLRecord{}, err
+	}
+
+	return r.GetByCode(ctx, code)
+}
+
+func (r *MySQLRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	// MySQL assigns left to right, each expression seeing the columns
+	// already set, so click_count is bumped last.
+	const q = `
+		UPDATE url_records
+		SET updated_at = IF(click_count + 1 < max_clicks, updated_at, CURRENT_TIMESTAMP(6)),
+		    active = click_count + 1 < max_clicks,
+		    click_count = click_count + 1
+		WHERE code=? AND active AND max_clicks > 0 AND click_count < max_clicks AND tenant_id = COALESCE(?, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, code, tenantArg(ctx))
+	if err := affectedOne(res, err); err != nil {
+		return model.URLRecord{}, err
+	}
+
+	return r.GetByCode(ctx, code)
+}
+
+func (r *MySQLRepo) Delete(ctx context.Context, code string) error {
+	const q = `DELETE FROM url_records WHERE code=? AND tenant_id = COALESCE(?, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, code, tenantArg(ctx))
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	// long_url is compared bytewise, so both sides are lower-cased. MySQL has
+	// no trigram index; the search scans the owner's links.
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE owner=? AND LOWER(long_url) LIKE ? AND tenant_id = COALESCE(?, tenant_id)
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?`
+
+	rows, err := r.db.QueryContext(ctx, q, owner, containsPattern(strings.ToLower(query)), tenantArg(ctx), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *MySQLRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE owner=? AND code > ? AND tenant_id = COALESCE(?, tenant_id)
+		ORDER BY code
+		LIMIT ?`
+
+	rows, err := r.db.QueryContext(ctx, q, owner, after, tenantArg(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *MySQLRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	const q = `UPDATE url_records SET scan_status=?, scanned_at=CURRENT_TIMESTAMP(6) WHERE code=? AND tenant_id = COALESCE(?, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, status, code, tenantArg(ctx))
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	// MySQL sorts NULLs first in ascending order.
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE scan_status <> 'flagged' AND (scanned_at IS NULL OR scanned_at < ?) AND tenant_id = COALESCE(?, tenant_id)
+		ORDER BY scanned_at
+		LIMIT ?`
+
+	rows, err := r.db.QueryContext(ctx, q, before, tenantArg(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *MySQLRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	const q = `DELETE FROM url_records WHERE (expires_at < ? OR (NOT active AND updated_at < ?)) AND tenant_id = COALESCE(?, tenant_id) LIMIT ?`
+
+	res, err := r.db.ExecContext(ctx, q, expiredBefore, nullTime(disabledBefore), tenantArg(ctx), limit)
+	return rowsAffected(res, err)
+}
+
+func (r *MySQLRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	return eachCode(ctx, r.db, fn)
+}
+
+// isMySQLDuplicate reports whether err is a duplicate-key error on any key.
+func isMySQLDuplicate(err error) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == MySQLDuplicateEntry
+}
+
+// mapMySQLError translates duplicate-key errors into the driver-agnostic repo errors.
+// The key name is reported as 'url_records.code' on MySQL 8 and 'code' on MariaDB.
+func mapMySQLError(err error) error {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) || myErr.Number != MySQLDuplicateEntry {
+		return err
+	}
+
+	// Only look at the key name; the duplicated value itself is user controlled.
+	key := myErr.Message
+	if i := strings.LastIndex(key, "for key "); i >= 0 {
+		key = key[i:]
+	}
+
+	switch {
+	case strings.Contains(key, "long_url"):
+		return ErrDuplicateLongURL
+	case strings.Contains(key, "code"):
+		return ErrDuplicateCode
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMapMySQLError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "MySQL 8 duplicate code",
+			err:      &mysql.MySQLError{Number: MySQLDuplicateEntry, Message: "Duplicate entry 'abc123' for key 'url_records.code'"},
+			expected: ErrDuplicateCode,
+		},
+		{
+			name:     "MariaDB duplicate code",
+			err:      &mysql.MySQLError{Number: MySQLDuplicateEntry, Message: "Duplicate entry 'abc123' for key 'code'"},
+			expected: ErrDuplicateCode,
+		},
+		{
+			name:     "Duplicate long URL hash",
+			err:      &mysql.MySQLError{Number: MySQLDuplicateEntry, Message: "Duplicate entry '9f86d08' for key 'url_records.long_url_hash'"},
+			expected: ErrDuplicateLongURL,
+		},
+		{
+			name:     "Code value containing long_url",
+			err:      &mysql.MySQLError{Number: MySQLDuplicateEntry, Message: "Duplicate entry 'long_url' for key 'code'"},
+			expected: ErrDuplicateCode,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := mapMySQLError(tc.err); !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestMapMySQLError_Passthrough(t *testing.T) {
+	other := &mysql.MySQLError{Number: 1146, Message: "Table 'urlshortener.url_records' doesn't exist"}
+	if err := mapMySQLError(other); err != other {
+		t.Errorf("Expected error to be returned unchanged, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/model"
+)
+
+// NegativeCache is a URLRepo that remembers which codes GetByCode did not
+// find, so repeated lookups of unknown codes, such as those of bots trying
+// random ones, are answered without a query. New links take their code out
+// of the cache again.
+type NegativeCache struct {
+	URLRepo
+	missing cache.Set
+
+	hits, misses atomic.Int64
+}
+
+// WithNegativeCache wraps r, remembering missing codes in missing.
+func WithNegativeCache(r URLRepo, missing cache.Set) *NegativeCache {
+	return &NegativeCache{URLRepo: r, missing: missing}
+}
+
+func (r *NegativeCache) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	if r.missing.Contains(ctx, code) {
+		r.hits.Add(1)
+		return model.URLRecord{}, ErrNotFound
+	}
+	r.misses.Add(1)
+
+	// Codes are unique across tenants, so the cache is shared by all of
+	// them: only a code no tenant has is remembered as missing.
+	rec, err := r.URLRepo.GetByCode(AllTenants(ctx), code)
+	if errors.Is(err, ErrNotFound) {
+		r.missing.Add(ctx, code)
+	}
+	if err == nil && !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+func (r *NegativeCache) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
+	out, err := r.URLRepo.Insert(ctx, rec)
+	if err == nil {
+		r.missing.Remove(ctx, out.Code)
+	}
+	return out, err
+}
+
+func (r *NegativeCache) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	out, created, err := r.URLRepo.Upsert(ctx, rec)
+	if err == nil {
+		r.missing.Remove(ctx, out.Code)
+	}
+	return out, created, err
+}
+
+// CacheStats returns how many lookups the cache has answered, and how many
+// it passed on.
+func (r *NegativeCache) CacheStats() (hits, misses int64) {
+	return r.hits.Load(), r.misses.Load()
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/model"
+)
+
+// countingRepo counts the GetByCode calls that reach the store.
+type countingRepo struct {
+	*MemoryRepo
+	lookups int
+}
+
+func (r *countingRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	r.lookups++
+	return r.MemoryRepo.GetByCode(ctx, code)
+}
+
+func TestNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{MemoryRepo: NewMemory()}
+	r := WithNegativeCache(inner, cache.NewMemorySet(100, time.Minute))
+
+	for range 3 {
+		if _, err := r.GetByCode(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if inner.lookups != 1 {
+		t.Errorf("expected 1 lookup to reach the store, got %d", inner.lookups)
+	}
+	if hits, misses := r.CacheStats(); hits != 2 || misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %d and %d", hits, misses)
+	}
+
+	if _, err := r.Insert(ctx, model.URLRecord{ID: "1", Code: "nope", LongUrl: "https://example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetByCode(ctx, "nope"); err != nil {
+		t.Errorf("expected a new link to be found at once, got %v", err)
+	}
+
+	// A code of another tenant is not found, but not remembered as missing.
+	acme := WithTenant(ctx, "acme")
+	if _, err := r.Insert(acme, model.URLRecord{ID: "2", Code: "AcMe", LongUrl: "https://acme.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetByCode(WithTenant(ctx, ""), "AcMe"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another tenant's code to be hidden, got %v", err)
+	}
+	if _, err := r.GetByCode(acme, "AcMe"); err != nil {
+		t.Errorf("expected the tenant to find its code, got %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// OrgRepo stores organizations, their members and the links they share.
+type OrgRepo interface {
+	// CreateOrg stores org with admin as its first member, an admin. A taken
+	// slug yields ErrDuplicateOrg.
+	CreateOrg(ctx context.Context, org model.Org, admin string) (model.Org, error)
+	GetOrg(ctx context.Context, slug string) (model.Org, error)
+	// ListOrgs returns the organizations owner belongs to, by slug.
+	ListOrgs(ctx context.Context, owner string) ([]model.Org, error)
+	// ListMembers returns org's members, admins first.
+	ListMembers(ctx context.Context, org string) ([]model.OrgMember, error)
+	// MemberRole returns owner's role in org, or ErrNotFound when owner is
+	// not a member.
+	MemberRole(ctx context.Context, org, owner string) (string, error)
+	// PutMember adds a member or changes their role.
+	PutMember(ctx context.Context, org string, m model.OrgMember) (model.OrgMember, error)
+	// DeleteMember removes a member; a missing one yields ErrNotFound.
+	DeleteMember(ctx context.Context, org, owner string) error
+	// ListByOrg returns org's links, newest first, skipping offset of them. A
+	// non-empty query keeps only links whose long URL contains it, ignoring
+	// case.
+	ListByOrg(ctx context.Context, org, query string, limit, offset int) ([]model.URLRecord, error)
+	// OrgStats totals org's links and the clicks they received.
+	OrgStats(ctx context.Context, org string, now time.Time) (model.Stats, error)
+}
+
+const memberOrder = `CASE role WHEN 'admin' THEN 0 ELSE 1 END, owner`
+
+func scanOrgs(rows *sql.Rows) ([]model.Org, error) {
+	defer rows.Close()
+
+	var orgs []model.Org
+	for rows.Next() {
+		var o model.Org
+		if err := rows.Scan(&o.Slug, &o.Name, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+func scanMembers(rows *sql.Rows) ([]model.OrgMember, error) {
+	defer rows.Close()
+
+	var members []model.OrgMember
+	for rows.Next() {
+		var m model.OrgMember
+		if err := rows.Scan(&m.Owner, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// createOrg runs the org and first member inserts in one transaction.
+func createOrg(ctx context.Context, db *sql.DB, insOrg, insMember string, org model.Org, admin string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, insOrg, org.Slug, org.Name); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, insMember, org.Slug, admin, model.RoleAdmin); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresRepo) CreateOrg(ctx context.Context, org model.Org, admin string) (model.Org, error) {
+	err := createOrg(ctx, r.db,
+		`INSERT INTO orgs (slug, name) VALUES ($1, $2)`,
+		`INSERT INTO org_members (org, owner, role) VALUES ($1, $2, $3)`,
+		org, admin)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == PgUniqueViolation {
+		return model.Org{}, ErrDuplicateOrg
+	}
+	if err != nil {
+		return model.Org{}, err
+	}
+	return r.GetOrg(ctx, org.Slug)
+}
+
+func (r *PostgresRepo) GetOrg(ctx context.Context, slug string) (model.Org, error) {
+	var o model.Org
+	err := r.db.QueryRowContext(ctx, `SELECT slug, name, created_at FROM orgs WHERE slug=$1`, slug).Scan(&o.Slug, &o.Name, &o.CreatedAt)
+	return o, err
+}
+
+func (r *PostgresRepo) ListOrgs(ctx context.Context, owner string) ([]model.Org, error) {
+	const q = `
+		SELECT o.slug, o.name, o.created_at FROM orgs o
+		JOIN org_members m ON m.org = o.slug
+		WHERE m.owner=$1
+		ORDER BY o.slug`
+
+	rows, err := r.db.QueryContext(ctx, q, owner)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrgs(rows)
+}
+
+func (r *PostgresRepo) ListMembers(ctx context.Context, org string) ([]model.OrgMember, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT owner, role, created_at FROM org_members WHERE org=$1 ORDER BY `+memberOrder, org)
+	if err != nil {
+		return nil, err
+	}
+	return scanMembers(rows)
+}
+
+func (r *PostgresRepo) MemberRole(ctx context.Context, org, owner string) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx, `SELECT role FROM org_members WHERE org=$1 AND owner=$2`, org, owner).Scan(&role)
+	return role, err
+}
+
+func (r *PostgresRepo) PutMember(ctx context.Context, org string, m model.OrgMember) (model.OrgMember, error) {
+	const q = `
+		INSERT INTO org_members (org, owner, role) VALUES ($1, $2, $3)
+		ON CONFLICT (org, owner) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at`
+
+	err := r.db.QueryRowContext(ctx, q, org, m.Owner, m.Role).Scan(&m.CreatedAt)
+	return m, err
+}
+
+func (r *PostgresRepo) DeleteMember(ctx context.Context, org, owner string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM org_members WHERE org=$1 AND owner=$2`, org, owner)
+	return affectedOne(res, err)
+}
+
+func (r *PostgresRepo) ListByOrg(ctx context.Context, org, query string, limit, offset int) ([]model.URLRecord, error) {
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE org=$1 AND long_url ILIKE $4 AND tenant_id = COALESCE($5, tenant_id)
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryContext(ctx, q, org, limit, offset, containsPattern(query), tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *PostgresRepo) OrgStats(ctx context.Context, org string, now time.Time) (model.Stats, error) {
+	return queryStats(ctx, r.db, fmt.Sprintf(statsQuery, "$1")+` WHERE org=$2 AND tenant_id = COALESCE($3, tenant_id)`,
+		`SELECT COUNT(*) FROM click_events e JOIN url_records u ON u.code = e.code WHERE u.org=$1 AND u.tenant_id = COALESCE($2, u.tenant_id)`, now, org, tenantArg(ctx))
+}
+
+func (r *MySQLRepo) CreateOrg(ctx context.Context, org model.Org, admin string) (model.Org, error) {
+	err := createOrg(ctx, r.db,
+		`INSERT INTO orgs (slug, name) VALUES (?, ?)`,
+		`INSERT INTO org_members (org, owner, role) VALUES (?, ?, ?)`,
+		org, admin)
+	if isMySQLDuplicate(err) {
+		return model.Org{}, ErrDuplicateOrg
+	}
+	if err != nil {
+		return model.Org{}, err
+	}
+	return r.GetOrg(ctx, org.Slug)
+}
+
+func (r *MySQLRepo) GetOrg(ctx context.Context, slug string) (model.Org, error) {
+	var o model.Org
+	err := r.db.QueryRowContext(ctx, `SELECT slug, name, created_at FROM orgs WHERE slug=?`, slug).Scan(&o.Slug, &o.Name, &o.CreatedAt)
+	return o, err
+}
+
+func (r *MySQLRepo) ListOrgs(ctx context.Context, owner string) ([]model.Org, error) {
+	const q = `
+		SELECT o.slug, o.name, o.created_at FROM orgs o
+		JOIN org_members m ON m.org = o.slug
+		WHERE m.owner=?
+		ORDER BY o.slug`
+
+	rows, err := r.db.QueryContext(ctx, q, owner)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrgs(rows)
+}
+
+func (r *MySQLRepo) ListMembers(ctx context.Context, org string) ([]model.OrgMember, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT owner, role, created_at FROM org_members WHERE org=? ORDER BY `+memberOrder, org)
+	if err != nil {
+		return nil, err
+	}
+	return scanMembers(rows)
+}
+
+func (r *MySQLRepo) MemberRole(ctx context.Context, org, owner string) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx, `SELECT role FROM org_members WHERE org=? AND owner=?`, org, owner).Scan(&role)
+	return role, err
+}
+
+func (r *MySQLRepo) PutMember(ctx context.Context, org string, m model.OrgMember) (model.OrgMember, error) {
+	const q = `INSERT INTO org_members (org, owner, role) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE role = VALUES(role)`
+
+	if _, err := r.db.ExecContext(ctx, q, org, m.Owner, m.Role); err != nil {
+		return model.OrgMember{}, err
+	}
+	err := r.db.QueryRowContext(ctx, `SELECT created_at FROM org_members WHERE org=? AND owner=?`, org, m.Owner).Scan(&m.CreatedAt)
+	return m, err
+}
+
+func (r *MySQLRepo) DeleteMember(ctx context.Context, org, owner string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM org_members WHERE org=? AND owner=?`, org, owner)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) ListByOrg(ctx context.Context, org, query string, limit, offset int) ([]model.URLRecord, error) {
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE org=? AND LOWER(long_url) LIKE ? AND tenant_id = COALESCE(?, tenant_id)
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?`
+
+	rows, err := r.db.QueryContext(ctx, q, org, containsPattern(strings.ToLower(query)), tenantArg(ctx), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *MySQLRepo) OrgStats(ctx context.Context, org string, now time.Time) (model.Stats, error) {
+	// The links query takes now first, so org and the tenant follow it.
+	return queryStats(ctx, r.db, fmt.Sprintf(statsQuery, "?")+` WHERE org=? AND tenant_id = COALESCE(?, tenant_id)`,
+		`SELECT COUNT(*) FROM click_events e JOIN url_records u ON u.code = e.code WHERE u.org=? AND u.tenant_id = COALESCE(?, u.tenant_id)`, now, org, tenantArg(ctx))
+}
+
+func (r *MemoryRepo) CreateOrg(ctx context.Context, org model.Org, admin string) (model.Org, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.orgs[org.Slug]; ok {
+		return model.Org{}, ErrDuplicateOrg
+	}
+	org.CreatedAt = time.Now().UTC()
+	r.orgs[org.Slug] = org
+	r.members[org.Slug] = map[string]model.OrgMember{admin: {Owner: admin, Role: model.RoleAdmin, CreatedAt: org.CreatedAt}}
+	return org, nil
+}
+
+func (r *MemoryRepo) GetOrg(ctx context.Context, slug string) (model.Org, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	o, ok := r.orgs[slug]
+	if !ok {
+		return model.Org{}, ErrNotFound
+	}
+	return o, nil
+}
+
+func (r *MemoryRepo) ListOrgs(ctx context.Context, owner string) ([]model.Org, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var orgs []model.Org
+	for slug, members := range r.members {
+		if _, ok := members[owner]; ok {
+			orgs = append(orgs, r.orgs[slug])
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Slug < orgs[j].Slug })
+	return orgs, nil
+}
+
+func (r *MemoryRepo) ListMembers(ctx context.Context, org string) ([]model.OrgMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var members []model.OrgMember
+	for _, m := range r.members[org] {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if ai, aj := members[i].Role == model.RoleAdmin, members[j].Role == model.RoleAdmin; ai != aj {
+			return ai
+		}
+		return members[i].Owner < members[j].Owner
+	})
+	return members, nil
+}
+
+func (r *MemoryRepo) MemberRole(ctx context.Context, org, owner string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.members[org][owner]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return m.Role, nil
+}
+
+func (r *MemoryRepo) PutMember(ctx context.Context, org string, m model.OrgMember) (model.OrgMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, ok := r.members[org]
+	if !ok {
+		// Mirrors the foreign key on org_members.org.
+		return model.OrgMember{}, ErrNotFound
+	}
+	if prev, ok := members[m.Owner]; ok {
+		m.CreatedAt = prev.CreatedAt
+	} else {
+		m.CreatedAt = time.Now().UTC()
+	}
+	members[m.Owner] = m
+	return m, nil
+}
+
+func (r *MemoryRepo) DeleteMember(ctx context.Context, org, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.members[org][owner]; !ok {
+		return ErrNotFound
+	}
+	delete(r.members[org], owner)
+	return nil
+}
+
+func (r *MemoryRepo) ListByOrg(ctx context.Context, org, query string, limit, offset int) ([]model.URLRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var recs []model.URLRecord
+	for _, rec := range r.byCode {
+		if rec.Org == org && inTenant(ctx, rec) && strings.Contains(strings.ToLower(rec.LongUrl), query) {
+			recs = append(recs, rec)
+		}
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (r *MemoryRepo) OrgStats(ctx context.Context, org string, now time.Time) (model.Stats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.stats(now, func(rec model.URLRecord) bool { return rec.Org == org && inTenant(ctx, rec) }), nil
+}
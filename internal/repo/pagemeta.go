@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// PageMetaRepo keeps the metadata fetched from each link's destination page.
+type PageMetaRepo interface {
+	// SavePageMeta records m, replacing the earlier metadata of its code.
+	SavePageMeta(ctx context.Context, m model.PageMeta) error
+	// GetPageMetas returns the metadata of those of codes that have some.
+	GetPageMetas(ctx context.Context, codes []string) (map[string]model.PageMeta, error)
+}
+
+const pageMetaColumns = `code, title, description, site_name, image, favicon, fetched_at`
+
+func scanPageMetas(rows *sql.Rows, err error) (map[string]model.PageMeta, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metas := make(map[string]model.PageMeta)
+	for rows.Next() {
+		var m model.PageMeta
+		if err := rows.Scan(&m.Code, &m.Title, &m.Description, &m.SiteName, &m.Image, &m.Favicon, &m.FetchedAt); err != nil {
+			return nil, err
+		}
+		metas[m.Code] = m
+	}
+	return metas, rows.Err()
+}
+
+func (r *PostgresRepo) SavePageMeta(ctx context.Context, m model.PageMeta) error {
+	const q = `
+		INSERT INTO link_page_meta (` + pageMetaColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (code) DO UPDATE SET
+			title = EXCLUDED.title, description = EXCLUDED.description, site_name = EXCLUDED.site_name,
+			image = EXCLUDED.image, favicon = EXCLUDED.favicon, fetched_at = EXCLUDED.fetched_at`
+
+	_, err := r.db.ExecContext(ctx, q, m.Code, m.Title, m.Description, m.SiteName, m.Image, m.Favicon, m.FetchedAt)
+	return err
+}
+
+func (r *PostgresRepo) GetPageMetas(ctx context.Context, codes []string) (map[string]model.PageMeta, error) {
+	if len(codes) == 0 {
+		return map[string]model.PageMeta{}, nil
+	}
+	return scanPageMetas(r.db.QueryContext(ctx, `SELECT `+pageMetaColumns+` FROM link_page_meta WHERE code = ANY($1)`, codes))
+}
+
+func (r *MySQLRepo) SavePageMeta(ctx context.Context, m model.PageMeta) error {
+	const q = `
+		INSERT INTO link_page_meta (` + pageMetaColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			title = VALUES(title), description = VALUES(description), site_name = VALUES(site_name),
+			image = VALUES(image), favicon = VALUES(favicon), fetched_at = VALUES(fetched_at)`
+
+	_, err := r.db.ExecContext(ctx, q, m.Code, m.Title, m.Description, m.SiteName, m.Image, m.Favicon, m.FetchedAt)
+	return err
+}
+
+func (r *MySQLRepo) GetPageMetas(ctx context.Context, codes []string) (map[string]model.PageMeta, error) {
+	if len(codes) == 0 {
+		return map[string]model.PageMeta{}, nil
+	}
+	q := `SELECT ` + pageMetaColumns + ` FROM link_page_meta WHERE code IN (?` + strings.Repeat(", ?", len(codes)-1) + `)`
+
+	args := make([]any, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+	return scanPageMetas(r.db.QueryContext(ctx, q, args...))
+}
+
+func (r *MemoryRepo) SavePageMeta(ctx context.Context, m model.PageMeta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pageMeta[m.Code] = m
+	return nil
+}
+
+func (r *MemoryRepo) GetPageMetas(ctx context.Context, codes []string) (map[string]model.PageMeta, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	metas := make(map[string]model.PageMeta, len(codes))
+	for _, code := range codes {
+		if m, ok := r.pageMeta[code]; ok {
+			metas[code] = m
+		}
+	}
+	return metas, nil
+}
@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func testPageMeta(t *testing.T, r PageMetaRepo) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, m := range []model.PageMeta{
+		{Code: "abc", Title: "Old", FetchedAt: now.Add(-time.Hour)},
+		{Code: "abc", Title: "Docs", Description: "All the docs", Favicon: "https://example.com/favicon.ico", FetchedAt: now},
+		{Code: "def", Image: "https://example.com/card.png", FetchedAt: now},
+	} {
+		if err := r.SavePageMeta(ctx, m); err != nil {
+			t.Fatalf("SavePageMeta: %v", err)
+		}
+	}
+
+	got, err := r.GetPageMetas(ctx, []string{"abc", "def", "nope"})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetPageMetas: expected abc and def, got %+v (%v)", got, err)
+	}
+	if m := got["abc"]; m.Title != "Docs" || m.Description != "All the docs" || m.Favicon != "https://example.com/favicon.ico" || !m.FetchedAt.Equal(now) {
+		t.Errorf("expected abc's latest metadata, got %+v", m)
+	}
+	if got, err := r.GetPageMetas(ctx, nil); err != nil || len(got) != 0 {
+		t.Errorf("GetPageMetas: expected nothing for no codes, got %+v (%v)", got, err)
+	}
+}
+
+func TestMemoryRepo_PageMeta(t *testing.T) {
+	testPageMeta(t, NewMemory())
+}
+
+func TestPostgresRepo_PageMeta(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+	testDB.Exec("DELETE FROM link_page_meta")
+	testPageMeta(t, NewPostgres(testDB))
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// QuotaRepo counts per-owner usage for quotas.
+type QuotaRepo interface {
+	// AddUsage adds one to owner's metric counter for the period starting at
+	// period, unless the counter has reached limit. It reports whether the
+	// usage was counted.
+	AddUsage(ctx context.Context, owner, metric string, period time.Time, limit int) (bool, error)
+	// CountLinks returns how many links owner has.
+	CountLinks(ctx context.Context, owner string) (int, error)
+	// DeleteUsage forgets counters for periods before before and returns how
+	// many.
+	DeleteUsage(ctx context.Context, before time.Time) (int, error)
+}
+
+func (r *PostgresRepo) AddUsage(ctx context.Context, owner, metric string, period time.Time, limit int) (bool, error) {
+	const q = `
+		INSERT INTO usage_counters (owner, metric, period, count) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (owner, metric, period) DO UPDATE SET count = usage_counters.count + 1
+		WHERE usage_counters.count < $4`
+
+	n, err := rowsAffected(r.db.ExecContext(ctx, q, owner, metric, period, limit))
+	return n == 1, err
+}
+
+func (r *PostgresRepo) CountLinks(ctx context.Context, owner string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM url_records WHERE owner=$1`, owner).Scan(&n)
+	return n, err
+}
+
+func (r *PostgresRepo) DeleteUsage(ctx context.Context, before time.Time) (int, error) {
+	return rowsAffected(r.db.ExecContext(ctx, `DELETE FROM usage_counters WHERE period < $1`, before))
+}
+
+func (r *MySQLRepo) AddUsage(ctx context.Context, owner, metric string, period time.Time, limit int) (bool, error) {
+	// ON DUPLICATE KEY UPDATE cannot tell an unchanged row from an insert
+	// under clientFoundRows, so the counter is bumped first and only created
+	// when missing. A concurrent insert sends the caller back to the update.
+	const upd = `UPDATE usage_counters SET count = count + 1 WHERE owner=? AND metric=? AND period=? AND count < ?`
+	const ins = `INSERT IGNORE INTO usage_counters (owner, metric, period, count) VALUES (?, ?, ?, 1)`
+
+	if n, err := rowsAffected(r.db.ExecContext(ctx, upd, owner, metric, period, limit)); err != nil || n == 1 {
+		return n == 1, err
+	}
+	if n, err := rowsAffected(r.db.ExecContext(ctx, ins, owner, metric, period)); err != nil || n == 1 {
+		return n == 1, err
+	}
+	n, err := rowsAffected(r.db.ExecContext(ctx, upd, owner, metric, period, limit))
+	return n == 1, err
+}
+
+func (r *MySQLRepo) CountLinks(ctx context.Context, owner string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM url_records WHERE owner=?`, owner).Scan(&n)
+	return n, err
+}
+
+func (r *MySQLRepo) DeleteUsage(ctx context.Context, before time.Time) (int, error) {
+	return rowsAffected(r.db.ExecContext(ctx, `DELETE FROM usage_counters WHERE period < ?`, before))
+}
+
+// usageKey identifies a counter in MemoryRepo.usage.
+type usageKey struct {
+	owner, metric string
+	period        time.Time
+}
+
+func (r *MemoryRepo) AddUsage(ctx context.Context, owner, metric string, period time.Time, limit int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := usageKey{owner, metric, period.UTC()}
+	if r.usage[k] >= limit {
+		return false, nil
+	}
+	r.usage[k]++
+	return true, nil
+}
+
+func (r *MemoryRepo) CountLinks(ctx context.Context, owner string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int
+	for _, rec := range r.byCode {
+		if rec.Owner == owner {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryRepo) DeleteUsage(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for k := range r.usage {
+		if k.period.Before(before) {
+			delete(r.usage, k)
+			n++
+		}
+	}
+	return n, nil
+}
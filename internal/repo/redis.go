@@ -0,0 +1,532 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisBatch is how many keys RedisRepo reads per round trip when walking
+// the links.
+const redisBatch = 100
+
+// RedisRepo is a URLRepo kept entirely in Redis, for deployments where
+// latency matters more than durability, such as links for an event that
+// may be lost afterwards. Each link is a hash at <prefix>link:<code>; a
+// string at <prefix>long:<hash of tenant, domain and long URL> names the
+// code of the link found by that destination, and a sorted set at
+// <prefix>owner:<owner> holds an owner's codes. Writes are Lua scripts, so
+// uniqueness checks and the writes they guard happen at once; as scripts
+// touch several keys, the server must not be a cluster. Whether links
+// survive a restart is the server's persistence settings' business.
+type RedisRepo struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis returns a repo keeping links in client under keys starting with
+// prefix.
+func NewRedis(client *redis.Client, prefix string) *RedisRepo {
+	return &RedisRepo{client: client, prefix: prefix}
+}
+
+func (r *RedisRepo) linkKey(code string) string { return r.prefix + "link:" + code }
+
+func (r *RedisRepo) longKey(tenant, domain, long string) string {
+	sum := sha256.Sum256([]byte(longKey(tenant, domain, long)))
+	return r.prefix + "long:" + hex.EncodeToString(sum[:])
+}
+
+func (r *RedisRepo) ownerKey(owner string) string { return r.prefix + "owner:" + owner }
+
+// redisInsert stores the link in ARGV[4:] unless its code, or when ARGV[1]
+// is set its destination, is taken, returning "code" or "long" with the code
+// holding the destination in those cases.
+var redisInsert = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return {'code', ''} end
+if ARGV[1] == '1' then
+	local code = redis.call('GET', KEYS[2])
+	if code then return {'long', code} end
+	redis.call('SET', KEYS[2], ARGV[2])
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+if ARGV[3] ~= '' then redis.call('ZADD', KEYS[3], 0, ARGV[2]) end
+return {'ok', ''}
+`)
+
+// redisUpdate sets the fields in ARGV[4:] if updated_at is still ARGV[1],
+// moving the destination claim from KEYS[3] to KEYS[2] when ARGV[2] is set.
+var redisUpdate = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'updated_at') ~= ARGV[1] then return 'missing' end
+if ARGV[2] == '1' and KEYS[2] ~= KEYS[3] then
+	local code = redis.call('GET', KEYS[2])
+	if code and code ~= ARGV[3] then return 'long' end
+	if redis.call('GET', KEYS[3]) == ARGV[3] then redis.call('DEL', KEYS[3]) end
+	redis.call('SET', KEYS[2], ARGV[3])
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+return 'ok'
+`)
+
+// redisSet sets the fields in ARGV of an existing link.
+var redisSet = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// redisTakeClick counts a click of an active link with clicks left in
+// tenant ARGV[3] (any tenant unless ARGV[2] is set), disabling it at
+// ARGV[1] on its last one.
+var redisTakeClick = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 'active', 'max_clicks', 'click_count', 'tenant')
+if v[1] ~= '1' or (ARGV[2] == '1' and v[4] ~= ARGV[3]) then return 0 end
+local max, n = tonumber(v[2]), tonumber(v[3]) + 1
+if max <= 0 or n > max then return 0 end
+redis.call('HSET', KEYS[1], 'click_count', n)
+if n >= max then redis.call('HSET', KEYS[1], 'active', '0', 'updated_at', ARGV[1]) end
+return 1
+`)
+
+// redisDelete removes link ARGV[1] with its destination claim and owner
+// index entry.
+var redisDelete = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 0 then return 0 end
+if redis.call('GET', KEYS[2]) == ARGV[1] then redis.call('DEL', KEYS[2]) end
+redis.call('ZREM', KEYS[3], ARGV[1])
+return 1
+`)
+
+func redisTime(t time.Time) string { return strconv.FormatInt(t.UnixNano(), 10) }
+
+func redisTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return redisTime(*t)
+}
+
+func redisBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// redisFields flattens rec into the field, value pairs of its hash.
+func redisFields(rec model.URLRecord) []any {
+	return []any{
+		"id", rec.ID,
+		"code", rec.Code,
+		"long_url", rec.LongUrl,
+		"short_url", rec.ShortUrl,
+		"created_at", redisTime(rec.CreatedAt),
+		"updated_at", redisTime(rec.UpdatedAt),
+		"scan_status", rec.ScanStatus,
+		"scanned_at", redisTimePtr(rec.ScannedAt),
+		"utm", encodeParams(rec.UTM),
+		"owner", rec.Owner,
+		"active", redisBool(rec.Active),
+		"domain", rec.Domain,
+		"expires_at", redisTimePtr(rec.ExpiresAt),
+		"title", rec.Title,
+		"description", rec.Description,
+		"org", rec.Org,
+		"original_url", rec.OriginalURL,
+		"unique", redisBool(rec.Unique),
+		"max_clicks", rec.MaxClicks,
+		"click_count", rec.ClickCount,
+		"fallback_url", rec.FallbackURL,
+		"tenant", rec.Tenant,
+	}
+}
+
+func parseRedisTime(s string) *time.Time {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if s == "" || err != nil {
+		return nil
+	}
+	t := time.Unix(0, n).UTC()
+	return &t
+}
+
+// decodeRedis reads a link's hash, which is empty for a missing link.
+func decodeRedis(h map[string]string) (model.URLRecord, error) {
+	if len(h) == 0 {
+		return model.URLRecord{}, ErrNotFound
+	}
+	rec := model.URLRecord{
+		ID:          h["id"],
+		Code:        h["code"],
+		LongUrl:     h["long_url"],
+		ShortUrl:    h["short_url"],
+		ScanStatus:  h["scan_status"],
+		ScannedAt:   parseRedisTime(h["scanned_at"]),
+		UTM:         decodeParams(h["utm"]),
+		Owner:       h["owner"],
+		Active:      h["active"] == "1",
+		Domain:      h["domain"],
+		ExpiresAt:   parseRedisTime(h["expires_at"]),
+		Title:       h["title"],
+		Description: h["description"],
+		Org:         h["org"],
+		OriginalURL: h["original_url"],
+		Unique:      h["unique"] == "1",
+		FallbackURL: h["fallback_url"],
+		Tenant:      h["tenant"],
+	}
+	if t := parseRedisTime(h["created_at"]); t != nil {
+		rec.CreatedAt = *t
+	}
+	if t := parseRedisTime(h["updated_at"]); t != nil {
+		rec.UpdatedAt = *t
+	}
+	rec.MaxClicks, _ = strconv.Atoi(h["max_clicks"])
+	rec.ClickCount, _ = strconv.ParseInt(h["click_count"], 10, 64)
+	return rec, nil
+}
+
+func (r *RedisRepo) get(ctx context.Context, code string) (model.URLRecord, error) {
+	h, err := r.client.HGetAll(ctx, r.linkKey(code)).Result()
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	return decodeRedis(h)
+}
+
+// getMany reads the links of codes visible to ctx in one round trip,
+// skipping missing ones.
+func (r *RedisRepo) getMany(ctx context.Context, codes []string) ([]model.URLRecord, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.HGetAll(ctx, r.linkKey(code))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	var recs []model.URLRecord
+	for _, cmd := range cmds {
+		rec, err := decodeRedis(cmd.Val())
+		if err == nil && inTenant(ctx, rec) {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+func (r *RedisRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	rec, err := r.get(ctx, code)
+	if err == nil && !inTenant(ctx, rec) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, err
+}
+
+func (r *RedisRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	code, err := r.client.Get(ctx, r.longKey(tenantID(ctx), domain, long)).Result()
+	if errors.Is(err, redis.Nil) {
+		return model.URLRecord{}, ErrNotFound
+	}
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	return r.GetByCode(ctx, code)
+}
+
+// create stores rec, returning the code holding its destination along with
+// ErrDuplicateLongURL.
+func (r *RedisRepo) create(ctx context.Context, rec model.URLRecord) (string, error) {
+	keys := []string{r.linkKey(rec.Code), r.longKey(rec.Tenant, rec.Domain, rec.LongUrl), r.ownerKey(rec.Owner)}
+	args := append([]any{redisBool(!rec.Unique), rec.Code, rec.Owner}, redisFields(rec)...)
+	res, err := redisInsert.Run(ctx, r.client, keys, args...).StringSlice()
+	if err != nil {
+		return "", err
+	}
+	switch res[0] {
+	case "code":
+		return "", ErrDuplicateCode
+	case "long":
+		return res[1], ErrDuplicateLongURL
+	}
+	return "", nil
+}
+
+// newRedisRecord fills in what Insert leaves to the database.
+func newRedisRecord(ctx context.Context, in model.URLRecord) model.URLRecord {
+	now := time.Now().UTC()
+	if !in.CreatedAt.IsZero() {
+		now = in.CreatedAt.UTC()
+	}
+	rec := in
+	rec.CreatedAt, rec.UpdatedAt = now, now
+	rec.ScanStatus = "unchecked"
+	rec.ScannedAt = nil
+	rec.UTM = decodeParams(encodeParams(in.UTM))
+	rec.Active = true
+	rec.ClickCount = 0
+	rec.Tenant = tenantID(ctx)
+	return rec
+}
+
+func (r *RedisRepo) Insert(ctx context.Context, in model.URLRecord) (model.URLRecord, error) {
+	rec := newRedisRecord(ctx, in)
+	if _, err := r.create(ctx, rec); err != nil {
+		return model.URLRecord{}, err
+	}
+	return rec, nil
+}
+
+func (r *RedisRepo) Upsert(ctx context.Context, in model.URLRecord) (model.URLRecord, bool, error) {
+	rec := newRedisRecord(ctx, in)
+	if in.ScanStatus != "" {
+		rec.ScanStatus = in.ScanStatus
+		rec.ScannedAt = utcPtr(in.ScannedAt)
+	}
+	code, err := r.create(ctx, rec)
+	if errors.Is(err, ErrDuplicateLongURL) {
+		rec, err := r.GetByCode(ctx, code)
+		return rec, false, err
+	}
+	if err != nil {
+		return model.URLRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (r *RedisRepo) Update(ctx context.Context, in model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	rec, err := r.GetByCode(ctx, in.Code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	oldLong := rec.LongUrl
+	rec.LongUrl = in.LongUrl
+	rec.UTM = decodeParams(encodeParams(in.UTM))
+	rec.ScanStatus = in.ScanStatus
+	rec.ScannedAt = utcPtr(in.ScannedAt)
+	rec.Title = in.Title
+	rec.Description = in.Description
+	rec.OriginalURL = in.OriginalURL
+	rec.FallbackURL = in.FallbackURL
+	rec.UpdatedAt = time.Now().UTC()
+
+	keys := []string{r.linkKey(rec.Code), r.longKey(rec.Tenant, rec.Domain, rec.LongUrl), r.longKey(rec.Tenant, rec.Domain, oldLong)}
+	args := append([]any{redisTime(prev), redisBool(!rec.Unique), rec.Code}, redisFields(rec)...)
+	res, err := redisUpdate.Run(ctx, r.client, keys, args...).Text()
+	switch {
+	case err != nil:
+		return model.URLRecord{}, err
+	case res == "missing":
+		return model.URLRecord{}, ErrNotFound
+	case res == "long":
+		return model.URLRecord{}, ErrDuplicateLongURL
+	}
+	return rec, nil
+}
+
+// set sets fields of the link with code, which must be visible to ctx.
+func (r *RedisRepo) set(ctx context.Context, code string, fields ...any) error {
+	if _, err := r.GetByCode(ctx, code); err != nil {
+		return err
+	}
+	ok, err := redisSet.Run(ctx, r.client, []string{r.linkKey(code)}, fields...).Bool()
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (r *RedisRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	if err := r.set(ctx, code, "active", redisBool(active), "updated_at", redisTime(time.Now().UTC())); err != nil {
+		return model.URLRecord{}, err
+	}
+	return r.GetByCode(ctx, code)
+}
+
+func (r *RedisRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	tenant, scoped := TenantOf(ctx)
+	ok, err := redisTakeClick.Run(ctx, r.client, []string{r.linkKey(code)}, redisTime(time.Now().UTC()), redisBool(scoped), tenant).Bool()
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if !ok {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return r.get(ctx, code)
+}
+
+func (r *RedisRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	return r.set(ctx, code, "scan_status", status, "scanned_at", redisTime(time.Now().UTC()))
+}
+
+func (r *RedisRepo) Delete(ctx context.Context, code string) error {
+	rec, err := r.GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	return r.delete(ctx, rec)
+}
+
+func (r *RedisRepo) delete(ctx context.Context, rec model.URLRecord) error {
+	keys := []string{r.linkKey(rec.Code), r.longKey(rec.Tenant, rec.Domain, rec.LongUrl), r.ownerKey(rec.Owner)}
+	ok, err := redisDelete.Run(ctx, r.client, keys, rec.Code).Bool()
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (r *RedisRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	codes, err := r.client.ZRange(ctx, r.ownerKey(owner), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(query)
+	var recs []model.URLRecord
+	for batch := range slices.Chunk(codes, redisBatch) {
+		got, err := r.getMany(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range got {
+			if strings.Contains(strings.ToLower(rec.LongUrl), query) {
+				recs = append(recs, rec)
+			}
+		}
+	}
+	return page(recs, limit, offset), nil
+}
+
+func (r *RedisRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	for len(recs) < limit {
+		// Codes sort by their bytes, as all members share one score.
+		from := "-"
+		if after != "" {
+			from = "(" + after
+		}
+		codes, err := r.client.ZRangeByLex(ctx, r.ownerKey(owner), &redis.ZRangeBy{Min: from, Max: "+", Count: int64(limit)}).Result()
+		if err != nil {
+			return nil, err
+		}
+		got, err := r.getMany(ctx, codes)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, got...)
+		if len(codes) < limit {
+			break
+		}
+		after = codes[len(codes)-1]
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+// each calls fn with batches of the codes of every link until fn returns an
+// error.
+func (r *RedisRepo) each(ctx context.Context, fn func(codes []string) error) error {
+	iter := r.client.Scan(ctx, 0, r.linkKey("*"), redisBatch).Iterator()
+	codes := make([]string, 0, redisBatch)
+	for iter.Next(ctx) {
+		codes = append(codes, strings.TrimPrefix(iter.Val(), r.linkKey("")))
+		if len(codes) == redisBatch {
+			if err := fn(codes); err != nil {
+				return err
+			}
+			codes = codes[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(codes) > 0 {
+		return fn(codes)
+	}
+	return nil
+}
+
+// scan collects the links visible to ctx that keep accepts.
+func (r *RedisRepo) scan(ctx context.Context, keep func(model.URLRecord) bool) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	err := r.each(ctx, func(codes []string) error {
+		got, err := r.getMany(ctx, codes)
+		for _, rec := range got {
+			if keep(rec) {
+				recs = append(recs, rec)
+			}
+		}
+		return err
+	})
+	return recs, err
+}
+
+func (r *RedisRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	recs, err := r.scan(ctx, func(rec model.URLRecord) bool {
+		return rec.ScanStatus != "flagged" && (rec.ScannedAt == nil || rec.ScannedAt.Before(before))
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		a, b := recs[i].ScannedAt, recs[j].ScannedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+func (r *RedisRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	stale, err := r.scan(ctx, func(rec model.URLRecord) bool {
+		expired := rec.ExpiresAt != nil && rec.ExpiresAt.Before(expiredBefore)
+		disabled := !disabledBefore.IsZero() && !rec.Active && rec.UpdatedAt.Before(disabledBefore)
+		return expired || disabled
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, rec := range stale[:min(limit, len(stale))] {
+		err := r.delete(ctx, rec)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *RedisRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	return r.each(ctx, func(codes []string) error {
+		for _, code := range codes {
+			if err := fn(code); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
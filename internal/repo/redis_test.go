@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *RedisRepo {
+	mr := miniredis.RunT(t)
+	return NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "test:")
+}
+
+func TestRedisRepo(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRedis(t)
+
+	expires := time.Now().Add(time.Hour).UTC()
+	rec, err := r.Insert(ctx, model.URLRecord{
+		ID: "id-1", Code: "abc", LongUrl: "https://example.com/a", Owner: "alice",
+		UTM: map[string]string{"utm_source": "mail"}, ExpiresAt: &expires, MaxClicks: 2,
+	})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	got, err := r.GetByCode(ctx, "abc")
+	if err != nil || !reflect.DeepEqual(got, rec) {
+		t.Fatalf("GetByCode:\nwant %+v\ngot  %+v (%v)", rec, got, err)
+	}
+	if got, err := r.GetByLong(ctx, "", "https://example.com/a"); err != nil || got.Code != "abc" {
+		t.Errorf("GetByLong: expected abc, got %q (%v)", got.Code, err)
+	}
+
+	if _, err := r.Insert(ctx, model.URLRecord{Code: "abc", LongUrl: "https://example.com/b"}); !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("expected ErrDuplicateCode, got %v", err)
+	}
+	if _, err := r.Insert(ctx, model.URLRecord{Code: "def", LongUrl: "https://example.com/a"}); !errors.Is(err, ErrDuplicateLongURL) {
+		t.Errorf("expected ErrDuplicateLongURL, got %v", err)
+	}
+	if got, created, err := r.Upsert(ctx, model.URLRecord{Code: "def", LongUrl: "https://example.com/a"}); err != nil || created || got.Code != "abc" {
+		t.Errorf("Upsert: expected the existing link, got %q, %v (%v)", got.Code, created, err)
+	}
+	if _, err := r.GetByCode(WithTenant(ctx, "t1"), "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected other tenants not to see the link, got %v", err)
+	}
+
+	rec.LongUrl = "https://example.com/moved"
+	updated, err := r.Update(ctx, rec, rec.UpdatedAt)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := r.Update(ctx, rec, rec.UpdatedAt); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a stale updated_at to fail, got %v", err)
+	}
+	if _, err := r.GetByLong(ctx, "", "https://example.com/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the old destination freed, got %v", err)
+	}
+	if got, _ := r.GetByLong(ctx, "", rec.LongUrl); got.Code != "abc" || !got.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("expected the link under its new destination, got %+v", got)
+	}
+
+	for i, wantActive := range []bool{true, false} {
+		got, err := r.TakeClick(ctx, "abc")
+		if err != nil || got.ClickCount != int64(i+1) || got.Active != wantActive {
+			t.Errorf("TakeClick %d: got count %d, active %v (%v)", i+1, got.ClickCount, got.Active, err)
+		}
+	}
+	if _, err := r.TakeClick(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no clicks left, got %v", err)
+	}
+
+	if err := r.UpdateScanStatus(ctx, "abc", "clean"); err != nil {
+		t.Fatalf("UpdateScanStatus: %v", err)
+	}
+	if got, _ := r.GetByCode(ctx, "abc"); got.ScanStatus != "clean" || got.ScannedAt == nil {
+		t.Errorf("expected the scan recorded, got %+v", got)
+	}
+
+	if err := r.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := r.Delete(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+	if recs, _ := r.ListAfter(ctx, "alice", "", 10); len(recs) != 0 {
+		t.Errorf("expected the owner index emptied, got %d links", len(recs))
+	}
+}
+
+func TestRedisRepo_Listings(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRedis(t)
+	for _, code := range []string{"c", "a", "d", "b"} {
+		if _, err := r.Insert(ctx, model.URLRecord{Code: code, LongUrl: "https://example.com/" + code, Owner: "alice"}); err != nil {
+			t.Fatalf("Insert %s: %v", code, err)
+		}
+	}
+	r.Insert(WithTenant(ctx, "t1"), model.URLRecord{Code: "aa", LongUrl: "https://example.com/aa", Owner: "alice"})
+
+	var codes []string
+	for after := ""; ; {
+		recs, err := r.ListAfter(WithTenant(ctx, ""), "alice", after, 2)
+		if err != nil {
+			t.Fatalf("ListAfter: %v", err)
+		}
+		for _, rec := range recs {
+			codes = append(codes, rec.Code)
+		}
+		if len(recs) < 2 {
+			break
+		}
+		after = recs[len(recs)-1].Code
+	}
+	if !reflect.DeepEqual(codes, []string{"a", "b", "c", "d"}) {
+		t.Errorf("ListAfter: expected a to d in order without t1's link, got %v", codes)
+	}
+
+	if recs, err := r.ListByOwner(ctx, "alice", "EXAMPLE.com/b", 10, 0); err != nil || len(recs) != 1 {
+		t.Errorf("ListByOwner: expected 1 match, got %d (%v)", len(recs), err)
+	}
+
+	var n int
+	if err := r.EachCode(ctx, func(string) error { n++; return nil }); err != nil || n != 5 {
+		t.Errorf("EachCode: expected every tenant's 5 codes, got %d (%v)", n, err)
+	}
+	if recs, err := r.ListForScan(ctx, time.Now(), 3); err != nil || len(recs) != 3 {
+		t.Errorf("ListForScan: expected 3 links, got %d (%v)", len(recs), err)
+	}
+
+	r.SetActive(ctx, "a", false)
+	if n, err := r.DeleteStale(ctx, time.Now(), time.Now().Add(time.Minute), 10); err != nil || n != 1 {
+		t.Errorf("DeleteStale: expected the disabled link deleted, got %d (%v)", n, err)
+	}
+}
@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// ReportRepo keeps the abuse report review queue.
+type ReportRepo interface {
+	// InsertReport queues a pending report and returns it with its ID.
+	InsertReport(ctx context.Context, r model.AbuseReport) (model.AbuseReport, error)
+	// GetReport returns a report or ErrNotFound.
+	GetReport(ctx context.Context, id int64) (model.AbuseReport, error)
+	// ListReports returns the reports in status, or all of them when status
+	// is empty, oldest first.
+	ListReports(ctx context.Context, status string, limit, offset int) ([]model.AbuseReport, error)
+	// ReviewReport moves a pending report to status on behalf of by; one
+	// that is missing or reviewed already yields ErrNotFound.
+	ReviewReport(ctx context.Context, id int64, status, by string) (model.AbuseReport, error)
+}
+
+const reportColumns = `id, code, reason, details, contact, status, created_at, reviewed_by, reviewed_at`
+
+func scanReport(row rowScanner) (model.AbuseReport, error) {
+	var r model.AbuseReport
+	var reviewedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.Code, &r.Reason, &r.Details, &r.Contact, &r.Status, &r.CreatedAt, &r.ReviewedBy, &reviewedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.AbuseReport{}, ErrNotFound
+	}
+	if reviewedAt.Valid {
+		r.ReviewedAt = &reviewedAt.Time
+	}
+	return r, err
+}
+
+func scanReports(rows *sql.Rows) ([]model.AbuseReport, error) {
+	defer rows.Close()
+
+	var reports []model.AbuseReport
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+func (r *PostgresRepo) InsertReport(ctx context.Context, rep model.AbuseReport) (model.AbuseReport, error) {
+	const q = `
+		INSERT INTO abuse_reports (code, reason, details, contact) VALUES ($1, $2, $3, $4)
+		RETURNING ` + reportColumns
+
+	return scanReport(r.db.QueryRowContext(ctx, q, rep.Code, rep.Reason, rep.Details, rep.Contact))
+}
+
+func (r *PostgresRepo) GetReport(ctx context.Context, id int64) (model.AbuseReport, error) {
+	return scanReport(r.db.QueryRowContext(ctx, `SELECT `+reportColumns+` FROM abuse_reports WHERE id=$1`, id))
+}
+
+func (r *PostgresRepo) ListReports(ctx context.Context, status string, limit, offset int) ([]model.AbuseReport, error) {
+	const q = `SELECT ` + reportColumns + ` FROM abuse_reports WHERE status = COALESCE(NULLIF($1, ''), status) ORDER BY id LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryContext(ctx, q, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanReports(rows)
+}
+
+func (r *PostgresRepo) ReviewReport(ctx context.Context, id int64, status, by string) (model.AbuseReport, error) {
+	const q = `
+		UPDATE abuse_reports SET status=$2, reviewed_by=$3, reviewed_at=now()
+		WHERE id=$1 AND status='pending'
+		RETURNING ` + reportColumns
+
+	return scanReport(r.db.QueryRowContext(ctx, q, id, status, by))
+}
+
+func (r *MySQLRepo) InsertReport(ctx context.Context, rep model.AbuseReport) (model.AbuseReport, error) {
+	const q = `INSERT INTO abuse_reports (code, reason, details, contact) VALUES (?, ?, ?, ?)`
+
+	res, err := r.db.ExecContext(ctx, q, rep.Code, rep.Reason, rep.Details, rep.Contact)
+	if err != nil {
+		return model.AbuseReport{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return model.AbuseReport{}, err
+	}
+	return r.GetReport(ctx, id)
+}
+
+func (r *MySQLRepo) GetReport(ctx context.Context, id int64) (model.AbuseReport, error) {
+	return scanReport(r.db.QueryRowContext(ctx, `SELECT `+reportColumns+` FROM abuse_reports WHERE id=?`, id))
+}
+
+func (r *MySQLRepo) ListReports(ctx context.Context, status string, limit, offset int) ([]model.AbuseReport, error) {
+	const q = `SELECT ` + reportColumns + ` FROM abuse_reports WHERE status = COALESCE(NULLIF(?, ''), status) ORDER BY id LIMIT ? OFFSET ?`
+
+	rows, err := r.db.QueryContext(ctx, q, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanReports(rows)
+}
+
+func (r *MySQLRepo) ReviewReport(ctx context.Context, id int64, status, by string) (model.AbuseReport, error) {
+	const q = `UPDATE abuse_reports SET status=?, reviewed_by=?, reviewed_at=CURRENT_TIMESTAMP(6) WHERE id=? AND status='pending'`
+
+	res, err := r.db.ExecContext(ctx, q, status, by, id)
+	if err := affectedOne(res, err); err != nil {
+		return model.AbuseReport{}, err
+	}
+	return r.GetReport(ctx, id)
+}
+
+func (r *MemoryRepo) InsertReport(ctx context.Context, rep model.AbuseReport) (model.AbuseReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep.ID = int64(len(r.reports) + 1)
+	rep.Status = model.ReportPending
+	rep.CreatedAt = time.Now().UTC()
+	rep.ReviewedBy, rep.ReviewedAt = "", nil
+	r.reports[rep.ID] = rep
+	return rep, nil
+}
+
+func (r *MemoryRepo) GetReport(ctx context.Context, id int64) (model.AbuseReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rep, ok := r.reports[id]
+	if !ok {
+		return model.AbuseReport{}, ErrNotFound
+	}
+	return rep, nil
+}
+
+func (r *MemoryRepo) ListReports(ctx context.Context, status string, limit, offset int) ([]model.AbuseReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var reports []model.AbuseReport
+	for _, rep := range r.reports {
+		if status == "" || rep.Status == status {
+			reports = append(reports, rep)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID < reports[j].ID })
+	if offset >= len(reports) {
+		return nil, nil
+	}
+	reports = reports[offset:]
+	if len(reports) > limit {
+		reports = reports[:limit]
+	}
+	return reports, nil
+}
+
+func (r *MemoryRepo) ReviewReport(ctx context.Context, id int64, status, by string) (model.AbuseReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep, ok := r.reports[id]
+	if !ok || rep.Status != model.ReportPending {
+		return model.AbuseReport{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	rep.Status, rep.ReviewedBy, rep.ReviewedAt = status, by, &now
+	r.reports[id] = rep
+	return rep, nil
+}
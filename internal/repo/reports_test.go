@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func testReports(t *testing.T, r ReportRepo) {
+	ctx := context.Background()
+	var ids []int64
+	for _, code := range []string{"abc", "def", "ghi"} {
+		rep, err := r.InsertReport(ctx, model.AbuseReport{Code: code, Reason: "spam", Contact: "me@example.com"})
+		if err != nil {
+			t.Fatalf("InsertReport: %v", err)
+		}
+		if rep.ID == 0 || rep.Status != model.ReportPending || rep.CreatedAt.IsZero() {
+			t.Fatalf("expected a pending report with an ID, got %+v", rep)
+		}
+		ids = append(ids, rep.ID)
+	}
+
+	rep, err := r.ReviewReport(ctx, ids[1], model.ReportRejected, "root")
+	if err != nil || rep.Status != model.ReportRejected || rep.ReviewedBy != "root" || rep.ReviewedAt == nil {
+		t.Fatalf("ReviewReport: expected the report rejected by root, got %+v (%v)", rep, err)
+	}
+	if _, err := r.ReviewReport(ctx, ids[1], model.ReportApproved, "root"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a reviewed report to stay reviewed, got %v", err)
+	}
+	if got, err := r.GetReport(ctx, ids[1]); err != nil || got.Status != model.ReportRejected {
+		t.Errorf("GetReport: expected the rejected report, got %+v (%v)", got, err)
+	}
+	if _, err := r.GetReport(ctx, -1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	pending, err := r.ListReports(ctx, model.ReportPending, 10, 0)
+	if err != nil || len(pending) != 2 || pending[0].Code != "abc" || pending[1].Code != "ghi" {
+		t.Errorf("ListReports: expected abc and ghi pending in order, got %+v (%v)", pending, err)
+	}
+	if all, _ := r.ListReports(ctx, "", 2, 1); len(all) != 2 || all[0].Code != "def" {
+		t.Errorf("ListReports: expected the second page of all reports to start at def, got %+v", all)
+	}
+}
+
+func TestMemoryRepo_Reports(t *testing.T) {
+	testReports(t, NewMemory())
+}
+
+func TestPostgresRepo_Reports(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+	testDB.Exec("DELETE FROM abuse_reports")
+	testReports(t, NewPostgres(testDB))
+}
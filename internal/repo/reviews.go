@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// ReviewRepo keeps the links held for review.
+type ReviewRepo interface {
+	// AddReview holds a link, replacing an earlier hold of its code.
+	AddReview(ctx context.Context, r model.Review) (model.Review, error)
+	// GetReview returns code's hold or ErrNotFound.
+	GetReview(ctx context.Context, code string) (model.Review, error)
+	// ListReviews returns the held links, oldest first.
+	ListReviews(ctx context.Context, limit, offset int) ([]model.Review, error)
+	// RemoveReview releases code; a missing hold yields ErrNotFound.
+	RemoveReview(ctx context.Context, code string) error
+}
+
+const reviewColumns = `code, owner, domain, score, reasons, created_at`
+
+func scanReview(row rowScanner) (model.Review, error) {
+	var r model.Review
+	var reasons string
+	err := row.Scan(&r.Code, &r.Owner, &r.Domain, &r.Score, &reasons, &r.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Review{}, ErrNotFound
+	}
+	r.Reasons = splitReasons(reasons)
+	return r, err
+}
+
+func scanReviews(rows *sql.Rows) ([]model.Review, error) {
+	defer rows.Close()
+
+	var reviews []model.Review
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// Reasons are stored one per line.
+func joinReasons(reasons []string) string {
+	return strings.Join(reasons, "\n")
+}
+
+func splitReasons(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func (r *PostgresRepo) AddReview(ctx context.Context, rev model.Review) (model.Review, error) {
+	const q = `
+		INSERT INTO link_reviews (code, owner, domain, score, reasons) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code) DO UPDATE SET
+			owner = EXCLUDED.owner, domain = EXCLUDED.domain, score = EXCLUDED.score,
+			reasons = EXCLUDED.reasons, created_at = now()
+		RETURNING created_at`
+
+	err := r.db.QueryRowContext(ctx, q, rev.Code, rev.Owner, rev.Domain, rev.Score, joinReasons(rev.Reasons)).Scan(&rev.CreatedAt)
+	return rev, err
+}
+
+func (r *PostgresRepo) GetReview(ctx context.Context, code string) (model.Review, error) {
+	return scanReview(r.db.QueryRowContext(ctx, `SELECT `+reviewColumns+` FROM link_reviews WHERE code=$1`, code))
+}
+
+func (r *PostgresRepo) ListReviews(ctx context.Context, limit, offset int) ([]model.Review, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+reviewColumns+` FROM link_reviews ORDER BY created_at, code LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+func (r *PostgresRepo) RemoveReview(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM link_reviews WHERE code=$1`, code)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) AddReview(ctx context.Context, rev model.Review) (model.Review, error) {
+	const q = `
+		INSERT INTO link_reviews (code, owner, domain, score, reasons) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			owner = VALUES(owner), domain = VALUES(domain), score = VALUES(score),
+			reasons = VALUES(reasons), created_at = CURRENT_TIMESTAMP(6)`
+
+	if _, err := r.db.ExecContext(ctx, q, rev.Code, rev.Owner, rev.Domain, rev.Score, joinReasons(rev.Reasons)); err != nil {
+		return model.Review{}, err
+	}
+	return r.GetReview(ctx, rev.Code)
+}
+
+func (r *MySQLRepo) GetReview(ctx context.Context, code string) (model.Review, error) {
+	return scanReview(r.db.QueryRowContext(ctx, `SELECT `+reviewColumns+` FROM link_reviews WHERE code=?`, code))
+}
+
+func (r *MySQLRepo) ListReviews(ctx context.Context, limit, offset int) ([]model.Review, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+reviewColumns+` FROM link_reviews ORDER BY created_at, code LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+func (r *MySQLRepo) RemoveReview(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM link_reviews WHERE code=?`, code)
+	return affectedOne(res, err)
+}
+
+func (r *MemoryRepo) AddReview(ctx context.Context, rev model.Review) (model.Review, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rev.CreatedAt = time.Now().UTC()
+	rev.Reasons = splitReasons(joinReasons(rev.Reasons))
+	r.reviews[rev.Code] = rev
+	return rev, nil
+}
+
+func (r *MemoryRepo) GetReview(ctx context.Context, code string) (model.Review, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rev, ok := r.reviews[code]
+	if !ok {
+		return model.Review{}, ErrNotFound
+	}
+	return rev, nil
+}
+
+func (r *MemoryRepo) ListReviews(ctx context.Context, limit, offset int) ([]model.Review, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reviews := make([]model.Review, 0, len(r.reviews))
+	for _, rev := range r.reviews {
+		reviews = append(reviews, rev)
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		if !reviews[i].CreatedAt.Equal(reviews[j].CreatedAt) {
+			return reviews[i].CreatedAt.Before(reviews[j].CreatedAt)
+		}
+		return reviews[i].Code < reviews[j].Code
+	})
+	if offset >= len(reviews) {
+		return nil, nil
+	}
+	reviews = reviews[offset:]
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+	}
+	return reviews, nil
+}
+
+func (r *MemoryRepo) RemoveReview(ctx context.Context, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.reviews[code]; !ok {
+		return ErrNotFound
+	}
+	delete(r.reviews, code)
+	return nil
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+func testReviews(t *testing.T, r ReviewRepo) {
+	ctx := context.Background()
+	for _, code := range []string{"abc", "def"} {
+		rev, err := r.AddReview(ctx, model.Review{Code: code, Owner: "alice", Domain: "free-prize.tk", Score: 40, Reasons: []string{"a", "b"}})
+		if err != nil || rev.CreatedAt.IsZero() {
+			t.Fatalf("AddReview: %+v (%v)", rev, err)
+		}
+	}
+
+	got, err := r.GetReview(ctx, "abc")
+	if err != nil || got.Score != 40 || !reflect.DeepEqual(got.Reasons, []string{"a", "b"}) {
+		t.Errorf("GetReview: expected the score and both reasons, got %+v (%v)", got, err)
+	}
+	if _, err := r.GetReview(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	reviews, err := r.ListReviews(ctx, 10, 0)
+	if err != nil || len(reviews) != 2 || reviews[0].Code != "abc" {
+		t.Errorf("ListReviews: expected abc then def, got %+v (%v)", reviews, err)
+	}
+
+	if err := r.RemoveReview(ctx, "abc"); err != nil {
+		t.Fatalf("RemoveReview: %v", err)
+	}
+	if err := r.RemoveReview(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound removing twice, got %v", err)
+	}
+	if reviews, _ := r.ListReviews(ctx, 10, 0); len(reviews) != 1 || reviews[0].Code != "def" {
+		t.Errorf("ListReviews: expected only def left, got %+v", reviews)
+	}
+}
+
+func TestMemoryRepo_Reviews(t *testing.T) {
+	testReviews(t, NewMemory())
+}
+
+func TestPostgresRepo_Reviews(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+	testDB.Exec("DELETE FROM link_reviews")
+	testReviews(t, NewPostgres(testDB))
+}
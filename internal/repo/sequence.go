@@ -0,0 +1,36 @@
+package repo
+
+import "context"
+
+// SequenceRepo hands out the numbers sequence codes are made from.
+type SequenceRepo interface {
+	// NextSequence returns a number never returned before, counting up
+	// from 1.
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+func (r *PostgresRepo) NextSequence(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := r.db.QueryRowContext(ctx, `SELECT nextval('code_seq')`).Scan(&n)
+	return n, err
+}
+
+// NextSequence bumps the single code_sequence row; LAST_INSERT_ID(expr)
+// hands the new value back in the statement's result, so no second query
+// on the same connection is needed.
+func (r *MySQLRepo) NextSequence(ctx context.Context) (uint64, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE code_sequence SET n = LAST_INSERT_ID(n + 1)`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.LastInsertId()
+	return uint64(n), err
+}
+
+func (r *MemoryRepo) NextSequence(ctx context.Context) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	return r.seq, nil
+}
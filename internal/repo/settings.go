@@ -0,0 +1,59 @@
+package repo
+
+import "context"
+
+// SettingsRepo keeps named values the service changes at run time.
+type SettingsRepo interface {
+	// GetSetting returns the value stored under name, or ErrNotFound.
+	GetSetting(ctx context.Context, name string) (string, error)
+	PutSetting(ctx context.Context, name, value string) error
+}
+
+func (r *PostgresRepo) GetSetting(ctx context.Context, name string) (string, error) {
+	var v string
+	err := r.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name=$1`, name).Scan(&v)
+	return v, err
+}
+
+func (r *PostgresRepo) PutSetting(ctx context.Context, name, value string) error {
+	const q = `
+		INSERT INTO settings (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = now()`
+
+	_, err := r.db.ExecContext(ctx, q, name, value)
+	return err
+}
+
+func (r *MySQLRepo) GetSetting(ctx context.Context, name string) (string, error) {
+	var v string
+	err := r.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE name=?`, name).Scan(&v)
+	return v, err
+}
+
+func (r *MySQLRepo) PutSetting(ctx context.Context, name, value string) error {
+	const q = `
+		INSERT INTO settings (name, value) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value), updated_at = CURRENT_TIMESTAMP(6)`
+
+	_, err := r.db.ExecContext(ctx, q, name, value)
+	return err
+}
+
+func (r *MemoryRepo) GetSetting(ctx context.Context, name string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	v, ok := r.settings[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (r *MemoryRepo) PutSetting(ctx context.Context, name, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.settings[name] = value
+	return nil
+}
@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"context"
+	"maps"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Singleflight is a URLRepo that lets concurrent GetByCode calls for the
+// same code share one query, so a burst of redirects for a link that just
+// went viral costs the database a single lookup.
+type Singleflight struct {
+	URLRepo
+	group singleflight.Group
+}
+
+// WithSingleflight wraps r.
+func WithSingleflight(r URLRepo) *Singleflight {
+	return &Singleflight{URLRepo: r}
+}
+
+func (r *Singleflight) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	// Tenants see different links, so only callers in the same scope share.
+	scope, ok := TenantOf(ctx)
+	if !ok {
+		scope = "*"
+	}
+	v, err, shared := r.group.Do(scope+"/"+code, func() (any, error) {
+		// One caller giving up must not fail the others.
+		return r.URLRepo.GetByCode(context.WithoutCancel(ctx), code)
+	})
+	rec := v.(model.URLRecord)
+	if shared {
+		// Every caller gets a record of its own to change.
+		rec.UTM = maps.Clone(rec.UTM)
+	}
+	return rec, err
+}
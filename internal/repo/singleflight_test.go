@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// slowRepo holds every GetByCode until release is closed.
+type slowRepo struct {
+	*MemoryRepo
+	release chan struct{}
+	lookups atomic.Int32
+}
+
+func (r *slowRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
+	r.lookups.Add(1)
+	<-r.release
+	return r.MemoryRepo.GetByCode(ctx, code)
+}
+
+func TestSingleflight(t *testing.T) {
+	ctx := context.Background()
+	inner := &slowRepo{MemoryRepo: NewMemory(), release: make(chan struct{})}
+	inner.Insert(ctx, model.URLRecord{ID: "1", Code: "viral", LongUrl: "https://example.com/", UTM: map[string]string{"utm_source": "x"}})
+	r := WithSingleflight(inner)
+
+	recs := make([]model.URLRecord, 20)
+	var wg sync.WaitGroup
+	for i := range recs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i], _ = r.GetByCode(ctx, "viral")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	if n := inner.lookups.Load(); n != 1 {
+		t.Errorf("expected 1 query for concurrent lookups, got %d", n)
+	}
+	for _, rec := range recs {
+		if rec.Code != "viral" {
+			t.Fatalf("expected every caller to get the link, got %+v", rec)
+		}
+	}
+	recs[0].UTM["utm_source"] = "changed"
+	if recs[1].UTM["utm_source"] != "x" {
+		t.Error("expected callers not to share the record's maps")
+	}
+}
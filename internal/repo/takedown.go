@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+const takedownColumns = `code, owner, reason, note, taken_by, created_at`
+
+func scanTakedown(row *sql.Row) (model.Takedown, error) {
+	var t model.Takedown
+	err := row.Scan(&t.Code, &t.Owner, &t.Reason, &t.Note, &t.By, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Takedown{}, ErrNotFound
+	}
+	return t, err
+}
+
+func (r *PostgresRepo) AddTakedown(ctx context.Context, t model.Takedown) (model.Takedown, error) {
+	const q = `
+		INSERT INTO takedowns (code, owner, reason, note, taken_by) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code) DO UPDATE SET
+			owner = EXCLUDED.owner, reason = EXCLUDED.reason, note = EXCLUDED.note,
+			taken_by = EXCLUDED.taken_by, created_at = now()
+		RETURNING created_at`
+
+	err := r.db.QueryRowContext(ctx, q, t.Code, t.Owner, t.Reason, t.Note, t.By).Scan(&t.CreatedAt)
+	return t, err
+}
+
+func (r *PostgresRepo) GetTakedown(ctx context.Context, code string) (model.Takedown, error) {
+	return scanTakedown(r.db.QueryRowContext(ctx, `SELECT `+takedownColumns+` FROM takedowns WHERE code=$1`, code))
+}
+
+func (r *PostgresRepo) RemoveTakedown(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM takedowns WHERE code=$1`, code)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) AddTakedown(ctx context.Context, t model.Takedown) (model.Takedown, error) {
+	const q = `
+		INSERT INTO takedowns (code, owner, reason, note, taken_by) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			owner = VALUES(owner), reason = VALUES(reason), note = VALUES(note),
+			taken_by = VALUES(taken_by), created_at = CURRENT_TIMESTAMP(6)`
+
+	if _, err := r.db.ExecContext(ctx, q, t.Code, t.Owner, t.Reason, t.Note, t.By); err != nil {
+		return model.Takedown{}, err
+	}
+	return r.GetTakedown(ctx, t.Code)
+}
+
+func (r *MySQLRepo) GetTakedown(ctx context.Context, code string) (model.Takedown, error) {
+	return scanTakedown(r.db.QueryRowContext(ctx, `SELECT `+takedownColumns+` FROM takedowns WHERE code=?`, code))
+}
+
+func (r *MySQLRepo) RemoveTakedown(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM takedowns WHERE code=?`, code)
+	return affectedOne(res, err)
+}
+
+func (r *MemoryRepo) AddTakedown(ctx context.Context, t model.Takedown) (model.Takedown, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.CreatedAt = time.Now().UTC()
+	r.takedowns[t.Code] = t
+	return t, nil
+}
+
+func (r *MemoryRepo) GetTakedown(ctx context.Context, code string) (model.Takedown, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.takedowns[code]
+	if !ok {
+		return model.Takedown{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (r *MemoryRepo) RemoveTakedown(ctx context.Context, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.takedowns[code]; !ok {
+		return ErrNotFound
+	}
+	delete(r.takedowns, code)
+	return nil
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// tenantKey keys the tenant scope of a context.
+type tenantKey struct{}
+
+// tenantScope is nil-able so AllTenants can lift a scope set further up.
+type tenantScope struct{ id string }
+
+// WithTenant scopes the link queries made with the returned context to
+// tenant's links, and stamps the links it inserts with tenant. The default
+// tenant is "".
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, &tenantScope{id: tenant})
+}
+
+// AllTenants lifts any tenant scope, as for operators and background jobs.
+// A context that was never scoped already sees every tenant's links.
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantKey{}, (*tenantScope)(nil))
+}
+
+// TenantOf returns the tenant ctx is scoped to, if any.
+func TenantOf(ctx context.Context) (string, bool) {
+	s, _ := ctx.Value(tenantKey{}).(*tenantScope)
+	if s == nil {
+		return "", false
+	}
+	return s.id, true
+}
+
+// tenantArg is the query argument for the tenant_id = COALESCE(?, tenant_id)
+// filter: the tenant, or NULL to match every tenant.
+func tenantArg(ctx context.Context) sql.NullString {
+	id, ok := TenantOf(ctx)
+	return sql.NullString{String: id, Valid: ok}
+}
+
+// tenantID is the tenant new links made with ctx belong to.
+func tenantID(ctx context.Context) string {
+	id, _ := TenantOf(ctx)
+	return id
+}
+
+// inTenant reports whether rec is visible to ctx.
+func inTenant(ctx context.Context, rec model.URLRecord) bool {
+	id, ok := TenantOf(ctx)
+	return !ok || rec.Tenant == id
+}
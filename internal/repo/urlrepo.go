@@ -3,46 +3,343 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
 
 	"urlshortener/urlshortener/internal/model"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+const PgUniqueViolation = "23505"
+
 type URLRepo interface {
-	GetByLong(ctx context.Context, long string) (model.URLRecord, error)
+	// GetByLong finds the link for long on a short domain ("" for the
+	// default). Unique links are never found this way.
+	GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error)
 	GetByCode(ctx context.Context, code string) (model.URLRecord, error)
-	Insert(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error)
+	// Insert stores a new record from rec's ID, Code, LongUrl, ShortUrl, UTM,
+	// Owner, Domain, ExpiresAt, Title, Description, Org, OriginalURL, Unique,
+	// MaxClicks and FallbackURL fields and returns it as persisted. A non-zero CreatedAt is kept, e.g. for imported links;
+	// otherwise the current time is used.
+	Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error)
+	// Upsert stores rec like Insert, along with its ScanStatus and ScannedAt
+	// when set, unless its destination already has a link on rec.Domain and
+	// rec is not Unique; then it returns that link and false. A taken code still yields
+	// ErrDuplicateCode.
+	Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error)
+	// Update writes rec's destination, original URL, scan state, title,
+	// description and fallback URL and bumps updated_at, provided the stored updated_at still equals prev. A missing code or a
+	// concurrent modification both yield ErrNotFound.
+	Update(ctx context.Context, rec model.URLRecord, prev time.Time) (model.URLRecord, error)
+	// Delete removes a link for good, freeing its code and destination.
+	Delete(ctx context.Context, code string) error
+	// ListByOwner returns owner's links, newest first, skipping offset of them.
+	// A non-empty query keeps only links whose long URL contains it,
+	// ignoring case.
+	ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error)
+	// ListAfter returns up to limit of owner's links in code order, starting
+	// after the code after ("" for the first). Unlike offsets, the position
+	// stays valid while links are added or deleted.
+	ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error)
+	// SetActive disables or re-enables a link and bumps updated_at.
+	SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error)
+	// TakeClick counts a redirect of a link with MaxClicks set and disables
+	// the link on its last allowed one, atomically so concurrent redirects
+	// cannot overshoot. It returns the updated link, or ErrNotFound when the
+	// link is disabled, has no clicks left or has no limit.
+	TakeClick(ctx context.Context, code string) (model.URLRecord, error)
+	// UpdateScanStatus records the outcome of a malware scan and stamps scanned_at.
+	UpdateScanStatus(ctx context.Context, code string, status string) error
+	// ListForScan returns up to limit records not yet flagged whose last scan
+	// is older than before, never-scanned records first.
+	ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error)
+	// DeleteStale deletes up to limit links that expired before expiredBefore
+	// or, unless disabledBefore is zero, were disabled before disabledBefore.
+	// It returns the number of links deleted.
+	DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error)
+	// EachCode calls fn with the code of every link of every tenant, in no
+	// particular order, stopping at the first error fn returns.
+	EachCode(ctx context.Context, fn func(code string) error) error
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// recordColumns is the column list every record query selects, in scanRecord order.
+const recordColumns = `id, code, long_url, short_url, created_at, scan_status, scanned_at, utm_params, owner, updated_at, active, domain, expires_at, title, description, org, COALESCE(original_url, ''), NOT dedup, max_clicks, click_count, tenant_id, COALESCE(fallback_url, '')`
+
+func scanRecord(row rowScanner) (model.URLRecord, error) {
+	var rec model.URLRecord
+	var scannedAt, expiresAt sql.NullTime
+	var utm string
+	err := row.Scan(&rec.ID, &rec.Code, &rec.LongUrl, &rec.ShortUrl, &rec.CreatedAt, &rec.ScanStatus, &scannedAt, &utm, &rec.Owner, &rec.UpdatedAt, &rec.Active, &rec.Domain, &expiresAt, &rec.Title, &rec.Description, &rec.Org, &rec.OriginalURL, &rec.Unique, &rec.MaxClicks, &rec.ClickCount, &rec.Tenant, &rec.FallbackURL)
+	if scannedAt.Valid {
+		rec.ScannedAt = &scannedAt.Time
+	}
+	if expiresAt.Valid {
+		rec.ExpiresAt = &expiresAt.Time
+	}
+	rec.UTM = decodeParams(utm)
+	return rec, err
+}
+
+// encodeParams serialises link parameters as a query string, keys sorted.
+func encodeParams(params map[string]string) string {
+	v := make(url.Values, len(params))
+	for k, val := range params {
+		v.Set(k, val)
+	}
+	return v.Encode()
+}
+
+func decodeParams(s string) map[string]string {
+	v, err := url.ParseQuery(s)
+	if err != nil || len(v) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(v))
+	for k := range v {
+		params[k] = v.Get(k)
+	}
+	return params
+}
+
+func scanRecords(rows *sql.Rows) ([]model.URLRecord, error) {
+	defer rows.Close()
+
+	var recs []model.URLRecord
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
 }
 
 type PostgresRepo struct{ db *sql.DB }
 
 func NewPostgres(db *sql.DB) *PostgresRepo { return &PostgresRepo{db} }
 
-func (r *PostgresRepo) GetByLong(ctx context.Context, long string) (model.URLRecord, error) {
-	const q = `SELECT id, code, long_url, short_url, created_at FROM url_records WHERE long_url=$1`
-
-	var rec model.URLRecord
-	err := r.db.QueryRowContext(ctx, q, long).Scan(&rec.ID, &rec.Code, &rec.LongUrl, &rec.ShortUrl, &rec.CreatedAt)
+func (r *PostgresRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	const q = `SELECT ` + recordColumns + ` FROM url_records WHERE domain=$1 AND long_url=$2 AND dedup AND tenant_id=$3`
 
-	return rec, err
+	return scanRecord(r.db.QueryRowContext(ctx, q, domain, long, tenantID(ctx)))
 }
 
 func (r *PostgresRepo) GetByCode(ctx context.Context, code string) (model.URLRecord, error) {
-	const q = `SELECT id, code, long_url, short_url, created_at FROM url_records WHERE code=$1`
-	var rec model.URLRecord
-	err := r.db.QueryRowContext(ctx, q, code).Scan(&rec.ID, &rec.Code, &rec.LongUrl, &rec.ShortUrl, &rec.CreatedAt)
-	return rec, err
+	const q = `SELECT ` + recordColumns + ` FROM url_records WHERE code=$1 AND tenant_id = COALESCE($2, tenant_id)`
+	return scanRecord(r.db.QueryRowContext(ctx, q, code, tenantArg(ctx)))
 }
 
-func (r *PostgresRepo) Insert(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error) {
+func (r *PostgresRepo) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
 	const q = `
-		INSERT INTO url_records (id, code, long_url, short_url)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, code, long_url, short_url, created_at`
+		INSERT INTO url_records (id, code, long_url, short_url, utm_params, owner, domain, expires_at, title, description, org, original_url, dedup, max_clicks, tenant_id, fallback_url, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $12, $13, $14, $15, $16, $17, COALESCE($11, now()), COALESCE($11, now()))
+		RETURNING ` + recordColumns
 
-	var rec model.URLRecord
+	rec, err := scanRecord(r.db.QueryRowContext(ctx, q, rec.ID, rec.Code, rec.LongUrl, rec.ShortUrl, encodeParams(rec.UTM), rec.Owner, rec.Domain, rec.ExpiresAt, rec.Title, rec.Description, nullTime(rec.CreatedAt), rec.Org, rec.OriginalURL, !rec.Unique, rec.MaxClicks, tenantID(ctx), rec.FallbackURL))
 
-	err := r.db.QueryRowContext(ctx, q, id, code, long, short).
-		Scan(&rec.ID, &rec.Code, &rec.LongUrl, &rec.ShortUrl, &rec.CreatedAt)
+	return rec, mapPgError(err)
+}
 
-	return rec, err
+func (r *PostgresRepo) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	const q = `
+		INSERT INTO url_records (id, code, long_url, short_url, utm_params, owner, domain, expires_at, title, description, org, scan_status, scanned_at, original_url, dedup, max_clicks, tenant_id, fallback_url, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $12, COALESCE(NULLIF($13, ''), 'unchecked'), $14, $15, $16, $17, $18, $19, COALESCE($11, now()), COALESCE($11, now()))
+		ON CONFLICT (tenant_id, domain, long_url) WHERE dedup DO NOTHING
+		RETURNING ` + recordColumns
+
+	out, err := scanRecord(r.db.QueryRowContext(ctx, q, rec.ID, rec.Code, rec.LongUrl, rec.ShortUrl, encodeParams(rec.UTM), rec.Owner, rec.Domain, rec.ExpiresAt, rec.Title, rec.Description, nullTime(rec.CreatedAt), rec.Org, rec.ScanStatus, rec.ScannedAt, rec.OriginalURL, !rec.Unique, rec.MaxClicks, tenantID(ctx), rec.FallbackURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		// The destination is taken; the conflicting row is committed, so a
+		// fresh statement sees it.
+		out, err = r.GetByLong(ctx, rec.Domain, rec.LongUrl)
+		return out, false, err
+	}
+	return out, err == nil, mapPgError(err)
+}
+
+func (r *PostgresRepo) Update(ctx context.Context, rec model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	const q = `
+		UPDATE url_records
+		SET long_url=$2, utm_params=$3, scan_status=$4, scanned_at=$5, title=$7, description=$8, original_url=$9, fallback_url=$11, updated_at=now()
+		WHERE code=$1 AND updated_at=$6 AND tenant_id = COALESCE($10, tenant_id)
+		RETURNING ` + recordColumns
+
+	rec, err := scanRecord(r.db.QueryRowContext(ctx, q, rec.Code, rec.LongUrl, encodeParams(rec.UTM), rec.ScanStatus, rec.ScannedAt, prev, rec.Title, rec.Description, rec.OriginalURL, tenantArg(ctx), rec.FallbackURL))
+
+	return rec, mapPgError(err)
+}
+
+func (r *PostgresRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	const q = `UPDATE url_records SET active=$2, updated_at=now() WHERE code=$1 AND tenant_id = COALESCE($3, tenant_id) RETURNING ` + recordColumns
+
+	return scanRecord(r.db.QueryRowContext(ctx, q, code, active, tenantArg(ctx)))
+}
+
+func (r *PostgresRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	// SET expressions all see the row as it was before the update.
+	const q = `
+		UPDATE url_records
+		SET click_count = click_count + 1,
+		    active = click_count + 1 < max_clicks,
+		    updated_at = CASE WHEN click_count + 1 < max_clicks THEN updated_at ELSE now() END
+		WHERE code=$1 AND active AND max_clicks > 0 AND click_count < max_clicks AND tenant_id = COALESCE($2, tenant_id)
+		RETURNING ` + recordColumns
+
+	return scanRecord(r.db.QueryRowContext(ctx, q, code, tenantArg(ctx)))
+}
+
+func (r *PostgresRepo) Delete(ctx context.Context, code string) error {
+	const q = `DELETE FROM url_records WHERE code=$1 AND tenant_id = COALESCE($2, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, code, tenantArg(ctx))
+	return affectedOne(res, err)
+}
+
+func (r *PostgresRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	// The trigram index on long_url serves the ILIKE once query has three or
+	// more characters.
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE owner=$1 AND long_url ILIKE $4 AND tenant_id = COALESCE($5, tenant_id)
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryContext(ctx, q, owner, limit, offset, containsPattern(query), tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *PostgresRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE owner=$1 AND code > $2 AND tenant_id = COALESCE($4, tenant_id)
+		ORDER BY code
+		LIMIT $3`
+
+	rows, err := r.db.QueryContext(ctx, q, owner, after, limit, tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *PostgresRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	const q = `UPDATE url_records SET scan_status=$2, scanned_at=now() WHERE code=$1 AND tenant_id = COALESCE($3, tenant_id)`
+
+	res, err := r.db.ExecContext(ctx, q, code, status, tenantArg(ctx))
+	return affectedOne(res, err)
+}
+
+func (r *PostgresRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	const q = `
+		SELECT ` + recordColumns + ` FROM url_records
+		WHERE scan_status <> 'flagged' AND (scanned_at IS NULL OR scanned_at < $1) AND tenant_id = COALESCE($3, tenant_id)
+		ORDER BY scanned_at NULLS FIRST
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, q, before, limit, tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (r *PostgresRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	const q = `
+		DELETE FROM url_records WHERE id IN (
+			SELECT id FROM url_records
+			WHERE (expires_at < $1 OR (NOT active AND updated_at < $2)) AND tenant_id = COALESCE($4, tenant_id)
+			LIMIT $3
+		)`
+
+	res, err := r.db.ExecContext(ctx, q, expiredBefore, nullTime(disabledBefore), limit, tenantArg(ctx))
+	return rowsAffected(res, err)
+}
+
+func (r *PostgresRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	return eachCode(ctx, r.db, fn)
+}
+
+// eachCode streams every code, for both SQL dialects.
+func eachCode(ctx context.Context, db *sql.DB, fn func(code string) error) error {
+	rows, err := db.QueryContext(ctx, `SELECT code FROM url_records`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return err
+		}
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// nullTime maps the zero time to NULL, which no comparison matches.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func rowsAffected(res sql.Result, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// affectedOne turns an UPDATE that matched no row into ErrNotFound.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mapPgError translates unique violations into the driver-agnostic repo
+// errors. Only the constraint name is looked at; the detail quotes the
+// duplicated value, which is user controlled.
+func mapPgError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != PgUniqueViolation {
+		return err
+	}
+
+	switch {
+	case strings.Contains(pgErr.ConstraintName, "long_url"):
+		return ErrDuplicateLongURL
+	case strings.Contains(pgErr.ConstraintName, "code"):
+		return ErrDuplicateCode
+	}
+	return err
+}
+
+// containsPattern is a LIKE pattern matching strings that contain s, with
+// LIKE's own wildcards in s escaped.
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+	return "%" + s + "%"
 }
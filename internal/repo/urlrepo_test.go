@@ -3,13 +3,20 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/testutil"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/sbowman/dotenv"
 )
 
@@ -20,15 +27,19 @@ func TestMain(m *testing.M) {
 	var err error
 	testDB, err = setupTestDB()
 	if err != nil {
-		log.Fatalf("Failed to setup test database: %v", err)
+		// Postgres tests skip themselves; the in-memory repo tests still run.
+		log.Printf("Failed to setup test database: %v", err)
+		testDB = nil
 	}
-	defer testDB.Close()
 
 	// Run tests
 	code := m.Run()
 
 	// Cleanup
-	cleanupTestDB()
+	if testDB != nil {
+		cleanupTestDB()
+		testDB.Close()
+	}
 
 	os.Exit(code)
 }
@@ -46,7 +57,7 @@ func setupTestDB() (*sql.DB, error) {
 	dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s",
 		dbUser, dbPass, dbName, dbHost, dbPort, dbSSLMode)
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -76,7 +87,7 @@ func createTestDatabase(user, pass, dbname, host, port, sslmode string) error {
 	dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s",
 		user, pass, dbname, host, port, sslmode)
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return err
 	}
@@ -92,17 +103,7 @@ func createTestDatabase(user, pass, dbname, host, port, sslmode string) error {
 }
 
 func createTestTable(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS url_records (
-			id UUID PRIMARY KEY,
-			code TEXT NOT NULL UNIQUE,
-			long_url TEXT NOT NULL UNIQUE,
-			short_url TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
-		)`
-
-	_, err := db.Exec(query)
-	return err
+	return testutil.ApplyMigrations(db)
 }
 
 func cleanupTestDB() {
@@ -135,7 +136,7 @@ func TestPostgresRepo_Insert(t *testing.T) {
 	longURL := "https://example.com/test"
 	shortURL := "https://shawt.ly/ABC123"
 
-	rec, err := repo.Insert(ctx, id, code, longURL, shortURL)
+	rec, err := repo.Insert(ctx, model.URLRecord{ID: id, Code: code, LongUrl: longURL, ShortUrl: shortURL})
 	if err != nil {
 		t.Fatalf("Insert failed: %v", err)
 	}
@@ -184,15 +185,15 @@ func TestPostgresRepo_Insert_DuplicateCode(t *testing.T) {
 	testDB.Exec("DELETE FROM url_records")
 
 	// Insert first record
-	_, err := repo.Insert(ctx, uuid.New().String(), "DUP123", "https://example.com/1", "https://shawt.ly/DUP123")
+	_, err := repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "DUP123", LongUrl: "https://example.com/1", ShortUrl: "https://shawt.ly/DUP123"})
 	if err != nil {
 		t.Fatalf("First insert failed: %v", err)
 	}
 
 	// Try to insert with same code
-	_, err = repo.Insert(ctx, uuid.New().String(), "DUP123", "https://example.com/2", "https://shawt.ly/DUP123")
-	if err == nil {
-		t.Error("Expected error for duplicate code")
+	_, err = repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "DUP123", LongUrl: "https://example.com/2", ShortUrl: "https://shawt.ly/DUP123"})
+	if !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("Expected ErrDuplicateCode for duplicate code, got %v", err)
 	}
 
 	// Verify only one record exists
@@ -217,15 +218,15 @@ func TestPostgresRepo_Insert_DuplicateLongURL(t *testing.T) {
 	longURL := "https://example.com/duplicate"
 
 	// Insert first record
-	_, err := repo.Insert(ctx, uuid.New().String(), "CODE1", longURL, "https://shawt.ly/CODE1")
+	_, err := repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "CODE1", LongUrl: longURL, ShortUrl: "https://shawt.ly/CODE1"})
 	if err != nil {
 		t.Fatalf("First insert failed: %v", err)
 	}
 
 	// Try to insert with same long URL
-	_, err = repo.Insert(ctx, uuid.New().String(), "CODE2", longURL, "https://shawt.ly/CODE2")
-	if err == nil {
-		t.Error("Expected error for duplicate long URL")
+	_, err = repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "CODE2", LongUrl: longURL, ShortUrl: "https://shawt.ly/CODE2"})
+	if !errors.Is(err, ErrDuplicateLongURL) {
+		t.Errorf("Expected ErrDuplicateLongURL for duplicate long URL, got %v", err)
 	}
 
 	// Verify only one record exists
@@ -236,6 +237,37 @@ func TestPostgresRepo_Insert_DuplicateLongURL(t *testing.T) {
 	}
 }
 
+func TestPostgresRepo_Upsert(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	testDB.Exec("DELETE FROM url_records")
+
+	longURL := "https://example.com/upsert"
+	now := time.Now()
+	first, created, err := repo.Upsert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "UPS001", LongUrl: longURL, ShortUrl: "https://shawt.ly/UPS001", ScanStatus: "clean", ScannedAt: &now})
+	if err != nil || !created {
+		t.Fatalf("First upsert: expected a new record, got created=%v, %v", created, err)
+	}
+	if first.ScanStatus != "clean" || first.ScannedAt == nil {
+		t.Errorf("Expected the scan status to be stored, got %q %v", first.ScanStatus, first.ScannedAt)
+	}
+
+	again, created, err := repo.Upsert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "UPS002", LongUrl: longURL, ShortUrl: "https://shawt.ly/UPS002"})
+	if err != nil || created || again.Code != "UPS001" {
+		t.Errorf("Second upsert: expected existing UPS001, got %s created=%v, %v", again.Code, created, err)
+	}
+
+	_, _, err = repo.Upsert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "UPS001", LongUrl: "https://example.com/other", ShortUrl: "https://shawt.ly/UPS001"})
+	if !errors.Is(err, ErrDuplicateCode) {
+		t.Errorf("Expected ErrDuplicateCode, got %v", err)
+	}
+}
+
 func TestPostgresRepo_GetByLong(t *testing.T) {
 	if testDB == nil {
 		t.Skip("Test database not available")
@@ -253,13 +285,13 @@ func TestPostgresRepo_GetByLong(t *testing.T) {
 	shortURL := "https://shawt.ly/GETLONG"
 
 	// Insert test record
-	insertedRec, err := repo.Insert(ctx, id, code, longURL, shortURL)
+	insertedRec, err := repo.Insert(ctx, model.URLRecord{ID: id, Code: code, LongUrl: longURL, ShortUrl: shortURL})
 	if err != nil {
 		t.Fatalf("Failed to insert test record: %v", err)
 	}
 
 	// Test GetByLong
-	rec, err := repo.GetByLong(ctx, longURL)
+	rec, err := repo.GetByLong(ctx, "", longURL)
 	if err != nil {
 		t.Fatalf("GetByLong failed: %v", err)
 	}
@@ -292,7 +324,7 @@ func TestPostgresRepo_GetByLong_NotFound(t *testing.T) {
 	// Clean up
 	testDB.Exec("DELETE FROM url_records")
 
-	_, err := repo.GetByLong(ctx, "https://nonexistent.com")
+	_, err := repo.GetByLong(ctx, "", "https://nonexistent.com")
 	if err != sql.ErrNoRows {
 		t.Errorf("Expected sql.ErrNoRows, got %v", err)
 	}
@@ -315,7 +347,7 @@ func TestPostgresRepo_GetByCode(t *testing.T) {
 	shortURL := "https://shawt.ly/GETCODE"
 
 	// Insert test record
-	insertedRec, err := repo.Insert(ctx, id, code, longURL, shortURL)
+	insertedRec, err := repo.Insert(ctx, model.URLRecord{ID: id, Code: code, LongUrl: longURL, ShortUrl: shortURL})
 	if err != nil {
 		t.Fatalf("Failed to insert test record: %v", err)
 	}
@@ -385,7 +417,7 @@ func TestPostgresRepo_Integration(t *testing.T) {
 
 	// Insert all records
 	for i, tc := range testCases {
-		_, err := repo.Insert(ctx, tc.id, tc.code, tc.longURL, tc.shortURL)
+		_, err := repo.Insert(ctx, model.URLRecord{ID: tc.id, Code: tc.code, LongUrl: tc.longURL, ShortUrl: tc.shortURL})
 		if err != nil {
 			t.Fatalf("Failed to insert record %d (%s): %v", i, tc.id, err)
 		}
@@ -400,7 +432,7 @@ func TestPostgresRepo_Integration(t *testing.T) {
 
 	// Test retrieval by long URL
 	for _, tc := range testCases {
-		rec, err := repo.GetByLong(ctx, tc.longURL)
+		rec, err := repo.GetByLong(ctx, "", tc.longURL)
 		if err != nil {
 			t.Errorf("Failed to get record by long URL %s: %v", tc.longURL, err)
 			continue
@@ -454,7 +486,7 @@ func BenchmarkPostgresRepo_Insert(b *testing.B) {
 		longURL := fmt.Sprintf("https://example.com/bench/%d", i)
 		shortURL := fmt.Sprintf("https://shawt.ly/BENCH%d", i)
 
-		_, err := repo.Insert(ctx, id, code, longURL, shortURL)
+		_, err := repo.Insert(ctx, model.URLRecord{ID: id, Code: code, LongUrl: longURL, ShortUrl: shortURL})
 		if err != nil {
 			b.Fatalf("Insert failed: %v", err)
 		}
@@ -479,7 +511,7 @@ func BenchmarkPostgresRepo_GetByCode(b *testing.B) {
 		longURL := fmt.Sprintf("https://example.com/bench/%d", i)
 		shortURL := fmt.Sprintf("https://shawt.ly/BENCH%d", i)
 
-		repo.Insert(ctx, id, code, longURL, shortURL)
+		repo.Insert(ctx, model.URLRecord{ID: id, Code: code, LongUrl: longURL, ShortUrl: shortURL})
 	}
 
 	b.ResetTimer()
@@ -491,3 +523,237 @@ func BenchmarkPostgresRepo_GetByCode(b *testing.B) {
 		}
 	}
 }
+
+func TestPostgresRepo_Update(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	testDB.Exec("DELETE FROM url_records")
+
+	rec, err := repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "UPD123", LongUrl: "https://example.com/old", ShortUrl: "https://shawt.ly/UPD123", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if rec.Owner != "alice" {
+		t.Errorf("Expected owner alice, got %q", rec.Owner)
+	}
+
+	prev := rec.UpdatedAt
+	rec.LongUrl = "https://example.com/new"
+	updated, err := repo.Update(ctx, rec, prev)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.LongUrl != "https://example.com/new" || updated.UpdatedAt.Equal(prev) {
+		t.Errorf("Expected new long URL and updated_at, got %+v", updated)
+	}
+
+	if _, err := repo.Update(ctx, rec, prev); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for stale revision, got %v", err)
+	}
+}
+
+func TestPostgresRepo_ListByOwner_Search(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	testDB.Exec("DELETE FROM url_records")
+
+	for code, long := range map[string]string{
+		"SRC001": "https://Docs.example.com/getting-started",
+		"SRC002": "https://example.com/100%_off",
+		"SRC003": "https://example.com/1000-off",
+	} {
+		if _, err := repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: code, LongUrl: long, ShortUrl: "https://shawt.ly/" + code, Owner: "alice"}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		query string
+		want  int
+	}{
+		{"", 3},
+		{"docs.EXAMPLE", 1},
+		{"100%_", 1},
+		{"nothing", 0},
+	}
+	for _, tc := range testCases {
+		recs, err := repo.ListByOwner(ctx, "alice", tc.query, 10, 0)
+		if err != nil {
+			t.Fatalf("ListByOwner(%q) failed: %v", tc.query, err)
+		}
+		if len(recs) != tc.want {
+			t.Errorf("ListByOwner(%q): expected %d links, got %d", tc.query, tc.want, len(recs))
+		}
+	}
+}
+
+func TestPostgresRepo_InsertClicks(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	testDB.Exec("DELETE FROM click_events")
+
+	now := time.Now().UTC()
+	events := []model.ClickEvent{
+		{Code: "CLK001", ClickedAt: now, Referrer: "https://news.example/", IPHash: "abc", UserAgent: "ua", Country: "FI"},
+		{Code: "CLK001", ClickedAt: now},
+	}
+	if err := repo.InsertClicks(ctx, events); err != nil {
+		t.Fatalf("InsertClicks failed: %v", err)
+	}
+
+	var count int
+	if err := testDB.QueryRow("SELECT COUNT(*) FROM click_events WHERE code = $1", "CLK001").Scan(&count); err != nil {
+		t.Fatalf("Failed to count clicks: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 click events, got %d", count)
+	}
+}
+
+func TestPostgresRepo_RollupClicks(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	testDB.Exec("DELETE FROM click_events")
+	testDB.Exec("DELETE FROM click_daily")
+
+	may1 := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	events := []model.ClickEvent{
+		{Code: "CLK001", ClickedAt: may1},
+		{Code: "CLK001", ClickedAt: may1},
+		{Code: "CLK001", ClickedAt: may1.Add(2 * time.Minute)},
+	}
+	if err := repo.InsertClicks(ctx, events); err != nil {
+		t.Fatalf("InsertClicks failed: %v", err)
+	}
+	if err := repo.RollupClicks(ctx); err != nil {
+		t.Fatalf("RollupClicks failed: %v", err)
+	}
+	// Rolling up again recounts instead of adding.
+	if err := repo.RollupClicks(ctx); err != nil {
+		t.Fatalf("RollupClicks failed: %v", err)
+	}
+
+	days, err := repo.DailyClicks(ctx, "CLK001", may1, may1.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("DailyClicks failed: %v", err)
+	}
+	want := []model.DailyClicks{{Day: "2024-05-01", Clicks: 2}, {Day: "2024-05-02", Clicks: 1}}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("Expected %v, got %v", want, days)
+	}
+
+	codes, err := repo.TopCodes(ctx, may1.AddDate(0, 0, 1), 10)
+	if err != nil || !reflect.DeepEqual(codes, []string{"CLK001"}) {
+		t.Errorf("Expected TopCodes to count from May 2, got %v (%v)", codes, err)
+	}
+}
+
+func TestPostgresRepo_DeleteStale(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	testDB.Exec("DELETE FROM url_records")
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "EXP001", LongUrl: "https://example.com/1", ShortUrl: "https://shawt.ly/EXP001", ExpiresAt: &past})
+	repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "EXP002", LongUrl: "https://example.com/2", ShortUrl: "https://shawt.ly/EXP002", ExpiresAt: &future})
+	repo.Insert(ctx, model.URLRecord{ID: uuid.New().String(), Code: "OFF001", LongUrl: "https://example.com/3", ShortUrl: "https://shawt.ly/OFF001"})
+	repo.SetActive(ctx, "OFF001", false)
+
+	n, err := repo.DeleteStale(ctx, time.Now(), time.Time{}, 10)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 expired link deleted, got n=%d err=%v", n, err)
+	}
+	if _, err := repo.GetByCode(ctx, "EXP001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected EXP001 to be gone, got %v", err)
+	}
+
+	n, err = repo.DeleteStale(ctx, time.Now(), time.Now().Add(time.Minute), 10)
+	if err != nil || n != 1 {
+		t.Errorf("Expected the disabled link deleted, got n=%d err=%v", n, err)
+	}
+}
+
+func TestPostgresRepo_NextSequence(t *testing.T) {
+	if testDB == nil {
+		t.Skip("Test database not available")
+	}
+
+	repo := NewPostgres(testDB)
+	ctx := context.Background()
+
+	first, err := repo.NextSequence(ctx)
+	if err != nil {
+		t.Fatalf("NextSequence failed: %v", err)
+	}
+	if second, err := repo.NextSequence(ctx); err != nil || second <= first {
+		t.Errorf("Expected a value after %d, got %d, %v", first, second, err)
+	}
+}
+
+func TestMapPgError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "Duplicate code",
+			err:      &pgconn.PgError{Code: PgUniqueViolation, ConstraintName: "url_records_code_key", Detail: "Key (code)=(abc123) already exists."},
+			expected: ErrDuplicateCode,
+		},
+		{
+			name:     "Duplicate long URL",
+			err:      &pgconn.PgError{Code: PgUniqueViolation, ConstraintName: "url_records_domain_long_url_key", Detail: "Key (domain, long_url)=(, https://example.com/) already exists."},
+			expected: ErrDuplicateLongURL,
+		},
+		{
+			name:     "Code value containing long_url",
+			err:      &pgconn.PgError{Code: PgUniqueViolation, ConstraintName: "url_records_code_key", Detail: "Key (code)=(long_url) already exists."},
+			expected: ErrDuplicateCode,
+		},
+		{
+			name:     "Not found",
+			err:      sql.ErrNoRows,
+			expected: ErrNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := mapPgError(tc.err); !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	other := &pgconn.PgError{Code: "42P01", Message: `relation "url_records" does not exist`}
+	if err := mapPgError(other); err != other {
+		t.Errorf("Expected error to be returned unchanged, got %v", err)
+	}
+}
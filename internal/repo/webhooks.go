@@ -0,0 +1,197 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// WebhookRepo is the outbox of webhook deliveries.
+type WebhookRepo interface {
+	// EnqueueDeliveries stores new pending deliveries, due immediately.
+	EnqueueDeliveries(ctx context.Context, ds []model.WebhookDelivery) error
+	// ClaimDeliveries returns up to limit pending deliveries due at now and
+	// pushes their next attempt out to now+lease, so concurrent workers do
+	// not send the same delivery twice.
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error)
+	// UpdateDelivery records the outcome of an attempt.
+	UpdateDelivery(ctx context.Context, d model.WebhookDelivery) error
+}
+
+const deliveryColumns = `id, endpoint, event, payload, status, attempts, last_status_code, last_error, next_attempt_at, created_at, delivered_at`
+
+func scanDelivery(row rowScanner) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.Endpoint, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &deliveredAt)
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, err
+}
+
+func scanDeliveries(rows *sql.Rows) ([]model.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var ds []model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+func deliveryArgs(ds []model.WebhookDelivery) []any {
+	args := make([]any, 0, len(ds)*4)
+	for _, d := range ds {
+		args = append(args, d.ID, d.Endpoint, d.Event, d.Payload)
+	}
+	return args
+}
+
+const enqueueDeliveries = `INSERT INTO webhook_deliveries (id, endpoint, event, payload)`
+
+func (r *PostgresRepo) EnqueueDeliveries(ctx context.Context, ds []model.WebhookDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, multiInsert(enqueueDeliveries, len(ds), 4, pgPlaceholder), deliveryArgs(ds)...)
+	return err
+}
+
+func (r *PostgresRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	const q = `
+		UPDATE webhook_deliveries SET next_attempt_at=$2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status='pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING ` + deliveryColumns
+
+	rows, err := r.db.QueryContext(ctx, q, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (r *PostgresRepo) UpdateDelivery(ctx context.Context, d model.WebhookDelivery) error {
+	const q = `
+		UPDATE webhook_deliveries
+		SET status=$2, attempts=$3, last_status_code=$4, last_error=$5, next_attempt_at=$6, delivered_at=$7
+		WHERE id=$1`
+
+	res, err := r.db.ExecContext(ctx, q, d.ID, d.Status, d.Attempts, d.LastStatusCode, d.LastError, d.NextAttemptAt, d.DeliveredAt)
+	return affectedOne(res, err)
+}
+
+func (r *MySQLRepo) EnqueueDeliveries(ctx context.Context, ds []model.WebhookDelivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, multiInsert(enqueueDeliveries, len(ds), 4, mysqlPlaceholder), deliveryArgs(ds)...)
+	return err
+}
+
+// ClaimDeliveries locks the due rows in a transaction, as MySQL has no
+// UPDATE ... RETURNING. SKIP LOCKED needs MySQL 8.0 or MariaDB 10.6.
+func (r *MySQLRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	const q = `
+		SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE status='pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, q, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := scanDeliveries(rows)
+	if err != nil || len(ds) == 0 {
+		return nil, err
+	}
+
+	next := now.Add(lease)
+	args := []any{next}
+	for i := range ds {
+		ds[i].NextAttemptAt = next
+		args = append(args, ds[i].ID)
+	}
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ds)), ", ")
+	if _, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at=? WHERE id IN (`+in+`)`, args...); err != nil {
+		return nil, err
+	}
+	return ds, tx.Commit()
+}
+
+func (r *MySQLRepo) UpdateDelivery(ctx context.Context, d model.WebhookDelivery) error {
+	const q = `
+		UPDATE webhook_deliveries
+		SET status=?, attempts=?, last_status_code=?, last_error=?, next_attempt_at=?, delivered_at=?
+		WHERE id=?`
+
+	res, err := r.db.ExecContext(ctx, q, d.Status, d.Attempts, d.LastStatusCode, d.LastError, d.NextAttemptAt, d.DeliveredAt, d.ID)
+	return affectedOne(res, err)
+}
+
+func (r *MemoryRepo) EnqueueDeliveries(ctx context.Context, ds []model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, d := range ds {
+		d.Status = model.DeliveryPending
+		d.NextAttemptAt = now
+		d.CreatedAt = now
+		r.deliveries[d.ID] = d
+	}
+	return nil
+}
+
+func (r *MemoryRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ds []model.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == model.DeliveryPending && !d.NextAttemptAt.After(now) {
+			ds = append(ds, d)
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].NextAttemptAt.Before(ds[j].NextAttemptAt) })
+	if len(ds) > limit {
+		ds = ds[:limit]
+	}
+	for i := range ds {
+		ds[i].NextAttemptAt = now.Add(lease)
+		r.deliveries[ds[i].ID] = ds[i]
+	}
+	return ds, nil
+}
+
+func (r *MemoryRepo) UpdateDelivery(ctx context.Context, d model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deliveries[d.ID]; !ok {
+		return ErrNotFound
+	}
+	r.deliveries[d.ID] = d
+	return nil
+}
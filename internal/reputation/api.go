@@ -0,0 +1,53 @@
+package reputation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// API asks an external reputation service about a host with
+// GET Endpoint?domain=<host>, sending Key as a bearer token when set. The
+// service answers with a Result: {"score": 0-100, "reasons": [...]}.
+type API struct {
+	Endpoint string
+	Key      string
+	Client   *http.Client
+}
+
+func (a *API) Check(ctx context.Context, host string) (Result, error) {
+	u, err := url.Parse(a.Endpoint)
+	if err != nil {
+		return Result{}, fmt.Errorf("reputation api: %w", err)
+	}
+	q := u.Query()
+	q.Set("domain", host)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Result{}, err
+	}
+	if a.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Key)
+	}
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("reputation api: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("reputation api: unexpected status %d", resp.StatusCode)
+	}
+
+	var res Result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return Result{}, fmt.Errorf("reputation api: %w", err)
+	}
+	if res.Score < 0 || res.Score > MaxScore {
+		return Result{}, fmt.Errorf("reputation api: score %d out of range", res.Score)
+	}
+	return res, nil
+}
@@ -0,0 +1,70 @@
+package reputation
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+)
+
+// suspiciousTLDs are top-level domains that abuse trackers find mostly
+// hosting phishing and malware, and the .zip and .mov ones that pass for
+// file names.
+var suspiciousTLDs = map[string]bool{
+	"cf": true, "click": true, "country": true, "ga": true, "gq": true,
+	"kim": true, "ml": true, "mov": true, "tk": true, "top": true,
+	"work": true, "xyz": true, "zip": true,
+}
+
+// Heuristics scores a host from its name alone, without any lookups.
+type Heuristics struct{}
+
+func (Heuristics) Check(ctx context.Context, host string) (Result, error) {
+	res := Result{Score: MaxScore}
+	penalize := func(points int, reason string) {
+		res.Score -= points
+		res.Reasons = append(res.Reasons, reason)
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		penalize(40, "an IP address instead of a domain name")
+		return res, nil
+	}
+
+	labels := strings.Split(host, ".")
+	if suspiciousTLDs[labels[len(labels)-1]] {
+		penalize(25, "a top-level domain often used for abuse")
+	}
+	var punycode bool
+	var hyphens int
+	for _, l := range labels {
+		if strings.HasPrefix(l, "xn--") {
+			punycode = true
+			l = l[len("xn--"):]
+		}
+		hyphens += strings.Count(l, "-")
+	}
+	if punycode {
+		penalize(25, "an internationalized name that can imitate another")
+	}
+	if len(labels) > 4 {
+		penalize(15, "deeply nested subdomains")
+	}
+	if hyphens >= 3 {
+		penalize(10, "many hyphens")
+	}
+	if len(host) > 50 {
+		penalize(10, "a very long name")
+	}
+	var digits int
+	for _, r := range labels[0] {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if digits >= 5 {
+		penalize(10, "a name made up mostly of digits")
+	}
+	res.Score = max(res.Score, 0)
+	return res, nil
+}
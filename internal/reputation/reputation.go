@@ -0,0 +1,67 @@
+// Package reputation scores the domains new links point at, from 0 for
+// certainly malicious to 100 for nothing suspicious, so that links to
+// doubtful domains can wait for an operator before they redirect.
+package reputation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+// MaxScore is the score of a domain nothing counts against.
+const MaxScore = 100
+
+// Result is a domain's score and what it lost points for.
+type Result struct {
+	Score   int      `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Checker scores the reputation of a host name or IP address.
+type Checker interface {
+	Check(ctx context.Context, host string) (Result, error)
+}
+
+// New builds a checker from the configuration: the local heuristics, and
+// the external API when one is set. It returns nil when reputation scoring
+// is off.
+func New(cfg config.Config) Checker {
+	if cfg.ReputationThreshold == 0 {
+		return nil
+	}
+	if cfg.ReputationAPIURL == "" {
+		return Heuristics{}
+	}
+	return Multi{Heuristics{}, &API{
+		Endpoint: cfg.ReputationAPIURL,
+		Key:      cfg.ReputationAPIKey,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}}
+}
+
+// Multi gives a host the lowest score any of its checkers does, with all
+// of their reasons.
+type Multi []Checker
+
+func (m Multi) Check(ctx context.Context, host string) (Result, error) {
+	out := Result{Score: MaxScore}
+	var errs []error
+	for _, c := range m {
+		res, err := c.Check(ctx, host)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out.Score = min(out.Score, res.Score)
+		out.Reasons = append(out.Reasons, res.Reasons...)
+	}
+	// As with scanners, some verdicts beat none.
+	if len(errs) == len(m) {
+		return Result{}, errors.Join(errs...)
+	}
+	return out, nil
+}
@@ -0,0 +1,80 @@
+package reputation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeuristics_Check(t *testing.T) {
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"example.com", 100},
+		{"www.example.co.uk", 100},
+		{"192.0.2.10", 60},
+		{"[2001:db8::1]", 60},
+		{"free-prize.tk", 75},
+		{"xn--pypal-4ve.com", 75},
+		{"login.secure.account.bank.example.com", 85},
+		{"secure-login-verify-account.example.com", 90},
+		{"login.secure.account-update-verify-now.bank.example.xyz", 40},
+	}
+	for _, tt := range tests {
+		res, err := Heuristics{}.Check(context.Background(), tt.host)
+		if err != nil || res.Score != tt.want {
+			t.Errorf("%s: expected score %d, got %d %v (%v)", tt.host, tt.want, res.Score, res.Reasons, err)
+		}
+		if res.Score < MaxScore && len(res.Reasons) == 0 {
+			t.Errorf("%s: expected reasons for the lost points", tt.host)
+		}
+	}
+}
+
+func TestAPI_Check(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("expected a bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Query().Get("domain") {
+		case "bad.example":
+			w.Write([]byte(`{"score":10,"reasons":["newly registered"]}`))
+		case "broken.example":
+			w.Write([]byte(`{"score":250}`))
+		default:
+			w.Write([]byte(`{"score":95}`))
+		}
+	}))
+	defer srv.Close()
+
+	api := &API{Endpoint: srv.URL + "/v1/domains?format=json", Key: "test-key", Client: srv.Client()}
+	res, err := api.Check(context.Background(), "bad.example")
+	if err != nil || res.Score != 10 || len(res.Reasons) != 1 {
+		t.Errorf("expected score 10 for one reason, got %+v (%v)", res, err)
+	}
+	if _, err := api.Check(context.Background(), "broken.example"); err == nil {
+		t.Error("expected an out of range score to fail")
+	}
+}
+
+type fixed struct {
+	res Result
+	err error
+}
+
+func (f fixed) Check(ctx context.Context, host string) (Result, error) { return f.res, f.err }
+
+func TestMulti_Check(t *testing.T) {
+	down := fixed{err: errors.New("connection refused")}
+	m := Multi{fixed{res: Result{Score: 80, Reasons: []string{"a"}}}, fixed{res: Result{Score: 30, Reasons: []string{"b"}}}, down}
+	res, err := m.Check(context.Background(), "example.com")
+	if err != nil || res.Score != 30 || len(res.Reasons) != 2 {
+		t.Errorf("expected the lowest score with every reason, got %+v (%v)", res, err)
+	}
+	if _, err := (Multi{down, down}).Check(context.Background(), "example.com"); err == nil {
+		t.Error("expected an error when every checker fails")
+	}
+}
@@ -0,0 +1,102 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const safeBrowsingEndpoint = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+
+// safeBrowsingBatch is the API's limit on threat entries per request.
+const safeBrowsingBatch = 500
+
+// SafeBrowsing queries the Google Safe Browsing v4 Lookup API.
+type SafeBrowsing struct {
+	APIKey   string
+	Client   *http.Client
+	Endpoint string // overrides safeBrowsingEndpoint, for tests
+}
+
+type sbEntry struct {
+	URL string `json:"url"`
+}
+
+type sbRequest struct {
+	Client struct {
+		ClientID      string `json:"clientId"`
+		ClientVersion string `json:"clientVersion"`
+	} `json:"client"`
+	ThreatInfo struct {
+		ThreatTypes      []string  `json:"threatTypes"`
+		PlatformTypes    []string  `json:"platformTypes"`
+		ThreatEntryTypes []string  `json:"threatEntryTypes"`
+		ThreatEntries    []sbEntry `json:"threatEntries"`
+	} `json:"threatInfo"`
+}
+
+type sbResponse struct {
+	Matches []struct {
+		Threat sbEntry `json:"threat"`
+	} `json:"matches"`
+}
+
+func (s *SafeBrowsing) Check(ctx context.Context, urls []string) (map[string]bool, error) {
+	flagged := make(map[string]bool)
+	for start := 0; start < len(urls); start += safeBrowsingBatch {
+		end := min(start+safeBrowsingBatch, len(urls))
+		if err := s.check(ctx, urls[start:end], flagged); err != nil {
+			return nil, err
+		}
+	}
+	return flagged, nil
+}
+
+func (s *SafeBrowsing) check(ctx context.Context, urls []string, flagged map[string]bool) error {
+	var body sbRequest
+	body.Client.ClientID = "shawty"
+	body.Client.ClientVersion = "1.0"
+	body.ThreatInfo.ThreatTypes = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, u := range urls {
+		body.ThreatInfo.ThreatEntries = append(body.ThreatInfo.ThreatEntries, sbEntry{URL: u})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = safeBrowsingEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"?key="+url.QueryEscape(s.APIKey), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("safe browsing: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("safe browsing: unexpected status %d", resp.StatusCode)
+	}
+
+	var out sbResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("safe browsing: %w", err)
+	}
+	for _, m := range out.Matches {
+		flagged[m.Threat.URL] = true
+	}
+	return nil
+}
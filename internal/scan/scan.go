@@ -0,0 +1,68 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+// Scan states stored on a record.
+const (
+	StatusUnchecked = "unchecked"
+	StatusClean     = "clean"
+	StatusFlagged   = "flagged"
+)
+
+// Scanner checks destination URLs against malware/phishing feeds. Check
+// returns the subset of urls that are flagged.
+type Scanner interface {
+	Check(ctx context.Context, urls []string) (map[string]bool, error)
+}
+
+// New builds a scanner from the configured providers, or returns nil when none
+// are enabled.
+func New(cfg config.Config) Scanner {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var scanners Multi
+	if cfg.SafeBrowsingAPIKey != "" {
+		scanners = append(scanners, &SafeBrowsing{APIKey: cfg.SafeBrowsingAPIKey, Client: client})
+	}
+	if cfg.URLhausAuthKey != "" {
+		scanners = append(scanners, &URLhaus{AuthKey: cfg.URLhausAuthKey, Client: client})
+	}
+
+	switch len(scanners) {
+	case 0:
+		return nil
+	case 1:
+		return scanners[0]
+	}
+	return scanners
+}
+
+// Multi flags a URL when any of its scanners does.
+type Multi []Scanner
+
+func (m Multi) Check(ctx context.Context, urls []string) (map[string]bool, error) {
+	flagged := make(map[string]bool)
+	var errs []error
+	for _, s := range m {
+		res, err := s.Check(ctx, urls)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for u := range res {
+			flagged[u] = true
+		}
+	}
+	// Partial results are still useful, but a failure of every provider is not.
+	if len(errs) == len(m) {
+		return nil, errors.Join(errs...)
+	}
+	return flagged, nil
+}
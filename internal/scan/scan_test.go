@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSafeBrowsing_Check(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "test-key" {
+			t.Errorf("expected API key in query, got %q", r.URL.RawQuery)
+		}
+
+		var req sbRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("bad request body: %v", err)
+		}
+		if len(req.ThreatInfo.ThreatEntries) != 2 {
+			t.Errorf("expected 2 threat entries, got %d", len(req.ThreatInfo.ThreatEntries))
+		}
+
+		w.Write([]byte(`{"matches":[{"threatType":"MALWARE","threat":{"url":"https://malware.example/"}}]}`))
+	}))
+	defer srv.Close()
+
+	sb := &SafeBrowsing{APIKey: "test-key", Client: srv.Client(), Endpoint: srv.URL}
+	flagged, err := sb.Check(context.Background(), []string{"https://malware.example/", "https://example.com/"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !flagged["https://malware.example/"] || flagged["https://example.com/"] {
+		t.Errorf("unexpected verdicts: %v", flagged)
+	}
+}
+
+func TestURLhaus_Check(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Auth-Key") != "test-key" {
+			t.Errorf("expected Auth-Key header, got %q", r.Header.Get("Auth-Key"))
+		}
+		switch r.FormValue("url") {
+		case "https://malware.example/":
+			w.Write([]byte(`{"query_status":"ok","url_status":"online"}`))
+		case "https://gone.example/":
+			w.Write([]byte(`{"query_status":"ok","url_status":"offline"}`))
+		default:
+			w.Write([]byte(`{"query_status":"no_results"}`))
+		}
+	}))
+	defer srv.Close()
+
+	uh := &URLhaus{AuthKey: "test-key", Client: srv.Client(), Endpoint: srv.URL}
+	flagged, err := uh.Check(context.Background(), []string{"https://malware.example/", "https://gone.example/", "https://example.com/"})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(flagged) != 1 || !flagged["https://malware.example/"] {
+		t.Errorf("unexpected verdicts: %v", flagged)
+	}
+}
+
+type stubScanner struct {
+	flagged map[string]bool
+	err     error
+}
+
+func (s stubScanner) Check(ctx context.Context, urls []string) (map[string]bool, error) {
+	return s.flagged, s.err
+}
+
+func TestMulti_Check(t *testing.T) {
+	m := Multi{
+		stubScanner{flagged: map[string]bool{"https://a.example/": true}},
+		stubScanner{err: errors.New("down")},
+		stubScanner{flagged: map[string]bool{"https://b.example/": true}},
+	}
+	flagged, err := m.Check(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("expected partial results, got error %v", err)
+	}
+	if !flagged["https://a.example/"] || !flagged["https://b.example/"] {
+		t.Errorf("expected union of verdicts, got %v", flagged)
+	}
+
+	all := Multi{stubScanner{err: errors.New("down")}, stubScanner{err: errors.New("down")}}
+	if _, err := all.Check(context.Background(), nil); err == nil {
+		t.Error("expected error when every scanner fails")
+	}
+}
@@ -0,0 +1,63 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const urlhausEndpoint = "https://urlhaus-api.abuse.ch/v1/url/"
+
+// URLhaus queries the abuse.ch URLhaus database, one URL per request.
+type URLhaus struct {
+	AuthKey  string
+	Client   *http.Client
+	Endpoint string // overrides urlhausEndpoint, for tests
+}
+
+type urlhausResponse struct {
+	QueryStatus string `json:"query_status"`
+	URLStatus   string `json:"url_status"`
+}
+
+func (s *URLhaus) Check(ctx context.Context, urls []string) (map[string]bool, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = urlhausEndpoint
+	}
+
+	flagged := make(map[string]bool)
+	for _, u := range urls {
+		form := url.Values{"url": {u}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Auth-Key", s.AuthKey)
+
+		resp, err := s.Client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("urlhaus: %w", err)
+		}
+
+		var out urlhausResponse
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("urlhaus: unexpected status %d", resp.StatusCode)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("urlhaus: %w", err)
+		}
+
+		// Listed URLs whose payload host has gone offline are no longer a threat.
+		if out.QueryStatus == "ok" && out.URLStatus != "offline" {
+			flagged[u] = true
+		}
+	}
+	return flagged, nil
+}
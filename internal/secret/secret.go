@@ -0,0 +1,180 @@
+// Package secret fetches the secrets settings refer to instead of holding
+// them in plain text. A reference is one of
+//
+//	file:/run/secrets/db_password        a file, such as a Docker secret
+//	vault:secret/data/shawty#password    a field of a HashiCorp Vault secret
+//	awssm:prod/shawty#password           an AWS Secrets Manager secret, or a
+//	                                     field of one holding a JSON object
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Schemes of references.
+const (
+	File  = "file"
+	Vault = "vault"
+	AWS   = "awssm"
+)
+
+// IsRef reports whether value refers to a secret rather than being one.
+func IsRef(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	return ok && (scheme == File || scheme == Vault || scheme == AWS)
+}
+
+// Resolver fetches the secrets references name. Each Vault and AWS secret is
+// fetched once, however many of its fields are asked for, so a Resolver
+// should not outlive one reading of the configuration.
+type Resolver struct {
+	// VaultAddr and VaultToken reach Vault's HTTP API, as VAULT_ADDR and
+	// VAULT_TOKEN do for its CLI.
+	VaultAddr  string
+	VaultToken string
+	Client     *http.Client
+
+	aws     *secretsmanager.Client
+	fetched map[string]any
+}
+
+func NewResolver(vaultAddr, vaultToken string) *Resolver {
+	return &Resolver{
+		VaultAddr:  strings.TrimSuffix(vaultAddr, "/"),
+		VaultToken: vaultToken,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		fetched:    make(map[string]any),
+	}
+}
+
+// Resolve returns the secret ref refers to.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	scheme, rest, _ := strings.Cut(ref, ":")
+	name, field, _ := strings.Cut(rest, "#")
+	if name == "" {
+		return "", fmt.Errorf("secret: %q names no secret", ref)
+	}
+
+	switch scheme {
+	case File:
+		b, err := os.ReadFile(rest)
+		if err != nil {
+			return "", fmt.Errorf("secret: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case Vault:
+		if field == "" {
+			return "", fmt.Errorf("secret: %q names no field; Vault secrets hold several", ref)
+		}
+		data, err := r.fetch(ctx, Vault, name, r.vault)
+		if err != nil {
+			return "", err
+		}
+		return pick(ref, data, field)
+	case AWS:
+		data, err := r.fetch(ctx, AWS, name, r.secretsManager)
+		if err != nil {
+			return "", err
+		}
+		s := data.(string)
+		if field == "" {
+			return s, nil
+		}
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(s), &fields); err != nil {
+			return "", fmt.Errorf("secret: %q: %s is not a JSON object", ref, name)
+		}
+		return pick(ref, fields, field)
+	}
+	return "", fmt.Errorf("secret: unknown reference %q", ref)
+}
+
+// fetch returns what get fetches for name, asking only once.
+func (r *Resolver) fetch(ctx context.Context, scheme, name string, get func(context.Context, string) (any, error)) (any, error) {
+	key := scheme + ":" + name
+	if v, ok := r.fetched[key]; ok {
+		return v, nil
+	}
+	v, err := get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	r.fetched[key] = v
+	return v, nil
+}
+
+// pick returns the field of a secret's fields, which must be text.
+func pick(ref string, fields any, field string) (string, error) {
+	m, _ := fields.(map[string]any)
+	v, ok := m[field]
+	if !ok {
+		return "", fmt.Errorf("secret: %q: no field %s", ref, field)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("secret: %q: field %s is not text", ref, field)
+	}
+	return s, nil
+}
+
+// vault reads the secret at path, whose fields are under data, or under
+// data.data in version 2 key/value engines.
+func (r *Resolver) vault(ctx context.Context, path string) (any, error) {
+	if r.VaultAddr == "" {
+		return nil, fmt.Errorf("secret: vault:%s needs VAULT_ADDR", path)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.VaultAddr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", r.VaultToken)
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secret: vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secret: vault:%s: unexpected status %d", path, resp.StatusCode)
+	}
+	var out struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("secret: vault: %w", err)
+	}
+	if inner, ok := out.Data["data"].(map[string]any); ok && out.Data["metadata"] != nil {
+		return inner, nil
+	}
+	return out.Data, nil
+}
+
+// secretsManager reads the text of the secret with id, with credentials and
+// region found the usual AWS way.
+func (r *Resolver) secretsManager(ctx context.Context, id string) (any, error) {
+	if r.aws == nil {
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("secret: aws: %w", err)
+		}
+		r.aws = secretsmanager.NewFromConfig(awsCfg)
+	}
+	out, err := r.aws.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &id})
+	if err != nil {
+		return nil, fmt.Errorf("secret: awssm:%s: %w", id, err)
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("secret: awssm:%s holds binary data", id)
+	}
+	return *out.SecretString, nil
+}
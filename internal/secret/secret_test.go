@@ -0,0 +1,125 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsRef(t *testing.T) {
+	for value, want := range map[string]bool{
+		"file:/run/secrets/db":  true,
+		"vault:secret/shawty#a": true,
+		"awssm:prod/shawty":     true,
+		"hunter2":               false,
+		"redis://localhost":     false,
+		"https://example.com/":  false,
+	} {
+		if got := IsRef(value); got != want {
+			t.Errorf("IsRef(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestResolve_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	os.WriteFile(path, []byte("s3cret\n"), 0o600)
+
+	r := NewResolver("", "")
+	if got, err := r.Resolve(context.Background(), "file:"+path); err != nil || got != "s3cret" {
+		t.Errorf("Expected the file without its newline, got %q (%v)", got, err)
+	}
+	if _, err := r.Resolve(context.Background(), "file:"+path+".missing"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestResolve_Vault(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/shawty":
+			w.Write([]byte(`{"data":{"data":{"user":"shawty","password":"s3cret"},"metadata":{"version":3}}}`))
+		case "/v1/kv/shawty":
+			w.Write([]byte(`{"data":{"password":"old"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	r := NewResolver(srv.URL+"/", "root")
+	for ref, want := range map[string]string{
+		"vault:secret/data/shawty#user":     "shawty",
+		"vault:secret/data/shawty#password": "s3cret",
+		"vault:kv/shawty#password":          "old",
+	} {
+		if got, err := r.Resolve(ctx, ref); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected each secret fetched once, got %d requests", requests)
+	}
+
+	for _, ref := range []string{"vault:secret/data/shawty", "vault:secret/data/shawty#token", "vault:secret/data/missing#user"} {
+		if _, err := r.Resolve(ctx, ref); err == nil {
+			t.Errorf("Expected an error for %q", ref)
+		}
+	}
+	if _, err := NewResolver(srv.URL, "wrong").Resolve(ctx, "vault:secret/data/shawty#user"); err == nil {
+		t.Error("Expected an error for a token Vault refuses")
+	}
+	if _, err := NewResolver("", "root").Resolve(ctx, "vault:secret/data/shawty#user"); err == nil || !strings.Contains(err.Error(), "VAULT_ADDR") {
+		t.Errorf("Expected an error asking for VAULT_ADDR, got %v", err)
+	}
+}
+
+func TestResolve_SecretsManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&in)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch in.SecretId {
+		case "prod/shawty":
+			json.NewEncoder(w).Encode(map[string]string{"Name": in.SecretId, "SecretString": `{"password":"s3cret"}`})
+		case "prod/salt":
+			json.NewEncoder(w).Encode(map[string]string{"Name": in.SecretId, "SecretString": "pepper"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", srv.URL)
+	t.Setenv("AWS_REGION", "eu-north-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	ctx := context.Background()
+	r := NewResolver("", "")
+	if got, err := r.Resolve(ctx, "awssm:prod/shawty#password"); err != nil || got != "s3cret" {
+		t.Errorf("Expected a field of the JSON secret, got %q (%v)", got, err)
+	}
+	if got, err := r.Resolve(ctx, "awssm:prod/salt"); err != nil || got != "pepper" {
+		t.Errorf("Expected the whole secret, got %q (%v)", got, err)
+	}
+	for _, ref := range []string{"awssm:prod/salt#password", "awssm:prod/missing"} {
+		if _, err := r.Resolve(ctx, ref); err == nil {
+			t.Errorf("Expected an error for %q", ref)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/util"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidDomain is returned when banning something that is not a host name.
+	ErrInvalidDomain = errors.New("Invalid domain")
+	// ErrInvalidCode is returned when importing a code that cannot be served
+	// or is reserved.
+	ErrInvalidCode = errors.New("Invalid or reserved code")
+	// ErrCodeTaken is returned when importing a code that is already in use.
+	ErrCodeTaken = errors.New("Code is already taken")
+	// ErrURLTaken is returned when importing a URL that already has a link on
+	// the domain.
+	ErrURLTaken = errors.New("URL is already shortened on this domain")
+	// ErrInvalidReason is returned for takedown reasons other than
+	// model.TakedownReasons.
+	ErrInvalidReason = errors.New("Invalid takedown reason")
+)
+
+// Admin is the operator's view of the service: every link regardless of
+// owner, service-wide stats, the banned domain list and the audit log.
+// Changes are recorded in the audit log under actor, the caller.
+type Admin interface {
+	ListLinks(ctx context.Context, limit, offset int) ([]model.URLRecord, error)
+	// DeleteLink removes any link for good.
+	DeleteLink(ctx context.Context, actor, code string) error
+	Stats(ctx context.Context) (model.Stats, error)
+	// BanDomain stops new links to domain and its subdomains. Existing links
+	// are left alone.
+	BanDomain(ctx context.Context, actor, domain, reason string) (model.BannedDomain, error)
+	UnbanDomain(ctx context.Context, actor, domain string) error
+	BannedDomains(ctx context.Context) ([]model.BannedDomain, error)
+	// ImportLink stores a link exported from elsewhere under its original
+	// code, with opts' Owner and Domain. Its URL must already be validated.
+	// It fails with ErrInvalidCode, ErrCodeTaken, ErrURLTaken or ErrBanned.
+	ImportLink(ctx context.Context, actor, baseURL string, link model.ImportLink, opts LinkOptions) (model.URLRecord, error)
+	// EraseOwner deletes everything stored about owner at the request of
+	// actor, including links a migration has not copied yet, and publishes a
+	// user.erased event recording it.
+	EraseOwner(ctx context.Context, actor, owner string) (model.Erasure, error)
+	// TakeDown disables any link for reason, one of model.TakedownReasons,
+	// and publishes a link.taken_down event so its owner hears of it. The
+	// owner cannot enable it again until LiftTakedown.
+	TakeDown(ctx context.Context, actor, code, reason, note string) (model.Takedown, error)
+	// LiftTakedown enables a taken down link again.
+	LiftTakedown(ctx context.Context, actor, code string) (model.URLRecord, error)
+	// ListReviews returns the links held for their destination's
+	// reputation, oldest first.
+	ListReviews(ctx context.Context, limit, offset int) ([]model.Review, error)
+	// ApproveReview releases a held link, enabling it.
+	ApproveReview(ctx context.Context, actor, code string) (model.URLRecord, error)
+	// RejectReview deletes a held link for good.
+	RejectReview(ctx context.Context, actor, code string) error
+	// PurgeClicks deletes a link's click history, keeping the link.
+	PurgeClicks(ctx context.Context, actor, code string) (int, error)
+	// AuditLog lists the audit entries matching filter, newest first.
+	AuditLog(ctx context.Context, filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, error)
+}
+
+type admin struct {
+	links    repo.URLRepo
+	repo     repo.AdminRepo
+	reserved util.Reserved
+	events   EventPublisher
+	codes    CodeStatser
+	audit    repo.AuditRepo
+}
+
+// NewAdmin returns the operator service. Imported codes must stay clear of
+// reserved; events and codes may be nil, and so may audit, leaving the audit
+// log empty.
+func NewAdmin(links repo.URLRepo, r repo.AdminRepo, reserved util.Reserved, events EventPublisher, codes CodeStatser, audit repo.AuditRepo) Admin {
+	return &admin{links: links, repo: r, reserved: reserved, events: events, codes: codes, audit: audit}
+}
+
+func (a *admin) ListLinks(ctx context.Context, limit, offset int) ([]model.URLRecord, error) {
+	return a.repo.ListAll(ctx, limit, offset)
+}
+
+func (a *admin) DeleteLink(ctx context.Context, actor, code string) error {
+	rec, err := a.links.GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if err := a.links.Delete(ctx, code); err != nil {
+		return err
+	}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventLinkDeleted, rec)
+	}
+	recordAudit(ctx, a.audit, model.EventLinkDeleted, actor, code, &rec, nil)
+	return nil
+}
+
+func (a *admin) TakeDown(ctx context.Context, actor, code, reason, note string) (model.Takedown, error) {
+	if !slices.Contains(model.TakedownReasons, reason) {
+		return model.Takedown{}, ErrInvalidReason
+	}
+	before, err := a.links.GetByCode(ctx, code)
+	if err != nil {
+		return model.Takedown{}, err
+	}
+	// Recorded first, so visitors never find the link disabled without the
+	// reason.
+	t, err := a.repo.AddTakedown(ctx, model.Takedown{Code: code, Owner: before.Owner, Reason: reason, Note: note, By: actor})
+	if err != nil {
+		return model.Takedown{}, err
+	}
+	rec, err := a.links.SetActive(ctx, code, false)
+	if err != nil {
+		return model.Takedown{}, err
+	}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventLinkTakenDown, t)
+	}
+	recordAudit(ctx, a.audit, model.EventLinkTakenDown, actor, code, &before, &rec)
+	return t, nil
+}
+
+func (a *admin) LiftTakedown(ctx context.Context, actor, code string) (model.URLRecord, error) {
+	before, err := a.links.GetByCode(ctx, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if err := a.repo.RemoveTakedown(ctx, code); err != nil {
+		return model.URLRecord{}, err
+	}
+	rec, err := a.links.SetActive(ctx, code, true)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventLinkEnabled, rec)
+	}
+	recordAudit(ctx, a.audit, model.AuditTakedownLifted, actor, code, &before, &rec)
+	return rec, nil
+}
+
+func (a *admin) ListReviews(ctx context.Context, limit, offset int) ([]model.Review, error) {
+	return a.repo.ListReviews(ctx, limit, offset)
+}
+
+func (a *admin) ApproveReview(ctx context.Context, actor, code string) (model.URLRecord, error) {
+	before, err := a.links.GetByCode(ctx, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if err := a.repo.RemoveReview(ctx, code); err != nil {
+		return model.URLRecord{}, err
+	}
+	rec, err := a.links.SetActive(ctx, code, true)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventLinkEnabled, rec)
+	}
+	recordAudit(ctx, a.audit, model.AuditReviewApproved, actor, code, &before, &rec)
+	return rec, nil
+}
+
+func (a *admin) RejectReview(ctx context.Context, actor, code string) error {
+	if err := a.repo.RemoveReview(ctx, code); err != nil {
+		return err
+	}
+	rec, err := a.links.GetByCode(ctx, code)
+	if errors.Is(err, ErrNotFound) {
+		// Its owner deleted it while it waited.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.links.Delete(ctx, code); err != nil {
+		return err
+	}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventLinkDeleted, rec)
+	}
+	recordAudit(ctx, a.audit, model.AuditReviewRejected, actor, code, &rec, nil)
+	return nil
+}
+
+func (a *admin) EraseOwner(ctx context.Context, actor, owner string) (model.Erasure, error) {
+	// The codes are read before the erase takes them out of the store. While
+	// links migrate they come from the old backend, which a.repo never sees,
+	// so they are also deleted through a.links.
+	codes, err := repo.OwnerCodes(ctx, a.links, owner)
+	if err != nil {
+		return model.Erasure{}, err
+	}
+	links, clicks, err := a.repo.EraseOwner(ctx, owner)
+	if err != nil {
+		return model.Erasure{}, err
+	}
+	for _, code := range codes {
+		if err := a.links.Delete(repo.AllTenants(ctx), code); err != nil && !errors.Is(err, repo.ErrNotFound) {
+			return model.Erasure{}, err
+		}
+	}
+	// Links not yet copied to the new backend were only in the old one.
+	links = max(links, len(codes))
+	e := model.Erasure{Owner: owner, By: actor, Links: links, Clicks: clicks, ErasedAt: time.Now().UTC()}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventUserErased, e)
+	}
+	recordAudit(ctx, a.audit, model.EventUserErased, actor, owner, nil, nil)
+	return e, nil
+}
+
+func (a *admin) PurgeClicks(ctx context.Context, actor, code string) (int, error) {
+	n, err := a.repo.PurgeClicks(ctx, code)
+	if err == nil {
+		recordAudit(ctx, a.audit, model.AuditClicksPurged, actor, code, nil, nil)
+	}
+	return n, err
+}
+
+func (a *admin) AuditLog(ctx context.Context, filter model.AuditFilter, limit, offset int) ([]model.AuditEntry, error) {
+	if a.audit == nil {
+		return nil, nil
+	}
+	return a.audit.ListAudit(ctx, filter, limit, offset)
+}
+
+func (a *admin) Stats(ctx context.Context) (model.Stats, error) {
+	stats, err := a.repo.Stats(ctx, time.Now())
+	if err == nil && a.codes != nil {
+		codes := a.codes.CodeStats()
+		stats.Codes = &codes
+	}
+	return stats, err
+}
+
+func (a *admin) BanDomain(ctx context.Context, actor, domain, reason string) (model.BannedDomain, error) {
+	domain, ok := normalizeDomain(domain)
+	if !ok {
+		return model.BannedDomain{}, ErrInvalidDomain
+	}
+	ban, err := a.repo.BanDomain(ctx, model.BannedDomain{Domain: domain, Reason: reason})
+	if err == nil {
+		recordAudit(ctx, a.audit, model.AuditDomainBanned, actor, domain, nil, nil)
+	}
+	return ban, err
+}
+
+func (a *admin) UnbanDomain(ctx context.Context, actor, domain string) error {
+	domain, ok := normalizeDomain(domain)
+	if !ok {
+		return ErrInvalidDomain
+	}
+	err := a.repo.UnbanDomain(ctx, domain)
+	if err == nil {
+		recordAudit(ctx, a.audit, model.AuditDomainUnbanned, actor, domain, nil, nil)
+	}
+	return err
+}
+
+func (a *admin) BannedDomains(ctx context.Context) ([]model.BannedDomain, error) {
+	return a.repo.ListBannedDomains(ctx)
+}
+
+func (a *admin) ImportLink(ctx context.Context, actor, baseURL string, link model.ImportLink, opts LinkOptions) (model.URLRecord, error) {
+	if !util.ValidCode(link.Code) || a.reserved.Contains(link.Code) {
+		return model.URLRecord{}, ErrInvalidCode
+	}
+	if err := checkBan(ctx, a.repo, link.LongURL); err != nil {
+		return model.URLRecord{}, err
+	}
+
+	in := model.URLRecord{
+		ID:       uuid.New().String(),
+		Code:     link.Code,
+		LongUrl:  link.LongURL,
+		ShortUrl: baseURL + link.Code,
+		Owner:    opts.Owner,
+		Domain:   opts.Domain,
+	}
+	if link.CreatedAt != nil {
+		in.CreatedAt = *link.CreatedAt
+	}
+
+	// Imported links are left unchecked for the rescan job, so a large
+	// import does not wait on the scanners.
+	rec, err := a.links.Insert(ctx, in)
+	switch {
+	case errors.Is(err, repo.ErrDuplicateCode):
+		return model.URLRecord{}, ErrCodeTaken
+	case errors.Is(err, repo.ErrDuplicateLongURL):
+		return model.URLRecord{}, ErrURLTaken
+	case err != nil:
+		return model.URLRecord{}, err
+	}
+	if a.events != nil {
+		a.events.Publish(ctx, model.EventLinkCreated, rec)
+	}
+	recordAudit(ctx, a.audit, model.AuditLinkImported, actor, rec.Code, nil, &rec)
+	return rec, nil
+}
+
+// normalizeDomain lower-cases a host name and rejects anything else, such as
+// URLs or host:port pairs.
+func normalizeDomain(domain string) (string, bool) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || len(domain) > 253 || strings.HasPrefix(domain, ".") || strings.Contains(domain, "..") {
+		return "", false
+	}
+	for _, r := range domain {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return "", false
+		}
+	}
+	return domain, true
+}
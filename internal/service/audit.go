@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// WithAudit records every change to a link in r.
+func WithAudit(r repo.AuditRepo) Option {
+	return func(s *shortener) { s.audit = r }
+}
+
+// recordAudit appends an entry to r, which may be nil. The change has already
+// been made by then, so a failure is logged rather than returned.
+func recordAudit(ctx context.Context, r repo.AuditRepo, action, actor, subject string, before, after *model.URLRecord) {
+	if r == nil {
+		return
+	}
+	entry := model.AuditEntry{Action: action, Actor: actor, Subject: subject, Before: before, After: after}
+	if err := r.InsertAudit(ctx, entry); err != nil {
+		log.Printf("audit: %s %s by %q: %v", action, subject, actor, err)
+	}
+}
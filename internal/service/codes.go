@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/util"
+)
+
+// codeLengthSetting is the setting AdaptiveCodes keeps its length in.
+const codeLengthSetting = "code_length"
+
+// maxAdaptiveLength bounds how long AdaptiveCodes lets codes grow.
+const maxAdaptiveLength = 16
+
+// collisionObserver is told, after each attempt to store a link, whether its
+// code was already taken.
+type collisionObserver interface {
+	Observe(ctx context.Context, collided bool)
+}
+
+// CodeStatser reports on code generation for the admin stats.
+type CodeStatser interface {
+	CodeStats() model.CodeStats
+}
+
+// AdaptiveCodes makes random codes and adds a character whenever too many of
+// them collide with existing ones. Collisions are counted in windows of
+// window attempts; a window whose collision rate exceeds threshold lengthens
+// codes from then on. The length is stored as a setting, so a restarted
+// server resumes at it rather than at the configured minimum.
+type AdaptiveCodes struct {
+	settings  repo.SettingsRepo
+	threshold float64
+	window    int
+
+	mu         sync.Mutex
+	length     int
+	attempts   int // in the current window
+	collisions int
+	stats      model.CodeStats
+}
+
+// NewAdaptiveCodes starts at the stored length, or at minLength when none
+// is stored yet or it is shorter.
+func NewAdaptiveCodes(ctx context.Context, settings repo.SettingsRepo, minLength int, threshold float64, window int) *AdaptiveCodes {
+	g := &AdaptiveCodes{settings: settings, threshold: threshold, window: window, length: max(minLength, 1)}
+	v, err := settings.GetSetting(ctx, codeLengthSetting)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		log.Printf("code length: %v", err)
+	default:
+		if n, err := strconv.Atoi(v); err == nil && n > g.length {
+			g.length = min(n, maxAdaptiveLength)
+		}
+	}
+	return g
+}
+
+func (g *AdaptiveCodes) Generate(ctx context.Context, domain, long string, attempt int) (string, error) {
+	g.mu.Lock()
+	length := g.length
+	g.mu.Unlock()
+	return util.RandomCodes{Length: length}.Generate(ctx, domain, long, attempt)
+}
+
+func (g *AdaptiveCodes) Observe(ctx context.Context, collided bool) {
+	g.mu.Lock()
+	g.attempts++
+	g.stats.Attempts++
+	if collided {
+		g.collisions++
+		g.stats.Collisions++
+	}
+	if g.attempts < g.window {
+		g.mu.Unlock()
+		return
+	}
+	grow := float64(g.collisions)/float64(g.attempts) > g.threshold && g.length < maxAdaptiveLength
+	g.attempts, g.collisions = 0, 0
+	if grow {
+		g.length++
+	}
+	length := g.length
+	g.mu.Unlock()
+
+	if grow {
+		log.Printf("code length: collision rate above %g, now making %d-character codes", g.threshold, length)
+		if err := g.settings.PutSetting(ctx, codeLengthSetting, strconv.Itoa(length)); err != nil {
+			log.Printf("code length: %v", err)
+		}
+	}
+}
+
+func (g *AdaptiveCodes) CodeStats() model.CodeStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.stats
+	s.Length = g.length
+	if s.Attempts > 0 {
+		s.CollisionRate = float64(s.Collisions) / float64(s.Attempts)
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestAdaptiveCodes(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	g := NewAdaptiveCodes(ctx, r, 6, 0.5, 4)
+
+	if code, _ := g.Generate(ctx, "", "https://example.com/", 0); len(code) != 6 {
+		t.Fatalf("Expected a 6-character code, got %q", code)
+	}
+
+	// Half the window colliding is not above the threshold.
+	for _, collided := range []bool{true, true, false, false} {
+		g.Observe(ctx, collided)
+	}
+	if n := g.CodeStats().Length; n != 6 {
+		t.Errorf("Expected length to stay 6, got %d", n)
+	}
+
+	for _, collided := range []bool{true, true, true, false} {
+		g.Observe(ctx, collided)
+	}
+	stats := g.CodeStats()
+	if stats.Length != 7 || stats.Attempts != 8 || stats.Collisions != 5 {
+		t.Errorf("Expected length 7 after 5 of 8 collisions, got %+v", stats)
+	}
+	if code, _ := g.Generate(ctx, "", "https://example.com/", 0); len(code) != 7 {
+		t.Errorf("Expected a 7-character code, got %q", code)
+	}
+
+	// A restart resumes at the stored length.
+	if n := NewAdaptiveCodes(ctx, r, 6, 0.5, 4).CodeStats().Length; n != 7 {
+		t.Errorf("Expected the stored length 7 after a restart, got %d", n)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// Destination is the URL a short link redirects to: the long URL with the
+// link's UTM parameters merged into its query string.
+func Destination(rec model.URLRecord) string {
+	return appendParams(rec.LongUrl, rec.UTM)
+}
+
+// web reports whether long is a web page, rather than an app link that
+// only a phone can open. Only web pages are fetched or scored.
+func web(long string) bool {
+	return strings.HasPrefix(long, "http://") || strings.HasPrefix(long, "https://")
+}
+
+// appendParams merges params into long's query string. Link parameters win
+// over same-named ones already in the URL; everything else in the original
+// query, including its order and encoding, is kept as is.
+func appendParams(long string, params map[string]string) string {
+	if len(params) == 0 {
+		return long
+	}
+	u, err := url.Parse(long)
+	if err != nil {
+		return long
+	}
+
+	var parts []string
+	for _, part := range strings.Split(u.RawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(part, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if _, ok := params[key]; ok {
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(params[k]))
+	}
+
+	u.RawQuery = strings.Join(parts, "&")
+	return u.String()
+}
+
+// trackingParams are query parameters that only identify the ad or click a
+// visitor came from, besides every utm_* one.
+var trackingParams = map[string]bool{"fbclid": true, "gclid": true}
+
+// stripTracking removes tracking parameters from long's query string. The
+// remaining parameters keep their order and encoding.
+func stripTracking(long string) string {
+	u, err := url.Parse(long)
+	if err != nil || u.RawQuery == "" {
+		return long
+	}
+
+	var parts []string
+	for _, part := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(part, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		key = strings.ToLower(key)
+		if part == "" || trackingParams[key] || strings.HasPrefix(key, "utm_") {
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	u.RawQuery = strings.Join(parts, "&")
+	u.ForceQuery = false
+	return u.String()
+}
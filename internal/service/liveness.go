@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// ErrDeadDestination is returned for destinations that cannot be reached or
+// answer that nothing is there, when dead destinations are refused.
+var ErrDeadDestination = errors.New("Destination is not reachable")
+
+// LivenessChecker requests destinations to tell whether they are live.
+type LivenessChecker interface {
+	Check(ctx context.Context, url string) model.LinkCheck
+}
+
+// LinkCheckStore keeps the latest check of each link's destination.
+type LinkCheckStore interface {
+	SaveLinkCheck(ctx context.Context, c model.LinkCheck) error
+	GetLinkChecks(ctx context.Context, codes []string) (map[string]model.LinkCheck, error)
+}
+
+type liveness struct {
+	checker    LivenessChecker
+	checks     LinkCheckStore
+	rejectDead bool
+}
+
+// WithLiveness checks the destinations of new links and changed ones with c
+// and keeps the outcome in checks, to show their owners. With rejectDead,
+// dead destinations are refused with ErrDeadDestination.
+func WithLiveness(c LivenessChecker, checks LinkCheckStore, rejectDead bool) Option {
+	return func(s *shortener) { s.live = liveness{checker: c, checks: checks, rejectDead: rejectDead} }
+}
+
+// checkLiveness requests long, before any link to it is stored.
+func (s *shortener) checkLiveness(ctx context.Context, long string) (*model.LinkCheck, error) {
+	if s.live.checker == nil || !web(long) {
+		return nil, nil
+	}
+	c := s.live.checker.Check(ctx, long)
+	if c.Dead && s.live.rejectDead {
+		return nil, ErrDeadDestination
+	}
+	return &c, nil
+}
+
+// saveCheck records c as the check of rec's destination and attaches it.
+// The link is there already, so failures are only logged.
+func (s *shortener) saveCheck(ctx context.Context, rec *model.URLRecord, c *model.LinkCheck) {
+	if c == nil {
+		return
+	}
+	c.Code = rec.Code
+	if c.CheckedAt.Before(rec.UpdatedAt) {
+		// Checked just before the link was stored; stamping it with the link
+		// keeps it from looking left over from an earlier link of the code.
+		c.CheckedAt = rec.UpdatedAt
+	}
+	if err := s.live.checks.SaveLinkCheck(ctx, *c); err != nil {
+		log.Printf("liveness %s: %v", rec.Code, err)
+		return
+	}
+	rec.Liveness = c
+}
+
+// attachChecks fills in the Liveness of recs. Failures only leave it out.
+func (s *shortener) attachChecks(ctx context.Context, recs []model.URLRecord) {
+	if s.live.checks == nil || len(recs) == 0 {
+		return
+	}
+	checks, err := s.live.checks.GetLinkChecks(ctx, codesOf(recs))
+	if err != nil {
+		log.Printf("liveness: %v", err)
+		return
+	}
+	for i := range recs {
+		// One older than the link was of a deleted link under the same code.
+		if c, ok := checks[recs[i].Code]; ok && !c.CheckedAt.Before(recs[i].CreatedAt) {
+			recs[i].Liveness = &c
+		}
+	}
+}
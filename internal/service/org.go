@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+var (
+	// ErrNotMember is returned when creating a link in an organization the
+	// caller does not belong to.
+	ErrNotMember = errors.New("Not a member of this organization")
+	// ErrNotOrgAdmin is returned when a member who is not an admin manages
+	// the member list.
+	ErrNotOrgAdmin = errors.New("Organization admin access required")
+	// ErrInvalidOrg is returned for slugs that are not 1 to 64 lower-case
+	// letters, digits or '-'.
+	ErrInvalidOrg = errors.New("Invalid organization slug")
+	// ErrOrgExists is returned when creating an organization whose slug is taken.
+	ErrOrgExists = errors.New("Organization already exists")
+	// ErrInvalidRole is returned for roles other than admin and member.
+	ErrInvalidRole = errors.New("role must be admin or member")
+	// ErrLastAdmin is returned when a change would leave an organization
+	// without an admin.
+	ErrLastAdmin = errors.New("An organization needs at least one admin")
+)
+
+// maxSlugLen is the longest organization slug.
+const maxSlugLen = 64
+
+// Orgs manages organizations on behalf of their members. Organizations the
+// caller does not belong to are reported as missing (ErrNotFound).
+type Orgs interface {
+	// Create makes a new organization with owner as its admin.
+	Create(ctx context.Context, owner string, req model.OrgReq) (model.Org, error)
+	// List returns the organizations owner belongs to.
+	List(ctx context.Context, owner string) ([]model.Org, error)
+	Get(ctx context.Context, owner, slug string) (model.OrgDetail, error)
+	// PutMember adds member to an organization, or changes their role. Only
+	// admins may.
+	PutMember(ctx context.Context, owner, slug, member, role string) (model.OrgMember, error)
+	// RemoveMember removes member. Admins may remove anyone; other members
+	// only themselves.
+	RemoveMember(ctx context.Context, owner, slug, member string) error
+	// Links returns the organization's links, newest first, optionally only
+	// those whose destination contains query.
+	Links(ctx context.Context, owner, slug, query string, limit, offset int) ([]model.URLRecord, error)
+	Stats(ctx context.Context, owner, slug string) (model.Stats, error)
+}
+
+// OrgMembership looks up an owner's role in an organization, failing with
+// ErrNotFound for non-members.
+type OrgMembership interface {
+	MemberRole(ctx context.Context, org, owner string) (string, error)
+}
+
+type orgs struct {
+	r repo.OrgRepo
+}
+
+func NewOrgs(r repo.OrgRepo) Orgs {
+	return &orgs{r: r}
+}
+
+func (o *orgs) Create(ctx context.Context, owner string, req model.OrgReq) (model.Org, error) {
+	if !validSlug(req.Slug) {
+		return model.Org{}, ErrInvalidOrg
+	}
+	org, err := o.r.CreateOrg(ctx, model.Org{Slug: req.Slug, Name: req.Name}, owner)
+	if errors.Is(err, repo.ErrDuplicateOrg) {
+		return model.Org{}, ErrOrgExists
+	}
+	return org, err
+}
+
+func (o *orgs) List(ctx context.Context, owner string) ([]model.Org, error) {
+	return o.r.ListOrgs(ctx, owner)
+}
+
+func (o *orgs) Get(ctx context.Context, owner, slug string) (model.OrgDetail, error) {
+	if _, err := o.r.MemberRole(ctx, slug, owner); err != nil {
+		return model.OrgDetail{}, err
+	}
+	org, err := o.r.GetOrg(ctx, slug)
+	if err != nil {
+		return model.OrgDetail{}, err
+	}
+	members, err := o.r.ListMembers(ctx, slug)
+	return model.OrgDetail{Org: org, Members: members}, err
+}
+
+func (o *orgs) PutMember(ctx context.Context, owner, slug, member, role string) (model.OrgMember, error) {
+	if role == "" {
+		role = model.RoleMember
+	}
+	if role != model.RoleAdmin && role != model.RoleMember {
+		return model.OrgMember{}, ErrInvalidRole
+	}
+	if err := o.requireAdmin(ctx, slug, owner); err != nil {
+		return model.OrgMember{}, err
+	}
+	if role != model.RoleAdmin {
+		if err := o.keepAdmin(ctx, slug, member); err != nil {
+			return model.OrgMember{}, err
+		}
+	}
+	return o.r.PutMember(ctx, slug, model.OrgMember{Owner: member, Role: role})
+}
+
+func (o *orgs) RemoveMember(ctx context.Context, owner, slug, member string) error {
+	if member != owner {
+		if err := o.requireAdmin(ctx, slug, owner); err != nil {
+			return err
+		}
+	}
+	if err := o.keepAdmin(ctx, slug, member); err != nil {
+		return err
+	}
+	return o.r.DeleteMember(ctx, slug, member)
+}
+
+func (o *orgs) Links(ctx context.Context, owner, slug, query string, limit, offset int) ([]model.URLRecord, error) {
+	if _, err := o.r.MemberRole(ctx, slug, owner); err != nil {
+		return nil, err
+	}
+	return o.r.ListByOrg(ctx, slug, query, limit, offset)
+}
+
+func (o *orgs) Stats(ctx context.Context, owner, slug string) (model.Stats, error) {
+	if _, err := o.r.MemberRole(ctx, slug, owner); err != nil {
+		return model.Stats{}, err
+	}
+	return o.r.OrgStats(ctx, slug, time.Now())
+}
+
+// requireAdmin fails with ErrNotFound for non-members and ErrNotOrgAdmin
+// for members who are not admins.
+func (o *orgs) requireAdmin(ctx context.Context, slug, owner string) error {
+	role, err := o.r.MemberRole(ctx, slug, owner)
+	if err != nil {
+		return err
+	}
+	if role != model.RoleAdmin {
+		return ErrNotOrgAdmin
+	}
+	return nil
+}
+
+// keepAdmin fails with ErrLastAdmin when member is the organization's only
+// admin, who must not be demoted or removed.
+func (o *orgs) keepAdmin(ctx context.Context, slug, member string) error {
+	members, err := o.r.ListMembers(ctx, slug)
+	if err != nil {
+		return err
+	}
+	admins, isAdmin := 0, false
+	for _, m := range members {
+		if m.Role == model.RoleAdmin {
+			admins++
+			isAdmin = isAdmin || m.Owner == member
+		}
+	}
+	if isAdmin && admins == 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func validSlug(slug string) bool {
+	if slug == "" || len(slug) > maxSlugLen {
+		return false
+	}
+	for _, r := range slug {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// isMember reports whether owner belongs to org.
+func isMember(ctx context.Context, m OrgMembership, org, owner string) (bool, error) {
+	if m == nil || org == "" || owner == "" {
+		return false, nil
+	}
+	_, err := m.MemberRole(ctx, org, owner)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
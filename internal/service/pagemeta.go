@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+// MetaQueue fetches the metadata of a link's destination page in the
+// background.
+type MetaQueue interface {
+	Enqueue(code, url string)
+}
+
+// PageMetaStore finds the metadata fetched for links.
+type PageMetaStore interface {
+	GetPageMetas(ctx context.Context, codes []string) (map[string]model.PageMeta, error)
+}
+
+type pageMeta struct {
+	queue MetaQueue
+	store PageMetaStore
+}
+
+// WithPageMeta queues the destinations of new links and changed ones on q,
+// and fills in the metadata found in store when owners get or list links.
+func WithPageMeta(q MetaQueue, store PageMetaStore) Option {
+	return func(s *shortener) { s.meta = pageMeta{queue: q, store: store} }
+}
+
+func (s *shortener) fetchMeta(rec model.URLRecord) {
+	if s.meta.queue != nil && web(rec.LongUrl) {
+		s.meta.queue.Enqueue(rec.Code, rec.LongUrl)
+	}
+}
+
+// attachMeta fills in the Meta of recs. Failures only leave it out.
+func (s *shortener) attachMeta(ctx context.Context, recs []model.URLRecord) {
+	if s.meta.store == nil || len(recs) == 0 {
+		return
+	}
+	metas, err := s.meta.store.GetPageMetas(ctx, codesOf(recs))
+	if err != nil {
+		log.Printf("page metadata: %v", err)
+		return
+	}
+	for i := range recs {
+		// Metadata older than the link was of a deleted link under the
+		// same code.
+		if m, ok := metas[recs[i].Code]; ok && !m.FetchedAt.Before(recs[i].CreatedAt) {
+			recs[i].Meta = &m
+		}
+	}
+}
+
+func codesOf(recs []model.URLRecord) []string {
+	codes := make([]string, len(recs))
+	for i, rec := range recs {
+		codes[i] = rec.Code
+	}
+	return codes
+}
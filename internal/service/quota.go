@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// Quota names, as reported by QuotaError.
+const (
+	QuotaLinksPerDay = "links_per_day"
+	QuotaLinksTotal  = "links_total"
+)
+
+// Usage counter metrics.
+const (
+	usageLinks  = "links"
+	usageClicks = "clicks"
+)
+
+// QuotaError is returned when creating a link would take its owner over a
+// quota.
+type QuotaError struct {
+	// Quota is QuotaLinksPerDay or QuotaLinksTotal.
+	Quota string
+	Limit int
+	// Reset is when the quota frees up again. It is zero for
+	// QuotaLinksTotal, which frees up only as links are deleted.
+	Reset time.Time
+}
+
+func (e *QuotaError) Error() string {
+	if e.Quota == QuotaLinksTotal {
+		return fmt.Sprintf("Link limit of %d reached", e.Limit)
+	}
+	return fmt.Sprintf("Daily limit of %d new links reached", e.Limit)
+}
+
+// Quotas enforces per-owner usage limits. Anonymous links are not subject to
+// them.
+type Quotas struct {
+	links  repo.URLRepo
+	usage  repo.QuotaRepo
+	limits atomic.Pointer[quotaLimits]
+	now    func() time.Time
+}
+
+type quotaLimits struct {
+	def    model.Quota
+	owners map[string]model.Quota
+	// clicks is whether any owner has a click quota, so clicks need counting.
+	clicks bool
+}
+
+// NewQuotas applies def to every owner not listed in owners.
+func NewQuotas(links repo.URLRepo, usage repo.QuotaRepo, def model.Quota, owners map[string]model.Quota) *Quotas {
+	q := &Quotas{links: links, usage: usage, now: time.Now}
+	q.SetLimits(def, owners)
+	return q
+}
+
+// SetLimits replaces the quotas, e.g. after a configuration reload. Usage
+// counted so far stays.
+func (q *Quotas) SetLimits(def model.Quota, owners map[string]model.Quota) {
+	l := &quotaLimits{def: def, owners: owners, clicks: def.ClicksPerMonth > 0}
+	for _, o := range owners {
+		l.clicks = l.clicks || o.ClicksPerMonth > 0
+	}
+	q.limits.Store(l)
+}
+
+// For returns owner's quota.
+func (q *Quotas) For(owner string) model.Quota {
+	l := q.limits.Load()
+	if o, ok := l.owners[owner]; ok {
+		return o
+	}
+	return l.def
+}
+
+// AllowLink counts a new link against owner's quotas, failing with a
+// *QuotaError when one is used up.
+func (q *Quotas) AllowLink(ctx context.Context, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	quota := q.For(owner)
+	if quota.LinksTotal > 0 {
+		n, err := q.usage.CountLinks(ctx, owner)
+		if err != nil {
+			return err
+		}
+		if n >= quota.LinksTotal {
+			return &QuotaError{Quota: QuotaLinksTotal, Limit: quota.LinksTotal}
+		}
+	}
+	if quota.LinksPerDay > 0 {
+		day := q.now().UTC().Truncate(24 * time.Hour)
+		ok, err := q.usage.AddUsage(ctx, owner, usageLinks, day, quota.LinksPerDay)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &QuotaError{Quota: QuotaLinksPerDay, Limit: quota.LinksPerDay, Reset: day.AddDate(0, 0, 1)}
+		}
+	}
+	return nil
+}
+
+// AllowClick counts a click on code against its owner's monthly click quota
+// and reports whether the click may be recorded. It fails open: a lookup or
+// counting error lets the click through.
+func (q *Quotas) AllowClick(ctx context.Context, code string) bool {
+	if !q.limits.Load().clicks {
+		return true
+	}
+	rec, err := q.links.GetByCode(ctx, code)
+	if err != nil || rec.Owner == "" {
+		return true
+	}
+	limit := q.For(rec.Owner).ClicksPerMonth
+	if limit == 0 {
+		return true
+	}
+	now := q.now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	ok, err := q.usage.AddUsage(ctx, rec.Owner, usageClicks, month, limit)
+	return ok || err != nil
+}
+
+// Prune forgets usage counters that no quota looks at any more: those from
+// before the previous month.
+func (q *Quotas) Prune(ctx context.Context) error {
+	now := q.now().UTC()
+	_, err := q.usage.DeleteUsage(ctx, time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC))
+	return err
+}
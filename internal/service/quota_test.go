@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	q := NewQuotas(r, r, model.Quota{LinksPerDay: 2, LinksTotal: 3}, map[string]model.Quota{
+		"vip": {ClicksPerMonth: 2},
+	})
+	now := time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	s := NewShortener(r, WithQuotas(q))
+
+	shorten := func(owner, long string) error {
+		_, _, err := s.Shorten(ctx, "https://shawt.ly/", long, LinkOptions{Owner: owner})
+		return err
+	}
+
+	for _, long := range []string{"https://example.com/1", "https://example.com/2"} {
+		if err := shorten("alice", long); err != nil {
+			t.Fatalf("shorten %s: %v", long, err)
+		}
+	}
+	var qe *QuotaError
+	if err := shorten("alice", "https://example.com/3"); !errors.As(err, &qe) || qe.Quota != QuotaLinksPerDay || !qe.Reset.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the daily quota to run out until midnight, got %v", err)
+	}
+	if err := shorten("alice", "https://example.com/1"); err != nil {
+		t.Errorf("an existing link should not count against the quota, got %v", err)
+	}
+	if err := shorten("", "https://example.com/anon"); err != nil {
+		t.Errorf("anonymous links have no quota, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := shorten("alice", "https://example.com/3"); err != nil {
+		t.Fatalf("expected a new day to reset the quota, got %v", err)
+	}
+	if err := shorten("alice", "https://example.com/4"); !errors.As(err, &qe) || qe.Quota != QuotaLinksTotal || !qe.Reset.IsZero() {
+		t.Errorf("expected the total quota to run out, got %v", err)
+	}
+
+	rec, _, _ := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/vip", LinkOptions{Owner: "vip"})
+	var allowed int
+	for i := 0; i < 3; i++ {
+		if q.AllowClick(ctx, rec.Code) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("expected 2 clicks recorded, got %d", allowed)
+	}
+	if !q.AllowClick(ctx, "missing") {
+		t.Error("expected an unknown code to be allowed")
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"unicode/utf8"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+var (
+	// ErrReviewed is returned when reviewing a report that has been
+	// reviewed already.
+	ErrReviewed = errors.New("Report has already been reviewed")
+	// ErrLongReport is returned for report details or contacts over their
+	// length limits.
+	ErrLongReport = errors.New("details must be at most 2000 characters and contact at most 255")
+)
+
+// Limits on the free text of an abuse report.
+const (
+	maxReportDetails = 2000
+	maxReportContact = 255
+)
+
+// Reports takes abuse reports about links from anyone and queues them for
+// operators, who approve them, taking the link down, or reject them.
+type Reports interface {
+	// Submit queues a report. It fails with ErrNotFound for unknown links,
+	// ErrInvalidReason for reasons other than model.ReportReasons and
+	// ErrLongReport.
+	Submit(ctx context.Context, r model.AbuseReport) (model.AbuseReport, error)
+	// List returns the reports in status, or all of them, oldest first.
+	List(ctx context.Context, status string, limit, offset int) ([]model.AbuseReport, error)
+	// Approve takes the reported link down for reason, by default the
+	// report's own, with note for its visitors.
+	Approve(ctx context.Context, actor string, id int64, reason, note string) (model.AbuseReport, error)
+	Reject(ctx context.Context, actor string, id int64) (model.AbuseReport, error)
+}
+
+type reports struct {
+	links  repo.URLRepo
+	repo   repo.ReportRepo
+	admin  Admin
+	events EventPublisher
+	audit  repo.AuditRepo
+}
+
+// NewReports returns the abuse report queue, approving reports through
+// admin. events and audit may be nil.
+func NewReports(links repo.URLRepo, r repo.ReportRepo, admin Admin, events EventPublisher, audit repo.AuditRepo) Reports {
+	return &reports{links: links, repo: r, admin: admin, events: events, audit: audit}
+}
+
+func (s *reports) Submit(ctx context.Context, r model.AbuseReport) (model.AbuseReport, error) {
+	if !slices.Contains(model.ReportReasons, r.Reason) {
+		return model.AbuseReport{}, ErrInvalidReason
+	}
+	if utf8.RuneCountInString(r.Details) > maxReportDetails || utf8.RuneCountInString(r.Contact) > maxReportContact {
+		return model.AbuseReport{}, ErrLongReport
+	}
+	if _, err := s.links.GetByCode(ctx, r.Code); err != nil {
+		return model.AbuseReport{}, err
+	}
+
+	rep, err := s.repo.InsertReport(ctx, r)
+	if err != nil {
+		return model.AbuseReport{}, err
+	}
+	if s.events != nil {
+		s.events.Publish(ctx, model.EventReportCreated, rep)
+	}
+	return rep, nil
+}
+
+func (s *reports) List(ctx context.Context, status string, limit, offset int) ([]model.AbuseReport, error) {
+	return s.repo.ListReports(ctx, status, limit, offset)
+}
+
+func (s *reports) Approve(ctx context.Context, actor string, id int64, reason, note string) (model.AbuseReport, error) {
+	rep, err := s.pending(ctx, id)
+	if err != nil {
+		return model.AbuseReport{}, err
+	}
+	if reason == "" {
+		reason = rep.Reason
+	}
+	if _, err := s.admin.TakeDown(ctx, actor, rep.Code, reason, note); err != nil {
+		return model.AbuseReport{}, err
+	}
+	return s.review(ctx, id, model.ReportApproved, actor)
+}
+
+func (s *reports) Reject(ctx context.Context, actor string, id int64) (model.AbuseReport, error) {
+	if _, err := s.pending(ctx, id); err != nil {
+		return model.AbuseReport{}, err
+	}
+	rep, err := s.review(ctx, id, model.ReportRejected, actor)
+	if err == nil {
+		recordAudit(ctx, s.audit, model.AuditReportRejected, actor, rep.Code, nil, nil)
+	}
+	return rep, err
+}
+
+// pending returns report id, failing with ErrReviewed once it is reviewed.
+func (s *reports) pending(ctx context.Context, id int64) (model.AbuseReport, error) {
+	rep, err := s.repo.GetReport(ctx, id)
+	if err != nil {
+		return model.AbuseReport{}, err
+	}
+	if rep.Status != model.ReportPending {
+		return model.AbuseReport{}, ErrReviewed
+	}
+	return rep, nil
+}
+
+func (s *reports) review(ctx context.Context, id int64, status, actor string) (model.AbuseReport, error) {
+	rep, err := s.repo.ReviewReport(ctx, id, status, actor)
+	if errors.Is(err, repo.ErrNotFound) {
+		// Reviewed by someone else since pending looked.
+		return model.AbuseReport{}, ErrReviewed
+	}
+	return rep, err
+}
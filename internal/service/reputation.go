@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/reputation"
+)
+
+// ErrUnderReview is returned for links held until an operator reviews
+// their destination, which their owners cannot enable meanwhile.
+var ErrUnderReview = errors.New("Link is waiting for review")
+
+// ReviewStore keeps the links held for review.
+type ReviewStore interface {
+	AddReview(ctx context.Context, r model.Review) (model.Review, error)
+	GetReview(ctx context.Context, code string) (model.Review, error)
+}
+
+// reputationHold holds new destinations whose domain scores below threshold.
+type reputationHold struct {
+	checker   reputation.Checker
+	threshold int
+	reviews   ReviewStore
+}
+
+// WithReputation scores the domain of new destinations with c. Links to
+// domains scoring below threshold are created disabled and held in reviews
+// until an operator approves them.
+func WithReputation(c reputation.Checker, threshold int, reviews ReviewStore) Option {
+	return func(s *shortener) { s.rep = reputationHold{checker: c, threshold: threshold, reviews: reviews} }
+}
+
+// score returns the review to hold a link to long for, if its domain scores
+// below the threshold. Like scans, scoring fails open.
+func (s *shortener) score(ctx context.Context, long string) (model.Review, bool) {
+	if s.rep.checker == nil || !web(long) {
+		return model.Review{}, false
+	}
+	u, err := url.Parse(long)
+	if err != nil {
+		return model.Review{}, false
+	}
+	res, err := s.rep.checker.Check(ctx, u.Hostname())
+	if err != nil {
+		log.Printf("reputation: %v", err)
+		return model.Review{}, false
+	}
+	if res.Score >= s.rep.threshold {
+		return model.Review{}, false
+	}
+	return model.Review{Domain: u.Hostname(), Score: res.Score, Reasons: res.Reasons}, true
+}
+
+// hold disables rec pending rev and publishes a link.held event. The review
+// is recorded first, so the owner never finds the link disabled without it.
+func (s *shortener) hold(ctx context.Context, rec model.URLRecord, rev model.Review) (model.URLRecord, error) {
+	rev.Code, rev.Owner = rec.Code, rec.Owner
+	rev, err := s.rep.reviews.AddReview(ctx, rev)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	held, err := s.r.SetActive(ctx, rec.Code, false)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if s.events != nil {
+		s.events.Publish(ctx, model.EventLinkHeld, rev)
+	}
+	recordAudit(ctx, s.audit, model.EventLinkHeld, "", rec.Code, &rec, &held)
+	return held, nil
+}
+
+// underReview reports whether rec is held for review. Only disabled links
+// are looked up, as holding a link disables it.
+func (s *shortener) underReview(ctx context.Context, rec model.URLRecord) (bool, error) {
+	if s.rep.reviews == nil || rec.Active {
+		return false, nil
+	}
+	rev, err := s.rep.reviews.GetReview(ctx, rec.Code)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// One older than the link was of a deleted link under the same code.
+	return !rev.CreatedAt.Before(rec.CreatedAt), nil
+}
@@ -3,71 +3,784 @@ package service
 import (
 	"context"
 	"errors"
+	"log"
+	"maps"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"urlshortener/urlshortener/internal/model"
 	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/scan"
 	"urlshortener/urlshortener/internal/util"
 
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 )
 
-const PgUniqueViolation pq.ErrorCode = "23505"
-
 type Shortener interface {
-	Shorten(ctx context.Context, baseURL, long string) (rec model.URLRecord, created bool, err error)
-	Resolve(ctx context.Context, code string) (string, error)
+	Shorten(ctx context.Context, baseURL, long string, opts LinkOptions) (rec model.URLRecord, created bool, err error)
+	// Resolve returns the destination of code on a short domain ("" for the
+	// default), counting the redirect against the link's click limit.
+	Resolve(ctx context.Context, domain, code string) (string, error)
+	// Visit is Resolve that also returns the link as it is after the
+	// redirect was counted.
+	Visit(ctx context.Context, domain, code string) (model.URLRecord, string, error)
+	// Lookup returns the record behind a code, subject to the same
+	// availability rules as Resolve.
+	Lookup(ctx context.Context, domain, code string) (model.URLRecord, error)
+	// Find returns the link shortening long on a short domain would hand
+	// out, subject to the same availability rules as Resolve.
+	Find(ctx context.Context, domain, long string) (model.URLRecord, error)
+	// Get returns a link owned by owner, whatever its state.
+	Get(ctx context.Context, owner, code string) (model.URLRecord, error)
+	// Update applies edit to a link owned by owner. A non-empty etag must
+	// match the link's current ETag.
+	Update(ctx context.Context, owner, code string, edit LinkEdit, etag string) (model.URLRecord, error)
+	// SetActive disables or re-enables a link owned by owner. Enabling a
+	// link an operator took down fails with a TakedownError, and one held
+	// for review with ErrUnderReview.
+	SetActive(ctx context.Context, owner, code string, active bool) (model.URLRecord, error)
+	// Delete removes a link owned by owner for good.
+	Delete(ctx context.Context, owner, code string) error
+	// List returns owner's links, newest first, optionally only those whose
+	// destination contains query.
+	List(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error)
+	// Export returns up to limit of owner's links in code order, after the
+	// code cursor ("" to start from the beginning).
+	Export(ctx context.Context, owner, cursor string, limit int) ([]model.URLRecord, error)
+}
+
+// LinkOptions carries the optional per-link settings of a Shorten request.
+type LinkOptions struct {
+	// UTM parameters are appended to the destination on every redirect.
+	UTM map[string]string
+	// Owner is recorded on new links and is the only caller allowed to edit them.
+	Owner string
+	// Domain is the short domain the link is created on, "" for the default.
+	Domain string
+	// ExpiresAt, when set, is when the link stops redirecting.
+	ExpiresAt *time.Time
+	// Title and Description annotate new links. Without a title, one is
+	// fetched from the destination when a TitleFetcher is configured.
+	Title       string
+	Description string
+	// Org shares the link with an organization Owner belongs to.
+	Org string
+	// MaxClicks, when positive, disables the link after that many redirects;
+	// one-time links have 1.
+	MaxClicks int
+	// FallbackURL is where visitors go once the link no longer redirects.
+	FallbackURL string
+	// StripTracking, when set, overrides the shortener's default for
+	// removing tracking parameters from the destination.
+	StripTracking *bool
+	// Unique mints a new link even when the destination already has one.
+	Unique bool
+}
+
+// LinkEdit is a change to an existing link. Zero fields are left as they are.
+type LinkEdit struct {
+	// LongURL, when non-empty, is the new destination.
+	LongURL     string
+	Title       *string
+	Description *string
+	// FallbackURL, when set, replaces the fallback URL; "" removes it.
+	FallbackURL *string
+}
+
+// TitleFetcher looks up the title of the page at a URL.
+type TitleFetcher interface {
+	Title(ctx context.Context, url string) (string, error)
+}
+
+var (
+	// ErrNotFound is returned for links, and other records, that do not exist
+	// or that the caller may not see.
+	ErrNotFound = repo.ErrNotFound
+	// ErrFlagged is returned when a destination is listed as malware or phishing.
+	ErrFlagged = errors.New("URL is flagged as malicious")
+	// ErrConflict is returned when the URL is already shortened with different options.
+	ErrConflict = errors.New("URL is already shortened with different options")
+	// ErrPreconditionFailed is returned when an update's ETag no longer matches the link.
+	ErrPreconditionFailed = errors.New("Link has been modified")
+	// ErrDisabled is returned for links that have been disabled.
+	ErrDisabled = errors.New("Link is disabled")
+	// ErrBanned is returned when a destination's domain has been banned.
+	ErrBanned = errors.New("Destination domain is banned")
+	// ErrExpired is returned for links past their expiry.
+	ErrExpired = errors.New("Link has expired")
+	// ErrClickLimit is returned for links that used up their max_clicks.
+	ErrClickLimit = errors.New("Link has reached its click limit")
+)
+
+// TakedownError is returned for links an operator has taken down, which
+// their owners cannot enable. It wraps ErrDisabled.
+type TakedownError struct {
+	Takedown model.Takedown
+}
+
+func (e *TakedownError) Error() string {
+	return "Link has been taken down for " + e.Takedown.Reason
+}
+
+func (e *TakedownError) Unwrap() error {
+	return ErrDisabled
+}
+
+// FallbackError is returned for a link that is disabled, expired or out of
+// clicks but names a page to send its visitors to instead. It wraps the
+// reason the link stopped redirecting.
+type FallbackError struct {
+	URL string
+	Err error
+}
+
+func (e *FallbackError) Error() string { return e.Err.Error() }
+
+func (e *FallbackError) Unwrap() error { return e.Err }
+
+// withFallback wraps err in a FallbackError when rec has a fallback page
+// for it. Flagged links never send visitors anywhere.
+func withFallback(rec model.URLRecord, err error) error {
+	if rec.FallbackURL == "" || !(errors.Is(err, ErrDisabled) || errors.Is(err, ErrExpired) || errors.Is(err, ErrClickLimit)) {
+		return err
+	}
+	return &FallbackError{URL: rec.FallbackURL, Err: err}
+}
+
+// EventPublisher is told about link changes, e.g. to send webhooks. Publish
+// must not fail the caller.
+type EventPublisher interface {
+	Publish(ctx context.Context, event string, data any)
+}
+
+// FlagChecker tells whether a feature being rolled out is on for an owner.
+type FlagChecker interface {
+	Enabled(name, owner string) bool
+}
+
+// BanChecker tells whether a destination host is banned.
+type BanChecker interface {
+	IsBanned(ctx context.Context, host string) (bool, error)
+}
+
+// TakedownChecker finds the takedowns of links.
+type TakedownChecker interface {
+	GetTakedown(ctx context.Context, code string) (model.Takedown, error)
 }
 
-type shortener struct{ r repo.URLRepo }
+// CachedLookup finds links to redirect with in a cache.
+type CachedLookup interface {
+	Cached(ctx context.Context, code string) (model.URLRecord, error)
+}
+
+type shortener struct {
+	r        repo.URLRepo
+	cached   CachedLookup
+	scanner  scan.Scanner
+	reserved util.Reserved
+	codes    util.CodeGenerator
+	flagged  flaggedCodes
+	events   EventPublisher
+	audit    repo.AuditRepo
+	bans     BanChecker
+	downs    TakedownChecker
+	titles   TitleFetcher
+	quotas   *Quotas
+	orgs     OrgMembership
+	rep      reputationHold
+	live     liveness
+	meta     pageMeta
+	strip    bool
+}
+
+// Option configures optional shortener collaborators.
+type Option func(*shortener)
+
+// WithScanner vets new destinations against a malware/phishing scanner.
+func WithScanner(sc scan.Scanner) Option {
+	return func(s *shortener) { s.scanner = sc }
+}
+
+// WithReserved keeps generated codes out of the given reserved set. Without
+// it only util.DefaultReserved applies.
+func WithReserved(reserved util.Reserved) Option {
+	return func(s *shortener) { s.reserved = reserved }
+}
+
+// WithCodes picks the codes of new links. Without it codes are random, of
+// util.DefaultCodeLength characters.
+func WithCodes(g util.CodeGenerator) Option {
+	return func(s *shortener) { s.codes = g }
+}
+
+// flaggedCodes replaces the code generator for owners a flag is on for.
+type flaggedCodes struct {
+	flags FlagChecker
+	name  string
+	codes util.CodeGenerator
+}
+
+// WithFlaggedCodes makes the codes of new links with g instead for owners
+// the feature flag name is on for, so a new generator can be rolled out
+// gradually.
+func WithFlaggedCodes(flags FlagChecker, name string, g util.CodeGenerator) Option {
+	return func(s *shortener) { s.flagged = flaggedCodes{flags: flags, name: name, codes: g} }
+}
+
+// WithBans refuses destinations on domains banned by operators.
+func WithBans(b BanChecker) Option {
+	return func(s *shortener) { s.bans = b }
+}
+
+// WithTakedowns tells visitors of taken down links why, and keeps their
+// owners from enabling them.
+func WithTakedowns(t TakedownChecker) Option {
+	return func(s *shortener) { s.downs = t }
+}
+
+// WithTitles fills in the title of new links that come without one.
+func WithTitles(f TitleFetcher) Option {
+	return func(s *shortener) { s.titles = f }
+}
+
+// WithQuotas holds owners to their link quotas.
+func WithQuotas(q *Quotas) Option {
+	return func(s *shortener) { s.quotas = q }
+}
+
+// WithOrgs lets members of an organization create its links and manage
+// them alongside their creator.
+func WithOrgs(m OrgMembership) Option {
+	return func(s *shortener) { s.orgs = m }
+}
+
+// WithStripTracking removes utm_*, fbclid and gclid parameters from new
+// destinations by default, keeping the URL as submitted in OriginalURL.
+// Links then share a code whatever campaign they were shared from.
+func WithStripTracking(on bool) Option {
+	return func(s *shortener) { s.strip = on }
+}
+
+// WithEvents publishes link lifecycle events to p.
+func WithEvents(p EventPublisher) Option {
+	return func(s *shortener) { s.events = p }
+}
+
+// WithLinkCache resolves short links through c rather than the repo. The
+// repo must write the links it stores through to c, as repo.LinkCache does,
+// so that a new link redirects at once.
+func WithLinkCache(c CachedLookup) Option {
+	return func(s *shortener) { s.cached = c }
+}
 
-func NewShortener(r repo.URLRepo) Shortener { return &shortener{r} }
+func NewShortener(r repo.URLRepo, opts ...Option) Shortener {
+	s := &shortener{r: r, reserved: util.NewReserved(nil), codes: util.RandomCodes{Length: util.DefaultCodeLength}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
 
-func (s *shortener) Shorten(ctx context.Context, baseUrl, long string) (model.URLRecord, bool, error) {
-	// Check if record already exists with retry for concurrent scenarios
-	for i := 0; i < 2; i++ {
-		if rec, err := s.r.GetByLong(ctx, long); err == nil {
-			return rec, false, nil
+func (s *shortener) Shorten(ctx context.Context, baseUrl, long string, opts LinkOptions) (model.URLRecord, bool, error) {
+	if opts.Org != "" {
+		ok, err := isMember(ctx, s.orgs, opts.Org, opts.Owner)
+		if err != nil {
+			return model.URLRecord{}, false, err
+		}
+		if !ok {
+			return model.URLRecord{}, false, ErrNotMember
 		}
 	}
 
-	for attempt := 0; attempt < 5; attempt++ {
-		code := util.GenerateCode()
-		short := baseUrl + code
-		id := uuid.New().String()
+	long, original := s.stripTracking(long, opts.StripTracking)
+	codes := s.codesFor(opts.Owner)
 
-		rec, err := s.r.Insert(ctx, id, code, long, short)
-		if err == nil {
-			return rec, true, nil
+	// Known destinations skip the scan, quota and title fetch below. A
+	// concurrent create of the same one is settled by Upsert, which is all
+	// deterministic codes need: storing the link again finds it.
+	if !util.Deterministic(codes) && !opts.Unique {
+		if rec, err := s.r.GetByLong(ctx, opts.Domain, long); err == nil {
+			return existing(rec, opts)
 		}
+	}
+
+	if err := s.checkBan(ctx, long); err != nil {
+		return model.URLRecord{}, false, err
+	}
+
+	status, err := s.scan(ctx, long)
+	if err != nil {
+		return model.URLRecord{}, false, err
+	}
+	review, held := s.score(ctx, long)
+	check, err := s.checkLiveness(ctx, long)
+	if err != nil {
+		return model.URLRecord{}, false, err
+	}
 
-		var pqErr *pq.Error
-		if !errors.As(err, &pqErr) || pqErr.Code != PgUniqueViolation {
+	if s.quotas != nil {
+		if err := s.quotas.AllowLink(ctx, opts.Owner); err != nil {
 			return model.URLRecord{}, false, err
 		}
+	}
+
+	if opts.Title == "" {
+		opts.Title = s.fetchTitle(ctx, long)
+	}
 
-		if strings.Contains(pqErr.Detail, "code") || strings.Contains(pqErr.Message, "code") {
+	in := model.URLRecord{LongUrl: long, UTM: opts.UTM, Owner: opts.Owner, Domain: opts.Domain, ExpiresAt: opts.ExpiresAt, Title: opts.Title, Description: opts.Description, Org: opts.Org, OriginalURL: original, Unique: opts.Unique, MaxClicks: opts.MaxClicks, FallbackURL: opts.FallbackURL}
+	if status == scan.StatusClean {
+		now := time.Now()
+		in.ScanStatus, in.ScannedAt = status, &now
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := codes.Generate(ctx, opts.Domain, long, attempt)
+		if err != nil {
+			return model.URLRecord{}, false, err
+		}
+		if s.reserved.Contains(code) {
 			continue
 		}
+		in.Code = code
+		in.ShortUrl = baseUrl + in.Code
+		in.ID = uuid.New().String()
 
-		if strings.Contains(pqErr.Detail, "long_url") || strings.Contains(pqErr.Message, "long_url") {
-			if rec, rec_err := s.r.GetByLong(ctx, long); rec_err == nil {
-				return rec, false, nil
-			}
+		rec, created, err := s.r.Upsert(ctx, in)
+		if o, ok := codes.(collisionObserver); ok && (err == nil || errors.Is(err, repo.ErrDuplicateCode)) {
+			o.Observe(ctx, err != nil)
+		}
+		if errors.Is(err, repo.ErrDuplicateCode) {
+			continue
+		}
+		if err != nil {
 			return model.URLRecord{}, false, err
 		}
-
-		return model.URLRecord{}, false, err
+		if !created {
+			return existing(rec, opts)
+		}
+		if held {
+			if rec, err = s.hold(ctx, rec, review); err != nil {
+				// Rather no link than one that skipped its review.
+				if derr := s.r.Delete(ctx, in.Code); derr != nil {
+					log.Printf("hold %s: %v", in.Code, derr)
+				}
+				return model.URLRecord{}, false, err
+			}
+		}
+		s.publish(ctx, model.EventLinkCreated, rec)
+		recordAudit(ctx, s.audit, model.EventLinkCreated, opts.Owner, rec.Code, nil, &rec)
+		s.saveCheck(ctx, &rec, check)
+		s.fetchMeta(rec)
+		return rec, true, nil
 	}
 	return model.URLRecord{}, false, errors.New("Could not allocate unique code")
 }
 
-func (s *shortener) Resolve(ctx context.Context, code string) (string, error) {
+func (s *shortener) Resolve(ctx context.Context, domain, code string) (string, error) {
+	_, dest, err := s.Visit(ctx, domain, code)
+	return dest, err
+}
+
+func (s *shortener) Visit(ctx context.Context, domain, code string) (model.URLRecord, string, error) {
+	rec, err := s.Lookup(ctx, domain, code)
+	if err != nil {
+		return model.URLRecord{}, "", err
+	}
+
+	if rec.MaxClicks > 0 {
+		// The claim is a conditional UPDATE, so of concurrent redirects
+		// only as many as there are clicks left get through.
+		before := rec
+		rec, err = s.r.TakeClick(ctx, code)
+		if errors.Is(err, ErrNotFound) {
+			return model.URLRecord{}, "", withFallback(before, ErrClickLimit)
+		}
+		if err != nil {
+			return model.URLRecord{}, "", err
+		}
+		if !rec.Active {
+			s.publish(ctx, model.EventLinkDisabled, rec)
+			recordAudit(ctx, s.audit, model.EventLinkDisabled, "", rec.Code, &before, &rec)
+		}
+	}
+
+	return rec, Destination(rec), nil
+}
+
+func (s *shortener) Lookup(ctx context.Context, domain, code string) (model.URLRecord, error) {
+	get := s.r.GetByCode
+	if s.cached != nil {
+		get = s.cached.Cached
+	}
+	rec, err := get(ctx, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+
+	// Codes are unique across domains, but only resolve on their own.
+	if rec.Domain != domain {
+		return model.URLRecord{}, ErrNotFound
+	}
+
+	out, err := available(rec)
+	if errors.Is(err, ErrDisabled) {
+		if t, ok, terr := s.takedown(ctx, rec); terr != nil {
+			log.Printf("takedown %s: %v", rec.Code, terr)
+		} else if ok {
+			return model.URLRecord{}, &TakedownError{Takedown: t}
+		}
+		if ok, rerr := s.underReview(ctx, rec); rerr != nil {
+			log.Printf("review %s: %v", rec.Code, rerr)
+		} else if ok {
+			return model.URLRecord{}, ErrUnderReview
+		}
+	}
+	return out, withFallback(rec, err)
+}
+
+// takedown returns rec's takedown, if it has one. Only disabled links are
+// looked up, as taking a link down disables it.
+func (s *shortener) takedown(ctx context.Context, rec model.URLRecord) (model.Takedown, bool, error) {
+	if s.downs == nil || rec.Active {
+		return model.Takedown{}, false, nil
+	}
+	t, err := s.downs.GetTakedown(ctx, rec.Code)
+	if errors.Is(err, ErrNotFound) {
+		return model.Takedown{}, false, nil
+	}
+	if err != nil {
+		return model.Takedown{}, false, err
+	}
+	// One older than the link was of a deleted link under the same code.
+	return t, !t.CreatedAt.Before(rec.CreatedAt), nil
+}
+
+func (s *shortener) Find(ctx context.Context, domain, long string) (model.URLRecord, error) {
+	long, _ = s.stripTracking(long, nil)
+	rec, err := s.r.GetByLong(ctx, domain, long)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	return available(rec)
+}
+
+// available returns rec unless it is flagged, disabled, out of clicks or
+// expired.
+func available(rec model.URLRecord) (model.URLRecord, error) {
+	if rec.ScanStatus == scan.StatusFlagged {
+		return model.URLRecord{}, ErrFlagged
+	}
+	if rec.Exhausted() {
+		return model.URLRecord{}, ErrClickLimit
+	}
+	if !rec.Active {
+		return model.URLRecord{}, ErrDisabled
+	}
+	if rec.Expired(time.Now()) {
+		return model.URLRecord{}, ErrExpired
+	}
+
+	return rec, nil
+}
+
+func (s *shortener) Get(ctx context.Context, owner, code string) (model.URLRecord, error) {
+	rec, err := s.owned(ctx, owner, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	recs := []model.URLRecord{rec}
+	s.attachChecks(ctx, recs)
+	s.attachMeta(ctx, recs)
+	return recs[0], nil
+}
+
+func (s *shortener) Update(ctx context.Context, owner, code string, edit LinkEdit, etag string) (model.URLRecord, error) {
+	rec, err := s.owned(ctx, owner, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	before := rec
+
+	if etag != "" && etag != "*" && strings.TrimPrefix(etag, "W/") != ETag(rec) {
+		return model.URLRecord{}, ErrPreconditionFailed
+	}
+
+	prev := rec.UpdatedAt
+	var review model.Review
+	var held bool
+	var check *model.LinkCheck
+	if edit.LongURL != "" {
+		edit.LongURL, rec.OriginalURL = s.stripTracking(edit.LongURL, nil)
+
+		if err := s.checkBan(ctx, edit.LongURL); err != nil {
+			return model.URLRecord{}, err
+		}
+
+		status, err := s.scan(ctx, edit.LongURL)
+		if err != nil {
+			return model.URLRecord{}, err
+		}
+
+		review, held = s.score(ctx, edit.LongURL)
+		if check, err = s.checkLiveness(ctx, edit.LongURL); err != nil {
+			return model.URLRecord{}, err
+		}
+
+		rec.LongUrl = edit.LongURL
+		rec.ScanStatus = status
+		rec.ScannedAt = nil
+		if status == scan.StatusClean {
+			now := time.Now()
+			rec.ScannedAt = &now
+		}
+	}
+	if edit.Title != nil {
+		rec.Title = *edit.Title
+	}
+	if edit.Description != nil {
+		rec.Description = *edit.Description
+	}
+	if edit.FallbackURL != nil {
+		rec.FallbackURL = *edit.FallbackURL
+	}
+
+	updated, err := s.r.Update(ctx, rec, prev)
+	if errors.Is(err, repo.ErrDuplicateLongURL) {
+		return model.URLRecord{}, ErrConflict
+	}
+	if errors.Is(err, ErrNotFound) {
+		// It existed a moment ago, so someone else got there first.
+		return model.URLRecord{}, ErrPreconditionFailed
+	}
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if held && updated.Active {
+		if updated, err = s.hold(ctx, updated, review); err != nil {
+			return model.URLRecord{}, err
+		}
+	}
+
+	s.publish(ctx, model.EventLinkUpdated, updated)
+	recordAudit(ctx, s.audit, model.EventLinkUpdated, owner, code, &before, &updated)
+	s.saveCheck(ctx, &updated, check)
+	if edit.LongURL != "" {
+		s.fetchMeta(updated)
+	}
+	return updated, nil
+}
+
+func (s *shortener) SetActive(ctx context.Context, owner, code string, active bool) (model.URLRecord, error) {
+	before, err := s.owned(ctx, owner, code)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if active {
+		t, ok, err := s.takedown(ctx, before)
+		if err != nil {
+			return model.URLRecord{}, err
+		}
+		if ok {
+			return model.URLRecord{}, &TakedownError{Takedown: t}
+		}
+		if ok, err := s.underReview(ctx, before); err != nil {
+			return model.URLRecord{}, err
+		} else if ok {
+			return model.URLRecord{}, ErrUnderReview
+		}
+	}
+
+	rec, err := s.r.SetActive(ctx, code, active)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+
+	event := model.EventLinkDisabled
+	if active {
+		event = model.EventLinkEnabled
+	}
+	s.publish(ctx, event, rec)
+	recordAudit(ctx, s.audit, event, owner, code, &before, &rec)
+	return rec, nil
+}
+
+func (s *shortener) Delete(ctx context.Context, owner, code string) error {
+	rec, err := s.owned(ctx, owner, code)
+	if err != nil {
+		return err
+	}
+
+	if err := s.r.Delete(ctx, code); err != nil {
+		return err
+	}
+
+	s.publish(ctx, model.EventLinkDeleted, rec)
+	recordAudit(ctx, s.audit, model.EventLinkDeleted, owner, code, &rec, nil)
+	return nil
+}
+
+func (s *shortener) List(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	if owner == "" {
+		// Anonymous links belong to no one, so there is no list to show.
+		return nil, nil
+	}
+	recs, err := s.r.ListByOwner(ctx, owner, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	s.attachChecks(ctx, recs)
+	s.attachMeta(ctx, recs)
+	return recs, nil
+}
+
+func (s *shortener) Export(ctx context.Context, owner, cursor string, limit int) ([]model.URLRecord, error) {
+	if owner == "" {
+		return nil, nil
+	}
+	return s.r.ListAfter(ctx, owner, cursor, limit)
+}
+
+// codesFor returns the code generator for owner's new links.
+func (s *shortener) codesFor(owner string) util.CodeGenerator {
+	if f := s.flagged; f.codes != nil && f.flags.Enabled(f.name, owner) {
+		return f.codes
+	}
+	return s.codes
+}
+
+// stripTracking returns long without tracking parameters when strip, or
+// the shortener's default if strip is nil, asks for it. original is long
+// as given when that changed it, and "" otherwise.
+func (s *shortener) stripTracking(long string, strip *bool) (stripped, original string) {
+	if strip == nil {
+		strip = &s.strip
+	}
+	if !*strip {
+		return long, ""
+	}
+	if stripped = stripTracking(long); stripped != long {
+		original = long
+	}
+	return stripped, original
+}
+
+// fetchTitle returns the destination page's title, or "" when titles are not
+// fetched or the page has none. Failures never block shortening.
+func (s *shortener) fetchTitle(ctx context.Context, long string) string {
+	if s.titles == nil || !web(long) {
+		return ""
+	}
+	title, err := s.titles.Title(ctx, long)
+	if err != nil {
+		return ""
+	}
+	return title
+}
+
+func (s *shortener) publish(ctx context.Context, event string, rec model.URLRecord) {
+	if s.events != nil {
+		s.events.Publish(ctx, event, rec)
+	}
+}
+
+// owned loads a link for modification by owner. Anonymous links have no owner
+// to edit them, and links of other owners look missing.
+func (s *shortener) owned(ctx context.Context, owner, code string) (model.URLRecord, error) {
 	rec, err := s.r.GetByCode(ctx, code)
 	if err != nil {
-		return "", err
+		return model.URLRecord{}, err
+	}
+	if owner == "" {
+		return model.URLRecord{}, ErrNotFound
+	}
+	if rec.Owner == owner {
+		return rec, nil
+	}
+	ok, err := isMember(ctx, s.orgs, rec.Org, owner)
+	if err != nil {
+		return model.URLRecord{}, err
+	}
+	if !ok {
+		return model.URLRecord{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// ETag is the entity tag of a link's current revision, derived from updated_at.
+func ETag(rec model.URLRecord) string {
+	return `"` + strconv.FormatInt(rec.UpdatedAt.UnixMicro(), 36) + `"`
+}
+
+// existing returns an already shortened record, unless it is disabled or
+// expired, or the request asks for options that differ from the ones it was
+// created with.
+func existing(rec model.URLRecord, opts LinkOptions) (model.URLRecord, bool, error) {
+	if !rec.Active {
+		// The code stays taken, and handing out a disabled link helps no one.
+		return model.URLRecord{}, false, ErrDisabled
+	}
+	if rec.Expired(time.Now()) {
+		// Taken until the cleanup worker purges it.
+		return model.URLRecord{}, false, ErrExpired
+	}
+	if len(opts.UTM) > 0 && !maps.Equal(rec.UTM, opts.UTM) {
+		return model.URLRecord{}, false, ErrConflict
+	}
+	if opts.ExpiresAt != nil && (rec.ExpiresAt == nil || !rec.ExpiresAt.Equal(*opts.ExpiresAt)) {
+		return model.URLRecord{}, false, ErrConflict
+	}
+	if opts.Org != rec.Org && opts.Org != "" {
+		return model.URLRecord{}, false, ErrConflict
+	}
+	if opts.MaxClicks != 0 && opts.MaxClicks != rec.MaxClicks {
+		return model.URLRecord{}, false, ErrConflict
+	}
+	if opts.FallbackURL != "" && opts.FallbackURL != rec.FallbackURL {
+		return model.URLRecord{}, false, ErrConflict
+	}
+	return rec, false, nil
+}
+
+// checkBan fails with ErrBanned when long points at a banned domain.
+func (s *shortener) checkBan(ctx context.Context, long string) error {
+	if s.bans == nil {
+		return nil
+	}
+	return checkBan(ctx, s.bans, long)
+}
+
+// checkBan returns ErrBanned when long's host is banned by bans.
+func checkBan(ctx context.Context, bans BanChecker, long string) error {
+	u, err := url.Parse(long)
+	if err != nil {
+		return err
+	}
+	banned, err := bans.IsBanned(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
+	return nil
+}
+
+// scan checks long against the configured scanner. Scanner outages fail open
+// and leave the link unchecked for the rescan job to pick up.
+func (s *shortener) scan(ctx context.Context, long string) (string, error) {
+	if s.scanner == nil {
+		return scan.StatusUnchecked, nil
 	}
 
-	return rec.LongUrl, nil
+	flagged, err := s.scanner.Check(ctx, []string{long})
+	if err != nil {
+		log.Printf("scan: %v", err)
+		return scan.StatusUnchecked, nil
+	}
+	if flagged[long] {
+		return scan.StatusFlagged, ErrFlagged
+	}
+	return scan.StatusClean, nil
 }
@@ -4,10 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/lib/pq"
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/feature"
 	"urlshortener/urlshortener/internal/model"
+	urlrepo "urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/reputation"
+	"urlshortener/urlshortener/internal/util"
 )
 
 // Mock repository for testing
@@ -17,7 +25,7 @@ type mockURLRepo struct {
 	insertError    error
 	getByLongError error
 	getByCodeError error
-	insertFunc     func(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error)
+	insertFunc     func(ctx context.Context, rec model.URLRecord) (model.URLRecord, error)
 }
 
 func newMockURLRepo() *mockURLRepo {
@@ -27,12 +35,12 @@ func newMockURLRepo() *mockURLRepo {
 	}
 }
 
-func (m *mockURLRepo) GetByLong(ctx context.Context, long string) (model.URLRecord, error) {
+func (m *mockURLRepo) GetByLong(ctx context.Context, domain, long string) (model.URLRecord, error) {
 	if m.getByLongError != nil {
 		return model.URLRecord{}, m.getByLongError
 	}
 
-	if rec, exists := m.urls[long]; exists {
+	if rec, exists := m.urls[long]; exists && rec.Domain == domain {
 		return rec, nil
 	}
 	return model.URLRecord{}, sql.ErrNoRows
@@ -49,45 +57,151 @@ func (m *mockURLRepo) GetByCode(ctx context.Context, code string) (model.URLReco
 	return model.URLRecord{}, sql.ErrNoRows
 }
 
-func (m *mockURLRepo) Insert(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error) {
+func (m *mockURLRepo) Insert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
 	// If custom insert function is provided, use it
 	if m.insertFunc != nil {
-		return m.insertFunc(ctx, id, code, long, short)
+		return m.insertFunc(ctx, rec)
 	}
 
 	if m.insertError != nil {
 		return model.URLRecord{}, m.insertError
 	}
 
-	// Check for code collision
-	if _, exists := m.codes[code]; exists {
-		pqErr := &pq.Error{
-			Code:   PgUniqueViolation,
-			Detail: "Key (code)=(" + code + ") already exists.",
-		}
-		return model.URLRecord{}, pqErr
+	return m.normalInsert(ctx, rec)
+}
+
+// Upsert behaves like the SQL repos: a taken destination comes back as the
+// existing record rather than an error.
+func (m *mockURLRepo) Upsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, bool, error) {
+	out, err := m.Insert(ctx, rec)
+	if errors.Is(err, urlrepo.ErrDuplicateLongURL) {
+		out, err = m.GetByLong(ctx, rec.Domain, rec.LongUrl)
+		return out, false, err
 	}
+	return out, err == nil, err
+}
 
-	// Check for long URL collision
-	if _, exists := m.urls[long]; exists {
-		pqErr := &pq.Error{
-			Code:   PgUniqueViolation,
-			Detail: "Key (long_url)=(" + long + ") already exists.",
+func (m *mockURLRepo) Update(ctx context.Context, rec model.URLRecord, prev time.Time) (model.URLRecord, error) {
+	old, exists := m.codes[rec.Code]
+	if !exists || !old.UpdatedAt.Equal(prev) {
+		return model.URLRecord{}, sql.ErrNoRows
+	}
+	if other, exists := m.urls[rec.LongUrl]; exists && other.Code != rec.Code {
+		return model.URLRecord{}, urlrepo.ErrDuplicateLongURL
+	}
+	delete(m.urls, old.LongUrl)
+	rec.UpdatedAt = prev.Add(time.Second)
+	m.codes[rec.Code] = rec
+	m.urls[rec.LongUrl] = rec
+	return rec, nil
+}
+
+func (m *mockURLRepo) SetActive(ctx context.Context, code string, active bool) (model.URLRecord, error) {
+	rec, exists := m.codes[code]
+	if !exists {
+		return model.URLRecord{}, sql.ErrNoRows
+	}
+	rec.Active = active
+	rec.UpdatedAt = rec.UpdatedAt.Add(time.Second)
+	m.codes[code] = rec
+	m.urls[rec.LongUrl] = rec
+	return rec, nil
+}
+
+func (m *mockURLRepo) TakeClick(ctx context.Context, code string) (model.URLRecord, error) {
+	rec, exists := m.codes[code]
+	if !exists || !rec.Active || rec.MaxClicks <= 0 || rec.Exhausted() {
+		return model.URLRecord{}, sql.ErrNoRows
+	}
+	rec.ClickCount++
+	rec.Active = !rec.Exhausted()
+	m.codes[code] = rec
+	m.urls[rec.LongUrl] = rec
+	return rec, nil
+}
+
+func (m *mockURLRepo) Delete(ctx context.Context, code string) error {
+	rec, exists := m.codes[code]
+	if !exists {
+		return sql.ErrNoRows
+	}
+	delete(m.codes, code)
+	delete(m.urls, rec.LongUrl)
+	return nil
+}
+
+func (m *mockURLRepo) ListByOwner(ctx context.Context, owner, query string, limit, offset int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	for _, rec := range m.codes {
+		if rec.Owner == owner && strings.Contains(rec.LongUrl, query) {
+			recs = append(recs, rec)
 		}
-		return model.URLRecord{}, pqErr
 	}
+	return recs, nil
+}
 
-	rec := model.URLRecord{
-		ID:       id,
-		Code:     code,
-		LongUrl:  long,
-		ShortUrl: short,
+func (m *mockURLRepo) ListAfter(ctx context.Context, owner, after string, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	for code, rec := range m.codes {
+		if rec.Owner == owner && code > after {
+			recs = append(recs, rec)
+		}
 	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Code < recs[j].Code })
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
 
-	m.urls[long] = rec
+func (m *mockURLRepo) UpdateScanStatus(ctx context.Context, code string, status string) error {
+	rec, exists := m.codes[code]
+	if !exists {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	rec.ScanStatus = status
+	rec.ScannedAt = &now
 	m.codes[code] = rec
+	m.urls[rec.LongUrl] = rec
+	return nil
+}
 
-	return rec, nil
+func (m *mockURLRepo) ListForScan(ctx context.Context, before time.Time, limit int) ([]model.URLRecord, error) {
+	var recs []model.URLRecord
+	for _, rec := range m.codes {
+		if rec.ScanStatus != "flagged" && len(recs) < limit {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+func (m *mockURLRepo) DeleteStale(ctx context.Context, expiredBefore, disabledBefore time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (m *mockURLRepo) EachCode(ctx context.Context, fn func(code string) error) error {
+	return nil
+}
+
+// Mock scanner flagging a fixed set of URLs
+type mockScanner struct {
+	flagged map[string]bool
+	err     error
+}
+
+func (m *mockScanner) Check(ctx context.Context, urls []string) (map[string]bool, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	out := make(map[string]bool)
+	for _, u := range urls {
+		if m.flagged[u] {
+			out[u] = true
+		}
+	}
+	return out, nil
 }
 
 func TestShortener_Shorten_NewURL(t *testing.T) {
@@ -98,7 +212,7 @@ func TestShortener_Shorten_NewURL(t *testing.T) {
 	baseURL := "https://shawt.ly/"
 	longURL := "https://example.com/very/long/url"
 
-	rec, created, err := s.Shorten(ctx, baseURL, longURL)
+	rec, created, err := s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -129,7 +243,7 @@ func TestShortener_Shorten_ExistingURL(t *testing.T) {
 	longURL := "https://example.com/existing"
 
 	// First call - should create
-	rec1, created1, err1 := s.Shorten(ctx, baseURL, longURL)
+	rec1, created1, err1 := s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 	if err1 != nil {
 		t.Fatalf("First call failed: %v", err1)
 	}
@@ -138,7 +252,7 @@ func TestShortener_Shorten_ExistingURL(t *testing.T) {
 	}
 
 	// Second call - should return existing
-	rec2, created2, err2 := s.Shorten(ctx, baseURL, longURL)
+	rec2, created2, err2 := s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 	if err2 != nil {
 		t.Errorf("Second call failed: %v", err2)
 	}
@@ -160,6 +274,7 @@ func TestShortener_Shorten_CodeCollision(t *testing.T) {
 		Code:     "ABC123",
 		LongUrl:  "https://example.com/existing",
 		ShortUrl: "https://shawt.ly/ABC123",
+		Active:   true,
 	}
 	repo.codes[existingRec.Code] = existingRec
 	repo.urls[existingRec.LongUrl] = existingRec
@@ -172,20 +287,16 @@ func TestShortener_Shorten_CodeCollision(t *testing.T) {
 
 	// Override insert to simulate code collision on first attempt
 	callCount := 0
-	repo.insertFunc = func(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error) {
+	repo.insertFunc = func(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
 		callCount++
-		if callCount == 1 && code == "ABC123" {
-			pqErr := &pq.Error{
-				Code:   PgUniqueViolation,
-				Detail: "Key (code)=(" + code + ") already exists.",
-			}
-			return model.URLRecord{}, pqErr
+		if callCount == 1 && rec.Code == "ABC123" {
+			return model.URLRecord{}, urlrepo.ErrDuplicateCode
 		}
 		// For subsequent calls, use the normal logic
-		return repo.normalInsert(ctx, id, code, long, short)
+		return repo.normalInsert(ctx, rec)
 	}
 
-	rec, created, err := s.Shorten(ctx, baseURL, longURL)
+	rec, created, err := s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 	if err != nil {
 		t.Errorf("Expected no error after retry, got %v", err)
 	}
@@ -200,46 +311,74 @@ func TestShortener_Shorten_CodeCollision(t *testing.T) {
 }
 
 // normalInsert is the default insert behavior
-func (m *mockURLRepo) normalInsert(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error) {
+func (m *mockURLRepo) normalInsert(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
 	// Check for code collision
-	if _, exists := m.codes[code]; exists {
-		pqErr := &pq.Error{
-			Code:   PgUniqueViolation,
-			Detail: "Key (code)=(" + code + ") already exists.",
-		}
-		return model.URLRecord{}, pqErr
+	if _, exists := m.codes[rec.Code]; exists {
+		return model.URLRecord{}, urlrepo.ErrDuplicateCode
 	}
 
 	// Check for long URL collision
-	if _, exists := m.urls[long]; exists {
-		pqErr := &pq.Error{
-			Code:   PgUniqueViolation,
-			Detail: "Key (long_url)=(" + long + ") already exists.",
-		}
-		return model.URLRecord{}, pqErr
+	if _, exists := m.urls[rec.LongUrl]; exists {
+		return model.URLRecord{}, urlrepo.ErrDuplicateLongURL
 	}
 
-	rec := model.URLRecord{
-		ID:       id,
-		Code:     code,
-		LongUrl:  long,
-		ShortUrl: short,
+	rec.Active = true
+	m.urls[rec.LongUrl] = rec
+	m.codes[rec.Code] = rec
+
+	return rec, nil
+}
+
+func TestShortener_Shorten_HashCodes(t *testing.T) {
+	repo := newMockURLRepo()
+	ctx := context.Background()
+	codes := util.HashCodes{Length: 6}
+	long := "https://example.com/hashed"
+	first, _ := codes.Generate(ctx, "", long, 0)
+	second, _ := codes.Generate(ctx, "", long, 1)
+	third, _ := codes.Generate(ctx, "", long, 2)
+
+	// The first candidate is taken and the second reserved.
+	repo.codes[first] = model.URLRecord{Code: first, LongUrl: "https://example.com/other"}
+	s := NewShortener(repo, WithCodes(codes), WithReserved(util.NewReserved([]string{second})))
+
+	rec, created, err := s.Shorten(ctx, "https://shawt.ly/", long, LinkOptions{})
+	if err != nil || !created {
+		t.Fatalf("Expected a new link, got created=%v, %v", created, err)
+	}
+	if rec.Code != third {
+		t.Errorf("Expected the third candidate %s, got %s", third, rec.Code)
 	}
 
-	m.urls[long] = rec
-	m.codes[code] = rec
+	// Shortening it again finds the link by storing it.
+	again, created, err := s.Shorten(ctx, "https://shawt.ly/", long, LinkOptions{})
+	if err != nil || created || again.Code != rec.Code {
+		t.Errorf("Expected existing link %s, got %s (created=%v, err=%v)", rec.Code, again.Code, created, err)
+	}
+}
 
-	return rec, nil
+func TestShortener_Shorten_FlaggedCodes(t *testing.T) {
+	flags := feature.New(nil, map[string]model.FeatureFlag{"long_codes": {Owners: []string{"alice"}}})
+	s := NewShortener(newMockURLRepo(), WithCodes(util.RandomCodes{Length: 4}),
+		WithFlaggedCodes(flags, "long_codes", util.RandomCodes{Length: 10}))
+	ctx := context.Background()
+
+	for owner, length := range map[string]int{"alice": 10, "bob": 4} {
+		rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/"+owner, LinkOptions{Owner: owner})
+		if err != nil {
+			t.Fatalf("Shorten for %s: %v", owner, err)
+		}
+		if len(rec.Code) != length {
+			t.Errorf("Expected a %d-character code for %s, got %q", length, owner, rec.Code)
+		}
+	}
 }
 
 func TestShortener_Shorten_MaxRetries(t *testing.T) {
 	repo := newMockURLRepo()
 
 	// Set up repo to always return code collision
-	repo.insertError = &pq.Error{
-		Code:   PgUniqueViolation,
-		Detail: "Key (code)=(test) already exists.",
-	}
+	repo.insertError = urlrepo.ErrDuplicateCode
 
 	s := NewShortener(repo)
 
@@ -247,7 +386,7 @@ func TestShortener_Shorten_MaxRetries(t *testing.T) {
 	baseURL := "https://shawt.ly/"
 	longURL := "https://example.com/test"
 
-	_, created, err := s.Shorten(ctx, baseURL, longURL)
+	_, created, err := s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 
 	if err == nil {
 		t.Error("Expected error after max retries")
@@ -272,27 +411,24 @@ func TestShortener_Shorten_LongURLCollisionRace(t *testing.T) {
 	longURL := "https://example.com/race"
 
 	// Override insert to simulate long URL collision
-	repo.insertFunc = func(ctx context.Context, id string, code string, long string, short string) (model.URLRecord, error) {
+	repo.insertFunc = func(ctx context.Context, rec model.URLRecord) (model.URLRecord, error) {
+		long := rec.LongUrl
 		// Simulate race condition - another request inserted the same long URL
-		pqErr := &pq.Error{
-			Code:   PgUniqueViolation,
-			Detail: "Key (long_url)=(" + long + ") already exists.",
-		}
-
 		// Add the record to simulate it was inserted by another request
 		existingRec := model.URLRecord{
 			ID:       "race-id",
 			Code:     "RACE01",
 			LongUrl:  long,
 			ShortUrl: baseURL + "RACE01",
+			Active:   true,
 		}
 		repo.urls[long] = existingRec
 		repo.codes["RACE01"] = existingRec
 
-		return model.URLRecord{}, pqErr
+		return model.URLRecord{}, urlrepo.ErrDuplicateLongURL
 	}
 
-	rec, created, err := s.Shorten(ctx, baseURL, longURL)
+	rec, created, err := s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -315,13 +451,14 @@ func TestShortener_Resolve_Success(t *testing.T) {
 		Code:     "TEST01",
 		LongUrl:  "https://example.com/test",
 		ShortUrl: "https://shawt.ly/TEST01",
+		Active:   true,
 	}
 	repo.codes[rec.Code] = rec
 
 	s := NewShortener(repo)
 
 	ctx := context.Background()
-	longURL, err := s.Resolve(ctx, "TEST01")
+	longURL, err := s.Resolve(ctx, "", "TEST01")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -336,7 +473,7 @@ func TestShortener_Resolve_NotFound(t *testing.T) {
 	s := NewShortener(repo)
 
 	ctx := context.Background()
-	_, err := s.Resolve(ctx, "NOTFOUND")
+	_, err := s.Resolve(ctx, "", "NOTFOUND")
 
 	if err == nil {
 		t.Error("Expected error for non-existent code")
@@ -354,7 +491,7 @@ func TestShortener_Resolve_RepoError(t *testing.T) {
 	s := NewShortener(repo)
 
 	ctx := context.Background()
-	_, err := s.Resolve(ctx, "TEST01")
+	_, err := s.Resolve(ctx, "", "TEST01")
 
 	if err == nil {
 		t.Error("Expected error from repository")
@@ -375,7 +512,7 @@ func BenchmarkShortener_Shorten(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		longURL := "https://example.com/benchmark/" + string(rune(i))
-		s.Shorten(ctx, baseURL, longURL)
+		s.Shorten(ctx, baseURL, longURL, LinkOptions{})
 	}
 }
 
@@ -388,6 +525,7 @@ func BenchmarkShortener_Resolve(b *testing.B) {
 		rec := model.URLRecord{
 			Code:    code,
 			LongUrl: "https://example.com/" + string(rune(i)),
+			Active:  true,
 		}
 		repo.codes[code] = rec
 	}
@@ -398,6 +536,595 @@ func BenchmarkShortener_Resolve(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		code := "CODE" + string(rune(i%1000))
-		s.Resolve(ctx, code)
+		s.Resolve(ctx, "", code)
+	}
+}
+
+func TestShortener_Shorten_ScannerFlagged(t *testing.T) {
+	repo := newMockURLRepo()
+	sc := &mockScanner{flagged: map[string]bool{"https://malware.example/": true}}
+	s := NewShortener(repo, WithScanner(sc))
+
+	_, created, err := s.Shorten(context.Background(), "https://shawt.ly/", "https://malware.example/", LinkOptions{})
+	if !errors.Is(err, ErrFlagged) {
+		t.Fatalf("Expected ErrFlagged, got %v", err)
+	}
+	if created {
+		t.Error("Expected created to be false for flagged URL")
+	}
+	if len(repo.codes) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d records", len(repo.codes))
+	}
+}
+
+func TestShortener_Shorten_ScannerClean(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo, WithScanner(&mockScanner{}))
+
+	rec, _, err := s.Shorten(context.Background(), "https://shawt.ly/", "https://example.com/clean", LinkOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rec.ScanStatus != "clean" {
+		t.Errorf("Expected scan status clean, got %q", rec.ScanStatus)
+	}
+	if repo.codes[rec.Code].ScanStatus != "clean" {
+		t.Errorf("Expected stored scan status clean, got %q", repo.codes[rec.Code].ScanStatus)
+	}
+}
+
+func TestShortener_Shorten_ScannerErrorFailsOpen(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo, WithScanner(&mockScanner{err: errors.New("provider down")}))
+
+	rec, created, err := s.Shorten(context.Background(), "https://shawt.ly/", "https://example.com/unknown", LinkOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !created {
+		t.Error("Expected link to be created")
+	}
+	if rec.ScanStatus == "clean" {
+		t.Error("Expected scan status to stay unchecked when the scanner fails")
+	}
+}
+
+func TestShortener_Resolve_Flagged(t *testing.T) {
+	repo := newMockURLRepo()
+	repo.codes["BAD001"] = model.URLRecord{Code: "BAD001", LongUrl: "https://malware.example/", ScanStatus: "flagged", Active: true}
+	s := NewShortener(repo)
+
+	if _, err := s.Resolve(context.Background(), "", "BAD001"); !errors.Is(err, ErrFlagged) {
+		t.Errorf("Expected ErrFlagged, got %v", err)
+	}
+}
+
+func TestShortener_Shorten_UTMConflict(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo)
+	ctx := context.Background()
+	utm := map[string]string{"utm_source": "newsletter"}
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{UTM: utm})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+
+	// Same parameters, or none at all, return the existing link.
+	for _, opts := range []LinkOptions{{UTM: utm}, {}} {
+		again, created, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", opts)
+		if err != nil || created || again.Code != rec.Code {
+			t.Errorf("Expected existing link %s, got %s (created=%v, err=%v)", rec.Code, again.Code, created, err)
+		}
+	}
+
+	_, _, err = s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{UTM: map[string]string{"utm_source": "ads"}})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+}
+
+func TestShortener_Resolve_AppendsUTM(t *testing.T) {
+	tests := []struct {
+		long string
+		utm  map[string]string
+		want string
+	}{
+		{"https://example.com/", nil, "https://example.com/"},
+		{"https://example.com/", map[string]string{"utm_source": "news letter"}, "https://example.com/?utm_source=news+letter"},
+		{"https://example.com/p?b=2&a=1", map[string]string{"utm_medium": "email"}, "https://example.com/p?b=2&a=1&utm_medium=email"},
+		{"https://example.com/?utm_source=old&x=1", map[string]string{"utm_source": "new"}, "https://example.com/?x=1&utm_source=new"},
+		{"https://example.com/?q=%2F#top", map[string]string{"utm_campaign": "spring", "utm_content": "a"}, "https://example.com/?q=%2F&utm_campaign=spring&utm_content=a#top"},
+	}
+
+	for _, tt := range tests {
+		repo := newMockURLRepo()
+		repo.codes["UTM001"] = model.URLRecord{Code: "UTM001", LongUrl: tt.long, UTM: tt.utm, Active: true}
+		s := NewShortener(repo)
+
+		got, err := s.Resolve(context.Background(), "", "UTM001")
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%s, %v) = %s, want %s", tt.long, tt.utm, got, tt.want)
+		}
+	}
+}
+
+func TestShortener_Shorten_Unique(t *testing.T) {
+	s := NewShortener(urlrepo.NewMemory())
+	ctx := context.Background()
+
+	shared, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	first, created, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{Unique: true})
+	if err != nil || !created || first.Code == shared.Code {
+		t.Fatalf("Expected a new link, got %s (created=%v, err=%v)", first.Code, created, err)
+	}
+	second, created, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{Unique: true})
+	if err != nil || !created || second.Code == first.Code {
+		t.Errorf("Expected yet another link, got %s (created=%v, err=%v)", second.Code, created, err)
+	}
+
+	again, created, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{})
+	if err != nil || created || again.Code != shared.Code {
+		t.Errorf("Expected the shared link %s, got %s (created=%v, err=%v)", shared.Code, again.Code, created, err)
+	}
+}
+
+func TestShortener_MaxClicks(t *testing.T) {
+	s := NewShortener(urlrepo.NewMemory())
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{MaxClicks: 3})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var ok, limited int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Resolve(ctx, "", rec.Code)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case errors.Is(err, ErrClickLimit):
+				limited++
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 3 || limited != 7 {
+		t.Errorf("Expected 3 redirects and 7 refusals, got %d and %d", ok, limited)
+	}
+
+	if _, err := s.Lookup(ctx, "", rec.Code); !errors.Is(err, ErrClickLimit) {
+		t.Errorf("Expected ErrClickLimit once the clicks are used up, got %v", err)
+	}
+}
+
+func TestShortener_FallbackURL(t *testing.T) {
+	s := NewShortener(urlrepo.NewMemory())
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/sale", LinkOptions{Owner: "alice", MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if _, err := s.Resolve(ctx, "", rec.Code); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	var fe *FallbackError
+	if _, err := s.Lookup(ctx, "", rec.Code); !errors.Is(err, ErrClickLimit) || errors.As(err, &fe) {
+		t.Errorf("Expected a plain ErrClickLimit without a fallback, got %v", err)
+	}
+
+	fallback := "https://example.com/sold-out"
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{FallbackURL: &fallback}, ""); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	_, err = s.Lookup(ctx, "", rec.Code)
+	if !errors.As(err, &fe) || fe.URL != fallback || !errors.Is(err, ErrClickLimit) {
+		t.Errorf("Expected the fallback wrapping ErrClickLimit, got %v", err)
+	}
+
+	if _, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/other", LinkOptions{FallbackURL: fallback}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if _, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/other", LinkOptions{FallbackURL: "https://example.com/"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict for a different fallback, got %v", err)
+	}
+}
+
+func TestShortener_Find(t *testing.T) {
+	s := NewShortener(urlrepo.NewMemory(), WithStripTracking(true))
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/a", LinkOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if found, err := s.Find(ctx, "", "https://example.com/a?utm_source=x"); err != nil || found.Code != rec.Code {
+		t.Errorf("Expected %s, got %s, %v", rec.Code, found.Code, err)
+	}
+	if _, err := s.Find(ctx, "other.example", "https://example.com/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on another domain, got %v", err)
+	}
+
+	if _, err := s.SetActive(ctx, "alice", rec.Code, false); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+	if _, err := s.Find(ctx, "", "https://example.com/a"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestShortener_StripTracking(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo, WithStripTracking(true))
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/p?UTM_Source=x&id=1&fbclid=abc&gclid=def#top", LinkOptions{})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if rec.LongUrl != "https://example.com/p?id=1#top" || rec.OriginalURL != "https://example.com/p?UTM_Source=x&id=1&fbclid=abc&gclid=def#top" {
+		t.Errorf("Expected tracking parameters stripped and the original kept, got %q / %q", rec.LongUrl, rec.OriginalURL)
+	}
+
+	// Another campaign's copy of the URL is the same link.
+	again, created, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/p?id=1&utm_medium=email#top", LinkOptions{})
+	if err != nil || created || again.Code != rec.Code {
+		t.Errorf("Expected existing link %s, got %s (created=%v, err=%v)", rec.Code, again.Code, created, err)
+	}
+
+	keep := false
+	rec, _, err = s.Shorten(ctx, "https://shawt.ly/", "https://example.com/?utm_source=x", LinkOptions{StripTracking: &keep})
+	if err != nil || rec.LongUrl != "https://example.com/?utm_source=x" || rec.OriginalURL != "" {
+		t.Errorf("Expected the request to keep its parameters, got %+v, %v", rec, err)
+	}
+
+	rec, _, err = s.Shorten(ctx, "https://shawt.ly/", "https://example.com/clean", LinkOptions{})
+	if err != nil || rec.OriginalURL != "" {
+		t.Errorf("Expected no original URL when nothing was stripped, got %q, %v", rec.OriginalURL, err)
+	}
+}
+
+func TestShortener_Update(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo)
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/old", LinkOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if rec.Owner != "alice" {
+		t.Fatalf("Expected owner alice, got %q", rec.Owner)
+	}
+
+	if _, err := s.Update(ctx, "bob", rec.Code, LinkEdit{LongURL: "https://example.com/new"}, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected foreign link to look missing, got %v", err)
+	}
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/new"}, `"stale"`); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+
+	updated, err := s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/new"}, ETag(rec))
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.LongUrl != "https://example.com/new" || updated.Code != rec.Code {
+		t.Errorf("Expected %s to point at the new URL, got %+v", rec.Code, updated)
+	}
+	if ETag(updated) == ETag(rec) {
+		t.Error("Expected the ETag to change after an update")
+	}
+
+	// The old revision is now stale.
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/newer"}, ETag(rec)); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed for stale ETag, got %v", err)
+	}
+}
+
+type stubTitles map[string]string
+
+func (s stubTitles) Title(ctx context.Context, url string) (string, error) {
+	if t, ok := s[url]; ok {
+		return t, nil
+	}
+	return "", errors.New("unreachable")
+}
+
+func TestShortener_Titles(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo, WithTitles(stubTitles{"https://example.com/docs": "Docs"}))
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/docs", LinkOptions{Owner: "alice", Description: "for the wiki"})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if rec.Title != "Docs" || rec.Description != "for the wiki" {
+		t.Errorf("Expected fetched title and given description, got %q / %q", rec.Title, rec.Description)
+	}
+
+	rec, _, err = s.Shorten(ctx, "https://shawt.ly/", "https://example.com/down", LinkOptions{Owner: "alice", Title: "Mine"})
+	if err != nil || rec.Title != "Mine" {
+		t.Errorf("Expected the given title to win, got %q, %v", rec.Title, err)
+	}
+	if rec, _, _ = s.Shorten(ctx, "https://shawt.ly/", "https://example.com/gone", LinkOptions{}); rec.Title != "" {
+		t.Errorf("Expected a failed fetch to leave the title empty, got %q", rec.Title)
+	}
+
+	title := "Renamed"
+	updated, err := s.Update(ctx, "alice", rec.Code, LinkEdit{Title: &title}, "")
+	if err == nil {
+		t.Errorf("Expected the anonymous link to be out of reach, got %+v", updated)
+	}
+
+	docs, _ := repo.GetByLong(ctx, "", "https://example.com/docs")
+	updated, err = s.Update(ctx, "alice", docs.Code, LinkEdit{Title: &title}, "")
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.Title != "Renamed" || updated.Description != "for the wiki" || updated.LongUrl != "https://example.com/docs" {
+		t.Errorf("Expected only the title to change, got %+v", updated)
+	}
+}
+
+func TestShortener_Update_Conflict(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo)
+	ctx := context.Background()
+
+	a, _, _ := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/a", LinkOptions{Owner: "alice"})
+	s.Shorten(ctx, "https://shawt.ly/", "https://example.com/b", LinkOptions{Owner: "alice"})
+
+	if _, err := s.Update(ctx, "alice", a.Code, LinkEdit{LongURL: "https://example.com/b"}, ""); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+}
+
+func TestShortener_Update_AnonymousLink(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo)
+	ctx := context.Background()
+
+	rec, _, _ := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/anon", LinkOptions{})
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/mine"}, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected anonymous link to be uneditable, got %v", err)
+	}
+}
+
+func TestShortener_SetActive(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo)
+	ctx := context.Background()
+
+	rec, _, _ := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/abuse", LinkOptions{Owner: "alice"})
+
+	if _, err := s.SetActive(ctx, "bob", rec.Code, false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected foreign link to look missing, got %v", err)
+	}
+
+	if _, err := s.SetActive(ctx, "alice", rec.Code, false); err != nil {
+		t.Fatalf("Disable failed: %v", err)
+	}
+	if _, err := s.Resolve(ctx, "", rec.Code); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+	if _, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/abuse", LinkOptions{}); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected re-shortening a disabled link to fail, got %v", err)
+	}
+
+	if _, err := s.SetActive(ctx, "alice", rec.Code, true); err != nil {
+		t.Fatalf("Enable failed: %v", err)
+	}
+	if long, err := s.Resolve(ctx, "", rec.Code); err != nil || long != "https://example.com/abuse" {
+		t.Errorf("Expected link to resolve again, got %q, %v", long, err)
+	}
+}
+
+type recordedEvents []string
+
+func (r *recordedEvents) Publish(ctx context.Context, event string, data any) {
+	*r = append(*r, event)
+}
+
+func TestShortener_PublishesEvents(t *testing.T) {
+	repo := newMockURLRepo()
+	events := &recordedEvents{}
+	s := NewShortener(repo, WithEvents(events))
+	ctx := context.Background()
+
+	rec, _, _ := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/ev", LinkOptions{Owner: "alice"})
+	s.Shorten(ctx, "https://shawt.ly/", "https://example.com/ev", LinkOptions{Owner: "alice"})
+	s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/ev2"}, "")
+	s.SetActive(ctx, "alice", rec.Code, false)
+	s.SetActive(ctx, "alice", rec.Code, true)
+	s.SetActive(ctx, "bob", rec.Code, false)
+
+	want := []string{model.EventLinkCreated, model.EventLinkUpdated, model.EventLinkDisabled, model.EventLinkEnabled}
+	if len(*events) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, *events)
+	}
+	for i := range want {
+		if (*events)[i] != want[i] {
+			t.Errorf("Expected event %d to be %s, got %s", i, want[i], (*events)[i])
+		}
+	}
+}
+
+func TestShortener_Expiry(t *testing.T) {
+	repo := newMockURLRepo()
+	s := NewShortener(repo)
+	ctx := context.Background()
+
+	soon := time.Now().Add(time.Hour)
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/sale", LinkOptions{ExpiresAt: &soon})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if _, err := s.Resolve(ctx, "", rec.Code); err != nil {
+		t.Errorf("Expected link to resolve before expiry, got %v", err)
+	}
+
+	later := soon.Add(time.Hour)
+	if _, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/sale", LinkOptions{ExpiresAt: &later}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict for a different expiry, got %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	rec.ExpiresAt = &past
+	repo.codes[rec.Code] = rec
+	repo.urls[rec.LongUrl] = rec
+
+	if _, err := s.Resolve(ctx, "", rec.Code); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if _, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/sale", LinkOptions{}); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected re-shortening an expired link to fail, got %v", err)
+	}
+}
+
+func TestShortener_LinkCache(t *testing.T) {
+	r := newMockURLRepo()
+	links := urlrepo.WithLinkCache(r, cache.NewMemoryStore(100, time.Minute))
+	s := NewShortener(links, WithLinkCache(links))
+	ctx := context.Background()
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/", LinkOptions{})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	// The database has not caught up with the write yet.
+	r.getByCodeError = ErrNotFound
+	if long, err := s.Resolve(ctx, "", rec.Code); err != nil || long != "https://example.com/" {
+		t.Errorf("Expected the new link to redirect at once, got %q (%v)", long, err)
+	}
+}
+
+type mockReputation map[string]int
+
+func (m mockReputation) Check(ctx context.Context, host string) (reputation.Result, error) {
+	score, ok := m[host]
+	if !ok {
+		return reputation.Result{}, errors.New("provider down")
+	}
+	return reputation.Result{Score: score, Reasons: []string{"test"}}, nil
+}
+
+func TestShortener_Reputation(t *testing.T) {
+	ctx := context.Background()
+	r := urlrepo.NewMemory()
+	rep := mockReputation{"good.example": 90, "bad.example": 20}
+	s := NewShortener(r, WithReputation(rep, 50, r))
+
+	rec, created, err := s.Shorten(ctx, "https://shawt.ly/", "https://bad.example/x", LinkOptions{Owner: "alice"})
+	if err != nil || !created || rec.Active {
+		t.Fatalf("Expected a new disabled link, got %+v, %v (%v)", rec, created, err)
+	}
+	if rev, err := r.GetReview(ctx, rec.Code); err != nil || rev.Score != 20 || rev.Owner != "alice" || rev.Domain != "bad.example" {
+		t.Errorf("Expected the link held with its score, got %+v (%v)", rev, err)
+	}
+	if _, err := s.Lookup(ctx, "", rec.Code); !errors.Is(err, ErrUnderReview) {
+		t.Errorf("Expected ErrUnderReview, got %v", err)
+	}
+	if _, err := s.SetActive(ctx, "alice", rec.Code, true); !errors.Is(err, ErrUnderReview) {
+		t.Errorf("Expected the owner not to enable a held link, got %v", err)
+	}
+
+	good, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://good.example/x", LinkOptions{Owner: "alice"})
+	if err != nil || !good.Active {
+		t.Fatalf("Expected an active link, got %+v (%v)", good, err)
+	}
+	updated, err := s.Update(ctx, "alice", good.Code, LinkEdit{LongURL: "https://bad.example/y"}, "")
+	if err != nil || updated.Active {
+		t.Errorf("Expected moving the link to a doubtful domain to hold it, got %+v (%v)", updated, err)
+	}
+
+	unknown, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://unknown.example/x", LinkOptions{})
+	if err != nil || !unknown.Active {
+		t.Errorf("Expected scoring to fail open, got %+v (%v)", unknown, err)
+	}
+}
+
+type mockLiveness map[string]int
+
+func (m mockLiveness) Check(ctx context.Context, url string) model.LinkCheck {
+	status := m[url]
+	return model.LinkCheck{Status: status, Dead: status == 0 || status == 404, CheckedAt: time.Now()}
+}
+
+func TestShortener_Liveness(t *testing.T) {
+	ctx := context.Background()
+	r := urlrepo.NewMemory()
+	live := mockLiveness{"https://example.com/up": 200, "https://example.com/gone": 404}
+	s := NewShortener(r, WithLiveness(live, r, false))
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/up", LinkOptions{Owner: "alice"})
+	if err != nil || rec.Liveness == nil || rec.Liveness.Status != 200 || rec.Liveness.Dead {
+		t.Fatalf("Expected a live check with the link, got %+v (%v)", rec.Liveness, err)
+	}
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/gone"}, ""); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	recs, err := s.List(ctx, "alice", "", 10, 0)
+	if err != nil || len(recs) != 1 || recs[0].Liveness == nil || !recs[0].Liveness.Dead {
+		t.Errorf("Expected the list to flag the new destination dead, got %+v (%v)", recs, err)
+	}
+	if got, err := s.Get(ctx, "alice", rec.Code); err != nil || got.Liveness == nil || got.Liveness.Status != 404 {
+		t.Errorf("Expected Get to carry the check, got %+v (%v)", got.Liveness, err)
+	}
+
+	strict := NewShortener(r, WithLiveness(live, r, true))
+	if _, _, err := strict.Shorten(ctx, "https://shawt.ly/", "https://example.com/nowhere", LinkOptions{}); !errors.Is(err, ErrDeadDestination) {
+		t.Errorf("Expected ErrDeadDestination, got %v", err)
+	}
+	if rec, _, err := strict.Shorten(ctx, "https://shawt.ly/", "myapp://item/42", LinkOptions{}); err != nil || rec.Liveness != nil {
+		t.Errorf("Expected app links to go unchecked, got %+v (%v)", rec.Liveness, err)
+	}
+}
+
+type mockMetaQueue []string
+
+func (q *mockMetaQueue) Enqueue(code, url string) { *q = append(*q, code+" "+url) }
+
+func TestShortener_PageMeta(t *testing.T) {
+	ctx := context.Background()
+	r := urlrepo.NewMemory()
+	var queue mockMetaQueue
+	s := NewShortener(r, WithPageMeta(&queue, r))
+
+	rec, _, err := s.Shorten(ctx, "https://shawt.ly/", "https://example.com/a", LinkOptions{Owner: "alice"})
+	if err != nil {
+		t.Fatalf("Shorten: %v", err)
+	}
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{Title: new(string)}, ""); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := s.Update(ctx, "alice", rec.Code, LinkEdit{LongURL: "https://example.com/b"}, ""); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if len(queue) != 2 || queue[0] != rec.Code+" https://example.com/a" || queue[1] != rec.Code+" https://example.com/b" {
+		t.Errorf("Expected new destinations queued, got %v", queue)
+	}
+
+	r.SavePageMeta(ctx, model.PageMeta{Code: rec.Code, Title: "B", FetchedAt: time.Now()})
+	recs, err := s.List(ctx, "alice", "", 10, 0)
+	if err != nil || len(recs) != 1 || recs[0].Meta == nil || recs[0].Meta.Title != "B" {
+		t.Errorf("Expected the list to carry the metadata, got %+v (%v)", recs, err)
 	}
 }
@@ -0,0 +1,47 @@
+package testutil
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MigrationsDir returns the absolute path of the Postgres migrations, so tests
+// can apply the real schema regardless of their working directory.
+func MigrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "db", "migration")
+}
+
+// ApplyMigrations runs every V<n>__*.sql file in version order. The migrations
+// are written to be idempotent, so this is safe against an existing schema.
+func ApplyMigrations(db *sql.DB) error {
+	files, err := filepath.Glob(filepath.Join(MigrationsDir(), "V*__*.sql"))
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return migrationVersion(files[i]) < migrationVersion(files[j]) })
+
+	for _, f := range files {
+		script, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(string(script)); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+	}
+	return nil
+}
+
+func migrationVersion(path string) int {
+	name := strings.TrimPrefix(filepath.Base(path), "V")
+	v, _ := strconv.Atoi(name[:strings.Index(name, "__")])
+	return v
+}
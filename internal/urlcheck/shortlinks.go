@@ -0,0 +1,225 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+var (
+	// ErrShortLink is returned for destinations that are short links
+	// themselves when they may not be shortened again.
+	ErrShortLink = errors.New("URL is already a short link")
+	// ErrUnwrap is returned when a short link does not lead to a destination
+	// off link shorteners within the allowed number of redirects.
+	ErrUnwrap = errors.New("Short link could not be resolved")
+	// ErrRedirectLoop is returned for destinations that lead back to this
+	// server, through its own domains, a DNS alias of them or other link
+	// shorteners, or that redirect in a circle.
+	ErrRedirectLoop = errors.New("URL redirects in a loop or back to this shortener")
+)
+
+// LocalResolver returns the destination of one of this server's own short
+// links, so unwrapping them needs no request to ourselves.
+type LocalResolver func(ctx context.Context, u *url.URL) (string, error)
+
+// shortLinks holds the short link policy of a Checker.
+type shortLinks struct {
+	policy       string
+	shorteners   []string
+	own          map[string]bool
+	maxRedirects int
+	timeout      time.Duration
+	client       *http.Client
+	cname        func(ctx context.Context, host string) (string, error)
+}
+
+func newShortLinks(cfg config.Config) shortLinks {
+	own := map[string]bool{}
+	if host := cfg.DefaultDomain(); host != "" {
+		own[host] = true
+	}
+	for host := range cfg.ShortDomains {
+		own[host] = true
+	}
+	return shortLinks{
+		policy:       cfg.ShortLinks,
+		shorteners:   cfg.ShortenerDomains,
+		own:          own,
+		maxRedirects: cfg.UnwrapMaxRedirects,
+		timeout:      cfg.UnwrapTimeout,
+		client:       redirectClient(cfg, false),
+		cname:        net.DefaultResolver.LookupCNAME,
+	}
+}
+
+// redirectClient makes single requests and hands redirects back instead of
+// following them. Like title fetches, it never connects to internal
+// addresses unless allowInternal.
+func redirectClient(cfg config.Config, allowInternal bool) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.UnwrapTimeout}
+	if !allowInternal {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || IsInternal(ip) {
+				return ErrInternalTarget
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout:   cfg.UnwrapTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// IsShortLink reports whether u lives on a known link shortener, including
+// this server's own domains and their subdomains.
+func (c *Checker) IsShortLink(u *url.URL) bool {
+	host := hostname(u)
+	if c.links.own[host] {
+		return true
+	}
+	for _, d := range c.links.shorteners {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShortLinks applies the configured policy to a destination that may be a
+// short link. It returns u unchanged when u is no short link or short links
+// are allowed, ErrShortLink when they are rejected, and otherwise the end of
+// u's redirects, each hop vetted like a submitted URL. local resolves this
+// server's own links. Whatever the policy, destinations that lead back to
+// this server other than through unwrapped links fail with ErrRedirectLoop.
+func (c *Checker) ShortLinks(ctx context.Context, u *url.URL, local LocalResolver) (*url.URL, error) {
+	if c.aliasesOwn(ctx, u) {
+		return nil, ErrRedirectLoop
+	}
+	if !c.IsShortLink(u) {
+		return u, nil
+	}
+	switch c.links.policy {
+	case config.ShortLinksReject:
+		return nil, ErrShortLink
+	case config.ShortLinksUnwrap:
+		return c.unwrap(ctx, u, local)
+	}
+
+	// Allowed short links are stored as they are, but their redirects are
+	// traced so none ends here. Failing to trace them is no reason to refuse.
+	if c.links.own[hostname(u)] {
+		return nil, ErrRedirectLoop
+	}
+	if _, err := c.unwrap(ctx, u, nil); errors.Is(err, ErrRedirectLoop) {
+		return nil, err
+	}
+	return u, nil
+}
+
+// unwrap follows u's redirects until they leave link shorteners, for at most
+// the configured number of hops. Without local, reaching one of this
+// server's own links is a loop.
+func (c *Checker) unwrap(ctx context.Context, u *url.URL, local LocalResolver) (*url.URL, error) {
+	seen := map[string]bool{}
+	for hop := 0; c.IsShortLink(u); hop++ {
+		if seen[u.String()] {
+			return nil, ErrRedirectLoop
+		}
+		seen[u.String()] = true
+		if hop == c.links.maxRedirects {
+			return nil, ErrUnwrap
+		}
+		var next string
+		var err error
+		switch {
+		case !c.links.own[hostname(u)]:
+			next, err = c.links.follow(ctx, u)
+		case local != nil:
+			next, err = local(ctx, u)
+		default:
+			return nil, ErrRedirectLoop
+		}
+		if err != nil {
+			return nil, ErrUnwrap
+		}
+
+		nu, err := u.Parse(next)
+		if err != nil || (nu.Scheme != "http" && nu.Scheme != "https") {
+			return nil, ErrUnwrap
+		}
+		if err := c.Check(ctx, nu); err != nil {
+			return nil, err
+		}
+		if c.aliasesOwn(ctx, nu) {
+			return nil, ErrRedirectLoop
+		}
+		u = nu
+	}
+	return u, nil
+}
+
+// aliasesOwn reports whether u's host is a CNAME for one of this server's
+// domains, so that requests to it would reach us. Lookup failures count as
+// no alias.
+func (c *Checker) aliasesOwn(ctx context.Context, u *url.URL) bool {
+	host := hostname(u)
+	if len(c.links.own) == 0 || c.links.own[host] || parseIP(host) != nil || c.links.cname == nil {
+		return false
+	}
+	if c.links.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.links.timeout)
+		defer cancel()
+	}
+	cname, err := c.links.cname(ctx, host)
+	if err != nil {
+		return false
+	}
+	return c.links.own[strings.TrimSuffix(strings.ToLower(cname), ".")]
+}
+
+func hostname(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// follow asks a shortener where u redirects to. Shorteners that refuse HEAD
+// are asked again with GET.
+func (s shortLinks) follow(ctx context.Context, u *url.URL) (string, error) {
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("User-Agent", "shawty-unwrapper/1.0")
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		if loc := resp.Header.Get("Location"); loc != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			return loc, nil
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+	return "", errors.New("no redirect")
+}
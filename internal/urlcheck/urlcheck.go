@@ -0,0 +1,140 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+var (
+	// ErrInternalTarget is returned when a URL points at a loopback, private,
+	// link-local or otherwise non-public address.
+	ErrInternalTarget = errors.New("URL targets a private or internal address")
+	// ErrUnresolvable is returned when the host has no addresses to vet.
+	ErrUnresolvable = errors.New("URL host could not be resolved")
+)
+
+// Extra ranges not covered by the net.IP helpers.
+var blockedNets = mustCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved
+	"64:ff9b::/96",  // NAT64, embeds IPv4 addresses
+)
+
+// Checker vets destination URLs before they are stored.
+type Checker struct {
+	blockInternal bool
+	lookup        func(ctx context.Context, host string) ([]net.IPAddr, error)
+	links         shortLinks
+}
+
+func New(cfg config.Config) *Checker {
+	return &Checker{
+		blockInternal: cfg.BlockInternalTargets,
+		lookup:        net.DefaultResolver.LookupIPAddr,
+		links:         newShortLinks(cfg),
+	}
+}
+
+// Check returns nil when u may be shortened under the configured policy.
+func (c *Checker) Check(ctx context.Context, u *url.URL) error {
+	if !c.blockInternal {
+		return nil
+	}
+
+	host := hostname(u)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInternalTarget
+	}
+
+	if ip := parseIP(host); ip != nil {
+		if IsInternal(ip) {
+			return ErrInternalTarget
+		}
+		return nil
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return ErrUnresolvable
+	}
+	for _, a := range addrs {
+		if IsInternal(a.IP) {
+			return ErrInternalTarget
+		}
+	}
+	return nil
+}
+
+// IsInternal reports whether ip is not a publicly routable unicast address.
+func IsInternal(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses standard IP literals as well as the legacy IPv4 spellings
+// browsers still accept ("2130706433", "0x7f.1", "0177.0.0.1").
+func parseIP(host string) net.IP {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	vals := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 0, 32)
+		if err != nil {
+			return nil
+		}
+		vals[i] = v
+	}
+
+	// The last part fills all remaining bytes, as with inet_aton.
+	var n uint64
+	for i, v := range vals[:len(vals)-1] {
+		if v > 0xff {
+			return nil
+		}
+		n |= v << (8 * (3 - i))
+	}
+	last := vals[len(vals)-1]
+	if last >= 1<<(8*(4-len(vals)+1)) {
+		return nil
+	}
+	n |= last
+
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func mustCIDRs(cidrs ...string) []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/config"
+)
+
+func newTestChecker(resolved map[string][]string) *Checker {
+	c := New(config.Config{BlockInternalTargets: true})
+	c.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := resolved[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		var addrs []net.IPAddr
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+	return c
+}
+
+func TestChecker_Check(t *testing.T) {
+	c := newTestChecker(map[string][]string{
+		"example.com":        {"93.184.216.34"},
+		"internal.corp":      {"10.0.0.5"},
+		"mixed.example":      {"93.184.216.34", "127.0.0.1"},
+		"metadata.example":   {"169.254.169.254"},
+		"v6public.example":   {"2606:2800:220:1:248:1893:25c8:1946"},
+		"v6loopback.example": {"::1"},
+	})
+
+	testCases := []struct {
+		url      string
+		expected error
+	}{
+		{"https://example.com/path", nil},
+		{"https://v6public.example/", nil},
+		{"https://93.184.216.34/", nil},
+		{"http://localhost:3000/", ErrInternalTarget},
+		{"http://api.localhost/", ErrInternalTarget},
+		{"http://127.0.0.1/", ErrInternalTarget},
+		{"http://192.168.1.1:8080/api", ErrInternalTarget},
+		{"http://[::1]/", ErrInternalTarget},
+		{"http://[fe80::1]/", ErrInternalTarget},
+		{"http://100.64.0.1/", ErrInternalTarget},
+		{"http://2130706433/", ErrInternalTarget},
+		{"http://0x7f.1/", ErrInternalTarget},
+		{"http://0177.0.0.1/", ErrInternalTarget},
+		{"https://internal.corp/", ErrInternalTarget},
+		{"https://mixed.example/", ErrInternalTarget},
+		{"https://metadata.example/latest", ErrInternalTarget},
+		{"https://v6loopback.example/", ErrInternalTarget},
+		{"https://nxdomain.example/", ErrUnresolvable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatalf("bad test URL: %v", err)
+			}
+			if err := c.Check(context.Background(), u); !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestChecker_Disabled(t *testing.T) {
+	c := New(config.Config{})
+	u, _ := url.Parse("http://127.0.0.1/")
+	if err := c.Check(context.Background(), u); err != nil {
+		t.Errorf("expected no error when disabled, got %v", err)
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	testCases := map[string]string{
+		"10.1.2.3":   "10.1.2.3",
+		"2130706433": "127.0.0.1",
+		"0x7f.1":     "127.0.0.1",
+		"10.1":       "10.0.0.1",
+		"192.168.1":  "192.168.0.1",
+	}
+	for in, want := range testCases {
+		if got := parseIP(in); got == nil || !got.Equal(net.ParseIP(want)) {
+			t.Errorf("parseIP(%q) = %v, want %s", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"example.com", "1.2.3.4.5", "256.1.1.1", "1.2.3.0x100"} {
+		if got := parseIP(in); got != nil {
+			t.Errorf("parseIP(%q) = %v, want nil", in, got)
+		}
+	}
+}
+
+func TestChecker_ShortLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "https://example.com/final", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/home":
+			http.Redirect(w, r, "https://shawt.ly/own", http.StatusFound)
+		case "/alias":
+			http.Redirect(w, r, "https://links.example.com/x", http.StatusFound)
+		case "/deep":
+			n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+			http.Redirect(w, r, "/deep?n="+strconv.Itoa(n+1), http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		BaseURL:            "https://shawt.ly/",
+		ShortLinks:         config.ShortLinksUnwrap,
+		ShortenerDomains:   []string{"127.0.0.1", "bit.ly"},
+		UnwrapTimeout:      time.Second,
+		UnwrapMaxRedirects: 5,
+	}
+	aliases := func(ctx context.Context, host string) (string, error) {
+		if host == "links.example.com" {
+			return "shawt.ly.", nil
+		}
+		return host + ".", nil
+	}
+	c := New(cfg)
+	c.links.client = redirectClient(cfg, true)
+	c.links.cname = aliases
+	local := func(ctx context.Context, u *url.URL) (string, error) {
+		if u.Path == "/own" {
+			return srv.URL + "/a", nil
+		}
+		return "", errors.New("not found")
+	}
+	ctx := context.Background()
+
+	testCases := []struct {
+		url      string
+		expected string
+		err      error
+	}{
+		{"https://example.com/x", "https://example.com/x", nil},
+		{srv.URL + "/a", "https://example.com/final", nil},
+		{"https://SHAWT.LY/own", "https://example.com/final", nil},
+		{"https://shawt.ly/missing", "", ErrUnwrap},
+		{srv.URL + "/loop", "", ErrRedirectLoop},
+		{srv.URL + "/deep", "", ErrUnwrap},
+		{srv.URL + "/gone", "", ErrUnwrap},
+		{srv.URL + "/alias", "", ErrRedirectLoop},
+		{"https://links.example.com/x", "", ErrRedirectLoop},
+	}
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.url)
+		got, err := c.ShortLinks(ctx, u, local)
+		if !errors.Is(err, tc.err) || (err == nil && got.String() != tc.expected) {
+			t.Errorf("ShortLinks(%s) = %v, %v; want %s, %v", tc.url, got, err, tc.expected, tc.err)
+		}
+	}
+
+	cfg.ShortLinks = config.ShortLinksReject
+	c = New(cfg)
+	for _, raw := range []string{"https://bit.ly/abc", "https://www.bit.ly/abc", "https://shawt.ly/own"} {
+		u, _ := url.Parse(raw)
+		if _, err := c.ShortLinks(ctx, u, local); !errors.Is(err, ErrShortLink) {
+			t.Errorf("Expected ErrShortLink for %s, got %v", raw, err)
+		}
+	}
+	u, _ := url.Parse("https://notbit.ly/abc")
+	if got, err := c.ShortLinks(ctx, u, local); err != nil || got != u {
+		t.Errorf("Expected notbit.ly to pass, got %v, %v", got, err)
+	}
+
+	cfg.ShortLinks = config.ShortLinksAllow
+	c = New(cfg)
+	c.links.client = redirectClient(cfg, true)
+	c.links.cname = aliases
+	testCases = []struct {
+		url      string
+		expected string
+		err      error
+	}{
+		{srv.URL + "/a", srv.URL + "/a", nil},
+		{srv.URL + "/gone", srv.URL + "/gone", nil},
+		{"https://shawt.ly/own", "", ErrRedirectLoop},
+		{srv.URL + "/home", "", ErrRedirectLoop},
+		{srv.URL + "/loop", "", ErrRedirectLoop},
+	}
+	for _, tc := range testCases {
+		u, _ := url.Parse(tc.url)
+		got, err := c.ShortLinks(ctx, u, local)
+		if !errors.Is(err, tc.err) || (err == nil && got.String() != tc.expected) {
+			t.Errorf("allow: ShortLinks(%s) = %v, %v; want %s, %v", tc.url, got, err, tc.expected, tc.err)
+		}
+	}
+}
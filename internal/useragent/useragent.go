@@ -0,0 +1,96 @@
+// Package useragent sorts User-Agent strings into coarse browser and
+// operating system families for click stats. It looks for the tokens major
+// browsers send and makes no attempt at versions or devices.
+package useragent
+
+import "strings"
+
+// Families returned for agents no rule matches.
+const (
+	Bot   = "Bot"
+	Other = "Other"
+)
+
+// rule names the family of agents containing any of tokens.
+type rule struct {
+	family string
+	tokens []string
+}
+
+// browsers is checked in order: most browsers also claim to be the ones
+// they are built on, so Edge and Opera must win over Chrome, and Chrome
+// over Safari.
+var browsers = []rule{
+	{"Edge", []string{"edg/", "edge/", "edga/", "edgios/"}},
+	{"Opera", []string{"opr/", "opera"}},
+	{"Samsung Internet", []string{"samsungbrowser/"}},
+	{"Firefox", []string{"firefox/", "fxios/"}},
+	{"Chrome", []string{"chrome/", "crios/", "chromium/"}},
+	{"Safari", []string{"safari/"}},
+}
+
+// systems is checked in order: Android and ChromeOS say Linux too, and
+// iPads may say Mac OS X.
+var systems = []rule{
+	{"Windows", []string{"windows"}},
+	{"Android", []string{"android"}},
+	{"iOS", []string{"iphone", "ipad", "ipod"}},
+	{"ChromeOS", []string{"cros"}},
+	{"macOS", []string{"mac os x", "macintosh"}},
+	{"Linux", []string{"linux"}},
+}
+
+var botTokens = []string{"bot", "spider", "crawl", "curl/", "wget/", "python", "go-http-client"}
+
+// unfurlers are the tokens of bots that fetch links to show a preview of
+// them where they were shared.
+var unfurlers = []string{
+	"slackbot", "twitterbot", "facebookexternalhit", "linkedinbot", "discordbot",
+	"telegrambot", "whatsapp", "skypeuripreview", "redditbot", "embedly", "pinterest",
+}
+
+// Unfurler reports whether ua is a bot fetching a link to preview it in a
+// chat or a social feed, rather than to index or follow it.
+func Unfurler(ua string) bool {
+	return containsAny(strings.ToLower(ua), unfurlers)
+}
+
+// Browser returns the browser family of ua: Bot for crawlers and scripts,
+// Other for anything unrecognised and "" when ua is empty.
+func Browser(ua string) string {
+	if ua == "" {
+		return ""
+	}
+	ua = strings.ToLower(ua)
+	if containsAny(ua, botTokens) {
+		return Bot
+	}
+	return match(ua, browsers)
+}
+
+// OS returns the operating system family of ua, Other when it is not
+// recognised and "" when ua is empty.
+func OS(ua string) string {
+	if ua == "" {
+		return ""
+	}
+	return match(strings.ToLower(ua), systems)
+}
+
+func match(ua string, rules []rule) string {
+	for _, r := range rules {
+		if containsAny(ua, r.tokens) {
+			return r.family
+		}
+	}
+	return Other
+}
+
+func containsAny(s string, tokens []string) bool {
+	for _, t := range tokens {
+		if strings.Contains(s, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package useragent
+
+import "testing"
+
+func TestBrowserAndOS(t *testing.T) {
+	tests := []struct {
+		ua, browser, os string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", "Chrome", "Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.80", "Edge", "Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4_1) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15", "Safari", "macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1", "Chrome", "iOS"},
+		{"Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0", "Firefox", "Android"},
+		{"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36", "Samsung Internet", "Android"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", "Firefox", "Linux"},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", "Chrome", "ChromeOS"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Bot", "Other"},
+		{"curl/8.5.0", "Bot", "Other"},
+		{"SomethingElse/1.0", "Other", "Other"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Browser(tt.ua); got != tt.browser {
+			t.Errorf("Browser(%q) = %q, want %q", tt.ua, got, tt.browser)
+		}
+		if got := OS(tt.ua); got != tt.os {
+			t.Errorf("OS(%q) = %q, want %q", tt.ua, got, tt.os)
+		}
+	}
+}
+
+func TestUnfurler(t *testing.T) {
+	tests := map[string]bool{
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)": true,
+		"Twitterbot/1.0": true,
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)": true,
+		"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)":         true,
+		"WhatsApp/2.23.20.0": true,
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": false,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0":   false,
+		"": false,
+	}
+	for ua, want := range tests {
+		if got := Unfurler(ua); got != want {
+			t.Errorf("Unfurler(%q) = %v, want %v", ua, got, want)
+		}
+	}
+}
@@ -1,14 +1,31 @@
 package util
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
+// DefaultCodeLength is the length of random and hash codes unless
+// configured otherwise.
+const DefaultCodeLength = 6
+
 func GenerateCode() string {
+	return randomCode(DefaultCodeLength)
+}
+
+func randomCode(length int) string {
 	chars := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
 
-	b := make([]rune, 6)
+	b := make([]rune, length)
 
 	for i := range b {
 		rn, _ := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
@@ -17,3 +34,205 @@ func GenerateCode() string {
 
 	return string(b)
 }
+
+// Code strategies, as selected with CODE_STRATEGY.
+const (
+	CodesRandom   = "random"
+	CodesSequence = "sequence"
+	CodesHash     = "hash"
+)
+
+// CodeStrategies lists every strategy NewCodeGenerator knows.
+var CodeStrategies = []string{CodesRandom, CodesSequence, CodesHash}
+
+// CodeGenerator mints the code of a new link to long on the short domain.
+// attempt counts the earlier candidates for the same link that were taken or
+// reserved, so deterministic strategies can move on to another code.
+type CodeGenerator interface {
+	Generate(ctx context.Context, domain, long string, attempt int) (string, error)
+}
+
+// Deterministic reports whether g always gives a link the same first
+// candidate, so an existing link is found by trying to store it again.
+func Deterministic(g CodeGenerator) bool {
+	_, ok := g.(HashCodes)
+	return ok
+}
+
+// CodeOptions configures NewCodeGenerator.
+type CodeOptions struct {
+	// Length is the length of random and hash codes, and the shortest
+	// sequence code. It defaults to DefaultCodeLength.
+	Length int
+	// Counter and Key feed sequence codes.
+	Counter Counter
+	Key     string
+}
+
+// NewCodeGenerator returns the generator for strategy.
+func NewCodeGenerator(strategy string, opts CodeOptions) (CodeGenerator, error) {
+	if opts.Length <= 0 {
+		opts.Length = DefaultCodeLength
+	}
+	switch strategy {
+	case "", CodesRandom:
+		return RandomCodes{Length: opts.Length}, nil
+	case CodesSequence:
+		if opts.Counter == nil {
+			return nil, errors.New("sequence codes need a counter")
+		}
+		return NewSequenceCodes(opts.Counter, opts.Key, opts.Length), nil
+	case CodesHash:
+		return HashCodes{Length: opts.Length}, nil
+	}
+	return nil, fmt.Errorf("unknown code strategy %q", strategy)
+}
+
+// RandomCodes draws every character from a cryptographic random source.
+type RandomCodes struct {
+	Length int
+}
+
+func (g RandomCodes) Generate(ctx context.Context, domain, long string, attempt int) (string, error) {
+	return randomCode(g.Length), nil
+}
+
+// Counter hands out numbers that are never repeated, such as the values of a
+// database sequence.
+type Counter interface {
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+// maxSequenceLen bounds sequence codes so their domain fits in a uint64.
+const maxSequenceLen = 10
+
+// SequenceCodes makes a code from each number of a counter. A keyed Feistel
+// network permutes the number first, so consecutive links get unrelated
+// looking codes, yet distinct numbers still always give distinct codes and
+// nothing needs retrying.
+//
+// Codes of length L permute the numbers below 2^bits(L), the largest even
+// power of two with at most L base62 digits. Codes start at the configured
+// length and grow by a character once the counter outgrows it; codes of
+// different lengths cannot collide.
+type SequenceCodes struct {
+	counter   Counter
+	key       []byte
+	minLength int
+}
+
+func NewSequenceCodes(c Counter, key string, minLength int) *SequenceCodes {
+	return &SequenceCodes{counter: c, key: []byte(key), minLength: max(minLength, 1)}
+}
+
+func (g *SequenceCodes) Generate(ctx context.Context, domain, long string, attempt int) (string, error) {
+	n, err := g.counter.NextSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	return g.Code(n)
+}
+
+// Code returns the code for the counter value n.
+func (g *SequenceCodes) Code(n uint64) (string, error) {
+	for length := g.minLength; length <= maxSequenceLen; length++ {
+		if bits := domainBits(length); n < 1<<bits {
+			return padBase62(g.permute(n, bits), length), nil
+		}
+	}
+	return "", errors.New("code sequence exhausted")
+}
+
+// domainBits is the largest even bit count whose values all fit in length
+// base62 digits.
+func domainBits(length int) uint {
+	size := uint64(1)
+	for i := 0; i < length; i++ {
+		size *= 62
+	}
+	bits := uint(2)
+	for bits+2 < 64 && uint64(1)<<(bits+2) <= size {
+		bits += 2
+	}
+	return bits
+}
+
+// permute is a four-round balanced Feistel network over bits-bit values,
+// with HMAC-SHA256 under the key as its round function.
+func (g *SequenceCodes) permute(n uint64, bits uint) uint64 {
+	half := bits / 2
+	mask := uint64(1)<<half - 1
+	l, r := n>>half, n&mask
+	var buf [9]byte
+	for round := byte(0); round < 4; round++ {
+		buf[0] = round
+		binary.BigEndian.PutUint64(buf[1:], r)
+		mac := hmac.New(sha256.New, g.key)
+		mac.Write(buf[:])
+		f := binary.BigEndian.Uint64(mac.Sum(nil)) & mask
+		l, r = r, l^f
+	}
+	return l<<half | r
+}
+
+// HashCodes derives the code from a SHA-256 of the short domain and the
+// normalized long URL, so every server gives a destination the same first
+// candidate. Later attempts hash them with the attempt number appended.
+type HashCodes struct {
+	Length int
+}
+
+func (g HashCodes) Generate(ctx context.Context, domain, long string, attempt int) (string, error) {
+	in := domain + "\x00" + NormalizeURL(long)
+	if attempt > 0 {
+		in += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(in))
+	return padBase62(binary.BigEndian.Uint64(sum[:8]), g.Length), nil
+}
+
+// NormalizeURL gives spellings of the same URL one form: the scheme and host
+// in lower case, without the scheme's default port, and "/" for an empty
+// path. Unparsable URLs are returned as they are.
+func NormalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port == "80" && u.Scheme == "http" || port == "443" && u.Scheme == "https" {
+		u.Host = u.Hostname()
+	}
+	if u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// padBase62 encodes the last length base62 digits of n, with leading zeros.
+func padBase62(n uint64, length int) string {
+	b := make([]byte, length)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = base62Digits[n%62]
+		n /= 62
+	}
+	return string(b)
+}
+
+const base62Digits = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Base62 encodes n with digits, lower-case and then upper-case letters.
+func Base62(n uint64) string {
+	if n == 0 {
+		return "0"
+	}
+	var b [11]byte
+	i := len(b)
+	for n > 0 {
+		i--
+		b[i] = base62Digits[n%62]
+		n /= 62
+	}
+	return string(b[i:])
+}
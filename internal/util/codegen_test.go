@@ -1,7 +1,9 @@
 package util
 
 import (
+	"context"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -92,3 +94,133 @@ func BenchmarkGenerateCode(b *testing.B) {
 		GenerateCode()
 	}
 }
+
+func TestReserved(t *testing.T) {
+	r := NewReserved([]string{"Shawty1", " acme "})
+
+	for _, code := range []string{"shorten", "SHORTEN", "healthz", "api", "shawty1", "ACME"} {
+		if !r.Contains(code) {
+			t.Errorf("Expected %q to be reserved", code)
+		}
+	}
+	for _, code := range []string{"abc123", "shorte", ""} {
+		if r.Contains(code) {
+			t.Errorf("Did not expect %q to be reserved", code)
+		}
+	}
+}
+
+func TestGenerateCodeExcluding(t *testing.T) {
+	var extra []string
+	for _, c := range "abcdefghijklmnopqrstuvwxyz0123456789" {
+		extra = append(extra, strings.Repeat(string(c), 6))
+	}
+	r := NewReserved(extra)
+
+	for i := 0; i < 1000; i++ {
+		if code := GenerateCodeExcluding(r); r.Contains(code) {
+			t.Fatalf("Generated reserved code %q", code)
+		}
+	}
+}
+
+func TestBase62(t *testing.T) {
+	tests := map[uint64]string{0: "0", 9: "9", 10: "a", 61: "Z", 62: "10", 3843: "ZZ", 1<<64 - 1: "lYGhA16ahyf"}
+	for n, want := range tests {
+		if got := Base62(n); got != want {
+			t.Errorf("Base62(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestCodeGenerators(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewCodeGenerator("snowflake", CodeOptions{}); err == nil {
+		t.Error("Expected an unknown strategy to be rejected")
+	}
+	if _, err := NewCodeGenerator(CodesSequence, CodeOptions{}); err == nil {
+		t.Error("Expected sequence codes without a counter to be rejected")
+	}
+
+	random, _ := NewCodeGenerator(CodesRandom, CodeOptions{Length: 8})
+	if code, _ := random.Generate(ctx, "", "https://example.com/", 0); len(code) != 8 {
+		t.Errorf("Expected an 8-character random code, got %q", code)
+	}
+
+	hash, _ := NewCodeGenerator(CodesHash, CodeOptions{})
+	a, _ := hash.Generate(ctx, "", "https://example.com/", 0)
+	again, _ := hash.Generate(ctx, "", "https://example.com/", 0)
+	retry, _ := hash.Generate(ctx, "", "https://example.com/", 1)
+	other, _ := hash.Generate(ctx, "", "https://example.com/other", 0)
+	if len(a) != DefaultCodeLength || a != again {
+		t.Errorf("Expected a stable %d-character hash code, got %q and %q", DefaultCodeLength, a, again)
+	}
+	if retry == a || other == a {
+		t.Errorf("Expected retries and other URLs to get other codes, got %q, %q and %q", a, retry, other)
+	}
+	if same, _ := hash.Generate(ctx, "", "HTTPS://Example.com:443", 0); same != a {
+		t.Errorf("Expected another spelling of the URL to get %q, got %q", a, same)
+	}
+	if domain, _ := hash.Generate(ctx, "example.to", "https://example.com/", 0); domain == a {
+		t.Errorf("Expected another short domain to get another code, got %q", domain)
+	}
+}
+
+type counter uint64
+
+func (c *counter) NextSequence(ctx context.Context) (uint64, error) {
+	*c++
+	return uint64(*c), nil
+}
+
+func TestSequenceCodes(t *testing.T) {
+	ctx := context.Background()
+	var c counter
+	g, _ := NewCodeGenerator(CodesSequence, CodeOptions{Counter: &c, Key: "secret"})
+
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		code, err := g.Generate(ctx, "", "", 0)
+		if err != nil || len(code) != DefaultCodeLength || seen[code] {
+			t.Fatalf("Value %d: expected a new %d-character code, got %q, %v", c, DefaultCodeLength, code, err)
+		}
+		seen[code] = true
+	}
+
+	// Neighbouring values do not give neighbouring codes.
+	s := NewSequenceCodes(&c, "secret", 6)
+	a, _ := s.Code(1)
+	b, _ := s.Code(2)
+	if a[:4] == b[:4] {
+		t.Errorf("Expected scrambled codes, got %q and %q", a, b)
+	}
+	other, _ := NewSequenceCodes(&c, "other", 6).Code(1)
+	if other == a {
+		t.Errorf("Expected the key to change the codes, got %q twice", a)
+	}
+
+	// Codes grow once the counter outgrows six characters' domain.
+	if code, err := s.Code(1 << 34); err != nil || len(code) != 7 {
+		t.Errorf("Expected a 7-character code past 2^34, got %q, %v", code, err)
+	}
+	if _, err := s.Code(1<<63 + 1); err == nil {
+		t.Error("Expected the sequence to run out past ten characters")
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/a?b=1#c": "https://example.com/a?b=1#c",
+		"HTTPS://Example.COM":         "https://example.com/",
+		"http://example.com:80/x":     "http://example.com/x",
+		"https://example.com:8443/x":  "https://example.com:8443/x",
+		"https://example.com:80/Path": "https://example.com:80/Path",
+		"not a url":                   "not a url",
+	}
+	for in, want := range tests {
+		if got := NormalizeURL(in); got != want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import "strings"
+
+// DefaultReserved lists codes that clash with the service's own routes or
+// well-known paths. They are always reserved, on top of any configured names.
+var DefaultReserved = []string{
+	"shorten", "links", "healthz", "metrics", "api", "admin", "static", "assets",
+	"favicon.ico", "robots.txt", "sitemap.xml", ".well-known",
+}
+
+// Reserved is a case-insensitive set of codes that must never be handed out,
+// so a code can neither shadow a route nor impersonate a brand in any casing.
+type Reserved map[string]struct{}
+
+// NewReserved builds the reserved set from DefaultReserved plus extra.
+func NewReserved(extra []string) Reserved {
+	r := make(Reserved, len(DefaultReserved)+len(extra))
+	for _, code := range append(append([]string{}, DefaultReserved...), extra...) {
+		if code = strings.TrimSpace(code); code != "" {
+			r[strings.ToLower(code)] = struct{}{}
+		}
+	}
+	return r
+}
+
+func (r Reserved) Contains(code string) bool {
+	_, ok := r[strings.ToLower(code)]
+	return ok
+}
+
+// GenerateCodeExcluding returns a random code that is not in r.
+func GenerateCodeExcluding(r Reserved) string {
+	for {
+		if code := GenerateCode(); !r.Contains(code) {
+			return code
+		}
+	}
+}
+
+// MaxCodeLen is the longest code accepted from outside, e.g. on import.
+const MaxCodeLen = 64
+
+// ValidCode reports whether code can be served as a short link: 1 to
+// MaxCodeLen letters, digits, '-' or '_'.
+func ValidCode(code string) bool {
+	if code == "" || len(code) > MaxCodeLen {
+		return false
+	}
+	for _, r := range code {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+// Package webhook notifies operator-configured endpoints of link events.
+// Events are written to a delivery outbox first and sent by a background
+// worker, so a slow or failing endpoint never holds up a request.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+
+	"github.com/google/uuid"
+)
+
+// Notifier turns events into pending deliveries, one per endpoint.
+type Notifier struct {
+	repo      repo.WebhookRepo
+	endpoints []string
+}
+
+func NewNotifier(r repo.WebhookRepo, endpoints []string) *Notifier {
+	return &Notifier{repo: r, endpoints: endpoints}
+}
+
+// Publish queues event for every endpoint. Failures are logged; a lost
+// notification must not fail the action that caused it.
+func (n *Notifier) Publish(ctx context.Context, event string, data any) {
+	body, err := json.Marshal(model.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Printf("webhook: encoding %s: %v", event, err)
+		return
+	}
+
+	ds := make([]model.WebhookDelivery, len(n.endpoints))
+	for i, endpoint := range n.endpoints {
+		ds[i] = model.WebhookDelivery{ID: uuid.New().String(), Endpoint: endpoint, Event: event, Payload: string(body)}
+	}
+
+	// The request that triggered the event may already be finished.
+	if err := n.repo.EnqueueDeliveries(context.WithoutCancel(ctx), ds); err != nil {
+		log.Printf("webhook: queueing %s: %v", event, err)
+	}
+}
+
+// Sign computes the X-Shawty-Signature value for a payload sent at timestamp
+// (Unix seconds): the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with
+// secret. Including the timestamp lets receivers reject replays.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender POSTs deliveries to their endpoints.
+type Sender struct {
+	Client *http.Client
+	Secret string
+}
+
+func NewSender(secret string, timeout time.Duration) *Sender {
+	return &Sender{Client: &http.Client{Timeout: timeout}, Secret: secret}
+}
+
+// Send attempts d once and returns the response status. Any non-2xx status
+// is reported as an error.
+func (s *Sender) Send(ctx context.Context, d model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Endpoint, bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shawty-webhook/1")
+	req.Header.Set("X-Shawty-Event", d.Event)
+	req.Header.Set("X-Shawty-Delivery", d.ID)
+	req.Header.Set("X-Shawty-Timestamp", strconv.FormatInt(ts, 10))
+	if s.Secret != "" {
+		req.Header.Set("X-Shawty-Signature", Sign(s.Secret, ts, []byte(d.Payload)))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain a little so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
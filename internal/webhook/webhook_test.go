@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	got := Sign("secret", 1700000000, []byte(`{"a":1}`))
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if got == Sign("secret", 1700000001, []byte(`{"a":1}`)) {
+		t.Error("expected the timestamp to be signed")
+	}
+	if got == Sign("other", 1700000000, []byte(`{"a":1}`)) {
+		t.Error("expected the secret to change the signature")
+	}
+}
+
+func TestSender_Send(t *testing.T) {
+	var gotHeaders http.Header
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := NewSender("secret", time.Second)
+	d := model.WebhookDelivery{ID: "d1", Endpoint: srv.URL, Event: model.EventLinkCreated, Payload: `{"type":"link.created"}`}
+
+	code, err := s.Send(context.Background(), d)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("expected success, got %d, %v", code, err)
+	}
+	if string(gotBody) != d.Payload {
+		t.Errorf("expected payload %s, got %s", d.Payload, gotBody)
+	}
+	if gotHeaders.Get("X-Shawty-Event") != model.EventLinkCreated || gotHeaders.Get("X-Shawty-Delivery") != "d1" {
+		t.Errorf("missing event headers: %v", gotHeaders)
+	}
+	ts, _ := strconv.ParseInt(gotHeaders.Get("X-Shawty-Timestamp"), 10, 64)
+	if sig := gotHeaders.Get("X-Shawty-Signature"); sig != Sign("secret", ts, gotBody) {
+		t.Errorf("signature %q does not verify", sig)
+	}
+
+	status = http.StatusInternalServerError
+	if code, err := s.Send(context.Background(), d); err == nil || code != http.StatusInternalServerError {
+		t.Errorf("expected an error for a 500, got %d, %v", code, err)
+	}
+}
+
+func TestNotifier_Publish(t *testing.T) {
+	r := repo.NewMemory()
+	n := NewNotifier(r, []string{"https://a.example/hook", "https://b.example/hook"})
+
+	n.Publish(context.Background(), model.EventLinkCreated, model.URLRecord{Code: "AbC123"})
+
+	ds, err := r.ClaimDeliveries(context.Background(), time.Now(), time.Minute, 10)
+	if err != nil {
+		t.Fatalf("ClaimDeliveries failed: %v", err)
+	}
+	if len(ds) != 2 {
+		t.Fatalf("expected one delivery per endpoint, got %d", len(ds))
+	}
+
+	var ev struct {
+		Type string          `json:"type"`
+		Data model.URLRecord `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(ds[0].Payload), &ev); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if ev.Type != model.EventLinkCreated || ev.Data.Code != "AbC123" {
+		t.Errorf("unexpected payload %s", ds[0].Payload)
+	}
+	if ds[0].Payload != ds[1].Payload {
+		t.Error("expected every endpoint to receive the same event")
+	}
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// Archiver periodically moves links that have gone unused for a number of
+// days into the archive, from where the next lookup of one brings it back.
+type Archiver struct {
+	repo      repo.ArchiveRepo
+	days      int
+	batchSize int
+	archived  atomic.Int64
+}
+
+// NewArchiver returns an Archiver archiving links neither changed nor
+// clicked for days.
+func NewArchiver(r repo.ArchiveRepo, days, batchSize int) *Archiver {
+	return &Archiver{repo: r, days: days, batchSize: batchSize}
+}
+
+// RunOnce archives unused links in batches of batchSize until none are left
+// and returns how many were archived.
+func (w *Archiver) RunOnce(ctx context.Context) (int, error) {
+	before := time.Now().AddDate(0, 0, -w.days)
+
+	var total int
+	for ctx.Err() == nil {
+		n, err := w.repo.ArchiveUnused(ctx, before, w.batchSize)
+		total += n
+		w.archived.Add(int64(n))
+		if err != nil {
+			return total, err
+		}
+		if n < w.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("archive: archived %d links unused since %s", total, before.Format(time.DateOnly))
+	}
+	return total, ctx.Err()
+}
+
+// Archived returns how many links the archiver has archived since it
+// started.
+func (w *Archiver) Archived() int64 {
+	return w.archived.Load()
+}
+
+// Run archives every interval until ctx is cancelled.
+func (w *Archiver) Run(ctx context.Context, interval time.Duration) {
+	Every(ctx, "archive", interval, func(ctx context.Context) error {
+		_, err := w.RunOnce(ctx)
+		return err
+	})
+}
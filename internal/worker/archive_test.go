@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestArchiver_RunOnce(t *testing.T) {
+	r := repo.NewMemory()
+	ctx := context.Background()
+
+	old := time.Now().AddDate(0, 0, -100)
+	for i := 0; i < 5; i++ {
+		code := fmt.Sprintf("OLD%03d", i)
+		r.Insert(ctx, model.URLRecord{ID: code, Code: code, LongUrl: "https://example.com/" + code, CreatedAt: old})
+	}
+	r.Insert(ctx, model.URLRecord{ID: "new", Code: "NEW001", LongUrl: "https://example.com/new"})
+	r.Insert(ctx, model.URLRecord{ID: "used", Code: "USED01", LongUrl: "https://example.com/used", CreatedAt: old})
+	r.InsertClicks(ctx, []model.ClickEvent{{Code: "USED01", ClickedAt: time.Now()}})
+
+	ar := NewArchiver(r, 90, 2)
+	n, err := ar.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 5 || ar.Archived() != 5 {
+		t.Errorf("expected 5 unused links archived across batches, got n=%d archived=%d", n, ar.Archived())
+	}
+	for _, code := range []string{"NEW001", "USED01"} {
+		if _, err := r.GetByCode(ctx, code); err != nil {
+			t.Errorf("expected %s to stay, got %v", code, err)
+		}
+	}
+	if _, err := r.GetByCode(ctx, "OLD000"); err != repo.ErrNotFound {
+		t.Errorf("expected OLD000 out of the link table, got %v", err)
+	}
+
+	// Looked up through the archive, a link comes back and is not archived
+	// again at once.
+	links := repo.WithArchive(r, r)
+	if rec, err := links.GetByCode(ctx, "OLD000"); err != nil || rec.Code != "OLD000" {
+		t.Fatalf("expected OLD000 rehydrated, got %+v (%v)", rec, err)
+	}
+	if n, err := ar.RunOnce(ctx); err != nil || n != 0 {
+		t.Errorf("expected nothing left to archive, got n=%d err=%v", n, err)
+	}
+	if _, err := links.Insert(ctx, model.URLRecord{Code: "OLD001", LongUrl: "https://example.com/other"}); err != repo.ErrDuplicateCode {
+		t.Errorf("expected archived codes to stay taken, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// Cleaner periodically deletes links that can no longer redirect: expired
+// links once their grace period is over and, when configured, links that
+// have stayed disabled for too long. Deleting a link frees its code and
+// destination for reuse.
+type Cleaner struct {
+	repo          repo.URLRepo
+	grace         time.Duration
+	disabledAfter time.Duration
+	batchSize     int
+	removed       atomic.Int64
+}
+
+// NewCleaner returns a Cleaner deleting expired links grace after their
+// expiry and disabled links disabledAfter after they were disabled; a zero
+// disabledAfter keeps disabled links forever.
+func NewCleaner(r repo.URLRepo, grace, disabledAfter time.Duration, batchSize int) *Cleaner {
+	return &Cleaner{repo: r, grace: grace, disabledAfter: disabledAfter, batchSize: batchSize}
+}
+
+// RunOnce deletes stale links in batches of batchSize until none are left
+// and returns how many were deleted. Small batches keep each statement's
+// locks short on large tables.
+func (w *Cleaner) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	var disabledBefore time.Time
+	if w.disabledAfter > 0 {
+		disabledBefore = now.Add(-w.disabledAfter)
+	}
+
+	var total int
+	for ctx.Err() == nil {
+		n, err := w.repo.DeleteStale(ctx, now.Add(-w.grace), disabledBefore, w.batchSize)
+		total += n
+		w.removed.Add(int64(n))
+		if err != nil {
+			return total, err
+		}
+		if n < w.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("cleanup: deleted %d links", total)
+	}
+	return total, ctx.Err()
+}
+
+// Removed returns how many links the cleaner has deleted since it started.
+func (w *Cleaner) Removed() int64 {
+	return w.removed.Load()
+}
+
+// Run cleans up every interval until ctx is cancelled.
+func (w *Cleaner) Run(ctx context.Context, interval time.Duration) {
+	Every(ctx, "cleanup", interval, func(ctx context.Context) error {
+		_, err := w.RunOnce(ctx)
+		return err
+	})
+}
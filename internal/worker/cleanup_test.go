@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestCleaner_RunOnce(t *testing.T) {
+	r := repo.NewMemory()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		code := fmt.Sprintf("OLD%03d", i)
+		r.Insert(ctx, model.URLRecord{ID: code, Code: code, LongUrl: "https://example.com/" + code, ExpiresAt: &past})
+	}
+	r.Insert(ctx, model.URLRecord{ID: "live", Code: "LIVE01", LongUrl: "https://example.com/live", ExpiresAt: &future})
+	r.Insert(ctx, model.URLRecord{ID: "off", Code: "OFF001", LongUrl: "https://example.com/off"})
+	r.SetActive(ctx, "OFF001", false)
+
+	// Disabled links are kept unless disabledAfter is set.
+	cl := NewCleaner(r, 0, 0, 2)
+	n, err := cl.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 5 || cl.Removed() != 5 {
+		t.Errorf("expected 5 expired links deleted across batches, got n=%d removed=%d", n, cl.Removed())
+	}
+	if _, err := r.GetByCode(ctx, "LIVE01"); err != nil {
+		t.Errorf("expected unexpired link to stay, got %v", err)
+	}
+	if _, err := r.GetByCode(ctx, "OFF001"); err != nil {
+		t.Errorf("expected disabled link to stay, got %v", err)
+	}
+
+	// An expired link's destination can be shortened again once purged.
+	if _, err := r.Insert(ctx, model.URLRecord{ID: "again", Code: "NEW001", LongUrl: "https://example.com/OLD000"}); err != nil {
+		t.Errorf("expected purged destination to be free, got %v", err)
+	}
+
+	cl = NewCleaner(r, time.Hour, time.Nanosecond, 100)
+	if n, err := cl.RunOnce(ctx); err != nil || n != 1 {
+		t.Errorf("expected the disabled link deleted, got n=%d err=%v", n, err)
+	}
+}
@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// drainTimeout bounds the final flush when the writer shuts down.
+const drainTimeout = 5 * time.Second
+
+// ClickWriter buffers click events and writes them in batches, so redirects
+// never wait on the database. Events arriving while the buffer is full are
+// dropped and counted rather than slowing the redirect down: by default the
+// new ones, or with DropOldest the oldest queued ones.
+type ClickWriter struct {
+	repo       repo.ClickRepo
+	events     chan model.ClickEvent
+	batchSize  int
+	flushEvery time.Duration
+	writers    int
+	dropOldest bool
+	onFlush    func(ctx context.Context, events []model.ClickEvent)
+	dedup      time.Duration
+
+	dropped atomic.Int64
+	written atomic.Int64
+	failed  atomic.Int64
+}
+
+// visitor identifies repeated clicks on one link from the same browser.
+type visitor struct {
+	code, ipHash, userAgent string
+}
+
+func NewClickWriter(r repo.ClickRepo, bufferSize, batchSize int, flushEvery time.Duration) *ClickWriter {
+	return &ClickWriter{
+		repo:       r,
+		events:     make(chan model.ClickEvent, bufferSize),
+		batchSize:  batchSize,
+		flushEvery: flushEvery,
+		writers:    1,
+	}
+}
+
+// Record queues ev without blocking.
+func (w *ClickWriter) Record(ev model.ClickEvent) {
+	select {
+	case w.events <- ev:
+		return
+	default:
+	}
+	if w.dropOldest {
+		// Make room by discarding the oldest event. Another Record may take
+		// the room first, in which case ev is dropped after all.
+		select {
+		case <-w.events:
+			w.dropped.Add(1)
+		default:
+		}
+		select {
+		case w.events <- ev:
+			return
+		default:
+		}
+	}
+	w.dropped.Add(1)
+}
+
+// Writers sets how many batches may be written at once, for databases that
+// keep up better with parallel inserts. It must be set before Run.
+func (w *ClickWriter) Writers(n int) {
+	w.writers = max(n, 1)
+}
+
+// DropOldest makes a full buffer drop its oldest event for a new one, keeping
+// the most recent clicks in a burst rather than the first. It must be set
+// before Run.
+func (w *ClickWriter) DropOldest() {
+	w.dropOldest = true
+}
+
+// OnFlush registers fn to be called with every batch after it is written,
+// e.g. to forward clicks to webhooks. It must be set before Run, must be
+// safe to call from several writers at once and must not retain events.
+func (w *ClickWriter) OnFlush(fn func(ctx context.Context, events []model.ClickEvent)) {
+	w.onFlush = fn
+}
+
+// DedupWindow makes clicks by the same visitor on the same link within d of
+// their first one count once, so page refreshes and prefetches do not inflate
+// stats. A visitor is a network hash and User-Agent; clicks without a network
+// hash are always kept. It must be set before Run.
+func (w *ClickWriter) DedupWindow(d time.Duration) {
+	w.dedup = d
+}
+
+// Dropped returns how many events were discarded because the buffer was full.
+func (w *ClickWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Written returns how many events have been stored.
+func (w *ClickWriter) Written() int64 {
+	return w.written.Load()
+}
+
+// Failed returns how many events were lost because their batch could not be
+// stored.
+func (w *ClickWriter) Failed() int64 {
+	return w.failed.Load()
+}
+
+// Queued returns how many events wait in the buffer.
+func (w *ClickWriter) Queued() int {
+	return len(w.events)
+}
+
+// Run collects queued events into batches, handing each to one of the
+// writers whenever it fills up or flushEvery passes, until ctx is cancelled.
+// Whatever is still buffered then is written before Run returns, for at most
+// drainTimeout.
+func (w *ClickWriter) Run(ctx context.Context) {
+	t := time.NewTicker(w.flushEvery)
+	defer t.Stop()
+
+	// Writes outlive ctx so the last batches make it, but not for long.
+	wctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { time.AfterFunc(drainTimeout, cancel) })
+	defer stop()
+
+	batches := make(chan []model.ClickEvent)
+	var wg sync.WaitGroup
+	for range w.writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				w.write(wctx, batch)
+			}
+		}()
+	}
+
+	// seen holds when each visitor's last counted click happened.
+	seen := make(map[visitor]time.Time)
+	repeated := func(ev model.ClickEvent) bool {
+		if w.dedup <= 0 || ev.IPHash == "" {
+			return false
+		}
+		key := visitor{ev.Code, ev.IPHash, ev.UserAgent}
+		if first, ok := seen[key]; ok && ev.ClickedAt.Sub(first) < w.dedup {
+			return true
+		}
+		seen[key] = ev.ClickedAt
+		return false
+	}
+
+	batch := make([]model.ClickEvent, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// Waits while every writer is busy; the buffer absorbs the wait.
+		batches <- batch
+		batch = make([]model.ClickEvent, 0, w.batchSize)
+	}
+	add := func(ev model.ClickEvent) {
+		if repeated(ev) {
+			return
+		}
+		batch = append(batch, ev)
+		if len(batch) >= w.batchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case ev := <-w.events:
+			add(ev)
+		case now := <-t.C:
+			flush()
+			for key, first := range seen {
+				if now.Sub(first) >= w.dedup {
+					delete(seen, key)
+				}
+			}
+		case <-ctx.Done():
+			for {
+				select {
+				case ev := <-w.events:
+					add(ev)
+				default:
+					flush()
+					close(batches)
+					wg.Wait()
+					return
+				}
+			}
+		}
+	}
+}
+
+// write stores one batch.
+func (w *ClickWriter) write(ctx context.Context, batch []model.ClickEvent) {
+	if err := w.repo.InsertClicks(ctx, batch); err != nil {
+		w.failed.Add(int64(len(batch)))
+		log.Printf("clicks: dropping %d events: %v", len(batch), err)
+		return
+	}
+	w.written.Add(int64(len(batch)))
+	if w.onFlush != nil {
+		w.onFlush(ctx, batch)
+	}
+}
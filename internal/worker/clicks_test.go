@@ -0,0 +1,229 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+)
+
+type stubClicks struct {
+	mu      sync.Mutex
+	batches [][]model.ClickEvent
+}
+
+func (s *stubClicks) InsertClicks(ctx context.Context, events []model.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]model.ClickEvent(nil), events...))
+	return nil
+}
+
+func (s *stubClicks) CountClicks(ctx context.Context, code string) (int, error) {
+	return 0, nil
+}
+
+func (s *stubClicks) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, b := range s.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestClickWriter_BatchesAndDrains(t *testing.T) {
+	stub := &stubClicks{}
+	w := NewClickWriter(stub, 100, 3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 7; i++ {
+		w.Record(model.ClickEvent{Code: "AbC123"})
+	}
+
+	// Two full batches go out without waiting for the flush interval.
+	deadline := time.Now().Add(time.Second)
+	for stub.total() < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := stub.total(); got != 6 {
+		t.Fatalf("expected 6 events written in full batches, got %d", got)
+	}
+
+	cancel()
+	<-done
+	if got := stub.total(); got != 7 {
+		t.Errorf("expected the remaining event to be flushed on shutdown, got %d total", got)
+	}
+	for _, b := range stub.batches {
+		if len(b) > 3 {
+			t.Errorf("batch of %d exceeds batch size 3", len(b))
+		}
+	}
+}
+
+func TestClickWriter_DropsWhenFull(t *testing.T) {
+	w := NewClickWriter(&stubClicks{}, 2, 10, time.Hour)
+
+	for i := 0; i < 5; i++ {
+		w.Record(model.ClickEvent{Code: "AbC123"})
+	}
+	if got := w.Dropped(); got != 3 {
+		t.Errorf("expected 3 dropped events, got %d", got)
+	}
+}
+
+func TestClickWriter_FlushInterval(t *testing.T) {
+	stub := &stubClicks{}
+	w := NewClickWriter(stub, 10, 100, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	w.Record(model.ClickEvent{Code: "AbC123"})
+
+	deadline := time.Now().Add(time.Second)
+	for stub.total() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stub.total() != 1 {
+		t.Error("expected a partial batch to be written after the flush interval")
+	}
+}
+
+func TestClickWriter_DedupWindow(t *testing.T) {
+	stub := &stubClicks{}
+	w := NewClickWriter(stub, 100, 100, time.Hour)
+	w.DedupWindow(30 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	start := time.Now()
+	click := func(code, ipHash, ua string, after time.Duration) {
+		w.Record(model.ClickEvent{Code: code, IPHash: ipHash, UserAgent: ua, ClickedAt: start.Add(after)})
+	}
+	click("AbC123", "net1", "ua", 0)
+	click("AbC123", "net1", "ua", 10*time.Second) // refresh
+	click("AbC123", "net1", "ua", 31*time.Second) // window over
+	click("AbC123", "net1", "other-ua", 0)
+	click("AbC123", "net2", "ua", 0)
+	click("XyZ789", "net1", "ua", 0)
+	click("AbC123", "", "ua", 0) // unknown network
+	click("AbC123", "", "ua", 0)
+
+	cancel()
+	<-done
+	if got := stub.total(); got != 7 {
+		t.Errorf("expected only the refresh to be dropped, got %d events", got)
+	}
+}
+
+func TestClickWriter_DropOldest(t *testing.T) {
+	stub := &stubClicks{}
+	w := NewClickWriter(stub, 2, 10, time.Hour)
+	w.DropOldest()
+
+	for _, code := range []string{"a", "b", "c", "d", "e"} {
+		w.Record(model.ClickEvent{Code: code})
+	}
+	if got := w.Dropped(); got != 3 {
+		t.Errorf("expected 3 dropped events, got %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx)
+	if len(stub.batches) != 1 || len(stub.batches[0]) != 2 || stub.batches[0][0].Code != "d" || stub.batches[0][1].Code != "e" {
+		t.Errorf("expected the newest events d and e to be kept, got %v", stub.batches)
+	}
+}
+
+// gatedClicks blocks every insert until release is closed, and fails them
+// when fail is set.
+type gatedClicks struct {
+	stubClicks
+	started chan struct{}
+	release chan struct{}
+	fail    bool
+}
+
+func (g *gatedClicks) InsertClicks(ctx context.Context, events []model.ClickEvent) error {
+	g.started <- struct{}{}
+	<-g.release
+	if g.fail {
+		return errors.New("database is down")
+	}
+	return g.stubClicks.InsertClicks(ctx, events)
+}
+
+func TestClickWriter_Writers(t *testing.T) {
+	gate := &gatedClicks{started: make(chan struct{}, 10), release: make(chan struct{})}
+	w := NewClickWriter(gate, 100, 1, time.Hour)
+	w.Writers(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 5; i++ {
+		w.Record(model.ClickEvent{Code: "AbC123"})
+	}
+	// Three batches are written at once while the rest wait their turn.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-gate.started:
+		case <-time.After(time.Second):
+			t.Fatalf("expected 3 inserts in flight, got %d", i)
+		}
+	}
+	select {
+	case <-gate.started:
+		t.Fatal("expected at most 3 inserts in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(gate.release)
+	cancel()
+	<-done
+	if got := w.Written(); got != 5 || gate.total() != 5 {
+		t.Errorf("expected 5 events written, got %d (%d stored)", got, gate.total())
+	}
+	if w.Queued() != 0 {
+		t.Errorf("expected an empty queue, got %d", w.Queued())
+	}
+}
+
+func TestClickWriter_Failed(t *testing.T) {
+	gate := &gatedClicks{started: make(chan struct{}, 10), release: make(chan struct{}), fail: true}
+	close(gate.release)
+	w := NewClickWriter(gate, 100, 2, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		w.Record(model.ClickEvent{Code: "AbC123"})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx)
+	if w.Failed() != 3 || w.Written() != 0 {
+		t.Errorf("expected 3 failed and 0 written, got %d and %d", w.Failed(), w.Written())
+	}
+}
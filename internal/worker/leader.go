@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// leaderLease names the lease whose holder is the leader.
+const leaderLease = "leader"
+
+// Leader elects one instance of those sharing locks to run the scheduled
+// jobs. Each campaigns for a lease every third of ttl; the holder renews it
+// and stays leader, and when it dies the lease runs out and another instance
+// takes over within ttl. A leader that cannot renew, say because the
+// database is unreachable, stops acting as one once its lease may have run
+// out, so two instances never both believe they lead.
+type Leader struct {
+	locks repo.LockRepo
+	owner string
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// NewLeader returns a Leader campaigning for owner with leases of ttl.
+func NewLeader(locks repo.LockRepo, owner string, ttl time.Duration) *Leader {
+	return &Leader{locks: locks, owner: owner, ttl: ttl}
+}
+
+// Leading reports whether this instance holds the lease.
+func (l *Leader) Leading() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.until)
+}
+
+// Campaign takes or renews the lease once.
+func (l *Leader) Campaign(ctx context.Context) error {
+	// The lease is counted from before asking, so it is never thought to
+	// last longer than the store keeps it.
+	start := time.Now()
+	ok, err := l.locks.TryLock(ctx, leaderLease, l.owner, l.ttl)
+	if err != nil {
+		return err
+	}
+
+	was := l.Leading()
+	l.mu.Lock()
+	if ok {
+		l.until = start.Add(l.ttl)
+	} else {
+		l.until = time.Time{}
+	}
+	l.mu.Unlock()
+
+	switch {
+	case ok && !was:
+		log.Printf("leader: %s is now the leader", l.owner)
+	case !ok && was:
+		log.Printf("leader: %s lost the lead", l.owner)
+	}
+	return nil
+}
+
+// Claim makes Leader a Claimer giving every shared job to the leader.
+func (l *Leader) Claim(ctx context.Context, job string, period time.Duration) (bool, error) {
+	return l.Leading(), nil
+}
+
+// Run campaigns until ctx is cancelled, then hands the lease back so
+// another instance need not wait for it to run out.
+func (l *Leader) Run(ctx context.Context) {
+	if err := l.Campaign(ctx); err != nil {
+		log.Printf("leader: %v", err)
+	}
+	Every(ctx, "leader", l.ttl/3, l.Campaign)
+
+	if l.Leading() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		l.mu.Lock()
+		l.until = time.Time{}
+		l.mu.Unlock()
+		if err := l.locks.Unlock(ctx, leaderLease, l.owner); err != nil {
+			log.Printf("leader: %v", err)
+		}
+	}
+}
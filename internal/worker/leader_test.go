@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestLeader(t *testing.T) {
+	locks := repo.NewMemory()
+	a := NewLeader(locks, "a", 50*time.Millisecond)
+	b := NewLeader(locks, "b", 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	b.Campaign(context.Background())
+	if !a.Leading() || b.Leading() {
+		t.Fatalf("expected a to lead, got a=%v b=%v", a.Leading(), b.Leading())
+	}
+	if ok, _ := b.Claim(context.Background(), "cleanup", time.Hour); ok {
+		t.Error("expected jobs to go to the leader only")
+	}
+
+	// a keeps renewing past its first lease.
+	time.Sleep(80 * time.Millisecond)
+	if !a.Leading() {
+		t.Error("expected a to keep the lead while it runs")
+	}
+
+	// Stopping hands the lease over at once.
+	cancel()
+	<-done
+	if a.Leading() {
+		t.Error("expected a to step down when stopped")
+	}
+	b.Campaign(context.Background())
+	if !b.Leading() {
+		t.Error("expected b to take over")
+	}
+	if ok, _ := b.Claim(context.Background(), "cleanup", time.Hour); !ok {
+		t.Error("expected the new leader to get the jobs")
+	}
+}
+
+func TestLeader_Expiry(t *testing.T) {
+	l := NewLeader(repo.NewMemory(), "a", 20*time.Millisecond)
+	l.Campaign(context.Background())
+	if !l.Leading() {
+		t.Fatal("expected to lead")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if l.Leading() {
+		t.Error("expected the lead to lapse with a lease that was not renewed")
+	}
+}
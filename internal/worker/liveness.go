@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// DestinationChecker requests a destination to tell whether it is live.
+type DestinationChecker interface {
+	Check(ctx context.Context, url string) model.LinkCheck
+}
+
+// LivenessChecker periodically requests the destinations of checked links
+// again, so links whose destinations go away are flagged dead to their
+// owners, and ones that come back lose the flag.
+type LivenessChecker struct {
+	repo         repo.URLRepo
+	checks       repo.LinkCheckRepo
+	checker      DestinationChecker
+	refreshAfter time.Duration
+	batchSize    int
+}
+
+func NewLivenessChecker(r repo.URLRepo, checks repo.LinkCheckRepo, c DestinationChecker, refreshAfter time.Duration, batchSize int) *LivenessChecker {
+	return &LivenessChecker{repo: r, checks: checks, checker: c, refreshAfter: refreshAfter, batchSize: batchSize}
+}
+
+// RunOnce rechecks one batch of stale checks and returns how many links
+// were newly found dead. Checks of links that are gone are dropped.
+func (w *LivenessChecker) RunOnce(ctx context.Context) (int, error) {
+	stale, err := w.checks.ListLinkChecks(ctx, time.Now().Add(-w.refreshAfter), w.batchSize)
+	if err != nil || len(stale) == 0 {
+		return 0, err
+	}
+
+	var n int
+	for _, prev := range stale {
+		rec, err := w.repo.GetByCode(ctx, prev.Code)
+		if errors.Is(err, repo.ErrNotFound) {
+			if err := w.checks.DeleteLinkCheck(ctx, prev.Code); err != nil && !errors.Is(err, repo.ErrNotFound) {
+				return n, err
+			}
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		c := w.checker.Check(ctx, rec.LongUrl)
+		c.Code = rec.Code
+		if c.Dead && !prev.Dead {
+			n++
+			log.Printf("liveness: %s -> %s is dead: %s", rec.Code, rec.LongUrl, describe(c))
+		}
+		if err := w.checks.SaveLinkCheck(ctx, c); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func describe(c model.LinkCheck) string {
+	if c.Error != "" {
+		return c.Error
+	}
+	return http.StatusText(c.Status)
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+type stubLiveness map[string]int
+
+func (s stubLiveness) Check(ctx context.Context, url string) model.LinkCheck {
+	status := s[url]
+	return model.LinkCheck{Status: status, Dead: status == 404, CheckedAt: time.Now()}
+}
+
+func TestLivenessChecker_RunOnce(t *testing.T) {
+	r := repo.NewMemory()
+	ctx := context.Background()
+	old := time.Now().Add(-2 * time.Hour)
+
+	r.Insert(ctx, model.URLRecord{ID: "1", Code: "LIVE01", LongUrl: "https://example.com/"})
+	r.Insert(ctx, model.URLRecord{ID: "2", Code: "GONE01", LongUrl: "https://example.com/gone"})
+	for _, code := range []string{"LIVE01", "GONE01", "DELETED"} {
+		r.SaveLinkCheck(ctx, model.LinkCheck{Code: code, Status: 200, CheckedAt: old})
+	}
+
+	lc := NewLivenessChecker(r, r, stubLiveness{"https://example.com/": 200, "https://example.com/gone": 404}, time.Hour, 10)
+	n, err := lc.RunOnce(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 newly dead link, got %d (%v)", n, err)
+	}
+
+	checks, _ := r.GetLinkChecks(ctx, []string{"LIVE01", "GONE01", "DELETED"})
+	if len(checks) != 2 || checks["LIVE01"].Dead || !checks["GONE01"].Dead || checks["GONE01"].Status != 404 {
+		t.Errorf("expected GONE01 dead and the deleted link's check dropped, got %+v", checks)
+	}
+
+	// Both were just checked, so nothing is due yet.
+	if n, err := lc.RunOnce(ctx); err != nil || n != 0 {
+		t.Errorf("expected empty second run, got n=%d err=%v", n, err)
+	}
+}
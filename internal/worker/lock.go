@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// Leases is a Claimer taking a lease per job, so that of the instances
+// sharing locks only the one holding a job's lease runs it. The holder
+// renews its lease with every run, for half as long again as the job's
+// period, so it keeps the job while it is up, and another instance takes
+// over within that time once it is gone.
+type Leases struct {
+	locks repo.LockRepo
+	owner string
+}
+
+// NewLeases returns Leases taking locks for owner, which names this
+// instance.
+func NewLeases(locks repo.LockRepo, owner string) *Leases {
+	return &Leases{locks: locks, owner: owner}
+}
+
+func (l *Leases) Claim(ctx context.Context, job string, period time.Duration) (bool, error) {
+	return l.locks.TryLock(ctx, "job:"+job, l.owner, period*3/2)
+}
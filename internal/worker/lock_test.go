@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestLeases(t *testing.T) {
+	ctx := context.Background()
+	locks := repo.NewMemory()
+	a, b := NewLeases(locks, "a"), NewLeases(locks, "b")
+	const period = 50 * time.Millisecond
+
+	var runs []string
+	for _, l := range []struct {
+		name   string
+		leases *Leases
+	}{{"a", a}, {"b", b}, {"a", a}} {
+		if ok, err := l.leases.Claim(ctx, "cleanup", period); err != nil {
+			t.Fatalf("Claim: %v", err)
+		} else if ok {
+			runs = append(runs, l.name)
+		}
+	}
+	if len(runs) != 2 || runs[0] != "a" || runs[1] != "a" {
+		t.Fatalf("expected only a to run while it holds the job, got %v", runs)
+	}
+	if ok, _ := b.Claim(ctx, "rollup", period); !ok {
+		t.Error("expected other jobs to be free")
+	}
+
+	// a stops renewing; b takes over once the lease has run out.
+	time.Sleep(80 * time.Millisecond)
+	if ok, _ := b.Claim(ctx, "cleanup", period); !ok {
+		t.Error("expected b to take over")
+	}
+	if ok, _ := a.Claim(ctx, "cleanup", period); ok {
+		t.Error("expected a to have lost the job")
+	}
+}
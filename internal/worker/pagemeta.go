@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// PageFetcher reads what a page says about itself.
+type PageFetcher interface {
+	Page(ctx context.Context, url string) (model.PageMeta, error)
+}
+
+// metaJob asks for the metadata of the page at url, for the link code.
+type metaJob struct {
+	code, url string
+}
+
+// MetaFetcher fetches the metadata of link destinations in the background,
+// so creating a link never waits on its destination. Pages are cached by
+// URL, so a destination many links share is fetched once per cache period.
+// Links queued while the queue is full go without metadata.
+type MetaFetcher struct {
+	fetcher PageFetcher
+	store   repo.PageMetaRepo
+	cache   cache.Store
+	jobs    chan metaJob
+
+	dropped atomic.Int64
+}
+
+func NewMetaFetcher(f PageFetcher, store repo.PageMetaRepo, c cache.Store, queueSize int) *MetaFetcher {
+	return &MetaFetcher{fetcher: f, store: store, cache: c, jobs: make(chan metaJob, queueSize)}
+}
+
+// Enqueue queues code's destination url without blocking.
+func (w *MetaFetcher) Enqueue(code, url string) {
+	select {
+	case w.jobs <- metaJob{code: code, url: url}:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many links were queued while the queue was full.
+func (w *MetaFetcher) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Run fetches queued pages one at a time until ctx is cancelled. What is
+// still queued then is dropped.
+func (w *MetaFetcher) Run(ctx context.Context) {
+	for {
+		select {
+		case job := <-w.jobs:
+			if err := w.fetch(ctx, job); err != nil {
+				log.Printf("page metadata %s: %v", job.code, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *MetaFetcher) fetch(ctx context.Context, job metaJob) error {
+	var meta model.PageMeta
+	if b, ok := w.cache.Get(ctx, job.url); !ok || json.Unmarshal(b, &meta) != nil {
+		var err error
+		if meta, err = w.fetcher.Page(ctx, job.url); err != nil {
+			return err
+		}
+		if b, err := json.Marshal(meta); err == nil {
+			w.cache.Put(ctx, job.url, b)
+		}
+	}
+	// A cached page counts as fetched now: it is at most a cache period old.
+	meta.Code, meta.FetchedAt = job.code, time.Now().UTC()
+	return w.store.SavePageMeta(ctx, meta)
+}
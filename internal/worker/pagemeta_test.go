@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/cache"
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+type countingPages map[string]int
+
+func (p countingPages) Page(ctx context.Context, url string) (model.PageMeta, error) {
+	p[url]++
+	if url == "https://example.com/broken" {
+		return model.PageMeta{}, errors.New("broken")
+	}
+	return model.PageMeta{Title: "Page at " + url}, nil
+}
+
+func TestMetaFetcher(t *testing.T) {
+	ctx := context.Background()
+	r := repo.NewMemory()
+	pages := countingPages{}
+	w := NewMetaFetcher(pages, r, cache.NewMemoryStore(10, time.Hour), 2)
+
+	for _, job := range []metaJob{{"a", "https://example.com/"}, {"b", "https://example.com/"}, {"c", "https://example.com/broken"}} {
+		err := w.fetch(ctx, job)
+		if (err != nil) != (job.code == "c") {
+			t.Errorf("fetch %s: unexpected error %v", job.code, err)
+		}
+	}
+	if pages["https://example.com/"] != 1 {
+		t.Errorf("expected the shared page fetched once, got %d", pages["https://example.com/"])
+	}
+	metas, _ := r.GetPageMetas(ctx, []string{"a", "b", "c"})
+	if len(metas) != 2 || metas["b"].Title != "Page at https://example.com/" || metas["b"].FetchedAt.IsZero() {
+		t.Errorf("expected a and b to have metadata, got %+v", metas)
+	}
+
+	for range 3 {
+		w.Enqueue("d", "https://example.com/d")
+	}
+	if w.Dropped() != 1 {
+		t.Errorf("expected the third job dropped, got %d", w.Dropped())
+	}
+}
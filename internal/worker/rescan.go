@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/scan"
+)
+
+// Rescanner periodically re-checks stored destinations so links whose targets
+// turn malicious after creation get flagged and stop redirecting.
+type Rescanner struct {
+	repo         repo.URLRepo
+	scanner      scan.Scanner
+	refreshAfter time.Duration
+	batchSize    int
+}
+
+func NewRescanner(r repo.URLRepo, sc scan.Scanner, refreshAfter time.Duration, batchSize int) *Rescanner {
+	return &Rescanner{repo: r, scanner: sc, refreshAfter: refreshAfter, batchSize: batchSize}
+}
+
+// RunOnce scans one batch of stale records and returns how many were flagged.
+func (w *Rescanner) RunOnce(ctx context.Context) (int, error) {
+	recs, err := w.repo.ListForScan(ctx, time.Now().Add(-w.refreshAfter), w.batchSize)
+	if err != nil || len(recs) == 0 {
+		return 0, err
+	}
+
+	urls := make([]string, len(recs))
+	for i, rec := range recs {
+		urls[i] = rec.LongUrl
+	}
+
+	flagged, err := w.scanner.Check(ctx, urls)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, rec := range recs {
+		status := scan.StatusClean
+		if flagged[rec.LongUrl] {
+			status = scan.StatusFlagged
+			n++
+			log.Printf("rescan: flagged %s -> %s", rec.Code, rec.LongUrl)
+		}
+		if err := w.repo.UpdateScanStatus(ctx, rec.Code, status); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Run rescans a batch every interval until ctx is cancelled.
+func (w *Rescanner) Run(ctx context.Context, interval time.Duration) {
+	Every(ctx, "rescan", interval, func(ctx context.Context) error {
+		_, err := w.RunOnce(ctx)
+		return err
+	})
+}
@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+	"urlshortener/urlshortener/internal/scan"
+)
+
+type stubScanner map[string]bool
+
+func (s stubScanner) Check(ctx context.Context, urls []string) (map[string]bool, error) {
+	return s, nil
+}
+
+func TestRescanner_RunOnce(t *testing.T) {
+	r := repo.NewMemory()
+	ctx := context.Background()
+
+	r.Insert(ctx, model.URLRecord{ID: "1", Code: "GOOD01", LongUrl: "https://example.com/", ShortUrl: "https://shawt.ly/GOOD01"})
+	r.Insert(ctx, model.URLRecord{ID: "2", Code: "BAD001", LongUrl: "https://malware.example/", ShortUrl: "https://shawt.ly/BAD001"})
+
+	rs := NewRescanner(r, stubScanner{"https://malware.example/": true}, time.Hour, 10)
+
+	n, err := rs.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 flagged link, got %d", n)
+	}
+
+	bad, _ := r.GetByCode(ctx, "BAD001")
+	if bad.ScanStatus != scan.StatusFlagged || bad.ScannedAt == nil {
+		t.Errorf("expected BAD001 flagged with scanned_at, got %+v", bad)
+	}
+	good, _ := r.GetByCode(ctx, "GOOD01")
+	if good.ScanStatus != scan.StatusClean {
+		t.Errorf("expected GOOD01 clean, got %q", good.ScanStatus)
+	}
+
+	// Both were just scanned, so nothing is due yet.
+	if n, err := rs.RunOnce(ctx); err != nil || n != 0 {
+		t.Errorf("expected empty second run, got n=%d err=%v", n, err)
+	}
+}
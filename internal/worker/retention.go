@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// ClickPruner periodically deletes raw click events older than the
+// retention period. The daily totals rolled up from them are kept forever.
+type ClickPruner struct {
+	repo      repo.ClickStatsRepo
+	days      int
+	batchSize int
+	pruned    atomic.Int64
+	lastRun   atomic.Int64
+}
+
+// NewClickPruner returns a ClickPruner keeping days of raw click events.
+func NewClickPruner(r repo.ClickStatsRepo, days, batchSize int) *ClickPruner {
+	return &ClickPruner{repo: r, days: days, batchSize: batchSize}
+}
+
+// RunOnce rolls up the events that have not been yet, then deletes those
+// from before the first retained UTC day in batches of batchSize and returns
+// how many were deleted. Whole days go at once, so a later rollup never
+// recounts a day from part of its events.
+func (w *ClickPruner) RunOnce(ctx context.Context) (int, error) {
+	if err := w.repo.RollupClicks(ctx); err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	before := now.Truncate(24*time.Hour).AddDate(0, 0, -w.days)
+
+	var total int
+	for ctx.Err() == nil {
+		n, err := w.repo.PruneClicks(ctx, before, w.batchSize)
+		total += n
+		w.pruned.Add(int64(n))
+		if err != nil {
+			return total, err
+		}
+		if n < w.batchSize {
+			break
+		}
+	}
+	w.lastRun.Store(now.Unix())
+	if total > 0 {
+		log.Printf("retention: deleted %d click events from before %s", total, before.Format(time.DateOnly))
+	}
+	return total, ctx.Err()
+}
+
+// Pruned returns how many click events the pruner has deleted since it
+// started.
+func (w *ClickPruner) Pruned() int64 {
+	return w.pruned.Load()
+}
+
+// LastRun returns when the pruner last completed a run, or the zero time
+// before the first.
+func (w *ClickPruner) LastRun() time.Time {
+	if t := w.lastRun.Load(); t != 0 {
+		return time.Unix(t, 0).UTC()
+	}
+	return time.Time{}
+}
+
+// Run prunes every interval until ctx is cancelled.
+func (w *ClickPruner) Run(ctx context.Context, interval time.Duration) {
+	Every(ctx, "retention", interval, func(ctx context.Context) error {
+		_, err := w.RunOnce(ctx)
+		return err
+	})
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+func TestClickPruner_RunOnce(t *testing.T) {
+	r := repo.NewMemory()
+	ctx := context.Background()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	old := today.AddDate(0, 0, -3).Add(23 * time.Hour)
+	kept := today.AddDate(0, 0, -2).Add(time.Minute)
+	r.InsertClicks(ctx, []model.ClickEvent{
+		{Code: "AbC123", ClickedAt: old},
+		{Code: "AbC123", ClickedAt: old},
+		{Code: "AbC123", ClickedAt: old},
+		{Code: "AbC123", ClickedAt: kept},
+	})
+
+	pr := NewClickPruner(r, 2, 2)
+	n, err := pr.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 3 || pr.Pruned() != 3 || pr.LastRun().IsZero() {
+		t.Errorf("expected 3 events pruned across batches, got n=%d pruned=%d last run %v", n, pr.Pruned(), pr.LastRun())
+	}
+	if n, _ := r.CountClicks(ctx, "AbC123"); n != 1 {
+		t.Errorf("expected the retained event to stay, got %d", n)
+	}
+
+	// The pruned events were rolled up first, and stay counted after
+	// another rollup.
+	r.RollupClicks(ctx)
+	days, _ := r.DailyClicks(ctx, "AbC123", old, kept)
+	want := []model.DailyClicks{{Day: old.Format(time.DateOnly), Clicks: 3}, {Day: kept.Format(time.DateOnly), Clicks: 1}}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("expected %v, got %v", want, days)
+	}
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"urlshortener/urlshortener/internal/repo"
+)
+
+// ClickRollup periodically folds raw click events into per-day totals, so
+// daily stats stay one row per link and day however many clicks there are.
+type ClickRollup struct {
+	repo repo.ClickStatsRepo
+}
+
+func NewClickRollup(r repo.ClickStatsRepo) *ClickRollup {
+	return &ClickRollup{repo: r}
+}
+
+// RunOnce brings the daily totals up to date with the events written so far.
+func (w *ClickRollup) RunOnce(ctx context.Context) error {
+	return w.repo.RollupClicks(ctx)
+}
+
+// Run rolls up clicks every interval until ctx is cancelled.
+func (w *ClickRollup) Run(ctx context.Context, interval time.Duration) {
+	Every(ctx, "rollup", interval, w.RunOnce)
+}
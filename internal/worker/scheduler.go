@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ErrUnknownJob is returned for job names the scheduler does not have.
+var ErrUnknownJob = errors.New("unknown job")
+
+// Claimer decides which instance makes a shared job's scheduled run.
+type Claimer interface {
+	// Claim reports whether this instance runs job now; period is how
+	// long until its next run.
+	Claim(ctx context.Context, job string, period time.Duration) (bool, error)
+}
+
+// ParseSchedule parses a cron expression: five fields, minute to day of
+// week, or a descriptor such as @hourly or @every 5m.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// Scheduler runs jobs on cron schedules. Shared jobs, which work on data
+// every instance shares, only run where claim says so; the others run on
+// every instance. A job never overlaps itself: a run due while the last
+// one is still going is skipped.
+type Scheduler struct {
+	claim Claimer
+	jobs  map[string]*job
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	shared   bool
+	run      func(ctx context.Context) error
+	trigger  chan struct{}
+
+	mu     sync.Mutex
+	status model.JobStatus
+}
+
+// NewScheduler returns a Scheduler handing shared jobs out with claim.
+func NewScheduler(claim Claimer) *Scheduler {
+	return &Scheduler{claim: claim, jobs: make(map[string]*job)}
+}
+
+// Add registers run as the job name, due on spec. Jobs must be added before
+// Run is called.
+func (s *Scheduler) Add(name, spec string, shared bool, run func(ctx context.Context) error) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.jobs[name] = &job{
+		name: name, spec: spec, schedule: schedule, shared: shared, run: run,
+		trigger: make(chan struct{}, 1),
+		status:  model.JobStatus{Name: name, Schedule: spec, Shared: shared},
+	}
+	return nil
+}
+
+// Run runs the jobs until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}()
+	}
+	wg.Wait()
+}
+
+// Trigger runs the job name on this instance as soon as it is not running,
+// shared or not. Triggering it again before then does not add a run.
+func (s *Scheduler) Trigger(name string) error {
+	j, ok := s.jobs[name]
+	if !ok {
+		return ErrUnknownJob
+	}
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// JobStats returns the status of every job, by name.
+func (s *Scheduler) JobStats() []model.JobStatus {
+	stats := make([]model.JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		stats = append(stats, j.status)
+		j.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, k int) bool { return stats[i].Name < stats[k].Name })
+	return stats
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	for {
+		next := j.schedule.Next(time.Now())
+		j.mu.Lock()
+		j.status.NextRun = next
+		j.mu.Unlock()
+
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-j.trigger:
+			t.Stop()
+			s.runJob(ctx, j)
+		case now := <-t.C:
+			if j.shared {
+				ok, err := s.claim.Claim(ctx, j.name, j.schedule.Next(now).Sub(now))
+				if err != nil {
+					log.Printf("%s: %v", j.name, err)
+				}
+				if !ok {
+					continue
+				}
+			}
+			s.runJob(ctx, j)
+		}
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, j *job) {
+	j.mu.Lock()
+	j.status.Running = true
+	j.mu.Unlock()
+
+	start := time.Now()
+	err := j.run(ctx)
+	if err != nil {
+		log.Printf("%s: %v", j.name, err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastRun = &start
+	j.status.LastDuration = time.Since(start).Seconds()
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// claimNone is a Claimer for an instance that never gets shared jobs.
+type claimNone struct{}
+
+func (claimNone) Claim(context.Context, string, time.Duration) (bool, error) { return false, nil }
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler(claimNone{})
+	var local, shared atomic.Int32
+	s.Add("local", "@every 1s", false, func(context.Context) error {
+		local.Add(1)
+		return errors.New("boom")
+	})
+	s.Add("shared", "@every 1s", true, func(context.Context) error {
+		shared.Add(1)
+		return nil
+	})
+	if err := s.Add("bad", "every minute", false, nil); err == nil {
+		t.Error("expected an invalid schedule to be refused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(1200 * time.Millisecond)
+
+	// @every schedules run on whole seconds, so the first run may come early.
+	if local.Load() == 0 || shared.Load() != 0 {
+		t.Errorf("expected the local job to run and the shared one not to, got %d and %d runs", local.Load(), shared.Load())
+	}
+
+	// Triggered runs skip the claim.
+	if err := s.Trigger("shared"); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	if err := s.Trigger("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("expected ErrUnknownJob, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	if shared.Load() != 1 {
+		t.Errorf("expected the triggered job to run, got %d runs", shared.Load())
+	}
+
+	stats := s.JobStats()
+	if len(stats) != 2 || stats[0].Name != "local" || stats[1].Name != "shared" {
+		t.Fatalf("expected both jobs by name, got %+v", stats)
+	}
+	if st := stats[0]; st.Runs != int64(local.Load()) || st.Failures != st.Runs || st.LastError != "boom" || st.LastRun == nil || st.NextRun.IsZero() {
+		t.Errorf("expected the local job's failed run recorded, got %+v", st)
+	}
+	if st := stats[1]; st.Runs != 1 || st.Failures != 0 || st.Running {
+		t.Errorf("expected the shared job's run recorded, got %+v", st)
+	}
+}
@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+const (
+	// deliveryLease is how long a claimed delivery stays invisible to other
+	// workers; it must outlast one send.
+	deliveryLease = 2 * time.Minute
+	retryBase     = 30 * time.Second
+	retryMax      = 6 * time.Hour
+	maxErrorLen   = 1024
+)
+
+// WebhookSender sends one delivery and reports the endpoint's status code.
+type WebhookSender interface {
+	Send(ctx context.Context, d model.WebhookDelivery) (int, error)
+}
+
+// WebhookDeliverer sends pending webhook deliveries, retrying failures with
+// exponential backoff until maxAttempts is reached.
+type WebhookDeliverer struct {
+	repo        repo.WebhookRepo
+	sender      WebhookSender
+	maxAttempts int
+	batchSize   int
+}
+
+func NewWebhookDeliverer(r repo.WebhookRepo, s WebhookSender, maxAttempts, batchSize int) *WebhookDeliverer {
+	return &WebhookDeliverer{repo: r, sender: s, maxAttempts: maxAttempts, batchSize: batchSize}
+}
+
+// RunOnce sends one batch of due deliveries and returns how many succeeded.
+func (w *WebhookDeliverer) RunOnce(ctx context.Context) (int, error) {
+	ds, err := w.repo.ClaimDeliveries(ctx, time.Now(), deliveryLease, w.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, d := range ds {
+		status, sendErr := w.sender.Send(ctx, d)
+
+		d.Attempts++
+		d.LastStatusCode = status
+		now := time.Now()
+		switch {
+		case sendErr == nil:
+			d.Status = model.DeliveryDelivered
+			d.LastError = ""
+			d.DeliveredAt = &now
+			n++
+		case d.Attempts >= w.maxAttempts:
+			d.Status = model.DeliveryFailed
+			d.LastError = truncateError(sendErr)
+			log.Printf("webhook: giving up on %s to %s after %d attempts: %v", d.Event, d.Endpoint, d.Attempts, sendErr)
+		default:
+			d.LastError = truncateError(sendErr)
+			d.NextAttemptAt = now.Add(backoff(d.Attempts))
+		}
+
+		if err := w.repo.UpdateDelivery(ctx, d); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Run delivers a batch every interval until ctx is cancelled.
+func (w *WebhookDeliverer) Run(ctx context.Context, interval time.Duration) {
+	Every(ctx, "webhook", interval, func(ctx context.Context) error {
+		_, err := w.RunOnce(ctx)
+		return err
+	})
+}
+
+// backoff doubles the retry delay with every attempt: 30s, 1m, 2m, ... up to 6h.
+func backoff(attempts int) time.Duration {
+	d := retryBase
+	for i := 1; i < attempts && d < retryMax; i++ {
+		d *= 2
+	}
+	return min(d, retryMax)
+}
+
+func truncateError(err error) string {
+	s := err.Error()
+	if len(s) > maxErrorLen {
+		s = s[:maxErrorLen]
+	}
+	return s
+}
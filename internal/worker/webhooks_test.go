@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortener/urlshortener/internal/model"
+	"urlshortener/urlshortener/internal/repo"
+)
+
+type stubSender struct {
+	fail  map[string]bool
+	sends int
+}
+
+func (s *stubSender) Send(ctx context.Context, d model.WebhookDelivery) (int, error) {
+	s.sends++
+	if s.fail[d.Endpoint] {
+		return 503, errors.New("endpoint returned 503 Service Unavailable")
+	}
+	return 200, nil
+}
+
+func TestWebhookDeliverer_RunOnce(t *testing.T) {
+	r := repo.NewMemory()
+	ctx := context.Background()
+
+	r.EnqueueDeliveries(ctx, []model.WebhookDelivery{
+		{ID: "ok", Endpoint: "https://ok.example/", Event: model.EventLinkCreated, Payload: "{}"},
+		{ID: "down", Endpoint: "https://down.example/", Event: model.EventLinkCreated, Payload: "{}"},
+	})
+
+	sender := &stubSender{fail: map[string]bool{"https://down.example/": true}}
+	wd := NewWebhookDeliverer(r, sender, 2, 10)
+
+	n, err := wd.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 1 || sender.sends != 2 {
+		t.Fatalf("expected 1 of 2 sends to succeed, got %d of %d", n, sender.sends)
+	}
+
+	// The failed delivery backs off, so nothing is due right away.
+	if n, _ := wd.RunOnce(ctx); n != 0 || sender.sends != 2 {
+		t.Fatalf("expected no retry before the backoff elapses, got %d sends", sender.sends)
+	}
+
+	ds, _ := r.ClaimDeliveries(ctx, time.Now().Add(time.Hour), time.Minute, 10)
+	if len(ds) != 1 || ds[0].ID != "down" || ds[0].Attempts != 1 || ds[0].LastStatusCode != 503 || ds[0].LastError == "" {
+		t.Fatalf("expected the failed delivery to be pending with its error recorded, got %+v", ds)
+	}
+
+	// Make it due again and let it fail for the last time.
+	ds[0].NextAttemptAt = time.Now().Add(-time.Second)
+	r.UpdateDelivery(ctx, ds[0])
+	wd.RunOnce(ctx)
+
+	if left, _ := r.ClaimDeliveries(ctx, time.Now().Add(24*time.Hour), time.Minute, 10); len(left) != 0 {
+		t.Errorf("expected the delivery to be given up after max attempts, got %+v", left)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 20: 6 * time.Hour}
+	for attempts, want := range cases {
+		if got := backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
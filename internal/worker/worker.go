@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs fn once per interval until ctx is cancelled. Errors are logged
+// and do not stop the loop.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := fn(ctx); err != nil {
+				log.Printf("%s: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package site holds the web front end served at the root, built into the
+// binary so it runs from any working directory.
+package site
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+//go:embed *.html *.ico *.png *.txt *.webmanifest
+var files embed.FS
+
+// FS returns the site's files. Files in dir, when set, take the place of the
+// built-in ones of the same name, so a deployment can brand the front end
+// without rebuilding.
+func FS(dir string) fs.FS {
+	if dir == "" {
+		return files
+	}
+	return overlay{top: os.DirFS(dir), base: files}
+}
+
+// overlay opens files from top, falling back to base for those top lacks.
+type overlay struct {
+	top, base fs.FS
+}
+
+func (o overlay) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}